@@ -0,0 +1,51 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+// textual markers used in accessible mode
+const (
+	// marks the line of a script or code snippet that caused an error
+	highlightMarker = ">> "
+
+	// marks text that was cut to fit the terminal
+	cutMarker = "..."
+)
+
+// check if output should be plain text for screen readers
+// without colors, ascii art, box-drawing characters and symbols
+func accessible() bool {
+	return conf != nil && conf.fields.Accessible
+}
+
+// return the symbol, or the textual marker in accessible mode
+func marker(symbol, text string) string {
+	if accessible() {
+		return text
+	}
+	return symbol
+}
+
+// print the ascii art and version
+func printBanner() {
+	if accessible() {
+		l.Println("ZEUS v" + version)
+		return
+	}
+	l.Println(cp.Text + asciiArt + "v" + version)
+}
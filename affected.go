@@ -0,0 +1,189 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// affectedFlagSince sets the revision to compare against
+	affectedFlagSince = "--since"
+
+	// affectedFlagList prints the affected commands without running them
+	affectedFlagList = "--list"
+)
+
+// ErrNoAffectedRevision occurs when the affected builtin is used without a revision
+var ErrNoAffectedRevision = errors.New("no revision to compare against")
+
+func printAffectedCommandUsageErr() {
+	l.Println(ErrInvalidUsage)
+	l.Println("usage: affected " + affectedFlagSince + " <ref> [" + affectedFlagList + "]")
+}
+
+// handle the affected builtin
+// runs all commands whose inputs changed since the given revision, and the commands that depend on them
+func handleAffectedCommand(args []string) error {
+
+	var (
+		ref  string
+		list bool
+	)
+	for i := 1; i < len(args); i++ {
+		switch args[i] {
+		case affectedFlagSince:
+			if i+1 == len(args) {
+				printAffectedCommandUsageErr()
+				return ErrNoAffectedRevision
+			}
+			i++
+			ref = args[i]
+		case affectedFlagList:
+			list = true
+		default:
+			printAffectedCommandUsageErr()
+			return ErrInvalidUsage
+		}
+	}
+	if ref == "" {
+		printAffectedCommandUsageErr()
+		return ErrNoAffectedRevision
+	}
+
+	files, err := projectVCS().changedFiles(ref)
+	if err != nil {
+		return err
+	}
+
+	affected := affectedCommands(files)
+	if len(affected) == 0 {
+		l.Println("no commands affected by changes since " + ref)
+		return nil
+	}
+
+	targets := affectedTargets(affected)
+	if list {
+		l.Println(cp.Prompt + pad("command", 25) + "target" + cp.Text)
+		for _, name := range affected {
+			var target string
+			for _, t := range targets {
+				if t == name {
+					target = "yes"
+				}
+			}
+			l.Println(pad(name, 25) + target)
+		}
+		return nil
+	}
+
+	l.Println(cp.Text + "affected by changes since " + cp.Prompt + ref + cp.Text + ": " + cp.Prompt + strings.Join(targets, commandChainSeparator) + cp.Reset)
+
+	cmdChain, ok := validCommandChain(targets)
+	if !ok {
+		return errors.New("invalid commandChain: " + strings.Join(targets, commandChainSeparator))
+	}
+	return cmdChain.exec(targets)
+}
+
+// check if a file matches an input of a command
+// inputs are glob patterns or paths of files and directories
+func matchInput(input, file string) bool {
+	input = filepath.Clean(input)
+	if isGlob(input) {
+		return matchGlob(input, file)
+	}
+	return input == "." || file == input || strings.HasPrefix(file, input+string(filepath.Separator))
+}
+
+// collect the commands whose inputs match one of the files
+// and all commands that depend on them, in sorted order
+func affectedCommands(files []string) (names []string) {
+
+	cmdMap.Lock()
+	var cmds []*command
+	for _, cmd := range cmdMap.items {
+		cmds = append(cmds, cmd)
+	}
+	cmdMap.Unlock()
+
+	var affected = make(map[string]bool, 0)
+	for _, cmd := range cmds {
+	inputs:
+		for _, input := range cmd.inputs {
+			for _, file := range files {
+				if matchInput(input, file) {
+					affected[cmd.name] = true
+					break inputs
+				}
+			}
+		}
+	}
+
+	// add dependents, commands with invalid dependencies can not run and are skipped
+	for _, cmd := range cmds {
+		deps, err := validDeepDependencies(cmd)
+		if err != nil {
+			Log.Warn("skipping " + cmd.name + ": " + err.Error())
+			continue
+		}
+		for _, dep := range deps {
+			if fields := strings.Fields(dep); len(fields) > 0 && affected[fields[0]] {
+				affected[cmd.name] = true
+			}
+		}
+	}
+
+	for name := range affected {
+		names = append(names, name)
+	}
+	sortCommandNames(names)
+	return
+}
+
+// reduce the affected commands to the ones that are not a dependency of another affected command
+// running them executes the remaining commands as dependencies
+func affectedTargets(affected []string) (targets []string) {
+
+	var isDependency = make(map[string]bool, 0)
+	for _, name := range affected {
+		cmd, err := cmdMap.getCommand(name)
+		if err != nil {
+			continue
+		}
+		deps, err := validDeepDependencies(cmd)
+		if err != nil {
+			continue
+		}
+		for _, dep := range deps {
+			if fields := strings.Fields(dep); len(fields) > 0 {
+				isDependency[fields[0]] = true
+			}
+		}
+	}
+
+	for _, name := range affected {
+		if !isDependency[name] {
+			targets = append(targets, name)
+		}
+	}
+	return
+}
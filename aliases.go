@@ -93,8 +93,8 @@ func printAliases() {
 		}
 	}
 
-	for name, command := range projectData.fields.Aliases {
-		l.Println(pad(name, maxLen+1), "=", command)
+	for _, name := range sortedKeys(projectData.fields.Aliases) {
+		l.Println(pad(name, maxLen+1), "=", projectData.fields.Aliases[name])
 	}
 
 	projectData.Unlock()
@@ -0,0 +1,353 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// number of runs kept by the API
+const maxAPIRuns = 100
+
+var (
+	// ErrUnauthorized occurs when an API request has no valid token
+	ErrUnauthorized = errors.New("unauthorized")
+
+	// ErrUnknownRun occurs when the status of a run that does not exist is requested
+	ErrUnknownRun = errors.New("unknown run")
+
+	// ErrContentTypeJSON occurs when a request that changes state is not sent as JSON
+	ErrContentTypeJSON = errors.New("content type must be application/json")
+
+	// ErrNoLogs occurs when there are no logs for a command
+	ErrNoLogs = errors.New("no logs found, set the logDir config field to enable logging")
+
+	// runs started over the API
+	apiRuns = &apiRunStore{
+		items: make(map[string]*apiRun, 0),
+	}
+)
+
+// run states
+const (
+	runStatusRunning   = "running"
+	runStatusSucceeded = "succeeded"
+	runStatusFailed    = "failed"
+	runStatusCanceled  = "canceled"
+)
+
+// apiRun is a command run started over the API
+type apiRun struct {
+	ID        string     `json:"id"`
+	Command   string     `json:"command"`
+	Arguments []string   `json:"arguments"`
+	Status    string     `json:"status"`
+	Start     time.Time  `json:"start"`
+	End       *time.Time `json:"end,omitempty"`
+	Error     string     `json:"error,omitempty"`
+	ExitCode  int        `json:"exitCode"`
+}
+
+// apiRunStore keeps the latest runs in memory
+type apiRunStore struct {
+	items map[string]*apiRun
+	order []string
+	sync.Mutex
+}
+
+// graph of all commands and their dependencies
+type apiGraph struct {
+	Nodes []string        `json:"nodes"`
+	Edges []*apiGraphEdge `json:"edges"`
+}
+
+// apiGraphEdge points from a command to one of its dependencies
+type apiGraphEdge struct {
+	From      string   `json:"from"`
+	To        string   `json:"to"`
+	Arguments []string `json:"arguments,omitempty"`
+}
+
+// add the API routes to the router
+// all routes require authentication, the routes that change state also a JSON content type
+func addAPIRoutes(r *httprouter.Router) {
+	r.Handler("GET", "/api/commands", apiAuth(apiCommandsHandler))
+	r.Handler("GET", "/api/graph", apiAuth(apiGraphHandler))
+	r.Handler("POST", "/api/run", apiAuth(apiJSON(apiRunHandler)))
+	r.Handler("GET", "/api/runs", apiAuth(apiRunsHandler))
+	r.Handler("GET", "/api/runs/:id", apiAuth(apiRunStatusHandler))
+	r.Handler("GET", "/api/logs/:command", apiAuth(apiLogsHandler))
+	r.Handler("GET", "/api/procs", apiAuth(apiProcsHandler))
+	r.Handler("POST", "/api/procs/:pid/kill", apiAuth(apiJSON(apiKillHandler)))
+}
+
+// create a router that only serves the API
+func createAPIRouter() *httprouter.Router {
+	r := httprouter.New()
+	addAPIRoutes(r)
+	return r
+}
+
+// requests from the local machine to a local host name are always allowed
+// remote requests must supply the apiToken from the config as bearer token
+func apiAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(r) {
+			writeJSONError(w, http.StatusUnauthorized, ErrUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func authorized(r *http.Request) bool {
+	return validAPIToken(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")) || isLocalRequest(r)
+}
+
+// a JSON content type can not be sent cross origin without a preflight request,
+// which protects the routes that change state against cross site requests
+func apiJSON(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+			writeJSONError(w, http.StatusUnsupportedMediaType, ErrContentTypeJSON)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// check a supplied token against the apiToken from the config
+// no token is valid if the apiToken is empty
+func validAPIToken(supplied string) bool {
+
+	conf.Lock()
+	token := conf.fields.APIToken
+	conf.Unlock()
+
+	return token != "" && subtle.ConstantTimeCompare([]byte(supplied), []byte(token)) == 1
+}
+
+// create and store a new run
+func (rs *apiRunStore) add(name string, args []string) *apiRun {
+
+	run := &apiRun{
+		ID:        randomString(),
+		Command:   name,
+		Arguments: args,
+		Status:    runStatusRunning,
+		Start:     time.Now(),
+	}
+
+	rs.Lock()
+	defer rs.Unlock()
+
+	rs.items[run.ID] = run
+	rs.order = append(rs.order, run.ID)
+
+	// drop the oldest runs
+	for len(rs.order) > maxAPIRuns {
+		delete(rs.items, rs.order[0])
+		rs.order = rs.order[1:]
+	}
+
+	return run
+}
+
+// set the outcome of a run
+// canceled runs keep their status
+func (rs *apiRunStore) finish(run *apiRun, err error) {
+
+	rs.Lock()
+	defer rs.Unlock()
+
+	end := time.Now()
+	run.End = &end
+	run.ExitCode = exitCode(err)
+	if err != nil {
+		run.Error = err.Error()
+	}
+
+	switch {
+	case run.Status == runStatusCanceled:
+	case err != nil:
+		run.Status = runStatusFailed
+	default:
+		run.Status = runStatusSucceeded
+	}
+}
+
+// get a copy of a run
+func (rs *apiRunStore) get(id string) (apiRun, bool) {
+	rs.Lock()
+	defer rs.Unlock()
+	if run, ok := rs.items[id]; ok {
+		return *run, true
+	}
+	return apiRun{}, false
+}
+
+// copies of all runs, latest first
+func (rs *apiRunStore) list() []apiRun {
+	rs.Lock()
+	defer rs.Unlock()
+	res := []apiRun{}
+	for i := len(rs.order) - 1; i >= 0; i-- {
+		res = append(res, *rs.items[rs.order[i]])
+	}
+	return res
+}
+
+// build the dependency graph of all commands
+func commandGraph() *apiGraph {
+
+	cmdMap.Lock()
+	defer cmdMap.Unlock()
+
+	graph := &apiGraph{
+		Nodes: []string{},
+		Edges: []*apiGraphEdge{},
+	}
+
+	for name := range cmdMap.items {
+		graph.Nodes = append(graph.Nodes, name)
+	}
+	sortCommandNames(graph.Nodes)
+
+	for _, name := range graph.Nodes {
+		for _, dep := range cmdMap.items[name].dependencies {
+			fields := strings.Fields(dep)
+			if len(fields) == 0 {
+				continue
+			}
+			graph.Edges = append(graph.Edges, &apiGraphEdge{
+				From:      name,
+				To:        fields[0],
+				Arguments: fields[1:],
+			})
+		}
+	}
+
+	return graph
+}
+
+// dependency graph of all commands
+var apiGraphHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, commandGraph())
+})
+
+// list the latest runs
+var apiRunsHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, apiRuns.list())
+})
+
+// status of a single run
+var apiRunStatusHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	run, ok := apiRuns.get(httprouter.ParamsFromContext(r.Context()).ByName("id"))
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, ErrUnknownRun)
+		return
+	}
+	writeJSON(w, http.StatusOK, run)
+})
+
+// serve the latest log of a command
+// the number of a previous log can be selected with ?n=, 1 is the latest
+var apiLogsHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+	var (
+		name = httprouter.ParamsFromContext(r.Context()).ByName("command")
+		logs = commandLogs(name)
+		n    = 1
+	)
+
+	if v := r.URL.Query().Get("n"); v != "" {
+		i, err := strconv.Atoi(v)
+		if err != nil || i < 1 {
+			writeJSONError(w, http.StatusBadRequest, errors.New("invalid log number: "+v))
+			return
+		}
+		n = i
+	}
+
+	if len(logs) < n {
+		writeJSONError(w, http.StatusNotFound, ErrNoLogs)
+		return
+	}
+
+	c, err := ioutil.ReadFile(logs[len(logs)-n])
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(c)
+})
+
+func printServeCommandUsageErr() {
+	l.Println(ErrInvalidUsage)
+	l.Println("usage: serve [--api] [--grpc] [--static <dir> [--port <port>] [--spa]]")
+}
+
+// run the web interface in the foreground, only the API with --api, the gRPC interface with --grpc
+// or a static file server for a directory with --static
+func handleServeCommand(args []string) {
+
+	switch {
+	case len(args) == 1:
+		StartWebListener(false)
+	case len(args) == 2 && args[1] == "--api":
+		conf.Lock()
+		addr := ":" + strconv.Itoa(conf.fields.PortWebPanel)
+		conf.Unlock()
+		showNote("serving API on "+addr, "starting server...")
+
+		err := http.ListenAndServe(addr, createAPIRouter())
+		if err != nil {
+			Log.WithError(err).Error("failed to listen")
+		}
+	case len(args) > 2 && args[1] == staticFlagDir:
+		d, err := parseStaticServerArgs(args)
+		if err != nil {
+			printServeCommandUsageErr()
+			return
+		}
+		err = serveStatic(d)
+		if err != nil {
+			Log.WithError(err).Error("failed to serve files")
+		}
+	case len(args) == 2 && args[1] == "--grpc":
+		err := serveGRPC()
+		if err != nil {
+			Log.WithError(err).Error("failed to serve gRPC")
+		}
+	default:
+		printServeCommandUsageErr()
+	}
+}
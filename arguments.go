@@ -22,6 +22,7 @@ import (
 	"bytes"
 	"errors"
 	"reflect"
+	"regexp"
 	"strconv"
 	"strings"
 
@@ -31,6 +32,27 @@ import (
 var (
 	// ErrDuplicateArgumentNames means the name for an argument was reused
 	ErrDuplicateArgumentNames = errors.New("duplicate argument name")
+
+	// ErrDecimalComma means a float was written with a comma as decimal separator
+	ErrDecimalComma = errors.New("use a dot as decimal separator: 1.5")
+
+	// ErrThousandsSeparator means a number was written with commas between the digits
+	ErrThousandsSeparator = errors.New("separate digits with underscores instead of commas: 1_000")
+
+	// ErrNotAnInteger means an integer argument got a value with a fraction or an exponent
+	ErrNotAnInteger = errors.New("not an integer")
+
+	// ErrNotANumber means a numeric argument got a value that is not a number
+	ErrNotANumber = errors.New("not a number")
+
+	// ErrNumberOutOfRange means the value does not fit into 64 bits
+	ErrNumberOutOfRange = errors.New("number out of range")
+
+	// ErrInvalidArgumentValue means the value is not one of the values declared for the argument
+	ErrInvalidArgumentValue = errors.New("invalid argument value")
+
+	// decimal digits, optionally separated by single underscores: 1_000_000
+	decimalDigits = regexp.MustCompile(`^[0-9]+(_[0-9]+)*$`)
 )
 
 // argument types
@@ -39,6 +61,9 @@ const (
 	argTypeInt    = "Int"
 	argTypeBool   = "Bool"
 	argTypeFloat  = "Float"
+
+	// a String that names a file or directory, completed with the paths on the prompt
+	argTypePath = "Path"
 )
 
 // a command argument has a name and a type and a value
@@ -54,6 +79,12 @@ type commandArg struct {
 	optional     bool
 	defaultValue string
 
+	// allowed values, declared in parentheses after the type: env:String(dev|prod)
+	values []string
+
+	// the value names a file or directory
+	path bool
+
 	// value after parsing argument input from commandline
 	value string
 }
@@ -77,78 +108,299 @@ func validateArgs(args []string) (map[string]*commandArg, error) {
 			return nil, errors.New("found empty argument at index: " + strconv.Itoa(i))
 		}
 
-		var (
-			k            reflect.Kind
-			slice        = strings.Split(s, ":")
-			opt          bool
-			defaultValue string
-		)
+		arg, err := parseArgument(s)
+		if err != nil {
+			return nil, err
+		}
 
-		if len(slice) == 2 {
+		// check for name conflicts with globals
+		g.Lock()
+		for name := range g.Vars {
+			if arg.name == name {
+				g.Unlock()
+				listGlobals()
+				return nil, errors.New("argument name " + arg.name + " conflicts with a global variable")
+			}
+		}
+		g.Unlock()
 
-			// argument name may contain leading whitespace - trim it
-			var argumentName = strings.TrimSpace(slice[0])
+		// check for duplicate argument names
+		if a, ok := validatedArgs[arg.name]; ok {
+			Log.Error("argument label ", a.name, " was used twice")
+			return nil, ErrDuplicateArgumentNames
+		}
 
-			// check for name conflicts with globals
-			g.Lock()
-			for name := range g.Vars {
-				if argumentName == name {
-					g.Unlock()
-					listGlobals()
-					return nil, errors.New("argument name " + argumentName + " conflicts with a global variable")
-				}
-			}
-			g.Unlock()
+		// add to validatedArgs
+		validatedArgs[arg.name] = arg
+	}
 
-			// check for duplicate argument names
-			if a, ok := validatedArgs[argumentName]; ok {
-				Log.Error("argument label ", a.name, " was used twice")
-				return nil, ErrDuplicateArgumentNames
-			}
+	return validatedArgs, nil
+}
 
-			// check if there's a default value set
-			defaultValSlice := strings.Split(slice[1], "=")
-			if len(defaultValSlice) > 1 {
-				if !strings.Contains(slice[1], "?") {
-					return nil, errors.New("default values for mandatory arguments are not allowed: " + s + ", at index: " + strconv.Itoa(i))
-				}
-				slice[1] = strings.TrimSpace(defaultValSlice[0])
-				defaultValue = defaultValSlice[1]
-			}
+// parse an argument declaration in the name:Type format
+// optionals are marked with a ? after the type and can have a default value: name:Type?=default
+// the allowed values can follow the type in parentheses: name:Type(a|b)
+func parseArgument(s string) (*commandArg, error) {
 
-			// check if its an optional arg
-			if strings.HasSuffix(slice[1], "?") {
-				slice[1] = strings.TrimSuffix(slice[1], "?")
-				opt = true
-			}
+	var (
+		k            reflect.Kind
+		slice        = strings.Split(s, ":")
+		opt          bool
+		defaultValue string
+		values       []string
+		path         bool
+	)
+
+	if len(slice) != 2 {
+		return nil, errors.New("invalid argument declaration: " + s)
+	}
 
-			// check if its a valid argType and set reflect.Kind
-			switch slice[1] {
-			case argTypeBool:
-				k = reflect.Bool
-			case argTypeFloat:
-				k = reflect.Float64
-			case argTypeString:
-				k = reflect.String
-			case argTypeInt:
-				k = reflect.Int
-			default:
-				return nil, errors.New("invalid or missing argument type: " + s)
+	// argument name may contain leading whitespace - trim it
+	var argumentName = strings.TrimSpace(slice[0])
+
+	// check if there's a default value set
+	defaultValSlice := strings.Split(slice[1], "=")
+	if len(defaultValSlice) > 1 {
+		if !strings.Contains(slice[1], "?") {
+			return nil, errors.New("default values for mandatory arguments are not allowed: " + s)
+		}
+		slice[1] = strings.TrimSpace(defaultValSlice[0])
+		defaultValue = defaultValSlice[1]
+	}
+
+	// check if its an optional arg
+	if strings.HasSuffix(slice[1], "?") {
+		slice[1] = strings.TrimSuffix(slice[1], "?")
+		opt = true
+	}
+
+	// check if the allowed values are declared
+	if i := strings.Index(slice[1], "("); i > 0 && strings.HasSuffix(slice[1], ")") {
+		for _, v := range strings.Split(slice[1][i+1:len(slice[1])-1], "|") {
+			if v = strings.TrimSpace(v); v == "" {
+				return nil, errors.New("empty value in the allowed values: " + s)
 			}
+			values = append(values, v)
+		}
+		slice[1] = slice[1][:i]
+	}
+
+	// check if its a valid argType and set reflect.Kind
+	switch slice[1] {
+	case argTypeBool:
+		k = reflect.Bool
+	case argTypeFloat:
+		k = reflect.Float64
+	case argTypeString:
+		k = reflect.String
+	case argTypeInt:
+		k = reflect.Int
+	case argTypePath:
+		k = reflect.String
+		path = true
+	default:
+		return nil, errors.New("invalid or missing argument type: " + s)
+	}
+
+	// allowed values are compared like supplied values
+	for i, v := range values {
+		value, err := normalizeArg(v, k)
+		if err != nil {
+			return nil, errors.New("invalid allowed value: " + argumentName + " expects " + argTypeName(k) + ", got " + strconv.Quote(v) + ": " + err.Error())
+		}
+		values[i] = value
+	}
+
+	// numeric defaults are passed like supplied values
+	if defaultValue != "" && (k == reflect.Int || k == reflect.Float64) {
+		value, err := normalizeArg(defaultValue, k)
+		if err != nil {
+			return nil, errors.New("invalid default value: " + argumentName + " expects " + argTypeName(k) + ", got " + strconv.Quote(strings.TrimSpace(defaultValue)) + ": " + err.Error())
+		}
+		defaultValue = value
+	}
+
+	arg := &commandArg{
+		name:         argumentName,
+		argType:      k,
+		optional:     opt,
+		defaultValue: defaultValue,
+		values:       values,
+		path:         path,
+	}
+
+	if defaultValue != "" && !arg.allows(strings.TrimSpace(defaultValue)) {
+		return nil, errors.New("invalid default value: " + argumentName + " expects one of " + strings.Join(values, ", ") + ", got " + strconv.Quote(strings.TrimSpace(defaultValue)))
+	}
+
+	return arg, nil
+}
+
+// check if the value is one of the allowed values, arguments without them allow every value
+// quotes around string values are ignored
+func (a *commandArg) allows(value string) bool {
+
+	if len(a.values) == 0 {
+		return true
+	}
+	if a.argType == reflect.String {
+		value = strings.Trim(value, "\"'")
+	}
+	for _, v := range a.values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// type of the argument as written in the CommandsFile, with the allowed values
+func (a *commandArg) typeName() string {
+
+	t := argTypeName(a.argType)
+	if a.path {
+		t = argTypePath
+	}
+	if len(a.values) > 0 {
+		t += "(" + strings.Join(a.values, "|") + ")"
+	}
+	return t
+}
+
+// name of the argument type, as written in the CommandsFile
+func argTypeName(k reflect.Kind) string {
+	switch k {
+	case reflect.Bool:
+		return argTypeBool
+	case reflect.Int:
+		return argTypeInt
+	case reflect.Float64:
+		return argTypeFloat
+	default:
+		return argTypeString
+	}
+}
 
-			// add to validatedArgs
-			validatedArgs[argumentName] = &commandArg{
-				name:         argumentName,
-				argType:      k,
-				optional:     opt,
-				defaultValue: defaultValue,
+// describe a value that does not match the type of an argument
+func argTypeError(name string, k reflect.Kind, value string, err error) error {
+	return errors.New(ErrInvalidArgumentType.Error() + ": " + name + " expects " + argTypeName(k) + ", got " + strconv.Quote(value) + ": " + err.Error())
+}
+
+// map the errors of the strconv package to the ones of the argument parser
+func numberError(err error) error {
+	if numErr, ok := err.(*strconv.NumError); ok && numErr.Err == strconv.ErrRange {
+		return ErrNumberOutOfRange
+	}
+	return ErrNotANumber
+}
+
+// parse an integer argument, the format does not depend on the locale
+// accepts a sign, underscores between digits and the 0x, 0o and 0b prefixes
+// a leading zero does not make the number octal, 010 is 10
+func parseIntArg(in string) (int64, error) {
+
+	var (
+		s    = strings.TrimSpace(in)
+		sign string
+	)
+	if strings.HasPrefix(s, "+") || strings.HasPrefix(s, "-") {
+		sign, s = s[:1], s[1:]
+	}
+
+	if len(s) > 2 && s[0] == '0' && strings.ContainsRune("xXoObB", rune(s[1])) {
+		i, err := strconv.ParseInt(sign+s, 0, 64)
+		if err != nil {
+			return 0, numberError(err)
+		}
+		return i, nil
+	}
+
+	if !decimalDigits.MatchString(s) {
+		switch {
+		case strings.Contains(s, ","):
+			return 0, ErrThousandsSeparator
+		case strings.ContainsAny(s, ".eE"):
+			if _, err := strconv.ParseFloat(s, 64); err == nil {
+				return 0, ErrNotAnInteger
 			}
-		} else {
-			return nil, errors.New("invalid argument declaration: " + s)
 		}
+		return 0, ErrNotANumber
 	}
 
-	return validatedArgs, nil
+	i, err := strconv.ParseInt(sign+strings.Replace(s, "_", "", -1), 10, 64)
+	if err != nil {
+		return 0, numberError(err)
+	}
+	return i, nil
+}
+
+// parse a float argument, the format does not depend on the locale
+// the decimal separator is a dot, underscores between digits and exponents are allowed
+func parseFloatArg(in string) (float64, error) {
+
+	s := strings.TrimSpace(in)
+
+	if strings.Contains(s, ",") {
+		if strings.Contains(s, ".") {
+			return 0, ErrThousandsSeparator
+		}
+		return 0, ErrDecimalComma
+	}
+
+	// infinity and NaN can't be passed to the scripts
+	switch strings.ToLower(strings.TrimLeft(s, "+-")) {
+	case "inf", "infinity", "nan":
+		return 0, ErrNotANumber
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, numberError(err)
+	}
+	return f, nil
+}
+
+// validate an argument value and return it in the format that is passed to the scripts
+// numbers are passed in decimal notation, so every language can read them
+func normalizeArg(in string, k reflect.Kind) (string, error) {
+	switch k {
+	case reflect.Int:
+		i, err := parseIntArg(in)
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatInt(i, 10), nil
+	case reflect.Float64:
+		f, err := parseFloatArg(in)
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatFloat(f, 'f', -1, 64), nil
+	default:
+		return in, validArgType(in, k)
+	}
+}
+
+// split the arguments of a command at the first --
+// everything after it is passed verbatim to the script
+// example: [name=test -- -run TestFoo -v] -> [name=test], [-run TestFoo -v]
+func splitExtraArgs(args []string) (parsed, extra []string) {
+	for i, a := range args {
+		if a == extraArgsSeparator {
+			return args[:i], args[i+1:]
+		}
+	}
+	return args, nil
+}
+
+// quote the extra arguments for the ZEUS_ARGS environment variable
+// shells restore them with: eval "set -- $ZEUS_ARGS"
+func quoteExtraArgs(extra []string) string {
+	quoted := make([]string, len(extra))
+	for i, a := range extra {
+		quoted[i] = shellQuote(a)
+	}
+	return strings.Join(quoted, " ")
 }
 
 // parse arguments array in the label=value format
@@ -160,6 +412,9 @@ func (c *command) parseArguments(args []string) (string, error) {
 		ocurrences = make(map[string]int, 0)
 	)
 
+	// extra arguments are passed to the script without validation
+	args, _ = splitExtraArgs(args)
+
 	// parse args
 	for _, val := range args {
 
@@ -190,11 +445,15 @@ func (c *command) parseArguments(args []string) (string, error) {
 				return "", errors.New("argument label appeared more than once: " + cmdArg.name)
 			}
 
-			if err := validArgType(argSlice[1], cmdArg.argType); err != nil {
-				return "", errors.New(ErrInvalidArgumentType.Error() + ": " + err.Error() + ", label=" + cmdArg.name + ", value=" + argSlice[1])
+			value, err := normalizeArg(argSlice[1], cmdArg.argType)
+			if err != nil {
+				return "", argTypeError(cmdArg.name, cmdArg.argType, argSlice[1], err)
+			}
+			if !cmdArg.allows(value) {
+				return "", errors.New(ErrInvalidArgumentValue.Error() + ": " + cmdArg.name + " expects one of " + strings.Join(cmdArg.values, ", ") + ", got " + strconv.Quote(argSlice[1]))
 			}
 
-			c.args[argSlice[0]].value = argSlice[1]
+			c.args[argSlice[0]].value = value
 		} else {
 			return "", errors.New("invalid argument: " + val)
 		}
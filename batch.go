@@ -0,0 +1,160 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// read the invocations for the batch builtin from stdin
+const batchStdin = "-"
+
+// set by the --stdin flag, same as: zeus batch -
+var batchFromStdin bool
+
+// outcome of a line in a batch
+type batchResult struct {
+	line     string
+	duration time.Duration
+	err      error
+
+	// not run because a previous line failed
+	skipped bool
+}
+
+func printBatchCommandUsageErr() {
+	l.Println(ErrInvalidUsage)
+	l.Println("usage: batch <file | ->")
+}
+
+// handle batch command
+// returns the error of the first failed line
+func handleBatchCommand(args []string) error {
+
+	if len(args) != 2 {
+		printBatchCommandUsageErr()
+		return ErrInvalidUsage
+	}
+
+	if args[1] == batchStdin {
+		return runBatch(os.Stdin)
+	}
+
+	f, err := os.Open(args[1])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return runBatch(f)
+}
+
+// run one invocation per line, empty lines and comments are ignored
+// the remaining lines are not run after a line failed
+// a summary for all lines is printed at the end
+func runBatch(r io.Reader) error {
+
+	var (
+		results  []*batchResult
+		firstErr error
+		scanner  = bufio.NewScanner(r)
+	)
+
+	for scanner.Scan() {
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		res := &batchResult{line: line}
+		results = append(results, res)
+
+		if firstErr != nil {
+			res.skipped = true
+			continue
+		}
+
+		start := time.Now()
+		res.err = runBatchLine(line)
+		res.duration = time.Since(start)
+
+		if res.err != nil {
+			l.Println(cp.Text + "batch: " + cp.Prompt + line + cp.Text + " failed: " + res.err.Error() + cp.Reset)
+			firstErr = res.err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	printBatchSummary(results)
+	return firstErr
+}
+
+// run a single line of a batch
+// unlike aliases, lines that are not commands or commandChains are not passed to the shell
+func runBatchLine(line string) error {
+
+	if !isCommandChain(line) {
+		name := strings.Fields(line)[0]
+		if _, err := cmdMap.getCommand(name); err != nil {
+			return errors.New(ErrUnknownCommand.Error() + ": " + name)
+		}
+	}
+
+	return runAlias(line)
+}
+
+// print the outcome of every line in the batch
+func printBatchSummary(results []*batchResult) {
+
+	if len(results) == 0 {
+		l.Println("batch: no commands.")
+		return
+	}
+
+	var failed, skipped int
+
+	l.Println(cp.Prompt + pad("status", 10) + pad("exit", 6) + pad("duration", 15) + "invocation" + cp.Text)
+	for _, res := range results {
+
+		var status, code, duration string
+		switch {
+		case res.skipped:
+			skipped++
+			status, code, duration = "skipped", "-", "-"
+		case res.err != nil:
+			failed++
+			status, code, duration = "failed", strconv.Itoa(exitStatus(res.err)), formatDuration(res.duration)
+		default:
+			status, code, duration = "ok", "0", formatDuration(res.duration)
+		}
+
+		l.Println(pad(status, 10) + pad(code, 6) + pad(duration, 15) + res.line)
+	}
+
+	l.Println(cp.Text + strconv.Itoa(len(results)) + " invocations, " + strconv.Itoa(failed) + " failed, " + strconv.Itoa(skipped) + " skipped" + cp.Reset)
+}
@@ -30,9 +30,16 @@ import (
 
 // bootstrap basic zeus setup
 // useful when starting from scratch
-func runBootstrapCommand() {
+// the commands and the config are generated from a profile for the type of the project
+func runBootstrapCommand(args []string) {
 
-	err := os.MkdirAll(scriptDir, 0700)
+	name, err := selectBootstrapProfile(args)
+	if err != nil {
+		Log.WithError(err).Fatal("failed to select a bootstrap profile")
+	}
+	profile := bootstrapProfiles[name]
+
+	err = os.MkdirAll(scriptDir, 0700)
 	if err != nil {
 		Log.WithError(err).Fatal("failed to create zeus directory")
 	}
@@ -42,45 +49,20 @@ func runBootstrapCommand() {
 		Log.WithError(err).Fatal("failed to create CommandsFile")
 	}
 	defer f.Close()
-	f.WriteString(asciiArtYAML + `
-
-# default language
-language: bash
-
-# globals for all commands
-globals:
-
-# command data
-commands:
-    
-    # build the binary
-    build:
-        description: build project
-        dependencies:
-            - clean
-        buildNumber: true
-        exec: |
-            echo "build the binary"
-
-    # clean up the mess
-    clean:
-        description: clean up to prepare for build
-        exec: rm -rf bin/*
-    
-    # perform install
-    install:
-        dependencies:
-            - clean
-        description: install to $PATH
-        help: Install the application to the default system location
-        exec: |
-            echo "perform install"
-`)
+	f.WriteString(asciiArtYAML + "\n" + fillTemplate(profile.commands, ""))
+
+	// keep an existing config
+	projectConfigPath = zeusDir + "/config.yml"
+	if _, err := os.Stat(projectConfigPath); err != nil {
+		profile.config().update()
+	}
+
+	l.Println("bootstrapped " + name + " project")
 }
 
 func printCreateCommandUsageErr() {
 	l.Println("usage:")
-	l.Println("zeus create [<language> <commandName>] [script <all> | <commandName>]")
+	l.Println("zeus create [<language> <commandName>] [script <all> | <commandName>] [command [--template <name> [<commandName>]]] [project --template <name>]")
 }
 
 // bootstrap a single new command
@@ -88,6 +70,17 @@ func printCreateCommandUsageErr() {
 // then drop into editor
 func handleCreateCommand(args []string) {
 
+	if len(args) > 1 {
+		switch args[1] {
+		case createTargetCommand:
+			handleCreateTargetCommand(args)
+			return
+		case createTargetProject:
+			handleCreateProjectCommand(args)
+			return
+		}
+	}
+
 	if len(args) < 3 {
 		printCreateCommandUsageErr()
 		return
@@ -165,26 +158,18 @@ func handleCreateCommand(args []string) {
 		_, err = os.Stat(commandsFilePath)
 		if err == nil {
 
-			// append command to CommandsFile
-			f, err := os.OpenFile(commandsFilePath, os.O_APPEND|os.O_WRONLY, 0744)
+			// add command to the commands section of the CommandsFile
+			err = addCommandEntry(args[2], []string{
+				"language: " + lang.Name,
+				"description:",
+				"help:",
+				"arguments:",
+				"dependencies:",
+				"outputs:",
+				"exec: implement " + args[2] + " command",
+			})
 			if err != nil {
-				Log.WithError(err).Error("failed to open CommandsFile for writing")
-				return
-			}
-
-			f.WriteString("\n" + `    ` + args[2] + `:
-        language: ` + lang.Name + `
-        description:
-        help:
-        arguments:
-        dependencies:
-        outputs:
-        exec: implement ` + args[2] + ` command
-`)
-
-			err = f.Close()
-			if err != nil {
-				l.Println(err)
+				Log.WithError(err).Error("failed to write CommandsFile")
 				return
 			}
 		} else {
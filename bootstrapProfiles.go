@@ -0,0 +1,331 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/dreadl0ck/readline"
+)
+
+const defaultBootstrapProfile = "default"
+
+// ErrUnknownBootstrapProfile occurs when bootstrap is called with a profile that does not exist
+var ErrUnknownBootstrapProfile = errors.New("unknown bootstrap profile")
+
+// bootstrapProfile is the setup for a type of project
+// {{project}} in the commands is replaced with the name of the project directory
+type bootstrapProfile struct {
+	description string
+	commands    string
+
+	// tune the default config, nil keeps the defaults
+	configure func(c *configFields)
+}
+
+var bootstrapProfiles = map[string]*bootstrapProfile{
+	defaultBootstrapProfile: {
+		description: "basic build, clean and install commands",
+		commands: `
+# default language
+language: bash
+
+# globals for all commands
+globals:
+
+# command data
+commands:
+    
+    # build the binary
+    build:
+        description: build project
+        dependencies:
+            - clean
+        buildNumber: true
+        exec: |
+            echo "build the binary"
+
+    # clean up the mess
+    clean:
+        description: clean up to prepare for build
+        exec: rm -rf bin/*
+    
+    # perform install
+    install:
+        dependencies:
+            - clean
+        description: install to $PATH
+        help: Install the application to the default system location
+        exec: |
+            echo "perform install"
+`,
+	},
+	"go": {
+		description: "Go module with go build, go test and go vet",
+		commands: `
+language: bash
+
+globals:
+    binary: bin/{{project}}
+    packages: ./...
+
+commands:
+
+    build:
+        description: build the binary
+        dependencies:
+            - clean
+        outputs:
+            - bin/{{project}}
+        exec: go build -o $binary .
+
+    clean:
+        description: remove the build artifacts
+        exec: rm -rf bin/*
+
+    test:
+        description: run the tests
+        exec: go test $packages
+
+    lint:
+        description: run go vet and check the formatting
+        exec: |
+            go vet $packages
+            test -z "$(gofmt -l .)"
+
+    release:
+        description: build the binaries for linux and darwin
+        dependencies:
+            - lint
+            - test
+            - clean
+        exec: |
+            for os in linux darwin; do
+                GOOS=$os GOARCH=amd64 go build -o $binary-$os-amd64 .
+            done
+`,
+		configure: func(c *configFields) {
+			c.LintOnSave = true
+			c.Reproducible = true
+		},
+	},
+	"node": {
+		description: "Node.js package with npm scripts",
+		commands: `
+language: bash
+
+globals:
+    NODE_ENV: development
+
+commands:
+
+    install:
+        description: install the dependencies
+        inputs:
+            - package-lock.json
+        outputs:
+            - node_modules
+        exec: npm ci
+
+    build:
+        description: build the package
+        dependencies:
+            - install
+        exec: npm run build
+
+    test:
+        description: run the tests
+        dependencies:
+            - install
+        exec: npm test
+
+    lint:
+        description: run eslint
+        dependencies:
+            - install
+        exec: npx eslint .
+
+    release:
+        description: pack the package into a tarball
+        dependencies:
+            - lint
+            - test
+            - build
+        exec: npm pack
+`,
+		configure: func(c *configFields) {
+			c.AutoFormat = true
+			c.LintOnSave = true
+		},
+	},
+	"python": {
+		description: "Python package in a virtualenv with pytest and flake8",
+		commands: `
+language: bash
+
+globals:
+    venv: .venv
+    python: .venv/bin/python
+
+commands:
+
+    install:
+        description: create the virtualenv and install the requirements
+        inputs:
+            - requirements.txt
+        exec: |
+            python3 -m venv $venv
+            $python -m pip install -r requirements.txt
+
+    build:
+        description: build the source distribution and the wheel
+        dependencies:
+            - install
+        exec: $python -m build
+
+    test:
+        description: run the tests
+        dependencies:
+            - install
+        exec: $python -m pytest
+
+    lint:
+        description: run flake8
+        dependencies:
+            - install
+        exec: $python -m flake8 .
+
+    release:
+        description: upload the distributions to the package index
+        dependencies:
+            - lint
+            - test
+            - build
+        exec: $python -m twine upload dist/*
+`,
+		configure: func(c *configFields) {
+			c.AutoFormat = true
+			c.LintOnSave = true
+		},
+	},
+	"docker": {
+		description: "container image built with docker",
+		commands: `
+language: bash
+
+globals:
+    image: {{project}}
+    tag: $(git rev-parse --short HEAD)
+
+commands:
+
+    build:
+        description: build the image
+        exec: docker build -t $image:$tag .
+
+    run:
+        description: run the image
+        dependencies:
+            - build
+        exec: docker run --rm -it $image:$tag
+
+    test:
+        description: check that the image starts
+        dependencies:
+            - build
+        exec: docker run --rm $image:$tag true
+
+    lint:
+        description: lint the Dockerfile with hadolint
+        exec: hadolint Dockerfile
+
+    release:
+        description: push the image
+        dependencies:
+            - lint
+            - test
+        exec: docker push $image:$tag
+
+    clean:
+        description: remove the image
+        exec: docker image rm $image:$tag
+`,
+		configure: func(c *configFields) {
+			c.PrefixOutput = true
+			c.GracePeriod = 30
+		},
+	},
+}
+
+// names of the bootstrap profiles, the default first
+func bootstrapProfileNames() []string {
+	var names []string
+	for name := range bootstrapProfiles {
+		if name != defaultBootstrapProfile {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return append([]string{defaultBootstrapProfile}, names...)
+}
+
+// get the profile from the commandline
+// without one the profile is asked for on a terminal, otherwise the default is used
+func selectBootstrapProfile(args []string) (string, error) {
+
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		if _, ok := bootstrapProfiles[args[0]]; !ok {
+			return "", errors.New(ErrUnknownBootstrapProfile.Error() + ": " + args[0] + ", available: " + strings.Join(bootstrapProfileNames(), ", "))
+		}
+		return args[0], nil
+	}
+
+	if ciModeDetected() || !readline.IsTerminal(int(os.Stdin.Fd())) {
+		return defaultBootstrapProfile, nil
+	}
+
+	for _, name := range bootstrapProfileNames() {
+		l.Println(pad(name, 10), bootstrapProfiles[name].description)
+	}
+	for {
+		name, err := ask("profile (" + defaultBootstrapProfile + "): ")
+		if err != nil {
+			return "", err
+		}
+		if name == "" {
+			return defaultBootstrapProfile, nil
+		}
+		if _, ok := bootstrapProfiles[name]; ok {
+			return name, nil
+		}
+		l.Println(ErrUnknownBootstrapProfile.Error() + ": " + name)
+	}
+}
+
+// the config of a profile, based on the defaults
+func (p *bootstrapProfile) config() *config {
+	c := newConfig()
+	if p.configure != nil {
+		p.configure(c.fields)
+	}
+	return c
+}
@@ -0,0 +1,219 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// partial lines are written after this delay, so prompts without a newline are visible
+const partialLineDelay = 100 * time.Millisecond
+
+// serializes the writes of all lineWriters for the terminal
+var terminalLock = &sync.Mutex{}
+
+// boundedBuffer collects output up to a fixed size
+// it keeps the first and the last half of the data and drops everything in between
+// a limit <= 0 means the buffer grows unbounded
+type boundedBuffer struct {
+	limit int
+
+	// first half of the data
+	head bytes.Buffer
+
+	// ring buffer for the last half of the data
+	tail   []byte
+	pos    int
+	filled bool
+
+	// total number of bytes written
+	total int64
+
+	sync.Mutex
+}
+
+// get the configured size for the stdErr buffer of commands
+func stdErrBufferSize() int {
+	conf.Lock()
+	defer conf.Unlock()
+	return conf.fields.StdErrBufferSize
+}
+
+func newBoundedBuffer(limit int) *boundedBuffer {
+	b := &boundedBuffer{
+		limit: limit,
+	}
+	if limit > 0 {
+		b.tail = make([]byte, limit-limit/2)
+	}
+	return b
+}
+
+// Write implements the io.Writer interface
+func (b *boundedBuffer) Write(p []byte) (int, error) {
+
+	b.Lock()
+	defer b.Unlock()
+
+	n := len(p)
+	b.total += int64(n)
+
+	if b.limit <= 0 {
+		return b.head.Write(p)
+	}
+
+	// fill the head first
+	if free := b.limit/2 - b.head.Len(); free > 0 {
+		if free > len(p) {
+			free = len(p)
+		}
+		b.head.Write(p[:free])
+		p = p[free:]
+	}
+
+	if len(p) == 0 {
+		return n, nil
+	}
+
+	// only the last bytes fit into the ring
+	if len(p) >= len(b.tail) {
+		copy(b.tail, p[len(p)-len(b.tail):])
+		b.pos = 0
+		b.filled = true
+		return n, nil
+	}
+
+	c := copy(b.tail[b.pos:], p)
+	if c < len(p) {
+		copy(b.tail, p[c:])
+		b.filled = true
+	}
+	b.pos = (b.pos + len(p)) % len(b.tail)
+	if b.pos == 0 {
+		b.filled = true
+	}
+
+	return n, nil
+}
+
+// String returns the head and the tail of the data
+// with a marker for the number of omitted bytes
+func (b *boundedBuffer) String() string {
+
+	b.Lock()
+	defer b.Unlock()
+
+	if b.limit <= 0 {
+		return b.head.String()
+	}
+
+	var tail []byte
+	if b.filled {
+		tail = append(append(tail, b.tail[b.pos:]...), b.tail[:b.pos]...)
+	} else {
+		tail = b.tail[:b.pos]
+	}
+
+	omitted := b.total - int64(b.head.Len()) - int64(len(tail))
+	if omitted <= 0 {
+		return b.head.String() + string(tail)
+	}
+
+	return b.head.String() + "\n... " + strconv.FormatInt(omitted, 10) + " bytes omitted ...\n" + string(tail)
+}
+
+// lineWriter forwards only complete lines to the underlying writer
+// writers sharing the same lock can not interleave in the middle of a line
+type lineWriter struct {
+	out   io.Writer
+	lock  *sync.Mutex
+	buf   bytes.Buffer
+	timer *time.Timer
+	sync.Mutex
+}
+
+func newLineWriter(out io.Writer, lock *sync.Mutex) *lineWriter {
+	return &lineWriter{
+		out:  out,
+		lock: lock,
+	}
+}
+
+// Write implements the io.Writer interface
+func (w *lineWriter) Write(p []byte) (int, error) {
+
+	w.Lock()
+	defer w.Unlock()
+
+	w.buf.Write(p)
+
+	data := w.buf.Bytes()
+	if i := bytes.LastIndexByte(data, '\n'); i >= 0 {
+		w.lock.Lock()
+		_, err := w.out.Write(data[:i+1])
+		w.lock.Unlock()
+		if err != nil {
+			return 0, err
+		}
+		w.buf.Next(i + 1)
+	}
+
+	// write a remaining partial line if no more data arrives
+	if w.buf.Len() > 0 {
+		if w.timer == nil {
+			w.timer = time.AfterFunc(partialLineDelay, w.flush)
+		} else {
+			w.timer.Reset(partialLineDelay)
+		}
+	}
+
+	return len(p), nil
+}
+
+// write all remaining output
+func (w *lineWriter) flush() {
+
+	w.Lock()
+	defer w.Unlock()
+
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+
+	if w.buf.Len() == 0 {
+		return
+	}
+
+	w.lock.Lock()
+	w.out.Write(w.buf.Bytes())
+	w.lock.Unlock()
+
+	w.buf.Reset()
+}
+
+// check if command output should be passed through without line buffering
+func rawOutput() bool {
+	conf.Lock()
+	defer conf.Unlock()
+	return conf.fields.RawOutput
+}
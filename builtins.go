@@ -59,6 +59,31 @@ const (
 	procsCommand      = "procs"
 	editCommand       = "edit"
 	generateCommand   = "generate"
+	logsCommand       = "logs"
+	profileCommand    = "profile"
+	historyCommand    = "history"
+	statsCommand      = "stats"
+	rerunCommand      = "rerun"
+	gitHooksCommand   = "githooks"
+	affectedCommand   = "affected"
+	serveCommand      = "serve"
+	lspCommand        = "lsp"
+	migrateCommand    = "migrate"
+	envCommand        = "env"
+	doctorCommand     = "doctor"
+	toolchainCommand  = "toolchain"
+	exportCommand     = "export"
+	gcCommand         = "gc"
+	batchCommand      = "batch"
+	secretsCommand    = "secrets"
+	dumpsCommand      = "dumps"
+	lintCommand       = "lint"
+	useCommand        = "use"
+	reportCommand     = "report"
+	optimizeCommand   = "optimize"
+	cmdCommand        = "cmd"
+	findCommand       = "find"
+	releaseCommand    = "release"
 )
 
 // mapped builtin names to description
@@ -67,7 +92,7 @@ var builtins = map[string]string{
 	helpCommand:       "print the command overview or the manualtext for a specific command",
 	clearCommand:      "clear the terminal screen",
 	infoCommand:       "print project info (lines of code + latest git commits)",
-	formatCommand:     "run the formatter for all scripts",
+	formatCommand:     "run the formatters for all scripts or the CommandsFile, or check if they are formatted",
 	globalsCommand:    "print the current globals",
 	configCommand:     "print or change the current config",
 	deadlineCommand:   "print or change the deadline",
@@ -76,7 +101,7 @@ var builtins = map[string]string{
 	eventsCommand:     "print, add or remove events",
 	dataCommand:       "print the current project data",
 	aliasCommand:      "print, add or remove aliases",
-	colorsCommand:     "change the current ANSI color profile",
+	colorsCommand:     "change or preview the ANSI color profiles",
 	makefileCommand:   "show or migrate GNU Makefiles",
 	authorCommand:     "print or change project author name",
 	keysCommand:       "manage keybindings",
@@ -84,16 +109,41 @@ var builtins = map[string]string{
 	webCommand:        "start web interface",
 	wikiCommand:       "start web wiki ",
 	createCommand:     "bootstrap single commands",
-	gitFilterCommand:  "filter git log output",
+	gitFilterCommand:  "filter the commit log",
 	todoCommand:       "manage todos",
-	updateCommand:     "update zeus version",
+	updateCommand:     "update zeus to the latest release of the update channel, or check for one",
 	procsCommand:      "manage spawned processes",
 	editCommand:       "edit scripts",
 	generateCommand:   "generate a standalone version of the script",
+	logsCommand:       "view the logs of the latest command runs",
+	profileCommand:    "print a timing breakdown of executed commands",
+	historyCommand:    "print the most recent command runs",
+	statsCommand:      "print statistics for all commands over the run history",
+	rerunCommand:      "run the latest invocation again or resume it at the failed command",
+	gitHooksCommand:   "install or remove the git hooks declared in the CommandsFile",
+	affectedCommand:   "run the commands affected by changes since a git revision",
+	serveCommand:      "serve the web interface, only the API or the gRPC interface",
+	lspCommand:        "run the language server for the CommandsFile on stdin and stdout",
+	migrateCommand:    "migrate a Makefile, Taskfile, Justfile or the scripts of a package.json into zeus commands",
+	envCommand:        "compare the current machine against the environment declared in the CommandsFile",
+	doctorCommand:     "check the environment, the tools required by the commands and the interpreters of their languages",
+	toolchainCommand:  "list, install or remove the tool versions pinned in the CommandsFile",
+	exportCommand:     "export the commands as a CI pipeline, or a command as a standalone runner script",
+	gcCommand:         "print the memory usage of zeus and return unused memory to the OS",
+	batchCommand:      "run one command or commandChain per line from a file or stdin and print a summary",
+	secretsCommand:    "list the secrets or store an encrypted value for a secret in the project data",
+	dumpsCommand:      "list, print or open the dumps of failed scripts",
+	lintCommand:       "run the linters of the languages over the scripts of the commands",
+	useCommand:        "list the environment profiles or select the one that is used for the commands",
+	reportCommand:     "summarize the commands, languages, dependency depth, largest scripts and unused commands",
+	optimizeCommand:   "suggest running independent steps of git hooks and aliases in parallel, based on the recorded durations",
+	cmdCommand:        "change the fields of commands in the CommandsFile, keeping its comments and formatting",
+	findCommand:       "fuzzy search the commands, aliases and builtins by name and description",
+	releaseCommand:    "attach the outputs of the commands with sbom: true, their checksums and SBOMs to a GitHub release",
 }
 
 // executed when running the info command
-// runs a count line of code and displays git info
+// runs a count line of code and displays the latest commits
 func printProjectInfo() {
 
 	cmd := exec.Command("cloc", "--exclude-dir=vendor,dist,node_modules,master,files", ".")
@@ -106,15 +156,25 @@ func printProjectInfo() {
 		return
 	}
 
-	cmd = exec.Command("git", "log", "-n", "5")
-	cmd.Stdout = os.Stdout
-	cmd.Stdin = os.Stdin
-	cmd.Stderr = os.Stderr
-	err = cmd.Run()
+	commits, err := projectVCS().log(5)
+	if err == ErrNoVCS {
+		return
+	}
 	if err != nil {
-		Log.WithError(err).Info("running git log failed.")
+		Log.WithError(err).Info("reading the commit log failed.")
 		return
 	}
+	printCommits(commits, "")
+}
+
+// print the commits containing the keyword, one per line
+func printCommits(commits []vcsCommit, keyword string) {
+	for _, c := range commits {
+		line := cp.Text + pad("["+c.date+"]", 35) + pad(c.author, 41) + c.subject
+		if strings.Contains(line, keyword) {
+			l.Println(line)
+		}
+	}
 }
 
 // print built-in commands
@@ -138,117 +198,12 @@ func printBuiltins() {
 
 	// print
 	for _, name := range names {
-		description := builtins[name]
-		l.Println(cp.CmdName + pad(name, width) + cp.Text + description)
+		description := wrapText(builtins[name], terminalWidth()-width, "")
+		l.Println(cp.CmdName + pad(name, width) + cp.Text + strings.Replace(description, "\n", "\n"+pad("", width), -1))
 	}
 	l.Println()
-}
-
-// print all available commands
-func printCommands() {
-
-	cmdMap.Lock()
-	defer cmdMap.Unlock()
-
-	if len(cmdMap.items) == 0 {
-		return
-	}
-
-	var (
-		sortedCommandKeys = make([]string, len(cmdMap.items))
-		index             = 0
-	)
-
-	// copy command names into array for sorting
-	for key := range cmdMap.items {
-		sortedCommandKeys[index] = key
-		index++
-	}
-
-	// sort alphabetically
-	sort.Strings(sortedCommandKeys)
-
-	// print them
-	l.Println(cp.Text + "commands")
-	printSortedCommandKeys(sortedCommandKeys)
-	l.Println("")
-}
-
-func printSortedCommandKeys(sortedCommandKeys []string) {
-
-	maxLen := 14
-
-	for i, key := range sortedCommandKeys {
-
-		var (
-			lastElem = i == len(sortedCommandKeys)-1
-			cmd      = cmdMap.items[key]
-		)
-
-		if conf.fields.Quiet {
-			var (
-				deps string
-			)
-			if len(cmd.dependencies) > 0 {
-				deps = cp.CmdFields + " [" + formatDependencies(cmd.dependencies) + "]"
-			}
-			if lastElem {
-				l.Print(cp.Text + "└─── " + cp.CmdName + cmd.name + " " + getArgumentString(cmd.args) + deps)
-			} else {
-				l.Print(cp.Text + "├─── " + cp.CmdName + cmd.name + " " + getArgumentString(cmd.args) + deps)
-			}
-
-		} else {
-
-			if lastElem {
-				l.Print(cp.Text + "└─── " + cp.CmdName + cmd.name + " " + getArgumentString(cmd.args) + cp.Text)
-			} else {
-				l.Print(cp.Text + "├─── " + cp.CmdName + cmd.name + " " + getArgumentString(cmd.args) + cp.Text)
-			}
-
-			if cmd.path != "" {
-				printLine(pad("path", maxLen)+cp.CmdFields+cmd.path, lastElem, !(len(cmd.dependencies) > 0) && !(len(cmd.outputs) > 0) && !cmd.async && !cmd.buildNumber && !(len(cmd.description) > 0))
-			}
-
-			if len(cmd.dependencies) > 0 {
-				printLine(pad("dependencies", maxLen)+cp.CmdFields+formatDependencies(cmd.dependencies), lastElem, !(len(cmd.outputs) > 0) && !cmd.async && !cmd.buildNumber && !(len(cmd.description) > 0))
-			}
-
-			if len(cmd.outputs) > 0 {
-				printLine(pad("outputs", maxLen)+cp.CmdFields+strings.Join(cmd.outputs, ", "), lastElem, !cmd.async && !cmd.buildNumber && !(len(cmd.description) > 0))
-			}
-
-			if cmd.async {
-				printLine(cp.CmdFields+"async", lastElem, !cmd.buildNumber && !(len(cmd.description) > 0))
-			}
-
-			if cmd.buildNumber {
-				printLine(cp.CmdFields+"buildNumber", lastElem, !(len(cmd.description) > 0))
-			}
-
-			if len(cmd.description) > 0 {
-				printLine(pad("description", maxLen)+cp.CmdFields+cmd.description, lastElem, true)
-			}
-
-			if !lastElem {
-				l.Println("|")
-			}
-		}
 
-	}
-}
-
-func printLine(line string, lastElem, lastItem bool) {
-	switch {
-	case lastElem && lastItem:
-		l.Println(cp.Text + "     └─── " + line + cp.Text)
-	case lastItem:
-		l.Println(cp.Text + "|    └─── " + line + cp.Text)
-	case lastElem:
-		l.Println(cp.Text + "     ├─── " + line + cp.Text)
-	default:
-		l.Println(cp.Text + "|    ├─── " + line + cp.Text)
-	}
+	printPluginBuiltins(width)
 }
 
 // format commandArg map into human readable string
@@ -265,7 +220,7 @@ func getArgumentString(args map[string]*commandArg) string {
 	)
 
 	for _, arg := range args {
-		var t = cp.CmdArgType + strings.Title(arg.argType.String())
+		var t = cp.CmdArgType + arg.typeName()
 		if arg.optional {
 			if arg.defaultValue != "" {
 				t += "?" + cp.CmdOutput + " =" + arg.defaultValue
@@ -294,33 +249,26 @@ func printGitFilterCommandUsageErr() {
 
 func handleGitFilterCommand(args []string) {
 
-	l.Println()
-
-	w := 35
-	l.Println(cp.Prompt + pad("time", w) + pad("author", 41) + "subject")
-	out, err := exec.Command("git", "log", "--pretty=format:"+cp.Text+pad("[%ci]", 13)+pad("%cn", w)+"%s").CombinedOutput()
-	if err != nil {
-		l.Println(err)
+	if len(args) > 2 {
+		printGitFilterCommandUsageErr()
 		return
 	}
 
-	if len(args) < 2 {
-		// print all
-		l.Println(string(out))
+	commits, err := projectVCS().log(0)
+	if err != nil {
+		l.Println(err)
 		return
 	}
 
-	if len(args) > 2 {
-		printGitFilterCommandUsageErr()
-		return
-	}
+	l.Println()
+	l.Println(cp.Prompt + pad("time", 35) + pad("author", 41) + "subject")
 
 	// filter output for lines containing the keyword
-	for _, line := range strings.Split(string(out), "\n") {
-		if strings.Contains(line, args[1]) {
-			l.Println(line)
-		}
+	var keyword string
+	if len(args) == 2 {
+		keyword = args[1]
 	}
+	printCommits(commits, keyword)
 }
 
 func printTodoCommandUsageErr() {
@@ -448,30 +396,10 @@ func handleTodoCommand(args []string) {
 	}
 }
 
-// run go get -u to get the latest ZEUS build from github
-func updateZeus() {
-
-	cmd := exec.Command("go", "get", "-u", "-v", "github.com/dreadl0ck/zeus")
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
-	cmd.Env = os.Environ()
-
-	l.Println("current version:", version)
-	l.Println("updating zeus...")
-	err := cmd.Run()
-	if err != nil {
-		Log.WithError(err).Fatal("failed to update zeus")
-	}
-
-	l.Println("zeus updated!")
-	cleanup()
-	os.Exit(0)
-}
-
 func printEditCommandUsageErr() {
 	l.Println("invalid usage")
 	l.Println("usage: edit <command>")
+	l.Println("       edit " + editTargetScratch + " [<language>]")
 }
 
 // start editor to edit files in the interactive shell
@@ -482,103 +410,110 @@ func handleEditCommand(args []string) {
 		return
 	}
 
-	var path string
-
-	// get editor from config
-	conf.Lock()
-	editor := conf.fields.Editor
-	conf.Unlock()
+	if args[1] == editTargetScratch {
+		err := handleScratchCommand(args)
+		if err != nil && err != ErrInvalidUsage {
+			l.Println(err)
+		}
+		return
+	}
 
-	cmdMap.Lock()
-	defer cmdMap.Unlock()
+	var (
+		loc    sourceLocation
+		editor = editorCommand()
+	)
 
 	switch args[1] {
 	case "config":
-		path = zeusDir + "/config.yml"
+		loc.path = zeusDir + "/config.yml"
 	case "commands":
-		path = commandsFilePath
+		loc.path = commandsFilePath
+		line, col, err := getYAMLFieldPosition("commands")
+		if err == nil {
+			loc.line, loc.col = line+1, col+1
+		}
 	case "todo":
 		conf.Lock()
-		path = conf.fields.TodoFilePath
+		loc.path = conf.fields.TodoFilePath
 		conf.Unlock()
 	case "data":
-		path = zeusDir + "/data.yml"
+		loc.path = zeusDir + "/data.yml"
 	case "globals":
-		if len(args) > 2 {
+		if len(args) > 2 && args[2] != "line" {
 
-			lang, err := ls.getLang(args[1])
+			lang, err := ls.getLang(args[2])
 			if err != nil {
 				l.Println(err)
 				return
 			}
 
-			path = zeusDir + "/globals/globals" + lang.FileExtension
+			loc.path = zeusDir + "/globals/globals" + lang.FileExtension
+			args = append(args[:2], args[3:]...)
 		} else {
-			path = commandsFilePath
+			loc.path = commandsFilePath
+			line, col, err := getYAMLFieldPosition("globals")
+			if err == nil {
+				loc.line, loc.col = line+1, col+1
+			}
 		}
 	default:
 		// check if its a valid command
-		if cmd, ok := cmdMap.items[args[1]]; ok {
-
-			// command has a path set?
-			if cmd.path == "" {
-				path = commandsFilePath
-			} else {
-				path = cmd.path
-
-				if _, err := os.Stat(cmd.path); err != nil {
-					path = commandsFilePath
-				}
-			}
-		} else {
+		cmd, err := cmdMap.getCommand(args[1])
+		if err != nil {
 			l.Println("invalid command:", args[1])
 			return
 		}
+		loc = commandSource(cmd)
 	}
 
-	// commmand is in commandsFile? let's start the editor at the correct position!
-	if path == commandsFilePath {
-
-		// check if editor supports starting at a position
-		// it could be supplied as a path, so we just check the path suffix
-		switch {
-		case strings.HasSuffix(editor, "vim"):
-			// find position of command in commandsfile
-			line, col, err := getYAMLFieldPosition(args[1])
-			if err != nil {
-				l.Println(err)
-				return
-			}
-			args = append(args, "+call cursor("+strconv.Itoa(line+1)+","+strconv.Itoa(col)+")")
-		case strings.HasSuffix(editor, "micro"):
-			// find position of command in commands file
-			line, col, err := getYAMLFieldPosition(args[1])
-			if err != nil {
-				l.Println(err)
-				return
-			}
-			args = append(args, "+"+strconv.Itoa(line+1)+":"+strconv.Itoa(col))
-		default: // not supported
+	// jump to the requested line
+	if len(args) > 2 {
+		if args[2] != "line" || len(args) != 4 {
+			printEditCommandUsageErr()
+			return
+		}
+		line, err := strconv.Atoi(args[3])
+		if err != nil || line < 1 {
+			printEditCommandUsageErr()
+			return
 		}
+		loc.line, loc.col = line, 1
 	}
 
-	var editorArgs []string
+	// commands are parsed again when their source changed
+	var (
+		reload = isCommandSource(loc.path)
+		before = modTime(loc.path)
+	)
 
-	// prepend args
-	if len(args) > 2 {
-		if args[2] == "line" {
-			if !(len(args) > 3) {
-				printEditCommandUsageErr()
-				return
-			}
-			editorArgs = append(editorArgs, "+"+args[3]+":0")
-		} else {
-			editorArgs = append(editorArgs, args[2:]...)
-		}
+	runEditor(editor, append(editorPositionArgs(editor, loc.line, loc.col), loc.path))
+
+	if reload {
+		reloadAfterEdit(loc.path, before)
+	}
+}
+
+// the editor from the config, $EDITOR when none is configured
+func editorCommand() string {
+
+	conf.Lock()
+	editor := conf.fields.Editor
+	conf.Unlock()
+
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vim"
 	}
+	return editor
+}
+
+// run the editor in the foreground, the last argument is the path of the file
+// vim is used when the editor fails
+func runEditor(editor string, editorArgs []string) {
 
-	// append path
-	editorArgs = append(editorArgs, path)
+	path := editorArgs[len(editorArgs)-1]
 
 	Log.Debug(editor, " ", editorArgs)
 
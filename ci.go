@@ -0,0 +1,332 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// marker used to find a previously posted summary comment
+const ciCommentMarker = "<!-- zeus-run-summary -->"
+
+var (
+	// ErrNoPullRequest means the current CI run does not belong to a pull request
+	ErrNoPullRequest = errors.New("no pull request found in CI environment")
+
+	// ErrNoCIToken means no token for the CI API is available
+	ErrNoCIToken = errors.New("GITHUB_TOKEN not set and no credential helper configured")
+)
+
+// ciConfig contains the settings for the CI integration
+type ciConfig struct {
+
+	// post the run summary as a pull request comment
+	Comment bool `yaml:"comment"`
+
+	// base URL of the GitHub API, defaults to $GITHUB_API_URL or https://api.github.com
+	APIURL string `yaml:"apiURL"`
+
+	// maximum number of stdErr lines included for each failed command
+	MaxDumpLines int `yaml:"maxDumpLines"`
+
+	// artifact names mapped to links, environment variables will be expanded
+	Artifacts map[string]string `yaml:"artifacts"`
+
+	// upload the merged SARIF report to GitHub code scanning
+	UploadSarif bool `yaml:"uploadSarif"`
+}
+
+func newCIConfig() *ciConfig {
+	return &ciConfig{
+		Comment:      true,
+		MaxDumpLines: 50,
+		Artifacts:    make(map[string]string, 0),
+	}
+}
+
+// check if zeus is running inside a CI environment with API access
+func ciEnvironmentDetected(c *ciConfig) bool {
+	return os.Getenv("CI") != "" && hasCredentials(githubAPI(c), "GITHUB_TOKEN")
+}
+
+// get the token for the GitHub API, from a credential helper or $GITHUB_TOKEN
+func githubToken(c *ciConfig) (string, error) {
+	token, err := credentialToken(githubAPI(c), "GITHUB_TOKEN")
+	if err != nil {
+		return "", err
+	}
+	if token == "" {
+		return "", ErrNoCIToken
+	}
+	return token, nil
+}
+
+// post the run summary as a pull request comment
+// and upload the SARIF report, if configured
+// errors are logged, but never fail the run
+func reportRunToCI(sarifPath string) {
+
+	conf.Lock()
+	c := conf.fields.CI
+	conf.Unlock()
+
+	if c == nil || !ciEnvironmentDetected(c) {
+		return
+	}
+
+	if c.UploadSarif && sarifPath != "" {
+		err := uploadSarif(c, sarifPath)
+		if err != nil {
+			Log.WithError(err).Warn("failed to upload SARIF report")
+		}
+	}
+
+	if !c.Comment {
+		return
+	}
+
+	records := runRecords.records()
+	if len(records) == 0 {
+		return
+	}
+
+	err := postCIComment(c, renderCISummary(c, records))
+	if err != nil {
+		Log.WithError(err).Warn("failed to post run summary to pull request")
+	}
+}
+
+// render the markdown for the run summary comment
+func renderCISummary(c *ciConfig, records []*runRecord) string {
+
+	var (
+		b      bytes.Buffer
+		failed []*runRecord
+	)
+
+	b.WriteString(ciCommentMarker + "\n")
+	b.WriteString("### ZEUS run summary\n\n")
+	b.WriteString("| command | status | duration |\n")
+	b.WriteString("| ------- | ------ | -------- |\n")
+
+	for _, r := range records {
+
+		var status string
+		switch {
+		case r.Skipped:
+			status = "skipped"
+		case r.Err != nil:
+			status = "**failed**"
+			failed = append(failed, r)
+		default:
+			status = "ok"
+		}
+
+		name := r.Name
+		if len(r.Args) > 0 {
+			name += " " + strings.Join(r.Args, " ")
+		}
+
+		b.WriteString("| `" + name + "` | " + status + " | " + formatDuration(r.Duration) + " |\n")
+	}
+
+	for _, r := range failed {
+		b.WriteString("\n<details><summary>" + r.Name + ": " + r.Err.Error() + "</summary>\n\n```\n")
+		b.WriteString(tailLines(r.StdErr, c.MaxDumpLines))
+		b.WriteString("\n```\n")
+		if len(r.Collected) > 0 {
+			b.WriteString("\nCollected files:\n\n")
+			for _, path := range r.Collected {
+				b.WriteString("- `" + path + "`\n")
+			}
+		}
+		b.WriteString("</details>\n")
+	}
+
+	if len(c.Artifacts) > 0 {
+
+		var names []string
+		for name := range c.Artifacts {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		b.WriteString("\n#### Artifacts\n\n")
+		for _, name := range names {
+			b.WriteString("- [" + name + "](" + os.ExpandEnv(c.Artifacts[name]) + ")\n")
+		}
+	}
+
+	return b.String()
+}
+
+// return the last n lines of a string
+// n <= 0 returns the complete input
+func tailLines(in string, n int) string {
+	lines := strings.Split(strings.TrimRight(in, "\n"), "\n")
+	if n > 0 && len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// determine the pull request number from the GitHub Actions environment
+func pullRequestNumber() (int, error) {
+
+	// refs/pull/<number>/merge
+	ref := os.Getenv("GITHUB_REF")
+	if strings.HasPrefix(ref, "refs/pull/") {
+		fields := strings.Split(ref, "/")
+		if len(fields) > 2 {
+			return strconv.Atoi(fields[2])
+		}
+	}
+
+	// fall back to the event payload
+	path := os.Getenv("GITHUB_EVENT_PATH")
+	if path == "" {
+		return 0, ErrNoPullRequest
+	}
+
+	c, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	var event struct {
+		PullRequest struct {
+			Number int `json:"number"`
+		} `json:"pull_request"`
+	}
+	err = json.Unmarshal(c, &event)
+	if err != nil {
+		return 0, err
+	}
+
+	if event.PullRequest.Number == 0 {
+		return 0, ErrNoPullRequest
+	}
+
+	return event.PullRequest.Number, nil
+}
+
+// get the base URL for the GitHub API
+func githubAPI(c *ciConfig) string {
+	api := c.APIURL
+	if api == "" {
+		api = os.Getenv("GITHUB_API_URL")
+	}
+	if api == "" {
+		api = "https://api.github.com"
+	}
+	return strings.TrimSuffix(api, "/")
+}
+
+// create or update the summary comment on the current pull request
+func postCIComment(c *ciConfig, body string) error {
+
+	token, err := githubToken(c)
+	if err != nil {
+		return err
+	}
+
+	repo := os.Getenv("GITHUB_REPOSITORY")
+	if repo == "" {
+		return errors.New("GITHUB_REPOSITORY not set")
+	}
+
+	number, err := pullRequestNumber()
+	if err != nil {
+		return err
+	}
+
+	api := githubAPI(c)
+
+	issueURL := api + "/repos/" + repo + "/issues/" + strconv.Itoa(number) + "/comments"
+
+	// look for a previous summary
+	var comments []struct {
+		ID   int    `json:"id"`
+		Body string `json:"body"`
+	}
+	err = githubRequest("GET", issueURL+"?per_page=100", token, nil, &comments)
+	if err != nil {
+		return err
+	}
+
+	payload := map[string]string{"body": body}
+
+	for _, comment := range comments {
+		if strings.Contains(comment.Body, ciCommentMarker) {
+			Log.Debug("updating run summary comment ", comment.ID)
+			return githubRequest("PATCH", api+"/repos/"+repo+"/issues/comments/"+strconv.Itoa(comment.ID), token, payload, nil)
+		}
+	}
+
+	Log.Debug("creating run summary comment on pull request ", number)
+	return githubRequest("POST", issueURL, token, payload, nil)
+}
+
+// perform a request against the GitHub API
+// the response body is decoded into out, if out is not nil
+func githubRequest(method, url, token string, in interface{}, out interface{}) error {
+
+	var body bytes.Buffer
+	if in != nil {
+		err := json.NewEncoder(&body).Encode(in)
+		if err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(method, url, &body)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", "token "+token)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return errors.New(method + " " + url + ": " + resp.Status)
+	}
+
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+
+	return nil
+}
@@ -0,0 +1,148 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ciMode disables everything that needs a human in front of a terminal
+// enabled with the --ci flag or when the CI environment variable is set
+var ciMode bool
+
+// check if zeus runs in a CI environment
+// most CI systems set CI=true, CI=false or CI=0 can be used to opt out
+func ciModeDetected() bool {
+	switch strings.ToLower(os.Getenv("CI")) {
+	case "", "0", "false", "no":
+		return false
+	}
+	return true
+}
+
+// ciModeFields are the config fields overridden by applyCIMode
+var ciModeFields = []string{"interactive", "colors", "stopOnError", "autoFormat", "webInterface"}
+
+// check if a config field is overridden in CI mode
+func isCIModeField(name string) bool {
+	for _, f := range ciModeFields {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+// override the config for non interactive use
+// the changes are never written to the config file
+func applyCIMode() {
+
+	if !ciMode {
+		return
+	}
+
+	conf.Lock()
+	conf.fields.Interactive = false
+	conf.fields.Colors = false
+	conf.fields.StopOnError = true
+	conf.fields.AutoFormat = false
+	conf.fields.WebInterface = false
+	conf.Unlock()
+}
+
+// start a collapsible section for the output of a command in the CI log
+// concurrent commands share the log, sections are only used for sequential output
+func ciGroupStart(name string) {
+
+	if !ciMode {
+		return
+	}
+	if prefix, _ := useMultiplexer(); prefix {
+		return
+	}
+
+	switch {
+	case os.Getenv("GITHUB_ACTIONS") == "true":
+		l.Println("::group::" + name)
+	case os.Getenv("GITLAB_CI") == "true":
+		l.Println("\033[0Ksection_start:" + strconv.FormatInt(time.Now().Unix(), 10) + ":" + ciJobID([]string{name}) + "\r\033[0K" + name)
+	}
+}
+
+// end the section started by ciGroupStart
+func ciGroupEnd(name string) {
+
+	if !ciMode {
+		return
+	}
+	if prefix, _ := useMultiplexer(); prefix {
+		return
+	}
+
+	switch {
+	case os.Getenv("GITHUB_ACTIONS") == "true":
+		l.Println("::endgroup::")
+	case os.Getenv("GITLAB_CI") == "true":
+		l.Println("\033[0Ksection_end:" + strconv.FormatInt(time.Now().Unix(), 10) + ":" + ciJobID([]string{name}) + "\r\033[0K")
+	}
+}
+
+// run an alias from the commandline
+// commands and commandChains report their errors, everything else is handled by the shell
+func runAlias(line string) error {
+
+	if isCommandChain(line) {
+		fields := strings.Split(line, commandChainSeparator)
+		cmdChain, ok := validCommandChain(fields)
+		if !ok {
+			return errors.New("invalid commandChain: " + line)
+		}
+		return cmdChain.exec(fields)
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return errors.New("empty alias")
+	}
+
+	cmd, err := cmdMap.getCommand(fields[0])
+	if err != nil {
+		handleLine(line)
+		return nil
+	}
+
+	count, err := getTotalDependencyCount(cmd)
+	if err != nil {
+		return err
+	}
+
+	err = s.begin()
+	if err != nil {
+		return err
+	}
+	defer s.end()
+	s.plan(count)
+	progressUI.plan(cmd)
+
+	return cmd.Run(fields[1:], cmd.async)
+}
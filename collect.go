@@ -0,0 +1,143 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// expand a path or glob pattern of the onFailureCollect field
+// in addition to the filepath.Match syntax, ** matches any number of directories
+func expandCollectPattern(pattern string) (matches []string, err error) {
+
+	pattern = os.ExpandEnv(pattern)
+
+	if !strings.Contains(pattern, "**") {
+		return filepath.Glob(pattern)
+	}
+
+	err = filepath.Walk(globBase(pattern), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// unreadable directories are skipped
+			return nil
+		}
+		if matchGlob(pattern, path) {
+			matches = append(matches, path)
+		}
+		return nil
+	})
+	return
+}
+
+// copy the files matching the onFailureCollect patterns of a command into the directory of the dump
+// directories are copied with their contents
+func (d *errorDump) collect(patterns []string) {
+
+	dumps, _ := filepath.Abs(dumpDir())
+
+	for _, pattern := range patterns {
+
+		matches, err := expandCollectPattern(pattern)
+		if err != nil {
+			Log.WithError(err).Error("invalid onFailureCollect pattern: ", pattern)
+			continue
+		}
+
+		for _, match := range matches {
+			err = filepath.Walk(match, func(path string, info os.FileInfo, err error) error {
+				if err != nil {
+					return nil
+				}
+
+				abs, err := filepath.Abs(path)
+				if err != nil {
+					return err
+				}
+				if info.IsDir() && abs == dumps {
+					return filepath.SkipDir
+				}
+				if !info.Mode().IsRegular() {
+					return nil
+				}
+
+				dst := filepath.Join(d.artifacts, collectedName(abs))
+				if err := copyFile(path, dst); err != nil {
+					return err
+				}
+
+				d.Collected = append(d.Collected, dst)
+				return nil
+			})
+			if err != nil {
+				Log.WithError(err).Error("failed to collect ", match)
+			}
+		}
+	}
+}
+
+// the path of a collected file below the directory of the dump
+// files in the working directory keep their relative path, others their absolute one
+func collectedName(abs string) string {
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, abs); err == nil && !strings.HasPrefix(rel, "..") {
+			return rel
+		}
+	}
+	return strings.TrimPrefix(abs, string(filepath.Separator))
+}
+
+// copy a file and create the directories for the destination
+func copyFile(src, dst string) error {
+
+	err := os.MkdirAll(filepath.Dir(dst), 0700)
+	if err != nil {
+		return err
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// the files in the directory with the collected files of a dump
+func (d *errorDump) collectedFiles() (files []string) {
+	filepath.Walk(d.artifacts, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return
+}
@@ -20,18 +20,32 @@ package main
 
 import (
 	"errors"
+	"fmt"
+	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/mgutz/ansi"
 )
 
+// subcommand of the colors builtin to show the profiles
+const colorsSubcommandPreview = "preview"
+
 var (
 	// global ANSI terminal color profile
 	cp = &ansiProfile{}
 
 	// ErrUnknownColorProfile means the color profile does not exist
 	ErrUnknownColorProfile = errors.New("unknown color profile")
+
+	// ErrInvalidColorStyle means a color of a profile does not follow the style format
+	ErrInvalidColorStyle = errors.New("invalid color style")
+
+	// attributes of the style format, colors are set by name, as number for 256 colors or as hex for truecolor
+	colorStyleAttributes = "bdBuish"
 )
 
 // ANSI Escape Sequence Representation of a ColorProfile
@@ -70,11 +84,54 @@ func printColorsUsageErr() {
 }
 
 func getAvailableColorProfiles() (res string) {
-	conf.Lock()
-	defer conf.Unlock()
-	for name := range conf.fields.ColorProfiles {
-		res += " | " + name
+	for _, name := range colorProfileNames() {
+		if name != "default" && name != "off" {
+			res += " | " + name
+		}
+	}
+	return res + " | " + colorsSubcommandPreview + " [<profile>]"
+}
+
+// the profiles that are always available
+func builtinColorProfiles() map[string]*ColorProfile {
+	return map[string]*ColorProfile{
+		"default": defaultProfile(),
+		"black":   blackProfile(),
+		"dark":    darkProfile(),
+		"light":   lightProfile(),
+		"off":     colorsOffProfile(),
+	}
+}
+
+// look up a color profile by name
+// the profiles from the config take precedence over the builtin ones, except for off
+func lookupColorProfile(profiles map[string]*ColorProfile, name string) (*ColorProfile, bool) {
+	if p, ok := profiles[name]; ok && name != "off" {
+		return p, true
+	}
+	p, ok := builtinColorProfiles()[name]
+	return p, ok
+}
+
+// names of the builtin and configured color profiles, sorted
+// the config is not loaded yet when completing on the commandline
+func colorProfileNames() (names []string) {
+
+	for name := range builtinColorProfiles() {
+		names = append(names, name)
+	}
+
+	if conf != nil {
+		conf.Lock()
+		for name := range conf.fields.ColorProfiles {
+			if _, ok := builtinColorProfiles()[name]; !ok {
+				names = append(names, name)
+			}
+		}
+		conf.Unlock()
 	}
+
+	sort.Strings(names)
 	return
 }
 
@@ -151,35 +208,34 @@ func handleColorsCommand(args []string) {
 		return
 	}
 
+	if args[1] == colorsSubcommandPreview {
+		printColorProfiles(args[2:])
+		return
+	}
+
 	var (
 		err     error
 		profile = args[1]
 	)
 
+	conf.Lock()
+	p, ok := lookupColorProfile(conf.fields.ColorProfiles, profile)
+	conf.Unlock()
+	if !ok {
+		Log.Error(ErrUnknownColorProfile)
+		return
+	}
+	if err = p.validate(); err != nil {
+		Log.Error(err)
+		return
+	}
+
+	// colors are enabled again when switching from the off profile
+	ansi.DisableColors(profile == "off")
+
 	// lock to prevent a race on the global ansiProfile instance
 	cp.Lock()
-	switch profile {
-	case "off":
-		cp = colorsOffProfile().parse()
-	case "default":
-		cp = defaultProfile().parse()
-	case "black":
-		cp = blackProfile().parse()
-	default:
-
-		// lookup profile name in config
-		conf.Lock()
-		if p, ok := conf.fields.ColorProfiles[profile]; ok {
-			conf.Unlock()
-			cp = p.parse()
-		} else {
-			// no change to colorProfile - Unlock it
-			cp.Unlock()
-			conf.Unlock()
-			Log.Error(ErrUnknownColorProfile)
-			return
-		}
-	}
+	cp = p.parse()
 	Log.Info("color profile set to: ", profile)
 
 	// update value in config
@@ -209,11 +265,11 @@ func handleColorsCommand(args []string) {
 
 	readlineMutex.Lock()
 	if rl != nil {
-		rl.SetPrompt(printPrompt())
+		rl.SetPrompt(refreshPrompt())
 		readlineMutex.Unlock()
 		clearScreen()
 
-		l.Println(cp.Text + asciiArt + "v" + version)
+		printBanner()
 
 		conf.Lock()
 		if conf.fields.Debug {
@@ -235,38 +291,217 @@ func initColorProfile() {
 	// look up current profile string from config
 	profile := conf.fields.ColorProfile
 
+	p, ok := lookupColorProfile(conf.fields.ColorProfiles, profile)
+	if !ok {
+		Log.Error(ErrUnknownColorProfile, " : ", profile)
+		return
+	}
+	if err := p.validate(); err != nil {
+		Log.Error(err)
+		return
+	}
+
 	// lock to prevent a race on the global ansiProfile instance
 	cp.Lock()
-	switch profile {
-	case "off":
-		cp = colorsOffProfile().parse()
+	cp = p.parse()
+	if profile == "off" {
 		cp.Reset = ""
-	case "default":
-		cp = defaultProfile().parse()
-	case "black":
-		cp = blackProfile().parse()
-	default:
-		if p, ok := conf.fields.ColorProfiles[profile]; ok {
-			cp = p.parse()
-		} else {
-			// no change to colorProfile - unlock it
-			cp.Unlock()
-			Log.Error(ErrUnknownColorProfile, " : ", conf.fields.ColorProfile)
-			return
-		}
 	}
 }
 
 // convert a ColorProfile to an ansiProfile
 func (cp *ColorProfile) parse() *ansiProfile {
 	return &ansiProfile{
-		Text:       ansi.ColorCode(cp.Text),
-		Prompt:     ansi.ColorCode(cp.Prompt),
-		CmdArgs:    ansi.ColorCode(cp.CmdArgs),
-		CmdArgType: ansi.ColorCode(cp.CmdArgType),
-		CmdFields:  ansi.ColorCode(cp.CmdFields),
-		CmdName:    ansi.ColorCode(cp.CmdName),
-		CmdOutput:  ansi.ColorCode(cp.CmdOutput),
+		Text:       colorCode(cp.Text),
+		Prompt:     colorCode(cp.Prompt),
+		CmdArgs:    colorCode(cp.CmdArgs),
+		CmdArgType: colorCode(cp.CmdArgType),
+		CmdFields:  colorCode(cp.CmdFields),
+		CmdName:    colorCode(cp.CmdName),
+		CmdOutput:  colorCode(cp.CmdOutput),
 		Reset:      ansi.Reset,
 	}
 }
+
+// the styles of a profile mapped to the field names
+func (cp *ColorProfile) styles() [][2]string {
+	return [][2]string{
+		{"Text", cp.Text},
+		{"Prompt", cp.Prompt},
+		{"CmdOutput", cp.CmdOutput},
+		{"CmdName", cp.CmdName},
+		{"CmdFields", cp.CmdFields},
+		{"CmdArgs", cp.CmdArgs},
+		{"CmdArgType", cp.CmdArgType},
+	}
+}
+
+// check that all colors of the profile follow the style format
+func (cp *ColorProfile) validate() error {
+	for _, style := range cp.styles() {
+		if err := validColorStyle(style[1]); err != nil {
+			return errors.New(style[0] + ": " + err.Error())
+		}
+	}
+	return nil
+}
+
+// check a style: "foregroundColor+attributes:backgroundColor+attributes"
+func validColorStyle(style string) error {
+
+	if style == "" || style == "off" || style == "reset" {
+		return nil
+	}
+
+	parts := strings.Split(style, ":")
+	if len(parts) > 2 {
+		return errors.New(ErrInvalidColorStyle.Error() + ": " + style)
+	}
+
+	for _, part := range parts {
+
+		color := strings.SplitN(part, "+", 2)
+		_, _, _, hex := parseHexColor(color[0])
+		switch {
+		case hex:
+		case strings.HasPrefix(color[0], "#"):
+			return errors.New(ErrInvalidColorStyle.Error() + ": invalid hex color " + color[0])
+		default:
+			if _, ok := ansi.Colors[color[0]]; !ok {
+				return errors.New(ErrInvalidColorStyle.Error() + ": unknown color \"" + color[0] + "\"")
+			}
+		}
+
+		if len(color) > 1 && strings.Trim(color[1], colorStyleAttributes) != "" {
+			return errors.New(ErrInvalidColorStyle.Error() + ": unknown attributes " + color[1])
+		}
+	}
+	return nil
+}
+
+// convert a style to its escape sequence
+// in addition to the format of the ansi package, colors can be given as hex: #rrggbb or #rgb.
+// They are used as is on truecolor terminals and mapped to the closest of the 256 colors on others
+func colorCode(style string) string {
+
+	var (
+		parts     = strings.Split(style, ":")
+		truecolor string
+	)
+	for i, part := range parts {
+
+		color := strings.SplitN(part, "+", 2)
+		r, g, b, ok := parseHexColor(color[0])
+		if !ok {
+			continue
+		}
+
+		// 38 for the foreground, 48 for the background
+		layer := 38 + 10*i
+		if trueColorTerminal() {
+			truecolor += fmt.Sprintf("\033[%d;2;%d;%d;%dm", layer, r, g, b)
+		} else {
+			truecolor += fmt.Sprintf("\033[%d;5;%dm", layer, ansi256(r, g, b))
+		}
+
+		// the ansi package handles the attributes
+		if i == 0 {
+			color[0] = "default"
+			parts[0] = strings.Join(color, "+")
+		} else {
+			parts = parts[:1]
+		}
+	}
+
+	code := ansi.ColorCode(strings.Join(parts, ":"))
+	if code == "" {
+		// colors are disabled
+		return ""
+	}
+	return code + truecolor
+}
+
+// parse a color in the format #rrggbb or #rgb
+func parseHexColor(color string) (r, g, b int, ok bool) {
+
+	if !strings.HasPrefix(color, "#") {
+		return
+	}
+
+	hex := color[1:]
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) != 6 {
+		return
+	}
+
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return
+	}
+	return int(v >> 16), int(v >> 8 & 0xff), int(v & 0xff), true
+}
+
+// check if the terminal supports 24 bit colors
+func trueColorTerminal() bool {
+	switch os.Getenv("COLORTERM") {
+	case "truecolor", "24bit":
+		return true
+	}
+	return false
+}
+
+// closest color of the 6x6x6 color cube of the 256 colors
+func ansi256(r, g, b int) int {
+	scale := func(v int) int {
+		return (v*5 + 127) / 255
+	}
+	return 16 + 36*scale(r) + 6*scale(g) + scale(b)
+}
+
+// colors preview [<profile>]
+// print a sample line in the colors of each profile, or of the given one
+func printColorProfiles(args []string) {
+
+	names := args
+	if len(names) == 0 {
+		names = colorProfileNames()
+	}
+
+	conf.Lock()
+	colors := conf.fields.Colors && !conf.fields.Accessible
+	current := conf.fields.ColorProfile
+	profiles := make(map[string]*ColorProfile, len(names))
+	for _, name := range names {
+		if p, ok := lookupColorProfile(conf.fields.ColorProfiles, name); ok {
+			profiles[name] = p
+		}
+	}
+	conf.Unlock()
+
+	if !colors {
+		l.Println("colors are disabled, the preview shows no colors.")
+	}
+
+	for _, name := range names {
+
+		p, ok := profiles[name]
+		if !ok {
+			l.Println(pad(name, 14), ErrUnknownColorProfile)
+			continue
+		}
+		if err := p.validate(); err != nil {
+			l.Println(pad(name, 14), err)
+			continue
+		}
+
+		label := "  "
+		if name == current {
+			label = marker("* ", "current: ")
+		}
+
+		a := p.parse()
+		l.Println(cp.Reset + label + pad(name, 12) + a.Prompt + "zeus » " + a.CmdName + "build " + a.CmdArgs + "name" + a.CmdArgType + ":String " + a.CmdFields + "description: " + a.Text + "some text " + a.CmdOutput + "output" + cp.Reset)
+	}
+}
@@ -19,7 +19,6 @@
 package main
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
 	"io"
@@ -30,6 +29,8 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/dreadl0ck/readline"
@@ -37,6 +38,20 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+const (
+	// orderOnlyPrefix marks dependencies that must not make a command stale
+	orderOnlyPrefix = "|"
+
+	// asyncDependencySuffix marks dependencies that are started without waiting for them
+	asyncDependencySuffix = "&"
+
+	// extraArgsSeparator separates the arguments of a command from the ones passed verbatim to the script
+	extraArgsSeparator = "--"
+
+	// extraArgsEnv contains the extra arguments, quoted for the shell
+	extraArgsEnv = "ZEUS_ARGS"
+)
+
 var (
 	// ErrInvalidArgumentType means the argument type does not match the expected type
 	ErrInvalidArgumentType = errors.New("invalid argument type")
@@ -52,6 +67,9 @@ var (
 
 	// ErrNoFileExtension means the script does not have a file extension
 	ErrNoFileExtension = errors.New("no file extension")
+
+	// async dependencies that are still running
+	asyncDependencies sync.WaitGroup
 )
 
 // command represents a parsed script in memory
@@ -77,6 +95,15 @@ type command struct {
 	// manual text
 	help string
 
+	// Markdown file with the manual, relative to the project directory
+	helpFile string
+
+	// invocations of the command, shown by the help builtin
+	examples []string
+
+	// command line that prints argument values for the completion
+	completionCmd string
+
 	// async means the command will be detached
 	async bool
 
@@ -89,18 +116,73 @@ type command struct {
 	// dependency commands will be executed prior to the command itself
 	dependencies []string
 
+	// dependencies that are run before the command, but never make it stale
+	// declared with the | prefix, like order-only prerequisites in GNU Make
+	orderOnly []string
+
+	// variables merged over the project globals
+	env      map[string]string
+	envTypes map[string]string
+
+	// dependencies that are started in the background, declared with the & suffix
+	// the command does not wait for them and their failure does not fail the command
+	asyncDeps []string
+
 	// output file(s) of the command
 	// if the file exists the command will not be executed
 	outputs []string
 
+	// condition to skip the command, evaluated before the outputs are checked
+	skipIf *expression
+
+	// input files of the command, used to determine the commands affected by a change
+	inputs []string
+
+	// report files produced by the command
+	reports []*commandReport
+
+	// license compliance check executed before the command
+	compliance *complianceCheck
+
+	// generate checksums and SBOM documents for the outputs
+	sbom bool
+
+	// attach the command to a pseudo terminal
+	tty bool
+
+	// ports of a service, checked before the command is started
+	ports []*commandPort
+
+	// tools the command needs in the PATH, checked before the command and its dependencies are started
+	requires []string
+
+	// commands that run after the top-level invocation, even if it failed or was interrupted
+	finally []string
+
+	// paths and glob patterns copied into the dump directory when the command fails
+	onFailureCollect []string
+
 	// if the command has been generated by a CommandsFile
 	// the script that will be executed goes in here
 	exec string
 }
 
 func (c *command) AsyncRun(args []string) error {
+	return c.asyncRun(args, !skipDependencies())
+}
+
+// start the command in the background, with its dependencies if deps is set
+func (c *command) asyncRun(args []string, deps bool) error {
+
+	// keep the progress counters of the invocation alive until the command has been started
+	if err := s.begin(); err != nil {
+		return err
+	}
+
 	go func() {
-		err := c.Run(args, false)
+		defer s.end()
+
+		err := c.run(args, false, deps)
 		if err != nil {
 			Log.WithError(err).Error("failed to run command: " + c.name)
 		}
@@ -113,16 +195,40 @@ func (c *command) AsyncRun(args []string) error {
 
 // Run executes the command
 func (c *command) Run(args []string, async bool) error {
+	return c.run(args, async, !skipDependencies())
+}
+
+// execute the command, with its dependencies if deps is set
+// the commands of a parallel commandChain step run without, the step executes their dependencies once
+func (c *command) run(args []string, async, deps bool) error {
 
 	// spawn async commands in a new goroutine
 	if async {
-		return c.AsyncRun(args)
+		return c.asyncRun(args, deps)
 	}
 
-	// handle dependencies
-	err := c.execDependencies()
+	// the pinned tools of a fresh checkout are downloaded on the first run
+	err := ensureToolchain()
 	if err != nil {
-		return errors.New("dependency error: " + err.Error())
+		return err
+	}
+
+	// fail before the first dependency is started when a tool is missing
+	err = c.checkRequirements(deps)
+	if err != nil {
+		return err
+	}
+
+	// registered before the dependencies, they belong to the pipeline of the command
+	finalizers.add(c)
+
+	// handle dependencies
+	// exported CI pipelines run them in jobs of their own
+	if deps {
+		err := c.execDependencies()
+		if err != nil {
+			return fmt.Errorf("dependency error: %w", err)
+		}
 	}
 
 	return c.AtomicRun(args, false)
@@ -138,32 +244,25 @@ func (c *command) AtomicRun(args []string, async bool) error {
 	var (
 		cLog         = Log.WithField("prefix", c.name)
 		start        = time.Now()
-		stdErrBuffer = &bytes.Buffer{}
+		stdErrBuffer = newBoundedBuffer(stdErrBufferSize())
 	)
 
-	// check outputs
-	if len(c.outputs) > 0 {
-
-		var outputMissing bool
-
-		// check if all named outputs exist
-		for _, output := range c.outputs {
-
-			_, err := os.Stat(output)
-			if err != nil {
-				Log.Debug("["+ansi.Red+c.name+cp.Reset+"] output missing: ", output)
-				outputMissing = true
-			}
-
-			if !outputMissing {
-				// all output files / dirs exist, skip command
-				s.Lock()
-				s.currentCommand++
-				l.Println(printPrompt() + "[" + strconv.Itoa(s.currentCommand) + "/" + strconv.Itoa(s.numCommands) + "] skipping " + cp.Prompt + c.name + cp.Reset + " because all named outputs exist")
-				s.Unlock()
-				return nil
-			}
-		}
+	// a signal was received, dont start any further commands
+	if s.isInterrupted() {
+		return ErrInterrupted
+	}
+	finalizers.add(c)
+
+	// check the skip condition and outputs
+	if state, reason := c.skipReason(); reason != "" {
+		c.printSkipped(state, reason)
+		runRecords.add(&runRecord{
+			Name:    c.name,
+			Args:    args,
+			Start:   start,
+			Skipped: true,
+		})
+		return nil
 	}
 
 	cLog.WithFields(logrus.Fields{
@@ -171,9 +270,12 @@ func (c *command) AtomicRun(args []string, async bool) error {
 		"args":   args,
 	}).Debug(cp.CmdName + c.name + cp.Reset)
 
-	s.Lock()
-	s.currentCommand++
-	s.Unlock()
+	// position of the command in the execution plan
+	state := stateExecuted
+	if c.async {
+		state = stateDetached
+	}
+	pos := s.next(state)
 
 	// handle args
 	argBuffer, err := c.parseArguments(args)
@@ -181,8 +283,54 @@ func (c *command) AtomicRun(args []string, async bool) error {
 		return err
 	}
 
+	// dependencies can be run on their own
+	err = c.checkRequirements(false)
+	if err != nil {
+		return err
+	}
+
+	// run the compliance check
+	if c.compliance != nil {
+		err = c.compliance.run(c.name)
+		if err != nil {
+			runRecords.add(&runRecord{
+				Name:     c.name,
+				Args:     args,
+				Start:    start,
+				Duration: time.Since(start),
+				Err:      err,
+			})
+			return err
+		}
+	}
+
+	// dynamic globals are evaluated once per invocation
+	g.RLock()
+	vars := c.globals(g.Vars)
+	g.RUnlock()
+	err = evaluateGlobals(vars)
+	if err == nil {
+		err = evaluateGlobals(c.env)
+	}
+	if err != nil {
+		return err
+	}
+
+	// secrets are only decrypted into the environment of the process, if the script references them
+	secretEnv, err := secrets.environment(c.source())
+	if err != nil {
+		return err
+	}
+
+	// ports must be known before the globals are generated
+	err = c.reservePorts()
+	if err != nil {
+		return err
+	}
+
 	// init command
-	cmd, script, cleanupFunc, err := c.createCommand(argBuffer)
+	_, extraArgs := splitExtraArgs(args)
+	cmd, script, cleanupFunc, err := c.createCommand(argBuffer, extraArgs)
 	if err != nil {
 		return err
 	}
@@ -192,41 +340,222 @@ func (c *command) AtomicRun(args []string, async bool) error {
 	prefix := ""
 
 	// set host shell environment
-	cmd.Env = os.Environ()
-	for name, value := range g.Vars {
-		cmd.Env = append(cmd.Env, prefix+name+"="+value)
+	cmd.Env = withoutPassphrase(os.Environ())
+	for _, name := range sortedKeys(vars) {
+		cmd.Env = append(cmd.Env, prefix+name+"="+substitutions.expand(vars[name]))
+	}
+
+	// the last value of duplicate variables is used
+	for _, name := range sortedKeys(c.env) {
+		cmd.Env = append(cmd.Env, prefix+name+"="+substitutions.expand(c.env[name]))
+	}
+	if entry := sourceDateEpochEnvEntry(); entry != "" {
+		cmd.Env = append(cmd.Env, entry)
+	}
+
+	cmd.Env = append(cmd.Env, secretEnv...)
+
+	// always set, so nested invocations of zeus do not inherit the extra arguments
+	cmd.Env = append(cmd.Env, extraArgsEnv+"="+quoteExtraArgs(extraArgs))
+	cmd.Env = append(cmd.Env, lifecycleEnv(c.name)...)
+
+	var (
+		// flushes the buffered output once the process exited
+		flushOutput func()
+
+		// pass the output through without line buffering
+		// a pty needs the terminal for itself
+		raw = rawOutput() || c.tty
+	)
+
+	// the progress view holds back the output
+	// a command in a pseudo terminal gets the terminal for itself, the view is not drawn while it runs
+	var held io.Writer
+	if !c.async {
+		held = progressUI.running(c.name)
+		if held != nil && c.tty {
+			held = nil
+			progressUI.suspend()
+			defer progressUI.resume()
+		}
 	}
 
 	// don't wire terminalIO for async jobs
 	// they can be attached by using the procs builtin
 	if !c.async {
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = io.MultiWriter(os.Stderr, stdErrBuffer)
+		if held != nil {
+			cmd.Stdout = held
+			cmd.Stderr = io.MultiWriter(held, stdErrBuffer)
+		} else if prefix, buffered := useMultiplexer(); prefix {
+			var (
+				stdout = mux.writer(c.name, buffered)
+				stderr = mux.writer(c.name, buffered)
+			)
+			cmd.Stdout = stdout
+			cmd.Stderr = io.MultiWriter(stderr, stdErrBuffer)
+
+			flushOutput = func() {
+				stdout.flush()
+				stderr.flush()
+			}
+		} else if raw {
+			// the process writes directly to the terminal, needed for full-screen TUIs
+			cmd.Stdout = os.Stdout
+			cmd.Stderr = io.MultiWriter(os.Stderr, stdErrBuffer)
+		} else {
+			var (
+				stdout = newLineWriter(os.Stdout, terminalLock)
+				stderr = newLineWriter(os.Stderr, terminalLock)
+			)
+			cmd.Stdout = stdout
+			cmd.Stderr = io.MultiWriter(stderr, stdErrBuffer)
+
+			flushOutput = func() {
+				stdout.flush()
+				stderr.flush()
+			}
+		}
 		cmd.Stdin = os.Stdin
+
+		// tee output into the log file for this run
+		if logDir() != "" {
+			logFile, err := openCommandLog(c.name)
+			if err != nil {
+				cLog.WithError(err).Error("failed to create log file")
+			} else {
+				defer logFile.Close()
+				if raw {
+					cmd.Stdout = io.MultiWriter(cmd.Stdout, logFile)
+					cmd.Stderr = io.MultiWriter(cmd.Stderr, logFile)
+				} else {
+					var (
+						logLock   = &sync.Mutex{}
+						stdoutLog = newLineWriter(logFile, logLock)
+						stderrLog = newLineWriter(logFile, logLock)
+						flush     = flushOutput
+					)
+					cmd.Stdout = io.MultiWriter(cmd.Stdout, stdoutLog)
+					cmd.Stderr = io.MultiWriter(cmd.Stderr, stderrLog)
+
+					flushOutput = func() {
+						if flush != nil {
+							flush()
+						}
+						stdoutLog.flush()
+						stderrLog.flush()
+					}
+				}
+			}
+		}
+
+		// stream the output to the web dashboard and gRPC clients
+		if dashboardActive() || outputListeners.active() {
+			var (
+				stdoutDashboard, stderrDashboard = newDashboardWriters(c.name)
+				flush                            = flushOutput
+			)
+			cmd.Stdout = io.MultiWriter(cmd.Stdout, stdoutDashboard)
+			cmd.Stderr = io.MultiWriter(cmd.Stderr, stderrDashboard)
+
+			flushOutput = func() {
+				if flush != nil {
+					flush()
+				}
+				stdoutDashboard.flush()
+				stderrDashboard.flush()
+			}
+		}
+
+		// the values of secrets never reach the terminal, the logs or the error reports
+		if secrets.active() {
+			var (
+				lock   = &sync.Mutex{}
+				stdout = newLineWriter(&maskWriter{out: cmd.Stdout}, lock)
+				stderr = newLineWriter(&maskWriter{out: cmd.Stderr}, lock)
+				flush  = flushOutput
+			)
+			cmd.Stdout = stdout
+			cmd.Stderr = stderr
+
+			// the masked lines must be written before the writers behind them are flushed
+			flushOutput = func() {
+				stdout.flush()
+				stderr.flush()
+				if flush != nil {
+					flush()
+				}
+			}
+		}
 	}
 
 	// incease build number if set
-	if c.buildNumber {
+	// reproducible builds must not depend on the number of previous builds
+	if c.buildNumber && !reproducible() {
 		projectData.Lock()
 		projectData.fields.BuildNumber++
 		projectData.Unlock()
 		projectData.update()
 	}
 
-	s.Lock()
-	if c.async {
-		l.Println(printPrompt() + "[" + strconv.Itoa(s.currentCommand) + "/" + strconv.Itoa(s.numCommands) + "] detaching " + cp.Prompt + c.name + cp.Reset)
-	} else {
-		l.Println(printPrompt() + "[" + strconv.Itoa(s.currentCommand) + "/" + strconv.Itoa(s.numCommands) + "] executing " + cp.Prompt + c.name + cp.Reset)
+	switch {
+	case c.async && progressUI.isActive():
+		progressUI.finished(c.name, stateDetached)
+	case c.async:
+		if !quietOutput() {
+			l.Println(fitLine(printPrompt() + s.progress(pos) + " detaching " + cp.Prompt + c.name + cp.Reset))
+		}
+	default:
+		ciGroupStart(c.name)
+		if !progressUI.isActive() && !quietOutput() {
+			l.Println(fitLine(printPrompt() + s.progress(pos) + " executing " + cp.Prompt + c.name + cp.Reset))
+		}
 	}
-	s.Unlock()
+	if verboseOutput() {
+		printCommandDetails(cmd)
+	}
+
+	// time spent on the arguments, globals, secrets and the script before the process starts
+	setup := time.Since(start)
 
 	// lets go
-	err = cmd.Start()
+	if c.tty && !c.async {
+		var waitPTY func()
+
+		// stdout and stderr are merged by the terminal
+		waitPTY, err = startPTY(cmd, io.MultiWriter(cmd.Stdout, stdErrBuffer))
+		if err == nil {
+			flush := flushOutput
+			flushOutput = func() {
+				waitPTY()
+				if flush != nil {
+					flush()
+				}
+			}
+		}
+	} else {
+		// a signal to the process group reaches all processes spawned by the command
+		if ownProcessGroup() {
+			cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+		}
+		err = cmd.Start()
+	}
 	if err != nil {
+		if cleanupFunc != nil {
+			cleanupFunc()
+		}
 		cLog.WithError(err).Fatal("failed to start command: " + c.name)
 	}
 
+	s.Lock()
+	s.running++
+	s.Unlock()
+
+	defer func() {
+		s.Lock()
+		s.running--
+		s.Unlock()
+	}()
+
 	// add to processMap
 	var (
 		id  = processID(randomString())
@@ -235,19 +564,54 @@ func (c *command) AtomicRun(args []string, async bool) error {
 	cLog.Debug("PID: ", pid)
 	addProcess(id, c.name, cmd.Process, pid)
 
-	// after command has finished running, remove from processMap
-	defer deleteProcessByPID(pid)
-
 	// wait for process
-	return c.waitForProcess(cmd, cleanupFunc, script, id, pid, start, stdErrBuffer)
+	collected, err := c.waitForProcess(cmd, cleanupFunc, flushOutput, script, args, id, pid, pos, start, stdErrBuffer)
+
+	if verboseOutput() && !c.async {
+		printCommandTiming(c.name, setup, time.Since(start)-setup, err)
+	}
+
+	// after command has finished running, move it to the exited processes
+	exitProcess(pid, exitCode(err))
+	if !c.async {
+		ciGroupEnd(c.name)
+	}
+	if err == nil && c.sbom {
+		err = generateSBOMs(c.name, c.outputs)
+	}
+
+	// record the outcome for the run summary
+	rec := &runRecord{
+		Name:      c.name,
+		Args:      args,
+		Start:     start,
+		Duration:  time.Now().Sub(start),
+		Err:       err,
+		Collected: collected,
+	}
+	if err != nil {
+		rec.StdErr = redact(stdErrBuffer.String())
+	}
+	runRecords.add(rec)
+
+	return err
 }
 
-func (c *command) waitForProcess(cmd *exec.Cmd, cleanupFunc func(), script string, id processID, pid int, start time.Time, stdErrBuffer *bytes.Buffer) error {
+func (c *command) waitForProcess(cmd *exec.Cmd, cleanupFunc, flushOutput func(), script string, args []string, id processID, pid, pos int, start time.Time, stdErrBuffer *boundedBuffer) (collected []string, err error) {
 
 	cLog := Log.WithField("prefix", "waitForProcess")
 
 	// wait for command to finish execution
-	err := cmd.Wait()
+	err = cmd.Wait()
+
+	// print buffered output before any status information
+	if flushOutput != nil {
+		flushOutput()
+	}
+	if !c.async {
+		progressUI.exited(c.name, err)
+	}
+
 	if err != nil {
 
 		// execute cleanupFunc if there is one
@@ -271,34 +635,50 @@ func (c *command) waitForProcess(cmd *exec.Cmd, cleanupFunc func(), script strin
 		// because ZEUS would not know which interpreter to use
 		lang, _ := c.getLanguage()
 
-		// search for lineErr in stdErrBuffer
-		i, lineErr := extractLineNumFromError(stdErrBuffer.String(), lang.ErrLineNumberSymbol)
-		if lineErr == ErrNoLineNumberFound {
-			i = -1
-		} else if lineErr != nil {
-			l.Println("failed to retrieve line number in which the error occured:", lineErr)
-		} else {
-			// some scripting languages return a line number
-			// thats one line below the real error line
-			if lang.CorrectErrLineNumber {
-				i--
-			}
+		// dump complete script and highlight the lines from the error output
+		errLines := c.errorLines(stdErrBuffer.String(), lang)
+		printScript(script, c.name, c.preamble(script), errLines...)
+
+		// the source locations, so editors can jump to them
+		for _, loc := range c.errorLocations(script, errLines) {
+			l.Println(cp.Prompt + "error at " + loc + cp.Reset)
 		}
 
-		// dump complete script and highlight error
-		printScript(script, c.name, i)
+		// gather the evidence for the post-mortem
+		d, dumpErr := newErrorDump(c, args, cmd.Env, script, err, stdErrBuffer.String())
+		if dumpErr != nil {
+			cLog.WithError(dumpErr).Error("failed to create error dump")
+			return nil, err
+		}
+		d.collect(c.onFailureCollect)
+		if len(d.Collected) > 0 {
+			l.Println(cp.Prompt + "collected " + strconv.Itoa(len(d.Collected)) + " files in " + d.artifacts + cp.Reset)
+		}
 		if conf.fields.DumpScriptOnError {
-			dumpScript(script, c.language, err, stdErrBuffer.String())
+			d.write()
+		} else if len(d.Collected) > 0 {
+			pruneDumps()
 		}
 
-		return err
+		return d.Collected, err
 	}
 
 	if c.async {
 
+		// the cleanup runs when the process exited, or when it is terminated on shutdown
+		var (
+			once    sync.Once
+			cleanup = func() {
+				if cleanupFunc != nil {
+					once.Do(cleanupFunc)
+				}
+			}
+		)
+
 		// add to process map PID +1
 		cLog.Debug("detached PID: ", pid+1)
 		addProcess(id, c.name, nil, pid+1)
+		setProcessCleanup(pid+1, cleanup)
 
 		func() {
 			for {
@@ -310,11 +690,7 @@ func (c *command) waitForProcess(cmd *exec.Cmd, cleanupFunc func(), script strin
 				if err != nil {
 					Log.Debug("detached process with PID " + strconv.Itoa(pid+1) + " exited")
 					deleteProcessByPID(pid + 1)
-
-					// execute cleanupFunc if there is one
-					if cleanupFunc != nil {
-						cleanupFunc()
-					}
+					cleanup()
 					return
 				}
 
@@ -322,14 +698,14 @@ func (c *command) waitForProcess(cmd *exec.Cmd, cleanupFunc func(), script strin
 			}
 		}()
 	} else {
-		s.Lock()
-		// print stats
-		l.Println(
-			printPrompt()+"["+strconv.Itoa(s.currentCommand)+"/"+strconv.Itoa(s.numCommands)+"] finished "+cp.Prompt+c.name+cp.Text+" in"+cp.Prompt,
-			time.Now().Sub(start),
-			cp.Reset,
-		)
-		s.Unlock()
+		// print stats, the progress view shows them in the tree
+		if !progressUI.isActive() && !quietOutput() {
+			l.Println(
+				printPrompt()+s.progress(pos)+" finished "+cp.Prompt+c.name+cp.Text+" in"+cp.Prompt,
+				formatDuration(time.Now().Sub(start)),
+				cp.Reset,
+			)
+		}
 
 		// execute cleanupFunc if there is one
 		if cleanupFunc != nil {
@@ -337,7 +713,7 @@ func (c *command) waitForProcess(cmd *exec.Cmd, cleanupFunc func(), script strin
 		}
 	}
 
-	return nil
+	return nil, nil
 }
 
 // collect dependencies for the current command
@@ -363,11 +739,157 @@ func (c *command) getDeepDependencies() (deps []string) {
 	return stripArrayRight(deps)
 }
 
+// split the order-only dependencies, marked with the | prefix, from the normal ones
+// deps contains all dependencies without the prefix, in the declared order
+func splitOrderOnly(dependencies []string) (deps, orderOnly []string) {
+	for _, dep := range dependencies {
+		if trimmed := strings.TrimSpace(dep); strings.HasPrefix(trimmed, orderOnlyPrefix) {
+			dep = strings.TrimSpace(strings.TrimPrefix(trimmed, orderOnlyPrefix))
+			orderOnly = append(orderOnly, dep)
+		}
+		deps = append(deps, dep)
+	}
+	return
+}
+
+// split the async dependencies, marked with the & suffix, from the normal ones
+// deps contains all dependencies without the suffix, in the declared order
+func splitAsyncDependencies(dependencies []string) (deps, async []string) {
+	for _, dep := range dependencies {
+		if trimmed := strings.TrimSpace(dep); strings.HasSuffix(trimmed, asyncDependencySuffix) {
+			dep = strings.TrimSpace(strings.TrimSuffix(trimmed, asyncDependencySuffix))
+			async = append(async, dep)
+		}
+		deps = append(deps, dep)
+	}
+	return
+}
+
+// collect the async dependencies of the current command and all subdependencies
+func (c *command) getAsyncDependencies() map[string]bool {
+
+	async := make(map[string]bool)
+	for _, dep := range c.asyncDeps {
+		async[dep] = true
+	}
+
+	for _, dep := range c.dependencies {
+		fields := strings.Fields(dep)
+		if len(fields) == 0 {
+			continue
+		}
+		if depCmd, err := cmdMap.getCommand(fields[0]); err == nil {
+			for d := range depCmd.getAsyncDependencies() {
+				async[d] = true
+			}
+		}
+	}
+
+	return async
+}
+
+// start a dependency in the background
+// it is tracked in the process map like any other command, but a failure is only logged
+func (c *command) fireAndForget(args []string) {
+
+	// keep the progress counters alive until the dependency finished
+	if err := s.begin(); err != nil {
+		Log.WithError(err).Warn("async dependency " + c.name + " failed")
+		return
+	}
+	asyncDependencies.Add(1)
+
+	go func() {
+		defer asyncDependencies.Done()
+		defer s.end()
+
+		err := c.AtomicRun(args, false)
+		if err != nil {
+			Log.WithError(err).Warn("async dependency " + c.name + " failed")
+		}
+	}()
+}
+
+// report a command that is not started, in the progress view or with a line
+func (c *command) printSkipped(state, reason string) {
+	pos := s.next(state)
+	if progressUI.isActive() {
+		progressUI.finished(c.name, state)
+		return
+	}
+	if quietOutput() {
+		return
+	}
+	l.Println(fitLine(printPrompt() + s.progress(pos) + " skipping " + cp.Prompt + c.name + cp.Reset + " because " + reason))
+}
+
+// check if a command can be skipped and return its state and the reason, or an empty reason if it has to run
+func (c *command) skipReason() (state, reason string) {
+	if c.skipIf != nil && c.skipIf.eval() {
+		return stateSkipped, "skipIf is true: " + c.skipIf.String()
+	}
+	if c.upToDate() {
+		return stateCached, "all named outputs exist"
+	}
+	return "", ""
+}
+
+// check if a command can be skipped
+// all named outputs must exist and none of them may be older than an output of a normal dependency
+// order-only dependencies never make a command stale
+func (c *command) upToDate() bool {
+
+	if len(c.outputs) == 0 {
+		return false
+	}
+
+	var oldest time.Time
+	for i, output := range c.outputs {
+		info, err := os.Stat(output)
+		if err != nil {
+			Log.Debug("["+ansi.Red+c.name+cp.Reset+"] output missing: ", output)
+			return false
+		}
+		if i == 0 || info.ModTime().Before(oldest) {
+			oldest = info.ModTime()
+		}
+	}
+
+	for _, dep := range c.dependencies {
+
+		fields := strings.Fields(dep)
+		if len(fields) == 0 || contains(c.orderOnly, dep) {
+			continue
+		}
+
+		depCmd, err := cmdMap.getCommand(fields[0])
+		if err != nil {
+			continue
+		}
+
+		for _, output := range depCmd.outputs {
+			info, err := os.Stat(output)
+			if err == nil && info.ModTime().After(oldest) {
+				Log.Debug("["+ansi.Red+c.name+cp.Reset+"] output of dependency "+depCmd.name+" is newer: ", output)
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
 // execute dependencies for the current command
 // if their named outputs do not exist
 func (c *command) execDependencies() error {
+	return execDependencyList(c.name, c.getDeepDependencies(), c.getAsyncDependencies())
+}
 
-	for _, depCommand := range c.getDeepDependencies() {
+// execute the dependencies in the given order, the ones in async are started in the background
+// parent is the command that needs them
+func execDependencyList(parent string, deps []string, async map[string]bool) error {
+
+	for _, depCommand := range deps {
 
 		fields := strings.Fields(depCommand)
 		if len(fields) == 0 {
@@ -380,34 +902,32 @@ func (c *command) execDependencies() error {
 			return errors.New("invalid dependency: " + err.Error())
 		}
 
-		// check if dependency has outputs defined
-		if len(dep.outputs) > 0 {
+		// skip the dependency if its skip condition is true or its outputs are up to date
+		if state, reason := dep.skipReason(); reason != "" {
 
-			var outputMissing bool
+			dep.printSkipped(state, reason)
 
-			// check if all named outputs exist
-			for _, output := range dep.outputs {
-				_, err := os.Stat(output)
-				if err != nil {
-					outputMissing = true
-				}
-			}
+			runRecords.add(&runRecord{
+				Name:    dep.name,
+				Args:    fields[1:],
+				Start:   time.Now(),
+				Skipped: true,
+			})
 
-			// no outputs missing
-			// next iteration
-			if !outputMissing {
+			continue
+		}
 
-				s.Lock()
-				s.currentCommand++
-				l.Println(printPrompt() + "[" + strconv.Itoa(s.currentCommand) + "/" + strconv.Itoa(s.numCommands) + "] skipping " + cp.Prompt + dep.name + cp.Reset)
-				s.Unlock()
+		s.setParent(dep.name, parent)
 
-				continue
-			}
+		// start async dependencies without waiting for them
+		if async[depCommand] {
+			dep.fireAndForget(fields[1:])
+			continue
 		}
 
 		// execute dependency and pass args
-		err = dep.AtomicRun(fields[1:], c.async)
+		// the dependencies of a detached command run before it is detached, their own dependencies are part of the plan already
+		err = dep.AtomicRun(fields[1:], false)
 		if err != nil {
 			Log.WithError(err).Error("failed to execute " + dep.name)
 			return err
@@ -430,14 +950,28 @@ func (c *command) getLanguage() (*Language, error) {
 	return nil, ErrUnsupportedLanguage
 }
 
+// the script for the exec of a command
+// the bang, the globals, the language specific global code and the arguments are inserted in front of the exec
+func (c *command) renderScript(lang *Language, globalVars, argBuffer string) string {
+
+	var globalFuncs string
+
+	// add language specific global code
+	code, err := ioutil.ReadFile(zeusDir + "/globals/globals" + lang.FileExtension)
+	if err == nil {
+		globalFuncs = string(code)
+	}
+
+	return lang.Bang + "\n" + globalVars + "\n" + globalFuncs + "\n" + argBuffer + "\n" + c.exec
+}
+
 // create an exec.Cmd instance ready for execution
-// for the given argument buffer
-func (c *command) createCommand(argBuffer string) (cmd *exec.Cmd, script string, cleanupFunc func(), err error) {
+// for the given argument buffer, the extra arguments are passed to the script
+func (c *command) createCommand(argBuffer string, extraArgs []string) (cmd *exec.Cmd, script string, cleanupFunc func(), err error) {
 
 	var (
 		shellCommand []string
 		globalVars   string
-		globalFuncs  string
 	)
 
 	if c.async {
@@ -464,17 +998,11 @@ func (c *command) createCommand(argBuffer string) (cmd *exec.Cmd, script string,
 		shellCommand = append(shellCommand, lang.FlagEvaluateScript)
 	}
 
-	globalVars = generateGlobals(lang)
-
-	// add language specific global code
-	code, err := ioutil.ReadFile(zeusDir + "/globals/globals" + lang.FileExtension)
-	if err == nil {
-		globalFuncs = string(code)
-	}
+	globalVars = generateGlobals(lang, c)
 
 	// check if loaded via CommandsFile
 	if c.exec != "" {
-		script = lang.Bang + "\n" + globalVars + "\n" + globalFuncs + "\n" + argBuffer + "\n" + c.exec
+		script = c.renderScript(lang, globalVars, argBuffer)
 		if lang.UseTempFile {
 			// make sure the .tmp dir exists
 			os.MkdirAll(scriptDir+"/.tmp", 0700)
@@ -516,13 +1044,21 @@ func (c *command) createCommand(argBuffer string) (cmd *exec.Cmd, script string,
 		shellCommand = append(shellCommand, c.path)
 	}
 
+	// pass the extra arguments verbatim, shells receive them in $@
+	if len(extraArgs) > 0 {
+		if c.path == "" && !lang.UseTempFile && lang.ScriptNameArgument {
+			shellCommand = append(shellCommand, c.name)
+		}
+		shellCommand = append(shellCommand, extraArgs...)
+	}
+
 	// Log.Debug("shellCommand: ", shellCommand)
 
 	cmd = exec.Command(shellCommand[0], shellCommand[1:]...)
 
 	// in debug mode, print the complete script that will be executed
 	if conf.fields.Debug {
-		printScript(script, c.name, -1)
+		printScript(script, c.name, c.preamble(script))
 	}
 
 	return cmd, script, cleanupFunc, nil
@@ -596,16 +1132,16 @@ func findCommands() {
 // dump command to stdout for debugging
 func (c *command) dump() {
 	w := 15
-	fmt.Println("# ---------------------------------------------------------------------------------------------------------------------- #")
+	fmt.Println(ruler("# ", "-", " #"))
 	fmt.Println(pad("#  cmdName", w), cp.CmdName+c.name+cp.Reset)
-	fmt.Println("# ---------------------------------------------------------------------------------------------------------------------- #")
+	fmt.Println(ruler("# ", "-", " #"))
 	fmt.Println(pad("#  path", w), c.path)
 	fmt.Println(pad("#  args", w), getArgumentString(c.args)+cp.Reset)
 	fmt.Println(pad("#  description", w), c.description)
 	fmt.Println(pad("#  help", w), c.help)
 	if len(c.dependencies) > 0 {
 		fmt.Println(pad("#  len(dependencies)", w), len(c.dependencies))
-		fmt.Println("# ====================================================================================================================== #")
+		fmt.Println(ruler("# ", "=", " #"))
 		for i, cmd := range c.dependencies {
 			fmt.Println("#  dependencies[" + cp.CmdName + strconv.Itoa(i) + cp.Reset + "]")
 			fmt.Println("## command: " + cmd)
@@ -624,7 +1160,7 @@ func (c *command) dump() {
 
 			dep.dump()
 		}
-		fmt.Println("# ====================================================================================================================== #")
+		fmt.Println(ruler("# ", "=", " #"))
 	}
 	fmt.Println(pad("#  buildNumber", w), c.buildNumber)
 	fmt.Println(pad("#  async", w), c.async)
@@ -642,6 +1178,29 @@ func (c *command) dump() {
 // intialize a command from a path
 func initScript(path string) error {
 
+	cmd, err := newScriptCommand(path)
+	if err != nil {
+		return err
+	}
+
+	completer.Lock()
+	completer.Children = append(completer.Children, cmd.PrefixCompleter)
+	completer.Unlock()
+
+	// add to command map
+	cmdMap.Lock()
+	cmdMap.items[cmd.name] = cmd
+	cmdMap.Unlock()
+
+	Log.WithField("prefix", "initScript").Debug("added " + cp.CmdName + cmd.name + cp.Reset + " to the command map")
+
+	return nil
+}
+
+// create the command for a script in the script directory
+// the language is detected from the file extension
+func newScriptCommand(path string) (*command, error) {
+
 	var (
 		lang string
 		ext  = filepath.Ext(path)
@@ -658,7 +1217,7 @@ func initScript(path string) error {
 	ls.Unlock()
 
 	if lang == "" {
-		return errors.New(path + ": " + ErrUnsupportedLanguage.Error())
+		return nil, errors.New(path + ": " + ErrUnsupportedLanguage.Error())
 	}
 
 	// create command instance
@@ -677,17 +1236,5 @@ func initScript(path string) error {
 		language:        lang,
 	}
 
-	completer.Lock()
-	completer.Children = append(completer.Children, cmd.PrefixCompleter)
-	completer.Unlock()
-
-	// add to command map
-	cmdMap.Lock()
-	cmdMap.items[cmd.name] = cmd
-	cmdMap.Unlock()
-
-	Log.WithField("prefix", "initScript").Debug("added " + cp.CmdName + cmd.name + cp.Reset + " to the command map")
-
-	return nil
-
+	return cmd, nil
 }
@@ -20,16 +20,47 @@ package main
 
 import (
 	"errors"
+	"fmt"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/mgutz/ansi"
 )
 
 type status struct {
-	recursionMap   map[string]int
-	numCommands    int
+
+	// total number of commands in the execution plan
+	numCommands int
+
+	// number of commands from the execution plan that have been started or skipped
 	currentCommand int
+
+	// number of started or skipped commands by their state
+	states map[string]int
+
+	// number of invocations sharing the counters
+	// they are reset when the last invocation ended
+	invocations int
+
+	// number of commands currently executing
+	running int
+
+	// a signal was received, no further commands are started
+	// cleared when the last invocation ended, or a new line was entered in the shell
+	interrupted bool
+
+	// identifies the running invocation and the time it started, exported to the commands
+	runID          string
+	invocationTime time.Time
+
+	// number of times each command has been started in the running invocation
+	attempts map[string]int
+
+	// the command a dependency has been started for
+	parents map[string]string
+
 	sync.RWMutex
 }
 
@@ -38,30 +69,324 @@ func (s *status) reset() {
 	s.Lock()
 	s.numCommands = 0
 	s.currentCommand = 0
-	s.recursionMap = make(map[string]int, 0)
+	s.states = nil
+	s.invocations = 0
+	s.interrupted = false
 	s.Unlock()
 }
 
-func (s *status) incrementRecursionCount(commandName string) error {
+// begin an invocation
+// nested invocations and async commands share the counters and the project lock of the running invocation
+func (s *status) begin() error {
 
-	conf.Lock()
-	limit := conf.fields.RecursionDepth
-	conf.Unlock()
+	err := projectLocks.acquire()
+	if err != nil {
+		return err
+	}
 
+	s.Lock()
+	first := s.invocations == 0
+	if first {
+		s.startRun()
+	}
+	s.invocations++
+	s.Unlock()
+
+	if first {
+		progressUI.start()
+	}
+
+	return nil
+}
+
+// add count commands to the execution plan
+func (s *status) plan(count int) {
+	s.Lock()
+	s.numCommands += count
+	s.Unlock()
+}
+
+// end an invocation, the counters are reset when no other invocation is using them
+// the end of the top-level invocation runs the finalizers and releases the project lock
+func (s *status) end() {
+	defer projectLocks.release()
+
+	s.Lock()
+	s.invocations--
+	last := s.invocations <= 0
+	var summary string
+	if last {
+		summary = s.summary()
+		s.invocations = 0
+		s.numCommands = 0
+		s.currentCommand = 0
+		s.states = nil
+		s.interrupted = false
+		s.runID = ""
+	}
+	s.Unlock()
+
+	if last {
+		progressUI.stop()
+	}
+
+	if summary != "" && !quietOutput() {
+		l.Println(fitLine(printPrompt() + summary))
+	}
+
+	if last {
+		finalizers.run()
+	}
+}
+
+// stop starting further commands of the running invocations
+func (s *status) interrupt() {
+	s.Lock()
+	if s.invocations > 0 {
+		s.interrupted = true
+	}
+	s.Unlock()
+}
+
+// start commands again after an interrupt
+// async commands can keep the counters alive, entering a new line must not be blocked by them
+func (s *status) resume() {
+	s.Lock()
+	s.interrupted = false
+	s.Unlock()
+}
+
+// check if the running invocations have been interrupted by a signal
+func (s *status) isInterrupted() bool {
+	s.RLock()
+	defer s.RUnlock()
+	return s.interrupted
+}
+
+// claim the next position in the execution plan for a command in the given state
+// every command has its own position, so concurrent commands can not mix up their progress
+func (s *status) next(state string) int {
 	s.Lock()
 	defer s.Unlock()
 
-	if val, ok := s.recursionMap[commandName]; ok {
-		if val == limit {
-			return errors.New("recursion limit for command " + commandName + " reached.")
+	s.currentCommand++
+	if s.states == nil {
+		s.states = make(map[string]int)
+	}
+	s.states[state]++
+
+	// commands that have not been planned, for example when fired by an event
+	if s.currentCommand > s.numCommands {
+		s.numCommands = s.currentCommand
+	}
+
+	return s.currentCommand
+}
+
+// format the progress for the given position
+// example: [2/5]
+func (s *status) progress(pos int) string {
+	s.RLock()
+	defer s.RUnlock()
+	return "[" + strconv.Itoa(pos) + "/" + strconv.Itoa(s.numCommands) + "]"
+}
+
+// summarize the states of the commands of an invocation, the caller holds the lock
+// example: finished 4 of 5 commands: 2 executed, 1 cached, 1 skipped
+// empty for invocations of a single command, their outcome has already been printed
+func (s *status) summary() string {
+
+	if s.numCommands < 2 {
+		return ""
+	}
+
+	var counts []string
+	for _, state := range commandStates {
+		if n := s.states[state]; n > 0 {
+			counts = append(counts, strconv.Itoa(n)+" "+state)
 		}
-		s.recursionMap[commandName]++
-		Log.Debug("incremented recursion count for command "+ansi.Red+commandName+cp.Reset+" to: ", s.recursionMap[commandName])
-	} else {
-		s.recursionMap[commandName] = 1
-		Log.Debug("adding " + ansi.Red + commandName + cp.Reset + " to recursionMap")
 	}
-	return nil
+
+	return "finished " + strconv.Itoa(s.currentCommand) + " of " + strconv.Itoa(s.numCommands) + " commands: " + strings.Join(counts, ", ")
+}
+
+// states of the commands in the execution plan
+const (
+	// the script of the command has been started
+	stateExecuted = "executed"
+
+	// the command has been started in a detached screen session
+	stateDetached = "detached"
+
+	// the command was not started, because its named outputs are up to date
+	stateCached = "cached"
+
+	// the command was not started, because its skipIf condition is true
+	stateSkipped = "skipped"
+)
+
+// states in the order of the summary
+var commandStates = []string{stateExecuted, stateDetached, stateCached, stateSkipped}
+
+var (
+	// ErrRecursionLimit means a command occurs in its own dependency path more often than allowed by recursionDepth
+	ErrRecursionLimit = errors.New("recursion limit reached")
+
+	// ErrMaxRecursionDepth means the dependencies are nested deeper than allowed by maxRecursionDepth
+	ErrMaxRecursionDepth = errors.New("max recursion depth reached")
+)
+
+// dependencyPath is the chain of dependencies from a command to the dependency that is currently visited
+type dependencyPath []string
+
+// return the path extended by the command
+// a command may occur recursionDepth times, and the path may not be longer than maxRecursionDepth
+func (p dependencyPath) enter(name string) (dependencyPath, error) {
+
+	conf.RLock()
+	var (
+		limit    = conf.fields.RecursionDepth
+		maxDepth = conf.fields.MaxRecursionDepth
+	)
+	conf.RUnlock()
+
+	next := append(p[:len(p):len(p)], name)
+
+	var occurrences int
+	for _, n := range next {
+		if n == name {
+			occurrences++
+		}
+	}
+
+	if occurrences > limit {
+		return nil, errors.New(ErrRecursionLimit.Error() + ": " + name + " occurs more than " + strconv.Itoa(limit) + " times in " + next.String() + ", repeated sequence: " + next.repeated().String())
+	}
+	if maxDepth > 0 && len(next) > maxDepth {
+		return nil, errors.New(ErrMaxRecursionDepth.Error() + ": more than " + strconv.Itoa(maxDepth) + " nested commands in " + next.String() + ", repeated sequence: " + next.repeated().String())
+	}
+
+	Log.Debug("dependency path: " + ansi.Red + next.String() + cp.Reset)
+	return next, nil
+}
+
+// the sequence from the previous occurrence of the last command up to the end of the path
+// the whole path, if the last command does not repeat
+func (p dependencyPath) repeated() dependencyPath {
+	last := len(p) - 1
+	for i := last - 1; i >= 0; i-- {
+		if p[i] == p[last] {
+			return p[i:]
+		}
+	}
+	return p
+}
+
+func (p dependencyPath) String() string {
+	return strings.Join(p, " => ")
+}
+
+// ErrMixedChainOperators means a step of a commandChain uses both the parallel and the fallback operator
+var ErrMixedChainOperators = errors.New("can not mix " + commandChainParallel + " and " + commandChainFallback + " in one step of a commandChain, use " + commandChainSeparator + " to separate them")
+
+// how the commands of a step in a commandChain are executed
+type chainStepMode int
+
+const (
+	// a single command
+	chainStepSingle chainStepMode = iota
+
+	// all commands at once, the step fails if one of them failed
+	chainStepParallel
+
+	// one after another until a command succeeds
+	chainStepFallback
+)
+
+// a step of a commandChain
+type chainStep struct {
+	mode     chainStepMode
+	commands []*command
+	args     [][]string
+}
+
+// split a step of a commandChain into its elements
+// example: "deploy env=prod || rollback" -> ["deploy env=prod", "rollback"], chainStepFallback
+func parseChainStep(step string) (elems []string, mode chainStepMode, err error) {
+
+	var (
+		parallel = splitChainStep(step, commandChainParallel)
+		fallback = splitChainStep(step, commandChainFallback)
+	)
+
+	switch {
+	case len(parallel) > 1 && len(fallback) > 1:
+		return nil, chainStepSingle, ErrMixedChainOperators
+	case len(parallel) > 1:
+		mode = chainStepParallel
+		elems = parallel
+	case len(fallback) > 1:
+		mode = chainStepFallback
+		elems = fallback
+	default:
+		elems = []string{step}
+	}
+
+	for i, e := range elems {
+		elems[i] = strings.TrimSpace(e)
+	}
+
+	return elems, mode, nil
+}
+
+// split a step of a commandChain at an operator
+// operators inside quoted argument values do not split the step
+// example: deploy msg="a & b" & notify -> [deploy msg="a & b", notify]
+func splitChainStep(step, op string) (elems []string) {
+
+	var (
+		quote byte
+		start int
+	)
+
+	for i := 0; i < len(step); i++ {
+		switch {
+		case quote != 0:
+			if step[i] == quote {
+				quote = 0
+			}
+		case step[i] == '"' || step[i] == '\'':
+			quote = step[i]
+		case strings.HasPrefix(step[i:], op):
+			elems = append(elems, step[start:i])
+			start = i + len(op)
+			i += len(op) - 1
+		}
+	}
+
+	return append(elems, step[start:])
+}
+
+// check if the line is a commandChain
+// the parallel and fallback operators are only handled by ZEUS if the line starts with a command,
+// otherwise they belong to the shell
+func isCommandChain(line string) bool {
+
+	if strings.Contains(line, commandChainSeparator) {
+		return true
+	}
+
+	if len(splitChainStep(line, commandChainParallel)) == 1 && len(splitChainStep(line, commandChainFallback)) == 1 {
+		return false
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return false
+	}
+
+	_, err := cmdMap.getCommand(fields[0])
+	return err == nil
 }
 
 type commandChain []*command
@@ -83,29 +408,199 @@ func (cmdChain commandChain) String() (out string) {
 }
 
 // parse and execute a given commandChain string
-func (cmdChain commandChain) exec(cmds []string) {
+// returns the error of the first failed command
+func (cmdChain commandChain) exec(cmds []string) error {
+	return cmdChain.execInvocation(invocationKey(cmds), cmds, 0)
+}
 
-	defer s.reset()
+// execute the commandChain for the steps of an invocation, starting at offset
+// the outcome is recorded so a failed invocation can be resumed with rerun
+func (cmdChain commandChain) execInvocation(key string, cmds []string, offset int) error {
 
-	// set numCommands counter
-	for _, c := range cmdChain {
-		count, err := getTotalDependencyCount(c)
-		if err != nil {
-			Log.WithError(err).Error("failed to get dependency count")
-			return
+	if err := s.begin(); err != nil {
+		return err
+	}
+	defer s.end()
+
+	steps, err := cmdChain.steps(cmds[offset:])
+	if err != nil {
+		return err
+	}
+
+	// count the commands of the execution plan
+	// fallbacks are not planned, they are counted once they run
+	// dependencies shared by the commands of a parallel step run once
+	var total int
+	for _, step := range steps {
+		seen := make(map[string]bool)
+		for i, c := range step.commands {
+			if step.mode == chainStepFallback && i > 0 {
+				break
+			}
+			plan, err := executionPlan(c)
+			if err != nil {
+				Log.WithError(err).Error("failed to get dependency count")
+				return err
+			}
+			for _, dep := range plan[:len(plan)-1] {
+				key := strings.Join(strings.Fields(dep), " ")
+				if step.mode != chainStepParallel || !seen[key] {
+					total++
+				}
+				seen[key] = true
+			}
+			total++
+			progressUI.plan(c)
 		}
-		s.Lock()
-		s.numCommands += count
-		s.Unlock()
 	}
+	s.plan(total)
 
 	// exec and pass args
-	for i, c := range cmdChain {
-		err := c.Run(strings.Fields(cmds[i])[1:], c.async)
+	for i, step := range steps {
+		err := step.run()
+		if err != nil {
+			recordInvocation(key, cmds, offset+i)
+			return err
+		}
+	}
+
+	recordInvocation(key, cmds, -1)
+	return nil
+}
+
+// group the commands of the chain into the given steps
+// the chain must have been created by validCommandChain from the same steps
+func (cmdChain commandChain) steps(cmds []string) ([]*chainStep, error) {
+
+	var (
+		steps []*chainStep
+		index int
+	)
+
+	for _, entry := range cmds {
+
+		elems, mode, err := parseChainStep(entry)
+		if err != nil {
+			return nil, err
+		}
+		if index+len(elems) > len(cmdChain) {
+			return nil, errors.New("invalid commandChain: " + strings.Join(cmds, commandChainSeparator))
+		}
+
+		step := &chainStep{
+			mode:     mode,
+			commands: cmdChain[index : index+len(elems)],
+		}
+		for _, e := range elems {
+			step.args = append(step.args, strings.Fields(e)[1:])
+		}
+		index += len(elems)
+
+		steps = append(steps, step)
+	}
+
+	return steps, nil
+}
+
+// execute the dependencies of the commands of a parallel step
+// a dependency needed by several commands runs once, in the position of the first command that needs it
+func (step *chainStep) execDependencies() error {
+
+	if skipDependencies() {
+		return nil
+	}
+
+	// fail before the first dependency is started when a tool is missing
+	for _, c := range step.commands {
+		err := c.checkRequirements(true)
+		if err != nil {
+			return err
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, c := range step.commands {
+
+		var deps []string
+		for _, dep := range c.getDeepDependencies() {
+			key := strings.Join(strings.Fields(dep), " ")
+			if !seen[key] {
+				seen[key] = true
+				deps = append(deps, dep)
+			}
+		}
+
+		finalizers.add(c)
+
+		err := execDependencyList(c.name, deps, c.getAsyncDependencies())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// execute the commands of a step
+// returns the error of the first failed command, or the error of the last fallback
+func (step *chainStep) run() error {
+
+	switch step.mode {
+	case chainStepParallel:
+
+		// dependencies shared by the commands run once, before the commands are started
+		err := step.execDependencies()
+		if err != nil {
+			return fmt.Errorf("dependency error: %w", err)
+		}
+
+		var (
+			wg   sync.WaitGroup
+			errs = make([]error, len(step.commands))
+		)
+
+		for i, c := range step.commands {
+			wg.Add(1)
+			go func(i int, c *command) {
+				defer wg.Done()
+				errs[i] = c.run(step.args[i], c.async, false)
+			}(i, c)
+		}
+		wg.Wait()
+
+		for i, err := range errs {
+			if err != nil {
+				Log.WithError(err).Error("failed to execute " + step.commands[i].name)
+				return err
+			}
+		}
+		return nil
+
+	case chainStepFallback:
+
+		var err error
+		for i, c := range step.commands {
+			err = c.Run(step.args[i], c.async)
+			if err == nil {
+				return nil
+			}
+			if errors.Is(err, ErrInterrupted) {
+				return err
+			}
+			if i < len(step.commands)-1 {
+				l.Println(printPrompt() + cp.Text + c.name + " failed, running fallback " + cp.Prompt + step.commands[i+1].name + cp.Reset)
+			}
+		}
+		Log.WithError(err).Error("failed to execute " + step.commands[len(step.commands)-1].name)
+		return err
+
+	default:
+		c := step.commands[0]
+		err := c.Run(step.args[0], c.async)
 		if err != nil {
 			Log.WithError(err).Error("failed to execute " + c.name)
-			return
 		}
+		return err
 	}
 }
 
@@ -128,7 +623,17 @@ func validCommandChain(commands []string) (commandChain, bool) {
 	maxRecursion := conf.fields.RecursionDepth
 	conf.Unlock()
 
-	for index, entry := range commands {
+	var elems []string
+	for _, entry := range commands {
+		e, _, err := parseChainStep(entry)
+		if err != nil {
+			l.Println(err)
+			return nil, false
+		}
+		elems = append(elems, e...)
+	}
+
+	for index, entry := range elems {
 
 		fields := strings.Fields(entry)
 		if len(fields) > 0 {
@@ -149,7 +654,7 @@ func validCommandChain(commands []string) (commandChain, bool) {
 
 			if val, ok := recursionMap[cmd.name]; ok {
 				if val == maxRecursion {
-					l.Println("recursion limit", maxRecursion, "reached for command:", cmd.name)
+					l.Println(ErrRecursionLimit.Error()+": "+cmd.name+" occurs more than "+strconv.Itoa(maxRecursion)+" times in the commandChain:", strings.Join(elems[:index+1], " "+commandChainSeparator+" "))
 					return nil, false
 				}
 				recursionMap[cmd.name]++
@@ -40,6 +40,15 @@ type commandData struct {
 	// Help page text
 	Help string `yaml:"help"`
 
+	// Markdown file with the manual of the command, instead of the help text
+	HelpFile string `yaml:"helpFile"`
+
+	// invocations of the command with realistic argument values
+	Examples []string `yaml:"examples"`
+
+	// command line that prints argument values for the completion, in the name=value format
+	CompletionCmd string `yaml:"completionCmd"`
+
 	// Arguments
 	Arguments []string `yaml:"arguments"`
 
@@ -49,6 +58,21 @@ type commandData struct {
 	// ouptuts
 	Outputs []string `yaml:"outputs"`
 
+	// condition to skip the command, like: exists('dist/app') && env('CI') != 'true'
+	SkipIf string `yaml:"skipIf"`
+
+	// files the command depends on, glob patterns or paths
+	Inputs []string `yaml:"inputs"`
+
+	// report files produced by the command, in the type=path format
+	Reports []string `yaml:"reports"`
+
+	// ports of a service, in the variable=port format
+	Ports []string `yaml:"ports"`
+
+	// tools in the PATH with optional version constraints: docker >= 24
+	Requires []string `yaml:"requires"`
+
 	// increase buildnumber on each execution
 	BuildNumber bool `yaml:"buildNumber"`
 
@@ -60,6 +84,27 @@ type commandData struct {
 
 	// Path allows to set a custom path for the command
 	Path string `yaml:"path"`
+
+	// license compliance check, executed before the command
+	Compliance *complianceData `yaml:"compliance"`
+
+	// generate checksums and a software bill of materials for the outputs
+	SBOM bool `yaml:"sbom"`
+
+	// allocate a pseudo terminal for the command
+	TTY bool `yaml:"tty"`
+
+	// run the built-in static file server instead of a script
+	Serve *staticServerData `yaml:"serve"`
+
+	// variables merged over the project globals for this command
+	Env map[string]*globalData `yaml:"env"`
+
+	// paths and glob patterns copied into the dump directory when the command fails
+	OnFailureCollect []string `yaml:"onFailureCollect"`
+
+	// commands that run after the top-level invocation, even if it failed or was interrupted
+	Finally []string `yaml:"finally"`
 }
 
 // intialize a command from a commandData instance
@@ -94,8 +139,11 @@ func (d *commandData) init(commandsFile *CommandsFile, name string) error {
 		return errors.New("command " + name + " has custom path set, but specifies an exec action")
 	}
 
+	dependencies, orderOnly := splitOrderOnly(d.Dependencies)
+	dependencies, asyncDeps := splitAsyncDependencies(dependencies)
+
 	// check if the current command is a dependency and abort if true
-	for index, dep := range d.Dependencies {
+	for index, dep := range dependencies {
 		fields := strings.Fields(dep)
 		if len(fields) >= 1 {
 			if fields[0] == name {
@@ -131,6 +179,54 @@ func (d *commandData) init(commandsFile *CommandsFile, name string) error {
 		return errors.New("command " + name + ": " + err.Error())
 	}
 
+	reports, err := validateReports(d.Reports)
+	if err != nil {
+		return errors.New("command " + name + ": " + err.Error())
+	}
+
+	ports, err := validatePorts(d.Ports)
+	if err != nil {
+		return errors.New("command " + name + ": " + err.Error())
+	}
+
+	err = validateRequirements(d.Requires)
+	if err != nil {
+		return errors.New("command " + name + ": " + err.Error())
+	}
+
+	g.RLock()
+	env, envTypes, err := parseGlobals(d.Env, g.Vars)
+	g.RUnlock()
+	if err != nil {
+		return errors.New("command " + name + ": " + err.Error())
+	}
+
+	compliance, err := newComplianceCheck(d.Compliance, commandsFile.Licenses)
+	if err != nil {
+		return errors.New("command " + name + ": " + err.Error())
+	}
+
+	if d.Help != "" && d.HelpFile != "" {
+		return errors.New("command " + name + ": " + ErrHelpAndHelpFile.Error())
+	}
+
+	err = validateExamples(name, d.Examples, args)
+	if err != nil {
+		return errors.New("command " + name + ": " + err.Error())
+	}
+
+	if d.SBOM && len(d.Outputs) == 0 {
+		return errors.New("command " + name + ": " + ErrSBOMWithoutOutputs.Error())
+	}
+
+	var skipIf *expression
+	if d.SkipIf != "" {
+		skipIf, err = parseExpression(d.SkipIf)
+		if err != nil {
+			return errors.New("command " + name + ": skipIf: " + err.Error())
+		}
+	}
+
 	var lang string
 	if d.Language == "" {
 		lang = commandsFile.Language
@@ -138,13 +234,28 @@ func (d *commandData) init(commandsFile *CommandsFile, name string) error {
 		lang = d.Language
 	}
 
+	// the static file server is started by a generated shell script
+	if d.Serve != nil {
+		if d.Exec != "" || d.Path != "" {
+			return errors.New("command " + name + ": " + ErrServeWithScript.Error())
+		}
+		d.Exec, err = d.Serve.script()
+		if err != nil {
+			return errors.New("command " + name + ": " + err.Error())
+		}
+		lang = "bash"
+	}
+
 	// create command
 	cmd := &command{
-		path:        d.Path,
-		name:        name,
-		args:        args,
-		description: d.Description,
-		help:        d.Help,
+		path:          d.Path,
+		name:          name,
+		args:          args,
+		description:   d.Description,
+		help:          d.Help,
+		helpFile:      d.HelpFile,
+		examples:      d.Examples,
+		completionCmd: d.CompletionCmd,
 		// PrefixCompleter: readline.PcItem(name,
 		// 	readline.PcItemDynamic(func(path string) (res []string) {
 
@@ -183,88 +294,36 @@ func (d *commandData) init(commandsFile *CommandsFile, name string) error {
 		PrefixCompleter: readline.PcItem(name,
 
 			// completer for current commands arguments
-			readline.PcItemDynamic(func(path string) (res []string) {
-				var allRequiredArgsSet = true
-				for _, a := range args {
-					if !strings.Contains(path, a.name+"=") {
-						res = append(res, a.name+"=")
-						if !a.optional {
-							allRequiredArgsSet = false
-						}
-					}
-				}
-				if allRequiredArgsSet {
-					res = append(res, commandChainSeparator)
-				}
-				// l.Println("\npath:", path)
-				// l.Println("result:", res)
-				return
-			},
+			readline.PcItemDynamic(argumentCompleter,
 
 				// completer for next command names
-				readline.PcItemDynamic(func(path string) (res []string) {
-
-					// return all available commands
-					cmdMap.Lock()
-					defer cmdMap.Unlock()
-					for name := range cmdMap.items {
-						res = append(res, name)
-					}
-					// l.Println("\npath:", path)
-					// l.Println("result:", res)
-					return
-				},
+				readline.PcItemDynamic(chainCompleter,
 
 					// completer for next commands args
-					readline.PcItemDynamic(func(path string) (res []string) {
-
-						slice := strings.Split(path, commandChainSeparator)
-						if len(slice) == 0 {
-							return
-						}
-
-						cmdArgSlice := strings.Fields(slice[len(slice)-1])
-						if len(cmdArgSlice) == 0 {
-							return
-						}
-
-						cmdMap.Lock()
-						c, ok := cmdMap.items[cmdArgSlice[0]]
-						if !ok {
-							cmdMap.Unlock()
-							return
-						}
-						cmdMap.Unlock()
-
-						// return the next commands completer?
-						// return c.PrefixCompleter.Callback(path)
-
-						var allRequiredArgsSet = true
-						for _, a := range c.args {
-							if !strings.Contains(path, a.name+"=") {
-								res = append(res, a.name+"=")
-								if !a.optional {
-									allRequiredArgsSet = false
-								}
-							}
-						}
-						if allRequiredArgsSet {
-							res = append(res, commandChainSeparator)
-						}
-
-						// l.Println("\npath:", path)
-						// l.Println("result:", res)
-						return
-					}),
+					readline.PcItemDynamic(argumentCompleter),
 				),
 			),
 		),
-		buildNumber:  d.BuildNumber,
-		dependencies: d.Dependencies,
-		outputs:      d.Outputs,
-		exec:         d.Exec,
-		async:        d.Async,
-		language:     lang,
+		buildNumber:      d.BuildNumber,
+		dependencies:     dependencies,
+		orderOnly:        orderOnly,
+		asyncDeps:        asyncDeps,
+		env:              env,
+		envTypes:         envTypes,
+		outputs:          d.Outputs,
+		skipIf:           skipIf,
+		inputs:           d.Inputs,
+		reports:          reports,
+		compliance:       compliance,
+		sbom:             d.SBOM,
+		tty:              d.TTY,
+		ports:            ports,
+		requires:         d.Requires,
+		exec:             d.Exec,
+		onFailureCollect: d.OnFailureCollect,
+		finally:          d.Finally,
+		async:            d.Async,
+		language:         lang,
 	}
 
 	if d.Exec == "" {
@@ -0,0 +1,548 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	yaml "gopkg.in/yaml.v1"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// subcommand of the cmd builtin that changes the fields of commands
+const cmdSubcommandSet = "set"
+
+// operations on a field of a command
+const (
+	editSet = iota
+	editUnset
+	editAdd
+	editRemove
+)
+
+// ErrInvalidCommandEdit occurs when a flag of the cmd builtin names an unknown field, or the value does not fit the field
+var ErrInvalidCommandEdit = errors.New("invalid command edit")
+
+// short names of the list fields for the flags of the cmd builtin, like: --add-dep or --output
+var commandEditAliases = map[string]string{
+	"dep":     "dependencies",
+	"output":  "outputs",
+	"input":   "inputs",
+	"arg":     "arguments",
+	"example": "examples",
+	"report":  "reports",
+	"port":    "ports",
+}
+
+// a change of a field of a command
+type commandEdit struct {
+	op    int
+	field string
+	value string
+}
+
+// handle the cmd builtin
+// usage: cmd set <command>... [--<field> value] [--add-<field> value] [--remove-<field> value] [--unset <field>]
+func handleCmdCommand(args []string) error {
+
+	if len(args) < 2 || args[1] != cmdSubcommandSet {
+		l.Println("usage: cmd set <command>... [--<field> value] [--add-<field> value] [--remove-<field> value] [--unset <field>]")
+		return ErrInvalidUsage
+	}
+
+	names, edits, err := parseCommandEdits(args[2:])
+	if err != nil {
+		return err
+	}
+
+	return editCommands(names, edits)
+}
+
+// parse the names of the commands and the flags of the cmd builtin
+// the names come first, each flag takes a value
+func parseCommandEdits(args []string) (names []string, edits []*commandEdit, err error) {
+
+	for i := 0; i < len(args); i++ {
+
+		if !strings.HasPrefix(args[i], "--") {
+			if len(edits) > 0 {
+				return nil, nil, errors.New(ErrInvalidCommandEdit.Error() + ": the command names must come before the flags: " + args[i])
+			}
+			names = append(names, args[i])
+			continue
+		}
+
+		if i+1 == len(args) {
+			return nil, nil, errors.New(ErrInvalidCommandEdit.Error() + ": missing value for " + args[i])
+		}
+
+		e, err := newCommandEdit(strings.TrimPrefix(args[i], "--"), args[i+1])
+		if err != nil {
+			return nil, nil, err
+		}
+		edits = append(edits, e)
+		i++
+	}
+
+	if len(names) == 0 || len(edits) == 0 {
+		return nil, nil, errors.New(ErrInvalidUsage.Error() + ": expected command names and flags")
+	}
+	return
+}
+
+// create the edit for a flag of the cmd builtin
+// --<field> sets a field or adds to a list, --add-<field> and --remove-<field> change a list, --unset <field> removes a field
+func newCommandEdit(flag, value string) (*commandEdit, error) {
+
+	op := editSet
+	switch {
+	case flag == "unset":
+		op, flag, value = editUnset, value, ""
+	case strings.HasPrefix(flag, "add-"):
+		op, flag = editAdd, strings.TrimPrefix(flag, "add-")
+	case strings.HasPrefix(flag, "remove-"):
+		op, flag = editRemove, strings.TrimPrefix(flag, "remove-")
+	}
+
+	if name, ok := commandEditAliases[flag]; ok {
+		flag = name
+	}
+
+	switch commandFieldKind(flag) {
+	case reflect.Slice:
+		if op == editSet {
+			op = editAdd
+		}
+	case reflect.Bool:
+		if _, err := strconv.ParseBool(value); op == editSet && err != nil {
+			return nil, errors.New(ErrInvalidCommandEdit.Error() + ": " + flag + " expects a bool: " + value)
+		}
+		fallthrough
+	case reflect.String:
+		if op == editAdd || op == editRemove {
+			return nil, errors.New(ErrInvalidCommandEdit.Error() + ": " + flag + " is not a list")
+		}
+	default:
+		return nil, errors.New(ErrInvalidCommandEdit.Error() + ": unknown or unsupported field: " + flag)
+	}
+
+	return &commandEdit{op: op, field: flag, value: value}, nil
+}
+
+// the kind of a field of a command by its yaml name: string, bool or slice for lists of strings
+// reflect.Invalid for unknown fields and those that can not be edited with flags
+func commandFieldKind(name string) reflect.Kind {
+
+	t := reflect.TypeOf(commandData{})
+	for i := 0; i < t.NumField(); i++ {
+		if strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0] != name {
+			continue
+		}
+		switch f := t.Field(i).Type; {
+		case f.Kind() == reflect.String, f.Kind() == reflect.Bool:
+			return f.Kind()
+		case f.Kind() == reflect.Slice && f.Elem().Kind() == reflect.String:
+			return reflect.Slice
+		}
+	}
+	return reflect.Invalid
+}
+
+// complete the flags of the cmd builtin
+func commandEditFlagCompleter(path string) (res []string) {
+
+	for _, name := range commandFieldOrder() {
+		switch commandFieldKind(name) {
+		case reflect.Slice:
+			res = append(res, "--add-"+name, "--remove-"+name)
+		case reflect.String, reflect.Bool:
+			res = append(res, "--"+name)
+		}
+	}
+	for alias := range commandEditAliases {
+		res = append(res, "--"+alias, "--add-"+alias, "--remove-"+alias)
+	}
+	sort.Strings(res)
+	return append(res, "--unset")
+}
+
+// split a line of the interactive shell into fields, single and double quotes group words
+func splitQuotedFields(line string) (fields []string) {
+
+	var (
+		b       strings.Builder
+		quote   rune
+		inField bool
+	)
+
+	for _, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				b.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote, inField = r, true
+		case unicode.IsSpace(r):
+			if inField {
+				fields = append(fields, b.String())
+				b.Reset()
+				inField = false
+			}
+		default:
+			b.WriteRune(r)
+			inField = true
+		}
+	}
+
+	if inField {
+		fields = append(fields, b.String())
+	}
+	return
+}
+
+// apply the edits to the commands in the files of the CommandsFile they are declared in
+// all files are checked before any of them is written
+func editCommands(names []string, edits []*commandEdit) error {
+
+	parts := commandsFileParts(commandsFilePath)
+	if len(parts) == 0 {
+		return ErrFailedToReadCommandsFile
+	}
+
+	var (
+		files   = make(map[string]string)
+		changed []string
+	)
+	for _, path := range parts {
+		c, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		files[path] = string(c)
+	}
+
+	for _, name := range names {
+
+		var path string
+		for _, p := range parts {
+			if declaresYAMLCommand(files[p], name) {
+				path = p
+				break
+			}
+		}
+		if path == "" {
+			return errors.New(ErrUnknownCommand.Error() + ": " + name)
+		}
+
+		contents := files[path]
+		for _, e := range edits {
+			var err error
+			contents, err = applyCommandEdit(contents, name, e)
+			if err != nil {
+				return errors.New(path + ": " + name + ": " + err.Error())
+			}
+		}
+
+		if contents != files[path] && !contains(changed, path) {
+			changed = append(changed, path)
+		}
+		files[path] = contents
+	}
+
+	for _, path := range changed {
+		err := checkEditedCommands(files[path], names)
+		if err != nil {
+			return errors.New(path + ": " + err.Error())
+		}
+	}
+
+	for _, path := range changed {
+
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+
+		err = writeFileWithBackup(path, []byte(files[path]), info.Mode())
+		if err != nil {
+			return err
+		}
+		l.Println(printPrompt() + "updated " + path)
+	}
+
+	if len(changed) == 0 {
+		l.Println(printPrompt() + "nothing to change")
+	}
+	return nil
+}
+
+// make sure the edited file still parses and the changed fields are valid
+func checkEditedCommands(contents string, names []string) error {
+
+	err := validateCommandsFile([]byte(contents))
+	if err != nil {
+		return err
+	}
+
+	commandsFile := newCommandsFile()
+	err = yaml.Unmarshal([]byte(contents), commandsFile)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		d, ok := commandsFile.Commands[name]
+		if !ok || d == nil {
+			continue
+		}
+		_, err = validateArgs(d.Arguments)
+		if err != nil {
+			return errors.New("command " + name + ": " + err.Error())
+		}
+		if d.SkipIf != "" {
+			_, err = parseExpression(d.SkipIf)
+			if err != nil {
+				return errors.New("command " + name + ": skipIf: " + err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+// the key and value nodes of a command in a CommandsFile document
+func findYAMLCommand(doc *yamlv3.Node, name string) (key, value *yamlv3.Node) {
+
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yamlv3.MappingNode {
+		return nil, nil
+	}
+
+	root := doc.Content[0]
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value != "commands" || root.Content[i+1].Kind != yamlv3.MappingNode {
+			continue
+		}
+		commands := root.Content[i+1]
+		for j := 0; j+1 < len(commands.Content); j += 2 {
+			if commands.Content[j].Value == name {
+				return commands.Content[j], commands.Content[j+1]
+			}
+		}
+	}
+	return nil, nil
+}
+
+// check if a file of the CommandsFile declares the command
+func declaresYAMLCommand(contents, name string) bool {
+	var doc yamlv3.Node
+	if yamlv3.Unmarshal([]byte(contents), &doc) != nil {
+		return false
+	}
+	key, _ := findYAMLCommand(&doc, name)
+	return key != nil
+}
+
+// change a field of a command in the contents of a CommandsFile
+// only the lines of the field are rewritten, comments and the formatting of the rest of the file are kept
+func applyCommandEdit(contents, name string, e *commandEdit) (string, error) {
+
+	var doc yamlv3.Node
+	err := yamlv3.Unmarshal([]byte(contents), &doc)
+	if err != nil {
+		return "", err
+	}
+
+	key, value := findYAMLCommand(&doc, name)
+	if key == nil {
+		return "", errors.New(ErrUnknownCommand.Error() + ": " + name)
+	}
+
+	var (
+		lines       = strings.Split(contents, "\n")
+		cmdIndent   = key.Column - 1
+		cmdEnd      = yamlEntryEnd(lines, key.Line-1, cmdIndent)
+		fieldIndent = cmdIndent + 4
+		fieldValue  *yamlv3.Node
+
+		// the lines of the field, new fields are added at the end of the command
+		start, end = cmdEnd, cmdEnd
+	)
+
+	switch {
+	case value.Kind == yamlv3.MappingNode && value.Style&yamlv3.FlowStyle == 0:
+		if len(value.Content) > 0 {
+			fieldIndent = value.Content[0].Column - 1
+		}
+		for i := 0; i+1 < len(value.Content); i += 2 {
+			if value.Content[i].Value != e.field {
+				continue
+			}
+			fieldValue = value.Content[i+1]
+			start = value.Content[i].Line - 1
+			if i+2 < len(value.Content) {
+				end = value.Content[i+2].Line - 1
+			}
+			// blank lines and comments in front of the next field belong to it
+			for end > start+1 {
+				t := strings.TrimSpace(lines[end-1])
+				if t != "" && !(strings.HasPrefix(t, "#") && countLeadingSpace(lines[end-1]) <= fieldIndent) {
+					break
+				}
+				end--
+			}
+		}
+	case value.Kind == yamlv3.ScalarNode && value.Value == "" && value.Line == key.Line:
+		// a command without fields
+	default:
+		return "", errors.New("the command is not a block mapping")
+	}
+
+	// replace the lines of the field, or add them at the end of the command
+	replace := func(rendered []string) string {
+		return spliceLines(lines, start, end, rendered)
+	}
+
+	switch e.op {
+	case editUnset:
+		if fieldValue == nil {
+			return contents, nil
+		}
+		return replace(nil), nil
+
+	case editSet:
+		var v interface{} = e.value
+		if commandFieldKind(e.field) == reflect.Bool {
+			v, _ = strconv.ParseBool(e.value)
+		}
+		rendered, err := renderYAML(fieldIndent, map[string]interface{}{e.field: v})
+		if err != nil {
+			return "", err
+		}
+		return replace(rendered), nil
+	}
+
+	var items []string
+	if fieldValue != nil {
+		err = fieldValue.Decode(&items)
+		if err != nil {
+			return "", errors.New(e.field + " is not a list")
+		}
+	}
+
+	index := -1
+	for i, item := range items {
+		if item == e.value {
+			index = i
+			break
+		}
+	}
+	if (e.op == editAdd && index >= 0) || (e.op == editRemove && index < 0) {
+		return contents, nil
+	}
+
+	// a block sequence keeps its formatting, only the line of the item changes
+	if fieldValue != nil && fieldValue.Kind == yamlv3.SequenceNode && fieldValue.Style&yamlv3.FlowStyle == 0 && len(fieldValue.Content) > 0 {
+
+		itemIndent := countLeadingSpace(lines[fieldValue.Content[0].Line-1])
+
+		if e.op == editAdd {
+			rendered, err := renderYAML(itemIndent, []string{e.value})
+			if err != nil {
+				return "", err
+			}
+			end := yamlEntryEnd(lines, fieldValue.Content[len(fieldValue.Content)-1].Line-1, itemIndent)
+			return spliceLines(lines, end, end, rendered), nil
+		}
+
+		if len(items) > 1 {
+			start := fieldValue.Content[index].Line - 1
+			return spliceLines(lines, start, yamlEntryEnd(lines, start, itemIndent), nil), nil
+		}
+	}
+
+	// flow sequences and new fields are written as a block sequence
+	if e.op == editAdd {
+		items = append(items, e.value)
+	} else {
+		items = append(items[:index], items[index+1:]...)
+	}
+	if len(items) == 0 {
+		return replace(nil), nil
+	}
+
+	rendered, err := renderYAML(fieldIndent, map[string]interface{}{e.field: items})
+	if err != nil {
+		return "", err
+	}
+	return replace(rendered), nil
+}
+
+// the end of an entry that starts at the line start and is indented by indent:
+// the line after the last line that is indented further, blank lines at the end are not part of it
+func yamlEntryEnd(lines []string, start, indent int) int {
+
+	end := start + 1
+	for i := start + 1; i < len(lines); i++ {
+		if strings.TrimSpace(lines[i]) == "" {
+			continue
+		}
+		if countLeadingSpace(lines[i]) <= indent {
+			break
+		}
+		end = i + 1
+	}
+	return end
+}
+
+// replace the lines from start up to end with the new ones
+func spliceLines(lines []string, start, end int, replacement []string) string {
+	out := append(append(append([]string{}, lines[:start]...), replacement...), lines[end:]...)
+	return strings.Join(out, "\n")
+}
+
+// encode a value as YAML with an indentation of four spaces and indent all lines
+func renderYAML(indent int, v interface{}) ([]string, error) {
+
+	var b bytes.Buffer
+	enc := yamlv3.NewEncoder(&b)
+	enc.SetIndent(4)
+	err := enc.Encode(v)
+	if err != nil {
+		return nil, err
+	}
+	enc.Close()
+
+	lines := strings.Split(strings.TrimRight(b.String(), "\n"), "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = strings.Repeat(" ", indent) + line
+		}
+	}
+	return lines, nil
+}
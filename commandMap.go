@@ -85,9 +85,9 @@ func (cm *commandMap) init(start time.Time) {
 		// only print info when using the interactive shell
 		if len(os.Args) == 1 {
 			if len(cm.items) == 1 {
-				l.Println(cp.Text+"initialized "+cp.Prompt, "1", cp.Text+" command in: "+cp.Prompt, time.Now().Sub(start), cp.Reset+"\n")
+				l.Println(cp.Text+"initialized "+cp.Prompt, "1", cp.Text+" command in: "+cp.Prompt, formatDuration(time.Now().Sub(start)), cp.Reset+"\n")
 			} else {
-				l.Println(cp.Text+"initialized "+cp.Prompt, len(cmdMap.items), cp.Text+" commands in: "+cp.Prompt, time.Now().Sub(start), cp.Reset+"\n")
+				l.Println(cp.Text+"initialized "+cp.Prompt, len(cmdMap.items), cp.Text+" commands in: "+cp.Prompt, formatDuration(time.Now().Sub(start)), cp.Reset+"\n")
 			}
 		}
 	}
@@ -103,12 +103,21 @@ func (cm *commandMap) init(start time.Time) {
 		}
 	}
 
+	cm.setHelpCompletions()
+}
+
+// add all commands to the completer for the help page
+// cm must be locked
+func (cm *commandMap) setHelpCompletions() {
+
 	var commandCompletions []readline.PrefixCompleterInterface
 	for _, c := range cm.items {
 		commandCompletions = append(commandCompletions, readline.PcItem(c.name))
 	}
 
-	// add all commands to the completer for the help page
+	completer.Lock()
+	defer completer.Unlock()
+
 	for _, c := range completer.Children {
 		if string(c.GetName()) == "help " {
 			c.SetChildren(commandCompletions)
@@ -116,6 +125,53 @@ func (cm *commandMap) init(start time.Time) {
 	}
 }
 
+// add a command or replace the command with the same name, along with its completion
+func (cm *commandMap) replace(cmd *command) {
+
+	cm.Lock()
+	defer cm.Unlock()
+
+	cm.items[cmd.name] = cmd
+
+	var exists bool
+
+	completer.Lock()
+	for i, c := range completer.Children {
+		if string(c.GetName()) == string(cmd.PrefixCompleter.GetName()) {
+			exists = true
+			completer.Children[i] = cmd.PrefixCompleter
+		}
+	}
+	if !exists {
+		completer.Children = append(completer.Children, cmd.PrefixCompleter)
+	}
+	completer.Unlock()
+
+	cm.setHelpCompletions()
+}
+
+// remove a command and its completion
+func (cm *commandMap) remove(name string) {
+
+	cm.Lock()
+	defer cm.Unlock()
+
+	delete(cm.items, name)
+
+	var children []readline.PrefixCompleterInterface
+
+	completer.Lock()
+	for _, c := range completer.Children {
+		if strings.TrimSpace(string(c.GetName())) != name {
+			children = append(children, c)
+		}
+	}
+	completer.Children = children
+	completer.Unlock()
+
+	cm.setHelpCompletions()
+}
+
 // retrieve a command instance by passing a command string
 func (cm *commandMap) getCommand(name string) (*command, error) {
 
@@ -46,7 +46,28 @@ type CommandsFile struct {
 	Language string `yaml:"language"`
 
 	// global vars for all commands
-	Globals map[string]string `yaml:"globals"`
+	Globals map[string]*globalData `yaml:"globals"`
+
+	// globals per environment, the ones of the active profile override the globals
+	Profiles map[string]map[string]*globalData `yaml:"profiles"`
+
+	// allowed licenses for compliance checks
+	Licenses []string `yaml:"licenses"`
+
+	// git hooks mapped to commandChains
+	Hooks map[string]string `yaml:"hooks"`
+
+	// tools, variables and services needed to work on the project
+	Environment *environmentData `yaml:"environment"`
+
+	// command line that receives unknown commands, for example: npm run
+	Fallback string `yaml:"fallback"`
+
+	// groups of commands for the help and completions, in display order
+	Groups yaml.MapSlice `yaml:"groups"`
+
+	// tool versions that are downloaded into the project and put in front of the PATH
+	Toolchain map[string]*toolData `yaml:"toolchain"`
 
 	// command data
 	Commands map[string]*commandData `yaml:"commands"`
@@ -55,7 +76,7 @@ type CommandsFile struct {
 func newCommandsFile() *CommandsFile {
 	return &CommandsFile{
 		Language: "bash",
-		Globals:  make(map[string]string, 0),
+		Globals:  make(map[string]*globalData, 0),
 		Commands: make(map[string]*commandData, 0),
 	}
 }
@@ -63,40 +84,26 @@ func newCommandsFile() *CommandsFile {
 // parse and initialize all commands from the CommandsFile
 func parseCommandsFile(path string) error {
 
-	var (
-		start        = time.Now()
-		commandsFile = newCommandsFile()
-	)
+	start := time.Now()
 
-	// read file contents
-	contents, err := ioutil.ReadFile(path)
+	// read the CommandsFile and its fragments
+	commandsFile, err := loadCommandsFile(path)
 	if err != nil {
-		Log.Debug(err)
-		return ErrFailedToReadCommandsFile
-	}
-
-	// unmarshal YAML
-	err = yaml.Unmarshal(contents, commandsFile)
-	if err != nil {
-		i, lineErr := extractLineNumFromError(err.Error(), "line")
-		if lineErr == ErrNoLineNumberFound {
-			i = -1
-		} else if lineErr != nil {
-			l.Println("failed to retrieve line number in which the error ocurred:", lineErr)
-			i = -1
-		}
-		if !editorProcRunning {
-			printCodeSnippet(string(contents), commandsFilePath, i)
+		if syntaxErr, ok := err.(*commandsFileSyntaxError); ok {
+			i, lineErr := extractLineNumFromError(syntaxErr.err.Error(), "line")
+			if lineErr == ErrNoLineNumberFound {
+				i = -1
+			} else if lineErr != nil {
+				l.Println("failed to retrieve line number in which the error ocurred:", lineErr)
+				i = -1
+			}
+			if !editorProcRunning {
+				printCodeSnippet(string(syntaxErr.contents), syntaxErr.path, i)
+			}
 		}
 		return err
 	}
 
-	// validate
-	err = validateCommandsFile(contents)
-	if err != nil {
-		return err
-	}
-
 	// check if language is supported
 	_, err = ls.getLang(commandsFile.Language)
 	if err != nil {
@@ -106,9 +113,24 @@ func parseCommandsFile(path string) error {
 	// flush command map
 	cmdMap.flush()
 
-	if len(commandsFile.Globals) > 0 {
+	secrets.declare(splitSecrets(commandsFile.Globals))
+
+	if len(commandsFile.Globals) > 0 || len(commandsFile.Profiles) > 0 || envs.current() != "" {
+		vars, types, err := envs.load(commandsFile.Globals, commandsFile.Profiles)
+		if err != nil {
+			return errors.New(commandsFilePath + ": " + err.Error())
+		}
 		g = &globals{
-			Vars: commandsFile.Globals,
+			Vars:  vars,
+			types: types,
+		}
+	}
+
+	// the results of the previous CommandsFile are stale
+	substitutions.reset()
+	if conf.fields.DynamicGlobals == dynamicGlobalsStartup {
+		if err := evaluateGlobals(g.Vars); err != nil {
+			Log.WithError(err).Warn("failed to evaluate dynamic globals")
 		}
 	}
 
@@ -125,10 +147,35 @@ func parseCommandsFile(path string) error {
 	cmdMap.Lock()
 	defer cmdMap.Unlock()
 
+	err = initGitHooks(commandsFile.Hooks)
+	if err != nil {
+		return errors.New("failed to init git hooks: " + err.Error())
+	}
+
+	err = initEnvironment(commandsFile.Environment)
+	if err != nil {
+		return errors.New("failed to init environment: " + err.Error())
+	}
+
+	err = initFallback(commandsFile.Fallback)
+	if err != nil {
+		return errors.New("failed to init fallback: " + err.Error())
+	}
+
+	err = initGroups(commandsFile.Groups)
+	if err != nil {
+		return errors.New("failed to init groups: " + err.Error())
+	}
+
+	err = initToolchain(commandsFile.Toolchain)
+	if err != nil {
+		return errors.New("failed to init toolchain: " + err.Error())
+	}
+
 	// only print info when using the interactive shell
 	if len(os.Args) == 1 {
 		if conf.fields.Debug {
-			l.Println(cp.Text+"initialized "+cp.Prompt, len(cmdMap.items), cp.Text+" commands from CommandsFile in: "+cp.Prompt, time.Now().Sub(start), cp.Reset+"\n")
+			l.Println(cp.Text+"initialized "+cp.Prompt, len(cmdMap.items), cp.Text+" commands from CommandsFile in: "+cp.Prompt, formatDuration(time.Now().Sub(start)), cp.Reset+"\n")
 		}
 	}
 
@@ -142,20 +189,52 @@ func validateCommandsFile(c []byte) error {
 		fields = []string{
 			"description",
 			"help",
+			"helpFile",
+			"examples",
+			"completionCmd",
 			"language",
 			"arguments",
 			"dependencies",
 			"outputs",
+			"skipIf",
+			"inputs",
+			"reports",
+			"ports",
+			"requires",
+			"compliance",
+			"sbom",
+			"tty",
+			"serve",
+			"env",
+			"onFailureCollect",
+			"finally",
+			"secret",
+			"licenses",
 			"buildNumber",
 			"async",
 			"exec",
 			"globals",
+			"profiles",
+			"hooks",
+			"environment",
+			"tools",
+			"variables",
+			"services",
+			"fallback",
+			"groups",
+			"toolchain",
+			"version",
+			"url",
+			"bin",
+			"arch",
+			"checksums",
 			"path",
 			"commands",
 		}
 		parsedFields                 []string
 		foundField                   bool
 		globalsStarted               bool
+		profilesStarted              bool
 		commandsStarted              bool
 		globalNames                  []string
 		commandNames                 []string
@@ -172,6 +251,17 @@ func validateCommandsFile(c []byte) error {
 		} else if strings.Contains(line, "commands:") {
 			commandsStarted = true
 			globalsStarted = false
+			profilesStarted = false
+			continue
+		} else if countLeadingSpace(line) == 0 && extractYAMLField(line) != "" {
+			// the names in other sections are neither globals nor commands
+			globalsStarted = false
+			commandsStarted = false
+			profilesStarted = extractYAMLField(line) == "profiles"
+		}
+
+		// the profiles contain globals, their names are checked by YAML
+		if profilesStarted && countLeadingSpace(line) > 0 {
 			continue
 		}
 
@@ -280,30 +370,33 @@ func watchCommandsFile(path, eventID string) {
 
 	Log.Debug("watching commandsFile at ", path)
 
-	err := addEvent(newEvent(path, fsnotify.Write, "commandsFile watcher", ".yml", eventID, "internal", func(e fsnotify.Event) {
+	err := addEvent(newEvent(path, fsnotify.Write, "commandsFile watcher", ".yml", eventID, "internal", reloadCommandsFile))
+	if err != nil {
+		Log.WithError(err).Error("failed to watch commandsFile")
+	}
+}
 
-		// without sleeping every line written to stdout has the length of the previous line as offset
-		// sleeping at least 100 millisecs seems to work - strange
-		time.Sleep(100 * time.Millisecond)
-		l.Println()
+// parse the CommandsFile again after a WRITE event
+func reloadCommandsFile(e fsnotify.Event) {
 
-		Log.Debug("received commandsFile WRITE event: ", e.Name)
+	// without sleeping every line written to stdout has the length of the previous line as offset
+	// sleeping at least 100 millisecs seems to work - strange
+	time.Sleep(100 * time.Millisecond)
+	l.Println()
 
-		if !editorProcRunning {
-			printProjectHeader()
-		}
+	Log.Debug("received commandsFile WRITE event: ", e.Name)
 
-		err := parseCommandsFile(path)
-		if !editorProcRunning {
-			if err != nil {
-				Log.WithError(err).Error("failed to parse commandsFile")
-			} else {
-				printCommands()
-			}
+	if !editorProcRunning {
+		printProjectHeader()
+	}
+
+	err := parseCommandsFile(commandsFilePath)
+	if !editorProcRunning {
+		if err != nil {
+			Log.WithError(err).Error("failed to parse commandsFile")
+		} else {
+			printCommands()
 		}
-	}))
-	if err != nil {
-		Log.WithError(err).Error("failed to watch commandsFile")
 	}
 }
 
@@ -0,0 +1,344 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+
+	yaml "gopkg.in/yaml.v1"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// formatTargetCommandsFile selects the CommandsFile for the format builtin
+const formatTargetCommandsFile = "commandsfile"
+
+var (
+	// ErrUnformattedCommandsFile means the check of the CommandsFile found that it is not formatted
+	ErrUnformattedCommandsFile = errors.New("CommandsFile is not formatted")
+
+	// ErrFormatChangedCommandsFile occurs when the formatted CommandsFile would parse to different contents
+	ErrFormatChangedCommandsFile = errors.New("formatting would change the contents of the CommandsFile")
+)
+
+// the yaml field names of a struct, in declaration order
+func yamlFieldOrder(v interface{}) (names []string) {
+	t := reflect.TypeOf(v)
+	for i := 0; i < t.NumField(); i++ {
+		if name := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]; name != "" && name != "-" {
+			names = append(names, name)
+		}
+	}
+	return
+}
+
+// canonical order of the top level sections of a CommandsFile
+func commandsFileSectionOrder() []string {
+	return yamlFieldOrder(CommandsFile{})
+}
+
+// canonical order of the fields of a command, the exec comes last
+func commandFieldOrder() (names []string) {
+	for _, name := range yamlFieldOrder(commandData{}) {
+		if name != "exec" {
+			names = append(names, name)
+		}
+	}
+	return append(names, "exec")
+}
+
+// sort the keys of a mapping node in the given order
+// unknown keys follow in their original order
+func sortMappingNode(n *yamlv3.Node, order []string) {
+
+	if n == nil || n.Kind != yamlv3.MappingNode {
+		return
+	}
+
+	rank := func(key string) int {
+		for i, name := range order {
+			if name == key {
+				return i
+			}
+		}
+		return len(order)
+	}
+
+	type pair struct {
+		key, value *yamlv3.Node
+	}
+	var pairs []pair
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		pairs = append(pairs, pair{n.Content[i], n.Content[i+1]})
+	}
+
+	// insertion sort is stable and the mappings are small
+	for i := 1; i < len(pairs); i++ {
+		for j := i; j > 0 && rank(pairs[j].key.Value) < rank(pairs[j-1].key.Value); j-- {
+			pairs[j], pairs[j-1] = pairs[j-1], pairs[j]
+		}
+	}
+
+	n.Content = n.Content[:0]
+	for _, p := range pairs {
+		n.Content = append(n.Content, p.key, p.value)
+	}
+}
+
+// format a CommandsFile: canonical order of the sections and the fields of the commands,
+// an indentation of four spaces and a blank line between sections and between commands
+// comments are preserved, the order of the commands is kept
+func formatCommandsFile(contents string) (string, error) {
+
+	var doc yamlv3.Node
+	err := yamlv3.Unmarshal([]byte(contents), &doc)
+	if err != nil {
+		return "", err
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yamlv3.MappingNode {
+		return "", errors.New("expected a mapping at the top level of the CommandsFile")
+	}
+
+	root := doc.Content[0]
+	sortMappingNode(root, commandsFileSectionOrder())
+
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value != "commands" {
+			continue
+		}
+		commands := root.Content[i+1]
+		if commands.Kind != yamlv3.MappingNode {
+			continue
+		}
+		for j := 1; j < len(commands.Content); j += 2 {
+			sortMappingNode(commands.Content[j], commandFieldOrder())
+		}
+	}
+
+	var b bytes.Buffer
+	enc := yamlv3.NewEncoder(&b)
+	enc.SetIndent(4)
+	err = enc.Encode(&doc)
+	if err != nil {
+		return "", err
+	}
+	enc.Close()
+
+	formatted := separateYAMLEntries(b.String())
+
+	// the formatting must not change what zeus reads from the file
+	var before, after = newCommandsFile(), newCommandsFile()
+	err = yaml.Unmarshal([]byte(contents), before)
+	if err != nil {
+		return "", err
+	}
+	err = yaml.Unmarshal([]byte(formatted), after)
+	if err != nil || !reflect.DeepEqual(before, after) {
+		return "", ErrFormatChangedCommandsFile
+	}
+
+	return formatted, nil
+}
+
+// insert a blank line in front of every top level section and every command, except the first ones
+// comments directly above an entry stay attached to it
+func separateYAMLEntries(contents string) string {
+
+	var (
+		lines    = strings.Split(contents, "\n")
+		out      []string
+		commands bool
+		first    = true
+		firstCmd = true
+	)
+
+	separate := func() {
+		// move the blank line above the comments of the entry
+		i := len(out)
+		for i > 0 && strings.HasPrefix(strings.TrimSpace(out[i-1]), "#") {
+			i--
+		}
+		if i > 0 && strings.TrimSpace(out[i-1]) != "" {
+			out = append(out[:i], append([]string{""}, out[i:]...)...)
+		}
+	}
+
+	for _, line := range lines {
+
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			out = append(out, line)
+			continue
+		}
+
+		switch level := countLeadingSpace(line); {
+		case level == 0 && !strings.HasPrefix(line, "-"):
+			if !first {
+				separate()
+			}
+			first = false
+			commands = strings.HasPrefix(line, "commands:")
+		case commands && level == 4 && !strings.HasPrefix(trimmed, "-"):
+			if !firstCmd {
+				separate()
+			}
+			firstCmd = false
+		}
+		out = append(out, line)
+	}
+	return strings.Join(out, "\n")
+}
+
+// add the entry of a command at the end of the commands section of a CommandsFile
+// the fields are indented like the other commands, the rest of the file is left untouched
+// a missing commands section is appended
+func insertYAMLCommand(contents, name string, fields []string) string {
+
+	var (
+		lines      = strings.Split(strings.TrimRight(contents, "\n"), "\n")
+		section    = -1
+		end        = len(lines)
+		entryLevel = -1
+		fieldLevel = -1
+	)
+
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		level := countLeadingSpace(line)
+
+		if section < 0 {
+			if strings.TrimRight(line, " ") == "commands:" {
+				section = i
+			}
+			continue
+		}
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if level == 0 {
+			end = i
+			break
+		}
+		if entryLevel < 0 {
+			entryLevel = level
+		} else if fieldLevel < 0 && level > entryLevel {
+			fieldLevel = level
+		}
+	}
+
+	if entryLevel < 0 {
+		entryLevel = 4
+	}
+	if fieldLevel < 0 {
+		fieldLevel = entryLevel + 4
+	}
+
+	entry := []string{"", strings.Repeat(" ", entryLevel) + name + ":"}
+	for _, f := range fields {
+		entry = append(entry, strings.Repeat(" ", fieldLevel)+f)
+	}
+
+	if section < 0 {
+		return strings.Join(append(lines, append([]string{"", "commands:"}, entry[1:]...)...), "\n") + "\n"
+	}
+
+	// blank lines and comments above the next section belong to it
+	for end > section+1 {
+		t := strings.TrimSpace(lines[end-1])
+		if t != "" && !(strings.HasPrefix(t, "#") && countLeadingSpace(lines[end-1]) == 0) {
+			break
+		}
+		end--
+	}
+
+	if end < len(lines) && strings.TrimSpace(lines[end]) != "" {
+		// keep the next section apart
+		entry = append(entry, "")
+	}
+
+	out := append(append(append([]string{}, lines[:end]...), entry...), lines[end:]...)
+	return strings.Join(out, "\n") + "\n"
+}
+
+// format the CommandsFile and its fragments on disk, or check if they are formatted
+func formatCommandsFileOnDisk(check bool) error {
+
+	parts := commandsFileParts(commandsFilePath)
+	if len(parts) == 0 {
+		return ErrFailedToReadCommandsFile
+	}
+
+	var unformatted bool
+	for _, path := range parts {
+		err := formatCommandsFilePart(path, check)
+		if err == ErrUnformattedCommandsFile {
+			unformatted = true
+		} else if err != nil {
+			return errors.New(path + ": " + err.Error())
+		}
+	}
+
+	if unformatted {
+		return ErrUnformattedCommandsFile
+	}
+	return nil
+}
+
+// format a file of the CommandsFile, or check if it is formatted
+func formatCommandsFilePart(path string, check bool) error {
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	formatted, err := formatCommandsFile(string(contents))
+	if err != nil {
+		return err
+	}
+
+	if formatted == string(contents) {
+		l.Println(printPrompt() + path + " is formatted")
+		return nil
+	}
+
+	if check {
+		l.Println(cp.Text + "not formatted: " + cp.Prompt + path + cp.Reset)
+		return ErrUnformattedCommandsFile
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	// the contents for zeus are the same, no need to parse it again
+	blockWriteEvent()
+
+	err = ioutil.WriteFile(path, []byte(formatted), info.Mode())
+	if err != nil {
+		return err
+	}
+	l.Println(printPrompt() + "formatted " + path)
+	return nil
+}
@@ -0,0 +1,297 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/fsnotify/fsnotify"
+	yaml "gopkg.in/yaml.v2"
+)
+
+var (
+	// directory with fragments of the CommandsFile, merged in the order of their file names
+	commandsFragmentsDir = zeusDir + "/zeus.d"
+
+	// ErrDuplicateDefinition occurs when a command, global, hook or group is defined in more than one file
+	ErrDuplicateDefinition = errors.New("defined more than once")
+)
+
+// commandsFileSyntaxError occurs when a file of the CommandsFile is not valid YAML
+type commandsFileSyntaxError struct {
+	path     string
+	contents []byte
+	err      error
+}
+
+func (e *commandsFileSyntaxError) Error() string {
+	return e.path + ": " + e.err.Error()
+}
+
+// the fragments of the CommandsFile, sorted by file name
+func commandsFragments() (paths []string) {
+
+	files, err := ioutil.ReadDir(commandsFragmentsDir)
+	if err != nil {
+		return nil
+	}
+
+	for _, f := range files {
+		if ext := filepath.Ext(f.Name()); !f.IsDir() && (ext == ".yml" || ext == ".yaml") {
+			paths = append(paths, filepath.Join(commandsFragmentsDir, f.Name()))
+		}
+	}
+	sort.Strings(paths)
+	return
+}
+
+// the files of the CommandsFile that exist, the main file first
+func commandsFileParts(path string) (paths []string) {
+	if _, err := os.Stat(path); err == nil {
+		paths = append(paths, path)
+	}
+	return append(paths, commandsFragments()...)
+}
+
+// read, validate and merge the CommandsFile and its fragments
+func loadCommandsFile(path string) (*CommandsFile, error) {
+
+	var (
+		commandsFile = newCommandsFile()
+		origins      = make(map[string]string)
+		parts        = commandsFileParts(path)
+	)
+
+	_, starErr := os.Stat(commandsStarPath)
+	if len(parts) == 0 && starErr != nil {
+		return nil, ErrFailedToReadCommandsFile
+	}
+
+	for _, part := range parts {
+
+		contents, err := ioutil.ReadFile(part)
+		if err != nil {
+			Log.Debug(err)
+			return nil, ErrFailedToReadCommandsFile
+		}
+
+		// the language of a fragment is the default for its commands only
+		fragment := &CommandsFile{}
+		if part == path {
+			fragment = commandsFile
+		}
+
+		err = yaml.Unmarshal(contents, fragment)
+		if err != nil {
+			return nil, &commandsFileSyntaxError{path: part, contents: contents, err: err}
+		}
+
+		err = validateCommandsFile(contents)
+		if err != nil {
+			if part != path {
+				return nil, errors.New(part + ": " + err.Error())
+			}
+			return nil, err
+		}
+
+		if part == path {
+			for name := range commandsFile.Commands {
+				origins["command "+name] = part
+			}
+			for name := range commandsFile.Globals {
+				origins["global "+name] = part
+			}
+			for name := range commandsFile.Profiles {
+				origins["profile "+name] = part
+			}
+			continue
+		}
+
+		err = commandsFile.merge(fragment, part, origins)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// the generated commands come last, so the script can not replace commands from the YAML files
+	if starErr == nil {
+		fragment, err := evalCommandsStar(commandsStarPath)
+		if err != nil {
+			return nil, errors.New(commandsStarPath + ": " + err.Error())
+		}
+		err = commandsFile.merge(fragment, commandsStarPath, origins)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return commandsFile, nil
+}
+
+// add the sections of a fragment
+// origins maps the definitions to the files they have been found in
+func (c *CommandsFile) merge(fragment *CommandsFile, path string, origins map[string]string) error {
+
+	define := func(kind, name string) error {
+		key := kind + " " + name
+		if prev, ok := origins[key]; ok {
+			return errors.New(key + " " + ErrDuplicateDefinition.Error() + ": " + prev + ", " + path)
+		}
+		origins[key] = path
+		return nil
+	}
+
+	var commands []string
+	for name := range fragment.Commands {
+		commands = append(commands, name)
+	}
+	sort.Strings(commands)
+
+	for _, name := range commands {
+		if err := define("command", name); err != nil {
+			return err
+		}
+		d := fragment.Commands[name]
+		if d != nil && d.Language == "" {
+			d.Language = fragment.Language
+		}
+		c.Commands[name] = d
+	}
+
+	var globals []string
+	for name := range fragment.Globals {
+		globals = append(globals, name)
+	}
+	sort.Strings(globals)
+
+	for _, name := range globals {
+		if err := define("global", name); err != nil {
+			return err
+		}
+		c.Globals[name] = fragment.Globals[name]
+	}
+
+	var profiles []string
+	for name := range fragment.Profiles {
+		profiles = append(profiles, name)
+	}
+	sort.Strings(profiles)
+
+	for _, name := range profiles {
+		if err := define("profile", name); err != nil {
+			return err
+		}
+		if c.Profiles == nil {
+			c.Profiles = make(map[string]map[string]*globalData)
+		}
+		c.Profiles[name] = fragment.Profiles[name]
+	}
+
+	for _, name := range sortedKeys(fragment.Hooks) {
+		if err := define("hook", name); err != nil {
+			return err
+		}
+		if c.Hooks == nil {
+			c.Hooks = make(map[string]string)
+		}
+		c.Hooks[name] = fragment.Hooks[name]
+	}
+
+	for _, item := range fragment.Groups {
+		name, _ := item.Key.(string)
+		if err := define("group", name); err != nil {
+			return err
+		}
+		c.Groups = append(c.Groups, item)
+	}
+
+	var tools []string
+	for name := range fragment.Toolchain {
+		tools = append(tools, name)
+	}
+	sort.Strings(tools)
+
+	for _, name := range tools {
+		if err := define("tool", name); err != nil {
+			return err
+		}
+		if c.Toolchain == nil {
+			c.Toolchain = make(map[string]*toolData)
+		}
+		c.Toolchain[name] = fragment.Toolchain[name]
+	}
+
+	if fragment.Fallback != "" {
+		if err := define("fallback", "command"); err != nil {
+			return err
+		}
+		c.Fallback = fragment.Fallback
+	}
+
+	known := make(map[string]bool)
+	for _, license := range c.Licenses {
+		known[license] = true
+	}
+	for _, license := range fragment.Licenses {
+		if !known[license] {
+			known[license] = true
+			c.Licenses = append(c.Licenses, license)
+		}
+	}
+
+	if e := fragment.Environment; e != nil {
+		if c.Environment == nil {
+			c.Environment = &environmentData{}
+		}
+		c.Environment.Tools = append(c.Environment.Tools, e.Tools...)
+		c.Environment.Variables = append(c.Environment.Variables, e.Variables...)
+		c.Environment.Services = append(c.Environment.Services, e.Services...)
+	}
+
+	return nil
+}
+
+// parse the CommandsFile again when a fragment changed
+func watchCommandsFragments(eventID string) {
+
+	// don't add a new watcher when the event exists
+	projectData.Lock()
+	for _, e := range projectData.fields.Events {
+		if e.Name == "commandsFile fragments watcher" {
+			projectData.Unlock()
+			return
+		}
+	}
+	projectData.Unlock()
+
+	if _, err := os.Stat(commandsFragmentsDir); err != nil {
+		return
+	}
+
+	Log.Debug("watching commandsFile fragments at ", commandsFragmentsDir)
+
+	err := addEvent(newEvent(commandsFragmentsDir, fsnotify.Write, "commandsFile fragments watcher", ".yml", eventID, "internal", reloadCommandsFile))
+	if err != nil {
+		Log.WithError(err).Error("failed to watch commandsFile fragments")
+	}
+}
@@ -0,0 +1,268 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/fsnotify/fsnotify"
+	"go.starlark.net/resolve"
+	"go.starlark.net/starlark"
+	yaml "gopkg.in/yaml.v2"
+)
+
+var (
+	// starlark script that generates commands, evaluated after the CommandsFile and its fragments
+	commandsStarPath = zeusDir + "/commands.star"
+
+	// ErrInvalidStarValue occurs when a value passed to a builtin of the commands script can not be used in the CommandsFile
+	ErrInvalidStarValue = errors.New("unsupported value")
+)
+
+// evaluate the commands script into a fragment of the CommandsFile
+// the commands it declares are merged like the ones of a fragment, so names must be unique across all files
+func evalCommandsStar(path string) (*CommandsFile, error) {
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		fragment = &CommandsFile{
+			Commands: make(map[string]*commandData),
+		}
+		thread = &starlark.Thread{
+			Name: filepath.Base(path),
+			Print: func(_ *starlark.Thread, msg string) {
+				l.Println(msg)
+			},
+		}
+		predeclared = starlark.StringDict{
+			"command": starlark.NewBuiltin("command", fragment.starCommand),
+			"env":     starlark.NewBuiltin("env", starEnv),
+			"exists":  starlark.NewBuiltin("exists", starExists),
+			"glob":    starlark.NewBuiltin("glob", starGlob),
+		}
+	)
+
+	// loops and conditions at the top level of the script
+	resolve.AllowGlobalReassign = true
+
+	_, err = starlark.ExecFile(thread, path, contents, predeclared)
+	if err != nil {
+		if evalErr, ok := err.(*starlark.EvalError); ok {
+			return nil, errors.New(evalErr.Backtrace())
+		}
+		return nil, err
+	}
+
+	return fragment, nil
+}
+
+// command(name, fields={}, **fields)
+// declares a command, the fields are the ones of a command in the CommandsFile
+// fields that are keywords in starlark, like async and finally, can be passed in the dict
+func (c *CommandsFile) starCommand(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+
+	var (
+		name   string
+		fields *starlark.Dict
+	)
+	err := starlark.UnpackPositionalArgs(fn.Name(), args, nil, 1, &name, &fields)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]starlark.Value)
+	if fields != nil {
+		for _, item := range fields.Items() {
+			key, ok := starlark.AsString(item[0])
+			if !ok {
+				return nil, errors.New(fn.Name() + ": " + name + ": field names must be strings")
+			}
+			values[key] = item[1]
+		}
+	}
+	for _, kv := range kwargs {
+		values[string(kv[0].(starlark.String))] = kv[1]
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	data := make(map[string]interface{}, len(values))
+	for _, key := range keys {
+		if !contains(commandFields, key) {
+			return nil, errors.New(fn.Name() + ": " + name + ": unknown field: " + key)
+		}
+		v, err := starlarkToGo(values[key])
+		if err != nil {
+			return nil, errors.New(fn.Name() + ": " + name + ": " + key + ": " + err.Error())
+		}
+		data[key] = v
+	}
+
+	if _, ok := c.Commands[name]; ok {
+		return nil, errors.New(fn.Name() + ": " + name + ": " + ErrDuplicateDefinition.Error())
+	}
+
+	// the fields take the same path as the ones from the YAML files
+	out, err := yaml.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	d := &commandData{}
+	err = yaml.Unmarshal(out, d)
+	if err != nil {
+		return nil, errors.New(fn.Name() + ": " + name + ": " + err.Error())
+	}
+	c.Commands[name] = d
+
+	return starlark.None, nil
+}
+
+// env(name, default="")
+func starEnv(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+
+	var name, def string
+	err := starlark.UnpackArgs(fn.Name(), args, kwargs, "name", &name, "default?", &def)
+	if err != nil {
+		return nil, err
+	}
+
+	if value, ok := os.LookupEnv(name); ok {
+		return starlark.String(value), nil
+	}
+	return starlark.String(def), nil
+}
+
+// exists(path)
+func starExists(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+
+	var path string
+	err := starlark.UnpackArgs(fn.Name(), args, kwargs, "path", &path)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = os.Stat(path)
+	return starlark.Bool(err == nil), nil
+}
+
+// glob(pattern)
+func starGlob(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+
+	var pattern string
+	err := starlark.UnpackArgs(fn.Name(), args, kwargs, "pattern", &pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []starlark.Value
+	for _, m := range matches {
+		items = append(items, starlark.String(m))
+	}
+	return starlark.NewList(items), nil
+}
+
+// convert a starlark value into the types of a YAML document
+func starlarkToGo(v starlark.Value) (interface{}, error) {
+
+	switch v := v.(type) {
+	case starlark.NoneType:
+		return nil, nil
+	case starlark.Bool:
+		return bool(v), nil
+	case starlark.Int:
+		i, ok := v.Int64()
+		if !ok {
+			return nil, errors.New(ErrInvalidStarValue.Error() + ": integer out of range: " + v.String())
+		}
+		return i, nil
+	case starlark.Float:
+		return float64(v), nil
+	case starlark.String:
+		return string(v), nil
+	case starlark.Indexable:
+		// lists and tuples
+		items := make([]interface{}, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			item, err := starlarkToGo(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	case *starlark.Dict:
+		m := make(map[string]interface{}, v.Len())
+		for _, item := range v.Items() {
+			key, ok := starlark.AsString(item[0])
+			if !ok {
+				return nil, errors.New(ErrInvalidStarValue.Error() + ": dict keys must be strings: " + item[0].String())
+			}
+			value, err := starlarkToGo(item[1])
+			if err != nil {
+				return nil, err
+			}
+			m[key] = value
+		}
+		return m, nil
+	}
+
+	return nil, errors.New(ErrInvalidStarValue.Error() + ": " + v.Type())
+}
+
+// parse the CommandsFile again when the commands script changed
+func watchCommandsStar(eventID string) {
+
+	// don't add a new watcher when the event exists
+	projectData.Lock()
+	for _, e := range projectData.fields.Events {
+		if e.Name == "commandsFile script watcher" {
+			projectData.Unlock()
+			return
+		}
+	}
+	projectData.Unlock()
+
+	if _, err := os.Stat(commandsStarPath); err != nil {
+		return
+	}
+
+	Log.Debug("watching commandsFile script at ", commandsStarPath)
+
+	err := addEvent(newEvent(commandsStarPath, fsnotify.Write, "commandsFile script watcher", ".star", eventID, "internal", reloadCommandsFile))
+	if err != nil {
+		Log.WithError(err).Error("failed to watch commandsFile script")
+	}
+}
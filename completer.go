@@ -22,7 +22,9 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -58,6 +60,34 @@ func newAtomicCompleter() *atomicCompleter {
 	}
 }
 
+// Do implements the readline.AutoCompleter interface
+// the arguments of commands and command chains and the flags of the cmd builtin are completed from all words before the cursor,
+// everything else by the prefix completer
+func (c *atomicCompleter) Do(line []rune, pos int) (newLine [][]rune, length int) {
+
+	text := string(line[:pos])
+
+	candidates, ok := contextCandidates(text)
+	if !ok {
+		return c.PrefixCompleter.Do(line, pos)
+	}
+
+	current := currentWord(text)
+	for _, candidate := range candidates {
+		if !strings.HasPrefix(candidate, current) {
+			continue
+		}
+		suffix := candidate[len(current):]
+
+		// labels and directories are followed by their value
+		if !strings.HasSuffix(candidate, "=") && !strings.HasSuffix(candidate, "/") {
+			suffix += " "
+		}
+		newLine = append(newLine, []rune(suffix))
+	}
+	return newLine, len([]rune(current))
+}
+
 // assemble and return all items for config item completion
 // also used for validating the config YAML for unknown fields
 // if there's a key in the config that is not in here there will be a warning
@@ -65,14 +95,18 @@ func configItems() []readline.PrefixCompleterInterface {
 	return []readline.PrefixCompleterInterface{
 		readline.PcItem("makefileOverview", readline.PcItem("true"), readline.PcItem("false")),
 		readline.PcItem("autoFormat", readline.PcItem("true"), readline.PcItem("false")),
+		readline.PcItem("lintOnSave", readline.PcItem("true"), readline.PcItem("false")),
 		readline.PcItem("fixParseErrors", readline.PcItem("true"), readline.PcItem("false")),
 		readline.PcItem("colors", readline.PcItem("true"), readline.PcItem("false")),
+		readline.PcItem("accessible", readline.PcItem("true"), readline.PcItem("false")),
 		readline.PcItem("passCommandsToShell", readline.PcItem("true"), readline.PcItem("false")),
 		readline.PcItem("eebInterface", readline.PcItem("true"), readline.PcItem("false")),
 		readline.PcItem("interactive", readline.PcItem("true"), readline.PcItem("false")),
 		readline.PcItem("debug", readline.PcItem("true"), readline.PcItem("false")),
 		readline.PcItem("recursionDepth"),
+		readline.PcItem("maxRecursionDepth"),
 		readline.PcItem("projectNamePrompt", readline.PcItem("true"), readline.PcItem("false")),
+		readline.PcItem("prompt"),
 		readline.PcItem("colorProfile"),
 		readline.PcItem("historyFile", readline.PcItem("true"), readline.PcItem("false")),
 		readline.PcItem("historyLimit"),
@@ -80,14 +114,73 @@ func configItems() []readline.PrefixCompleterInterface {
 		readline.PcItem("disableTimestamps", readline.PcItem("true"), readline.PcItem("false")),
 		readline.PcItem("printBuiltins", readline.PcItem("true"), readline.PcItem("false")),
 		readline.PcItem("dumpScriptOnError", readline.PcItem("true"), readline.PcItem("false")),
+		readline.PcItem("dumpDir"),
+		readline.PcItem("dumpRetention"),
+		readline.PcItem("dumpFormat", readline.PcItem(dumpFormatScript), readline.PcItem(dumpFormatJSON)),
+		readline.PcItem("vcs", readline.PcItem(vcsAuto), readline.PcItem(vcsGit), readline.PcItem(vcsMercurial), readline.PcItem(vcsNone)),
 		readline.PcItem("stopOnError", readline.PcItem("true"), readline.PcItem("false")),
 		readline.PcItem("portWebPanel"),
 		readline.PcItem("portGlueServer"),
+		readline.PcItem("portGRPC"),
 		readline.PcItem("dateFormat"),
 		readline.PcItem("todoFilePath"),
 		readline.PcItem("editor"),
+		readline.PcItem("sarifOutput"),
+		readline.PcItem("logDir"),
+		readline.PcItem("logRetention"),
+		readline.PcItem("runHistorySize"),
+		readline.PcItem("stdErrBufferSize"),
+		readline.PcItem("rawOutput",
+			readline.PcItem("true"),
+			readline.PcItem("false"),
+		),
+		readline.PcItem("fancyOutput",
+			readline.PcItem("true"),
+			readline.PcItem("false"),
+		),
+		readline.PcItem("commandOrder",
+			readline.PcItem(commandOrderAlphabetical),
+			readline.PcItem(commandOrderGroup),
+		),
+		readline.PcItem("portConflicts",
+			readline.PcItem(portConflictsFail),
+			readline.PcItem(portConflictsAllocate),
+		),
+		readline.PcItem("gracePeriod"),
+		readline.PcItem("asyncOnExit",
+			readline.PcItem(asyncOnExitOrphan),
+			readline.PcItem(asyncOnExitTerminate),
+		),
+		readline.PcItem("secretKeyFile"),
+		readline.PcItem("redactPatterns"),
+		readline.PcItem("dynamicGlobals",
+			readline.PcItem(dynamicGlobalsLazy),
+			readline.PcItem(dynamicGlobalsStartup),
+		),
+		readline.PcItem("durationFormat",
+			readline.PcItem(durationFormatCompact),
+			readline.PcItem(durationFormatGo),
+		),
+		readline.PcItem("durationPrecision"),
+		readline.PcItem("apiToken"),
+		readline.PcItem("credentialHelpers"),
+		readline.PcItem("reproducible",
+			readline.PcItem("true"),
+			readline.PcItem("false"),
+		),
+		readline.PcItem("updateChannel",
+			readline.PcItem(updateChannelStable),
+			readline.PcItem(updateChannelBeta),
+		),
+		readline.PcItem("sbomFormat",
+			readline.PcItem(sbomFormatCycloneDX),
+			readline.PcItem(sbomFormatSPDX),
+		),
 		readline.PcItem("codeSnippetScope"),
 		readline.PcItem("quiet", readline.PcItem("true"), readline.PcItem("false")),
+		readline.PcItem("prefixOutput", readline.PcItem("true"), readline.PcItem("false")),
+		readline.PcItem("bufferOutput", readline.PcItem("true"), readline.PcItem("false")),
+		readline.PcItem("projectLock", readline.PcItem("true"), readline.PcItem("false")),
 	}
 }
 
@@ -125,11 +218,17 @@ func newCompleter() *readline.PrefixCompleter {
 	c := readline.NewPrefixCompleter(
 		readline.PcItem(exitCommand),
 		readline.PcItem(helpCommand,
+			readline.PcItem(longOverviewFlag),
 			readline.PcItemDynamic(commandCompleter),
 		),
 		readline.PcItem(infoCommand),
 		readline.PcItem(clearCommand),
-		readline.PcItem(formatCommand),
+		readline.PcItem(formatCommand,
+			readline.PcItem(formatFlagCheck),
+			readline.PcItem(formatTargetCommandsFile,
+				readline.PcItem(formatFlagCheck),
+			),
+		),
 		readline.PcItem(globalsCommand),
 		readline.PcItem(versionCommand),
 		readline.PcItem(configCommand,
@@ -139,9 +238,23 @@ func newCompleter() *readline.PrefixCompleter {
 			readline.PcItem("get",
 				configItems()...,
 			),
+			readline.PcItem("which",
+				configItems()...,
+			),
+			readline.PcItem("reload"),
 		),
 		readline.PcItem(createCommand,
 			readline.PcItemDynamic(languageCompleter),
+			readline.PcItem(createTargetCommand,
+				readline.PcItem(createFlagTemplate,
+					readline.PcItemDynamic(templateCompleter),
+				),
+			),
+			readline.PcItem(createTargetProject,
+				readline.PcItem(createFlagTemplate,
+					readline.PcItemDynamic(templateCompleter),
+				),
+			),
 			readline.PcItem("script",
 				readline.PcItem("all"),
 				readline.PcItemDynamic(commandCompleter),
@@ -165,6 +278,17 @@ func newCompleter() *readline.PrefixCompleter {
 			readline.PcItem("remove",
 				readline.PcItemDynamic(eventIDCompleter),
 			),
+			readline.PcItem("test",
+				readline.PcItemDynamic(eventIDCompleter),
+			),
+			readline.PcItem("chain",
+				readline.PcItemDynamic(eventIDCompleter,
+					readline.PcItemDynamic(eventIDCompleter),
+				),
+			),
+			readline.PcItem("ignore",
+				readline.PcItemDynamic(eventIDCompleter),
+			),
 		),
 		readline.PcItem(milestonesCommand,
 			readline.PcItem("set"),
@@ -177,7 +301,7 @@ func newCompleter() *readline.PrefixCompleter {
 			readline.PcItem("remove"),
 		),
 		readline.PcItem(makefileCommand,
-			readline.PcItem("migrate"),
+			readline.PcItem("migrate", conflictPolicyItems()),
 		),
 		readline.PcItem(dataCommand),
 		readline.PcItem(aliasCommand,
@@ -194,15 +318,23 @@ func newCompleter() *readline.PrefixCompleter {
 			readline.PcItemDynamic(commandCompleter),
 		),
 		readline.PcItem(colorsCommand,
-			readline.PcItem("off"),
-			readline.PcItem("default"),
+			readline.PcItem(colorsSubcommandPreview,
+				readline.PcItemDynamic(colorProfileCompleter),
+			),
 			readline.PcItemDynamic(colorProfileCompleter),
 		),
 		readline.PcItem(authorCommand,
 			readline.PcItem("set"),
 			readline.PcItem("remove"),
 		),
-		readline.PcItem(updateCommand),
+		readline.PcItem(updateCommand,
+			readline.PcItem(updateFlagCheck),
+			readline.PcItem(updateFlagChannel,
+				readline.PcItem(updateChannelStable),
+				readline.PcItem(updateChannelBeta),
+			),
+			readline.PcItem(updateFlagRollback),
+		),
 		readline.PcItem(builtinsCommand),
 		readline.PcItem(keysCommand,
 			readline.PcItem("set",
@@ -217,6 +349,9 @@ func newCompleter() *readline.PrefixCompleter {
 			readline.PcItem("commands",
 				readline.PcItem("line"),
 			),
+			readline.PcItem(editTargetScratch,
+				readline.PcItemDynamic(languageCompleter),
+			),
 			readline.PcItem("data",
 				readline.PcItem("line"),
 			),
@@ -231,6 +366,101 @@ func newCompleter() *readline.PrefixCompleter {
 			),
 		),
 		readline.PcItem(webCommand),
+		readline.PcItem(profileCommand,
+			readline.PcItem("clear"),
+			readline.PcItemDynamic(commandCompleter),
+		),
+		readline.PcItem(historyCommand,
+			readline.PcItem(historySubcommandLines),
+			readline.PcItemDynamic(commandCompleter),
+		),
+		readline.PcItem(statsCommand),
+		readline.PcItem(findCommand),
+		readline.PcItem(gcCommand),
+		readline.PcItem(batchCommand,
+			readline.PcItemDynamic(fileCompleter),
+		),
+		readline.PcItem(lintCommand,
+			readline.PcItemDynamic(commandCompleter),
+		),
+		readline.PcItem(dumpsCommand,
+			readline.PcItem("show"),
+			readline.PcItem("open"),
+		),
+		readline.PcItem(secretsCommand,
+			readline.PcItem("set"),
+			readline.PcItem("remove"),
+		),
+		readline.PcItem(rerunCommand,
+			readline.PcItem(rerunFlagFromFailure),
+		),
+		readline.PcItem(gitHooksCommand,
+			readline.PcItem("install"),
+			readline.PcItem("uninstall"),
+		),
+		readline.PcItem(serveCommand,
+			readline.PcItem("--api"),
+			readline.PcItem("--grpc"),
+			readline.PcItem(staticFlagDir,
+				readline.PcItemDynamic(directoryCompleter),
+			),
+		),
+		readline.PcItem(lspCommand),
+		readline.PcItem(migrateCommand,
+			readline.PcItem("makefile", conflictPolicyItems()),
+			readline.PcItem("npm", conflictPolicyItems()),
+			readline.PcItem("taskfile", conflictPolicyItems()),
+			readline.PcItem("justfile", conflictPolicyItems()),
+			readline.PcItem(migrateTargetSyntax),
+		),
+		readline.PcItem(exportCommand,
+			readline.PcItem("ci",
+				readline.PcItem(exportFlagFormat,
+					readline.PcItem(exportFormatGitHub),
+					readline.PcItem(exportFormatGitLab),
+				),
+			),
+			readline.PcItem("standalone",
+				readline.PcItemDynamic(commandCompleter),
+			),
+		),
+		readline.PcItem(envCommand,
+			readline.PcItem("diff"),
+		),
+		readline.PcItem(doctorCommand),
+		readline.PcItem(releaseCommand,
+			readline.PcItem(releaseFlagDraft),
+			readline.PcItem(releaseFlagDryRun),
+		),
+		readline.PcItem(toolchainCommand,
+			readline.PcItem("install",
+				readline.PcItemDynamic(toolchainCompleter),
+			),
+			readline.PcItem("clean"),
+		),
+		readline.PcItem(reportCommand,
+			readline.PcItem(reportTargetProject),
+		),
+		readline.PcItem(optimizeCommand),
+		readline.PcItem(cmdCommand,
+			readline.PcItem(cmdSubcommandSet,
+				readline.PcItemDynamic(commandCompleter,
+					readline.PcItemDynamic(commandEditFlagCompleter),
+				),
+			),
+		),
+		readline.PcItem(useCommand,
+			readline.PcItemDynamic(envProfileCompleter),
+		),
+		readline.PcItem(affectedCommand,
+			readline.PcItem(affectedFlagSince),
+			readline.PcItem(affectedFlagList),
+		),
+		readline.PcItem(logsCommand,
+			readline.PcItemDynamic(commandCompleter,
+				readline.PcItem("tail"),
+			),
+		),
 		readline.PcItem(procsCommand,
 			readline.PcItem("detach",
 				readline.PcItemDynamic(commandCompleter),
@@ -295,9 +525,291 @@ func commandCompleter(path string) (res []string) {
 	for name := range cmdMap.items {
 		res = append(res, name)
 	}
+	sortCommandNames(res)
+	return
+}
+
+// the word under the cursor, empty after a space
+func currentWord(text string) string {
+	if text == "" || strings.HasSuffix(text, " ") {
+		return ""
+	}
+	fields := strings.Fields(text)
+	return fields[len(fields)-1]
+}
+
+// candidates for the word under the cursor that depend on the words before it
+// only lines starting with a command or the cmd set builtin are completed, ok is false for all others
+func contextCandidates(text string) (res []string, ok bool) {
+
+	fields := strings.Fields(text)
+	if currentWord(text) != "" {
+		fields = fields[:len(fields)-1]
+	}
+	if len(fields) == 0 {
+		return nil, false
+	}
+
+	if fields[0] == cmdCommand {
+		if len(fields) < 2 || fields[1] != cmdSubcommandSet {
+			return nil, false
+		}
+		return cmdSetCandidates(fields[2:]), true
+	}
+
+	if _, err := cmdMap.getCommand(fields[0]); err != nil {
+		return nil, false
+	}
+
+	// the words after the last operator of a chain
+	segment := fields
+	for i, f := range fields {
+		if f == commandChainSeparator || f == commandChainFallback || f == commandChainParallel {
+			segment = fields[i+1:]
+		}
+	}
+	if len(segment) == 0 {
+		return chainCompleter(text), true
+	}
+
+	cmd, err := cmdMap.getCommand(segment[0])
+	if err != nil {
+		return nil, true
+	}
+	return argumentCandidates(cmd, segment[1:], currentWord(text)), true
+}
+
+// complete the arguments of the command in the last step of a command chain
+func argumentCompleter(path string) []string {
+	res, _ := contextCandidates(path)
+	return res
+}
+
+// complete the arguments of a command, after the arguments that are typed already
+// a word with a label is completed with the values of the argument
+func argumentCandidates(c *command, typed []string, current string) (res []string) {
+
+	set := make(map[string]bool)
+	for _, t := range typed {
+		// everything after -- is passed to the script
+		if t == extraArgsSeparator {
+			return nil
+		}
+		set[strings.SplitN(t, "=", 2)[0]] = true
+	}
+
+	if i := strings.Index(current, "="); i > 0 {
+		arg, ok := c.args[current[:i]]
+		if !ok {
+			return nil
+		}
+		return argumentValueCandidates(c, arg, current[i+1:])
+	}
+
+	// values from the examples come first, followed by those of the completionCmd
+	for _, v := range append(exampleArguments(c.examples), completionValues(c.name, c.completionCmd, c.args)...) {
+		if !set[strings.SplitN(v, "=", 2)[0]] {
+			res = append(res, v)
+		}
+	}
+
+	var allRequiredArgsSet = true
+	for _, name := range sortedArgNames(c.args) {
+		if set[name] {
+			continue
+		}
+		res = append(res, name+"=")
+		if !c.args[name].optional {
+			allRequiredArgsSet = false
+		}
+	}
+	if allRequiredArgsSet {
+		res = append(res, commandChainSeparator)
+	}
+	return
+}
+
+// complete the value of an argument
+// with the values of the examples and the completionCmd, the allowed values, true and false for bools and the files for paths
+func argumentValueCandidates(c *command, arg *commandArg, value string) (res []string) {
+
+	var (
+		label = arg.name + "="
+		seen  = make(map[string]bool)
+		add   = func(v string) {
+			if !seen[v] {
+				seen[v] = true
+				res = append(res, v)
+			}
+		}
+	)
+
+	for _, v := range append(exampleArguments(c.examples), completionValues(c.name, c.completionCmd, c.args)...) {
+		if strings.HasPrefix(v, label) {
+			add(v)
+		}
+	}
+	for _, v := range arg.values {
+		add(label + v)
+	}
+	if arg.argType == reflect.Bool && len(arg.values) == 0 {
+		add(label + "true")
+		add(label + "false")
+	}
+	if arg.path {
+		for _, p := range pathCandidates(value) {
+			add(label + p)
+		}
+	}
+	return
+}
+
+// complete a path relative to the working directory, directories end with a slash
+func pathCandidates(path string) (res []string) {
+
+	dir, _ := filepath.Split(path)
+
+	read := dir
+	if read == "" {
+		read = "."
+	}
+
+	files, err := ioutil.ReadDir(read)
+	if err != nil {
+		return nil
+	}
+
+	for _, f := range files {
+		if f.IsDir() {
+			res = append(res, dir+f.Name()+"/")
+			continue
+		}
+		res = append(res, dir+f.Name())
+	}
 	return
 }
 
+// complete the words after cmd set: the names of the commands, the flags and their values
+// the dependency flags are completed with the command names, removing them with the dependencies of the named commands
+func cmdSetCandidates(words []string) []string {
+
+	var (
+		names []string
+		flag  string
+		flags bool
+	)
+
+	for i := 0; i < len(words); i++ {
+		if strings.HasPrefix(words[i], "--") {
+			flags = true
+			if i+1 == len(words) {
+				flag = strings.TrimPrefix(words[i], "--")
+			}
+			i++
+			continue
+		}
+		names = append(names, words[i])
+	}
+
+	if flag == "unset" {
+		var res []string
+		for _, name := range commandFieldOrder() {
+			if commandFieldKind(name) != reflect.Invalid {
+				res = append(res, name)
+			}
+		}
+		return res
+	}
+
+	if flag != "" {
+		return commandEditValueCandidates(names, flag)
+	}
+
+	if flags {
+		return commandEditFlagCompleter("")
+	}
+
+	res := exclude(commandCompleter(""), names)
+	if len(names) > 0 {
+		res = append(res, commandEditFlagCompleter("")...)
+	}
+	return res
+}
+
+// complete the value of a flag of the cmd builtin
+func commandEditValueCandidates(names []string, flag string) (res []string) {
+
+	remove := strings.HasPrefix(flag, "remove-")
+	flag = strings.TrimPrefix(strings.TrimPrefix(flag, "add-"), "remove-")
+	if name, ok := commandEditAliases[flag]; ok {
+		flag = name
+	}
+
+	switch {
+	case flag == "dependencies" && remove:
+		seen := make(map[string]bool)
+		for _, name := range names {
+			cmd, err := cmdMap.getCommand(name)
+			if err != nil {
+				continue
+			}
+			for _, dep := range cmd.dependencies {
+				if strings.Contains(dep, " ") {
+					dep = strconv.Quote(dep)
+				}
+				if !seen[dep] {
+					seen[dep] = true
+					res = append(res, dep)
+				}
+			}
+		}
+		return res
+	case flag == "dependencies":
+		return exclude(commandCompleter(""), names)
+	case flag == "language":
+		return languageCompleter("")
+	case commandFieldKind(flag) == reflect.Bool:
+		return []string{"true", "false"}
+	}
+	return nil
+}
+
+// remove the names from the list
+func exclude(list, names []string) (res []string) {
+	for _, item := range list {
+		var found bool
+		for _, n := range names {
+			if n == item {
+				found = true
+				break
+			}
+		}
+		if !found {
+			res = append(res, item)
+		}
+	}
+	return
+}
+
+// complete the next command of a command chain
+// commands that followed the previous command in the run history are suggested first
+func chainCompleter(path string) (res []string) {
+
+	res = commandCompleter(path)
+
+	segments := strings.Split(path, commandChainSeparator)
+	if len(segments) < 2 {
+		return
+	}
+
+	fields := strings.Fields(segments[len(segments)-2])
+	if len(fields) == 0 {
+		return
+	}
+
+	return rankByFollowers(fields[0], res, runFollowers.get())
+}
+
 // complete available parser languages
 func languageCompleter(path string) (res []string) {
 	ls.Lock()
@@ -305,16 +817,25 @@ func languageCompleter(path string) (res []string) {
 	for name := range ls.items {
 		res = append(res, name)
 	}
+	sort.Strings(res)
 	return
 }
 
-func colorProfileCompleter(path string) (res []string) {
-	conf.Lock()
-	defer conf.Unlock()
-	for name := range conf.fields.ColorProfiles {
-		res = append(res, name)
-	}
-	return
+// complete the names of the tools in the toolchain
+func toolchainCompleter(path string) []string {
+	return projectToolchain.names()
+}
+
+func envProfileCompleter(path string) []string {
+	return append(envs.list(), envProfileNone)
+}
+
+func templateCompleter(path string) []string {
+	return listTemplates()
+}
+
+func colorProfileCompleter(path string) []string {
+	return colorProfileNames()
 }
 
 func todoIndexCompleter(path string) (res []string) {
@@ -457,3 +978,12 @@ func fileCompleter(path string) (names []string) {
 	}
 	return
 }
+
+// completions for the --non-interactive flag of the migrations
+func conflictPolicyItems() readline.PrefixCompleterInterface {
+	var items []readline.PrefixCompleterInterface
+	for _, p := range conflictPolicies {
+		items = append(items, readline.PcItem(p))
+	}
+	return readline.PcItem(migrateFlagNonInteractive, items...)
+}
@@ -0,0 +1,85 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// time a completionCmd may take, before its values are dropped
+const completionCmdTimeout = 2 * time.Second
+
+// run the completionCmd of a command and collect the argument values it prints
+// each line of the output has the name=value format, lines for unknown arguments are ignored
+// the command line is passed to the shell, so it can be a script or a pipeline
+func completionValues(name, completionCmd string, args map[string]*commandArg) (res []string) {
+
+	if completionCmd == "" {
+		return
+	}
+
+	var (
+		out bytes.Buffer
+		cmd = exec.Command("sh", "-c", completionCmd)
+	)
+	cmd.Env = append(os.Environ(), "ZEUS_COMMAND="+name)
+	cmd.Stdout = &out
+
+	// run in its own process group, so the timeout also stops the children of the helper
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	// a failing or slow helper only costs the values, the completion must not break
+	err := cmd.Start()
+	if err != nil {
+		Log.WithError(err).Debug("failed to start the completionCmd of " + name)
+		return
+	}
+
+	timer := time.AfterFunc(completionCmdTimeout, func() {
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	})
+	err = cmd.Wait()
+	timer.Stop()
+	if err != nil {
+		Log.WithError(err).Debug("completionCmd of " + name + " failed")
+		return
+	}
+
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		slice := strings.SplitN(line, "=", 2)
+		if len(slice) != 2 || slice[1] == "" || seen[line] {
+			continue
+		}
+		if _, ok := args[slice[0]]; !ok {
+			continue
+		}
+		seen[line] = true
+		res = append(res, line)
+	}
+	return
+}
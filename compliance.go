@@ -0,0 +1,284 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrLicenseViolation means a compliance check found licenses that are not on the allowlist
+	ErrLicenseViolation = errors.New("disallowed licenses found")
+
+	// ErrNoLicenseAllowlist means a command has a compliance check but the CommandsFile has no licenses allowlist
+	ErrNoLicenseAllowlist = errors.New("compliance check configured, but no licenses allowlist in the CommandsFile")
+
+	// ErrEmptyComplianceCheck means neither inputs nor a scanner have been specified for a compliance check
+	ErrEmptyComplianceCheck = errors.New("compliance check needs inputs or a scanner")
+
+	// file name prefixes of license files
+	licenseFileNames = []string{"LICENSE", "LICENCE", "COPYING"}
+
+	// phrases identifying a license, all phrases must be present in the license text
+	// more specific licenses must come first: the LGPL text contains the GPL phrases
+	licensePhrases = []struct {
+		id      string
+		phrases []string
+	}{
+		{"AGPL-3.0", []string{"GNU AFFERO GENERAL PUBLIC LICENSE", "VERSION 3"}},
+		{"LGPL-3.0", []string{"GNU LESSER GENERAL PUBLIC LICENSE", "VERSION 3"}},
+		{"LGPL-2.1", []string{"GNU LESSER GENERAL PUBLIC LICENSE", "VERSION 2.1"}},
+		{"GPL-3.0", []string{"GNU GENERAL PUBLIC LICENSE", "VERSION 3"}},
+		{"GPL-2.0", []string{"GNU GENERAL PUBLIC LICENSE", "VERSION 2"}},
+		{"Apache-2.0", []string{"APACHE LICENSE", "VERSION 2.0"}},
+		{"MPL-2.0", []string{"MOZILLA PUBLIC LICENSE", "2.0"}},
+		{"BSD-3-Clause", []string{"REDISTRIBUTION AND USE IN SOURCE AND BINARY FORMS", "NEITHER THE NAME"}},
+		{"BSD-2-Clause", []string{"REDISTRIBUTION AND USE IN SOURCE AND BINARY FORMS"}},
+		{"ISC", []string{"PERMISSION TO USE, COPY, MODIFY, AND/OR DISTRIBUTE THIS SOFTWARE"}},
+		{"MIT", []string{"PERMISSION IS HEREBY GRANTED, FREE OF CHARGE"}},
+		{"Unlicense", []string{"THIS IS FREE AND UNENCUMBERED SOFTWARE RELEASED INTO THE PUBLIC DOMAIN"}},
+	}
+)
+
+// license identifier for texts that could not be matched
+const unknownLicense = "unknown"
+
+// complianceData is the compliance section of a command in the CommandsFile
+type complianceData struct {
+
+	// files or directories that will be scanned for license files
+	Inputs []string `yaml:"inputs"`
+
+	// external scanner, each output line must end with the license identifier
+	// lines with commas are treated as CSV and the last column is used
+	Scanner string `yaml:"scanner"`
+}
+
+// complianceCheck is executed before a command runs
+// and fails the command if disallowed licenses are found
+type complianceCheck struct {
+	inputs  []string
+	scanner string
+	allow   []string
+}
+
+// licenseFinding is a license detected by a compliance check
+type licenseFinding struct {
+
+	// file or package the license belongs to
+	source string
+
+	// SPDX identifier
+	license string
+}
+
+// create a compliance check from the commandData section
+func newComplianceCheck(d *complianceData, allow []string) (*complianceCheck, error) {
+
+	if d == nil {
+		return nil, nil
+	}
+
+	if len(allow) == 0 {
+		return nil, ErrNoLicenseAllowlist
+	}
+
+	if len(d.Inputs) == 0 && d.Scanner == "" {
+		return nil, ErrEmptyComplianceCheck
+	}
+
+	return &complianceCheck{
+		inputs:  d.Inputs,
+		scanner: d.Scanner,
+		allow:   allow,
+	}, nil
+}
+
+// run the check and return an error if any licenses are not on the allowlist
+func (c *complianceCheck) run(name string) error {
+
+	findings, err := c.scan()
+	if err != nil {
+		return errors.New("compliance check failed: " + err.Error())
+	}
+
+	var violations []*licenseFinding
+	for _, f := range findings {
+		if !c.allowed(f.license) {
+			violations = append(violations, f)
+		}
+	}
+
+	if len(violations) == 0 {
+		Log.Debug("["+name+"] compliance check passed for ", len(findings), " licenses")
+		return nil
+	}
+
+	l.Println(cp.Prompt + "[" + name + "] " + cp.Text + "the following licenses are not allowed:")
+	for _, v := range violations {
+		l.Println(cp.Text + pad(v.license, 15) + v.source + cp.Reset)
+	}
+
+	return errors.New(ErrLicenseViolation.Error() + ": " + strconv.Itoa(len(violations)))
+}
+
+// check if a license identifier is on the allowlist
+func (c *complianceCheck) allowed(license string) bool {
+	for _, a := range c.allow {
+		if strings.EqualFold(a, license) {
+			return true
+		}
+	}
+	return false
+}
+
+// collect the licenses from the inputs and the external scanner
+func (c *complianceCheck) scan() (findings []*licenseFinding, err error) {
+
+	for _, input := range c.inputs {
+		f, err := scanLicenseFiles(input)
+		if err != nil {
+			return nil, err
+		}
+		findings = append(findings, f...)
+	}
+
+	if c.scanner != "" {
+		var (
+			out bytes.Buffer
+			cmd = exec.Command("sh", "-c", c.scanner)
+		)
+		cmd.Stdout = &out
+		cmd.Stderr = os.Stderr
+
+		err = cmd.Run()
+		if err != nil {
+			return nil, errors.New("scanner: " + err.Error())
+		}
+
+		findings = append(findings, parseScannerOutput(out.String())...)
+	}
+
+	return findings, nil
+}
+
+// walk the input and detect the license for all license files
+func scanLicenseFiles(input string) (findings []*licenseFinding, err error) {
+
+	err = filepath.Walk(input, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !isLicenseFile(info.Name()) {
+			return nil
+		}
+
+		c, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		findings = append(findings, &licenseFinding{
+			source:  path,
+			license: detectLicense(string(c)),
+		})
+		return nil
+	})
+
+	return
+}
+
+// check if the filename indicates a license file
+func isLicenseFile(name string) bool {
+	name = strings.ToUpper(name)
+	for _, prefix := range licenseFileNames {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// identify the license of a text
+// returns unknownLicense if the license could not be determined
+func detectLicense(text string) string {
+
+	for _, line := range strings.Split(text, "\n") {
+		if i := strings.Index(line, "SPDX-License-Identifier:"); i != -1 {
+			if id := strings.Fields(line[i+len("SPDX-License-Identifier:"):]); len(id) > 0 {
+				return id[0]
+			}
+		}
+	}
+
+	// normalize whitespace so phrases spanning multiple lines match
+	text = strings.ToUpper(strings.Join(strings.Fields(text), " "))
+
+	for _, lp := range licensePhrases {
+		var missing bool
+		for _, p := range lp.phrases {
+			if !strings.Contains(text, p) {
+				missing = true
+				break
+			}
+		}
+		if !missing {
+			return lp.id
+		}
+	}
+
+	return unknownLicense
+}
+
+// parse the output of an external license scanner
+func parseScannerOutput(out string) (findings []*licenseFinding) {
+
+	for _, line := range strings.Split(out, "\n") {
+
+		var fields []string
+		if strings.Contains(line, ",") {
+			fields = strings.Split(line, ",")
+		} else {
+			fields = strings.Fields(line)
+		}
+
+		if len(fields) == 0 || strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		license := strings.TrimSpace(fields[len(fields)-1])
+		if license == "" {
+			license = unknownLicense
+		}
+
+		findings = append(findings, &licenseFinding{
+			source:  strings.TrimSpace(fields[0]),
+			license: license,
+		})
+	}
+
+	return
+}
@@ -39,6 +39,9 @@ var (
 	// ErrConfigFileIsADirectory means the config file is a directory, thats wrong
 	ErrConfigFileIsADirectory = errors.New("the config file is a directory")
 
+	// ErrEmptyConfig means the config file is empty
+	ErrEmptyConfig = errors.New("config file is empty")
+
 	// path for project config file
 	projectConfigPath string
 
@@ -52,28 +55,40 @@ var (
 	configYamlField = regexp.MustCompile("^(\\s)*[A-Z]+(.|\\s)*:")
 
 	// regex for matching YAML keys from commands, config or data file
-	yamlField = regexp.MustCompile("^(\\s)*[a-z]+(.|\\s)*:")
+	yamlField = regexp.MustCompile("^(\\s)*[a-z]+(.|\\s)*?:")
 )
 
 // config contains configurable parameters
 type config struct {
 	fields *configFields
+
+	// origins of the values by field name, fields without one have their default value
+	origins map[string]string
+
+	// the project config exists, only the fields set in it are written
+	project bool
+
 	sync.RWMutex
 }
 
 type configFields struct {
 	AutoFormat          bool                     `yaml:"autoFormat"`
+	LintOnSave          bool                     `yaml:"lintOnSave"`
 	Colors              bool                     `yaml:"colors"`
+	Accessible          bool                     `yaml:"accessible"`
 	PassCommandsToShell bool                     `yaml:"passCommandsToShell"`
 	WebInterface        bool                     `yaml:"webInterface"`
 	Interactive         bool                     `yaml:"interactive"`
 	Debug               bool                     `yaml:"debug"`
 	ProjectNamePrompt   bool                     `yaml:"projectNamePrompt"`
+	Prompt              string                   `yaml:"prompt"`
 	RecursionDepth      int                      `yaml:"recursionDepth"`
+	MaxRecursionDepth   int                      `yaml:"maxRecursionDepth"`
 	HistoryLimit        int                      `yaml:"historyLimit"`
 	CodeSnippetScope    int                      `yaml:"codeSnippetScope"`
 	PortWebPanel        int                      `yaml:"portWebPanel"`
 	PortGlueServer      int                      `yaml:"portGlueServer"`
+	PortGRPC            int                      `yaml:"portGRPC"`
 	HistoryFile         bool                     `yaml:"historyFile"`
 	ExitOnInterrupt     bool                     `yaml:"exitOnInterrupt"`
 	DisableTimestamps   bool                     `yaml:"disableTimestamps"`
@@ -81,13 +96,42 @@ type configFields struct {
 	MakefileOverview    bool                     `yaml:"makefileOverview"`
 	StopOnError         bool                     `yaml:"stopOnError"`
 	DumpScriptOnError   bool                     `yaml:"dumpScriptOnError"`
+	DumpDir             string                   `yaml:"dumpDir"`
+	DumpRetention       int                      `yaml:"dumpRetention"`
+	DumpFormat          string                   `yaml:"dumpFormat"`
+	VCS                 string                   `yaml:"vcs"`
 	Quiet               bool                     `yaml:"quiet"`
+	PrefixOutput        bool                     `yaml:"prefixOutput"`
+	BufferOutput        bool                     `yaml:"bufferOutput"`
+	ProjectLock         bool                     `yaml:"projectLock"`
 	ColorProfile        string                   `yaml:"colorProfile"`
 	DateFormat          string                   `yaml:"dateFormat"`
 	TodoFilePath        string                   `yaml:"todoFilePath"`
 	Editor              string                   `yaml:"editor"`
+	SarifOutput         string                   `yaml:"sarifOutput"`
+	LogDir              string                   `yaml:"logDir"`
+	LogRetention        int                      `yaml:"logRetention"`
+	SBOMFormat          string                   `yaml:"sbomFormat"`
+	RunHistorySize      int                      `yaml:"runHistorySize"`
+	StdErrBufferSize    int                      `yaml:"stdErrBufferSize"`
+	RawOutput           bool                     `yaml:"rawOutput"`
+	FancyOutput         bool                     `yaml:"fancyOutput"`
+	CommandOrder        string                   `yaml:"commandOrder"`
+	PortConflicts       string                   `yaml:"portConflicts"`
+	GracePeriod         int                      `yaml:"gracePeriod"`
+	AsyncOnExit         string                   `yaml:"asyncOnExit"`
+	DynamicGlobals      string                   `yaml:"dynamicGlobals"`
+	SecretKeyFile       string                   `yaml:"secretKeyFile"`
+	RedactPatterns      []string                 `yaml:"redactPatterns"`
+	DurationFormat      string                   `yaml:"durationFormat"`
+	DurationPrecision   int                      `yaml:"durationPrecision"`
+	Reproducible        bool                     `yaml:"reproducible"`
+	UpdateChannel       string                   `yaml:"updateChannel"`
+	APIToken            string                   `yaml:"apiToken"`
+	CredentialHelpers   map[string]string        `yaml:"credentialHelpers"`
 	ColorProfiles       map[string]*ColorProfile `yaml:"colorProfiles"`
 	Languages           []*Language              `yaml:"languages"`
+	CI                  *ciConfig                `yaml:"ci"`
 }
 
 // newConfig returns the default configuration in case there is no config file
@@ -96,6 +140,7 @@ func newConfig() *config {
 		fields: &configFields{
 			MakefileOverview:    false,
 			AutoFormat:          false,
+			LintOnSave:          false,
 			Colors:              true,
 			PassCommandsToShell: true,
 			WebInterface:        false,
@@ -104,14 +149,32 @@ func newConfig() *config {
 			ProjectNamePrompt:   true,
 			HistoryFile:         true,
 			RecursionDepth:      1,
+			MaxRecursionDepth:   64,
 			HistoryLimit:        20,
 			PortWebPanel:        8080,
+			PortGRPC:            50051,
 			CodeSnippetScope:    15,
+			LogRetention:        10,
+			SBOMFormat:          sbomFormatCycloneDX,
+			RunHistorySize:      10000,
+			StdErrBufferSize:    1024 * 1024,
+			CommandOrder:        commandOrderAlphabetical,
+			PortConflicts:       portConflictsFail,
+			GracePeriod:         10,
+			AsyncOnExit:         asyncOnExitOrphan,
+			DynamicGlobals:      dynamicGlobalsLazy,
+			RedactPatterns:      defaultRedactPatterns,
+			DurationFormat:      durationFormatCompact,
+			DurationPrecision:   2,
+			UpdateChannel:       updateChannelStable,
 			ExitOnInterrupt:     true,
 			DisableTimestamps:   false,
 			PrintBuiltins:       false,
 			StopOnError:         true,
 			DumpScriptOnError:   true,
+			DumpRetention:       10,
+			DumpFormat:          dumpFormatScript,
+			VCS:                 vcsAuto,
 			Quiet:               false,
 			// default: german date format DD-MM-YYYY
 			DateFormat:   "02-01-2006",
@@ -122,13 +185,14 @@ func newConfig() *config {
 				"light": lightProfile(),
 				"dark":  darkProfile(),
 			},
+			CI: newCIConfig(),
 		},
 	}
 }
 
 func printConfigUsageErr() {
 	l.Println(ErrInvalidUsage)
-	l.Println("usage: config [get <field>] [set <field> <value>]")
+	l.Println("usage: config [get <field>] [set <field> <value>] [which <field>] [reload]")
 }
 
 // check for unknown fields in the config
@@ -140,6 +204,9 @@ func validateConfig(path string) (data []byte, warnings []string, err error) {
 		return nil, warnings, err
 	}
 
+	// the names of older versions are understood until the config is migrated
+	c, _ = renameConfigFields(c)
+
 	var (
 		items        = configItems()
 		parsedFields []string
@@ -161,7 +228,7 @@ func validateConfig(path string) (data []byte, warnings []string, err error) {
 					foundField = true
 				}
 			}
-			if !foundField && field != "colorProfiles" && field != "languages" {
+			if !foundField && field != "colorProfiles" && field != "languages" && field != "ci" {
 				warnings = append(warnings, "line "+strconv.Itoa(i)+": unknown config field: "+field)
 			}
 			foundField = false
@@ -176,36 +243,69 @@ func parseProjectConfig() (c *config, warnings []string, err error) {
 
 	projectConfigPath = zeusDir + "/config.yml"
 
-	// init default config
+	// init default config, with the user config on top
 	c = newConfig()
+	userWarnings := c.loadUserConfig()
 	var contents []byte
 
 	stat, err := os.Stat(projectConfigPath)
 	if err != nil {
-		return nil, warnings, err
+		return nil, userWarnings, err
 	}
 
 	if stat.IsDir() {
-		return nil, warnings, ErrConfigFileIsADirectory
+		return nil, userWarnings, ErrConfigFileIsADirectory
 	}
 
 	contents, warnings, err = validateConfig(projectConfigPath)
+	warnings = append(userWarnings, warnings...)
 	if err != nil {
 		return nil, warnings, err
 	}
 
-	err = yaml.Unmarshal(contents, c.fields)
+	err = unmarshalConfig(contents, c)
 	if err != nil {
-		Log.WithError(err).Fatal("failed to unmarshal confg - invalid YAML:")
-		printFileContents(contents)
-		return nil, warnings, err
+
+		// the file might have been truncated by an interrupted write
+		backup, backupErr := restoreBackup(projectConfigPath)
+		if backupErr == nil {
+			c = newConfig()
+			c.loadUserConfig()
+			err = unmarshalConfig(backup, c)
+			if err != nil {
+				Log.WithError(err).Fatal("failed to unmarshal config backup - invalid YAML:")
+				return nil, warnings, err
+			}
+			contents = backup
+			warnings = append(warnings, "restored config from "+projectConfigPath+backupSuffix)
+		} else if err != ErrEmptyConfig {
+			printFileContents(contents)
+			Log.WithError(err).Fatal("failed to unmarshal config - invalid YAML:")
+			return nil, warnings, err
+		}
+
+		// an empty config without backup uses the defaults
 	}
 
+	// the project config takes precedence over the user config
+	c.setOrigins(contents, configOriginProject)
+	c.project = true
+
 	c.handle()
 
 	return c, warnings, nil
 }
 
+// unmarshal the contents of the config file
+func unmarshalConfig(contents []byte, c *config) error {
+
+	if len(contents) == 0 {
+		return ErrEmptyConfig
+	}
+
+	return yaml.Unmarshal(contents, c.fields)
+}
+
 // handle config shell command
 func handleConfigCommand(args []string) {
 
@@ -220,13 +320,18 @@ func handleConfigCommand(args []string) {
 			printConfigUsageErr()
 			return
 		}
-		conf.setValue(args[2], args[3])
+		// values can contain spaces, like the prompt template
+		conf.setValue(args[2], strings.Join(args[3:], " "))
 	case "get":
 		if len(args) < 3 {
 			printConfigUsageErr()
 			return
 		}
 		Log.Info(conf.getFieldInfo(args[2]))
+	case "which":
+		handleConfigWhichCommand(args)
+	case "reload":
+		handleConfigReloadCommand()
 	default:
 		Log.Error("invalid config command: ", args[1])
 		printConfigUsageErr()
@@ -241,6 +346,9 @@ func (c *config) update() {
 
 	// marshal config
 	b, err := yaml.Marshal(c.fields)
+	if err == nil {
+		b, err = c.projectFields(b)
+	}
 	if err != nil {
 		Log.WithError(err).Fatal("failed to marshal config YAML:")
 	}
@@ -253,14 +361,8 @@ func (c *config) update() {
 		}
 	}
 
-	// open the config file write only and truncate if it exists
-	f, err := os.OpenFile(projectConfigPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0700)
-	if err != nil {
-		Log.WithError(err).Fatal("failed to open config")
-	}
-
 	// write to file
-	_, err = f.Write(append([]byte(asciiArtYAML), b...))
+	err = writeFileWithBackup(projectConfigPath, append([]byte(asciiArtYAML), b...), 0700)
 	if err != nil {
 		Log.WithError(err).Fatal("failed to write config")
 	}
@@ -309,29 +411,16 @@ func (c *config) watch(eventID string) {
 
 		Log.Debug("config watcher event: ", event.Name)
 
-		contents, warnings, err := validateConfig(projectConfigPath)
-		if err != nil {
-			Log.WithError(err).Error("failed to read config")
-			return
-		}
-
+		changes, warnings, err := c.reload()
 		for _, w := range warnings {
 			Log.Warn(w)
 		}
-
-		// lock config
-		c.Lock()
-
-		err = yaml.Unmarshal(contents, c.fields)
 		if err != nil {
 			Log.WithError(err).Error("config parse error")
-			c.Unlock()
 			return
 		}
-		c.Unlock()
 
-		// handle updated values
-		c.handle()
+		printConfigChanges(changes)
 	}))
 	if err != nil {
 		Log.WithError(err).Fatal("projectConfig watcher failed")
@@ -403,8 +492,27 @@ func (c *config) setValue(field, value string) {
 		return
 	}
 
+	// values set with the builtin belong to the project config
+	if sf, ok := configField(strings.Title(field)); ok {
+		c.Lock()
+		if c.origins == nil {
+			c.origins = make(map[string]string)
+		}
+		c.origins[sf.Tag.Get("yaml")] = configOriginProject
+		c.Unlock()
+	}
+
 	c.handle()
 	c.update()
+
+	// apply values that are only read on startup
+	if sf, ok := configField(strings.Title(field)); ok {
+		change := configChange{name: sf.Tag.Get("yaml"), to: f.Interface()}
+		c.apply([]configChange{change})
+		if change.restart() {
+			l.Println("restart zeus to apply: " + change.name)
+		}
+	}
 }
 
 // handle the config by applying updated values
@@ -418,21 +526,13 @@ func (c *config) handle() {
 	Log.Lock()
 	defer Log.Unlock()
 
-	// handle debug mode on the fly
-	// @TODO: this produces a data race in tests
-	// if c.Debug {
-	// 	Log.Level = logrus.DebugLevel
-	// } else {
-	// 	Log.Level = logrus.InfoLevel
-	// }
-
 	// enable dumping the script on error when the auto formatter is enabled
 	if c.fields.AutoFormat {
 		c.fields.DumpScriptOnError = true
 	}
 
 	// disable colors if requested
-	if !c.fields.Colors {
+	if !c.fields.Colors || c.fields.Accessible {
 
 		// lock once
 		cp.Lock()
@@ -444,7 +544,8 @@ func (c *config) handle() {
 		}
 	}
 
-	if !c.fields.AutoFormat {
+	// the script dir is only watched by the interactive shell
+	if !c.fields.Interactive {
 		cleanFormatterEvent()
 	}
 
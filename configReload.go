@@ -0,0 +1,235 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/mgutz/ansi"
+	"github.com/sirupsen/logrus"
+	prefixed "github.com/x-cray/logrus-prefixed-formatter"
+)
+
+// configRestartFields are only read when zeus starts, changing them requires a restart
+var configRestartFields = []string{"interactive", "webInterface", "historyFile", "historyLimit", "portWebPanel", "portGlueServer", "portGRPC"}
+
+// configChange describes a changed config field
+type configChange struct {
+	name string
+	from interface{}
+	to   interface{}
+}
+
+// display the change, values that can't be printed on a single line are omitted
+func (c configChange) String() string {
+	switch reflect.ValueOf(c.to).Kind() {
+	case reflect.Bool, reflect.Int, reflect.String:
+		return fmt.Sprint(c.name, ": ", c.from, " -> ", c.to)
+	default:
+		return c.name
+	}
+}
+
+// check if a changed config field requires a restart
+func (c configChange) restart() bool {
+	for _, name := range configRestartFields {
+		if name == c.name {
+			return true
+		}
+	}
+	return false
+}
+
+// compare two configs field by field, changes are named like in the config file
+func changedConfigFields(prev, next *configFields) (changes []configChange) {
+
+	var (
+		a = reflect.ValueOf(prev).Elem()
+		b = reflect.ValueOf(next).Elem()
+		t = a.Type()
+	)
+
+	for i := 0; i < t.NumField(); i++ {
+		if !reflect.DeepEqual(a.Field(i).Interface(), b.Field(i).Interface()) {
+			changes = append(changes, configChange{
+				name: t.Field(i).Tag.Get("yaml"),
+				from: a.Field(i).Interface(),
+				to:   b.Field(i).Interface(),
+			})
+		}
+	}
+	return
+}
+
+// reload the user and the project config from disk and apply the changes
+// fields removed from the files fall back to their defaults
+func (c *config) reload() (changes []configChange, warnings []string, err error) {
+
+	next := newConfig()
+	warnings = next.loadUserConfig()
+
+	if _, statErr := os.Stat(projectConfigPath); statErr == nil {
+
+		contents, projectWarnings, err := validateConfig(projectConfigPath)
+		warnings = append(warnings, projectWarnings...)
+		if err != nil {
+			return nil, warnings, err
+		}
+
+		err = unmarshalConfig(contents, next)
+		if err != nil && err != ErrEmptyConfig {
+			return nil, warnings, err
+		}
+		next.setOrigins(contents, configOriginProject)
+		next.project = true
+	}
+
+	c.Lock()
+	prev := c.fields
+	c.fields = next.fields
+	c.origins = next.origins
+	c.project = c.project || next.project
+	c.Unlock()
+
+	if c == conf {
+		applyCIMode()
+		applyTerminalFallback()
+	}
+	c.handle()
+
+	c.RLock()
+	changes = changedConfigFields(prev, c.fields)
+	c.RUnlock()
+
+	c.apply(changes)
+
+	return changes, warnings, nil
+}
+
+// apply changed values that are read once when zeus starts to the running shell
+func (c *config) apply(changes []configChange) {
+
+	// the global state belongs to the config in use
+	if c != conf {
+		return
+	}
+
+	var colors, prompt bool
+
+	for _, change := range changes {
+		switch change.name {
+		case "debug":
+			c.RLock()
+			debug = c.fields.Debug
+			c.RUnlock()
+			if debug {
+				Log.SetLevel(logrus.DebugLevel)
+			} else {
+				Log.SetLevel(logrus.InfoLevel)
+			}
+		case "colors", "accessible", "colorProfile", "colorProfiles", "disableTimestamps":
+			colors = true
+		case "projectNamePrompt", "prompt":
+			prompt = true
+		}
+	}
+
+	if colors {
+		applyColorConfig()
+		prompt = true
+	}
+
+	if prompt {
+		conf.RLock()
+		if conf.fields.ProjectNamePrompt && workingDir != "" {
+			zeusPrompt = filepath.Base(workingDir)
+		} else {
+			zeusPrompt = "zeus"
+		}
+		conf.RUnlock()
+
+		readlineMutex.Lock()
+		if rl != nil {
+			rl.SetPrompt(refreshPrompt())
+		}
+		readlineMutex.Unlock()
+	}
+}
+
+// switch colors and the log formatter according to the config
+func applyColorConfig() {
+
+	conf.RLock()
+	off := !conf.fields.Colors || conf.fields.Accessible
+	disableTimestamps := conf.fields.DisableTimestamps
+	conf.RUnlock()
+
+	Log.Lock()
+	Log.Formatter = &prefixed.TextFormatter{
+		DisableColors:    off,
+		DisableTimestamp: disableTimestamps,
+	}
+	Log.Unlock()
+
+	ansi.DisableColors(off)
+
+	// the colors off profile has been set when handling the config
+	if !off {
+		initColorProfile()
+	}
+}
+
+// print the changed config fields
+func printConfigChanges(changes []configChange) {
+
+	var restart []string
+	for _, change := range changes {
+		l.Println(cp.Text + "config changed: " + cp.Prompt + change.String() + cp.Reset)
+		if change.restart() {
+			restart = append(restart, change.name)
+		}
+	}
+
+	if len(restart) > 0 {
+		l.Println(cp.Text + "restart zeus to apply: " + strings.Join(restart, ", ") + cp.Reset)
+	}
+}
+
+// config reload
+func handleConfigReloadCommand() {
+
+	changes, warnings, err := conf.reload()
+	for _, w := range warnings {
+		Log.Warn(w)
+	}
+	if err != nil {
+		Log.WithError(err).Error("failed to reload config")
+		return
+	}
+
+	if len(changes) == 0 {
+		l.Println("config unchanged")
+		return
+	}
+	printConfigChanges(changes)
+}
@@ -0,0 +1,366 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/dreadl0ck/readline"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	// policies for migrated commands whose name is taken by an existing command
+	conflictKeep      = "keep"
+	conflictOverwrite = "overwrite"
+	conflictRename    = "rename"
+	conflictMerge     = "merge"
+
+	// migrateFlagNonInteractive resolves all conflicts with a policy instead of asking
+	migrateFlagNonInteractive = "--non-interactive"
+
+	// appended to the names of renamed commands
+	migratedSuffix = "-migrated"
+)
+
+var (
+	// ErrUnknownConflictPolicy means the policy passed to --non-interactive is not supported
+	ErrUnknownConflictPolicy = errors.New("unknown conflict policy, expected " + strings.Join(conflictPolicies, ", "))
+
+	conflictPolicies = []string{conflictKeep, conflictOverwrite, conflictRename, conflictMerge}
+
+	// answers are read from stdin when there is no interactive shell
+	stdinReader = bufio.NewReader(os.Stdin)
+)
+
+// parse the optional --non-interactive flag following a migrate command
+// an empty policy means conflicts are resolved interactively
+func parseConflictPolicy(args []string) (string, error) {
+
+	switch len(args) {
+	case 0:
+		return "", nil
+	case 2:
+		if args[0] != migrateFlagNonInteractive {
+			return "", ErrInvalidUsage
+		}
+		if !contains(conflictPolicies, args[1]) {
+			return "", ErrUnknownConflictPolicy
+		}
+		return args[1], nil
+	default:
+		return "", ErrInvalidUsage
+	}
+}
+
+// check if a command with the given name exists
+func commandExists(name string) bool {
+	cmdMap.Lock()
+	defer cmdMap.Unlock()
+	_, ok := cmdMap.items[name]
+	return ok
+}
+
+// decide what happens to migrated commands whose name is taken
+// kept commands are dropped, merged ones pass their dependencies on to the existing command
+func (m *migration) resolveConflicts(policy string) error {
+
+	var (
+		commands []*migratedCommand
+		renamed  = make(map[string]string)
+	)
+
+	for _, c := range m.commands {
+
+		if !commandExists(c.name) {
+			commands = append(commands, c)
+			continue
+		}
+
+		action := policy
+		if action == "" {
+			var err error
+			action, err = askConflictPolicy(c.name, m.source)
+			if err != nil {
+				return err
+			}
+		}
+
+		switch action {
+		case conflictKeep:
+			l.Println("keeping existing command " + c.name)
+		case conflictOverwrite:
+			m.overwrite = append(m.overwrite, c.name)
+			commands = append(commands, c)
+		case conflictRename:
+			name := m.freeCommandName(c.name)
+			l.Println("renaming " + c.name + " from " + m.source + " to " + name)
+			renamed[c.name] = name
+			c.name = name
+			commands = append(commands, c)
+		case conflictMerge:
+			m.merged = append(m.merged, c)
+			if len(c.script) > 0 {
+				m.note(0, "script of "+c.name+" was dropped, its dependencies were merged into the existing command")
+			}
+		}
+	}
+	m.commands = commands
+
+	// dependencies on renamed commands must follow them
+	rename := func(deps []string) {
+		for i, dep := range deps {
+			fields := strings.Fields(dep)
+			if len(fields) == 0 {
+				continue
+			}
+			if name, ok := renamed[fields[0]]; ok {
+				deps[i] = strings.Join(append([]string{name}, fields[1:]...), " ")
+			}
+		}
+	}
+	for _, c := range m.commands {
+		rename(c.dependencies)
+	}
+	for _, c := range m.merged {
+		rename(c.dependencies)
+	}
+
+	return nil
+}
+
+// find a name for a renamed command that is neither taken by an existing nor a migrated command
+func (m *migration) freeCommandName(name string) string {
+
+	taken := func(candidate string) bool {
+		if commandExists(candidate) {
+			return true
+		}
+		for _, c := range m.commands {
+			if c.name == candidate {
+				return true
+			}
+		}
+		return false
+	}
+
+	candidate := name + migratedSuffix
+	for i := 2; taken(candidate); i++ {
+		candidate = name + migratedSuffix + "-" + strconv.Itoa(i)
+	}
+	return candidate
+}
+
+// ask the user how to resolve a conflict
+// without a terminal there is nobody to ask, the migration fails like before
+func askConflictPolicy(name, source string) (string, error) {
+
+	if ciMode || !readline.IsTerminal(int(os.Stdin.Fd())) {
+		return "", errors.New("command name '" + name + "' from " + source + " already taken. use " + migrateFlagNonInteractive + " <" + strings.Join(conflictPolicies, " | ") + "> to resolve conflicts")
+	}
+
+	for {
+		answer, err := readAnswer(cp.Prompt + "command " + name + " from " + source + " exists already. [k]eep, [o]verwrite, [r]ename or [m]erge dependencies? " + cp.Text)
+		if err != nil {
+			return "", err
+		}
+
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		for _, p := range conflictPolicies {
+			if answer != "" && strings.HasPrefix(p, answer) {
+				return p, nil
+			}
+		}
+		l.Println("please answer " + strings.Join(conflictPolicies, ", "))
+	}
+}
+
+// read a line from the interactive shell or stdin
+func readAnswer(question string) (string, error) {
+
+	readlineMutex.Lock()
+	if rl == nil {
+		readlineMutex.Unlock()
+
+		print(question)
+		line, err := stdinReader.ReadString('\n')
+		if err != nil && line == "" {
+			return "", err
+		}
+		return line, nil
+	}
+	rl.SetPrompt(question)
+	readlineMutex.Unlock()
+
+	line, err := rl.Readline()
+
+	readlineMutex.Lock()
+	rl.SetPrompt(printPrompt())
+	readlineMutex.Unlock()
+
+	return line, err
+}
+
+// locate the entry of a command in the commands section of a CommandsFile
+// the entry ends before the next line that is not indented deeper, trailing blank lines are not part of it
+func yamlCommandEntry(lines []string, name string) (start, end, indent int, ok bool) {
+
+	var (
+		section    = -1
+		entryLevel = -1
+	)
+
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		level := len(line) - len(strings.TrimLeft(line, " "))
+
+		if section < 0 {
+			if strings.TrimRight(line, " ") == "commands:" {
+				section = i
+			}
+			continue
+		}
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if level == 0 {
+			break
+		}
+		if entryLevel < 0 {
+			entryLevel = level
+		}
+		if level == entryLevel && trimmed == name+":" {
+			end = i + 1
+			for end < len(lines) {
+				t := strings.TrimSpace(lines[end])
+				if t != "" && len(lines[end])-len(strings.TrimLeft(lines[end], " ")) <= level {
+					break
+				}
+				end++
+			}
+			for end > i+1 && strings.TrimSpace(lines[end-1]) == "" {
+				end--
+			}
+			return i, end, level, true
+		}
+	}
+
+	return 0, 0, 0, false
+}
+
+// remove the entry of a command from a CommandsFile
+func removeYAMLCommand(contents, name string) string {
+
+	lines := strings.Split(contents, "\n")
+
+	start, end, _, ok := yamlCommandEntry(lines, name)
+	if !ok {
+		return contents
+	}
+
+	return strings.Join(append(lines[:start], lines[end:]...), "\n")
+}
+
+// add dependencies to the entry of a command in a CommandsFile
+// dependencies written as a flow sequence are rewritten as a block sequence
+func mergeYAMLDependencies(contents, name string, existing, deps []string) string {
+
+	var (
+		lines   = strings.Split(contents, "\n")
+		missing []string
+	)
+
+	for _, d := range deps {
+		if d != name && !contains(existing, d) && !contains(missing, d) {
+			missing = append(missing, d)
+		}
+	}
+	if len(missing) == 0 {
+		return contents
+	}
+
+	start, end, level, ok := yamlCommandEntry(lines, name)
+	if !ok {
+		return contents
+	}
+
+	// indentation of the fields of the entry
+	fieldLevel := level + 4
+	for i := start + 1; i < end; i++ {
+		if t := strings.TrimSpace(lines[i]); t != "" && !strings.HasPrefix(t, "#") {
+			fieldLevel = len(lines[i]) - len(strings.TrimLeft(lines[i], " "))
+			break
+		}
+	}
+
+	items := func(indent int, values []string) (out []string) {
+		for _, v := range values {
+			out = append(out, strings.Repeat(" ", indent)+"- "+yamlScalar(v))
+		}
+		return
+	}
+
+	for i := start + 1; i < end; i++ {
+
+		if len(lines[i])-len(strings.TrimLeft(lines[i], " ")) != fieldLevel {
+			continue
+		}
+		trimmed := strings.TrimSpace(lines[i])
+		if !strings.HasPrefix(trimmed, "dependencies:") {
+			continue
+		}
+
+		// flow sequence
+		if value := strings.TrimSpace(strings.TrimPrefix(trimmed, "dependencies:")); value != "" && !strings.HasPrefix(value, "#") {
+			var current []string
+			yaml.Unmarshal([]byte(value), &current)
+			block := append([]string{strings.Repeat(" ", fieldLevel) + "dependencies:"}, items(fieldLevel+4, append(current, missing...))...)
+			return strings.Join(append(lines[:i], append(block, lines[i+1:]...)...), "\n")
+		}
+
+		// block sequence, append after the last item
+		var (
+			last       = i
+			itemIndent = fieldLevel + 4
+		)
+		for j := i + 1; j < end; j++ {
+			t := strings.TrimSpace(lines[j])
+			indent := len(lines[j]) - len(strings.TrimLeft(lines[j], " "))
+			if t == "" || strings.HasPrefix(t, "#") {
+				continue
+			}
+			if indent < fieldLevel || indent == fieldLevel && !strings.HasPrefix(t, "-") {
+				break
+			}
+			if last == i {
+				itemIndent = indent
+			}
+			last = j
+		}
+		return strings.Join(append(lines[:last+1], append(items(itemIndent, missing), lines[last+1:]...)...), "\n")
+	}
+
+	// no dependencies yet
+	block := append([]string{strings.Repeat(" ", fieldLevel) + "dependencies:"}, items(fieldLevel+4, missing)...)
+	return strings.Join(append(lines[:start+1], append(block, lines[start+1:]...)...), "\n")
+}
@@ -0,0 +1,366 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	createTargetCommand = "command"
+	createTargetProject = "project"
+	createFlagTemplate  = "--template"
+
+	// file extension of command templates
+	templateExtension = ".yml"
+)
+
+var (
+	// templates for commands and projects, command templates are YAML files with the fields of a command
+	// project templates are directories that are copied into the project
+	templatesDir = "~/.zeus/templates"
+
+	// ErrTemplateNotFound occurs when there is no template with the requested name
+	ErrTemplateNotFound = errors.New("template not found")
+
+	// ErrCommandExists occurs when a created command is already defined
+	ErrCommandExists = errors.New("command exists")
+
+	// ErrInvalidCommandName occurs when the name of a new command is empty or contains whitespace
+	ErrInvalidCommandName = errors.New("invalid command name")
+)
+
+// create command [--template <name>] [<commandName>]
+func handleCreateTargetCommand(args []string) {
+
+	var (
+		name     string
+		fields   []string
+		template string
+		err      error
+	)
+
+	if len(args) > 2 && args[2] == createFlagTemplate {
+		if len(args) < 4 {
+			printCreateCommandUsageErr()
+			return
+		}
+		template = args[3]
+		if len(args) > 4 {
+			name = args[4]
+		}
+	}
+
+	switch {
+	case template == "":
+		name, fields, err = runCreateWizard()
+	case name == "":
+		name, err = askCommandName()
+	}
+	if err != nil {
+		l.Println(err)
+		return
+	}
+
+	if template != "" {
+		fields, err = commandTemplate(template, name)
+		if err != nil {
+			l.Println(err)
+			return
+		}
+	}
+
+	err = addCommandEntry(name, fields)
+	if err != nil {
+		l.Println("failed to add " + name + ": " + err.Error())
+		return
+	}
+	l.Println("created zeus command " + name + " in " + commandsFilePath)
+
+	// wait for the CommandsFile to be parsed again before starting the editor
+	if template == "" {
+		time.Sleep(120 * time.Millisecond)
+		handleEditCommand([]string{"edit", name})
+	}
+}
+
+// ask the questions for a new command and assemble its fields
+// empty answers leave the field out
+func runCreateWizard() (name string, fields []string, err error) {
+
+	name, err = askCommandName()
+	if err != nil {
+		return
+	}
+
+	for {
+		language, err := ask("language (empty for the default of the CommandsFile): ")
+		if err != nil {
+			return "", nil, err
+		}
+		if language == "" {
+			break
+		}
+		if _, err = ls.getLang(language); err == nil {
+			fields = append(fields, "language: "+language)
+			break
+		}
+		l.Println(err.Error() + ": " + language)
+	}
+
+	description, err := ask("description: ")
+	if err != nil {
+		return
+	}
+	if description != "" {
+		fields = append(fields, "description: "+description)
+	}
+
+	for {
+		answer, err := ask("arguments (label:Type, comma separated): ")
+		if err != nil {
+			return "", nil, err
+		}
+		arguments := splitAnswer(answer)
+		if _, err = validateArgs(arguments); err == nil {
+			fields = append(fields, yamlList("arguments", arguments)...)
+			break
+		}
+		l.Println(err)
+	}
+
+	for {
+		answer, err := ask("dependencies (comma separated): ")
+		if err != nil {
+			return "", nil, err
+		}
+		dependencies := splitAnswer(answer)
+		if err = checkCommandsExist(dependencies); err == nil {
+			fields = append(fields, yamlList("dependencies", dependencies)...)
+			break
+		}
+		l.Println(err)
+	}
+
+	fields = append(fields, "exec: implement "+name+" command")
+	return
+}
+
+// ask for the name of a new command until a valid one is given
+func askCommandName() (string, error) {
+	for {
+		name, err := ask("name: ")
+		if err != nil {
+			return "", err
+		}
+		if err = checkNewCommandName(name); err == nil {
+			return name, nil
+		}
+		l.Println(err)
+	}
+}
+
+// read a trimmed answer
+func ask(question string) (string, error) {
+	answer, err := readAnswer(question)
+	return strings.TrimSpace(answer), err
+}
+
+// split a comma separated answer
+func splitAnswer(answer string) (items []string) {
+	for _, item := range strings.Split(answer, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return
+}
+
+// the lines of a YAML list field, nothing for an empty list
+func yamlList(field string, items []string) []string {
+	if len(items) == 0 {
+		return nil
+	}
+	lines := []string{field + ":"}
+	for _, item := range items {
+		lines = append(lines, "    - "+item)
+	}
+	return lines
+}
+
+// make sure a name can be used for a new command
+func checkNewCommandName(name string) error {
+
+	if name == "" || strings.ContainsAny(name, " \t") {
+		return errors.New(ErrInvalidCommandName.Error() + ": " + name)
+	}
+
+	cmdMap.Lock()
+	defer cmdMap.Unlock()
+
+	if _, ok := cmdMap.items[name]; ok {
+		return errors.New(ErrCommandExists.Error() + ": " + name)
+	}
+	return nil
+}
+
+// make sure all commands are defined
+func checkCommandsExist(names []string) error {
+	for _, name := range names {
+		if _, err := cmdMap.getCommand(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// the fields of a command from a template
+// {{name}} and {{project}} are replaced with the name of the command and the project
+func commandTemplate(template, name string) ([]string, error) {
+
+	contents, err := ioutil.ReadFile(filepath.Join(expandHome(templatesDir), template+templateExtension))
+	if err != nil {
+		return nil, templateNotFound(template)
+	}
+
+	var fields []string
+	for _, line := range strings.Split(strings.TrimRight(fillTemplate(string(contents), name), "\n"), "\n") {
+		fields = append(fields, strings.TrimRight(line, " "))
+	}
+	return fields, nil
+}
+
+// replace the placeholders of a template, {{name}} is kept when no command name is given
+func fillTemplate(contents, name string) string {
+	wd, _ := os.Getwd()
+	pairs := []string{"{{project}}", filepath.Base(wd)}
+	if name != "" {
+		pairs = append(pairs, "{{name}}", name)
+	}
+	return strings.NewReplacer(pairs...).Replace(contents)
+}
+
+// the error for a missing template, with the list of available ones
+func templateNotFound(template string) error {
+	available := listTemplates()
+	if len(available) == 0 {
+		return errors.New(ErrTemplateNotFound.Error() + ": " + template + ", " + templatesDir + " is empty")
+	}
+	return errors.New(ErrTemplateNotFound.Error() + ": " + template + ", available: " + strings.Join(available, ", "))
+}
+
+// names of the command and project templates
+func listTemplates() (names []string) {
+
+	files, err := ioutil.ReadDir(expandHome(templatesDir))
+	if err != nil {
+		return nil
+	}
+
+	for _, f := range files {
+		if f.IsDir() || filepath.Ext(f.Name()) == templateExtension {
+			names = append(names, strings.TrimSuffix(f.Name(), templateExtension))
+		}
+	}
+	sort.Strings(names)
+	return
+}
+
+// add a command at the end of the commands section
+// a CommandsFile is created when the project has none
+func addCommandEntry(name string, fields []string) error {
+
+	var (
+		contents             = asciiArtYAML
+		mode     os.FileMode = 0644
+	)
+
+	if info, err := os.Stat(commandsFilePath); err == nil {
+		c, err := ioutil.ReadFile(commandsFilePath)
+		if err != nil {
+			return err
+		}
+		contents = string(c)
+		mode = info.Mode()
+	}
+
+	return ioutil.WriteFile(commandsFilePath, []byte(insertYAMLCommand(contents, name, fields)), mode)
+}
+
+// create project --template <name>
+// copies the template directory into the current directory, existing files are never overwritten
+func handleCreateProjectCommand(args []string) {
+
+	if len(args) < 4 || args[2] != createFlagTemplate {
+		printCreateCommandUsageErr()
+		return
+	}
+
+	err := createProject(args[3])
+	if err != nil {
+		l.Println(err)
+		return
+	}
+	l.Println("created project from template " + args[3])
+}
+
+// copy a project template into the current directory
+func createProject(template string) error {
+
+	root := filepath.Join(expandHome(templatesDir), template)
+	if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		return templateNotFound(template)
+	}
+
+	if hasZeusSetup(".") {
+		return errors.New("project has a " + zeusDir + " directory already")
+	}
+
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil || rel == "." {
+			return err
+		}
+
+		if info.IsDir() {
+			return os.MkdirAll(rel, info.Mode())
+		}
+
+		if _, err := os.Stat(rel); err == nil {
+			l.Println("skipping " + rel + ", the file exists")
+			return nil
+		}
+
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(rel, []byte(fillTemplate(string(contents), "")), info.Mode())
+	})
+}
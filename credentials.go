@@ -0,0 +1,154 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// key of the credential helper used for all hosts without a dedicated helper
+const defaultCredentialHelper = "*"
+
+var (
+	// ErrNoCredentials occurs when a credential helper returned an empty secret
+	ErrNoCredentials = errors.New("credential helper returned no secret")
+
+	// secrets returned by credential helpers, cached to run each helper only once per host
+	credentialCache = &credentialStore{
+		items: make(map[string]string, 0),
+	}
+)
+
+// credentialStore caches secrets by host
+type credentialStore struct {
+	items map[string]string
+	sync.Mutex
+}
+
+// credentialHelperOutput is the response of a docker style credential helper
+type credentialHelperOutput struct {
+	ServerURL string `json:"ServerURL"`
+	Username  string `json:"Username"`
+	Secret    string `json:"Secret"`
+}
+
+// host part of a server URL, used to select the credential helper
+func credentialHost(serverURL string) string {
+	u, err := url.Parse(serverURL)
+	if err != nil || u.Host == "" {
+		return serverURL
+	}
+	return u.Hostname()
+}
+
+// get the credential helper for a server URL, empty if none is configured
+func credentialHelper(serverURL string) string {
+
+	conf.Lock()
+	defer conf.Unlock()
+
+	if helper, ok := conf.fields.CredentialHelpers[credentialHost(serverURL)]; ok {
+		return helper
+	}
+	return conf.fields.CredentialHelpers[defaultCredentialHelper]
+}
+
+// get a token for a server URL
+// a configured credential helper is preferred over the environment variable
+func credentialToken(serverURL, env string) (string, error) {
+
+	if helper := credentialHelper(serverURL); helper != "" {
+		return credentialCache.get(helper, serverURL)
+	}
+
+	return os.Getenv(env), nil
+}
+
+// check if a token for a server URL is available, without running a credential helper
+func hasCredentials(serverURL, env string) bool {
+	return credentialHelper(serverURL) != "" || os.Getenv(env) != ""
+}
+
+// get the secret from the cache or run the credential helper
+func (cs *credentialStore) get(helper, serverURL string) (string, error) {
+
+	host := credentialHost(serverURL)
+
+	cs.Lock()
+	defer cs.Unlock()
+
+	if secret, ok := cs.items[host]; ok {
+		return secret, nil
+	}
+
+	secret, err := runCredentialHelper(helper, serverURL)
+	if err != nil {
+		return "", err
+	}
+
+	cs.items[host] = secret
+	return secret, nil
+}
+
+// run a credential helper with the get action and the server URL on stdin
+// the helper can print a docker credential helper JSON response, or only the secret
+// stderr is passed through, so helpers can ask the user to log in
+func runCredentialHelper(helper, serverURL string) (string, error) {
+
+	fields := strings.Fields(helper)
+	if len(fields) == 0 {
+		return "", ErrNoCredentials
+	}
+
+	var (
+		stdout bytes.Buffer
+		cmd    = exec.Command(fields[0], append(fields[1:], "get")...)
+	)
+	cmd.Stdin = strings.NewReader(serverURL)
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+
+	Log.Debug("running credential helper ", fields[0], " for ", serverURL)
+
+	err := cmd.Run()
+	if err != nil {
+		return "", errors.New("credential helper " + fields[0] + " failed: " + err.Error())
+	}
+
+	var (
+		out    = bytes.TrimSpace(stdout.Bytes())
+		secret = string(out)
+		res    credentialHelperOutput
+	)
+	if json.Unmarshal(out, &res) == nil {
+		secret = res.Secret
+	}
+
+	if secret == "" {
+		return "", ErrNoCredentials
+	}
+	return secret, nil
+}
@@ -0,0 +1,408 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// ErrUnknownProcess occurs when a process should be killed that has not been spawned by zeus
+var ErrUnknownProcess = errors.New("unknown process")
+
+// dashboardCommand describes a command for the web dashboard
+type dashboardCommand struct {
+	Name         string               `json:"name"`
+	Description  string               `json:"description"`
+	Arguments    []*dashboardArgument `json:"arguments"`
+	Dependencies []string             `json:"dependencies"`
+	Async        bool                 `json:"async"`
+}
+
+// dashboardArgument describes a command argument for the web dashboard
+type dashboardArgument struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Optional bool   `json:"optional"`
+	Default  string `json:"default"`
+}
+
+// dashboardProcess describes a running process for the web dashboard
+type dashboardProcess struct {
+	Name     string `json:"name"`
+	ID       string `json:"id"`
+	PID      int    `json:"pid"`
+	Exited   bool   `json:"exited"`
+	ExitCode *int   `json:"exitCode,omitempty"`
+}
+
+// runRequest is the body of a request to run a command
+type runRequest struct {
+	Command   string            `json:"command"`
+	Arguments map[string]string `json:"arguments"`
+}
+
+// dashboardMessage is sent to all connected sockets
+type dashboardMessage struct {
+
+	// output, started or finished
+	Type    string `json:"type"`
+	Command string `json:"command"`
+
+	// stdout or stderr, for output messages
+	Stream string `json:"stream,omitempty"`
+	Line   string `json:"line,omitempty"`
+
+	// error and exit code of a finished command
+	Error    string `json:"error,omitempty"`
+	ExitCode int    `json:"exitCode,omitempty"`
+}
+
+// check if the web interface is running and clients are connected
+func dashboardActive() bool {
+
+	webInterfaceRunningMutex.Lock()
+	running := webInterfaceRunning
+	webInterfaceRunningMutex.Unlock()
+
+	if !running {
+		return false
+	}
+
+	socketstoreMutex.Lock()
+	defer socketstoreMutex.Unlock()
+
+	return socketstore != nil && socketstore.NumSockets() > 0
+}
+
+// send a message to all connected dashboards and gRPC streams
+func broadcast(msg *dashboardMessage) {
+
+	outputListeners.send(msg)
+
+	c, err := json.Marshal(msg)
+	if err != nil {
+		Log.WithError(err).Error("failed to marshal dashboard message")
+		return
+	}
+
+	socketstoreMutex.Lock()
+	store := socketstore
+	socketstoreMutex.Unlock()
+
+	if store != nil {
+		store.Broadcast(string(c))
+	}
+}
+
+// dashboardWriter streams the output of a command to the dashboard
+// it is wrapped in a lineWriter, so every write contains complete lines
+type dashboardWriter struct {
+	command string
+	stream  string
+}
+
+// Write implements the io.Writer interface
+func (w *dashboardWriter) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimSuffix(string(p), "\n"), "\n") {
+		broadcast(&dashboardMessage{
+			Type:    "output",
+			Command: w.command,
+			Stream:  w.stream,
+			Line:    line,
+		})
+	}
+	return len(p), nil
+}
+
+// create line buffered writers for the stdout and stderr of a command
+func newDashboardWriters(name string) (stdout, stderr *lineWriter) {
+	lock := &sync.Mutex{}
+	return newLineWriter(&dashboardWriter{command: name, stream: "stdout"}, lock),
+		newLineWriter(&dashboardWriter{command: name, stream: "stderr"}, lock)
+}
+
+// check if the request has been sent from the local machine
+// the host and the origin must be local as well, so websites opened in a local browser
+// can not reach the server with a cross origin request or by rebinding their domain to a loopback address
+func isLocalRequest(r *http.Request) bool {
+
+	if !isLoopbackAddr(r.RemoteAddr) || !isLoopbackHost(r.Host) {
+		return false
+	}
+
+	if origin := r.Header.Get("Origin"); origin != "" {
+		u, err := url.Parse(origin)
+		if err != nil || !isLoopbackHost(u.Host) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// check if a host with an optional port is localhost or a loopback address
+func isLoopbackHost(host string) bool {
+
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// check if a host:port address is a loopback address
+func isLoopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		Log.WithError(err).Error("failed to write JSON response")
+	}
+}
+
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// collect all commands for the dashboard, in the configured order
+func dashboardCommands() (res []*dashboardCommand) {
+
+	cmdMap.Lock()
+	defer cmdMap.Unlock()
+
+	var names []string
+	for name := range cmdMap.items {
+		names = append(names, name)
+	}
+	sortCommandNames(names)
+
+	for _, name := range names {
+
+		var (
+			cmd = cmdMap.items[name]
+			dc  = &dashboardCommand{
+				Name:         cmd.name,
+				Description:  cmd.description,
+				Arguments:    []*dashboardArgument{},
+				Dependencies: cmd.dependencies,
+				Async:        cmd.async,
+			}
+		)
+
+		for _, arg := range cmd.args {
+			dc.Arguments = append(dc.Arguments, &dashboardArgument{
+				Name:     arg.name,
+				Type:     arg.typeName(),
+				Optional: arg.optional,
+				Default:  arg.defaultValue,
+			})
+		}
+
+		// required arguments first
+		sort.Slice(dc.Arguments, func(i, j int) bool {
+			a, b := dc.Arguments[i], dc.Arguments[j]
+			if a.Optional != b.Optional {
+				return !a.Optional
+			}
+			return a.Name < b.Name
+		})
+
+		res = append(res, dc)
+	}
+	return
+}
+
+// list all commands
+var apiCommandsHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, dashboardCommands())
+})
+
+// run a command with the supplied arguments
+// the output is streamed to the connected sockets
+var apiRunHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+	var req runRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	cmd, err := cmdMap.getCommand(req.Command)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, errors.New(ErrUnknownCommand.Error()+": "+req.Command))
+		return
+	}
+
+	var (
+		run    = apiRuns.add(cmd.name, runArguments(req.Arguments))
+		status = *run
+	)
+	go runFromDashboard(cmd, run)
+
+	writeJSON(w, http.StatusAccepted, status)
+})
+
+// convert argument values by name to name=value arguments
+// empty values are left out, so the defaults apply
+func runArguments(values map[string]string) (args []string) {
+	for _, name := range sortedKeys(values) {
+		if values[name] != "" {
+			args = append(args, name+"="+values[name])
+		}
+	}
+	return
+}
+
+// run a command and report start and result to the dashboard
+func runFromDashboard(cmd *command, run *apiRun) {
+
+	err := s.begin()
+	if err != nil {
+		apiRuns.finish(run, err)
+		broadcast(&dashboardMessage{Type: "finished", Command: cmd.name, Error: err.Error(), ExitCode: exitCode(err)})
+		return
+	}
+	defer s.end()
+
+	count, err := getTotalDependencyCount(cmd)
+	if err != nil {
+		apiRuns.finish(run, err)
+		broadcast(&dashboardMessage{Type: "finished", Command: cmd.name, Error: err.Error(), ExitCode: exitCode(err)})
+		return
+	}
+	s.plan(count)
+	progressUI.plan(cmd)
+
+	broadcast(&dashboardMessage{Type: "started", Command: cmd.name})
+
+	msg := &dashboardMessage{Type: "finished", Command: cmd.name}
+	err = cmd.Run(run.Arguments, cmd.async)
+	if err != nil {
+		msg.Error = err.Error()
+		msg.ExitCode = exitCode(err)
+	}
+	apiRuns.finish(run, err)
+	broadcast(msg)
+}
+
+// list the running processes
+var apiProcsHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+	res := []*dashboardProcess{}
+
+	processMapMutex.Lock()
+	for id, p := range processMap {
+		res = append(res, &dashboardProcess{
+			Name: p.Name,
+			ID:   string(id),
+			PID:  p.PID,
+		})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].PID < res[j].PID
+	})
+
+	// exited processes follow the running ones, oldest first
+	for _, p := range exitedProcesses {
+		code := p.ExitCode
+		res = append(res, &dashboardProcess{
+			Name:     p.Name,
+			ID:       string(p.ID),
+			PID:      p.PID,
+			Exited:   true,
+			ExitCode: &code,
+		})
+	}
+	processMapMutex.Unlock()
+
+	writeJSON(w, http.StatusOK, res)
+})
+
+// kill a process spawned by zeus
+var apiKillHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+	pid, err := strconv.Atoi(httprouter.ParamsFromContext(r.Context()).ByName("pid"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	err = killProcess(pid)
+	if err == ErrUnknownProcess {
+		writeJSONError(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "killed"})
+})
+
+// kill a process from the processMap by its PID
+// processes that have not been spawned by zeus are never touched
+func killProcess(pid int) error {
+
+	processMapMutex.Lock()
+	var proc *Process
+	for _, p := range processMap {
+		if p.PID == pid {
+			proc = p
+		}
+	}
+	processMapMutex.Unlock()
+
+	if proc == nil || proc.Proc == nil {
+		return ErrUnknownProcess
+	}
+
+	err := proc.Proc.Kill()
+	if err != nil {
+		return err
+	}
+
+	deleteProcessByPID(pid)
+	return nil
+}
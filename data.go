@@ -65,6 +65,9 @@ type dataFields struct {
 
 	// keys mapped to commands
 	KeyBindings map[string]string `yaml:"keyBindings"`
+
+	// encrypted values of the secrets
+	Secrets map[string]string `yaml:"secrets"`
 }
 
 func newData() *data {
@@ -77,6 +80,7 @@ func newData() *data {
 			Events:      make(map[string]*Event, 0),
 			Author:      "",
 			KeyBindings: make(map[string]string, 0),
+			Secrets:     make(map[string]string, 0),
 		},
 	}
 }
@@ -94,15 +98,8 @@ func (d *data) update() {
 		return
 	}
 
-	// get file handle
-	f, err := os.OpenFile(projectDataPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0700)
-	if err != nil {
-		Log.WithError(err).Error("failed to open zeus data")
-		return
-	}
-
 	// write to file
-	_, err = f.Write(append([]byte(asciiArtYAML), b...))
+	err = writeFileWithBackup(projectDataPath, append([]byte(asciiArtYAML), b...), 0700)
 	if err != nil {
 		Log.WithError(err).Error("failed to write zeus data")
 		return
@@ -127,20 +124,41 @@ func parseProjectData() (*data, error) {
 		return nil, err
 	}
 
-	if len(contents) == 0 {
-		return nil, ErrEmptyZeusData
-	}
-
-	err = yaml.Unmarshal(contents, d.fields)
+	err = unmarshalProjectData(contents, d)
 	if err != nil {
-		printFileContents(contents)
-		Log.WithError(err).Fatal("failed to unmarshal zeus data - invalid YAML:")
-		return nil, err
+
+		// the file might have been truncated by an interrupted write
+		backup, backupErr := restoreBackup(projectDataPath)
+		if backupErr != nil {
+			if err != ErrEmptyZeusData {
+				printFileContents(contents)
+				Log.WithError(err).Warn("project data is corrupted and there is no backup, resetting it")
+			}
+			return nil, err
+		}
+
+		d = newData()
+		err = unmarshalProjectData(backup, d)
+		if err != nil {
+			return nil, err
+		}
+
+		Log.Warn("restored project data from " + projectDataPath + backupSuffix)
 	}
 
 	return d, nil
 }
 
+// unmarshal the contents of the project data file
+func unmarshalProjectData(contents []byte, d *data) error {
+
+	if len(contents) == 0 {
+		return ErrEmptyZeusData
+	}
+
+	return yaml.Unmarshal(contents, d.fields)
+}
+
 // load user events from projectData and create the watchers
 func loadEvents() {
 
@@ -159,9 +177,6 @@ func loadEvents() {
 
 		Log.Info("loading event: ", e.Command, " path: ", e.Path)
 
-		// addEvent will create a new eventID so we need to clean up the entry for the previous one
-		delete(projectData.fields.Events, e.ID)
-
 		// copy values from struct
 		var (
 			path          = e.Path
@@ -169,11 +184,15 @@ func loadEvents() {
 			command       = e.Command
 			name          = e.Name
 			fileExtension = e.FileExtension
+			id            = e.ID
+			ignore        = e.Ignore
+			trigger       = e.Trigger
 		)
 
 		go func() {
 
-			err := addEvent(newEvent(path, op, name, fileExtension, "", command, func(event fsnotify.Event) {
+			// keep the eventID, chained events refer to it
+			e := newEvent(path, op, name, fileExtension, id, command, func(event fsnotify.Event) {
 
 				Log.Debug("event fired, name: ", event.Name, " path: ", path)
 
@@ -191,7 +210,11 @@ func loadEvents() {
 						passCommandToShell(fields[0], []string{})
 					}
 				}
-			}))
+			})
+			e.Ignore = ignore
+			e.Trigger = trigger
+
+			err := addEvent(e)
 			if err != nil {
 				Log.Error("failed to watch path: ", path)
 			}
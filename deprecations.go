@@ -0,0 +1,256 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// migrate syntax
+	migrateTargetSyntax = "syntax"
+
+	// name of the CommandsFile before it has been renamed
+	zeusfileName = "Zeusfile.yml"
+
+	// format of the days in the deprecation state
+	deprecationDayFormat = "2006-01-02"
+)
+
+// ErrCommandsFileExists occurs when the Zeusfile is migrated, but a CommandsFile exists already
+var ErrCommandsFileExists = errors.New("the CommandsFile exists already")
+
+// top-level config fields with an upper case name, like the fields of older versions
+var upperCaseConfigField = regexp.MustCompile(`^([A-Z][A-Za-z]*)(\s*:.*)$`)
+
+// a deprecated syntax that is still understood
+// the migration rewrites the affected file, so the warning disappears
+type deprecation struct {
+
+	// identifies the deprecation in the state of the shown warnings
+	id string
+
+	// the version that deprecated the syntax
+	since string
+
+	// what changed
+	message string
+
+	// the affected file
+	path func() string
+
+	// describe the occurrences in the file, nothing if the file is not affected
+	detect func(path string) []string
+
+	// rewrite the file, returns the new path of the file
+	migrate func(path string) (string, error)
+}
+
+// registered deprecations, the oldest first
+// add new ones at the end and keep them until the old syntax is no longer understood
+var deprecations = []*deprecation{
+	{
+		id:      "upper-case-config-fields",
+		since:   "0.8.0",
+		message: "config field names start with a lower case letter",
+		path:    configPath,
+		detect:  detectUpperCaseConfigFields,
+		migrate: migrateUpperCaseConfigFields,
+	},
+	{
+		id:      "zeusfile",
+		since:   "0.8.0",
+		message: "the Zeusfile has been renamed to commands.yml",
+		path:    func() string { return commandsFilePath },
+		detect:  detectZeusfile,
+		migrate: migrateZeusfile,
+	},
+}
+
+// the project config, the migration runs before the config has been parsed
+func configPath() string {
+	if projectConfigPath == "" {
+		return zeusDir + "/config.yml"
+	}
+	return projectConfigPath
+}
+
+// path of the days the deprecation warnings have been shown last
+func deprecationStatePath() string {
+	return filepath.Join(zeusDir, "data", "deprecations.json")
+}
+
+// the days the deprecation warnings have been shown last, by id
+func readDeprecationState() map[string]string {
+	state := make(map[string]string)
+	if contents, err := ioutil.ReadFile(deprecationStatePath()); err == nil {
+		json.Unmarshal(contents, &state)
+	}
+	return state
+}
+
+func writeDeprecationState(state map[string]string) error {
+	contents, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(deprecationStatePath()), 0700)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(deprecationStatePath(), contents, 0600)
+}
+
+// the warnings for the deprecated syntax used by the project
+// each warning is returned once per day, the day is recorded in the project data directory
+func deprecationWarnings(now time.Time) (warnings []string) {
+
+	var (
+		state   = readDeprecationState()
+		today   = now.Format(deprecationDayFormat)
+		changed bool
+	)
+
+	for _, d := range deprecations {
+		path := d.path()
+		findings := d.detect(path)
+		if len(findings) == 0 || state[d.id] == today {
+			continue
+		}
+		state[d.id] = today
+		changed = true
+
+		warnings = append(warnings, "deprecated since v"+d.since+": "+d.message+" ("+path+"): "+strings.Join(findings, ", ")+
+			"\n  run 'zeus "+migrateCommand+" "+migrateTargetSyntax+"' to update the file")
+	}
+
+	if changed {
+		if err := writeDeprecationState(state); err != nil {
+			Log.WithError(err).Debug("failed to write the deprecation state")
+		}
+	}
+	return
+}
+
+// migrate syntax
+// rewrites the files using a deprecated syntax
+func migrateSyntax() {
+
+	useZeusfile()
+
+	var migrated int
+	for _, d := range deprecations {
+		path := d.path()
+		findings := d.detect(path)
+		if len(findings) == 0 {
+			continue
+		}
+
+		newPath, err := d.migrate(path)
+		if err != nil {
+			l.Println("failed to migrate " + path + ": " + err.Error())
+			continue
+		}
+		migrated++
+		l.Println("migrated " + newPath + ": " + d.message + ": " + strings.Join(findings, ", "))
+	}
+
+	if migrated == 0 {
+		l.Println("no deprecated syntax found")
+	}
+}
+
+// rename the upper case fields of a config to their current names
+// unknown fields are kept, so the config validation can report them
+func renameConfigFields(contents []byte) (out []byte, renamed []string) {
+
+	lines := strings.Split(string(contents), "\n")
+	for i, line := range lines {
+		m := upperCaseConfigField.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		field, ok := configField(m[1])
+		if !ok {
+			continue
+		}
+		name := field.Tag.Get("yaml")
+		lines[i] = name + m[2]
+		renamed = append(renamed, m[1]+" -> "+name)
+	}
+	return []byte(strings.Join(lines, "\n")), renamed
+}
+
+func detectUpperCaseConfigFields(path string) []string {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	_, renamed := renameConfigFields(contents)
+	return renamed
+}
+
+func migrateUpperCaseConfigFields(path string) (string, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return path, err
+	}
+	contents, _ = renameConfigFields(contents)
+	return path, writeFileWithBackup(path, contents, 0700)
+}
+
+// use the Zeusfile of a project that has not been migrated
+func useZeusfile() {
+	zeusfile := filepath.Join(zeusDir, zeusfileName)
+	if _, err := os.Stat(commandsFilePath); err != nil {
+		if _, err := os.Stat(zeusfile); err == nil {
+			commandsFilePath = zeusfile
+		}
+	}
+}
+
+func detectZeusfile(path string) []string {
+	if filepath.Base(path) != zeusfileName {
+		return nil
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil
+	}
+	return []string{path}
+}
+
+func migrateZeusfile(path string) (string, error) {
+	newPath := filepath.Join(filepath.Dir(path), "commands.yml")
+	if _, err := os.Stat(newPath); err == nil {
+		return path, ErrCommandsFileExists
+	}
+	err := os.Rename(path, newPath)
+	if err != nil {
+		return path, err
+	}
+	commandsFilePath = newPath
+	return newPath, nil
+}
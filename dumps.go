@@ -0,0 +1,374 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// formats for the dumps of failed scripts
+const (
+	// dumpFormatScript writes the script, with the error details in comments
+	dumpFormatScript = "script"
+
+	// dumpFormatJSON writes the script and the error details as a JSON object
+	dumpFormatJSON = "json"
+)
+
+// details of a failed script, written to the dump directory
+type errorDump struct {
+	Command   string    `json:"command"`
+	Language  string    `json:"language"`
+	Timestamp time.Time `json:"timestamp"`
+	Version   string    `json:"version"`
+	Args      []string  `json:"args"`
+	Env       []string  `json:"env"`
+	Error     string    `json:"error"`
+	ExitCode  int       `json:"exitCode"`
+	StdErr    string    `json:"stdErr"`
+	Collected []string  `json:"collected,omitempty"`
+	Script    string    `json:"script"`
+
+	// location of the dump on disk, not part of the dump
+	path string
+
+	// directory with the files collected for the failure
+	artifacts string
+
+	lang *Language
+}
+
+func printDumpsCommandUsageErr() {
+	l.Println(ErrInvalidUsage)
+	l.Println("usage: dumps [show | open] [<number>]")
+}
+
+// get the configured dump directory
+func dumpDir() string {
+	conf.Lock()
+	defer conf.Unlock()
+	if conf.fields.DumpDir != "" {
+		return conf.fields.DumpDir
+	}
+	return zeusDir + "/dumps"
+}
+
+// the variables zeus adds to the environment of a command
+// values of sensitive variables are masked
+func dumpEnvironment(env []string) (out []string) {
+
+	var inherited = make(map[string]bool)
+	for _, e := range os.Environ() {
+		inherited[e] = true
+	}
+
+	conf.Lock()
+	patterns := conf.fields.RedactPatterns
+	conf.Unlock()
+
+	for _, e := range env {
+		if inherited[e] {
+			continue
+		}
+		if i := strings.Index(e, "="); i > 0 && sensitiveName(e[:i], patterns) {
+			e = e[:i+1] + secretMask
+		}
+		out = append(out, redact(e))
+	}
+	return
+}
+
+// create the dump for the currently executed script
+// together with the arguments, the environment set by zeus and the error
+func newErrorDump(c *command, args, env []string, script string, e error, stdErr string) (*errorDump, error) {
+
+	lang, err := c.getLanguage()
+	if err != nil {
+		return nil, err
+	}
+
+	d := &errorDump{
+		Command:   c.name,
+		Language:  lang.Name,
+		Timestamp: time.Now(),
+		Version:   version,
+		Args:      make([]string, len(args)),
+		Env:       dumpEnvironment(env),
+		Error:     redact(e.Error()),
+		ExitCode:  exitCode(e),
+		StdErr:    redact(stdErr),
+		Script:    redact(script),
+		lang:      lang,
+	}
+	for i, a := range args {
+		d.Args[i] = redact(a)
+	}
+	d.artifacts = filepath.Join(dumpDir(), c.name+"-"+d.Timestamp.Format(logFileTimestampFormat))
+
+	return d, nil
+}
+
+// write the dump to the dump directory
+// and remove the oldest dumps exceeding the retention limit
+func (d *errorDump) write() {
+
+	if err := os.MkdirAll(dumpDir(), 0700); err != nil {
+		Log.WithError(err).Error("failed to create dumps directory")
+		return
+	}
+
+	conf.Lock()
+	format := conf.fields.DumpFormat
+	conf.Unlock()
+
+	var (
+		contents []byte
+		err      error
+		ext      = d.lang.FileExtension
+	)
+
+	if format == dumpFormatJSON {
+		ext = ".json"
+		contents, err = json.MarshalIndent(d, "", "  ")
+		if err != nil {
+			Log.WithError(err).Error("failed to marshal dump")
+			return
+		}
+	} else {
+		contents = []byte(d.script())
+	}
+
+	d.path = d.artifacts + ext
+	err = ioutil.WriteFile(d.path, contents, 0700)
+	if err != nil {
+		Log.WithError(err).Error("failed to write dump file")
+		return
+	}
+	Log.Debug("script dumped: ", d.path)
+
+	pruneDumps()
+}
+
+// the script with the details of the error in comments
+func (d *errorDump) script() string {
+
+	var b strings.Builder
+
+	comment := func(line string) {
+		b.WriteString(strings.TrimRight(d.lang.Comment+" "+line, " ") + "\n")
+	}
+
+	b.WriteString(d.lang.Bang + "\n")
+	comment("")
+	comment("ZEUS Error Dump")
+	comment("Timestamp: " + d.Timestamp.Format(timestampFormat))
+	comment("Version: " + d.Version)
+	comment("Command: " + d.Command)
+	comment("Args: " + strings.Join(d.Args, " "))
+	comment("Env:")
+	for _, e := range d.Env {
+		comment("    " + e)
+	}
+	comment("Error: " + d.Error)
+	comment("ExitCode: " + strconv.Itoa(d.ExitCode))
+	if len(d.Collected) > 0 {
+		comment("Collected:")
+		for _, path := range d.Collected {
+			comment("    " + path)
+		}
+	}
+	comment("StdErr: ")
+	for _, line := range strings.Split(d.StdErr, "\n") {
+		comment(line)
+	}
+	b.WriteString("\n\n" + d.Script)
+
+	return b.String()
+}
+
+// collect the dumps of failed scripts, sorted from newest to oldest
+// a dump consists of the script file, the directory with the collected files, or both
+func errorDumps() (dumps []*errorDump) {
+
+	files, err := ioutil.ReadDir(dumpDir())
+	if err != nil {
+		return
+	}
+
+	var byBase = make(map[string]*errorDump)
+	for _, f := range files {
+
+		// name-timestamp.extension, command names can contain dashes as well
+		// the timestamp contains a dot, so directories have no extension
+		base := f.Name()
+		if !f.IsDir() {
+			base = strings.TrimSuffix(base, filepath.Ext(base))
+		}
+		if len(base) <= len(logFileTimestampFormat) {
+			continue
+		}
+		var (
+			split = len(base) - len(logFileTimestampFormat)
+			name  = strings.TrimSuffix(base[:split], "-")
+		)
+		ts, err := time.ParseInLocation(logFileTimestampFormat, base[split:], time.Local)
+		if err != nil || name == base[:split] {
+			continue
+		}
+
+		d, ok := byBase[base]
+		if !ok {
+			d = &errorDump{
+				Command:   name,
+				Timestamp: ts,
+			}
+			byBase[base] = d
+			dumps = append(dumps, d)
+		}
+
+		if f.IsDir() {
+			d.artifacts = filepath.Join(dumpDir(), f.Name())
+		} else {
+			d.path = filepath.Join(dumpDir(), f.Name())
+		}
+	}
+
+	sort.Slice(dumps, func(i, j int) bool {
+		return dumps[i].Timestamp.After(dumps[j].Timestamp)
+	})
+	return
+}
+
+// remove the oldest dumps exceeding the retention limit
+func pruneDumps() {
+
+	conf.Lock()
+	retention := conf.fields.DumpRetention
+	conf.Unlock()
+
+	if retention <= 0 {
+		return
+	}
+
+	dumps := errorDumps()
+	if len(dumps) <= retention {
+		return
+	}
+
+	for _, d := range dumps[retention:] {
+		for _, path := range []string{d.path, d.artifacts} {
+			if path == "" {
+				continue
+			}
+			err := os.RemoveAll(path)
+			if err != nil {
+				Log.WithError(err).Error("failed to remove dump: ", path)
+			}
+		}
+	}
+}
+
+// the script of the dump, or the directory with the collected files if there is none
+func (d *errorDump) location() string {
+	if d.path != "" {
+		return d.path
+	}
+	return d.artifacts
+}
+
+// handle dumps shell command
+func handleDumpsCommand(args []string) {
+
+	dumps := errorDumps()
+	if len(args) < 2 {
+		if len(dumps) == 0 {
+			l.Println("no dumps in " + dumpDir())
+			return
+		}
+		l.Println(cp.Prompt + pad("#", 5) + pad("command", 25) + pad("time", 22) + "path" + cp.Text)
+		for i, d := range dumps {
+			l.Println(fitLine(pad(strconv.Itoa(i+1), 5) + pad(d.Command, 25) + pad(d.Timestamp.Format("2006-01-02 15:04:05"), 22) + d.location()))
+		}
+		return
+	}
+
+	if len(args) > 3 {
+		printDumpsCommandUsageErr()
+		return
+	}
+
+	// the latest dump by default
+	n := 1
+	if len(args) == 3 {
+		var err error
+		n, err = strconv.Atoi(args[2])
+		if err != nil {
+			printDumpsCommandUsageErr()
+			return
+		}
+	}
+	if n < 1 || n > len(dumps) {
+		l.Println("no dump with number " + strconv.Itoa(n))
+		return
+	}
+	d := dumps[n-1]
+
+	switch args[1] {
+	case "show":
+		if d.path != "" {
+			c, err := ioutil.ReadFile(d.path)
+			if err != nil {
+				l.Println(err)
+				return
+			}
+			l.Println(cp.Prompt + d.path + cp.Reset)
+			l.Print(string(c))
+		}
+		if d.artifacts != "" {
+			l.Println(cp.Prompt + "collected files in " + d.artifacts + cp.Reset)
+			for _, f := range d.collectedFiles() {
+				l.Println("    " + f)
+			}
+		}
+	case "open":
+		conf.Lock()
+		editor := conf.fields.Editor
+		conf.Unlock()
+
+		cmd := exec.Command(editor, d.location())
+		wireEnv(cmd)
+
+		editorProcRunning = true
+		err := cmd.Run()
+		editorProcRunning = false
+		if err != nil {
+			Log.WithError(err).Error("failed to open dump in editor")
+		}
+	default:
+		printDumpsCommandUsageErr()
+	}
+}
@@ -0,0 +1,116 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// durationFormatCompact prints durations in human friendly units
+	// example: 1m 23s
+	durationFormatCompact = "compact"
+
+	// durationFormatGo prints durations in the format of time.Duration
+	// example: 1m23.456789012s
+	durationFormatGo = "go"
+)
+
+// units for the compact duration format, largest first
+var durationUnits = []struct {
+	size   time.Duration
+	suffix string
+}{
+	{time.Hour, "h"},
+	{time.Minute, "m"},
+	{time.Second, "s"},
+	{time.Millisecond, "ms"},
+	{time.Microsecond, "µs"},
+	{time.Nanosecond, "ns"},
+}
+
+// format a duration for the terminal, according to the durationFormat and durationPrecision config fields
+func formatDuration(d time.Duration) string {
+
+	var (
+		format    = durationFormatCompact
+		precision = 2
+	)
+
+	// read without locking, callers may hold the config lock
+	if conf != nil {
+		format = conf.fields.DurationFormat
+		precision = conf.fields.DurationPrecision
+	}
+
+	if format == durationFormatGo {
+		return d.String()
+	}
+	return compactDuration(d, precision)
+}
+
+// format a duration with at most precision units, the last unit is rounded
+// example with precision 2: 1m23.456s -> 1m 23s, 1.5s -> 1s 500ms
+func compactDuration(d time.Duration, precision int) string {
+
+	if precision < 1 {
+		precision = 1
+	}
+
+	var sign string
+	if d < 0 {
+		sign = "-"
+		d = -d
+	}
+
+	// find the largest unit
+	first := len(durationUnits) - 1
+	for i, u := range durationUnits {
+		if d >= u.size {
+			first = i
+			break
+		}
+	}
+
+	last := first + precision - 1
+	if last >= len(durationUnits) {
+		last = len(durationUnits) - 1
+	}
+	d = d.Round(durationUnits[last].size)
+
+	var parts []string
+	for _, u := range durationUnits[:last+1] {
+		if n := d / u.size; n > 0 {
+			parts = append(parts, strconv.FormatInt(int64(n), 10)+u.suffix)
+			d -= n * u.size
+		}
+	}
+
+	if len(parts) == 0 {
+		return "0s"
+	}
+	return sign + strings.Join(parts, " ")
+}
+
+// milliseconds of a duration, for machine readable output
+func durationMillis(d time.Duration) int64 {
+	return int64(d / time.Millisecond)
+}
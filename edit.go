@@ -0,0 +1,175 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// the location of the source of a command
+// line and col start at 1, 0 means the start of the file
+type sourceLocation struct {
+	path string
+	line int
+	col  int
+}
+
+func (s sourceLocation) String() string {
+	if s.line == 0 {
+		return s.path
+	}
+	return s.path + ":" + strconv.Itoa(s.line)
+}
+
+// locate the source of a command
+// scripts are opened at the top, for commands in the CommandsFile or one of its fragments
+// the first line of the exec block is used, or the name of the command when it has no exec
+func commandSource(cmd *command) sourceLocation {
+
+	if cmd.exec == "" && cmd.path != "" {
+		if _, err := os.Stat(cmd.path); err == nil {
+			return sourceLocation{path: cmd.path}
+		}
+	}
+
+	for _, part := range commandsFileParts(commandsFilePath) {
+
+		contents, err := ioutil.ReadFile(part)
+		if err != nil {
+			continue
+		}
+
+		c, ok := parseOutline(string(contents)).commands[cmd.name]
+		if !ok {
+			continue
+		}
+
+		exec := c.field("exec")
+		if exec == nil {
+			return sourceLocation{path: part, line: c.key.Line, col: c.key.Column}
+		}
+
+		switch exec.Style {
+		case yamlv3.LiteralStyle, yamlv3.FoldedStyle:
+			// the block starts in the line after the indicator
+			line := exec.Line + 1
+			return sourceLocation{path: part, line: line, col: blockIndent(string(contents), line)}
+		default:
+			return sourceLocation{path: part, line: exec.Line, col: exec.Column}
+		}
+	}
+
+	// generated by the commands script
+	if _, err := os.Stat(commandsStarPath); err == nil {
+		return sourceLocation{path: commandsStarPath}
+	}
+
+	return sourceLocation{path: commandsFilePath}
+}
+
+// column of the first character in a line, starting at 1
+func blockIndent(contents string, line int) int {
+	lines := strings.Split(contents, "\n")
+	if line < 1 || line > len(lines) {
+		return 1
+	}
+	return countLeadingSpace(lines[line-1]) + 1
+}
+
+// arguments for the editor to open a file at the location
+// returns nil for editors that are not known to support it
+func editorPositionArgs(editor string, line, col int) []string {
+
+	if line == 0 {
+		return nil
+	}
+	if col == 0 {
+		col = 1
+	}
+
+	// the editor could be supplied as a path, so only the name is checked
+	switch strings.TrimSuffix(filepath.Base(editor), ".exe") {
+	case "vim", "nvim", "vi":
+		return []string{"+call cursor(" + strconv.Itoa(line) + "," + strconv.Itoa(col) + ")"}
+	case "micro":
+		return []string{"+" + strconv.Itoa(line) + ":" + strconv.Itoa(col)}
+	case "nano":
+		return []string{"+" + strconv.Itoa(line) + "," + strconv.Itoa(col)}
+	case "emacs", "emacsclient", "kak":
+		return []string{"+" + strconv.Itoa(line) + ":" + strconv.Itoa(col)}
+	}
+	return nil
+}
+
+// check if the file belongs to the commands, the CommandsFile, one of its fragments, the commands script or a script
+func isCommandSource(path string) bool {
+
+	for _, part := range append(commandsFileParts(commandsFilePath), commandsStarPath) {
+		if filepath.Clean(part) == filepath.Clean(path) {
+			return true
+		}
+	}
+
+	cmdMap.Lock()
+	defer cmdMap.Unlock()
+
+	for _, cmd := range cmdMap.items {
+		if cmd.path != "" && filepath.Clean(cmd.path) == filepath.Clean(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// modification time of a file, the zero time if it does not exist
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// parse the commands again after the source of a command has been edited
+// nothing happens when the file did not change
+func reloadAfterEdit(path string, before time.Time) {
+
+	if !modTime(path).After(before) {
+		return
+	}
+
+	err := parseCommandsFile(commandsFilePath)
+	if err != nil {
+		Log.WithError(err).Error("failed to reload the commands")
+		return
+	}
+
+	cmdMap.Lock()
+	count := len(cmdMap.items)
+	cmdMap.Unlock()
+
+	l.Println(cp.Text + "reloaded " + strconv.Itoa(count) + " commands after editing " + path + cp.Reset)
+}
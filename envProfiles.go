@@ -0,0 +1,211 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// command line flag selecting the environment profile
+	envProfileFlag = "env"
+
+	// deselects the active environment profile
+	envProfileNone = "none"
+)
+
+// ErrUnknownEnvProfile means the environment profile is not declared in the CommandsFile
+var ErrUnknownEnvProfile = errors.New("unknown environment profile")
+
+// environment profiles from the profiles section of the CommandsFile
+// the globals of the active profile are put on top of the globals of the CommandsFile
+type envProfiles struct {
+
+	// names of the declared profiles
+	names []string
+
+	// name of the active profile, empty if none is active
+	active string
+
+	sync.RWMutex
+}
+
+// the profile is inherited by zeus processes started from commands
+var envs = &envProfiles{
+	active: os.Getenv(envProfileEnv),
+}
+
+// parse the globals of the CommandsFile with the ones of the active profile on top
+// references between them are resolved after merging, so globals can use the values of the profile
+func (e *envProfiles) load(globals map[string]*globalData, profiles map[string]map[string]*globalData) (vars, types map[string]string, err error) {
+
+	e.Lock()
+	defer e.Unlock()
+
+	e.names = e.names[:0]
+	for name := range profiles {
+		e.names = append(e.names, name)
+	}
+	sort.Strings(e.names)
+
+	if e.active == "" {
+		return parseGlobals(globals, nil)
+	}
+
+	profile, ok := profiles[e.active]
+	if !ok {
+		return nil, nil, errors.New(ErrUnknownEnvProfile.Error() + ": " + e.active)
+	}
+
+	merged := make(map[string]*globalData, len(globals)+len(profile))
+	for name, d := range globals {
+		merged[name] = d
+	}
+	for name, d := range profile {
+		merged[name] = d
+	}
+
+	vars, types, err = parseGlobals(merged, nil)
+	if err != nil {
+		return nil, nil, errors.New("profile " + e.active + ": " + err.Error())
+	}
+	return vars, types, nil
+}
+
+// the names of the declared profiles
+func (e *envProfiles) list() []string {
+	e.RLock()
+	defer e.RUnlock()
+	return append([]string{}, e.names...)
+}
+
+// the name of the active profile
+func (e *envProfiles) current() string {
+	e.RLock()
+	defer e.RUnlock()
+	return e.active
+}
+
+// select a declared profile, none deselects the active one
+func (e *envProfiles) use(name string) error {
+
+	e.Lock()
+	defer e.Unlock()
+
+	if name == envProfileNone || name == "" {
+		e.active = ""
+		return nil
+	}
+
+	for _, n := range e.names {
+		if n == name {
+			e.active = name
+			return nil
+		}
+	}
+	return ErrUnknownEnvProfile
+}
+
+// the active profile for the prompt
+func (e *envProfiles) prompt() string {
+	if name := e.current(); name != "" {
+		return " (" + name + ")"
+	}
+	return ""
+}
+
+// remove the environment profile flags and their values from the commandline arguments
+func stripEnvProfileFlags(args []string) (out []string) {
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "-"+envProfileFlag || args[i] == "--"+envProfileFlag:
+			// skip the value
+			i++
+		case strings.HasPrefix(args[i], "-"+envProfileFlag+"=") || strings.HasPrefix(args[i], "--"+envProfileFlag+"="):
+		default:
+			out = append(out, args[i])
+		}
+	}
+	return
+}
+
+func printUseCommandUsageErr() {
+	l.Println(ErrInvalidUsage)
+	l.Println("usage: use [<profile> | " + envProfileNone + "]")
+}
+
+// use [<profile> | none]
+// without arguments the profiles are listed and the active one is marked
+func handleUseCommand(args []string) error {
+
+	if len(args) > 2 {
+		printUseCommandUsageErr()
+		return ErrInvalidUsage
+	}
+
+	if len(args) < 2 {
+		names := envs.list()
+		if len(names) == 0 {
+			l.Println("no profiles declared in the CommandsFile")
+			return nil
+		}
+		active := envs.current()
+		for _, name := range names {
+			if name == active {
+				l.Println(cp.Prompt + "* " + name + cp.Text)
+			} else {
+				l.Println(cp.Text + "  " + name)
+			}
+		}
+		return nil
+	}
+
+	prev := envs.current()
+	err := envs.use(args[1])
+	if err != nil {
+		l.Println(err.Error() + ": " + args[1])
+		return err
+	}
+
+	// initialize the globals and commands again with the values of the profile
+	err = parseCommandsFile(commandsFilePath)
+	if err != nil {
+		envs.use(prev)
+		parseCommandsFile(commandsFilePath)
+		l.Println("failed to use profile " + args[1] + ": " + err.Error())
+		return err
+	}
+
+	readlineMutex.Lock()
+	if rl != nil {
+		rl.SetPrompt(refreshPrompt())
+	}
+	readlineMutex.Unlock()
+
+	if name := envs.current(); name != "" {
+		l.Println(cp.Text + "using profile " + cp.Prompt + name + cp.Text)
+	} else {
+		l.Println(cp.Text + "no profile active")
+	}
+	return nil
+}
@@ -0,0 +1,419 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mgutz/ansi"
+)
+
+// timeout for version lookups and service checks
+const environmentCheckTimeout = 3 * time.Second
+
+var (
+	// ErrInvalidToolRequirement means a tool requirement does not follow the <name> [operator] [version] format
+	ErrInvalidToolRequirement = errors.New("invalid tool requirement, expected <name> [>= | > | <= | < | =] [version]")
+
+	// ErrEnvironmentDiffers means the current machine does not match the declared environment
+	ErrEnvironmentDiffers = errors.New("environment differs from the declaration in the CommandsFile")
+
+	toolRequirement = regexp.MustCompile("^([^\\s<>=]+)\\s*(?:(>=|<=|>|<|==|=)?\\s*v?([0-9][0-9A-Za-z.\\-+]*))?$")
+	toolVersion     = regexp.MustCompile("[0-9]+(\\.[0-9]+)+")
+
+	// arguments tried in order to make a tool print its version
+	toolVersionArgs = [][]string{{"--version"}, {"version"}, {"-version"}}
+
+	// environment declared in the CommandsFile
+	projectEnvironment = &environment{
+		data: &environmentData{},
+	}
+)
+
+// environmentData is the environment section of the CommandsFile
+// it declares what a machine needs to work on the project
+type environmentData struct {
+
+	// tools in the PATH with optional version constraints: go >= 1.15
+	Tools []string `yaml:"tools"`
+
+	// environment variables that need to be set: NAME, or with an expected value: NAME=value
+	Variables []string `yaml:"variables"`
+
+	// services that need to be reachable: host:port or an http(s) URL
+	Services []string `yaml:"services"`
+}
+
+type environment struct {
+	data *environmentData
+	sync.Mutex
+}
+
+// result of checking a single requirement on the current machine
+type environmentCheck struct {
+	kind  string
+	name  string
+	found string
+	ok    bool
+
+	// what to do if the check failed
+	hint string
+}
+
+func printEnvCommandUsageErr() {
+	l.Println(ErrInvalidUsage)
+	l.Println("usage: env [diff]")
+}
+
+// set the environment declared in the CommandsFile
+func initEnvironment(d *environmentData) error {
+
+	if d == nil {
+		d = &environmentData{}
+	}
+
+	for _, t := range d.Tools {
+		if !toolRequirement.MatchString(strings.TrimSpace(t)) {
+			return errors.New(ErrInvalidToolRequirement.Error() + ": " + t)
+		}
+	}
+	for _, v := range d.Variables {
+		if strings.TrimSpace(strings.SplitN(v, "=", 2)[0]) == "" {
+			return errors.New("invalid variable requirement, expected NAME or NAME=value: " + v)
+		}
+	}
+
+	projectEnvironment.Lock()
+	projectEnvironment.data = d
+	projectEnvironment.Unlock()
+
+	return nil
+}
+
+// handle the env builtin
+// prints the status of all requirements, or only the differences
+func handleEnvCommand(args []string) error {
+
+	var diff bool
+	switch len(args) {
+	case 1:
+	case 2:
+		if args[1] != "diff" {
+			printEnvCommandUsageErr()
+			return ErrInvalidUsage
+		}
+		diff = true
+	default:
+		printEnvCommandUsageErr()
+		return ErrInvalidUsage
+	}
+
+	checks := checkEnvironment()
+	if len(checks) == 0 {
+		l.Println("no environment declared in the CommandsFile")
+		return nil
+	}
+
+	var (
+		failed int
+		kind   string
+	)
+	for _, c := range checks {
+		if c.ok {
+			if diff {
+				continue
+			}
+		} else {
+			failed++
+		}
+		if c.kind != kind {
+			kind = c.kind
+			l.Println(cp.Prompt + kind + cp.Text)
+		}
+		c.print()
+	}
+
+	if failed == 0 {
+		l.Println(cp.Text + "environment matches the CommandsFile")
+		return nil
+	}
+
+	l.Println(cp.Text + strconv.Itoa(failed) + " of " + strconv.Itoa(len(checks)) + " requirements not met")
+	return ErrEnvironmentDiffers
+}
+
+func (c *environmentCheck) print() {
+	if c.ok {
+		l.Println("  " + ansi.Green + marker("✔ ", "ok      ") + cp.Text + pad(c.name, 30) + c.found)
+		return
+	}
+	l.Println("  " + ansi.Red + marker("✘ ", "missing ") + cp.Text + pad(c.name, 30) + c.found)
+	l.Println("      " + marker("~> ", "hint: ") + c.hint)
+}
+
+// check all declared requirements on the current machine
+func checkEnvironment() (checks []*environmentCheck) {
+
+	projectEnvironment.Lock()
+	d := projectEnvironment.data
+	projectEnvironment.Unlock()
+
+	for _, t := range d.Tools {
+		checks = append(checks, checkTool(t))
+	}
+	for _, v := range d.Variables {
+		checks = append(checks, checkVariable(v))
+	}
+
+	// services can take a while to time out, check them concurrently
+	var (
+		services = make([]*environmentCheck, len(d.Services))
+		wg       sync.WaitGroup
+	)
+	for i, s := range d.Services {
+		wg.Add(1)
+		go func(i int, s string) {
+			services[i] = checkService(s)
+			wg.Done()
+		}(i, s)
+	}
+	wg.Wait()
+
+	return append(checks, services...)
+}
+
+// check if a tool is installed and satisfies the version constraint
+func checkTool(requirement string) *environmentCheck {
+
+	var (
+		match = toolRequirement.FindStringSubmatch(strings.TrimSpace(requirement))
+		c     = &environmentCheck{
+			kind: "tools",
+			name: strings.TrimSpace(requirement),
+		}
+	)
+	if match == nil {
+		c.found = "invalid requirement"
+		c.hint = ErrInvalidToolRequirement.Error()
+		return c
+	}
+
+	var (
+		name     = match[1]
+		operator = match[2]
+		want     = match[3]
+	)
+
+	path, err := exec.LookPath(name)
+	if err != nil {
+		c.found = "not installed"
+		c.hint = "install " + name + " and make sure it can be found in the PATH"
+		return c
+	}
+
+	if want == "" {
+		c.found = path
+		c.ok = true
+		return c
+	}
+
+	have := installedToolVersion(path)
+	if have == "" {
+		c.found = "unknown version"
+		c.hint = "make sure " + path + " has version " + strings.TrimSpace(operator+" "+want)
+		return c
+	}
+
+	c.found = have
+	c.ok = versionSatisfies(have, operator, want)
+	if !c.ok {
+		c.hint = "install " + name + " " + strings.TrimSpace(operator+" "+want) + ", found " + have + " at " + path
+	}
+
+	return c
+}
+
+// ask a tool for its version
+// returns an empty string if the version could not be determined
+func installedToolVersion(path string) string {
+
+	for _, args := range toolVersionArgs {
+
+		ctx, cancel := context.WithTimeout(context.Background(), environmentCheckTimeout)
+		out, _ := exec.CommandContext(ctx, path, args...).CombinedOutput()
+		cancel()
+
+		if v := toolVersion.FindString(string(out)); v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
+
+// check if version have satisfies the constraint
+// without an operator, the version must match up to the precision of want: 1.15 matches 1.15.3
+func versionSatisfies(have, operator, want string) bool {
+
+	cmp := compareVersions(have, want)
+
+	switch operator {
+	case ">=":
+		return cmp >= 0
+	case ">":
+		return cmp > 0
+	case "<=":
+		return cmp <= 0
+	case "<":
+		return cmp < 0
+	case "=", "==":
+		return cmp == 0
+	default:
+		return have == want || strings.HasPrefix(have, want+".")
+	}
+}
+
+// compare two dotted version numbers
+// missing components count as zero, non numeric suffixes are ignored
+func compareVersions(a, b string) int {
+
+	var (
+		as = strings.Split(a, ".")
+		bs = strings.Split(b, ".")
+	)
+
+	for i := 0; i < len(as) || i < len(bs); i++ {
+
+		var x, y int
+		if i < len(as) {
+			x = leadingNumber(as[i])
+		}
+		if i < len(bs) {
+			y = leadingNumber(bs[i])
+		}
+
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+
+	return 0
+}
+
+func leadingNumber(s string) int {
+	end := 0
+	for end < len(s) && s[end] >= '0' && s[end] <= '9' {
+		end++
+	}
+	n, _ := strconv.Atoi(s[:end])
+	return n
+}
+
+// check if an environment variable is set, and has the expected value if one is declared
+func checkVariable(requirement string) *environmentCheck {
+
+	var (
+		slice = strings.SplitN(requirement, "=", 2)
+		name  = strings.TrimSpace(slice[0])
+		c     = &environmentCheck{
+			kind: "variables",
+			name: name,
+		}
+	)
+
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		c.found = "not set"
+		if len(slice) == 2 {
+			c.hint = "export " + name + "=" + slice[1]
+		} else {
+			c.hint = "export " + name + "=<value>"
+		}
+		return c
+	}
+
+	c.found = "set"
+	if len(slice) == 1 {
+		c.ok = true
+		return c
+	}
+
+	c.found = value
+	c.ok = value == slice[1]
+	if !c.ok {
+		c.hint = "export " + name + "=" + slice[1]
+	}
+
+	return c
+}
+
+// check if a service is reachable
+// URLs are requested with HTTP, everything else is dialed with TCP
+func checkService(address string) *environmentCheck {
+
+	var c = &environmentCheck{
+		kind: "services",
+		name: address,
+	}
+
+	if strings.Contains(address, "://") {
+
+		client := &http.Client{Timeout: environmentCheckTimeout}
+		resp, err := client.Get(address)
+		if err != nil {
+			c.found = "unreachable"
+			c.hint = "start the service or check your network connection: " + err.Error()
+			return c
+		}
+		resp.Body.Close()
+
+		c.found = resp.Status
+		c.ok = resp.StatusCode < 500
+		if !c.ok {
+			c.hint = "the service responds with an error, check its logs"
+		}
+		return c
+	}
+
+	conn, err := net.DialTimeout("tcp", address, environmentCheckTimeout)
+	if err != nil {
+		c.found = "unreachable"
+		c.hint = "start the service or check your network connection: " + err.Error()
+		return c
+	}
+	conn.Close()
+
+	c.found = "reachable"
+	c.ok = true
+
+	return c
+}
@@ -21,6 +21,7 @@ package main
 import (
 	"errors"
 	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 
@@ -38,6 +39,12 @@ var (
 
 	// ErrInvalidUsage means the command was used incorrectly
 	ErrInvalidUsage = errors.New("invalid usage")
+
+	// ErrUnknownEvent means there is no event with the given ID
+	ErrUnknownEvent = errors.New("unknown event")
+
+	// directories that are never watched when expanding glob patterns
+	defaultEventIgnore = []string{".git", "node_modules"}
 )
 
 // temporarely disable change event
@@ -70,6 +77,12 @@ type Event struct {
 	// Command to be executed upon event
 	Command string
 
+	// glob patterns or names of files and directories to ignore
+	Ignore []string
+
+	// ID of an event that will be fired after this one
+	Trigger string
+
 	// custom event handler func
 	handler func(fsnotify.Event)
 
@@ -79,7 +92,7 @@ type Event struct {
 
 func printEventsUsageErr() {
 	l.Println(ErrInvalidUsage)
-	l.Println("usage: events [add <optype> <path> <filetype> <commandChain>] [remove <path>]")
+	l.Println("usage: events [add <optype> <path|glob> <filetype> <commandChain>] [remove <id>] [test <id>] [chain <id> <id>] [ignore <id> <patterns>]")
 }
 
 // handle events command
@@ -100,6 +113,29 @@ func handleEventsCommand(args []string) {
 		removeEvent(args[2])
 	case "add":
 		registerEvent(args)
+	case "test":
+		err := testEvent(args[2])
+		if err != nil {
+			Log.Error(err)
+		}
+	case "chain":
+		if len(args) != 4 {
+			printEventsUsageErr()
+			return
+		}
+		err := chainEvents(args[2], args[3])
+		if err != nil {
+			Log.Error(err)
+		}
+	case "ignore":
+		if len(args) < 4 {
+			printEventsUsageErr()
+			return
+		}
+		err := ignoreForEvent(args[2], args[3:])
+		if err != nil {
+			Log.Error(err)
+		}
 
 	default:
 		printEventsUsageErr()
@@ -122,7 +158,8 @@ func registerEvent(args []string) {
 	}
 
 	// check if path exists
-	_, err = os.Stat(args[3])
+	// for glob patterns the directory the pattern starts from must exist
+	_, err = os.Stat(globBase(args[3]))
 	if err != nil {
 		Log.Error(err)
 		return
@@ -198,9 +235,9 @@ func printEvents() {
 
 	w := 25
 
-	l.Println(cp.Prompt + pad("name", w) + pad("ID", w) + pad("operation", w) + pad("command", w) + pad("filetype", w) + pad("path", w))
+	l.Println(cp.Prompt + pad("name", w) + pad("ID", w) + pad("operation", w) + pad("command", w) + pad("filetype", w) + pad("trigger", w) + pad("path", w))
 	for _, e := range projectData.fields.Events {
-		l.Println(cp.Text + pad(e.Name, w) + pad(e.ID, w) + pad(e.Op.String(), w) + pad(e.Command, w) + pad(e.FileExtension, w) + pad(e.Path, w))
+		l.Println(cp.Text + pad(e.Name, w) + pad(e.ID, w) + pad(e.Op.String(), w) + pad(e.Command, w) + pad(e.FileExtension, w) + pad(e.Trigger, w) + pad(e.Path, w))
 	}
 }
 
@@ -288,8 +325,27 @@ func addEvent(e *Event) error {
 				// 	"path":  path,
 				// }).Debug("incoming event")
 
-				// check operation type
-				if event.Op == e.Op {
+				// watch directories created below a glob pattern
+				if event.Op == fsnotify.Create && isGlob(e.Path) {
+					if stat, err := os.Stat(event.Name); err == nil && stat.IsDir() && !e.ignored(event.Name) {
+						for _, dir := range watchDirs(event.Name, e.ignorePatterns()) {
+							if err := watcher.Add(dir); err != nil {
+								cLog.WithError(err).Error("failed to add path to watcher: ", dir)
+							}
+						}
+					}
+				}
+
+				if e.ignored(event.Name) {
+					continue
+				}
+
+				if isGlob(e.Path) && !matchGlob(e.Path, event.Name) {
+					continue
+				}
+
+				// check operation type, events can watch more than one
+				if event.Op&e.Op != 0 {
 
 					if e.FileExtension != "" {
 						if !strings.HasSuffix(event.Name, e.FileExtension) {
@@ -302,7 +358,7 @@ func addEvent(e *Event) error {
 					// example: when updating the config with the config command
 					// revalidating the config is not necessary
 					disableWriteEventMutex.Lock()
-					if disableWriteEvent {
+					if disableWriteEvent && event.Op&fsnotify.Write != 0 {
 						disableWriteEvent = false
 						disableWriteEventMutex.Unlock()
 						cLog.Debug("ignoring WRITE event for path: ", e.Path)
@@ -311,7 +367,7 @@ func addEvent(e *Event) error {
 					disableWriteEventMutex.Unlock()
 
 					// fire handler
-					e.handler(event)
+					fireEvent(e, event, map[string]bool{})
 				}
 			case err := <-watcher.Errors:
 				cLog.WithError(err).Fatal("watcher failed")
@@ -323,15 +379,21 @@ func addEvent(e *Event) error {
 		}
 	}()
 
-	// add path to watcher
-	err = watcher.Add(e.Path)
-	if err != nil {
-		cLog.WithFields(logrus.Fields{
-			"error": err,
-			"path":  e.Path,
-		}).Error("failed to add path to watcher")
-		e.stopChan <- true
-		return err
+	// add paths to watcher
+	paths := []string{e.Path}
+	if isGlob(e.Path) {
+		paths = watchDirs(globBase(e.Path), e.ignorePatterns())
+	}
+	for _, path := range paths {
+		err = watcher.Add(path)
+		if err != nil {
+			cLog.WithFields(logrus.Fields{
+				"error": err,
+				"path":  path,
+			}).Error("failed to add path to watcher")
+			e.stopChan <- true
+			return err
+		}
 	}
 
 	// wait for it
@@ -349,12 +411,229 @@ func reloadEvent(e *Event) {
 	case "config watcher":
 		go conf.watch(e.ID)
 	case "formatter watcher":
-		if conf.fields.AutoFormat {
-			go f.watchScriptDir(e.ID)
-		}
+		go f.watchScriptDir(e.ID)
 	case "commandsFile watcher":
 		go watchCommandsFile(commandsFilePath, e.ID)
+	case "commandsFile fragments watcher":
+		go watchCommandsFragments(e.ID)
+	case "commandsFile script watcher":
+		go watchCommandsStar(e.ID)
 	default:
 		Log.Warn("reload event called for an unknown event: ", e.Name)
 	}
 }
+
+// fire the handler of an event and all events chained to it
+// fired contains the IDs of the events handled so far, to break loops
+func fireEvent(e *Event, event fsnotify.Event, fired map[string]bool) {
+
+	if e.handler != nil {
+		e.handler(event)
+	}
+	fired[e.ID] = true
+
+	projectData.Lock()
+	trigger := e.Trigger
+	next, ok := projectData.fields.Events[trigger]
+	projectData.Unlock()
+
+	if trigger == "" {
+		return
+	}
+	if !ok {
+		Log.Error(ErrUnknownEvent, ": ", trigger, " triggered by event ", e.ID)
+		return
+	}
+	if fired[next.ID] {
+		Log.Warn("event chain loop detected, not firing event ", next.ID, " again")
+		return
+	}
+
+	Log.Debug("event ", e.ID, " triggers event ", next.ID)
+	fireEvent(next, fsnotify.Event{Name: next.Path, Op: next.Op}, fired)
+}
+
+// fire an event manually for debugging
+func testEvent(id string) error {
+
+	projectData.Lock()
+	e, ok := projectData.fields.Events[id]
+	projectData.Unlock()
+
+	if !ok {
+		return errors.New(ErrUnknownEvent.Error() + ": " + id)
+	}
+
+	Log.Info("firing event ", e.ID, " for path ", e.Path)
+	fireEvent(e, fsnotify.Event{Name: e.Path, Op: e.Op}, map[string]bool{})
+
+	return nil
+}
+
+// fire the event with the ID target after the event with the ID id
+func chainEvents(id, target string) error {
+
+	projectData.Lock()
+
+	e, ok := projectData.fields.Events[id]
+	if !ok {
+		projectData.Unlock()
+		return errors.New(ErrUnknownEvent.Error() + ": " + id)
+	}
+	if _, ok := projectData.fields.Events[target]; !ok {
+		projectData.Unlock()
+		return errors.New(ErrUnknownEvent.Error() + ": " + target)
+	}
+	if id == target {
+		projectData.Unlock()
+		return errors.New("an event can not trigger itself")
+	}
+	e.Trigger = target
+
+	projectData.Unlock()
+	projectData.update()
+
+	return nil
+}
+
+// add ignore patterns to an event
+func ignoreForEvent(id string, patterns []string) error {
+
+	projectData.Lock()
+
+	e, ok := projectData.fields.Events[id]
+	if !ok {
+		projectData.Unlock()
+		return errors.New(ErrUnknownEvent.Error() + ": " + id)
+	}
+	e.Ignore = append(e.Ignore, patterns...)
+
+	projectData.Unlock()
+	projectData.update()
+
+	return nil
+}
+
+// default and custom ignore patterns of the event
+func (e *Event) ignorePatterns() []string {
+	projectData.Lock()
+	defer projectData.Unlock()
+	return append(append([]string{}, defaultEventIgnore...), e.Ignore...)
+}
+
+// check if the path matches any of the ignore patterns
+// only the part below the watched path is checked, so watching an ignored directory explicitly works
+func (e *Event) ignored(path string) bool {
+	if rel, err := filepath.Rel(globBase(e.Path), path); err == nil {
+		path = rel
+	}
+	return isIgnored(path, e.ignorePatterns())
+}
+
+// check if any element of the path or the whole path matches one of the patterns
+func isIgnored(path string, patterns []string) bool {
+
+	path = filepath.Clean(path)
+
+	for _, p := range patterns {
+		if isGlob(p) && matchGlob(p, path) {
+			return true
+		}
+		for _, elem := range strings.Split(path, string(filepath.Separator)) {
+			if ok, _ := filepath.Match(p, elem); ok {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// check if the path contains glob characters
+func isGlob(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
+
+// return the directory a glob pattern starts from
+// example: src/**/*.go -> src
+func globBase(pattern string) string {
+
+	if !isGlob(pattern) {
+		return pattern
+	}
+
+	var base []string
+	for _, elem := range strings.Split(filepath.Clean(pattern), string(filepath.Separator)) {
+		if isGlob(elem) {
+			break
+		}
+		base = append(base, elem)
+	}
+
+	if len(base) == 0 {
+		return "."
+	}
+	if len(base) == 1 && base[0] == "" {
+		return string(filepath.Separator)
+	}
+
+	return strings.Join(base, string(filepath.Separator))
+}
+
+// match a path against a glob pattern
+// in addition to the filepath.Match syntax, ** matches any number of directories
+func matchGlob(pattern, path string) bool {
+	return matchGlobElems(
+		strings.Split(filepath.Clean(pattern), string(filepath.Separator)),
+		strings.Split(filepath.Clean(path), string(filepath.Separator)),
+	)
+}
+
+func matchGlobElems(pattern, path []string) bool {
+
+	for len(pattern) > 0 {
+
+		if pattern[0] == "**" {
+			// try to match the rest of the pattern for every suffix of the path
+			for i := 0; i <= len(path); i++ {
+				if matchGlobElems(pattern[1:], path[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(path) == 0 {
+			return false
+		}
+
+		if ok, _ := filepath.Match(pattern[0], path[0]); !ok {
+			return false
+		}
+
+		pattern = pattern[1:]
+		path = path[1:]
+	}
+
+	return len(path) == 0
+}
+
+// collect the directory and all its subdirectories, that are not ignored
+func watchDirs(root string, ignore []string) (dirs []string) {
+
+	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if rel, err := filepath.Rel(root, path); err == nil && rel != "." && isIgnored(rel, ignore) {
+			return filepath.SkipDir
+		}
+		dirs = append(dirs, path)
+		return nil
+	})
+
+	return
+}
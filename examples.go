@@ -0,0 +1,116 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+// bound to a key with: keys set <KeyComb> copy-example
+// replaces the prompt with the next example of the command on it
+const keyActionCopyExample = "copy-example"
+
+// ErrInvalidExample occurs when an example does not invoke its command, or passes an unknown argument
+var ErrInvalidExample = errors.New("invalid example")
+
+// make sure the examples invoke the command with its arguments
+func validateExamples(name string, examples []string, args map[string]*commandArg) error {
+
+	for _, example := range examples {
+
+		fields := strings.Fields(example)
+		if len(fields) == 0 || fields[0] != name {
+			return errors.New(ErrInvalidExample.Error() + ": " + example + ": does not start with " + name)
+		}
+
+		for _, field := range fields[1:] {
+			if field == extraArgsSeparator {
+				break
+			}
+			label := strings.SplitN(field, "=", 2)[0]
+			if _, ok := args[label]; !ok {
+				return errors.New(ErrInvalidExample.Error() + ": " + example + ": unknown argument " + label)
+			}
+		}
+	}
+
+	return nil
+}
+
+// the label=value pairs of the examples, for the completion of the arguments
+func exampleArguments(examples []string) (res []string) {
+
+	seen := make(map[string]bool)
+	for _, example := range examples {
+		fields := strings.Fields(example)
+		if len(fields) == 0 {
+			continue
+		}
+		for _, field := range fields[1:] {
+			if field == extraArgsSeparator {
+				break
+			}
+			if strings.Contains(field, "=") && !seen[field] {
+				seen[field] = true
+				res = append(res, field)
+			}
+		}
+	}
+	return
+}
+
+// print the examples of a command for the help builtin
+func (c *command) printExamples() {
+
+	if len(c.examples) == 0 {
+		return
+	}
+
+	l.Println("\nexamples:")
+	for _, example := range c.examples {
+		l.Println("  " + cp.Prompt + example + cp.Reset)
+	}
+}
+
+// the next example of the command on the prompt
+// pressing the key again cycles through the examples
+func copyExample(line []rune) ([]rune, bool) {
+
+	fields := strings.Fields(string(line))
+	if len(fields) == 0 {
+		return nil, false
+	}
+
+	cmdMap.Lock()
+	c, ok := cmdMap.items[fields[0]]
+	cmdMap.Unlock()
+	if !ok || len(c.examples) == 0 {
+		return nil, false
+	}
+
+	next := 0
+	for i, example := range c.examples {
+		if example == strings.TrimSpace(string(line)) {
+			next = (i + 1) % len(c.examples)
+			break
+		}
+	}
+	return []rune(c.examples[next]), true
+}
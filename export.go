@@ -0,0 +1,383 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	// CI pipeline formats
+	exportFormatGitHub = "github"
+	exportFormatGitLab = "gitlab"
+
+	// exportFlagFormat sets the CI pipeline format
+	exportFlagFormat = "--format"
+
+	// exportFlagOutput sets the file the pipeline is written to, - prints it to stdout
+	exportFlagOutput = "--output"
+
+	// skipDependenciesEnv disables running dependencies
+	// exported pipelines run every dependency in a job of its own
+	skipDependenciesEnv = "ZEUS_SKIP_DEPENDENCIES"
+
+	// marker for generated pipeline files
+	exportMarker = "# generated by zeus export ci - edit the CommandsFile and export again instead"
+
+	// installs zeus in the CI jobs
+	exportInstallZeus = "go install github.com/dreadl0ck/zeus@latest"
+)
+
+var (
+	// ErrUnknownExportFormat means the requested CI format is not supported
+	ErrUnknownExportFormat = errors.New("unknown export format, expected " + exportFormatGitHub + " or " + exportFormatGitLab)
+
+	// default pipeline files for each format
+	exportDefaultOutput = map[string]string{
+		exportFormatGitHub: filepath.Join(".github", "workflows", "zeus.yml"),
+		exportFormatGitLab: ".gitlab-ci.yml",
+	}
+)
+
+// a CI job running a single zeus invocation
+type ciJob struct {
+	id         string
+	invocation string
+	needs      []string
+	outputs    []string
+
+	// length of the longest chain of jobs this one needs
+	depth int
+}
+
+// CI jobs in the order they have been added
+type ciPipeline struct {
+	jobs  []*ciJob
+	index map[string]*ciJob
+}
+
+func printExportCommandUsageErr() {
+	l.Println(ErrInvalidUsage)
+	l.Println("usage: export ci " + exportFlagFormat + " <" + exportFormatGitHub + " | " + exportFormatGitLab + "> [" + exportFlagOutput + " <file>] [commandChain]")
+	l.Println("       export standalone <command> [" + exportFlagOutput + " <file>]")
+}
+
+// check if dependencies should be skipped when running a command
+func skipDependencies() bool {
+	return os.Getenv(skipDependenciesEnv) != ""
+}
+
+// handle the export builtin
+func handleExportCommand(args []string) error {
+
+	if len(args) < 2 {
+		printExportCommandUsageErr()
+		return ErrInvalidUsage
+	}
+
+	switch args[1] {
+	case "ci":
+		return handleExportCICommand(args)
+	case "standalone":
+		return handleExportStandaloneCommand(args)
+	default:
+		printExportCommandUsageErr()
+		return ErrInvalidUsage
+	}
+}
+
+// handle export ci
+func handleExportCICommand(args []string) error {
+
+	var (
+		format string
+		output string
+		chain  []string
+	)
+	for i := 2; i < len(args); i++ {
+		switch args[i] {
+		case exportFlagFormat, exportFlagOutput:
+			if i+1 == len(args) {
+				printExportCommandUsageErr()
+				return ErrInvalidUsage
+			}
+			if args[i] == exportFlagFormat {
+				format = args[i+1]
+			} else {
+				output = args[i+1]
+			}
+			i++
+		default:
+			chain = append(chain, args[i])
+		}
+	}
+
+	if _, ok := exportDefaultOutput[format]; !ok {
+		printExportCommandUsageErr()
+		return ErrUnknownExportFormat
+	}
+	if output == "" {
+		output = exportDefaultOutput[format]
+	}
+
+	pipeline, err := newCIPipeline(strings.Join(chain, " "))
+	if err != nil {
+		return err
+	}
+
+	var contents string
+	if format == exportFormatGitHub {
+		contents = pipeline.github()
+	} else {
+		contents = pipeline.gitlab()
+	}
+
+	if output == "-" {
+		os.Stdout.WriteString(contents)
+		return nil
+	}
+
+	err = os.MkdirAll(filepath.Dir(output), 0700)
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(output, []byte(contents), 0644)
+	if err != nil {
+		return err
+	}
+
+	l.Println("exported " + strconv.Itoa(len(pipeline.jobs)) + " jobs to " + output)
+	return nil
+}
+
+// create the jobs for a commandChain and all dependencies
+// an empty chain exports all commands
+func newCIPipeline(chain string) (*ciPipeline, error) {
+
+	var (
+		p = &ciPipeline{
+			index: make(map[string]*ciJob),
+		}
+		previous *ciJob
+	)
+
+	if strings.TrimSpace(chain) == "" {
+
+		var names []string
+		cmdMap.Lock()
+		for name := range cmdMap.items {
+			names = append(names, name)
+		}
+		cmdMap.Unlock()
+		sortCommandNames(names)
+
+		for _, name := range names {
+			_, err := p.add(name, nil)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return p, nil
+	}
+
+	// each element of the chain needs the previous one
+	for _, invocation := range strings.Split(chain, commandChainSeparator) {
+
+		var after []string
+		if previous != nil {
+			after = append(after, previous.id)
+		}
+
+		job, err := p.add(strings.TrimSpace(invocation), after)
+		if err != nil {
+			return nil, err
+		}
+		previous = job
+	}
+
+	return p, nil
+}
+
+// add a job for an invocation and its dependencies
+func (p *ciPipeline) add(invocation string, after []string) (*ciJob, error) {
+
+	fields := strings.Fields(invocation)
+	if len(fields) == 0 {
+		return nil, ErrEmptyDependency
+	}
+
+	if job, ok := p.index[ciJobID(fields)]; ok {
+		return job, nil
+	}
+
+	cmd, err := cmdMap.getCommand(fields[0])
+	if err != nil {
+		return nil, err
+	}
+
+	job := &ciJob{
+		id:         ciJobID(fields),
+		invocation: strings.Join(append([]string{"zeus"}, fields...), " "),
+		outputs:    cmd.outputs,
+	}
+
+	// claim the id before descending, dependency cycles are caught when parsing the CommandsFile
+	p.index[job.id] = job
+
+	for _, dep := range cmd.dependencies {
+		d, err := p.add(dep, nil)
+		if err != nil {
+			return nil, errors.New("dependency of " + fields[0] + ": " + err.Error())
+		}
+		after = append(after, d.id)
+	}
+
+	for _, id := range after {
+		if !contains(job.needs, id) {
+			job.needs = append(job.needs, id)
+		}
+		if d := p.index[id]; d.depth+1 > job.depth {
+			job.depth = d.depth + 1
+		}
+	}
+
+	p.jobs = append(p.jobs, job)
+	return job, nil
+}
+
+// job ids may only contain letters, digits, '-' and '_' and must not start with a digit
+func ciJobID(fields []string) string {
+
+	id := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-' {
+			return r
+		}
+		return '-'
+	}, strings.Join(fields, "-"))
+
+	if id[0] >= '0' && id[0] <= '9' {
+		id = "_" + id
+	}
+	return id
+}
+
+// render the pipeline as a GitHub Actions workflow
+// outputs of a job are uploaded as artifacts and downloaded by the jobs that need it
+func (p *ciPipeline) github() string {
+
+	var b bytes.Buffer
+
+	b.WriteString(exportMarker + "\n")
+	b.WriteString("name: zeus\n\n")
+	b.WriteString("on:\n    push:\n    pull_request:\n\n")
+	b.WriteString("env:\n    " + skipDependenciesEnv + ": \"true\"\n\n")
+	b.WriteString("jobs:\n")
+
+	for _, job := range p.jobs {
+
+		b.WriteString("\n    " + job.id + ":\n")
+		b.WriteString("        runs-on: ubuntu-latest\n")
+		if len(job.needs) > 0 {
+			b.WriteString("        needs: [" + strings.Join(job.needs, ", ") + "]\n")
+		}
+		b.WriteString("        steps:\n")
+		b.WriteString("            - uses: actions/checkout@v2\n")
+		b.WriteString("            - uses: actions/setup-go@v2\n")
+		b.WriteString("            - run: " + exportInstallZeus + "\n")
+
+		for _, id := range job.needs {
+			if len(p.index[id].outputs) == 0 {
+				continue
+			}
+			b.WriteString("            - uses: actions/download-artifact@v2\n")
+			b.WriteString("              with:\n")
+			b.WriteString("                  name: " + id + "\n")
+		}
+
+		b.WriteString("            - run: " + yamlScalar(job.invocation) + "\n")
+
+		if len(job.outputs) > 0 {
+			b.WriteString("            - uses: actions/upload-artifact@v2\n")
+			b.WriteString("              with:\n")
+			b.WriteString("                  name: " + job.id + "\n")
+			b.WriteString("                  path: |\n")
+			for _, o := range job.outputs {
+				b.WriteString("                      " + o + "\n")
+			}
+		}
+	}
+
+	return b.String()
+}
+
+// render the pipeline as a GitLab CI configuration
+// jobs are put into stages by the length of their dependency chain, artifacts are passed on by needs
+func (p *ciPipeline) gitlab() string {
+
+	var (
+		b     bytes.Buffer
+		depth int
+	)
+	for _, job := range p.jobs {
+		if job.depth > depth {
+			depth = job.depth
+		}
+	}
+
+	b.WriteString(exportMarker + "\n")
+	b.WriteString("image: golang:latest\n\n")
+	b.WriteString("variables:\n    " + skipDependenciesEnv + ": \"true\"\n\n")
+	b.WriteString("before_script:\n    - " + exportInstallZeus + "\n\n")
+	b.WriteString("stages:\n")
+	for i := 0; i <= depth; i++ {
+		b.WriteString("    - " + ciStage(i) + "\n")
+	}
+
+	for _, job := range p.jobs {
+
+		b.WriteString("\n" + job.id + ":\n")
+		b.WriteString("    stage: " + ciStage(job.depth) + "\n")
+		if len(job.needs) > 0 {
+			b.WriteString("    needs: [" + strings.Join(job.needs, ", ") + "]\n")
+		}
+		b.WriteString("    script:\n")
+		b.WriteString("        - " + yamlScalar(job.invocation) + "\n")
+
+		if len(job.outputs) > 0 {
+			b.WriteString("    artifacts:\n")
+			b.WriteString("        paths:\n")
+			for _, o := range job.outputs {
+				b.WriteString("            - " + yamlScalar(o) + "\n")
+			}
+		}
+	}
+
+	return b.String()
+}
+
+func ciStage(depth int) string {
+	return "zeus-" + strconv.Itoa(depth+1)
+}
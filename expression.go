@@ -0,0 +1,464 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"unicode"
+)
+
+var (
+	// ErrInvalidExpression means a skipIf expression could not be parsed
+	ErrInvalidExpression = errors.New("invalid expression")
+
+	// ErrExpressionType means the operands of an expression have the wrong type
+	ErrExpressionType = errors.New("type mismatch")
+
+	// ErrUnknownExpressionFunc means an expression calls a function that does not exist
+	ErrUnknownExpressionFunc = errors.New("unknown function")
+)
+
+// value types of expressions
+const (
+	exprBool   = "Bool"
+	exprString = "String"
+)
+
+// kinds of expression tokens
+const (
+	tokenIdent = iota
+	tokenString
+	tokenOperator
+	tokenEnd
+)
+
+type exprToken struct {
+	kind  int
+	value string
+	pos   int
+}
+
+// expression is a parsed skipIf condition
+// the types of all operands are checked while parsing, so evaluating it can not fail
+type expression struct {
+	source string
+	root   *exprNode
+}
+
+// exprNode is a typed node of the expression tree
+// depending on its type either truth or text is set
+type exprNode struct {
+	typ   string
+	truth func() bool
+	text  func() string
+}
+
+// a function available in expressions
+// functions returning a Bool implement truth, functions returning a String implement text
+type exprFunc struct {
+	params []string
+	truth  func(args []string) bool
+	text   func(args []string) string
+}
+
+// functions available in expressions
+// all parameters are strings, the results are bools or strings
+var exprFuncs = map[string]exprFunc{
+	// true if the path exists, glob patterns match at least one file
+	"exists": {
+		params: []string{exprString},
+		truth: func(args []string) bool {
+			matches, err := filepath.Glob(args[0])
+			return err == nil && len(matches) > 0
+		},
+	},
+	// value of an environment variable, empty if unset
+	"env": {
+		params: []string{exprString},
+		text: func(args []string) string {
+			return os.Getenv(args[0])
+		},
+	},
+	// true if the first file exists and was modified after the second one, or the second one is missing
+	"newer": {
+		params: []string{exprString, exprString},
+		truth: func(args []string) bool {
+			a, err := os.Stat(args[0])
+			if err != nil {
+				return false
+			}
+			b, err := os.Stat(args[1])
+			if err != nil {
+				return true
+			}
+			return a.ModTime().After(b.ModTime())
+		},
+	},
+	// name of the operating system, like linux or darwin
+	"os": {
+		text: func(args []string) string {
+			return runtime.GOOS
+		},
+	},
+}
+
+func boolNode(f func() bool) *exprNode {
+	return &exprNode{typ: exprBool, truth: f}
+}
+
+func stringNode(f func() string) *exprNode {
+	return &exprNode{typ: exprString, text: f}
+}
+
+// parse an expression like: exists('dist/app') && env('CI') != 'true'
+//
+// supported are string literals in single or double quotes, true and false,
+// the operators ! && || == != and parentheses, and calls of the functions exists, env, newer and os
+func parseExpression(source string) (*expression, error) {
+
+	tokens, err := tokenizeExpression(source)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &exprParser{tokens: tokens}
+
+	root, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind != tokenEnd {
+		return nil, p.errorAt(t, "unexpected "+strconv.Quote(t.value))
+	}
+
+	if root.typ != exprBool {
+		return nil, errors.New(ErrExpressionType.Error() + ": expression must be a Bool, got " + root.typ)
+	}
+
+	return &expression{
+		source: source,
+		root:   root,
+	}, nil
+}
+
+// evaluate the expression
+func (e *expression) eval() bool {
+	return e.root.truth()
+}
+
+func (e *expression) String() string {
+	return e.source
+}
+
+// split the source into identifiers, string literals and operators
+func tokenizeExpression(source string) ([]exprToken, error) {
+
+	var (
+		tokens []exprToken
+		runes  = []rune(source)
+	)
+
+	for i := 0; i < len(runes); {
+
+		r := runes[i]
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+
+		case r == '\'' || r == '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != r {
+				end++
+			}
+			if end == len(runes) {
+				return nil, errors.New(ErrInvalidExpression.Error() + ": unterminated string at position " + strconv.Itoa(i+1))
+			}
+			tokens = append(tokens, exprToken{kind: tokenString, value: string(runes[i+1 : end]), pos: i})
+			i = end + 1
+
+		case unicode.IsLetter(r) || r == '_':
+			end := i
+			for end < len(runes) && (unicode.IsLetter(runes[end]) || unicode.IsDigit(runes[end]) || runes[end] == '_') {
+				end++
+			}
+			tokens = append(tokens, exprToken{kind: tokenIdent, value: string(runes[i:end]), pos: i})
+			i = end
+
+		default:
+			var op string
+			if i+1 < len(runes) {
+				switch string(runes[i : i+2]) {
+				case "&&", "||", "==", "!=":
+					op = string(runes[i : i+2])
+				}
+			}
+			if op == "" {
+				switch r {
+				case '!', '(', ')', ',':
+					op = string(r)
+				default:
+					return nil, errors.New(ErrInvalidExpression.Error() + ": unexpected " + strconv.Quote(string(r)) + " at position " + strconv.Itoa(i+1))
+				}
+			}
+			tokens = append(tokens, exprToken{kind: tokenOperator, value: op, pos: i})
+			i += len(op)
+		}
+	}
+
+	return append(tokens, exprToken{kind: tokenEnd, value: "end of expression", pos: len(runes)}), nil
+}
+
+// recursive descent parser, from the lowest to the highest precedence:
+// ||, &&, !, == and !=, literals, calls and parentheses
+type exprParser struct {
+	tokens []exprToken
+	index  int
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.index]
+}
+
+func (p *exprParser) next() exprToken {
+	t := p.tokens[p.index]
+	if t.kind != tokenEnd {
+		p.index++
+	}
+	return t
+}
+
+// consume the operator if it is next
+func (p *exprParser) accept(op string) bool {
+	if t := p.peek(); t.kind == tokenOperator && t.value == op {
+		p.index++
+		return true
+	}
+	return false
+}
+
+func (p *exprParser) expect(op string) error {
+	if !p.accept(op) {
+		t := p.peek()
+		return p.errorAt(t, "expected "+strconv.Quote(op)+", got "+strconv.Quote(t.value))
+	}
+	return nil
+}
+
+func (p *exprParser) errorAt(t exprToken, msg string) error {
+	return errors.New(ErrInvalidExpression.Error() + ": " + msg + " at position " + strconv.Itoa(t.pos+1))
+}
+
+func (p *exprParser) or() (*exprNode, error) {
+
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.accept("||") {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		if err := checkBools("||", left, right); err != nil {
+			return nil, err
+		}
+		a, b := left.truth, right.truth
+		left = boolNode(func() bool { return a() || b() })
+	}
+
+	return left, nil
+}
+
+func (p *exprParser) and() (*exprNode, error) {
+
+	left, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.accept("&&") {
+		right, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		if err := checkBools("&&", left, right); err != nil {
+			return nil, err
+		}
+		a, b := left.truth, right.truth
+		left = boolNode(func() bool { return a() && b() })
+	}
+
+	return left, nil
+}
+
+func (p *exprParser) not() (*exprNode, error) {
+
+	if p.accept("!") {
+		operand, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		if err := checkBools("!", operand); err != nil {
+			return nil, err
+		}
+		return boolNode(func() bool { return !operand.truth() }), nil
+	}
+
+	return p.comparison()
+}
+
+func (p *exprParser) comparison() (*exprNode, error) {
+
+	left, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+
+	var op string
+	switch {
+	case p.accept("=="):
+		op = "=="
+	case p.accept("!="):
+		op = "!="
+	default:
+		return left, nil
+	}
+
+	right, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+
+	if left.typ != right.typ {
+		return nil, errors.New(ErrExpressionType.Error() + ": can not compare " + left.typ + " " + op + " " + right.typ)
+	}
+
+	equal := func() bool {
+		if left.typ == exprBool {
+			return left.truth() == right.truth()
+		}
+		return left.text() == right.text()
+	}
+
+	if op == "!=" {
+		return boolNode(func() bool { return !equal() }), nil
+	}
+	return boolNode(equal), nil
+}
+
+func (p *exprParser) primary() (*exprNode, error) {
+
+	t := p.next()
+
+	switch t.kind {
+	case tokenString:
+		value := t.value
+		return stringNode(func() string { return value }), nil
+
+	case tokenIdent:
+		switch t.value {
+		case "true":
+			return boolNode(func() bool { return true }), nil
+		case "false":
+			return boolNode(func() bool { return false }), nil
+		}
+		return p.call(t)
+
+	case tokenOperator:
+		if t.value == "(" {
+			inner, err := p.or()
+			if err != nil {
+				return nil, err
+			}
+			return inner, p.expect(")")
+		}
+	}
+
+	return nil, p.errorAt(t, "unexpected "+strconv.Quote(t.value))
+}
+
+// parse a function call, the arguments are evaluated when the function is called
+func (p *exprParser) call(name exprToken) (*exprNode, error) {
+
+	f, ok := exprFuncs[name.value]
+	if !ok {
+		return nil, errors.New(ErrUnknownExpressionFunc.Error() + ": " + name.value)
+	}
+
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+
+	var args []*exprNode
+	if !p.accept(")") {
+		for {
+			arg, err := p.or()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if p.accept(")") {
+				break
+			}
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(args) != len(f.params) {
+		return nil, errors.New(ErrInvalidExpression.Error() + ": " + name.value + " expects " + strconv.Itoa(len(f.params)) + " arguments, got " + strconv.Itoa(len(args)))
+	}
+
+	for i, arg := range args {
+		if arg.typ != f.params[i] {
+			return nil, errors.New(ErrExpressionType.Error() + ": argument " + strconv.Itoa(i+1) + " of " + name.value + " must be a " + f.params[i] + ", got " + arg.typ)
+		}
+	}
+
+	values := func() []string {
+		v := make([]string, len(args))
+		for i, arg := range args {
+			v[i] = arg.text()
+		}
+		return v
+	}
+
+	if f.truth != nil {
+		return boolNode(func() bool { return f.truth(values()) }), nil
+	}
+	return stringNode(func() string { return f.text(values()) }), nil
+}
+
+// make sure all operands of a logical operator are bools
+func checkBools(op string, operands ...*exprNode) error {
+	for _, o := range operands {
+		if o.typ != exprBool {
+			return errors.New(ErrExpressionType.Error() + ": " + op + " expects Bool operands, got " + o.typ)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// maximum number of suggestions for an unknown command
+const maxSuggestions = 3
+
+var (
+	// ErrEmptyFallback means the fallback field of the CommandsFile contains no command
+	ErrEmptyFallback = errors.New("fallback must contain a command")
+
+	// fallback for unknown commands declared in the CommandsFile
+	commandFallback = &fallbackHandler{}
+)
+
+// forwards unknown commands to another build tool
+// the unknown command and its arguments are appended to the fallback command line
+type fallbackHandler struct {
+	line string
+	sync.Mutex
+}
+
+// set the fallback declared in the CommandsFile
+func initFallback(line string) error {
+
+	if line != "" && strings.TrimSpace(line) == "" {
+		return ErrEmptyFallback
+	}
+
+	commandFallback.Lock()
+	commandFallback.line = strings.TrimSpace(line)
+	commandFallback.Unlock()
+
+	return nil
+}
+
+// get the fallback command line, empty if there is none
+func (f *fallbackHandler) get() string {
+	f.Lock()
+	defer f.Unlock()
+	return f.line
+}
+
+// pass an unknown command to the fallback
+// returns ErrUnknownCommand if no fallback is declared
+func runFallback(name string, args []string) error {
+
+	line := commandFallback.get()
+	if line == "" {
+		return ErrUnknownCommand
+	}
+
+	Log.Debug("passing unknown command " + name + " to fallback: " + line)
+
+	cmd := exec.Command("/bin/bash", "-e", "-c", line+" "+name+" "+strings.Join(args, " "))
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	// the fallback sees the globals, just like the commands do
+	cmd.Env = os.Environ()
+	g.Lock()
+	for _, n := range sortedKeys(g.Vars) {
+		cmd.Env = append(cmd.Env, n+"="+substitutions.expand(g.Vars[n]))
+	}
+	g.Unlock()
+
+	return cmd.Run()
+}
+
+// print the error for an unknown command with the most similar commands, aliases and builtins
+func printUnknownCommand(name string) {
+
+	l.Println(ErrUnknownCommand.Error() + ": " + name)
+
+	if suggestions := suggestCommands(name); len(suggestions) > 0 {
+		l.Println(cp.Text + "did you mean: " + cp.Prompt + strings.Join(suggestions, cp.Text+", "+cp.Prompt) + cp.Text + "?" + cp.Reset)
+	}
+}
+
+// find the commands, aliases and builtins with the smallest edit distance to name
+// names are only suggested if at most a third of their characters differ
+func suggestCommands(name string) []string {
+
+	var candidates []string
+
+	cmdMap.Lock()
+	for n := range cmdMap.items {
+		candidates = append(candidates, n)
+	}
+	cmdMap.Unlock()
+
+	projectData.Lock()
+	for n := range projectData.fields.Aliases {
+		candidates = append(candidates, n)
+	}
+	projectData.Unlock()
+
+	for n := range builtins {
+		candidates = append(candidates, n)
+	}
+
+	var (
+		distances   = make(map[string]int)
+		suggestions []string
+		limit       = len(name) / 3
+	)
+	if limit < 1 {
+		limit = 1
+	}
+
+	for _, c := range candidates {
+		if _, ok := distances[c]; ok || c == name {
+			continue
+		}
+		if d := levenshtein(name, c); d <= limit {
+			distances[c] = d
+			suggestions = append(suggestions, c)
+		}
+	}
+
+	sort.Slice(suggestions, func(i, j int) bool {
+		if distances[suggestions[i]] != distances[suggestions[j]] {
+			return distances[suggestions[i]] < distances[suggestions[j]]
+		}
+		return suggestions[i] < suggestions[j]
+	})
+
+	if len(suggestions) > maxSuggestions {
+		suggestions = suggestions[:maxSuggestions]
+	}
+	return suggestions
+}
+
+// number of single character insertions, deletions and substitutions to turn a into b
+func levenshtein(a, b string) int {
+
+	var (
+		ra   = []rune(a)
+		rb   = []rune(b)
+		prev = make([]int, len(rb)+1)
+		cur  = make([]int, len(rb)+1)
+	)
+
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+
+	return prev[len(rb)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
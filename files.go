@@ -0,0 +1,104 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// suffix for the backup of files written with writeFileWithBackup
+const backupSuffix = ".bak"
+
+// write a file without leaving a partially written file behind when interrupted
+// the data is written to a temporary file in the same directory, synced to disk and renamed to path
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+
+	dir := filepath.Dir(path)
+
+	f, err := ioutil.TempFile(dir, "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	// remove the temp file if anything goes wrong
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(data)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	err = f.Sync()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+
+	err = os.Chmod(f.Name(), perm)
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(f.Name(), path)
+	if err != nil {
+		return err
+	}
+
+	// persist the rename
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
+
+// write a file atomically and keep the previous version as path.bak
+func writeFileWithBackup(path string, data []byte, perm os.FileMode) error {
+
+	if previous, err := ioutil.ReadFile(path); err == nil && len(previous) > 0 {
+		err = writeFileAtomic(path+backupSuffix, previous, perm)
+		if err != nil {
+			Log.WithError(err).Warn("failed to write backup for ", path)
+		}
+	}
+
+	return writeFileAtomic(path, data, perm)
+}
+
+// read the backup for the file at path and restore it
+// used when the file was found to be corrupted
+func restoreBackup(path string) ([]byte, error) {
+
+	contents, err := ioutil.ReadFile(path + backupSuffix)
+	if err != nil {
+		return nil, err
+	}
+
+	return contents, writeFileAtomic(path, contents, 0700)
+}
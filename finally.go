@@ -0,0 +1,169 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// commands from the finally field of the commands started in an invocation
+// they run when the top-level invocation ended, whether it succeeded, failed or was interrupted
+type finalizerQueue struct {
+
+	// command lines in the order they were registered
+	lines []string
+
+	// registered command lines, each one runs only once
+	seen map[string]bool
+
+	// the finalizers are running, their own finally entries are not added
+	running bool
+
+	sync.Mutex
+}
+
+var finalizers = &finalizerQueue{
+	seen: make(map[string]bool),
+}
+
+// register the finally entries of a command that is about to start
+func (q *finalizerQueue) add(c *command) {
+
+	if len(c.finally) == 0 || s.isInterrupted() {
+		return
+	}
+
+	q.Lock()
+	defer q.Unlock()
+
+	if q.running {
+		return
+	}
+	for _, line := range c.finally {
+		if !q.seen[line] {
+			q.seen[line] = true
+			q.lines = append(q.lines, line)
+		}
+	}
+}
+
+// run the registered finalizers, the last registered first, like deferred calls
+// every finalizer runs, even if the previous one failed
+// returns the number of failed finalizers
+func (q *finalizerQueue) run() (failed int) {
+
+	q.Lock()
+	if q.running || len(q.lines) == 0 {
+		q.Unlock()
+		return 0
+	}
+	lines := q.lines
+	q.lines = nil
+	q.seen = make(map[string]bool)
+	q.running = true
+	q.Unlock()
+
+	defer func() {
+		q.Lock()
+		q.running = false
+		q.Unlock()
+	}()
+
+	// the processes of an interrupted invocation must have exited, or the shutdown would kill the finalizers
+	waitForShutdown()
+
+	// the finalizers are an invocation of their own, with a progress starting from the beginning
+	err := s.begin()
+	if err != nil {
+		Log.WithError(err).Error("failed to run finally commands")
+		return len(lines)
+	}
+	defer s.end()
+
+	// plan all finalizers before the first one starts
+	var (
+		cmds  = make([]*command, len(lines))
+		total int
+	)
+	for i, line := range lines {
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		cmd, err := cmdMap.getCommand(fields[0])
+		if err != nil {
+			Log.WithError(err).Error("invalid finally command: " + line)
+			failed++
+			continue
+		}
+
+		count, err := getTotalDependencyCount(cmd)
+		if err != nil {
+			Log.WithError(err).Error("finally " + line + " failed")
+			failed++
+			continue
+		}
+
+		cmds[i] = cmd
+		total += count
+	}
+	s.plan(total)
+
+	// the last registered runs first
+	for i := len(lines) - 1; i >= 0; i-- {
+		if cmds[i] != nil {
+			progressUI.plan(cmds[i])
+		}
+	}
+
+	for i := len(lines) - 1; i >= 0; i-- {
+
+		if cmds[i] == nil {
+			continue
+		}
+
+		if !quietOutput() {
+			l.Println(printPrompt() + "running finally " + cp.Prompt + lines[i] + cp.Reset)
+		}
+
+		err = cmds[i].Run(strings.Fields(lines[i])[1:], false)
+		if err != nil {
+			Log.WithError(err).Error("finally " + lines[i] + " failed")
+			failed++
+		}
+	}
+	return
+}
+
+// block until a signal has been handled
+func waitForShutdown() {
+	for {
+		signalMutex.Lock()
+		done := !shuttingDown
+		signalMutex.Unlock()
+		if done {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
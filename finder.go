@@ -0,0 +1,365 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/dreadl0ck/readline"
+)
+
+const (
+	// key that toggles the fuzzy finder in the interactive shell, unless it has a key binding
+	finderKey = "Ctrl-T"
+
+	// number of matches listed below the prompt of the fuzzy finder
+	finderRows = 10
+
+	// score of a match in the name, ranks every name match before matches in the description only
+	finderNameBonus = 1000
+)
+
+var (
+	// fuzzy finder of the interactive shell
+	finder = &fuzzyFinder{}
+)
+
+// a command, alias or builtin the fuzzy finder searches
+type finderItem struct {
+	name        string
+	description string
+	score       int
+}
+
+// the fuzzy finder filters the commands while the query is typed at the prompt
+// it paints the best matches below the prompt, Enter inserts the selected one into the next prompt
+type fuzzyFinder struct {
+	active bool
+
+	// items when the finder was opened
+	items []*finderItem
+
+	// matches of the last painted query
+	query    string
+	matches  []*finderItem
+	selected int
+
+	// inserted into the next prompt
+	pending string
+
+	sync.Mutex
+}
+
+// collect the commands, aliases and builtins
+func finderItems() (items []*finderItem) {
+
+	cmdMap.Lock()
+	for name, cmd := range cmdMap.items {
+		items = append(items, &finderItem{name: name, description: cmd.description})
+	}
+	cmdMap.Unlock()
+
+	projectData.Lock()
+	for name, line := range projectData.fields.Aliases {
+		items = append(items, &finderItem{name: name, description: "alias for " + line})
+	}
+	projectData.Unlock()
+
+	for name, description := range builtins {
+		items = append(items, &finderItem{name: name, description: description})
+	}
+
+	return items
+}
+
+// score the characters of the pattern appearing in order in the text, ignoring the case
+// consecutive characters and characters at the start of a word score higher, skipped characters lower
+func fuzzyScore(pattern, text string) (int, bool) {
+
+	var (
+		p         = []rune(strings.ToLower(pattern))
+		t         = []rune(strings.ToLower(text))
+		score     int
+		last      = -1
+		j         int
+		wordStart = func(i int) bool {
+			return i == 0 || !unicode.IsLetter(t[i-1]) && !unicode.IsDigit(t[i-1])
+		}
+	)
+
+	for i := 0; i < len(t) && j < len(p); i++ {
+		if t[i] != p[j] {
+			continue
+		}
+		score += 10
+		switch {
+		case last >= 0 && i == last+1:
+			score += 15
+		case wordStart(i):
+			score += 10
+		case last >= 0:
+			score -= i - last - 1
+		}
+		last = i
+		j++
+	}
+
+	if j < len(p) {
+		return 0, false
+	}
+	return score, true
+}
+
+// rank the items matching all words of the query, the best match first
+// an empty query keeps all items, the shorter names first
+func fuzzyFind(query string, items []*finderItem) []*finderItem {
+
+	var (
+		words   = strings.Fields(query)
+		matches []*finderItem
+	)
+
+	for _, item := range items {
+
+		var (
+			total int
+			ok    = true
+		)
+
+		for _, w := range words {
+			if score, found := fuzzyScore(w, item.name); found {
+				total += score + finderNameBonus
+			} else if score, found = fuzzyScore(w, item.description); found {
+				total += score
+			} else {
+				ok = false
+				break
+			}
+		}
+
+		if ok {
+			matches = append(matches, &finderItem{name: item.name, description: item.description, score: total})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		if len(matches[i].name) != len(matches[j].name) {
+			return len(matches[i].name) < len(matches[j].name)
+		}
+		return matches[i].name < matches[j].name
+	})
+
+	return matches
+}
+
+// prompt of the interactive shell while the fuzzy finder is open
+func finderPrompt() string {
+	return cp.Prompt + "find" + marker(" » ", "> ") + cp.Text
+}
+
+// open the fuzzy finder
+// the lines for the matches are reserved below the prompt, so the terminal does not scroll while painting them
+func (f *fuzzyFinder) open() {
+
+	items := finderItems()
+
+	f.Lock()
+	f.active, f.items, f.query, f.matches, f.selected = true, items, "", nil, 0
+	f.Unlock()
+
+	print(strings.Repeat("\n", finderRows) + "\033[" + strconv.Itoa(finderRows) + "A")
+}
+
+// close the fuzzy finder
+func (f *fuzzyFinder) close() {
+	f.Lock()
+	f.active, f.items, f.matches = false, nil, nil
+	f.Unlock()
+}
+
+func (f *fuzzyFinder) isActive() bool {
+	f.Lock()
+	defer f.Unlock()
+	return f.active
+}
+
+// take the line that is inserted into the next prompt
+func (f *fuzzyFinder) takePending() string {
+	f.Lock()
+	defer f.Unlock()
+	p := f.pending
+	f.pending = ""
+	return p
+}
+
+// close the finder for the query submitted with Enter
+// the selected name is inserted into the next prompt, without matches the query is kept
+func (f *fuzzyFinder) accept(query string) {
+
+	f.Lock()
+	if f.query != query || f.matches == nil {
+		f.query, f.matches, f.selected = query, fuzzyFind(query, f.items), 0
+	}
+	if len(f.matches) > 0 {
+		f.pending = f.matches[f.selected].name + " "
+	} else {
+		f.pending = query
+	}
+	f.Unlock()
+
+	f.close()
+}
+
+// filter the keys read by the interactive shell
+// the finder key opens and closes the finder, while it is open the arrow keys move the selection and Ctrl-G cancels
+func (f *fuzzyFinder) filterInputRune(r rune) (rune, bool) {
+
+	switch r {
+	case readline.CharTranspose:
+
+		projectData.Lock()
+		_, bound := projectData.fields.KeyBindings[finderKey]
+		projectData.Unlock()
+		if bound {
+			return r, true
+		}
+
+		if f.isActive() {
+			f.close()
+			rl.SetPrompt(printPrompt())
+		} else {
+			f.open()
+			rl.SetPrompt(finderPrompt())
+		}
+		return r, false
+
+	case readline.CharPrev, readline.CharNext:
+		if !f.isActive() {
+			return r, true
+		}
+		f.Lock()
+		if r == readline.CharPrev && f.selected > 0 {
+			f.selected--
+		}
+		if r == readline.CharNext && f.selected < len(f.matches)-1 && f.selected < finderRows-1 {
+			f.selected++
+		}
+		f.Unlock()
+		return r, false
+
+	case readline.CharBell:
+		if !f.isActive() {
+			return r, true
+		}
+		f.close()
+		rl.SetPrompt(printPrompt())
+		return r, false
+	}
+
+	return r, true
+}
+
+// Paint implements the readline.Painter interface
+// while the finder is open, the matches for the line are painted below it
+func (f *fuzzyFinder) Paint(line []rune, pos int) []rune {
+
+	f.Lock()
+	defer f.Unlock()
+
+	// the line is submitted
+	if !f.active || len(line) > 0 && line[len(line)-1] == '\n' {
+		return line
+	}
+
+	if query := string(line); query != f.query || f.matches == nil {
+		f.query, f.matches, f.selected = query, fuzzyFind(query, f.items), 0
+	}
+
+	var (
+		b     strings.Builder
+		width = terminalWidth() - 4
+	)
+
+	// save the cursor, paint the rows and restore it
+	b.WriteString("\0337")
+	for i := 0; i < finderRows; i++ {
+		b.WriteString("\r\n\033[2K")
+		if i >= len(f.matches) {
+			if i == 0 {
+				b.WriteString(cp.Text + "  no matches" + cp.Reset)
+			}
+			continue
+		}
+		m := f.matches[i]
+		if i == f.selected {
+			b.WriteString(cp.Prompt + marker("❯ ", "> "))
+		} else {
+			b.WriteString("  ")
+		}
+		b.WriteString(cp.CmdName + m.name + cp.Reset)
+		if m.description != "" && width-len(m.name)-2 > 0 {
+			b.WriteString("  " + cp.Text + truncate(m.description, width-len(m.name)-2) + cp.Reset)
+		}
+	}
+	b.WriteString("\0338")
+
+	return append(append([]rune{}, line...), []rune(b.String())...)
+}
+
+// find [<query>]
+// in the interactive shell the finder opens with the query, otherwise the matches are printed
+func handleFindCommand(args []string) {
+
+	query := strings.Join(args[1:], " ")
+
+	readlineMutex.Lock()
+	shell := rl != nil
+	readlineMutex.Unlock()
+
+	if shell {
+		finder.open()
+		finder.Lock()
+		finder.pending = query
+		finder.Unlock()
+		return
+	}
+
+	matches := fuzzyFind(query, finderItems())
+	if len(matches) == 0 {
+		l.Println("no matches for " + query)
+		return
+	}
+
+	width := minNameWidth
+	for _, m := range matches {
+		if len(m.name) > width {
+			width = len(m.name)
+		}
+	}
+	for _, m := range matches {
+		l.Println(cp.CmdName + pad(m.name, width+2) + cp.Text + m.description + cp.Reset)
+	}
+}
@@ -19,72 +19,225 @@
 package main
 
 import (
+	"bytes"
 	"errors"
+	"io/ioutil"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
 )
 
-// generic formatter type
-type formatter struct {
-	language *Language
+const formatFlagCheck = "--check"
+
+var (
+	// ErrUnformattedScripts means the check of the formatters found scripts that are not formatted
+	ErrUnformattedScripts = errors.New("scripts are not formatted")
+
+	// ErrFormatterNotFound means the formatter configured for a language is not installed
+	ErrFormatterNotFound = errors.New("formatter not found")
+)
 
-	// path to binary
-	binPath string
+// formatter runs the formatters of the languages over the scripts in the zeus directory
+type formatter struct {
+	// formatters that are not installed, reported only once
+	missing map[string]bool
+	sync.Mutex
 }
 
-// initialize the formatter to handle shell scripts
-func newFormatter(path string, l *Language) *formatter {
+func newFormatter() *formatter {
 	return &formatter{
-		language: l,
-		binPath:  path,
+		missing: make(map[string]bool),
+	}
+}
+
+func printFormatCommandUsageErr() {
+	l.Println(ErrInvalidUsage)
+	l.Println("usage: format [" + formatTargetCommandsFile + "] [" + formatFlagCheck + "]")
+}
+
+// the language of the script at path
+// the language of the command for the script, or the first language with the file extension
+func scriptLanguage(path string) *Language {
+
+	cmdMap.Lock()
+	for _, c := range cmdMap.items {
+		if c.path != "" && c.path == path {
+			cmdMap.Unlock()
+			lang, err := c.getLanguage()
+			if err != nil {
+				return nil
+			}
+			return lang
+		}
+	}
+	cmdMap.Unlock()
+
+	ls.Lock()
+	defer ls.Unlock()
+
+	var names []string
+	for name := range ls.items {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if lang := ls.items[name]; lang.FileExtension != "" && filepath.Ext(path) == lang.FileExtension {
+			return lang
+		}
+	}
+	return nil
+}
+
+// check if the formatter of the language is installed
+// formatters that are not found in the PATH are reported once
+func (f *formatter) installed(lang *Language) bool {
+
+	fields := strings.Fields(lang.Formatter)
+	if len(fields) == 0 {
+		return false
 	}
+	if _, err := exec.LookPath(fields[0]); err == nil {
+		return true
+	}
+
+	f.Lock()
+	defer f.Unlock()
+
+	if !f.missing[lang.Formatter] {
+		f.missing[lang.Formatter] = true
+		l.Println(cp.Prompt + "skipping " + lang.Name + " scripts, formatter not found: " + lang.Formatter + cp.Reset)
+	}
+	return false
 }
 
-// format a single shell file on disk
+// run the formatter of the language on the file at path
+func runFormatter(lang *Language, path string) error {
+	out, err := exec.Command("sh", "-c", lang.Formatter+" "+shellQuote(path)).CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return errors.New(msg)
+		}
+		return err
+	}
+	return nil
+}
+
+// format a single script on disk
 func (f *formatter) formatPath(path string) error {
 
 	var cLog = Log.WithField("prefix", "formatPath")
+
+	lang := scriptLanguage(path)
+	if lang == nil || lang.Formatter == "" {
+		return nil
+	}
+	if !f.installed(lang) {
+		return ErrFormatterNotFound
+	}
+
 	cLog.Debug("formatting: ", path)
-	return nil
+	return runFormatter(lang, path)
+}
+
+// check if a single script on disk is formatted, without changing it
+// the formatter runs on a temporary copy of the script
+func (f *formatter) checkPath(path string) (formatted bool, err error) {
+
+	lang := scriptLanguage(path)
+	if lang == nil || lang.Formatter == "" {
+		return true, nil
+	}
+	if !f.installed(lang) {
+		return true, ErrFormatterNotFound
+	}
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+
+	dir, err := ioutil.TempDir("", "zeus-format")
+	if err != nil {
+		return false, err
+	}
+	defer os.RemoveAll(dir)
+
+	// keep the name, formatters detect the language from the extension
+	tmp := filepath.Join(dir, filepath.Base(path))
+	err = ioutil.WriteFile(tmp, contents, 0600)
+	if err != nil {
+		return false, err
+	}
+
+	err = runFormatter(lang, tmp)
+	if err != nil {
+		return false, err
+	}
+
+	result, err := ioutil.ReadFile(tmp)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(contents, result), nil
 }
 
-// walk the zeus directory and run formatPath on all files
-func (f *formatter) formatzeusDir() error {
+// walk the script directory and format all scripts
+// in check mode the scripts are not changed and the unformatted ones are returned
+func (f *formatter) formatzeusDir(check bool) (unformatted []string, err error) {
 
 	var cLog = Log.WithField("prefix", "formatzeusDir")
 
 	info, err := os.Stat(scriptDir)
 	if err != nil {
 		cLog.WithError(err).Error("path does not exist")
-		return err
+		return nil, err
 	}
 	if !info.IsDir() {
-		return errors.New("scriptDir path is not a directory")
+		return nil, errors.New("scriptDir path is not a directory")
 	}
 
-	return filepath.Walk(scriptDir, func(path string, info os.FileInfo, err error) error {
+	err = filepath.Walk(scriptDir, func(path string, info os.FileInfo, err error) error {
+
+		if err != nil {
+			cLog.WithError(err).Error("error walking zeus directory")
+			return err
+		}
 
-		// no recursion for now
 		if info.IsDir() {
+			// skip the temporary scripts
+			if info.Name() == ".tmp" {
+				return filepath.SkipDir
+			}
 			return nil
 		}
 
-		if err != nil {
-			cLog.WithError(err).Error("error walking zeus directory")
-			return err
+		if check {
+			formatted, err := f.checkPath(path)
+			if err != nil && err != ErrFormatterNotFound {
+				cLog.WithError(err).Error("failed to check path: " + path)
+				return err
+			}
+			if !formatted {
+				unformatted = append(unformatted, path)
+			}
+			return nil
 		}
 
 		err = f.formatPath(path)
-		if err != nil && !os.IsNotExist(err) {
+		if err != nil && err != ErrFormatterNotFound && !os.IsNotExist(err) {
 			cLog.WithError(err).Error("failed to format path: " + path)
 			return err
 		}
 		return nil
 	})
+	return unformatted, err
 }
 
 /*
@@ -100,21 +253,58 @@ func empty(f *os.File) error {
 	return err
 }
 
-// run the formatter for all files in the zeus dir
+// handle the format builtin
+// runs the formatters for all scripts in the zeus dir, or checks them with the --check flag
+// formats the CommandsFile instead, when it is selected
 // calculates runtime and displays error
-func (f *formatter) formatCommand() {
+func (f *formatter) formatCommand(args []string) error {
 
-	var (
-		start = time.Now()
-		err   = f.formatzeusDir()
-	)
+	var check, commandsFile bool
+	for _, arg := range args[1:] {
+		switch {
+		case arg == formatFlagCheck && !check:
+			check = true
+		case arg == formatTargetCommandsFile && !commandsFile:
+			commandsFile = true
+		default:
+			printFormatCommandUsageErr()
+			return ErrInvalidUsage
+		}
+	}
+
+	if commandsFile {
+		err := formatCommandsFileOnDisk(check)
+		if err != nil && err != ErrUnformattedCommandsFile {
+			l.Println("error formatting: ", err)
+		}
+		return err
+	}
+
+	var start = time.Now()
+
+	unformatted, err := f.formatzeusDir(check)
 	if err != nil {
 		l.Println("error formatting: ", err)
+		return err
+	}
+
+	if !check {
+		l.Println(printPrompt()+"formatted zeus directory in ", formatDuration(time.Now().Sub(start)))
+		return nil
 	}
-	l.Println(printPrompt()+"formatted zeus directory in ", time.Now().Sub(start))
+
+	if len(unformatted) == 0 {
+		l.Println(printPrompt()+"all scripts are formatted, checked in ", formatDuration(time.Now().Sub(start)))
+		return nil
+	}
+	for _, path := range unformatted {
+		l.Println(cp.Text + "not formatted: " + cp.Prompt + path + cp.Reset)
+	}
+	return ErrUnformattedScripts
 }
 
-// watch the zeus dir changes and run format on write event
+// watch the script dir for changes
+// written scripts are formatted and linted if configured, changed commands are reloaded
 func (f *formatter) watchScriptDir(eventID string) {
 
 	// dont add a new watcher when the event exists
@@ -127,20 +317,37 @@ func (f *formatter) watchScriptDir(eventID string) {
 	}
 	projectData.Unlock()
 
-	err := addEvent(newEvent(scriptDir, fsnotify.Write, "formatter watcher", "", eventID, "internal", func(event fsnotify.Event) {
+	op := fsnotify.Write | fsnotify.Create | fsnotify.Remove | fsnotify.Rename
+
+	err := addEvent(newEvent(scriptDir, op, "formatter watcher", "", eventID, "internal", func(event fsnotify.Event) {
+
+		// reload the command when the script is complete
+		defer reloadScript(event.Name)
+
+		if event.Op&fsnotify.Write == 0 {
+			return
+		}
+
+		conf.Lock()
+		autoFormat, lint := conf.fields.AutoFormat, conf.fields.LintOnSave
+		conf.Unlock()
 
-		// check if its a valid script
-		if strings.HasSuffix(event.Name, ".sh") {
+		// check if its a script with a formatter
+		if lang := scriptLanguage(event.Name); autoFormat && lang != nil && lang.Formatter != "" {
 
 			// ignore further WRITE events while formatting a script
 			blockWriteEvent()
 
 			// format script
 			err := f.formatPath(event.Name)
-			if err != nil {
+			if err != nil && err != ErrFormatterNotFound {
 				Log.WithError(err).Error("failed to format file")
 			}
 		}
+
+		if lint {
+			lintOnSave(event.Name)
+		}
 	}))
 	if err != nil {
 		Log.Error("failed to watch path: ", scriptDir)
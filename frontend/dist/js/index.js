@@ -1,2 +1,164 @@
-$(document).ready(function(){$('#btn-wiki').click(function(){window.open("/wiki","_blank");});$('#btn-scripts').click(function(){window.open("/scripts","_blank");});$('#btn-config').click(function(){console.log("toggle config panel");});$('#btn-quit').click(function(){window.location="/quit";setTimeout(function(){window.close();},1000);});var socket=glue();socket.onMessage(function(data){console.log("onMessage: "+data);});socket.on("connected",function(){console.log("connected");});socket.on("connecting",function(){console.log("connecting");});socket.on("disconnected",function(){console.log("disconnected");});socket.on("reconnecting",function(){console.log("reconnecting");});socket.on("error",function(e,msg){console.log("error: "+msg);});socket.on("connect_timeout",function(){console.log("connect_timeout");});socket.on("timeout",function(){console.log("timeout");});socket.on("discard_send_buffer",function(){console.log("some data could not be send and was discarded.");});});function spinnerON(){$('#main-spinner').toggle(true);}
-function spinnerOFF(){$('#main-spinner').toggle(false);}
\ No newline at end of file
+$(document).ready(function() {
+$('#btn-wiki').click(function() {
+window.open("/wiki", "_blank");
+});
+$('#btn-scripts').click(function() {
+window.open("/scripts", "_blank");
+});
+$('#btn-config').click(function() {
+console.log("toggle config panel");
+});
+$('#btn-db').click(function() {
+loadCommands();
+});
+$('#btn-clear').click(function() {
+$('#output').empty();
+});
+$('#btn-quit').click(function() {
+window.location = "/quit";
+setTimeout(function() {
+window.close();
+}, 1000);
+});
+var socket = glue();
+socket.onMessage(function(data) {
+var msg;
+try {
+msg = JSON.parse(data);
+} catch (e) {
+console.log("onMessage: " + data);
+return;
+}
+switch (msg.type) {
+case "output":
+appendOutput(msg.command, msg.stream, msg.line);
+break;
+case "started":
+appendOutput(msg.command, "status", "started");
+loadProcs();
+break;
+case "finished":
+if (msg.error) {
+appendOutput(msg.command, "stderr", "failed: " + msg.error);
+} else {
+appendOutput(msg.command, "status", "finished");
+}
+loadProcs();
+break;
+}
+});
+socket.on("connected", function() {
+console.log("connected");
+});
+socket.on("connecting", function() {
+console.log("connecting");
+});
+socket.on("disconnected", function() {
+console.log("disconnected");
+});
+socket.on("reconnecting", function() {
+console.log("reconnecting");
+});
+socket.on("error", function(e, msg) {
+console.log("error: " + msg);
+});
+socket.on("connect_timeout", function() {
+console.log("connect_timeout");
+});
+socket.on("timeout", function() {
+console.log("timeout");
+});
+socket.on("discard_send_buffer", function() {
+console.log("some data could not be send and was discarded.");
+});
+loadCommands();
+loadProcs();
+setInterval(loadProcs, 3000);
+});
+function loadCommands() {
+$.getJSON("/api/commands", function(commands) {
+var list = $('#commands').empty();
+$.each(commands, function(i, cmd) {
+var form = $('<form class="pure-form command"></form>');
+form.append($('<div class="command-name"></div>').text(cmd.name));
+if (cmd.description) {
+form.append($('<div class="command-description"></div>').text(cmd.description));
+}
+$.each(cmd.arguments, function(j, arg) {
+var input;
+if (arg.type === "Bool") {
+input = $('<select></select>');
+if (arg.optional) {
+input.append($('<option value=""></option>'));
+}
+input.append($('<option>true</option>'), $('<option>false</option>'));
+} else {
+input = $('<input type="text">');
+input.attr("placeholder", arg.name + ":" + arg.type + (arg.optional ? "?" : ""));
+}
+input.attr("name", arg.name);
+input.attr("title", arg.name + ":" + arg.type);
+input.prop("required", !arg.optional);
+if (arg.default) {
+input.val(arg.default);
+}
+form.append(input);
+});
+form.append($('<button type="submit" class="zeus-button">RUN</button>'));
+form.submit(function(e) {
+e.preventDefault();
+runCommand(cmd.name, form);
+});
+list.append(form);
+});
+});
+}
+function runCommand(name, form) {
+var args = {};
+form.find("input, select").each(function() {
+args[$(this).attr("name")] = $(this).val();
+});
+$.ajax({
+url: "/api/run",
+method: "POST",
+contentType: "application/json",
+data: JSON.stringify({
+command: name,
+arguments: args
+}),
+error: function(xhr) {
+appendOutput(name, "stderr", xhr.responseJSON ? xhr.responseJSON.error : xhr.statusText);
+}
+});
+}
+function appendOutput(command, stream, line) {
+var out = $('#output');
+out.append($('<span></span>').addClass(stream).text("[" + command + "] " + line + "\n"));
+out.scrollTop(out[0].scrollHeight);
+}
+function loadProcs() {
+$.getJSON("/api/procs", function(procs) {
+var body = $('#procs tbody').empty();
+$.each(procs, function(i, p) {
+var kill = $('<button class="zeus-button">KILL</button>').click(function() {
+$.ajax({
+url: "/api/procs/" + p.pid + "/kill",
+method: "POST",
+contentType: "application/json",
+complete: loadProcs
+});
+});
+body.append($('<tr></tr>').append(
+$('<td></td>').text(p.name),
+$('<td></td>').text(p.pid),
+$('<td></td>').append(kill)
+));
+});
+});
+}
+function spinnerON() {
+$('#main-spinner').toggle(true);
+}
+function spinnerOFF() {
+$('#main-spinner').toggle(false);
+}
@@ -30,6 +30,14 @@ $(document).ready(function() {
         console.log("toggle config panel");
     });
 
+    $('#btn-db').click(function() {
+        loadCommands();
+    });
+
+    $('#btn-clear').click(function() {
+        $('#output').empty();
+    });
+
     $('#btn-quit').click(function() {
         window.location = "/quit";
         setTimeout(function() {
@@ -42,7 +50,32 @@ $(document).ready(function() {
     var socket = glue();
 
     socket.onMessage(function(data) {
-        console.log("onMessage: " + data);
+
+        var msg;
+        try {
+            msg = JSON.parse(data);
+        } catch (e) {
+            console.log("onMessage: " + data);
+            return;
+        }
+
+        switch (msg.type) {
+            case "output":
+                appendOutput(msg.command, msg.stream, msg.line);
+                break;
+            case "started":
+                appendOutput(msg.command, "status", "started");
+                loadProcs();
+                break;
+            case "finished":
+                if (msg.error) {
+                    appendOutput(msg.command, "stderr", "failed: " + msg.error);
+                } else {
+                    appendOutput(msg.command, "status", "finished");
+                }
+                loadProcs();
+                break;
+        }
     });
 
     socket.on("connected", function() {
@@ -76,8 +109,118 @@ $(document).ready(function() {
     socket.on("discard_send_buffer", function() {
         console.log("some data could not be send and was discarded.");
     });
+
+    loadCommands();
+    loadProcs();
+
+    // async commands are not reported over the socket, poll for them
+    setInterval(loadProcs, 3000);
 });
 
+// fetch all commands and render a form for each of them
+function loadCommands() {
+    $.getJSON("/api/commands", function(commands) {
+
+        var list = $('#commands').empty();
+
+        $.each(commands, function(i, cmd) {
+
+            var form = $('<form class="pure-form command"></form>');
+            form.append($('<div class="command-name"></div>').text(cmd.name));
+
+            if (cmd.description) {
+                form.append($('<div class="command-description"></div>').text(cmd.description));
+            }
+
+            $.each(cmd.arguments, function(j, arg) {
+
+                var input;
+                if (arg.type === "Bool") {
+                    input = $('<select></select>');
+                    if (arg.optional) {
+                        input.append($('<option value=""></option>'));
+                    }
+                    input.append($('<option>true</option>'), $('<option>false</option>'));
+                } else {
+                    input = $('<input type="text">');
+                    input.attr("placeholder", arg.name + ":" + arg.type + (arg.optional ? "?" : ""));
+                }
+
+                input.attr("name", arg.name);
+                input.attr("title", arg.name + ":" + arg.type);
+                input.prop("required", !arg.optional);
+                if (arg.default) {
+                    input.val(arg.default);
+                }
+                form.append(input);
+            });
+
+            form.append($('<button type="submit" class="zeus-button">RUN</button>'));
+            form.submit(function(e) {
+                e.preventDefault();
+                runCommand(cmd.name, form);
+            });
+
+            list.append(form);
+        });
+    });
+}
+
+// trigger a run, the output arrives over the socket
+function runCommand(name, form) {
+
+    var args = {};
+    form.find("input, select").each(function() {
+        args[$(this).attr("name")] = $(this).val();
+    });
+
+    $.ajax({
+        url: "/api/run",
+        method: "POST",
+        contentType: "application/json",
+        data: JSON.stringify({
+            command: name,
+            arguments: args
+        }),
+        error: function(xhr) {
+            appendOutput(name, "stderr", xhr.responseJSON ? xhr.responseJSON.error : xhr.statusText);
+        }
+    });
+}
+
+// append a line to the output screen
+function appendOutput(command, stream, line) {
+    var out = $('#output');
+    out.append($('<span></span>').addClass(stream).text("[" + command + "] " + line + "\n"));
+    out.scrollTop(out[0].scrollHeight);
+}
+
+// fetch the running processes and render them with a kill button
+function loadProcs() {
+    $.getJSON("/api/procs", function(procs) {
+
+        var body = $('#procs tbody').empty();
+
+        $.each(procs, function(i, p) {
+
+            var kill = $('<button class="zeus-button">KILL</button>').click(function() {
+                $.ajax({
+                    url: "/api/procs/" + p.pid + "/kill",
+                    method: "POST",
+                    contentType: "application/json",
+                    complete: loadProcs
+                });
+            });
+
+            body.append($('<tr></tr>').append(
+                $('<td></td>').text(p.name),
+                $('<td></td>').text(p.pid),
+                $('<td></td>').append(kill)
+            ));
+        });
+    });
+}
+
 // show spinner
 function spinnerON() {
     $('#main-spinner').toggle(true);
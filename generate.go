@@ -24,7 +24,6 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
-	"time"
 )
 
 // Generate a standalone version of a single command or commandChain.
@@ -46,6 +45,14 @@ func handleGenerateCommand(args []string) {
 		outputName = zeusDir + "/generated/" + args[1]
 	)
 
+	// the generated scripts call each other one after another
+	for _, step := range args[2:] {
+		if strings.Contains(step, commandChainParallel) || strings.Contains(step, commandChainFallback) {
+			l.Println("generate does not support the " + commandChainParallel + " and " + commandChainFallback + " operators")
+			return
+		}
+	}
+
 	// check if its a valid command chain
 	if chain, ok = validCommandChain(args[2:]); !ok {
 		l.Println("invalid command chain")
@@ -88,7 +95,11 @@ func handleGenerateCommand(args []string) {
 		}
 
 		f.WriteString("#!/bin/bash\n\n")
-		f.WriteString("# generated by ZEUS v" + version + " @ " + time.Now().String() + "\n")
+		if reproducible() {
+			f.WriteString("# generated by ZEUS v" + version + "\n")
+		} else {
+			f.WriteString("# generated by ZEUS v" + version + " @ " + artifactTime().String() + "\n")
+		}
 		f.WriteString("# commandChain: " + strings.Join(args[2:], " ") + "\n")
 		f.WriteString("\n./" + filepath.Base(chain[0].path) + "\n")
 		f.Close()
@@ -163,12 +174,14 @@ func generateScript(outputName string, mixed bool, cmd *command, args []string)
 	}
 
 	header := lang.Comment + " generated by ZEUS v" + version + "\n"
-	header += lang.Comment + " Timestamp: " + time.Now().Format(timestampFormat) + "\n"
+	if !reproducible() {
+		header += lang.Comment + " Timestamp: " + artifactTime().Format(timestampFormat) + "\n"
+	}
 
 	// insert bang and args
 	f.WriteString(lang.Bang + "\n" + header + "\n" + arguments + "\n")
 
-	f.WriteString(generateGlobals(lang))
+	f.WriteString(generateGlobals(lang, cmd))
 
 	// add language specific global code
 	code, err := ioutil.ReadFile(zeusDir + "/globals/globals" + lang.FileExtension)
@@ -0,0 +1,328 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// gitHookMarker identifies hook shims generated by zeus
+// hooks without the marker are never modified or removed
+const gitHookMarker = "# generated by zeus"
+
+var (
+	// ErrUnknownGitHook occurs when the hooks section contains a name that is not a git hook
+	ErrUnknownGitHook = errors.New("unknown git hook")
+
+	// ErrNotAGitRepository occurs when the githooks builtin is used outside of a git repository
+	ErrNotAGitRepository = errors.New("not a git repository")
+
+	// client side hooks supported by git
+	gitHookNames = []string{
+		"applypatch-msg",
+		"pre-applypatch",
+		"post-applypatch",
+		"pre-commit",
+		"prepare-commit-msg",
+		"commit-msg",
+		"post-commit",
+		"pre-rebase",
+		"post-checkout",
+		"post-merge",
+		"pre-push",
+		"post-rewrite",
+	}
+
+	// hooks declared in the CommandsFile
+	gitHooks = &gitHookMap{
+		items: make(map[string]string, 0),
+	}
+)
+
+// gitHookMap maps git hook names to commandChains
+type gitHookMap struct {
+	items map[string]string
+	sync.Mutex
+}
+
+func printGitHooksUsageErr() {
+	l.Println(ErrInvalidUsage)
+	l.Println("usage: githooks [install | uninstall]")
+}
+
+// set the hooks declared in the CommandsFile
+// installed shims are updated to match the new declarations
+func initGitHooks(hooks map[string]string) error {
+
+	for name, chain := range hooks {
+		if !isGitHook(name) {
+			return errors.New(ErrUnknownGitHook.Error() + ": " + name)
+		}
+		for _, step := range strings.Split(chain, commandChainSeparator) {
+			elems, _, err := parseChainStep(step)
+			if err != nil {
+				return errors.New("hook " + name + ": " + err.Error())
+			}
+			for _, elem := range elems {
+				fields := strings.Fields(elem)
+				if len(fields) == 0 {
+					return errors.New("hook " + name + ": empty command in commandChain: " + chain)
+				}
+				if _, ok := cmdMap.items[fields[0]]; !ok {
+					return errors.New("hook " + name + ": " + ErrUnknownCommand.Error() + ": " + fields[0])
+				}
+			}
+		}
+	}
+
+	if hooks == nil {
+		hooks = make(map[string]string, 0)
+	}
+
+	gitHooks.Lock()
+	gitHooks.items = hooks
+	gitHooks.Unlock()
+
+	// keep installed shims up to date
+	dir, err := gitHooksDir()
+	if err != nil {
+		return nil
+	}
+	if len(installedGitHooks(dir)) > 0 {
+		return installGitHooks()
+	}
+
+	return nil
+}
+
+func isGitHook(name string) bool {
+	for _, n := range gitHookNames {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// handle the githooks builtin
+func handleGitHooksCommand(args []string) {
+
+	switch len(args) {
+	case 1:
+		printGitHooks()
+	case 2:
+		var err error
+		switch args[1] {
+		case "install":
+			err = installGitHooks()
+		case "uninstall":
+			err = uninstallGitHooks()
+		default:
+			printGitHooksUsageErr()
+			return
+		}
+		if err != nil {
+			l.Println(err)
+			return
+		}
+		printGitHooks()
+	default:
+		printGitHooksUsageErr()
+	}
+}
+
+// determine the hooks directory of the repository
+// respects core.hooksPath and worktrees
+func gitHooksDir() (string, error) {
+	if _, ok := projectVCS().(gitVCS); !ok {
+		return "", ErrNotAGitRepository
+	}
+	out, err := exec.Command("git", "rev-parse", "--git-path", "hooks").Output()
+	if err != nil {
+		return "", ErrNotAGitRepository
+	}
+	dir := strings.TrimSpace(string(out))
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(workingDir, dir)
+	}
+	return dir, nil
+}
+
+// path of the project directory relative to the repository root
+func gitProjectPrefix() string {
+	out, err := exec.Command("git", "rev-parse", "--show-prefix").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// names of the hooks in dir that have been generated by zeus
+func installedGitHooks(dir string) (names []string) {
+	for _, name := range gitHookNames {
+		if isZeusGitHook(filepath.Join(dir, name)) {
+			names = append(names, name)
+		}
+	}
+	return
+}
+
+func isZeusGitHook(path string) bool {
+	c, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	return strings.Contains(string(c), gitHookMarker)
+}
+
+// generate the shim script for a hook
+// git runs hooks from the repository root, so the shim changes into the project directory first
+// the arguments git passes to the hook are available in ZEUS_GIT_HOOK_ARGS
+func gitHookShim(name, chain, prefix string) string {
+
+	var invocation string
+	if strings.Contains(chain, commandChainSeparator) || strings.Contains(chain, commandChainParallel) || strings.Contains(chain, commandChainFallback) {
+		invocation = shellQuote(chain)
+	} else {
+		for i, f := range strings.Fields(chain) {
+			if i > 0 {
+				invocation += " "
+			}
+			invocation += shellQuote(f)
+		}
+	}
+
+	return "#!/bin/sh\n" +
+		gitHookMarker + " - edit the hooks section of the CommandsFile instead\n" +
+		"export ZEUS_GIT_HOOK=" + shellQuote(name) + "\n" +
+		"export ZEUS_GIT_HOOK_ARGS=\"$*\"\n" +
+		"cd \"$(git rev-parse --show-toplevel)\"/" + shellQuote(prefix) + " || exit 1\n" +
+		"exec zeus " + invocation + "\n"
+}
+
+// quote s for use in a POSIX shell
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// write shims for all declared hooks and remove generated shims that are no longer declared
+// hooks that have not been generated by zeus are left untouched
+func installGitHooks() error {
+
+	dir, err := gitHooksDir()
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return err
+	}
+
+	prefix := gitProjectPrefix()
+
+	gitHooks.Lock()
+	defer gitHooks.Unlock()
+
+	for name, chain := range gitHooks.items {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil && !isZeusGitHook(path) {
+			Log.Warn("skipping hook " + name + ": " + path + " was not generated by zeus")
+			continue
+		}
+		err = writeFileAtomic(path, []byte(gitHookShim(name, chain, prefix)), 0755)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, name := range installedGitHooks(dir) {
+		if _, ok := gitHooks.items[name]; !ok {
+			err = os.Remove(filepath.Join(dir, name))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// remove all shims generated by zeus
+func uninstallGitHooks() error {
+
+	dir, err := gitHooksDir()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range installedGitHooks(dir) {
+		err = os.Remove(filepath.Join(dir, name))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// print the declared hooks and their installation status
+func printGitHooks() {
+
+	dir, err := gitHooksDir()
+	if err != nil {
+		l.Println(err)
+		return
+	}
+
+	gitHooks.Lock()
+	defer gitHooks.Unlock()
+
+	if len(gitHooks.items) == 0 {
+		l.Println("no hooks declared in the CommandsFile")
+		return
+	}
+
+	var names []string
+	for name := range gitHooks.items {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w := 20
+	l.Println(cp.Prompt + pad("hook", w) + pad("status", 15) + "commandChain" + cp.Text)
+	for _, name := range names {
+		var (
+			path   = filepath.Join(dir, name)
+			status = "not installed"
+		)
+		if isZeusGitHook(path) {
+			status = "installed"
+		} else if _, err := os.Stat(path); err == nil {
+			status = "foreign"
+		}
+		l.Println(pad(name, w) + pad(status, 15) + gitHooks.items[name])
+	}
+}
@@ -19,9 +19,61 @@
 package main
 
 import (
+	"bytes"
+	"errors"
 	"io/ioutil"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
+	"text/template"
+)
+
+// types of global variables, taken from the YAML values
+const (
+	globalTypeString = "string"
+	globalTypeBool   = "bool"
+	globalTypeInt    = "int"
+	globalTypeFloat  = "float"
+)
+
+// when dynamic globals are evaluated for the first time
+const (
+	// dynamicGlobalsLazy evaluates dynamic globals when a command referencing them is run
+	dynamicGlobalsLazy = "lazy"
+
+	// dynamicGlobalsStartup evaluates dynamic globals after parsing the CommandsFile
+	dynamicGlobalsStartup = "startup"
+
+	// start of a command substitution, globals containing it are dynamic
+	commandSubstitution = "$("
+
+	// start of a template action, globals containing it are dynamic
+	templateAction = "{{"
+)
+
+var (
+	// ErrUnsupportedGlobalType means a global is neither a string, number nor boolean
+	ErrUnsupportedGlobalType = errors.New("unsupported type, use a string, number or boolean")
+
+	// ErrCyclicGlobal means globals reference each other
+	ErrCyclicGlobal = errors.New("cyclic reference between globals")
+
+	// reference to another global or an environment variable: ${NAME}
+	globalReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+	// functions for the templates of dynamic globals
+	globalFuncs = template.FuncMap{
+		"sh":        shellOutput,
+		"env":       os.Getenv,
+		"gitSHA":    func() (string, error) { return projectVCS().revision() },
+		"gitBranch": func() (string, error) { return projectVCS().branch() },
+		"timestamp": func() int64 { return artifactTime().Unix() },
+		"date":      func(layout string) string { return artifactTime().Format(layout) },
+	}
 )
 
 type globals struct {
@@ -29,27 +81,418 @@ type globals struct {
 	// mapped variable names to values
 	Vars map[string]string
 
+	// mapped variable names to their types
+	// the type of variables without one is detected from the value
+	types map[string]string
+
 	sync.RWMutex
 }
 
+// results of the dynamic globals, by value
+// the values are cached for a single invocation, so every snippet runs only once
+type substitutionCache struct {
+	values map[string]string
+	sync.Mutex
+}
+
+var substitutions = &substitutionCache{
+	values: make(map[string]string),
+}
+
+// check if the value of a global contains a command substitution or a template
+func isDynamic(value string) bool {
+	return strings.Contains(value, commandSubstitution) || strings.Contains(value, templateAction)
+}
+
+// run a snippet with the shell and return its output without the trailing newline
+func shellOutput(snippet string) (string, error) {
+
+	var (
+		stderr bytes.Buffer
+		cmd    = exec.Command("/bin/sh", "-c", snippet)
+	)
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", errors.New(err.Error() + ": " + msg)
+		}
+		return "", err
+	}
+	return strings.TrimRight(string(out), "\n"), nil
+}
+
+// execute the template actions of a value, values without one are returned unchanged
+func renderTemplate(value string) (string, error) {
+
+	if !strings.Contains(value, templateAction) {
+		return value, nil
+	}
+
+	t, err := template.New("global").Funcs(globalFuncs).Option("missingkey=error").Parse(value)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	if err := t.Execute(&b, nil); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// evaluate a dynamic value, other values are returned unchanged
+// template actions are executed first, command substitutions are evaluated with the shell afterwards
+// fails if the template or the command substitution failed
+func (sc *substitutionCache) eval(value string) (string, error) {
+
+	if !isDynamic(value) {
+		return value, nil
+	}
+
+	sc.Lock()
+	defer sc.Unlock()
+
+	if v, ok := sc.values[value]; ok {
+		return v, nil
+	}
+
+	out, err := renderTemplate(value)
+	if err != nil {
+		return "", err
+	}
+
+	if strings.Contains(out, commandSubstitution) {
+		// the assignment fails with the status of the command substitution
+		out, err = shellOutput(`value="` + out + `" && printf '%s' "$value"`)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	sc.values[value] = out
+	return out, nil
+}
+
+// return the result of a dynamic value, if it was evaluated already
+func (sc *substitutionCache) cached(value string) (string, bool) {
+	sc.Lock()
+	defer sc.Unlock()
+	v, ok := sc.values[value]
+	return v, ok
+}
+
+// return the result of a dynamic value
+// if it cannot be evaluated, the value is returned unchanged
+func (sc *substitutionCache) expand(value string) string {
+	if v, err := sc.eval(value); err == nil {
+		return v
+	}
+	return value
+}
+
+// forget the results, the dynamic globals are evaluated again for the next invocation
+func (sc *substitutionCache) reset() {
+	sc.Lock()
+	sc.values = make(map[string]string)
+	sc.Unlock()
+}
+
+// the globals the command is run with
+// in lazy mode, dynamic globals the command does not reference are left out, so they are never evaluated
+func (c *command) globals(vars map[string]string) map[string]string {
+
+	conf.Lock()
+	lazy := conf.fields.DynamicGlobals != dynamicGlobalsStartup
+	conf.Unlock()
+
+	if !lazy {
+		return vars
+	}
+
+	var source string
+	used := make(map[string]string, len(vars))
+	for name, value := range vars {
+		if !isDynamic(value) {
+			used[name] = value
+			continue
+		}
+		if source == "" {
+			source = c.source()
+		}
+		if referencesName(source, name) {
+			used[name] = value
+		}
+	}
+	return used
+}
+
+// the code that can reference globals: the script, the global code and the env of the command
+func (c *command) source() string {
+
+	var b strings.Builder
+
+	if c.exec != "" {
+		b.WriteString(c.exec)
+	} else if c.path != "" {
+		code, _ := ioutil.ReadFile(c.path)
+		b.Write(code)
+	}
+
+	if lang, err := c.getLanguage(); err == nil {
+		code, _ := ioutil.ReadFile(zeusDir + "/globals/globals" + lang.FileExtension)
+		b.Write(code)
+	}
+
+	for _, value := range c.env {
+		b.WriteString("\n" + value)
+	}
+	return b.String()
+}
+
+// check if the text contains the name as a whole identifier
+func referencesName(text, name string) bool {
+
+	isIdent := func(r byte) bool {
+		return r == '_' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z'
+	}
+
+	for i := strings.Index(text, name); i >= 0; {
+		end := i + len(name)
+		if (i == 0 || !isIdent(text[i-1])) && (end == len(text) || !isIdent(text[end])) {
+			return true
+		}
+		next := strings.Index(text[i+1:], name)
+		if next < 0 {
+			break
+		}
+		i += next + 1
+	}
+	return false
+}
+
+// evaluate all dynamic values of the given globals
+func evaluateGlobals(vars map[string]string) error {
+	for _, name := range sortedKeys(vars) {
+		if _, err := substitutions.eval(vars[name]); err != nil {
+			return errors.New("global " + name + ": " + err.Error())
+		}
+	}
+	return nil
+}
+
+// a global variable as declared in the CommandsFile or in the env of a command
+type globalData struct {
+
+	// the value as written, so 1.10 does not become 1.1
+	text string
+
+	// type of the YAML value
+	typ string
+
+	// the value is stored encrypted in the project data
+	secret bool
+}
+
+// UnmarshalYAML takes the type from the YAML value and keeps the text as written
+func (d *globalData) UnmarshalYAML(unmarshal func(interface{}) error) error {
+
+	var value interface{}
+	if err := unmarshal(&value); err != nil {
+		return err
+	}
+
+	switch value.(type) {
+	case map[interface{}]interface{}:
+		var opts struct {
+			Secret bool `yaml:"secret"`
+		}
+		if err := unmarshal(&opts); err != nil || !opts.Secret {
+			return ErrUnsupportedGlobalType
+		}
+		d.typ, d.secret = globalTypeString, true
+		return nil
+	case nil, string:
+		d.typ = globalTypeString
+	case bool:
+		d.typ = globalTypeBool
+	case int, int64, uint64:
+		d.typ = globalTypeInt
+	case float64:
+		d.typ = globalTypeFloat
+	default:
+		return ErrUnsupportedGlobalType
+	}
+
+	if value == nil {
+		return nil
+	}
+	return unmarshal(&d.text)
+}
+
+// remove the globals marked as secret and return their names
+func splitSecrets(raw map[string]*globalData) (names []string) {
+	for name, d := range raw {
+		if d != nil && d.secret {
+			names = append(names, name)
+			delete(raw, name)
+		}
+	}
+	sort.Strings(names)
+	return
+}
+
+// parse the globals from the CommandsFile or the env of a command
+// references to other globals and environment variables (${NAME}) are resolved,
+// a variable referencing itself refers to the value in base or the environment
+// unknown references are kept, so the shell can still expand them
+func parseGlobals(raw map[string]*globalData, base map[string]string) (vars, types map[string]string, err error) {
+
+	vars = make(map[string]string, len(raw))
+	types = make(map[string]string, len(raw))
+
+	for name, d := range raw {
+		if d == nil {
+			vars[name], types[name] = "", globalTypeString
+			continue
+		}
+		if d.secret {
+			return nil, nil, errors.New("global " + name + ": " + ErrSecretInEnv.Error())
+		}
+		vars[name], types[name] = d.text, d.typ
+	}
+
+	var (
+		resolved = make(map[string]bool, len(vars))
+		visiting = make(map[string]bool)
+		resolve  func(name string) error
+	)
+
+	// lookup a referenced variable outside of the parsed ones
+	outer := func(name string) (string, bool) {
+		if v, ok := base[name]; ok {
+			return v, true
+		}
+		return os.LookupEnv(name)
+	}
+
+	resolve = func(name string) error {
+
+		if resolved[name] {
+			return nil
+		}
+		if visiting[name] {
+			return errors.New(ErrCyclicGlobal.Error() + ": " + name)
+		}
+		visiting[name] = true
+
+		var err error
+		vars[name] = globalReference.ReplaceAllStringFunc(vars[name], func(ref string) string {
+
+			ident := globalReference.FindStringSubmatch(ref)[1]
+
+			if _, ok := vars[ident]; ok && ident != name {
+				if e := resolve(ident); e != nil {
+					err = e
+					return ref
+				}
+				return vars[ident]
+			}
+			if v, ok := outer(ident); ok {
+				return v
+			}
+			return ref
+		})
+		if err != nil {
+			return err
+		}
+
+		visiting[name] = false
+		resolved[name] = true
+		return nil
+	}
+
+	for _, name := range sortedKeys(vars) {
+		if err := resolve(name); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return vars, types, nil
+}
+
+// create the literal for a value in the given language
+// values without a type are detected, booleans and integers are used as they are
+func (lang *Language) literal(value, typ string) string {
+
+	if typ == "" {
+		typ = globalTypeString
+		if _, err := strconv.ParseBool(value); err == nil {
+			return value
+		}
+		if _, err := strconv.ParseInt(value, 10, 0); err == nil {
+			return value
+		}
+	}
+
+	switch typ {
+	case globalTypeBool:
+		if b, _ := strconv.ParseBool(value); b {
+			if lang.BoolTrue != "" {
+				return lang.BoolTrue
+			}
+			return "true"
+		}
+		if lang.BoolFalse != "" {
+			return lang.BoolFalse
+		}
+		return "false"
+	case globalTypeInt, globalTypeFloat:
+		return value
+	default:
+		// shells still expand $(cmd) and $VAR inside double quotes
+		return "\"" + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + "\""
+	}
+}
+
 // print the contents of all globals on stdout
 func listGlobals() {
 
 	g.Lock()
 	defer g.Unlock()
 
-	if len(g.Vars) > 0 {
+	secrets.Lock()
+	secretNames := secrets.names
+	secrets.Unlock()
+
+	if len(g.Vars) > 0 || len(secretNames) > 0 {
 
 		w := 20
 
-		l.Println("\n" + cp.Prompt + pad("name", w) + "value")
-		for name, val := range g.Vars {
-			l.Println(cp.Text+pad(name, w), val)
+		l.Println("\n" + cp.Prompt + pad("name", w) + pad("type", 10) + "value")
+		for _, name := range sortedKeys(g.Vars) {
+			typ := g.types[name]
+			if typ == "" {
+				typ = "-"
+			}
+			l.Println(fitLine(cp.Text + pad(name, w) + pad(typ, 10) + " " + g.Vars[name]))
+		}
+		for _, name := range secretNames {
+			l.Println(cp.Text+pad(name, w)+pad("secret", 10), secretMask)
 		}
 
 		ls.Lock()
 		defer ls.Unlock()
-		for name, lang := range ls.items {
+
+		var names []string
+		for name := range ls.items {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			lang := ls.items[name]
 			code, err := ioutil.ReadFile(zeusDir + "/globals/globals" + lang.FileExtension)
 			if err == nil {
 				l.Println("\n" + cp.Prompt + name)
@@ -62,33 +505,38 @@ func listGlobals() {
 }
 
 // generate global variables for a given language
+// the env of the command, if any, is merged over the project globals
 // returns a string
-func generateGlobals(lang *Language) (out string) {
+func generateGlobals(lang *Language, c *command) string {
 
-	g.Lock()
-	defer g.Unlock()
+	var (
+		vars  = make(map[string]string)
+		types = make(map[string]string)
+	)
 
-	// initialize global variables
-	for name, value := range g.Vars {
+	g.Lock()
+	used := g.Vars
+	if c != nil {
+		used = c.globals(g.Vars)
+	}
+	for name, value := range used {
+		vars[name], types[name] = substitutions.expand(value), g.types[name]
+	}
+	g.Unlock()
 
-		var valString = true
-		// check if its a boolean
-		if _, err := strconv.ParseBool(value); err == nil {
-			// value goot as it is
-			valString = false
-		}
-		// check if its an integer
-		if _, err := strconv.ParseInt(value, 10, 0); err == nil {
-			// value good as it is
-			valString = false
+	if c != nil {
+		for name, value := range c.env {
+			vars[name], types[name] = substitutions.expand(value), c.envTypes[name]
 		}
-		// check if its a string
-		if valString {
-			value = "\"" + value + "\""
-		}
-
-		out += lang.VariableKeyword + name + lang.AssignmentOperator + value + lang.LineDelimiter + "\n"
 	}
 
+	return lang.declare(vars, types)
+}
+
+// declarations of the variables in the language, sorted by name
+func (lang *Language) declare(vars, types map[string]string) (out string) {
+	for _, name := range sortedKeys(vars) {
+		out += lang.VariableKeyword + name + lang.AssignmentOperator + lang.literal(vars[name], types[name]) + lang.LineDelimiter + "\n"
+	}
 	return
 }
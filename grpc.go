@@ -0,0 +1,381 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/dreadl0ck/zeus/rpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	grpcStatus "google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// number of output messages buffered for each stream
+// output is dropped when a client can not keep up, to never block a running command
+const outputListenerBufferSize = 1024
+
+var (
+	// ErrRunNotRunning occurs when a run should be canceled that has already finished
+	ErrRunNotRunning = errors.New("run is not running")
+
+	// output listeners of the gRPC streams
+	outputListeners = &outputListenerStore{
+		items: make(map[chan *dashboardMessage]bool, 0),
+	}
+)
+
+// outputListenerStore delivers the output of all commands to the RunCommand streams
+type outputListenerStore struct {
+	items map[chan *dashboardMessage]bool
+	sync.Mutex
+}
+
+// register a new listener
+func (ls *outputListenerStore) add() chan *dashboardMessage {
+	ch := make(chan *dashboardMessage, outputListenerBufferSize)
+	ls.Lock()
+	ls.items[ch] = true
+	ls.Unlock()
+	return ch
+}
+
+// remove a listener
+func (ls *outputListenerStore) remove(ch chan *dashboardMessage) {
+	ls.Lock()
+	delete(ls.items, ch)
+	ls.Unlock()
+}
+
+// check if there are any listeners
+func (ls *outputListenerStore) active() bool {
+	ls.Lock()
+	defer ls.Unlock()
+	return len(ls.items) > 0
+}
+
+// send a message to all listeners without blocking
+func (ls *outputListenerStore) send(msg *dashboardMessage) {
+	ls.Lock()
+	defer ls.Unlock()
+	for ch := range ls.items {
+		select {
+		case ch <- msg:
+		default:
+		}
+	}
+}
+
+// zeusServer implements the Zeus gRPC service
+type zeusServer struct {
+	rpc.UnimplementedZeusServer
+}
+
+// create a gRPC server, all calls require authentication
+func newGRPCServer() *grpc.Server {
+	srv := grpc.NewServer(
+		grpc.UnaryInterceptor(grpcUnaryAuth),
+		grpc.StreamInterceptor(grpcStreamAuth),
+	)
+	rpc.RegisterZeusServer(srv, &zeusServer{})
+	return srv
+}
+
+// serve the gRPC interface on the portGRPC port
+func serveGRPC() error {
+
+	conf.Lock()
+	addr := ":" + strconv.Itoa(conf.fields.PortGRPC)
+	conf.Unlock()
+
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	showNote("serving gRPC on "+addr, "starting server...")
+	return newGRPCServer().Serve(lis)
+}
+
+// the same rules as for the REST API apply:
+// calls from the local machine to a local authority are always allowed
+// remote calls must supply the apiToken from the config as bearer token in the authorization metadata
+func grpcAuthorized(ctx context.Context) bool {
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for _, v := range md.Get("authorization") {
+			if validAPIToken(strings.TrimPrefix(v, "Bearer ")) {
+				return true
+			}
+		}
+	}
+
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil || !isLoopbackAddr(p.Addr.String()) {
+		return false
+	}
+
+	// the authority must be local as well, like the host of HTTP requests
+	md, _ := metadata.FromIncomingContext(ctx)
+	authority := md.Get(":authority")
+	return len(authority) == 1 && isLoopbackHost(authority[0])
+}
+
+func grpcUnaryAuth(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if !grpcAuthorized(ctx) {
+		return nil, grpcStatus.Error(codes.Unauthenticated, ErrUnauthorized.Error())
+	}
+	return handler(ctx, req)
+}
+
+func grpcStreamAuth(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if !grpcAuthorized(ss.Context()) {
+		return grpcStatus.Error(codes.Unauthenticated, ErrUnauthorized.Error())
+	}
+	return handler(srv, ss)
+}
+
+// ListCommands lists all commands
+func (z *zeusServer) ListCommands(ctx context.Context, req *rpc.ListCommandsRequest) (*rpc.ListCommandsResponse, error) {
+
+	res := &rpc.ListCommandsResponse{}
+	for _, dc := range dashboardCommands() {
+		c := &rpc.Command{
+			Name:         dc.Name,
+			Description:  dc.Description,
+			Dependencies: dc.Dependencies,
+			Async:        dc.Async,
+		}
+		for _, arg := range dc.Arguments {
+			c.Arguments = append(c.Arguments, &rpc.Argument{
+				Name:     arg.Name,
+				Type:     arg.Type,
+				Optional: arg.Optional,
+				Default:  arg.Default,
+			})
+		}
+		res.Commands = append(res.Commands, c)
+	}
+	return res, nil
+}
+
+// RunCommand runs a command and streams its output, including the output of its dependencies
+// the run continues when the client disconnects, use CancelRun to stop it
+func (z *zeusServer) RunCommand(req *rpc.RunCommandRequest, stream rpc.Zeus_RunCommandServer) error {
+
+	cmd, err := cmdMap.getCommand(req.Command)
+	if err != nil {
+		return grpcStatus.Error(codes.NotFound, ErrUnknownCommand.Error()+": "+req.Command)
+	}
+
+	names, err := runCommandNames(cmd)
+	if err != nil {
+		return grpcStatus.Error(codes.InvalidArgument, err.Error())
+	}
+
+	// listen before starting, so no output is missed
+	ch := outputListeners.add()
+	defer outputListeners.remove(ch)
+
+	var (
+		run  = apiRuns.add(cmd.name, runArguments(req.Arguments))
+		id   = run.ID
+		done = make(chan struct{})
+	)
+
+	err = stream.Send(&rpc.RunEvent{
+		Type: rpc.RunEvent_STARTED,
+		Run:  runStatus(id),
+	})
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		runFromDashboard(cmd, run)
+		close(done)
+	}()
+
+	sendOutput := func(msg *dashboardMessage) error {
+		if msg.Type != "output" || !names[msg.Command] {
+			return nil
+		}
+		return stream.Send(&rpc.RunEvent{
+			Type:    rpc.RunEvent_OUTPUT,
+			Command: msg.Command,
+			Stream:  msg.Stream,
+			Line:    msg.Line,
+		})
+	}
+
+	for {
+		select {
+		case msg := <-ch:
+			if err := sendOutput(msg); err != nil {
+				return err
+			}
+		case <-done:
+
+			// output is flushed before the command returns
+			for len(ch) > 0 {
+				if err := sendOutput(<-ch); err != nil {
+					return err
+				}
+			}
+
+			return stream.Send(&rpc.RunEvent{
+				Type: rpc.RunEvent_FINISHED,
+				Run:  runStatus(id),
+			})
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		}
+	}
+}
+
+// CancelRun cancels a run by killing the running processes of the command and its dependencies
+func (z *zeusServer) CancelRun(ctx context.Context, req *rpc.CancelRunRequest) (*rpc.Run, error) {
+
+	err := cancelRun(req.Id)
+	switch err {
+	case nil:
+	case ErrUnknownRun:
+		return nil, grpcStatus.Error(codes.NotFound, err.Error())
+	case ErrRunNotRunning:
+		return nil, grpcStatus.Error(codes.FailedPrecondition, err.Error())
+	default:
+		return nil, grpcStatus.Error(codes.Internal, err.Error())
+	}
+
+	return runStatus(req.Id), nil
+}
+
+// GetGraph returns the dependency graph of all commands
+func (z *zeusServer) GetGraph(ctx context.Context, req *rpc.GetGraphRequest) (*rpc.Graph, error) {
+
+	var (
+		graph = commandGraph()
+		res   = &rpc.Graph{
+			Nodes: graph.Nodes,
+		}
+	)
+
+	for _, e := range graph.Edges {
+		res.Edges = append(res.Edges, &rpc.Edge{
+			From:      e.From,
+			To:        e.To,
+			Arguments: e.Arguments,
+		})
+	}
+	return res, nil
+}
+
+// names of a command and all of its dependencies
+// fails if the dependencies do not exist or contain a cycle
+func runCommandNames(cmd *command) (map[string]bool, error) {
+
+	deps, err := validDeepDependencies(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	names := map[string]bool{cmd.name: true}
+	for _, dep := range deps {
+		if fields := strings.Fields(dep); len(fields) > 0 {
+			names[fields[0]] = true
+		}
+	}
+	return names, nil
+}
+
+// mark a run as canceled and kill the processes of its command and dependencies
+// processes of other runs of the same commands are killed as well
+func cancelRun(id string) error {
+
+	apiRuns.Lock()
+	run, ok := apiRuns.items[id]
+	if !ok {
+		apiRuns.Unlock()
+		return ErrUnknownRun
+	}
+	if run.Status != runStatusRunning {
+		apiRuns.Unlock()
+		return ErrRunNotRunning
+	}
+	run.Status = runStatusCanceled
+	name := run.Command
+	apiRuns.Unlock()
+
+	cmd, err := cmdMap.getCommand(name)
+	if err != nil {
+		return err
+	}
+	names, err := runCommandNames(cmd)
+	if err != nil {
+		return err
+	}
+
+	var pids []int
+	processMapMutex.Lock()
+	for _, p := range processMap {
+		if names[p.Name] {
+			pids = append(pids, p.PID)
+		}
+	}
+	processMapMutex.Unlock()
+
+	for _, pid := range pids {
+		err = killProcess(pid)
+		if err != nil && err != ErrUnknownProcess {
+			return err
+		}
+	}
+	return nil
+}
+
+// convert the current state of a run for gRPC
+func runStatus(id string) *rpc.Run {
+
+	run, ok := apiRuns.get(id)
+	if !ok {
+		return &rpc.Run{Id: id}
+	}
+
+	res := &rpc.Run{
+		Id:        run.ID,
+		Command:   run.Command,
+		Arguments: run.Arguments,
+		Status:    run.Status,
+		Start:     timestamppb.New(run.Start),
+		Error:     run.Error,
+		ExitCode:  int32(run.ExitCode),
+	}
+	if run.End != nil {
+		res.End = timestamppb.New(*run.End)
+	}
+	return res
+}
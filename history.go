@@ -0,0 +1,534 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// a run only counts as following another one when it started within this time after the other has finished
+const followerWindow = 30 * time.Minute
+
+var (
+	// persistent store for all command runs
+	runHistory = &runHistoryStore{}
+
+	// transitions between commands in the run history, for ranking completions
+	runFollowers = &runFollowerCache{}
+)
+
+// historyEntry is a single command run in the run history
+type historyEntry struct {
+	Name      string        `json:"name"`
+	Args      []string      `json:"args,omitempty"`
+	Timestamp time.Time     `json:"timestamp"`
+	Duration  time.Duration `json:"duration"`
+
+	// duration in milliseconds, for tools that do not handle nanoseconds
+	DurationMs int64 `json:"durationMs"`
+
+	ExitCode int  `json:"exitCode"`
+	Skipped  bool `json:"skipped,omitempty"`
+}
+
+// runHistoryStore appends runs as JSON lines to zeus/data/runs.jsonl
+type runHistoryStore struct {
+
+	// number of entries in the file
+	count int
+
+	// path the count refers to, empty until the file has been counted
+	path string
+
+	sync.Mutex
+}
+
+// runFollowerCache keeps the command transitions until the run history changes
+type runFollowerCache struct {
+	modTime time.Time
+	size    int64
+	counts  map[string]map[string]int
+	sync.Mutex
+}
+
+// commandStats are the statistics for a command over the run history
+type commandStats struct {
+	name     string
+	runs     int
+	failures int
+	total    time.Duration
+	slowest  time.Duration
+	lastRun  time.Time
+}
+
+func printHistoryCommandUsageErr() {
+	l.Println(ErrInvalidUsage)
+	l.Println("usage: history [<command>] [<number of runs>]")
+	l.Println("       history " + historySubcommandLines + " [<number of lines>]")
+}
+
+// path of the run history
+func runHistoryPath() string {
+	return filepath.Join(zeusDir, "data", "runs.jsonl")
+}
+
+// get the exit code for a process error, wrapped errors are unwrapped
+// returns -1 if the process did not exit normally
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var e *exec.ExitError
+	if errors.As(err, &e) {
+		return e.ExitCode()
+	}
+	return -1
+}
+
+// get the exit status of zeus for the error of a run
+// the exit code of a failed script is passed on, a script killed by a signal exits with 128 + signal
+// all other errors exit with 1
+func exitStatus(err error) int {
+
+	if code := exitCode(err); code > 0 {
+		return code
+	}
+
+	var e *exec.ExitError
+	if errors.As(err, &e) {
+		if ws, ok := e.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+			return 128 + int(ws.Signal())
+		}
+	}
+
+	if err == nil {
+		return 0
+	}
+	return 1
+}
+
+// append a record to the run history
+func (h *runHistoryStore) append(rec *runRecord) {
+
+	conf.Lock()
+	limit := conf.fields.RunHistorySize
+	conf.Unlock()
+
+	if limit <= 0 {
+		return
+	}
+
+	h.Lock()
+	defer h.Unlock()
+
+	path := runHistoryPath()
+
+	c, err := json.Marshal(&historyEntry{
+		Name:       rec.Name,
+		Args:       rec.Args,
+		Timestamp:  rec.Start,
+		Duration:   rec.Duration,
+		DurationMs: durationMillis(rec.Duration),
+		ExitCode:   exitCode(rec.Err),
+		Skipped:    rec.Skipped,
+	})
+	if err != nil {
+		Log.WithError(err).Error("failed to marshal history entry")
+		return
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		Log.WithError(err).Error("failed to create history directory")
+		return
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		Log.WithError(err).Error("failed to open run history")
+		return
+	}
+
+	_, err = f.Write(append(c, '\n'))
+	f.Close()
+	if err != nil {
+		Log.WithError(err).Error("failed to write run history")
+		return
+	}
+
+	// count the entries once per process
+	if h.path != path {
+		entries, err := readRunHistory()
+		if err != nil {
+			Log.WithError(err).Error("failed to read run history")
+			return
+		}
+		h.path = path
+		h.count = len(entries)
+	} else {
+		h.count++
+	}
+
+	// drop the oldest quarter when the limit is exceeded
+	// to avoid rewriting the file on every run
+	if h.count > limit {
+		h.compact(limit - limit/4)
+	}
+}
+
+// rewrite the run history with the latest n entries
+func (h *runHistoryStore) compact(n int) {
+
+	entries, err := readRunHistory()
+	if err != nil {
+		Log.WithError(err).Error("failed to read run history")
+		return
+	}
+
+	if len(entries) > n {
+		entries = entries[len(entries)-n:]
+	}
+
+	var b strings.Builder
+	for _, e := range entries {
+		c, err := json.Marshal(e)
+		if err != nil {
+			Log.WithError(err).Error("failed to marshal history entry")
+			return
+		}
+		b.Write(append(c, '\n'))
+	}
+
+	err = writeFileAtomic(h.path, []byte(b.String()), 0644)
+	if err != nil {
+		Log.WithError(err).Error("failed to write run history")
+		return
+	}
+
+	h.count = len(entries)
+}
+
+// read all entries from the run history, oldest first
+func readRunHistory() (entries []*historyEntry, err error) {
+
+	f, err := os.Open(runHistoryPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		var e = new(historyEntry)
+		if err := json.Unmarshal(scanner.Bytes(), e); err != nil {
+			// skip lines corrupted by an interrupted write
+			Log.WithError(err).Debug("invalid history entry")
+			continue
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, scanner.Err()
+}
+
+// map the run history into memory
+// pages are read from disk on demand, instead of copying the whole file onto the heap
+func mapRunHistory() (data []byte, unmap func(), err error) {
+
+	f, err := os.Open(runHistoryPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, func() {}, nil
+		}
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// empty files can not be mapped
+	if stat.Size() == 0 {
+		return nil, func() {}, nil
+	}
+
+	data, err = syscall.Mmap(int(f.Fd()), 0, int(stat.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return data, func() {
+		if err := syscall.Munmap(data); err != nil {
+			Log.WithError(err).Debug("failed to unmap run history")
+		}
+	}, nil
+}
+
+// read the latest n entries from the run history, oldest first
+// if name is set, only the runs of this command are returned
+// the file is scanned backwards, so only the returned entries are decoded
+func tailRunHistory(name string, n int) (entries []*historyEntry, err error) {
+
+	data, unmap, err := mapRunHistory()
+	if err != nil {
+		return nil, err
+	}
+	defer unmap()
+
+	for end := len(data); end > 0 && len(entries) < n; {
+
+		start := bytes.LastIndexByte(data[:end], '\n')
+		line := data[start+1 : end]
+		end = start
+		if start < 0 {
+			end = 0
+		}
+
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		var e = new(historyEntry)
+		if err := json.Unmarshal(line, e); err != nil {
+			// skip lines corrupted by an interrupted write
+			Log.WithError(err).Debug("invalid history entry")
+			continue
+		}
+
+		if name != "" && e.Name != name {
+			continue
+		}
+		entries = append(entries, e)
+	}
+
+	// reverse into chronological order
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+
+	return entries, nil
+}
+
+// handle history shell command
+func handleHistoryCommand(args []string) {
+
+	if len(args) > 1 && args[1] == historySubcommandLines {
+		handleHistoryLinesCommand(args[2:])
+		return
+	}
+
+	var (
+		name string
+		n    = 20
+	)
+
+	for _, arg := range args[1:] {
+		if i, err := strconv.Atoi(arg); err == nil {
+			n = i
+			continue
+		}
+		if name != "" {
+			printHistoryCommandUsageErr()
+			return
+		}
+		name = arg
+	}
+
+	entries, err := tailRunHistory(name, n)
+	if err != nil {
+		l.Println("failed to read run history:", err)
+		return
+	}
+
+	if len(entries) == 0 {
+		l.Println("no runs recorded yet.")
+		return
+	}
+
+	l.Println(cp.Prompt + pad("timestamp", 22) + pad("command", 25) + pad("exit", 6) + pad("duration", 15) + "args" + cp.Text)
+	for _, e := range entries {
+
+		status := strconv.Itoa(e.ExitCode)
+		if e.Skipped {
+			status = "skip"
+		}
+
+		l.Println(fitLine(pad(e.Timestamp.Format("2006-01-02 15:04:05"), 22) + pad(e.Name, 25) + pad(status, 6) + pad(formatDuration(e.Duration), 15) + strings.Join(e.Args, " ")))
+	}
+}
+
+// calculate the statistics for all commands
+// sorted by average duration, slowest first
+func runStats(entries []*historyEntry) (stats []*commandStats) {
+
+	var index = make(map[string]*commandStats)
+
+	for _, e := range entries {
+		if e.Skipped {
+			continue
+		}
+
+		st, ok := index[e.Name]
+		if !ok {
+			st = &commandStats{name: e.Name}
+			index[e.Name] = st
+			stats = append(stats, st)
+		}
+
+		st.runs++
+		st.total += e.Duration
+		if e.ExitCode != 0 {
+			st.failures++
+		}
+		if e.Duration > st.slowest {
+			st.slowest = e.Duration
+		}
+		if e.Timestamp.After(st.lastRun) {
+			st.lastRun = e.Timestamp
+		}
+	}
+
+	sort.SliceStable(stats, func(i, j int) bool {
+		return stats[i].average() > stats[j].average()
+	})
+
+	return
+}
+
+// average duration of a command
+func (st *commandStats) average() time.Duration {
+	if st.runs == 0 {
+		return 0
+	}
+	return st.total / time.Duration(st.runs)
+}
+
+// percentage of failed runs
+func (st *commandStats) failureRate() float64 {
+	if st.runs == 0 {
+		return 0
+	}
+	return float64(st.failures) / float64(st.runs) * 100
+}
+
+// handle stats shell command
+func handleStatsCommand() {
+
+	entries, err := readRunHistory()
+	if err != nil {
+		l.Println("failed to read run history:", err)
+		return
+	}
+
+	stats := runStats(entries)
+	if len(stats) == 0 {
+		l.Println("no runs recorded yet.")
+		return
+	}
+
+	l.Println(cp.Prompt + pad("command", 25) + pad("runs", 8) + pad("failures", 10) + pad("average", 15) + pad("slowest", 15) + "last run" + cp.Text)
+	for _, st := range stats {
+		l.Println(fitLine(pad(st.name, 25) + pad(strconv.Itoa(st.runs), 8) + pad(strconv.FormatFloat(st.failureRate(), 'f', 1, 64)+"%", 10) + pad(formatDuration(st.average()), 15) + pad(formatDuration(st.slowest), 15) + st.lastRun.Format("2006-01-02 15:04:05")))
+	}
+}
+
+// count how often each command has been followed by another command in the run history
+func commandFollowers(entries []*historyEntry) map[string]map[string]int {
+
+	var counts = make(map[string]map[string]int)
+
+	for i := 1; i < len(entries); i++ {
+		prev, next := entries[i-1], entries[i]
+		if prev.Name == next.Name || next.Timestamp.Sub(prev.Timestamp.Add(prev.Duration)) > followerWindow {
+			continue
+		}
+		if counts[prev.Name] == nil {
+			counts[prev.Name] = make(map[string]int)
+		}
+		counts[prev.Name][next.Name]++
+	}
+
+	return counts
+}
+
+// get the command transitions, the run history is only read again when it has changed
+func (fc *runFollowerCache) get() map[string]map[string]int {
+
+	stat, err := os.Stat(runHistoryPath())
+	if err != nil {
+		return nil
+	}
+
+	fc.Lock()
+	defer fc.Unlock()
+
+	if fc.counts != nil && stat.ModTime().Equal(fc.modTime) && stat.Size() == fc.size {
+		return fc.counts
+	}
+
+	entries, err := readRunHistory()
+	if err != nil {
+		Log.WithError(err).Debug("failed to read run history")
+		return nil
+	}
+
+	fc.modTime = stat.ModTime()
+	fc.size = stat.Size()
+	fc.counts = commandFollowers(entries)
+
+	return fc.counts
+}
+
+// drop the cached transitions, they are read again when needed
+func (fc *runFollowerCache) reset() (commands int) {
+	fc.Lock()
+	defer fc.Unlock()
+	commands = len(fc.counts)
+	fc.counts = nil
+	return
+}
+
+// order names by how often they followed the previous command
+// names that never followed it keep their order
+func rankByFollowers(previous string, names []string, followers map[string]map[string]int) []string {
+	counts := followers[previous]
+	sort.SliceStable(names, func(i, j int) bool {
+		return counts[names[i]] > counts[names[j]]
+	})
+	return names
+}
@@ -59,8 +59,10 @@ func createRouter() *httprouter.Router {
 	r.HandlerFunc("GET", "/quit", quitHandler)
 	r.HandlerFunc("GET", "/wiki", wikiIndexHandler)
 	r.HandlerFunc("GET", "/wiki/docs/:doc", wikiDocsHandler)
-	r.HandlerFunc("GET", "/glue/ws", glueWebSocketHandler)
-	r.HandlerFunc("POST", "/glue/ajax", glueAjaxHandler)
+	// the sockets receive the live output of all commands
+	r.Handler("GET", "/glue/ws", apiAuth(glueWebSocketHandler))
+	r.Handler("POST", "/glue/ajax", apiAuth(glueAjaxHandler))
+	addAPIRoutes(r)
 
 	return r
 }
@@ -192,8 +194,9 @@ func runGlue() {
 	glueServerMutex.Lock()
 
 	// create a new glue server
+	// it does not listen on its own, the sockets are only served by the authorized routes of the web panel
 	glueServer = glue.NewServer(glue.Options{
-		HTTPListenAddress: ":" + strconv.Itoa(conf.fields.PortGlueServer),
+		HTTPSocketType: glue.HTTPSocketTypeNone,
 	})
 
 	// release the glue server on defer
@@ -0,0 +1,267 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"regexp"
+	"strings"
+)
+
+var (
+	// ErrNoRecipes means the Justfile does not contain any recipes
+	ErrNoRecipes = errors.New("no recipes found in Justfile")
+
+	// file names just looks for
+	justfileNames = []string{"justfile", "Justfile", ".justfile"}
+
+	// regular expressions to match various elements from a Justfile
+	justfileAssignment = regexp.MustCompile("^(export\\s+)?([A-Za-z_][A-Za-z0-9_-]*)\\s*:=\\s*(.*)$")
+	justfileDirective  = regexp.MustCompile("^(set|alias|import|mod)\\s")
+	justfileRecipe     = regexp.MustCompile("^@?([A-Za-z_][A-Za-z0-9_-]*)([^:]*):(?:\\s+(.*))?$")
+	justfileAttribute  = regexp.MustCompile("^\\[.*\\]$")
+	justfileDependency = regexp.MustCompile("\\([^)]*\\)|\\S+")
+	justfileVar        = regexp.MustCompile("\\{\\{\\s*([A-Za-z_][A-Za-z0-9_]*)\\s*\\}\\}")
+	justfileTemplate   = regexp.MustCompile("\\{\\{[^}]*\\}\\}")
+	justfileBacktick   = regexp.MustCompile("^`([^`]*)`$")
+)
+
+// escaped template braces are swapped for this placeholder during translation
+const justfileBraces = "\x00"
+
+// migrate the recipes of a Justfile into a zeus command folder
+func migrateJustfile(zeusDirectory, policy string) {
+
+	Log.WithField("dir", zeusDirectory).Info("Justfile migration started.")
+
+	var (
+		contents []byte
+		name     string
+		err      error
+	)
+	for _, name = range justfileNames {
+		contents, err = ioutil.ReadFile(name)
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		Log.WithError(err).Error("unable to read Justfile")
+		return
+	}
+
+	m, err := translateJustfile(contents, name)
+	if err != nil {
+		l.Println(err)
+		return
+	}
+
+	err = m.write(zeusDirectory, policy)
+	if err != nil {
+		l.Println(err)
+	}
+}
+
+// translate the contents of a Justfile into globals and commands
+func translateJustfile(contents []byte, source string) (*migration, error) {
+
+	var (
+		m       = newMigration(source)
+		current *migratedCommand
+		comment string
+		attrs   []string
+		indent  string
+		lines   = strings.Split(string(contents), "\n")
+
+		// dependencies after && that run when the recipe succeeded
+		subsequent []string
+	)
+
+	for i, line := range lines {
+
+		var (
+			num     = i + 1
+			trimmed = strings.TrimSpace(strings.TrimRight(line, "\r"))
+		)
+
+		// recipe lines are indented
+		if current != nil && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			if indent == "" {
+				indent = line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+			}
+			current.translateJustfileLine(strings.TrimPrefix(strings.TrimRight(line, "\r"), indent), len(current.script) == 0)
+			continue
+		}
+
+		if trimmed == "" {
+			if current != nil {
+				current.script = append(current.script, "")
+			}
+			comment = ""
+			continue
+		}
+
+		m.finishRecipe(current, subsequent)
+		current = nil
+		subsequent = nil
+		indent = ""
+
+		// the comment directly above a recipe is its description
+		if strings.HasPrefix(trimmed, "#") {
+			comment = strings.TrimSpace(strings.TrimPrefix(trimmed, "#"))
+			continue
+		}
+
+		if justfileAttribute.MatchString(trimmed) {
+			attrs = append(attrs, trimmed)
+			continue
+		}
+
+		if match := justfileAssignment.FindStringSubmatch(trimmed); match != nil {
+			m.assignJustfile(strings.Replace(match[2], "-", "_", -1), strings.TrimSpace(match[3]), num)
+			continue
+		}
+
+		if justfileDirective.MatchString(trimmed) {
+			m.note(num, trimmed)
+			continue
+		}
+
+		match := justfileRecipe.FindStringSubmatch(trimmed)
+		if match == nil {
+			m.note(num, trimmed)
+			comment = ""
+			continue
+		}
+
+		current = &migratedCommand{
+			name:        migratedCommandName(match[1]),
+			description: comment,
+		}
+		if current.description == "" {
+			current.description = "migrated from recipe " + match[1]
+		}
+		for _, a := range attrs {
+			current.notes = append(current.notes, "attribute "+a)
+		}
+		if params := strings.TrimSpace(match[2]); params != "" {
+			current.notes = append(current.notes, "parameters need to be declared as command arguments: "+params)
+		}
+
+		deps := strings.SplitN(match[3], "&&", 2)
+		for _, d := range justfileDependency.FindAllString(deps[0], -1) {
+			current.dependencies = append(current.dependencies, current.justfileDependency(d))
+		}
+		if len(deps) == 2 {
+			for _, d := range justfileDependency.FindAllString(deps[1], -1) {
+				subsequent = append(subsequent, current.justfileDependency(d))
+			}
+		}
+
+		comment = ""
+		attrs = nil
+	}
+
+	m.finishRecipe(current, subsequent)
+
+	if len(m.commands) == 0 {
+		return nil, ErrNoRecipes
+	}
+
+	return m, nil
+}
+
+// add a parsed recipe to the migration
+func (m *migration) finishRecipe(c *migratedCommand, subsequent []string) {
+
+	if c == nil {
+		return
+	}
+
+	// drop trailing empty lines
+	for len(c.script) > 0 && c.script[len(c.script)-1] == "" {
+		c.script = c.script[:len(c.script)-1]
+	}
+
+	for i, name := range subsequent {
+		if i == 0 && len(c.script) > 0 && !strings.HasSuffix(c.script[len(c.script)-1], "|| true") {
+			c.script[len(c.script)-1] += " || exit $?"
+		}
+		c.script = append(c.script, "zeus "+name)
+	}
+
+	m.commands = append(m.commands, c)
+}
+
+// translate a variable assignment into a global
+func (m *migration) assignJustfile(name, value string, line int) {
+
+	if len(value) > 1 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] && !strings.ContainsRune(value[1:len(value)-1], rune(value[0])) {
+		value = value[1 : len(value)-1]
+	} else if match := justfileBacktick.FindStringSubmatch(value); match != nil {
+		value = "$(" + match[1] + ")"
+	} else {
+		m.note(line, "expression in variable "+name+": "+value)
+	}
+
+	if _, ok := m.globals[name]; !ok {
+		m.globalNames = append(m.globalNames, name)
+	}
+	m.globals[name] = value
+}
+
+// get the command name of a dependency, arguments passed to it are noted
+func (c *migratedCommand) justfileDependency(dep string) string {
+	if strings.HasPrefix(dep, "(") {
+		c.notes = append(c.notes, "arguments passed to dependency: "+dep)
+		dep = strings.Fields(strings.Trim(dep, "()"))[0]
+	}
+	return migratedCommandName(dep)
+}
+
+// translate a recipe line into bash
+func (c *migratedCommand) translateJustfileLine(line string, first bool) {
+
+	if first && strings.HasPrefix(line, "#!") {
+		c.notes = append(c.notes, "shebang recipe is run with the language of the CommandsFile: "+line)
+		return
+	}
+
+	// strip the '@' (quiet) and '-' (ignore errors) prefixes
+	var ignoreErrors bool
+	for len(line) > 0 && strings.ContainsAny(line[:1], "@-") {
+		ignoreErrors = ignoreErrors || line[0] == '-'
+		line = line[1:]
+	}
+
+	// {{{{ escapes literal braces
+	line = strings.Replace(line, "{{{{", justfileBraces, -1)
+	line = justfileVar.ReplaceAllString(line, "$${$1}")
+	for _, t := range justfileTemplate.FindAllString(line, -1) {
+		c.notes = append(c.notes, "expression "+t)
+	}
+	line = strings.Replace(line, justfileBraces, "{{", -1)
+
+	if ignoreErrors && strings.TrimSpace(line) != "" {
+		line += " || true"
+	}
+
+	c.script = append(c.script, line)
+}
@@ -35,6 +35,12 @@ var (
 
 		if keyName, ok := keyMap[key]; ok {
 			if command, ok := projectData.fields.KeyBindings[keyName]; ok {
+				if command == keyActionCopyExample {
+					if example, found := copyExample(line); found {
+						return example, len(example), true
+					}
+					return nil, 0, false
+				}
 				println()
 				handleLine(command)
 			}
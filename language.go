@@ -26,6 +26,11 @@ import (
 var (
 	commandChainSeparator = "->"
 
+	// operators inside a step of a commandChain
+	// a & b runs both commands in parallel, a || b runs b only if a failed
+	commandChainParallel = "&"
+	commandChainFallback = "||"
+
 	// global language store
 	ls = &languageStore{
 		items: map[string]*Language{
@@ -95,14 +100,33 @@ type Language struct {
 	// in this case a temporary script is generated on disk and passed to the interpreter for execution
 	UseTempFile bool `yaml:"useTempFile"`
 
+	// the first argument after an evaluated script sets its name ($0 in shells)
+	// the arguments for the script follow after it
+	ScriptNameArgument bool `yaml:"scriptNameArgument"`
+
 	ExecOpPrefix string `yaml:"execOpPrefix"`
 	ExecOpSuffix string `yaml:"execOpSuffix"`
 
 	// extension for filetype
 	FileExtension string `yaml:"fileExtension"`
 
+	// literals for booleans, true and false if empty
+	BoolTrue  string `yaml:"boolTrue"`
+	BoolFalse string `yaml:"boolFalse"`
+
 	CorrectErrLineNumber bool   `yaml:"correctErrLineNumber"`
 	ErrLineNumberSymbol  string `yaml:"errLineNumberSymbol"`
+
+	// regular expression for the locations in the error output of a script
+	// the group named line captures the line number, the optional group named file the script name
+	ErrLinePattern string `yaml:"errLinePattern"`
+
+	// command for linting scripts, the path of the script is appended
+	// findings are expected in the file:line[:column]: message format
+	Linter string `yaml:"linter"`
+
+	// command for formatting scripts in place, the path of the script is appended
+	Formatter string `yaml:"formatter"`
 }
 
 func bashLanguage() *Language {
@@ -114,9 +138,13 @@ func bashLanguage() *Language {
 		AssignmentOperator:   "=",
 		FlagStopOnError:      "-e",
 		FlagEvaluateScript:   "-c",
+		ScriptNameArgument:   true,
 		FileExtension:        ".sh",
 		CorrectErrLineNumber: false,
 		ErrLineNumberSymbol:  "line",
+		ErrLinePattern:       `(?m)^(?P<file>[^:\n]+): line (?P<line>[0-9]+):`,
+		Linter:               "shellcheck -s bash -f gcc",
+		Formatter:            "shfmt -ln bash -w",
 	}
 }
 
@@ -129,9 +157,13 @@ func shellLanguage() *Language {
 		AssignmentOperator:   "=",
 		FlagStopOnError:      "-e",
 		FlagEvaluateScript:   "-c",
+		ScriptNameArgument:   true,
 		FileExtension:        ".sh",
 		CorrectErrLineNumber: false,
 		ErrLineNumberSymbol:  "line",
+		ErrLinePattern:       `(?m)^(?P<file>[^:\n]+): (?:line )?(?P<line>[0-9]+):`,
+		Linter:               "shellcheck -s sh -f gcc",
+		Formatter:            "shfmt -ln posix -w",
 	}
 }
 
@@ -144,9 +176,11 @@ func zshellLanguage() *Language {
 		AssignmentOperator:   "=",
 		FlagStopOnError:      "-e",
 		FlagEvaluateScript:   "-c",
+		ScriptNameArgument:   true,
 		FileExtension:        ".zsh",
 		CorrectErrLineNumber: false,
 		ErrLineNumberSymbol:  "", // TODO: no symbol for that, allow to use a regex for this task
+		ErrLinePattern:       `(?m)^(?P<file>[^:\n]+):(?P<line>[0-9]+): `,
 	}
 }
 
@@ -161,8 +195,13 @@ func pythonLanguage() *Language {
 		FileExtension:        ".py",
 		ExecOpPrefix:         "import os; os.system(\"",
 		ExecOpSuffix:         "\")",
-		CorrectErrLineNumber: true,
+		BoolTrue:             "True",
+		BoolFalse:            "False",
+		CorrectErrLineNumber: false,
 		ErrLineNumberSymbol:  "line",
+		ErrLinePattern:       `File "(?P<file>[^"]+)", line (?P<line>[0-9]+)`,
+		Linter:               "pylint --output-format=parseable",
+		Formatter:            "black -q",
 	}
 }
 
@@ -180,6 +219,8 @@ func javaScriptLanguage() *Language {
 		ExecOpSuffix:         "\");",
 		CorrectErrLineNumber: false,
 		ErrLineNumberSymbol:  "line",
+		ErrLinePattern:       `(?:(?P<file>\[eval\]|[^\s():]+\.js):(?P<line>[0-9]+)|Error on line (?P<line>[0-9]+))`,
+		Formatter:            "prettier --write",
 	}
 }
 
@@ -195,8 +236,10 @@ func rubyLanguage() *Language {
 		FileExtension:        ".rb",
 		ExecOpPrefix:         "`",
 		ExecOpSuffix:         "`",
-		CorrectErrLineNumber: true,
+		CorrectErrLineNumber: false,
 		ErrLineNumberSymbol:  "-e:",
+		ErrLinePattern:       `(?m)(?:^|from )(?P<file>-e|[^\s:]+\.rb):(?P<line>[0-9]+):`,
+		Linter:               "rubocop --format emacs",
 	}
 }
 
@@ -212,8 +255,11 @@ func luaLanguage() *Language {
 		FileExtension:        ".lua",
 		ExecOpPrefix:         "os.execute(\"",
 		ExecOpSuffix:         "\")",
-		CorrectErrLineNumber: true,
+		CorrectErrLineNumber: false,
 		ErrLineNumberSymbol:  "line",
+		ErrLinePattern:       `(?P<file>\(command line\)|[^\s:]+\.lua):(?P<line>[0-9]+):`,
+		Linter:               "luacheck --formatter plain",
+		Formatter:            "stylua",
 	}
 }
 
@@ -230,7 +276,12 @@ func perlLanguage() *Language {
 		FileExtension:        ".pl",
 		ExecOpPrefix:         "system(\"",
 		ExecOpSuffix:         "\")",
-		CorrectErrLineNumber: true,
+		BoolTrue:             "1",
+		BoolFalse:            "0",
+		CorrectErrLineNumber: false,
 		ErrLineNumberSymbol:  "line",
+		ErrLinePattern:       ` at (?P<file>\S+) line (?P<line>[0-9]+)`,
+		Linter:               "perlcritic --verbose 1",
+		Formatter:            "perltidy -b -bext=/",
 	}
 }
@@ -0,0 +1,123 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+// lifecycle variables exported to every command
+// the names and formats are stable, scripts rely on them
+const (
+	// identifies the invocation, shared by all commands it started and nested zeus processes
+	runIDEnv = "ZEUS_RUN_ID"
+
+	// name of the command
+	commandEnv = "ZEUS_COMMAND"
+
+	// the command that started the command as a dependency
+	// for the invoked commands of a nested zeus process, the command that started zeus
+	parentEnv = "ZEUS_PARENT"
+
+	// number of times the command has been started in the invocation, starting at 1
+	attemptEnv = "ZEUS_ATTEMPT"
+
+	// start of the invocation in RFC3339 format, in UTC
+	invocationTimeEnv = "ZEUS_INVOCATION_TIME"
+
+	// true in CI Mode, false otherwise
+	isCIEnv = "ZEUS_IS_CI"
+
+	// name of the active environment profile, empty without one
+	envProfileEnv = "ZEUS_ENV"
+)
+
+// start a new invocation, the caller holds the lock
+// a zeus process started by a command continues the invocation of its parent
+func (s *status) startRun() {
+	s.runID = os.Getenv(runIDEnv)
+	if s.runID == "" {
+		s.runID = randomString()
+	}
+	s.invocationTime = time.Now().UTC()
+	s.attempts = make(map[string]int)
+	s.parents = make(map[string]string)
+}
+
+// the id and the start of the running invocation
+// commands started without an invocation get one of their own
+func (s *status) run() (string, time.Time) {
+	s.Lock()
+	defer s.Unlock()
+	if s.runID == "" {
+		s.startRun()
+	}
+	return s.runID, s.invocationTime
+}
+
+// count a start of a command and return the attempt
+func (s *status) attempt(name string) int {
+	s.run()
+
+	s.Lock()
+	defer s.Unlock()
+	s.attempts[name]++
+	return s.attempts[name]
+}
+
+// remember the command a dependency has been started for
+func (s *status) setParent(dependency, parent string) {
+	s.run()
+
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.parents[dependency]; !ok {
+		s.parents[dependency] = parent
+	}
+}
+
+// the command a dependency has been started for
+// invoked commands inherit the command of a parent zeus process
+func (s *status) parent(name string) string {
+	s.RLock()
+	defer s.RUnlock()
+	if p, ok := s.parents[name]; ok {
+		return p
+	}
+	return os.Getenv(commandEnv)
+}
+
+// the lifecycle variables for a start of a command
+func lifecycleEnv(name string) []string {
+
+	attempt := s.attempt(name)
+	id, start := s.run()
+
+	return []string{
+		runIDEnv + "=" + id,
+		commandEnv + "=" + name,
+		parentEnv + "=" + s.parent(name),
+		attemptEnv + "=" + strconv.Itoa(attempt),
+		invocationTimeEnv + "=" + start.Format(time.RFC3339),
+		isCIEnv + "=" + strconv.FormatBool(ciMode),
+		envProfileEnv + "=" + envs.current(),
+	}
+}
@@ -0,0 +1,263 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrLintFindings means the linters reported findings for the scripts of the commands
+	ErrLintFindings = errors.New("linters reported findings")
+
+	// ErrLinterNotFound means the linter configured for a language is not installed
+	ErrLinterNotFound = errors.New("linter not found")
+)
+
+// a line of linter output in the file:line[:column]: message format
+var lintFindingPattern = regexp.MustCompile(`^([^:\s]+):([0-9]+):(?:[0-9]+:)?\s*(.*)$`)
+
+// a finding of a linter in the script of a command
+type lintFinding struct {
+	command string
+
+	// file:line in the CommandsFile or the script of the command
+	location string
+
+	message string
+}
+
+func printLintCommandUsageErr() {
+	l.Println(ErrInvalidUsage)
+	l.Println("usage: lint [<command> ...]")
+}
+
+// handle the lint builtin
+// lints the scripts of the given commands, or of all commands
+func handleLintCommand(args []string) error {
+
+	var cmds []*command
+	if len(args) > 1 {
+		for _, name := range args[1:] {
+			c, err := cmdMap.getCommand(name)
+			if err != nil {
+				printLintCommandUsageErr()
+				return err
+			}
+			cmds = append(cmds, c)
+		}
+	} else {
+		cmdMap.Lock()
+		for _, c := range cmdMap.items {
+			cmds = append(cmds, c)
+		}
+		cmdMap.Unlock()
+		sort.Slice(cmds, func(i, j int) bool {
+			return cmds[i].name < cmds[j].name
+		})
+	}
+
+	var (
+		findings int
+		missing  = make(map[string]bool)
+	)
+	for _, c := range cmds {
+		results, err := c.lint()
+		if err == ErrLinterNotFound {
+			lang, _ := c.getLanguage()
+			if !missing[lang.Linter] {
+				missing[lang.Linter] = true
+				l.Println(cp.Prompt + "skipping " + lang.Name + " scripts, linter not found: " + lang.Linter + cp.Reset)
+			}
+			continue
+		}
+		if err != nil {
+			l.Println(c.name + ": " + err.Error())
+			continue
+		}
+		printLintFindings(results)
+		findings += len(results)
+	}
+
+	if findings == 0 {
+		l.Println("no findings")
+		return nil
+	}
+	l.Println(cp.Prompt + strconv.Itoa(findings) + " findings" + cp.Reset)
+	return ErrLintFindings
+}
+
+func printLintFindings(findings []lintFinding) {
+	for _, f := range findings {
+		l.Println(cp.Text + f.location + ": " + cp.Prompt + f.command + cp.Text + ": " + f.message + cp.Reset)
+	}
+}
+
+// lint the script of the command with the linter of its language
+// an exec is rendered into a temporary script the way it is run, with the globals and the arguments declared in front of it
+// findings in the lines inserted by zeus are ignored
+func (c *command) lint() (findings []lintFinding, err error) {
+
+	lang, err := c.getLanguage()
+	if err != nil {
+		return nil, err
+	}
+	if lang.Linter == "" {
+		return nil, nil
+	}
+
+	var (
+		path   = c.path
+		script string
+	)
+	if c.exec != "" {
+		script = c.renderScript(lang, c.lintGlobals(lang), c.lintArguments(lang))
+
+		// make sure the .tmp dir exists
+		os.MkdirAll(scriptDir+"/.tmp", 0700)
+		path = scriptDir + "/.tmp/" + c.name + "_" + randomString() + lang.FileExtension
+
+		err = ioutil.WriteFile(path, []byte(script), 0700)
+		if err != nil {
+			return nil, err
+		}
+		defer os.Remove(path)
+	}
+
+	out, err := exec.Command("sh", "-c", lang.Linter+" "+shellQuote(path)).CombinedOutput()
+	if exitCode(err) == 127 {
+		return nil, ErrLinterNotFound
+	}
+	// linters exit with a non zero status when reporting findings
+
+	preamble := c.preamble(script)
+	for _, line := range strings.Split(string(out), "\n") {
+
+		match := lintFindingPattern.FindStringSubmatch(strings.TrimSpace(line))
+		if match == nil || filepath.Base(match[1]) != filepath.Base(path) {
+			continue
+		}
+		n, _ := strconv.Atoi(match[2])
+
+		f := lintFinding{
+			command: c.name,
+			message: match[3],
+		}
+
+		n -= preamble
+		if n < 1 {
+			continue
+		}
+
+		if c.exec == "" {
+			f.location = c.path + ":" + strconv.Itoa(n)
+		} else if line := c.commandsFileLine(n); line > 0 {
+			f.location = commandsFilePath + ":" + strconv.Itoa(line)
+		} else {
+			// the exec is not from the CommandsFile
+			f.location = c.name + ":" + strconv.Itoa(n)
+		}
+		findings = append(findings, f)
+	}
+	return findings, nil
+}
+
+// declarations of the globals and the env of the command for linting
+// the values are not evaluated, dynamic globals are never executed
+func (c *command) lintGlobals(lang *Language) string {
+
+	var (
+		vars  = make(map[string]string)
+		types = make(map[string]string)
+	)
+
+	g.Lock()
+	for name, value := range c.globals(g.Vars) {
+		vars[name], types[name] = value, g.types[name]
+	}
+	g.Unlock()
+
+	for name, value := range c.env {
+		vars[name], types[name] = value, c.envTypes[name]
+	}
+	return lang.declare(vars, types)
+}
+
+// declarations of the arguments of the command with their default values for linting
+func (c *command) lintArguments(lang *Language) string {
+
+	var (
+		vars  = make(map[string]string)
+		types = make(map[string]string)
+	)
+	for _, arg := range c.args {
+
+		value := strings.TrimSpace(arg.defaultValue)
+		if value == "" {
+			value = getDefaultValue(arg)
+		}
+
+		switch arg.argType {
+		case reflect.Bool:
+			types[arg.name] = globalTypeBool
+		case reflect.Int:
+			types[arg.name] = globalTypeInt
+		case reflect.Float64:
+			types[arg.name] = globalTypeFloat
+		default:
+			types[arg.name] = globalTypeString
+		}
+		vars[arg.name] = value
+	}
+	return lang.declare(vars, types)
+}
+
+// lint the command with the script at path, when a script in the zeus directory has been saved
+func lintOnSave(path string) {
+
+	cmdMap.Lock()
+	var cmd *command
+	for _, c := range cmdMap.items {
+		if c.path != "" && c.path == path {
+			cmd = c
+			break
+		}
+	}
+	cmdMap.Unlock()
+
+	if cmd == nil {
+		return
+	}
+
+	findings, err := cmd.lint()
+	if err != nil {
+		Log.WithError(err).Error("failed to lint " + path)
+		return
+	}
+	printLintFindings(findings)
+}
@@ -0,0 +1,191 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timestamp format for the log file names
+const logFileTimestampFormat = "2006-01-02_15-04-05.000"
+
+func printLogsCommandUsageErr() {
+	l.Println(ErrInvalidUsage)
+	l.Println("usage: logs [<command>] [<command> tail]")
+}
+
+// get the configured log directory
+// returns an empty string if logging is disabled
+func logDir() string {
+	conf.Lock()
+	defer conf.Unlock()
+	return conf.fields.LogDir
+}
+
+// create a new log file for the named command
+// and remove the logs exceeding the retention limit
+func openCommandLog(name string) (*os.File, error) {
+
+	dir := logDir()
+
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Create(filepath.Join(dir, name+"-"+time.Now().Format(logFileTimestampFormat)+".log"))
+	if err != nil {
+		return nil, err
+	}
+
+	pruneCommandLogs(name)
+
+	return f, nil
+}
+
+// collect the log files for the named command, sorted from oldest to newest
+func commandLogs(name string) (logs []string) {
+
+	dir := logDir()
+	if dir == "" {
+		return
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	for _, f := range files {
+		if f.IsDir() || !strings.HasPrefix(f.Name(), name+"-") || !strings.HasSuffix(f.Name(), ".log") {
+			continue
+		}
+
+		// make sure the remainder is a timestamp
+		// otherwise the logs for build-race would show up for build
+		ts := strings.TrimSuffix(strings.TrimPrefix(f.Name(), name+"-"), ".log")
+		if _, err := time.Parse(logFileTimestampFormat, ts); err != nil {
+			continue
+		}
+
+		logs = append(logs, filepath.Join(dir, f.Name()))
+	}
+
+	sort.Strings(logs)
+	return
+}
+
+// remove old log files for the named command
+func pruneCommandLogs(name string) {
+
+	conf.Lock()
+	retention := conf.fields.LogRetention
+	conf.Unlock()
+
+	if retention <= 0 {
+		return
+	}
+
+	logs := commandLogs(name)
+	if len(logs) <= retention {
+		return
+	}
+
+	for _, path := range logs[:len(logs)-retention] {
+		err := os.Remove(path)
+		if err != nil {
+			Log.WithError(err).Error("failed to remove log file: ", path)
+		}
+	}
+}
+
+// handle logs shell command
+func handleLogsCommand(args []string) {
+
+	if logDir() == "" {
+		l.Println("logging is disabled. set the logDir config field to enable it.")
+		return
+	}
+
+	if len(args) < 2 {
+		printLogOverview()
+		return
+	}
+
+	logs := commandLogs(args[1])
+	if len(logs) == 0 {
+		l.Println("no logs for command: " + args[1])
+		return
+	}
+	latest := logs[len(logs)-1]
+
+	if len(args) > 2 {
+		if args[2] != "tail" {
+			printLogsCommandUsageErr()
+			return
+		}
+
+		// follow the log until interrupted
+		cmd := exec.Command("tail", "-f", latest)
+		wireEnv(cmd)
+		err := cmd.Run()
+		if err != nil {
+			Log.WithError(err).Debug("tail exited")
+		}
+		return
+	}
+
+	c, err := ioutil.ReadFile(latest)
+	if err != nil {
+		l.Println(err)
+		return
+	}
+
+	l.Println(cp.Prompt + latest + cp.Reset)
+	l.Print(string(c))
+}
+
+// print the number of logs and the latest run for each command
+func printLogOverview() {
+
+	cmdMap.Lock()
+	var names []string
+	for name := range cmdMap.items {
+		names = append(names, name)
+	}
+	cmdMap.Unlock()
+
+	sort.Strings(names)
+
+	w := 25
+	l.Println(cp.Prompt + pad("command", w) + pad("logs", 10) + "latest" + cp.Text)
+	for _, name := range names {
+		logs := commandLogs(name)
+		if len(logs) > 0 {
+			l.Println(pad(name, w) + pad(strconv.Itoa(len(logs)), 10) + logs[len(logs)-1])
+		}
+	}
+}
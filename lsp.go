@@ -0,0 +1,886 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// JSON-RPC error codes
+const (
+	lspMethodNotFound = -32601
+	lspInvalidParams  = -32602
+)
+
+// LSP constants
+const (
+	lspSyncFull            = 1
+	lspSeverityError       = 1
+	lspSeverityWarning     = 2
+	lspCompletionField     = 5
+	lspCompletionValue     = 12
+	lspCompletionReference = 18
+)
+
+var (
+	// ErrMissingContentLength occurs when a LSP message has no Content-Length header
+	ErrMissingContentLength = errors.New("missing Content-Length header")
+
+	// line number in YAML syntax errors
+	yamlErrorLine = regexp.MustCompile(`line (\d+)`)
+
+	// characters of a command name or field
+	lspWordChars = regexp.MustCompile(`[A-Za-z0-9_\-./]`)
+
+	// fields of the CommandsFile and of a single command
+	commandsFileFields = yamlFieldNames(CommandsFile{})
+	commandFields      = yamlFieldNames(commandData{})
+
+	// docs for field hovers and completions
+	lspFieldDocs = map[string]string{
+		"language":         "default language for all commands, or language of a single command",
+		"globals":          "global variables, visible for all commands",
+		"profiles":         "globals per environment, selected with zeus --env <profile> or the use builtin",
+		"licenses":         "allowed licenses for compliance checks",
+		"hooks":            "git hooks mapped to command chains",
+		"environment":      "tools, variables and services needed to work on the project, compared with the env builtin",
+		"fallback":         "command line that unknown commands and their arguments are passed to, for example: make",
+		"groups":           "groups of commands for the help and completions, mapped to their commands in display order",
+		"toolchain":        "tool versions that are downloaded into zeus/.toolchain and put in front of the PATH, like shfmt: 3.7.0",
+		"commands":         "all commands of the project",
+		"description":      "short description text for the command overview",
+		"help":             "help text for the help builtin",
+		"helpFile":         "Markdown file with the manual for the help builtin, relative to the project directory, instead of the help text",
+		"examples":         "invocations of the command with realistic argument values, shown by the help builtin and completed on the prompt",
+		"completionCmd":    "command line that prints argument values in the name=value format, completed on the prompt and the shell",
+		"arguments":        "list of typed arguments in the name:Type format, optionals are marked with ? and can have a default value: name:Type?=default",
+		"dependencies":     "commands that are run before the command, with their arguments",
+		"outputs":          "output files of the command, the command is skipped if they exist",
+		"skipIf":           "condition to skip the command, like: exists('dist/app') && env('CI') != 'true'",
+		"inputs":           "input files of the command, glob patterns or paths",
+		"reports":          "report files produced by the command, in the type=path format",
+		"ports":            "ports of a service in the variable=port format, checked before the command is started",
+		"requires":         "tools the command needs in the PATH with optional version constraints like docker >= 24, checked before the command and its dependencies are started",
+		"buildNumber":      "increase the build number on each execution",
+		"async":            "detach the command in a screen session",
+		"exec":             "the script of the command",
+		"path":             "custom path for the script file",
+		"compliance":       "license compliance check, executed before the command",
+		"sbom":             "generate checksums and a software bill of materials for the outputs",
+		"tty":              "run the command in a pseudo terminal",
+		"serve":            "run the built-in static file server instead of a script, with the fields dir, port and spa",
+		"env":              "variables merged over the project globals for this command, ${NAME} references globals and environment variables",
+		"finally":          "commands that run after the top-level run, even if a step failed or it was cancelled, the last registered first",
+		"onFailureCollect": "paths and glob patterns of files copied into the dump directory when the command fails, like test logs or screenshots",
+	}
+)
+
+// lspMessage is a JSON-RPC request or notification
+type lspMessage struct {
+	ID     *json.RawMessage `json:"id"`
+	Method string           `json:"method"`
+	Params json.RawMessage  `json:"params"`
+}
+
+type lspResponse struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id"`
+	Result  interface{}      `json:"result"`
+}
+
+type lspErrorResponse struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id"`
+	Error   *lspError        `json:"error"`
+}
+
+type lspError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type lspNotification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+type lspPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lspRange struct {
+	Start lspPosition `json:"start"`
+	End   lspPosition `json:"end"`
+}
+
+type lspLocation struct {
+	URI   string   `json:"uri"`
+	Range lspRange `json:"range"`
+}
+
+type lspDiagnostic struct {
+	Range    lspRange `json:"range"`
+	Severity int      `json:"severity"`
+	Source   string   `json:"source"`
+	Message  string   `json:"message"`
+}
+
+type lspCompletionItem struct {
+	Label         string `json:"label"`
+	Kind          int    `json:"kind"`
+	Detail        string `json:"detail,omitempty"`
+	Documentation string `json:"documentation,omitempty"`
+}
+
+type lspHover struct {
+	Contents lspMarkupContent `json:"contents"`
+}
+
+type lspMarkupContent struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+type lspTextDocument struct {
+	URI  string `json:"uri"`
+	Text string `json:"text"`
+}
+
+type lspPositionParams struct {
+	TextDocument lspTextDocument `json:"textDocument"`
+	Position     lspPosition     `json:"position"`
+}
+
+type lspDocumentParams struct {
+	TextDocument   lspTextDocument `json:"textDocument"`
+	ContentChanges []struct {
+		Text string `json:"text"`
+	} `json:"contentChanges"`
+}
+
+// lspServer speaks the language server protocol for CommandsFiles
+type lspServer struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	// contents of the open documents by URI
+	docs map[string]string
+
+	shutdown bool
+}
+
+// commandsFileOutline is a CommandsFile with the positions of its commands
+type commandsFileOutline struct {
+	commands    map[string]*outlineCommand
+	diagnostics []lspDiagnostic
+}
+
+// outlineCommand is a command of a CommandsFile
+type outlineCommand struct {
+	name  string
+	key   *yamlv3.Node
+	value *yamlv3.Node
+	data  *commandData
+	args  map[string]*commandArg
+}
+
+// run the language server on the supplied streams until the client sends exit
+// returns the exit code
+func serveLSP(in io.Reader, out io.Writer) int {
+
+	srv := &lspServer{
+		in:   bufio.NewReader(in),
+		out:  out,
+		docs: make(map[string]string, 0),
+	}
+
+	for {
+		msg, err := srv.read()
+		if err != nil {
+			if err != io.EOF {
+				Log.WithError(err).Error("failed to read LSP message")
+			}
+			break
+		}
+		if msg.Method == "exit" {
+			break
+		}
+		srv.handle(msg)
+	}
+
+	if srv.shutdown {
+		return 0
+	}
+	return 1
+}
+
+// read a single message
+func (srv *lspServer) read() (*lspMessage, error) {
+
+	var length int
+	for {
+		line, err := srv.in.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if parts := strings.SplitN(line, ":", 2); len(parts) == 2 && strings.EqualFold(parts[0], "Content-Length") {
+			length, err = strconv.Atoi(strings.TrimSpace(parts[1]))
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if length <= 0 {
+		return nil, ErrMissingContentLength
+	}
+
+	buf := make([]byte, length)
+	_, err := io.ReadFull(srv.in, buf)
+	if err != nil {
+		return nil, err
+	}
+
+	var msg lspMessage
+	return &msg, json.Unmarshal(buf, &msg)
+}
+
+// write a single message
+func (srv *lspServer) write(v interface{}) {
+	c, err := json.Marshal(v)
+	if err != nil {
+		Log.WithError(err).Error("failed to marshal LSP message")
+		return
+	}
+	_, err = io.WriteString(srv.out, "Content-Length: "+strconv.Itoa(len(c))+"\r\n\r\n"+string(c))
+	if err != nil {
+		Log.WithError(err).Error("failed to write LSP message")
+	}
+}
+
+func (srv *lspServer) reply(id *json.RawMessage, result interface{}) {
+	srv.write(&lspResponse{JSONRPC: "2.0", ID: id, Result: result})
+}
+
+func (srv *lspServer) replyError(id *json.RawMessage, code int, message string) {
+	srv.write(&lspErrorResponse{JSONRPC: "2.0", ID: id, Error: &lspError{Code: code, Message: message}})
+}
+
+// handle a request or notification
+func (srv *lspServer) handle(msg *lspMessage) {
+
+	switch msg.Method {
+	case "initialize":
+		srv.reply(msg.ID, map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync": lspSyncFull,
+				"completionProvider": map[string]interface{}{
+					"triggerCharacters": []string{" ", ":", "="},
+				},
+				"hoverProvider":      true,
+				"definitionProvider": true,
+			},
+			"serverInfo": map[string]string{
+				"name":    "zeus",
+				"version": version,
+			},
+		})
+
+	case "shutdown":
+		srv.shutdown = true
+		srv.reply(msg.ID, nil)
+
+	case "textDocument/didOpen", "textDocument/didChange", "textDocument/didClose":
+		var params lspDocumentParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return
+		}
+
+		uri := params.TextDocument.URI
+		switch msg.Method {
+		case "textDocument/didOpen":
+			srv.docs[uri] = params.TextDocument.Text
+		case "textDocument/didChange":
+			if n := len(params.ContentChanges); n > 0 {
+				srv.docs[uri] = params.ContentChanges[n-1].Text
+			}
+		default:
+			delete(srv.docs, uri)
+		}
+		srv.publishDiagnostics(uri)
+
+	case "textDocument/completion", "textDocument/hover", "textDocument/definition":
+		var params lspPositionParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			srv.replyError(msg.ID, lspInvalidParams, err.Error())
+			return
+		}
+
+		text, ok := srv.docs[params.TextDocument.URI]
+		if !ok || !isCommandsFileURI(params.TextDocument.URI) {
+			srv.reply(msg.ID, nil)
+			return
+		}
+
+		switch msg.Method {
+		case "textDocument/completion":
+			srv.reply(msg.ID, lspCompletion(text, params.Position))
+		case "textDocument/hover":
+			if h := lspHoverAt(text, params.Position); h != nil {
+				srv.reply(msg.ID, h)
+			} else {
+				srv.reply(msg.ID, nil)
+			}
+		default:
+			if r := lspDefinition(text, params.Position); r != nil {
+				srv.reply(msg.ID, &lspLocation{URI: params.TextDocument.URI, Range: *r})
+			} else {
+				srv.reply(msg.ID, nil)
+			}
+		}
+
+	default:
+		// notifications need no answer
+		if msg.ID != nil {
+			srv.replyError(msg.ID, lspMethodNotFound, "method not found: "+msg.Method)
+		}
+	}
+}
+
+// send the diagnostics for a document
+func (srv *lspServer) publishDiagnostics(uri string) {
+
+	diagnostics := []lspDiagnostic{}
+	if text, ok := srv.docs[uri]; ok && isCommandsFileURI(uri) {
+		diagnostics = append(diagnostics, parseOutline(text).diagnostics...)
+	}
+
+	srv.write(&lspNotification{
+		JSONRPC: "2.0",
+		Method:  "textDocument/publishDiagnostics",
+		Params: map[string]interface{}{
+			"uri":         uri,
+			"diagnostics": diagnostics,
+		},
+	})
+}
+
+// only YAML documents are treated as CommandsFiles
+func isCommandsFileURI(uri string) bool {
+	ext := filepath.Ext(uri)
+	return ext == ".yml" || ext == ".yaml"
+}
+
+// collect the yaml tags of a struct
+func yamlFieldNames(v interface{}) (names []string) {
+	t := reflect.TypeOf(v)
+	for i := 0; i < t.NumField(); i++ {
+		if tag := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]; tag != "" && tag != "-" {
+			names = append(names, tag)
+		}
+	}
+	sort.Strings(names)
+	return
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// range of a node, YAML positions start at 1 while LSP positions start at 0
+func nodeRange(n *yamlv3.Node) lspRange {
+	start := lspPosition{Line: n.Line - 1, Character: n.Column - 1}
+	return lspRange{
+		Start: start,
+		End:   lspPosition{Line: start.Line, Character: start.Character + len(n.Value)},
+	}
+}
+
+func (o *commandsFileOutline) addDiagnostic(n *yamlv3.Node, severity int, message string) {
+	o.diagnostics = append(o.diagnostics, lspDiagnostic{
+		Range:    nodeRange(n),
+		Severity: severity,
+		Source:   "zeus",
+		Message:  message,
+	})
+}
+
+func isKnownLanguage(name string) bool {
+	ls.Lock()
+	defer ls.Unlock()
+	_, ok := ls.items[name]
+	return ok
+}
+
+// parse a CommandsFile and collect diagnostics for
+// syntax errors, unknown fields, unknown languages, invalid argument declarations,
+// unknown dependencies and invalid dependency arguments
+func parseOutline(text string) *commandsFileOutline {
+
+	var (
+		o = &commandsFileOutline{
+			commands:    make(map[string]*outlineCommand, 0),
+			diagnostics: []lspDiagnostic{},
+		}
+		doc   yamlv3.Node
+		hooks *yamlv3.Node
+	)
+
+	err := yamlv3.Unmarshal([]byte(text), &doc)
+	if err != nil {
+		line := 1
+		if m := yamlErrorLine.FindStringSubmatch(err.Error()); m != nil {
+			line, _ = strconv.Atoi(m[1])
+		}
+		o.addDiagnostic(&yamlv3.Node{Line: line, Column: 1}, lspSeverityError, err.Error())
+		return o
+	}
+
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yamlv3.MappingNode {
+		return o
+	}
+	root := doc.Content[0]
+
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key, value := root.Content[i], root.Content[i+1]
+
+		switch key.Value {
+		case "language":
+			if !isKnownLanguage(value.Value) {
+				o.addDiagnostic(value, lspSeverityError, ErrUnknownLanguage.Error()+": "+value.Value)
+			}
+		case "hooks":
+			hooks = value
+		case "commands":
+			o.parseCommands(value)
+		default:
+			if !contains(commandsFileFields, key.Value) {
+				o.addDiagnostic(key, lspSeverityError, "unknown field: "+key.Value)
+			}
+		}
+	}
+
+	// dependencies can only be checked once all commands are known
+	for _, name := range sortedCommandNames(o.commands) {
+		o.checkDependencies(o.commands[name])
+	}
+
+	if hooks != nil && hooks.Kind == yamlv3.MappingNode {
+		for i := 0; i+1 < len(hooks.Content); i += 2 {
+			key, value := hooks.Content[i], hooks.Content[i+1]
+			if !isGitHook(key.Value) {
+				o.addDiagnostic(key, lspSeverityError, ErrUnknownGitHook.Error()+": "+key.Value)
+			}
+			for _, step := range strings.Split(value.Value, commandChainSeparator) {
+				elems, _, err := parseChainStep(step)
+				if err != nil {
+					o.addDiagnostic(value, lspSeverityError, err.Error())
+					continue
+				}
+				for _, elem := range elems {
+					if fields := strings.Fields(elem); len(fields) > 0 && o.commands[fields[0]] == nil {
+						o.addDiagnostic(value, lspSeverityError, ErrUnknownCommand.Error()+": "+fields[0])
+					}
+				}
+			}
+		}
+	}
+
+	return o
+}
+
+// collect the commands and check their fields and argument declarations
+func (o *commandsFileOutline) parseCommands(commands *yamlv3.Node) {
+
+	if commands.Kind != yamlv3.MappingNode {
+		return
+	}
+
+	for i := 0; i+1 < len(commands.Content); i += 2 {
+
+		var (
+			key, value = commands.Content[i], commands.Content[i+1]
+			cmd        = &outlineCommand{
+				name:  key.Value,
+				key:   key,
+				value: value,
+				data:  &commandData{},
+				args:  make(map[string]*commandArg, 0),
+			}
+		)
+		o.commands[cmd.name] = cmd
+
+		if value.Kind != yamlv3.MappingNode {
+			continue
+		}
+
+		err := value.Decode(cmd.data)
+		if err != nil {
+			o.addDiagnostic(key, lspSeverityError, err.Error())
+		}
+
+		for j := 0; j+1 < len(value.Content); j += 2 {
+			field, fieldValue := value.Content[j], value.Content[j+1]
+
+			switch {
+			case !contains(commandFields, field.Value):
+				o.addDiagnostic(field, lspSeverityError, "unknown field: "+field.Value)
+			case field.Value == "language" && !isKnownLanguage(fieldValue.Value):
+				o.addDiagnostic(fieldValue, lspSeverityError, ErrUnknownLanguage.Error()+": "+fieldValue.Value)
+			case field.Value == "helpFile":
+				if _, err := os.Stat(fieldValue.Value); err != nil {
+					o.addDiagnostic(fieldValue, lspSeverityWarning, "help file not found: "+fieldValue.Value)
+				}
+			case field.Value == "skipIf":
+				if _, err := parseExpression(fieldValue.Value); err != nil {
+					o.addDiagnostic(fieldValue, lspSeverityError, err.Error())
+				}
+			case field.Value == "arguments":
+				for _, item := range fieldValue.Content {
+					arg, err := parseArgument(item.Value)
+					if err != nil {
+						o.addDiagnostic(item, lspSeverityError, err.Error())
+						continue
+					}
+					if _, ok := cmd.args[arg.name]; ok {
+						o.addDiagnostic(item, lspSeverityError, ErrDuplicateArgumentNames.Error()+": "+arg.name)
+						continue
+					}
+					cmd.args[arg.name] = arg
+				}
+			}
+		}
+	}
+}
+
+// check that all dependencies exist and their arguments match the declared types
+func (o *commandsFileOutline) checkDependencies(cmd *outlineCommand) {
+
+	deps := cmd.field("dependencies")
+	if deps == nil {
+		return
+	}
+
+	for _, item := range deps.Content {
+
+		fields := strings.Fields(strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(item.Value), orderOnlyPrefix), asyncDependencySuffix))
+		if len(fields) == 0 {
+			continue
+		}
+
+		dep, ok := o.commands[fields[0]]
+		if !ok {
+			o.addDiagnostic(item, lspSeverityError, "unknown dependency: "+fields[0])
+			continue
+		}
+		if dep.name == cmd.name {
+			o.addDiagnostic(item, lspSeverityError, "command "+cmd.name+" has itself as dependency")
+			continue
+		}
+
+		supplied := make(map[string]bool, 0)
+		for _, a := range fields[1:] {
+			kv := strings.SplitN(a, "=", 2)
+			if len(kv) != 2 {
+				o.addDiagnostic(item, lspSeverityError, "invalid argument: "+a)
+				continue
+			}
+			arg, ok := dep.args[kv[0]]
+			if !ok {
+				o.addDiagnostic(item, lspSeverityError, ErrInvalidArgumentLabel.Error()+": "+kv[0])
+				continue
+			}
+			if err := validArgType(kv[1], arg.argType); err != nil {
+				o.addDiagnostic(item, lspSeverityError, argTypeError(kv[0], arg.argType, kv[1], err).Error())
+			}
+			supplied[kv[0]] = true
+		}
+
+		for _, name := range sortedArgNames(dep.args) {
+			if arg := dep.args[name]; !arg.optional && !supplied[name] {
+				o.addDiagnostic(item, lspSeverityError, "missing argument: "+name+":"+strings.Title(arg.argType.String()))
+			}
+		}
+	}
+}
+
+// value node of a command field
+func (cmd *outlineCommand) field(name string) *yamlv3.Node {
+	if cmd.value.Kind != yamlv3.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(cmd.value.Content); i += 2 {
+		if cmd.value.Content[i].Value == name {
+			return cmd.value.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func sortedCommandNames(commands map[string]*outlineCommand) (names []string) {
+	for name := range commands {
+		names = append(names, name)
+	}
+	sortCommandNames(names)
+	return
+}
+
+func sortedArgNames(args map[string]*commandArg) (names []string) {
+	for name := range args {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
+
+// the word under the cursor
+func wordAt(line string, character int) string {
+	if character > len(line) {
+		character = len(line)
+	}
+	start, end := character, character
+	for start > 0 && lspWordChars.MatchString(line[start-1:start]) {
+		start--
+	}
+	for end < len(line) && lspWordChars.MatchString(line[end:end+1]) {
+		end++
+	}
+	return line[start:end]
+}
+
+// keys of the parent mappings of a line, determined by indentation
+func keyPath(lines []string, line int) (path []string) {
+
+	if line >= len(lines) {
+		return nil
+	}
+
+	// list items may start at the indentation of their key
+	threshold := countLeadingSpace(lines[line])
+	if strings.HasPrefix(strings.TrimSpace(lines[line]), "-") {
+		threshold++
+	}
+
+	for i := line - 1; i >= 0 && threshold > 0; i-- {
+		trimmed := strings.TrimSpace(lines[i])
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, "-") {
+			continue
+		}
+		indent := countLeadingSpace(lines[i])
+		if indent < threshold {
+			if key := strings.SplitN(trimmed, ":", 2)[0]; key != trimmed {
+				path = append([]string{key}, path...)
+			}
+			threshold = indent
+		}
+	}
+	return
+}
+
+func completionItems(kind int, labels ...string) (items []lspCompletionItem) {
+	for _, label := range labels {
+		items = append(items, lspCompletionItem{
+			Label:         label,
+			Kind:          kind,
+			Documentation: lspFieldDocs[label],
+		})
+	}
+	return
+}
+
+// completion items for the position in the CommandsFile
+func lspCompletion(text string, pos lspPosition) []lspCompletionItem {
+
+	var (
+		lines  = strings.Split(text, "\n")
+		o      = parseOutline(text)
+		items  = []lspCompletionItem{}
+		prefix string
+	)
+	if pos.Line >= len(lines) {
+		return items
+	}
+	if line := lines[pos.Line]; pos.Character <= len(line) {
+		prefix = strings.TrimLeft(line[:pos.Character], " \t")
+	}
+
+	var (
+		path  = keyPath(lines, pos.Line)
+		item  = strings.TrimLeft(strings.TrimPrefix(prefix, "-"), " ")
+		names = sortedCommandNames(o.commands)
+	)
+
+	switch {
+	case strings.HasPrefix(prefix, "language:"):
+		ls.Lock()
+		var langs []string
+		for name := range ls.items {
+			langs = append(langs, name)
+		}
+		ls.Unlock()
+		sort.Strings(langs)
+		return append(items, completionItems(lspCompletionValue, langs...)...)
+
+	case len(path) == 0:
+		return append(items, completionItems(lspCompletionField, commandsFileFields...)...)
+
+	case path[0] == "hooks":
+		if strings.Contains(prefix, ":") {
+			return append(items, completionItems(lspCompletionReference, names...)...)
+		}
+		return append(items, completionItems(lspCompletionValue, gitHookNames...)...)
+
+	case path[0] != "commands":
+		return items
+
+	case len(path) == 2:
+		return append(items, completionItems(lspCompletionField, commandFields...)...)
+
+	case len(path) == 3 && path[2] == "dependencies":
+
+		// arguments of the dependency
+		if fields := strings.Fields(item); len(fields) > 1 || (len(fields) == 1 && strings.HasSuffix(item, " ")) {
+			if dep, ok := o.commands[fields[0]]; ok {
+				for _, name := range sortedArgNames(dep.args) {
+					arg := dep.args[name]
+					items = append(items, lspCompletionItem{
+						Label:  name + "=",
+						Kind:   lspCompletionField,
+						Detail: arg.typeName(),
+					})
+				}
+			}
+			return items
+		}
+
+		for _, name := range names {
+			items = append(items, lspCompletionItem{
+				Label:  name,
+				Kind:   lspCompletionReference,
+				Detail: o.commands[name].data.Description,
+			})
+		}
+		return items
+
+	case len(path) == 3 && path[2] == "arguments" && strings.Contains(item, ":"):
+		for _, t := range []string{argTypeString, argTypeInt, argTypeBool, argTypeFloat, argTypePath} {
+			items = append(items, completionItems(lspCompletionValue, t, t+"?")...)
+		}
+		return items
+	}
+
+	return items
+}
+
+// hover docs for commands and fields
+func lspHoverAt(text string, pos lspPosition) *lspHover {
+
+	lines := strings.Split(text, "\n")
+	if pos.Line >= len(lines) {
+		return nil
+	}
+
+	var (
+		o    = parseOutline(text)
+		line = lines[pos.Line]
+		word = wordAt(line, pos.Character)
+	)
+	if word == "" {
+		return nil
+	}
+
+	// field docs are shown for keys
+	path := keyPath(lines, pos.Line)
+	if strings.HasPrefix(strings.TrimSpace(line), word+":") && (len(path) == 0 || (len(path) == 2 && path[0] == "commands")) {
+		if doc, ok := lspFieldDocs[word]; ok {
+			return &lspHover{Contents: lspMarkupContent{Kind: "markdown", Value: "**" + word + "**\n\n" + doc}}
+		}
+	}
+
+	cmd, ok := o.commands[word]
+	if !ok {
+		return nil
+	}
+
+	var b strings.Builder
+	b.WriteString("**" + cmd.name + "**")
+	if cmd.data.Description != "" {
+		b.WriteString("\n\n" + cmd.data.Description)
+	}
+	if cmd.data.Help != "" {
+		b.WriteString("\n\n" + strings.TrimSpace(cmd.data.Help))
+	}
+	if cmd.data.HelpFile != "" {
+		if contents, err := ioutil.ReadFile(cmd.data.HelpFile); err == nil {
+			b.WriteString("\n\n" + strings.TrimSpace(string(contents)))
+		}
+	}
+	if len(cmd.data.Arguments) > 0 {
+		b.WriteString("\n\narguments: `" + strings.Join(cmd.data.Arguments, "`, `") + "`")
+	}
+	if len(cmd.data.Dependencies) > 0 {
+		b.WriteString("\n\ndependencies: `" + strings.Join(cmd.data.Dependencies, "`, `") + "`")
+	}
+	if len(cmd.data.Examples) > 0 {
+		b.WriteString("\n\nexamples:\n\n    " + strings.Join(cmd.data.Examples, "\n    "))
+	}
+
+	return &lspHover{Contents: lspMarkupContent{Kind: "markdown", Value: b.String()}}
+}
+
+// location of the command under the cursor
+func lspDefinition(text string, pos lspPosition) *lspRange {
+
+	lines := strings.Split(text, "\n")
+	if pos.Line >= len(lines) {
+		return nil
+	}
+
+	cmd, ok := parseOutline(text).commands[wordAt(lines[pos.Line], pos.Character)]
+	if !ok {
+		return nil
+	}
+
+	r := nodeRange(cmd.key)
+	return &r
+}
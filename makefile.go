@@ -21,7 +21,7 @@ package main
 import (
 	"bytes"
 	"io/ioutil"
-	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 )
@@ -29,16 +29,39 @@ import (
 // regular expressions to match various elements from a makefile
 var (
 	makefileTarget = regexp.MustCompile("^[^\\s]*([a-z]+):")
-	makeTargetBody = regexp.MustCompile("^[\\s\\p{Zs}]+")
 
-	global               = regexp.MustCompile("^[^\\s]*([A-Z]+)(\\s)*(=)")
-	makefileVar          = regexp.MustCompile("\\$\\([A-Z]+(_[A-Z]+)*\\)")
-	makefileShellCommand = regexp.MustCompile("\\$\\(shell(\\s*([\\w|\\S]*))*\\)")
+	makefileAssignment   = regexp.MustCompile("^(?:export\\s+|override\\s+)?([A-Za-z_][A-Za-z0-9_]*)\\s*(\\?=|::=|:=|\\+=|!=|=)\\s*(.*)$")
+	makefileRuleLine     = regexp.MustCompile("^([^:=#\\t]+?)\\s*::?\\s*([^=]*)$")
+	makefileDirective    = regexp.MustCompile("^-?(ifeq|ifneq|ifdef|ifndef|else|endif|include|sinclude|define|endef|vpath|unexport|export|override)(\\s|$)")
+	makefileVar          = regexp.MustCompile("\\$[({]([A-Za-z_][A-Za-z0-9_]*)[)}]")
+	makefileShellCommand = regexp.MustCompile("\\$\\(shell\\s+([^()]*)\\)")
+	makefileFunction     = regexp.MustCompile("\\$[({]([a-z-]+)\\s")
+	makefileAutoVar      = regexp.MustCompile("\\$(?:([@<^+*?|])|[({]([@<^+*?|])([DF]?)[)}])")
+	makefileMake         = regexp.MustCompile("\\$[({]MAKE[)}]")
 
-	bashBuiltin = regexp.MustCompile("(@[a-z]*\\s+)")
-	makeCommand = regexp.MustCompile("make\\s+[a-z0-9]+")
+	makeCommand = regexp.MustCompile("(^|[;&|\\s])make\\s+")
 )
 
+// escaped dollar signs are swapped for this placeholder during translation
+const makefileDollar = "\x00"
+
+// a rule parsed from a Makefile
+type makefileRule struct {
+	line    int
+	targets []string
+	prereqs []string
+	recipe  []string
+
+	// prerequisites after the |, they are built first but never make the target stale
+	orderOnly []string
+
+	// stem of a target generated from a pattern rule
+	stem string
+
+	// target pattern of the rule the target was generated from
+	pattern string
+}
+
 // print an overview of the available makefile commands to stdout
 func printMakefileCommandOverview() {
 
@@ -60,211 +83,494 @@ func printMakefileCommandOverview() {
 }
 
 // migrate Makefile into a zeus command folder
-func migrateMakefile(zeusDirectory string) {
+func migrateMakefile(zeusDirectory, policy string) {
 
-	var (
-		file            *os.File
-		cmdFile         *os.File
-		writeInProgress bool
-		err             error
-		perm            = os.FileMode(0700)
-		dir             = zeusDirectory
-	)
+	var makefileDir = "."
 
-	Log.WithField("dir", dir).Info("Makefile migration started.")
+	Log.WithField("dir", zeusDirectory).Info("Makefile migration started.")
 
 	contents, err := ioutil.ReadFile("Makefile")
 	if err != nil {
 		if testingMode {
+			makefileDir = "tests"
 			contents, err = ioutil.ReadFile("tests/Makefile")
-		} else {
+		}
+		if err != nil {
 			Log.WithError(err).Error("unable to read Makefile")
 			return
 		}
 	}
 
-	// bail out if a command with the same name exists
-	for _, line := range bytes.Split(contents, []byte("\n")) {
+	err = translateMakefile(contents, makefileDir).write(zeusDirectory, policy)
+	if err != nil {
+		l.Println(err)
+	}
+}
 
-		if makefileTarget.Match(line) && !bytes.Contains(line, []byte("\t")) {
+// translate the contents of a Makefile into globals and commands
+// dir is used to look up files for expanding pattern rules
+func translateMakefile(contents []byte, dir string) *migration {
+
+	var (
+		m        = newMigration("Makefile")
+		phony    = make(map[string]bool)
+		rules    []*makefileRule
+		patterns []*makefileRule
+		current  *makefileRule
+		inDefine bool
+		lines    = strings.Split(string(contents), "\n")
+	)
+
+	for i := 0; i < len(lines); i++ {
+
+		var (
+			line = strings.TrimRight(lines[i], "\r")
+			num  = i + 1
+		)
+
+		// recipe lines are handed to the shell as they are
+		if current != nil && strings.HasPrefix(line, "\t") {
+			current.recipe = append(current.recipe, line)
+			continue
+		}
+
+		// join continued lines outside of recipes
+		for strings.HasSuffix(line, "\\") && i+1 < len(lines) {
+			i++
+			line = strings.TrimRight(strings.TrimSuffix(line, "\\"), " \t") + " " + strings.TrimSpace(lines[i])
+		}
+
+		trimmed := strings.TrimSpace(line)
+
+		if inDefine {
+			if strings.HasPrefix(trimmed, "endef") {
+				inDefine = false
+			}
+			continue
+		}
 
-			targetName := strings.TrimSuffix(string(line), ":")
+		// blank lines can be used for formatting inside recipes
+		if trimmed == "" {
+			if current != nil {
+				current.recipe = append(current.recipe, "")
+			}
+			continue
+		}
+		if strings.HasPrefix(trimmed, "#") {
+			continue
+		}
 
-			cmdMap.Lock()
-			if _, ok := cmdMap.items[targetName]; ok {
-				cmdMap.Unlock()
-				Log.Error("makefile target name '" + targetName + "' already taken. please choose a different name.")
-				return
+		current = nil
+
+		if match := makefileAssignment.FindStringSubmatch(trimmed); match != nil {
+			m.assign(match[1], match[2], match[3], num)
+			continue
+		}
+
+		if match := makefileDirective.FindStringSubmatch(trimmed); match != nil {
+			switch match[1] {
+			case "define":
+				inDefine = true
+				m.note(num, "multi line variable: "+trimmed)
+			case "ifeq", "ifneq", "ifdef", "ifndef", "else", "endif":
+				m.note(num, "conditional, both branches were migrated: "+trimmed)
+			default:
+				m.note(num, trimmed)
 			}
-			cmdMap.Unlock()
+			continue
+		}
+
+		// split off a recipe on the same line
+		var inline string
+		if pos := strings.Index(trimmed, ";"); pos != -1 {
+			inline = strings.TrimSpace(trimmed[pos+1:])
+			trimmed = trimmed[:pos]
+		}
+
+		match := makefileRuleLine.FindStringSubmatch(trimmed)
+		if match == nil {
+			m.note(num, trimmed)
+			continue
+		}
+
+		r := &makefileRule{
+			line:    num,
+			targets: strings.Fields(match[1]),
+		}
+
+		// order only prerequisites follow the |
+		var orderOnly bool
+		for _, p := range strings.Fields(match[2]) {
+			switch {
+			case p == "|":
+				orderOnly = true
+			case orderOnly:
+				r.orderOnly = append(r.orderOnly, p)
+			default:
+				r.prereqs = append(r.prereqs, p)
+			}
+		}
+		if inline != "" {
+			r.recipe = append(r.recipe, inline)
+		}
+
+		switch {
+		case r.targets[0] == ".PHONY":
+			for _, p := range r.prereqs {
+				phony[p] = true
+			}
+		case strings.HasPrefix(r.targets[0], "."):
+			m.note(num, "special target: "+trimmed)
+		case strings.Contains(match[1], "%"):
+			patterns = append(patterns, r)
+			current = r
+		default:
+			rules = append(rules, r)
+			current = r
 		}
 	}
 
-	// create dir
-	err = os.MkdirAll(dir, perm)
-	if err != nil {
-		Log.WithError(err).Error("failed to create: ", dir)
-		return
+	rules = mergeMakefileRules(rules)
+	rules = append(rules, m.expandPatterns(rules, patterns, dir)...)
+
+	// collect all targets to tell dependencies apart from input files
+	var targets = make(map[string]bool)
+	for _, r := range rules {
+		targets[r.targets[0]] = true
 	}
 
-	// make sure a commandsFile exists
-	_, err = os.Stat(commandsFilePath)
-	if err != nil {
-		cmdFile, err = os.Create(commandsFilePath)
-		if err != nil {
-			l.Println(err)
-			return
+	for _, r := range rules {
+		m.commands = append(m.commands, m.translateRule(r, targets, phony))
+	}
+
+	for _, name := range sortedSet(phony) {
+		if !targets[name] {
+			m.note(0, "phony target without rule: "+name)
 		}
-	} else {
-		cmdFile, err = os.OpenFile(commandsFilePath, os.O_APPEND|os.O_WRONLY, 0700)
-		if err != nil {
-			l.Println(err)
+	}
+
+	return m
+}
+
+// translate a variable assignment into a global
+func (m *migration) assign(name, operator, value string, line int) {
+
+	value, unsupported := translateMakeValue(strings.TrimSpace(value), nil)
+	for _, f := range unsupported {
+		m.note(line, "make function "+f+" in variable "+name)
+	}
+
+	// quotes are passed on literally by make, but the globals are quoted for the shell anyway
+	if len(value) > 1 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		value = value[1 : len(value)-1]
+	}
+
+	existing, ok := m.globals[name]
+	switch operator {
+	case "?=":
+		if ok {
 			return
 		}
+	case "+=":
+		if ok && existing != "" {
+			value = existing + " " + value
+		}
+	case "!=":
+		value = "$(" + value + ")"
+	}
+
+	if !ok {
+		m.globalNames = append(m.globalNames, name)
 	}
-	defer cmdFile.Close()
+	m.globals[name] = value
+}
+
+// merge multiple rules for the same target into one
+func mergeMakefileRules(rules []*makefileRule) (merged []*makefileRule) {
 
-	for _, line := range bytes.Split(contents, []byte("\n")) {
+	var index = make(map[string]*makefileRule)
 
-		if writeInProgress {
+	for _, r := range rules {
+		for _, t := range r.targets {
 
-			// write empty lines to file
-			// they can can be used used for formatting
-			// which is perfectly valid in makefiles
-			if len(line) == 0 {
-				file.WriteString(string(line) + "\n")
+			if existing, ok := index[t]; ok {
+				existing.prereqs = append(existing.prereqs, r.prereqs...)
+				existing.orderOnly = append(existing.orderOnly, r.orderOnly...)
+				if len(existing.recipe) == 0 {
+					existing.recipe = r.recipe
+				}
 				continue
 			}
 
-			// match everything preceded by whitespace
-			if makeTargetBody.Match(line) {
-
-				line = migrateLine(line)
-
-				// write to file
-				file.WriteString(string(line) + "\n")
-			} else {
-				writeInProgress = false
+			// rules with multiple targets produce one command per target
+			single := &makefileRule{
+				line:      r.line,
+				targets:   []string{t},
+				prereqs:   append([]string{}, r.prereqs...),
+				recipe:    r.recipe,
+				orderOnly: append([]string{}, r.orderOnly...),
 			}
+			index[t] = single
+			merged = append(merged, single)
 		}
+	}
 
-		if makefileTarget.Match(line) && !makeTargetBody.Match(line) {
+	return
+}
+
+// expand pattern rules for all stems that are referenced as prerequisites
+// or can be found as files matching the first prerequisite pattern
+func (m *migration) expandPatterns(rules, patterns []*makefileRule, dir string) (expanded []*makefileRule) {
+
+	var explicit = make(map[string]bool)
+	for _, r := range rules {
+		explicit[r.targets[0]] = true
+	}
 
-			l.Println("migrating target ~> " + strings.TrimSuffix(string(line), ":"))
+	for _, p := range patterns {
+		for _, targetPattern := range p.targets {
 
 			var (
-				args       = strings.Split(string(line), " ")
-				targetName = strings.TrimSuffix(args[0], ":")
-				filename   = dir + "/" + targetName + ".sh"
+				stems  = make(map[string]bool)
+				prefix = targetPattern[:strings.Index(targetPattern, "%")]
+				suffix = targetPattern[strings.Index(targetPattern, "%")+1:]
 			)
 
-			file, err = os.OpenFile(filename, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, perm)
-			if err != nil {
-				Log.WithError(err).Error("failed to create file: ", filename, "permMode: ", perm)
+			for _, r := range rules {
+				for _, prereq := range r.prereqs {
+					if stem, ok := makefileStem(prereq, prefix, suffix); ok {
+						stems[stem] = true
+					}
+				}
 			}
-			defer file.Close()
 
-			file.WriteString("#!/bin/bash" + "\n\n")
+			if len(p.prereqs) > 0 && strings.Contains(p.prereqs[0], "%") {
+
+				var (
+					source       = p.prereqs[0]
+					sourcePrefix = source[:strings.Index(source, "%")]
+					sourceSuffix = source[strings.Index(source, "%")+1:]
+				)
+
+				files, _ := filepath.Glob(filepath.Join(dir, strings.Replace(source, "%", "*", 1)))
+				for _, f := range files {
+					rel, err := filepath.Rel(dir, f)
+					if err != nil {
+						continue
+					}
+					if stem, ok := makefileStem(filepath.ToSlash(rel), sourcePrefix, sourceSuffix); ok {
+						stems[stem] = true
+					}
+				}
+			}
 
-			var depString string
-			if len(args[1:]) > 0 {
-				depString = "\n            - " + strings.Join(args[1:], "\n            - ")
+			if len(stems) == 0 {
+				m.note(p.line, "pattern rule without matching files: "+targetPattern)
+				continue
 			}
 
-			blockWriteEvent()
-
-			// add entry to cmdFile
-			cmdFile.WriteString("\n" + `    ` + targetName + `:
-        description: description for command ` + targetName + `
-        help: help text for command ` + targetName + `
-        arguments:
-        dependencies:` + depString + `
-        outputs:
-`)
-			writeInProgress = true
+			for _, stem := range sortedSet(stems) {
+
+				target := strings.Replace(targetPattern, "%", stem, 1)
+				if explicit[target] {
+					continue
+				}
+
+				r := &makefileRule{
+					line:    p.line,
+					targets: []string{target},
+					recipe:  p.recipe,
+					stem:    stem,
+					pattern: targetPattern,
+				}
+				for _, prereq := range p.prereqs {
+					r.prereqs = append(r.prereqs, strings.Replace(prereq, "%", stem, 1))
+				}
+				for _, prereq := range p.orderOnly {
+					r.orderOnly = append(r.orderOnly, strings.Replace(prereq, "%", stem, 1))
+				}
+				expanded = append(expanded, r)
+			}
 		}
 	}
 
-	// handle globals
-	migrateGlobals(contents)
+	return
+}
 
-	// parse commands
-	err = parseCommandsFile(commandsFilePath)
-	if err != nil {
-		l.Println(err)
+// return the part of name matched by the % of a pattern
+func makefileStem(name, prefix, suffix string) (string, bool) {
+	if len(name) <= len(prefix)+len(suffix) || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, suffix) {
+		return "", false
 	}
+	return name[len(prefix) : len(name)-len(suffix)], true
 }
 
-func migrateLine(line []byte) []byte {
-
-	// trim whitespace
-	line = bytes.TrimSpace(line)
+// translate a single rule into a command
+func (m *migration) translateRule(r *makefileRule, targets, phony map[string]bool) *migratedCommand {
 
-	// replace '@builtin' with 'builtin'
-	line = bashBuiltin.ReplaceAll(line, bytes.TrimPrefix(bashBuiltin.Find(line), []byte("@")))
+	var (
+		target = r.targets[0]
+		c      = &migratedCommand{
+			name:        migratedCommandName(target),
+			description: "migrated from Makefile target " + target,
+		}
+		seen   = make(map[string]bool)
+		unique []string
+	)
 
-	// replace $(VAR) with $VAR
-	var step1 = bytes.TrimSuffix(bytes.TrimPrefix(makefileVar.Find(line), []byte("$(")), []byte(")")) // VAR
+	if r.pattern != "" {
+		c.description = "migrated from Makefile pattern rule for " + r.pattern
+	}
 
-	// escaping the $ with another $ is important here,
-	// otherwise the regex engine treats it as an expansion!
-	var replace = append([]byte("$$"), step1...) // $VAR
+	for _, p := range r.prereqs {
+		if seen[p] {
+			continue
+		}
+		seen[p] = true
+		unique = append(unique, p)
 
-	line = makefileVar.ReplaceAll(line, replace)
+		if targets[p] {
+			c.dependencies = append(c.dependencies, migratedCommandName(p))
+		} else {
+			c.inputs = append(c.inputs, p)
+		}
+	}
 
-	// replace $(shell ...) commands with $(...)
-	// replace $(shell command > test) with $(command > test)
-	step1 = bytes.TrimPrefix(makefileShellCommand.Find(line), []byte("$(shell ")) // command > test)
+	// order only prerequisites without a rule are usually directories that exist already
+	for _, p := range r.orderOnly {
+		if targets[p] && !seen[p] {
+			seen[p] = true
+			c.dependencies = append(c.dependencies, orderOnlyPrefix+" "+migratedCommandName(p))
+		}
+	}
 
-	replace = append([]byte("$("), step1...) // $(command > test)
-	line = makefileShellCommand.ReplaceAll(line, replace)
+	// phony targets never produce a file
+	if !phony[target] && strings.ContainsAny(target, "./") {
+		c.outputs = append(c.outputs, target)
+	}
 
-	// replace all make <command> with zeus <command>
-	if makeCommand.Match(line) {
-		line = bytes.Replace(line, []byte("make"), []byte("zeus"), -1)
+	var first string
+	if len(r.prereqs) > 0 {
+		first = r.prereqs[0]
+	}
+	autos := map[string]string{
+		"@": target,
+		"<": first,
+		"^": strings.Join(unique, " "),
+		"+": strings.Join(r.prereqs, " "),
+		"?": strings.Join(unique, " "),
+		"*": r.stem,
+		"|": strings.Join(r.orderOnly, " "),
 	}
 
-	// convert if statements
-	if bytes.HasSuffix(line, []byte("\\")) {
+	for _, line := range r.recipe {
 
-		if bytes.HasPrefix(line, []byte("if")) {
-			line = bytes.TrimSuffix(line, []byte("\\"))
-			line = append(line, []byte("then")...)
-		} else if bytes.HasPrefix(line, []byte("then")) {
-			// delete line with then
-			line = []byte{}
-		} else {
-			line = bytes.TrimSuffix(line, []byte("\\"))
-			line = bytes.TrimSpace(line)
-			line = bytes.TrimSuffix(line, []byte(";"))
-			line = append([]byte("\t"), line...)
+		translated, unsupported := migrateLine(line, autos)
+		for _, f := range unsupported {
+			c.notes = append(c.notes, "make function "+f+" in recipe: "+strings.TrimSpace(line))
+		}
+
+		// keep empty lines inside of the script, they are used for formatting
+		if translated != "" || strings.TrimSpace(line) == "" {
+			c.script = append(c.script, translated)
 		}
-	} else if bytes.HasPrefix(line, []byte("fi;")) {
-		line = []byte("fi")
 	}
 
-	return line
+	// drop trailing empty lines
+	for len(c.script) > 0 && c.script[len(c.script)-1] == "" {
+		c.script = c.script[:len(c.script)-1]
+	}
+
+	return c
 }
 
-func migrateGlobals(contents []byte) {
-	var globals string
-	for _, line := range bytes.Split(contents, []byte("\n")) {
-		if global.Match(line) {
-			globals += string(line) + "\n"
+// translate make variable references, automatic variables and shell calls into bash
+// returns the names of make functions that could not be translated
+func translateMakeValue(value string, autos map[string]string) (string, []string) {
+
+	var unsupported []string
+
+	// $$ escapes a dollar sign for the shell
+	value = strings.Replace(value, "$$", makefileDollar, -1)
+
+	if autos != nil {
+		value = makefileAutoVar.ReplaceAllStringFunc(value, func(s string) string {
+			var (
+				match = makefileAutoVar.FindStringSubmatch(s)
+				name  = match[1] + match[2]
+				words = strings.Fields(autos[name])
+			)
+			for i, w := range words {
+				switch match[3] {
+				case "D":
+					words[i] = filepath.Dir(w)
+				case "F":
+					words[i] = filepath.Base(w)
+				}
+			}
+			return strings.Join(words, " ")
+		})
+	}
+
+	for _, match := range makefileFunction.FindAllStringSubmatch(value, -1) {
+		if match[1] != "shell" {
+			unsupported = append(unsupported, "$("+match[1]+")")
 		}
 	}
 
-	if len(globals) > 0 {
-		f, err := os.Create(zeusDir + "/globals.sh")
-		if err != nil {
-			Log.WithError(err).Error("failed to create globals file")
-			return
+	// replace $(MAKE) with zeus
+	value = makefileMake.ReplaceAllString(value, "zeus")
+
+	// replace $(VAR) with ${VAR}
+	value = makefileVar.ReplaceAllString(value, makefileDollar+"{$1}")
+
+	// replace $(shell command > test) with $(command > test)
+	value = makefileShellCommand.ReplaceAllString(value, makefileDollar+"($1)")
+
+	return strings.Replace(value, makefileDollar, "$", -1), unsupported
+}
+
+// translate a recipe line into bash
+func migrateLine(line string, autos map[string]string) (string, []string) {
+
+	// trim whitespace
+	line = strings.TrimSpace(line)
+
+	// strip the '@' (silent), '+' and '-' (ignore errors) prefixes
+	var ignoreErrors bool
+	for len(line) > 0 && strings.ContainsAny(line[:1], "@+-") {
+		ignoreErrors = ignoreErrors || line[0] == '-'
+		line = line[1:]
+	}
+	line = strings.TrimSpace(line)
+
+	line, unsupported := translateMakeValue(line, autos)
+
+	// replace all make <command> with zeus <command>
+	line = makeCommand.ReplaceAllString(line, "${1}zeus ")
+
+	// convert if statements
+	if strings.HasSuffix(line, "\\") {
+
+		if strings.HasPrefix(line, "if") {
+			line = strings.TrimSuffix(line, "\\")
+			line += "then"
+		} else if strings.HasPrefix(line, "then") {
+			// delete line with then
+			line = ""
+		} else {
+			line = strings.TrimSuffix(line, "\\")
+			line = strings.TrimSpace(line)
+			line = strings.TrimSuffix(line, ";")
+			line = "\t" + line
 		}
-		defer f.Close()
-		f.WriteString("#!/bin/bash\n\n")
-		f.WriteString(globals + "\n")
-		l.Println("created " + zeusDir + "/globals.sh")
+	} else if strings.HasPrefix(line, "fi;") {
+		line = "fi"
+	} else if ignoreErrors && line != "" {
+		line += " || true"
 	}
+
+	return line, unsupported
 }
 
 // handle makefile shell commands
@@ -276,7 +582,13 @@ func handleMakefileCommand(args []string) {
 	}
 
 	if args[1] == "migrate" {
-		migrateMakefile(scriptDir)
+		policy, err := parseConflictPolicy(args[2:])
+		if err != nil {
+			l.Println(err)
+			l.Println("usage: makefile migrate [" + migrateFlagNonInteractive + " <" + strings.Join(conflictPolicies, " | ") + ">]")
+			return
+		}
+		migrateMakefile(scriptDir, policy)
 		return
 	}
 
@@ -0,0 +1,101 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/dreadl0ck/readline"
+)
+
+// defaultPager is used for long manuals when $PAGER is not set
+const defaultPager = "less -R"
+
+// ErrHelpAndHelpFile occurs when a command has a help text and a help file
+var ErrHelpAndHelpFile = errors.New("help and helpFile can not be used together")
+
+// the manual of the command, from its help file or the help field
+func (c *command) helpText() (string, error) {
+	if c.helpFile == "" {
+		return c.help, nil
+	}
+	contents, err := ioutil.ReadFile(c.helpFile)
+	if err != nil {
+		return "", errors.New("failed to read the help file of " + c.name + ": " + err.Error())
+	}
+	return string(contents), nil
+}
+
+// render a Markdown manual for the terminal
+// headings are highlighted, emphasis markers removed and code blocks indented
+func renderManual(text string) string {
+
+	var (
+		b     strings.Builder
+		code  bool
+		width = terminalWidth()
+	)
+
+	for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "```"):
+			code = !code
+		case code:
+			b.WriteString("    " + cp.CmdOutput + line + cp.Text + "\n")
+		case strings.HasPrefix(trimmed, "#"):
+			b.WriteString(cp.Prompt + strings.TrimSpace(strings.TrimLeft(trimmed, "#")) + cp.Text + "\n")
+		default:
+			line = strings.NewReplacer("**", "", "__", "").Replace(line)
+			b.WriteString(wrapText(line, width, "") + "\n")
+		}
+	}
+	return b.String()
+}
+
+// print a text, through the pager if it does not fit on the terminal
+func page(text string) {
+
+	_, height, err := readline.GetSize(int(os.Stdout.Fd()))
+	if err != nil || ciMode || !readline.IsTerminal(int(os.Stdout.Fd())) || strings.Count(text, "\n") < height {
+		l.Print(text)
+		return
+	}
+
+	pager := os.Getenv("PAGER")
+	if pager == "" {
+		pager = defaultPager
+	}
+
+	cmd := exec.Command("sh", "-c", pager)
+	cmd.Stdin = strings.NewReader(text)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	err = cmd.Run()
+	if err != nil {
+		Log.WithError(err).Debug("pager failed: ", pager)
+		l.Print(text)
+	}
+}
@@ -0,0 +1,128 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"runtime"
+	rtdebug "runtime/debug"
+	"strconv"
+)
+
+// snapshot of the memory used by zeus and its in-memory state
+type memoryUsage struct {
+	heapInUse   uint64
+	heapIdle    uint64
+	sys         uint64
+	numGC       uint32
+	goroutines  int
+	runRecords  int
+	processes   int
+	exited      int
+	followerMap int
+}
+
+// collect the current memory usage
+func readMemoryUsage() *memoryUsage {
+
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+
+	processMapMutex.Lock()
+	var (
+		processes = len(processMap)
+		exited    = len(exitedProcesses)
+	)
+	processMapMutex.Unlock()
+
+	runFollowers.Lock()
+	followers := len(runFollowers.counts)
+	runFollowers.Unlock()
+
+	return &memoryUsage{
+		heapInUse:   stats.HeapInuse,
+		heapIdle:    stats.HeapIdle - stats.HeapReleased,
+		sys:         stats.Sys,
+		numGC:       stats.NumGC,
+		goroutines:  runtime.NumGoroutine(),
+		runRecords:  runRecords.len(),
+		processes:   processes,
+		exited:      exited,
+		followerMap: followers,
+	}
+}
+
+// drop state that can be restored from disk and return unused memory to the OS
+// the run records are only dropped when no command is running, they belong to the current run otherwise
+func reclaimMemory() {
+
+	runFollowers.reset()
+
+	s.RLock()
+	idle := s.invocations == 0
+	s.RUnlock()
+
+	if idle {
+		runRecords.flush()
+	}
+
+	// runs a garbage collection first
+	rtdebug.FreeOSMemory()
+}
+
+// format a number of bytes with binary units
+// example: 1536 -> 1.5 KiB
+func formatBytes(b uint64) string {
+
+	const unit = 1024
+	if b < unit {
+		return strconv.FormatUint(b, 10) + " B"
+	}
+
+	div, exp := uint64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	return strconv.FormatFloat(float64(b)/float64(div), 'f', 1, 64) + " " + string("KMGTPE"[exp]) + "iB"
+}
+
+// handle gc shell command
+// prints the memory usage of zeus before and after reclaiming memory
+func handleGCCommand() {
+
+	before := readMemoryUsage()
+	reclaimMemory()
+	after := readMemoryUsage()
+
+	row := func(name, before, after string) {
+		l.Println(pad(name, 20) + pad(before, 15) + after)
+	}
+
+	l.Println(cp.Prompt + pad("", 20) + pad("before", 15) + "after" + cp.Text)
+	row("heap in use", formatBytes(before.heapInUse), formatBytes(after.heapInUse))
+	row("heap idle", formatBytes(before.heapIdle), formatBytes(after.heapIdle))
+	row("obtained from OS", formatBytes(before.sys), formatBytes(after.sys))
+	row("goroutines", strconv.Itoa(before.goroutines), strconv.Itoa(after.goroutines))
+	row("run records", strconv.Itoa(before.runRecords), strconv.Itoa(after.runRecords))
+	row("processes", strconv.Itoa(before.processes), strconv.Itoa(after.processes))
+	row("exited processes", strconv.Itoa(before.exited), strconv.Itoa(after.exited))
+	row("cached followers", strconv.Itoa(before.followerMap), strconv.Itoa(after.followerMap))
+	l.Println("garbage collections: " + strconv.FormatUint(uint64(after.numGC), 10))
+}
@@ -0,0 +1,299 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// a zeus command translated from another build tool
+type migratedCommand struct {
+	name         string
+	description  string
+	dependencies []string
+	outputs      []string
+	inputs       []string
+	script       []string
+	notes        []string
+}
+
+// the result of translating the build definitions of another tool
+type migration struct {
+
+	// name of the file the commands were migrated from
+	source string
+
+	globalNames []string
+	globals     map[string]string
+	commands    []*migratedCommand
+
+	// constructs that could not be translated
+	notes []string
+
+	// existing commands replaced by migrated ones
+	overwrite []string
+
+	// migrated commands whose dependencies are added to the existing command of the same name
+	merged []*migratedCommand
+}
+
+func newMigration(source string) *migration {
+	return &migration{
+		source:  source,
+		globals: make(map[string]string),
+	}
+}
+
+func printMigrateCommandUsageErr() {
+	l.Println(ErrInvalidUsage)
+	l.Println("usage: migrate <makefile | npm | taskfile | justfile | " + migrateTargetSyntax + "> [" + migrateFlagNonInteractive + " <" + strings.Join(conflictPolicies, " | ") + ">]")
+}
+
+// handle the migrate shell command
+func handleMigrateCommand(args []string) {
+
+	if len(args) < 2 {
+		printMigrateCommandUsageErr()
+		return
+	}
+
+	policy, err := parseConflictPolicy(args[2:])
+	if err != nil {
+		if err != ErrInvalidUsage {
+			l.Println(err)
+		}
+		printMigrateCommandUsageErr()
+		return
+	}
+
+	switch args[1] {
+	case "makefile":
+		migrateMakefile(scriptDir, policy)
+	case "npm":
+		migrateNPM(scriptDir, policy)
+	case "taskfile":
+		migrateTaskfile(scriptDir, policy)
+	case "justfile":
+		migrateJustfile(scriptDir, policy)
+	case migrateTargetSyntax:
+		migrateSyntax()
+	default:
+		printMigrateCommandUsageErr()
+	}
+}
+
+// add a note about a construct that could not be translated
+func (m *migration) note(line int, text string) {
+	if line > 0 {
+		text = "line " + strconv.Itoa(line) + ": " + text
+	}
+	m.notes = append(m.notes, text)
+}
+
+// write the scripts into dir and add the commands and globals to the CommandsFile
+// conflicts with existing commands are resolved with the policy, or interactively if it is empty
+func (m *migration) write(dir, policy string) error {
+
+	var perm = os.FileMode(0700)
+
+	err := m.resolveConflicts(policy)
+	if err != nil {
+		return err
+	}
+
+	// create dir
+	err = os.MkdirAll(dir, perm)
+	if err != nil {
+		return errors.New("failed to create: " + dir + ": " + err.Error())
+	}
+
+	for _, c := range m.commands {
+
+		l.Println("migrating ~> " + c.name)
+
+		filename := dir + "/" + c.name + ".sh"
+		err = ioutil.WriteFile(filename, []byte("#!/bin/bash\n\n"+strings.Join(c.script, "\n")+"\n"), perm)
+		if err != nil {
+			Log.WithError(err).Error("failed to create file: ", filename, "permMode: ", perm)
+		}
+	}
+
+	// a missing commandsFile will be created
+	existing, err := ioutil.ReadFile(commandsFilePath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	blockWriteEvent()
+
+	err = ioutil.WriteFile(commandsFilePath, []byte(m.render(string(existing))), perm)
+	if err != nil {
+		return err
+	}
+
+	for _, n := range m.notes {
+		l.Println(cp.Prompt + "not translated: " + cp.Text + n)
+	}
+
+	// parse commands
+	return parseCommandsFile(commandsFilePath)
+}
+
+// render the migration into the contents of an existing CommandsFile
+func (m *migration) render(existing string) string {
+
+	var (
+		current = newCommandsFile()
+		lines   []string
+		b       bytes.Buffer
+	)
+
+	if strings.TrimSpace(existing) == "" {
+		existing = "language: bash\n"
+	}
+	yaml.Unmarshal([]byte(existing), current)
+
+	// resolved conflicts
+	for _, name := range m.overwrite {
+		existing = removeYAMLCommand(existing, name)
+	}
+	for _, c := range m.merged {
+		var deps []string
+		if d, ok := current.Commands[c.name]; ok && d != nil {
+			deps = d.Dependencies
+		}
+		existing = mergeYAMLDependencies(existing, c.name, deps, c.dependencies)
+	}
+
+	// globals
+	for _, name := range m.globalNames {
+		if _, ok := current.Globals[name]; ok {
+			m.note(0, "global "+name+" exists already")
+			continue
+		}
+		lines = append(lines, "    "+name+": "+yamlScalar(m.globals[name]))
+	}
+
+	if len(lines) > 0 {
+		existing = insertYAMLSection(existing, "globals", strings.Join(lines, "\n"))
+	}
+
+	if !strings.HasSuffix(existing, "\n") {
+		existing += "\n"
+	}
+	if !yamlSectionStart(existing, "commands") {
+		existing += "\ncommands:\n"
+	}
+	b.WriteString(existing)
+
+	b.WriteString("\n    # migrated from " + m.source + "\n")
+	if len(m.notes) > 0 {
+		b.WriteString("    # the following constructs could not be translated:\n")
+		for _, n := range m.notes {
+			b.WriteString("    # - " + n + "\n")
+		}
+	}
+
+	for _, c := range m.commands {
+
+		b.WriteString("\n")
+		for _, n := range c.notes {
+			b.WriteString("    # not translated: " + n + "\n")
+		}
+		b.WriteString("    " + c.name + ":\n")
+		b.WriteString("        description: " + yamlScalar(c.description) + "\n")
+		b.WriteString("        help: " + yamlScalar("help text for command "+c.name) + "\n")
+
+		for _, list := range []struct {
+			name  string
+			items []string
+		}{
+			{"dependencies", c.dependencies},
+			{"outputs", c.outputs},
+			{"inputs", c.inputs},
+		} {
+			if len(list.items) == 0 {
+				continue
+			}
+			b.WriteString("        " + list.name + ":\n")
+			for _, item := range list.items {
+				b.WriteString("            - " + yamlScalar(item) + "\n")
+			}
+		}
+	}
+
+	return b.String()
+}
+
+// check if a top level section exists in a YAML document
+func yamlSectionStart(contents, name string) bool {
+	for _, line := range strings.Split(contents, "\n") {
+		if strings.TrimRight(line, " ") == name+":" {
+			return true
+		}
+	}
+	return false
+}
+
+// add lines to a top level section of a YAML document
+// a missing section will be inserted before the commands
+func insertYAMLSection(contents, name, entries string) string {
+
+	var lines = strings.Split(contents, "\n")
+
+	for i, line := range lines {
+		if strings.TrimRight(line, " ") == name+":" {
+			return strings.Join(append(lines[:i+1], append([]string{entries}, lines[i+1:]...)...), "\n")
+		}
+	}
+
+	for i, line := range lines {
+		if strings.TrimRight(line, " ") == "commands:" {
+			return strings.Join(append(lines[:i], append([]string{name + ":", entries, ""}, lines[i:]...)...), "\n")
+		}
+	}
+
+	return strings.TrimRight(contents, "\n") + "\n\n" + name + ":\n" + entries + "\n"
+}
+
+// format a string as a YAML scalar, quoting it if necessary
+func yamlScalar(s string) string {
+	out, err := yaml.Marshal(s)
+	if err != nil {
+		return strconv.Quote(s)
+	}
+	return strings.TrimSuffix(string(out), "\n")
+}
+
+// target and script names can contain paths and separators, command names can not
+func migratedCommandName(target string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '_' || r == '-' {
+			return r
+		}
+		return '-'
+	}, target)
+}
@@ -0,0 +1,180 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/mgutz/ansi"
+)
+
+var (
+	// multiplexer for the output of concurrently running commands
+	mux = newOutputMultiplexer(os.Stdout)
+
+	// colors used to distinguish command output
+	muxColors = []string{"cyan", "magenta", "yellow", "green", "blue", "red"}
+)
+
+// outputMultiplexer serializes the output of concurrently running commands
+// every line is prefixed with the name of the command that produced it
+type outputMultiplexer struct {
+	out io.Writer
+
+	// command names mapped to their prefix color
+	colors map[string]string
+
+	// width of the longest name seen, used for alignment
+	width int
+
+	sync.Mutex
+}
+
+func newOutputMultiplexer(out io.Writer) *outputMultiplexer {
+	return &outputMultiplexer{
+		out:    out,
+		colors: make(map[string]string, 0),
+	}
+}
+
+// create a writer for the named command
+// if buffered is true, the output is held back until the writer is flushed
+func (m *outputMultiplexer) writer(name string, buffered bool) *prefixWriter {
+
+	m.Lock()
+	defer m.Unlock()
+
+	if _, ok := m.colors[name]; !ok {
+		m.colors[name] = muxColors[len(m.colors)%len(muxColors)]
+	}
+	if len(name) > m.width {
+		m.width = len(name)
+	}
+
+	return &prefixWriter{
+		name:     name,
+		m:        m,
+		buffered: buffered,
+	}
+}
+
+// return the prefix for the named command
+// must be called with the multiplexer locked
+func (m *outputMultiplexer) prefix(name string) string {
+
+	conf.Lock()
+	colors := conf.fields.Colors && !conf.fields.Accessible
+	conf.Unlock()
+
+	if colors {
+		return ansi.ColorCode(m.colors[name]) + pad(name, m.width) + " | " + ansi.Reset
+	}
+	return pad(name, m.width) + " | "
+}
+
+// write lines with the prefix of the named command
+// all lines are written at once, so output of other commands can not interleave
+func (m *outputMultiplexer) writeLines(name string, lines [][]byte) {
+
+	m.Lock()
+	defer m.Unlock()
+
+	var (
+		p   = []byte(m.prefix(name))
+		out bytes.Buffer
+	)
+	for _, line := range lines {
+		out.Write(p)
+		out.Write(line)
+		out.WriteByte('\n')
+	}
+	m.out.Write(out.Bytes())
+}
+
+// prefixWriter is an io.Writer that forwards complete lines to the multiplexer
+type prefixWriter struct {
+	name     string
+	m        *outputMultiplexer
+	buffered bool
+	buf      bytes.Buffer
+	sync.Mutex
+}
+
+// Write implements the io.Writer interface
+func (w *prefixWriter) Write(p []byte) (int, error) {
+
+	w.Lock()
+	defer w.Unlock()
+
+	w.buf.Write(p)
+
+	if w.buffered {
+		return len(p), nil
+	}
+
+	// forward all complete lines
+	data := w.buf.Bytes()
+	i := bytes.LastIndexByte(data, '\n')
+	if i < 0 {
+		return len(p), nil
+	}
+
+	w.m.writeLines(w.name, bytes.Split(data[:i], []byte("\n")))
+
+	rest := append([]byte{}, data[i+1:]...)
+	w.buf.Reset()
+	w.buf.Write(rest)
+
+	return len(p), nil
+}
+
+// flush all remaining output
+func (w *prefixWriter) flush() {
+
+	w.Lock()
+	defer w.Unlock()
+
+	if w.buf.Len() == 0 {
+		return
+	}
+
+	w.m.writeLines(w.name, bytes.Split(bytes.TrimSuffix(w.buf.Bytes(), []byte("\n")), []byte("\n")))
+	w.buf.Reset()
+}
+
+// check if the output of the next command should go through the multiplexer
+func useMultiplexer() (prefix bool, buffered bool) {
+
+	conf.Lock()
+	prefix = conf.fields.PrefixOutput
+	buffered = conf.fields.BufferOutput
+	conf.Unlock()
+
+	// always prefix when other commands are running concurrently
+	s.Lock()
+	if s.running > 0 {
+		prefix = true
+	}
+	s.Unlock()
+
+	return prefix || buffered, buffered
+}
@@ -0,0 +1,187 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"regexp"
+	"strings"
+)
+
+var (
+	// ErrNoScripts means the package.json does not contain any scripts
+	ErrNoScripts = errors.New("no scripts found in package.json")
+
+	npmRun       = regexp.MustCompile("\\b(?:npm|pnpm|yarn)\\s+(?:run|run-script)\\s+([^\\s;&|]+)")
+	npmLifecycle = regexp.MustCompile("\\bnpm\\s+(test|start|stop|restart)\\b")
+	npmEnv       = regexp.MustCompile("\\$\\{?npm_[a-z_]+")
+)
+
+// package.json fields used for the migration
+type packageJSON struct {
+
+	// scripts can contain "//" keys with comments, as strings or lists of strings
+	Scripts map[string]interface{} `json:"scripts"`
+
+	// descriptions in the npm-scripts-info format
+	ScriptsInfo map[string]string `json:"scripts-info"`
+}
+
+// migrate the scripts of a package.json into a zeus command folder
+func migrateNPM(zeusDirectory, policy string) {
+
+	Log.WithField("dir", zeusDirectory).Info("npm migration started.")
+
+	contents, err := ioutil.ReadFile("package.json")
+	if err != nil {
+		Log.WithError(err).Error("unable to read package.json")
+		return
+	}
+
+	m, err := translatePackageJSON(contents)
+	if err != nil {
+		l.Println(err)
+		return
+	}
+
+	err = m.write(zeusDirectory, policy)
+	if err != nil {
+		l.Println(err)
+	}
+}
+
+// translate the scripts of a package.json into commands
+// pre and post scripts are run around the script they belong to, like npm does
+func translatePackageJSON(contents []byte) (*migration, error) {
+
+	var (
+		p            packageJSON
+		m            = newMigration("package.json")
+		scripts      = make(map[string]string)
+		descriptions = make(map[string]string)
+		comments     []string
+	)
+
+	err := json.Unmarshal(contents, &p)
+	if err != nil {
+		return nil, errors.New("failed to parse package.json: " + err.Error())
+	}
+
+	for name, value := range p.Scripts {
+		if name == "//" {
+			comments = npmComments(value)
+			continue
+		}
+		if script, ok := value.(string); ok {
+			scripts[name] = script
+		} else {
+			m.note(0, "script "+name+" is not a string")
+		}
+	}
+	// script names can contain colons, the longest matching name wins
+	for _, comment := range comments {
+		var match string
+		for name := range scripts {
+			if strings.HasPrefix(comment, name+":") && len(name) > len(match) {
+				match = name
+			}
+		}
+		if match != "" {
+			descriptions[match] = strings.TrimSpace(comment[len(match)+1:])
+		}
+	}
+	for name, description := range p.ScriptsInfo {
+		descriptions[name] = description
+	}
+
+	if len(scripts) == 0 {
+		return nil, ErrNoScripts
+	}
+
+	for _, name := range sortedKeys(scripts) {
+
+		c := &migratedCommand{
+			name:        migratedCommandName(name),
+			description: descriptions[name],
+			script: []string{
+				// npm makes locally installed binaries available
+				"export PATH=\"$PWD/node_modules/.bin:$PATH\"",
+			},
+		}
+		if c.description == "" {
+			c.description = "migrated from npm script " + name
+		}
+
+		if _, ok := scripts["pre"+name]; ok {
+			c.dependencies = append(c.dependencies, migratedCommandName("pre"+name))
+		}
+
+		c.script = append(c.script, c.translateNPMScript(scripts[name], scripts))
+
+		// post scripts only run if the script succeeded
+		if post, ok := scripts["post"+name]; ok {
+			c.script[len(c.script)-1] += " || exit $?"
+			c.script = append(c.script, c.translateNPMScript(post, scripts))
+		}
+
+		m.commands = append(m.commands, c)
+	}
+
+	return m, nil
+}
+
+// replace calls to other scripts with zeus and note what could not be translated
+func (c *migratedCommand) translateNPMScript(script string, scripts map[string]string) string {
+
+	if npmEnv.MatchString(script) {
+		c.notes = append(c.notes, "npm environment variables are not set: "+script)
+	}
+	if strings.Contains(script, " -- ") {
+		c.notes = append(c.notes, "arguments passed with -- need to be declared as command arguments: "+script)
+	}
+
+	script = npmRun.ReplaceAllStringFunc(script, func(s string) string {
+		return "zeus " + migratedCommandName(npmRun.FindStringSubmatch(s)[1])
+	})
+
+	return npmLifecycle.ReplaceAllStringFunc(script, func(s string) string {
+		name := npmLifecycle.FindStringSubmatch(s)[1]
+		if _, ok := scripts[name]; !ok {
+			return s
+		}
+		return "zeus " + name
+	})
+}
+
+// collect the comments of a "//" key
+func npmComments(value interface{}) (comments []string) {
+	switch v := value.(type) {
+	case string:
+		comments = append(comments, v)
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				comments = append(comments, s)
+			}
+		}
+	}
+	return
+}
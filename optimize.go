@@ -0,0 +1,394 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dreadl0ck/readline"
+)
+
+// kinds of pipelines
+const (
+	pipelineHook  = "hook"
+	pipelineAlias = "alias"
+)
+
+// ErrPipelineNotFound means the definition of a pipeline could not be found for rewriting it
+var ErrPipelineNotFound = errors.New("pipeline definition not found")
+
+// pipeline is a commandChain declared as git hook or alias
+type pipeline struct {
+	kind  string
+	name  string
+	chain string
+}
+
+// chainSuggestion is a faster version of a pipeline
+type chainSuggestion struct {
+	pipeline *pipeline
+
+	// the rewritten commandChain
+	chain string
+
+	// steps that run in parallel in the rewritten commandChain
+	groups [][]string
+
+	// estimated saving of each group, zero if no durations have been recorded
+	savings []time.Duration
+}
+
+// handle optimize shell command
+func handleOptimizeCommand(args []string) {
+
+	if len(args) > 1 {
+		l.Println(ErrInvalidUsage)
+		l.Println("usage: optimize")
+		return
+	}
+
+	entries, err := readRunHistory()
+	if err != nil {
+		l.Println("failed to read run history:", err)
+		return
+	}
+
+	var (
+		averages    = averageDurations(entries)
+		suggestions []*chainSuggestion
+	)
+
+	for _, p := range collectPipelines() {
+		sg := optimizeChain(p, averages)
+		if sg != nil {
+			suggestions = append(suggestions, sg)
+		}
+	}
+
+	if len(suggestions) == 0 {
+		l.Println("no suggestions, the hooks and aliases can not run faster.")
+		return
+	}
+
+	// without a terminal there is nobody to confirm the changes
+	confirm := !ciMode && readline.IsTerminal(int(os.Stdin.Fd()))
+
+	for _, sg := range suggestions {
+
+		sg.print()
+
+		if !confirm {
+			continue
+		}
+
+		answer, err := ask(cp.Prompt + "rewrite " + sg.pipeline.kind + " " + sg.pipeline.name + "? [y/N] " + cp.Text)
+		if err != nil {
+			l.Println(err)
+			return
+		}
+		if strings.ToLower(answer) != "y" && strings.ToLower(answer) != "yes" {
+			continue
+		}
+
+		err = sg.apply()
+		if err != nil {
+			l.Println("failed to rewrite "+sg.pipeline.kind+" "+sg.pipeline.name+":", err)
+			continue
+		}
+		l.Println(printPrompt() + "rewrote " + sg.pipeline.kind + " " + sg.pipeline.name)
+	}
+}
+
+// average duration of each command in the run history
+func averageDurations(entries []*historyEntry) map[string]time.Duration {
+	var averages = make(map[string]time.Duration)
+	for _, st := range runStats(entries) {
+		averages[st.name] = st.average()
+	}
+	return averages
+}
+
+// the git hooks and aliases that are commandChains, hooks first
+func collectPipelines() (pipelines []*pipeline) {
+
+	gitHooks.Lock()
+	for _, name := range sortedKeys(gitHooks.items) {
+		pipelines = append(pipelines, &pipeline{kind: pipelineHook, name: name, chain: gitHooks.items[name]})
+	}
+	gitHooks.Unlock()
+
+	projectData.Lock()
+	for _, name := range sortedKeys(projectData.fields.Aliases) {
+		pipelines = append(pipelines, &pipeline{kind: pipelineAlias, name: name, chain: projectData.fields.Aliases[name]})
+	}
+	projectData.Unlock()
+
+	return
+}
+
+// move independent steps of the commandChain together and run them in parallel
+// each step is placed directly after the last earlier step it conflicts with, so steps can move forward
+// steps using the parallel or fallback operators are kept in place, nothing moves across them
+// returns nil if the commandChain can not be improved
+func optimizeChain(p *pipeline, averages map[string]time.Duration) *chainSuggestion {
+
+	var (
+		sg      = &chainSuggestion{pipeline: p}
+		steps   []string
+		segment []string
+	)
+
+	flush := func() {
+		levels := scheduleSteps(segment)
+		for _, level := range levels {
+			steps = append(steps, strings.Join(level, " "+commandChainParallel+" "))
+			if len(level) < 2 {
+				continue
+			}
+
+			// the steps of a group ran one after another so far
+			var sum, longest time.Duration
+			for _, step := range level {
+				d := averages[strings.Fields(step)[0]]
+				sum += d
+				if d > longest {
+					longest = d
+				}
+			}
+			sg.groups = append(sg.groups, level)
+			sg.savings = append(sg.savings, sum-longest)
+		}
+		segment = nil
+	}
+
+	for _, step := range strings.Split(p.chain, commandChainSeparator) {
+		step = strings.TrimSpace(step)
+		if step == "" {
+			return nil
+		}
+
+		_, mode, err := parseChainStep(step)
+		if err != nil {
+			return nil
+		}
+		if mode != chainStepSingle {
+			flush()
+			steps = append(steps, step)
+			continue
+		}
+		segment = append(segment, step)
+	}
+	flush()
+
+	if len(sg.groups) == 0 {
+		return nil
+	}
+
+	sg.chain = strings.Join(steps, " "+commandChainSeparator+" ")
+	return sg
+}
+
+// assign the steps to levels, the steps of a level can run in parallel
+// a step runs one level after the last earlier step it conflicts with
+func scheduleSteps(steps []string) (levels [][]string) {
+
+	var level = make([]int, len(steps))
+
+	for j := range steps {
+		for i := 0; i < j; i++ {
+			if stepsConflict(steps[i], steps[j]) && level[i]+1 > level[j] {
+				level[j] = level[i] + 1
+			}
+		}
+		for len(levels) <= level[j] {
+			levels = append(levels, nil)
+		}
+		levels[level[j]] = append(levels[level[j]], steps[j])
+	}
+
+	return
+}
+
+// check if two steps of a commandChain must not run in parallel
+// steps conflict if one depends on the other, they share a command, or the outputs of one are used by the other
+// unknown commands always conflict
+func stepsConflict(a, b string) bool {
+
+	var (
+		nameA = strings.Fields(a)[0]
+		nameB = strings.Fields(b)[0]
+	)
+
+	cmdA, errA := cmdMap.getCommand(nameA)
+	cmdB, errB := cmdMap.getCommand(nameB)
+	if errA != nil || errB != nil {
+		return true
+	}
+
+	var (
+		depsA = dependencyNames(cmdA, map[string]bool{nameA: true})
+		depsB = dependencyNames(cmdB, map[string]bool{nameB: true})
+	)
+
+	// a shared dependency would be run twice at the same time
+	for name := range depsA {
+		if depsB[name] {
+			return true
+		}
+	}
+
+	return outputsUsed(cmdA, cmdB) || outputsUsed(cmdB, cmdA)
+}
+
+// check if the outputs of a are outputs or inputs of b
+func outputsUsed(a, b *command) bool {
+	for _, output := range a.outputs {
+		for _, o := range b.outputs {
+			if matchInput(o, output) || matchInput(output, o) {
+				return true
+			}
+		}
+		for _, input := range b.inputs {
+			if matchInput(input, output) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// the names of a command and all its direct and indirect dependencies
+func dependencyNames(c *command, names map[string]bool) map[string]bool {
+	for _, dep := range c.dependencies {
+		fields := strings.Fields(dep)
+		if len(fields) == 0 || names[fields[0]] {
+			continue
+		}
+		names[fields[0]] = true
+		if depCmd, err := cmdMap.getCommand(fields[0]); err == nil {
+			dependencyNames(depCmd, names)
+		}
+	}
+	return names
+}
+
+func (sg *chainSuggestion) print() {
+
+	l.Println(cp.Prompt + sg.pipeline.kind + " " + sg.pipeline.name + ": " + cp.Text + sg.pipeline.chain)
+
+	for i, group := range sg.groups {
+
+		var names = make([]string, len(group))
+		for j, step := range group {
+			names[j] = strings.Fields(step)[0]
+		}
+		independent := strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1] + " are independent"
+
+		if sg.savings[i] > 0 {
+			l.Println("  " + independent + ", running them in parallel would save ~" + formatDuration(sg.savings[i]))
+		} else {
+			l.Println("  " + independent + " and can run in parallel, no durations recorded yet")
+		}
+	}
+
+	l.Println("  suggested: " + cp.Prompt + sg.chain + cp.Reset)
+}
+
+// rewrite the declaration of the pipeline with the suggested commandChain
+func (sg *chainSuggestion) apply() error {
+
+	p := sg.pipeline
+
+	switch p.kind {
+	case pipelineAlias:
+		projectData.Lock()
+		projectData.fields.Aliases[p.name] = sg.chain
+		projectData.Unlock()
+		projectData.update()
+
+	case pipelineHook:
+		err := rewriteHook(p.name, p.chain, sg.chain)
+		if err != nil {
+			return err
+		}
+
+		gitHooks.Lock()
+		var hooks = make(map[string]string, len(gitHooks.items))
+		for name, chain := range gitHooks.items {
+			hooks[name] = chain
+		}
+		gitHooks.Unlock()
+
+		// update the installed shims
+		hooks[p.name] = sg.chain
+		err = initGitHooks(hooks)
+		if err != nil {
+			return err
+		}
+	}
+
+	p.chain = sg.chain
+	return nil
+}
+
+// replace the commandChain of a hook in the file of the CommandsFile that declares it
+// the file is edited line by line, to keep its formatting and comments
+func rewriteHook(name, chain, replacement string) error {
+
+	for _, path := range commandsFileParts(commandsFilePath) {
+
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		var (
+			lines = strings.Split(string(contents), "\n")
+			hooks bool
+		)
+
+		for i, line := range lines {
+
+			// top level sections are not indented
+			if line != "" && !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "\t") {
+				hooks = strings.HasPrefix(line, "hooks:")
+				continue
+			}
+
+			trimmed := strings.TrimSpace(line)
+			if !hooks || !strings.HasPrefix(trimmed, name+":") || !strings.Contains(line, chain) {
+				continue
+			}
+
+			lines[i] = strings.Replace(line, chain, replacement, 1)
+
+			info, err := os.Stat(path)
+			if err != nil {
+				return err
+			}
+			return writeFileWithBackup(path, []byte(strings.Join(lines, "\n")), info.Mode())
+		}
+	}
+
+	return errors.New(ErrPipelineNotFound.Error() + ": hook " + name)
+}
@@ -0,0 +1,235 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	// commandOrderAlphabetical sorts commands by name
+	commandOrderAlphabetical = "alphabetical"
+
+	// commandOrderGroup sorts commands by their namespace, the part of the name before the first separator
+	// example: build-linux and build-darwin are in the group build
+	commandOrderGroup = "group"
+
+	// characters that separate the namespace from the rest of a command name
+	namespaceSeparators = "-_:./"
+)
+
+var (
+	// ErrInvalidGroup means a display group is not a list of command names
+	ErrInvalidGroup = errors.New("invalid group, expected a list of command names")
+
+	// ErrDuplicateGroupMember means a command is listed in more than one display group
+	ErrDuplicateGroupMember = errors.New("command is listed in more than one group")
+
+	// display groups from the CommandsFile
+	displayGroups = &groupStore{}
+)
+
+// a group of commands for the help and completions, declared in the CommandsFile
+type commandGroup struct {
+	name     string
+	commands []string
+}
+
+// the display groups in the order they were declared
+type groupStore struct {
+	groups []*commandGroup
+
+	// position of each grouped command over all groups
+	rank map[string]int
+
+	sync.RWMutex
+}
+
+// init the display groups from the groups section of the CommandsFile
+// keeps the order of the groups and of the commands inside each group
+func initGroups(groups yaml.MapSlice) error {
+
+	var (
+		parsed []*commandGroup
+		rank   = make(map[string]int)
+	)
+
+	for _, item := range groups {
+
+		name, ok := item.Key.(string)
+		if !ok {
+			return ErrInvalidGroup
+		}
+
+		members, ok := item.Value.([]interface{})
+		if !ok {
+			return errors.New(name + ": " + ErrInvalidGroup.Error())
+		}
+
+		group := &commandGroup{name: name}
+		for _, m := range members {
+			cmd, ok := m.(string)
+			if !ok {
+				return errors.New(name + ": " + ErrInvalidGroup.Error())
+			}
+			if _, ok := cmdMap.items[cmd]; !ok {
+				return errors.New(name + ": " + ErrUnknownCommand.Error() + ": " + cmd)
+			}
+			if _, ok := rank[cmd]; ok {
+				return errors.New(name + ": " + ErrDuplicateGroupMember.Error() + ": " + cmd)
+			}
+			rank[cmd] = len(rank)
+			group.commands = append(group.commands, cmd)
+		}
+		parsed = append(parsed, group)
+	}
+
+	displayGroups.Lock()
+	displayGroups.groups = parsed
+	displayGroups.rank = rank
+	displayGroups.Unlock()
+
+	return nil
+}
+
+// split sorted command names into the declared display groups
+// commands without a group are collected in the last group without a name
+// returns false if there are no display groups
+func (gs *groupStore) split(sorted []string) (groups []string, members map[string][]string, ok bool) {
+
+	gs.RLock()
+	defer gs.RUnlock()
+
+	if len(gs.groups) == 0 {
+		return nil, nil, false
+	}
+
+	var exists = make(map[string]bool, len(sorted))
+	for _, name := range sorted {
+		exists[name] = true
+	}
+
+	members = make(map[string][]string, len(gs.groups)+1)
+	for _, group := range gs.groups {
+		groups = append(groups, group.name)
+		for _, name := range group.commands {
+			if exists[name] {
+				members[group.name] = append(members[group.name], name)
+			}
+		}
+	}
+
+	groups = append(groups, "")
+	for _, name := range sorted {
+		if _, grouped := gs.rank[name]; !grouped {
+			members[""] = append(members[""], name)
+		}
+	}
+	return groups, members, true
+}
+
+// the namespace of a command name
+// names without a separator are their own namespace
+func commandNamespace(name string) string {
+	if i := strings.IndexAny(name, namespaceSeparators); i > 0 {
+		return name[:i]
+	}
+	return name
+}
+
+// sort command names in place, according to the commandOrder config field
+// commands of the display groups come first, in the declared order
+func sortCommandNames(names []string) {
+
+	if conf == nil || conf.fields.CommandOrder != commandOrderGroup {
+		sort.Strings(names)
+	} else {
+		sort.Slice(names, func(i, j int) bool {
+			a, b := commandNamespace(names[i]), commandNamespace(names[j])
+			if a != b {
+				return a < b
+			}
+			return names[i] < names[j]
+		})
+	}
+
+	displayGroups.RLock()
+	defer displayGroups.RUnlock()
+
+	if len(displayGroups.rank) == 0 {
+		return
+	}
+
+	position := func(name string) int {
+		if r, ok := displayGroups.rank[name]; ok {
+			return r
+		}
+		return len(displayGroups.rank)
+	}
+	sort.SliceStable(names, func(i, j int) bool {
+		return position(names[i]) < position(names[j])
+	})
+}
+
+// split sorted command names into groups of commands sharing a namespace
+// commands that are the only member of their namespace are collected in the first group without a name
+func groupCommandNames(sorted []string) (groups []string, members map[string][]string) {
+
+	var count = make(map[string]int, 0)
+	for _, name := range sorted {
+		count[commandNamespace(name)]++
+	}
+
+	members = make(map[string][]string, 0)
+	groups = []string{""}
+	for _, name := range sorted {
+		ns := commandNamespace(name)
+		if count[ns] == 1 {
+			ns = ""
+		}
+		if _, ok := members[ns]; !ok && ns != "" {
+			groups = append(groups, ns)
+		}
+		members[ns] = append(members[ns], name)
+	}
+	return
+}
+
+// return the keys of a string map in sorted order
+func sortedKeys(m map[string]string) (keys []string) {
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return
+}
+
+// return the members of a set in sorted order
+func sortedSet(m map[string]bool) (keys []string) {
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return
+}
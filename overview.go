@@ -0,0 +1,132 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"strings"
+)
+
+const (
+	// flag of the help builtin for the overview with arguments and dependencies
+	longOverviewFlag = "--long"
+
+	// minimum width of the name column
+	minNameWidth = 14
+
+	// indentation of the commands below their group
+	overviewIndent = "  "
+)
+
+// print all available commands
+func printCommands() {
+	printCommandOverview(false)
+}
+
+// print all commands grouped by namespace or by the groups of the CommandsFile, with names and descriptions in aligned columns
+// the long overview adds the arguments and dependencies of each command
+// in quiet mode only the names are printed, in as many columns as fit the terminal
+func printCommandOverview(long bool) {
+
+	cmdMap.Lock()
+	defer cmdMap.Unlock()
+
+	if len(cmdMap.items) == 0 {
+		return
+	}
+
+	var (
+		names     = make([]string, 0, len(cmdMap.items))
+		nameWidth = minNameWidth
+		width     = terminalWidth()
+	)
+
+	for name := range cmdMap.items {
+		names = append(names, name)
+		if len(name) > nameWidth {
+			nameWidth = len(name)
+		}
+	}
+	nameWidth += 2
+
+	sortCommandNames(names)
+
+	// the groups declared in the CommandsFile replace the namespaces
+	groups, members, declared := displayGroups.split(names)
+	if !declared {
+		groups, members = groupCommandNames(names)
+	}
+
+	l.Println(cp.Text + "commands")
+	for _, group := range groups {
+		if len(members[group]) == 0 {
+			continue
+		}
+		if group != "" {
+			l.Println(cp.Text + "\n" + group)
+		} else if declared {
+			l.Println(cp.Text + "\nother")
+		}
+		if conf.fields.Quiet && !long {
+			printCommandColumns(members[group], nameWidth, width)
+			continue
+		}
+		for _, name := range members[group] {
+			printCommandRow(cmdMap.items[name], nameWidth, width, long)
+		}
+	}
+	l.Println("")
+}
+
+// print a single command of the overview
+func printCommandRow(cmd *command, nameWidth, width int, long bool) {
+
+	var (
+		descWidth = width - len(overviewIndent) - nameWidth
+		indent    = overviewIndent + pad("", nameWidth)
+	)
+
+	l.Println(overviewIndent + cp.CmdName + pad(cmd.name, nameWidth) + cp.Text + truncate(cmd.description, descWidth))
+
+	if !long {
+		return
+	}
+	if len(cmd.args) > 0 {
+		l.Println(indent + cp.CmdFields + pad("args", 6) + getArgumentString(cmd.args) + cp.Text)
+	}
+	if len(cmd.dependencies) > 0 {
+		l.Println(indent + cp.CmdFields + pad("deps", 6) + truncate(formatDependencies(cmd.dependencies), descWidth-6) + cp.Text)
+	}
+}
+
+// print command names in as many columns as fit the terminal
+func printCommandColumns(names []string, nameWidth, width int) {
+
+	columns := (width - len(overviewIndent)) / nameWidth
+	if columns < 1 {
+		columns = 1
+	}
+
+	for i := 0; i < len(names); i += columns {
+		var row = overviewIndent
+		for j := i; j < i+columns && j < len(names); j++ {
+			row += cp.CmdName + pad(names[j], nameWidth)
+		}
+		l.Println(strings.TrimRight(row, " ") + cp.Text)
+	}
+}
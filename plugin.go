@@ -0,0 +1,379 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dreadl0ck/readline"
+)
+
+const (
+	// prefix of the executables that are loaded as plugins
+	pluginPrefix = "zeus-"
+
+	// plugins have to answer describe and complete requests quickly, they block the startup and the prompt
+	pluginDescribeTimeout = 5 * time.Second
+	pluginCompleteTimeout = 2 * time.Second
+
+	// request types of the plugin protocol
+	pluginRequestDescribe = "describe"
+	pluginRequestRun      = "run"
+	pluginRequestComplete = "complete"
+
+	// message types a plugin writes while running a builtin
+	pluginMessageOutput = "output"
+	pluginMessageError  = "error"
+)
+
+var (
+	// ErrPluginFailed means a plugin builtin reported an error or exited with a non zero status
+	ErrPluginFailed = errors.New("plugin failed")
+
+	// the builtins registered by plugins
+	plugins = &pluginRegistry{
+		items: make(map[string]*pluginBuiltin, 0),
+	}
+)
+
+type pluginRegistry struct {
+	items  map[string]*pluginBuiltin
+	loaded bool
+	sync.Mutex
+}
+
+// a builtin provided by a plugin executable
+type pluginBuiltin struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Completions []string `json:"completions"`
+
+	// ask the plugin for completions, instead of using the static ones
+	Complete bool `json:"complete"`
+
+	// executable of the plugin
+	path string
+}
+
+// a request to a plugin, written to its stdin as a single JSON object
+type pluginRequest struct {
+	Type    string            `json:"type"`
+	Version string            `json:"version"`
+	Builtin string            `json:"builtin,omitempty"`
+	Args    []string          `json:"args,omitempty"`
+	Dir     string            `json:"dir,omitempty"`
+	ZeusDir string            `json:"zeusDir,omitempty"`
+	Globals map[string]string `json:"globals,omitempty"`
+}
+
+// the response to describe and complete requests
+type pluginResponse struct {
+	Builtins    []*pluginBuiltin `json:"builtins"`
+	Completions []string         `json:"completions"`
+}
+
+// a line a plugin writes while running a builtin
+type pluginMessage struct {
+	Type    string `json:"type"`
+	Text    string `json:"text"`
+	Message string `json:"message"`
+}
+
+// directories searched for plugins, the project plugins take precedence over the ones in the PATH
+func pluginDirs() []string {
+	return append([]string{filepath.Join(zeusDir, "plugins")}, filepath.SplitList(os.Getenv("PATH"))...)
+}
+
+// find the plugin executables, the first one with a name wins
+func findPlugins() (paths []string) {
+
+	seen := make(map[string]bool)
+	for _, dir := range pluginDirs() {
+
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+
+		for _, f := range files {
+			name := f.Name()
+			if !strings.HasPrefix(name, pluginPrefix) || seen[name] || f.IsDir() || f.Mode()&0111 == 0 {
+				continue
+			}
+			seen[name] = true
+			paths = append(paths, filepath.Join(dir, name))
+		}
+	}
+	return
+}
+
+// send a request to a plugin and return its stdout
+func (r *pluginRequest) send(ctx context.Context, path string) ([]byte, error) {
+
+	r.Version = version
+
+	req, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var stdout bytes.Buffer
+	cmd := exec.CommandContext(ctx, path)
+	cmd.Stdin = bytes.NewReader(append(req, '\n'))
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = os.Environ()
+
+	err = cmd.Run()
+	return stdout.Bytes(), err
+}
+
+// ask the plugin for its builtins
+func describePlugin(path string) ([]*pluginBuiltin, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), pluginDescribeTimeout)
+	defer cancel()
+
+	out, err := (&pluginRequest{Type: pluginRequestDescribe}).send(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp pluginResponse
+	err = json.Unmarshal(out, &resp)
+	if err != nil {
+		return nil, errors.New("invalid describe response: " + err.Error())
+	}
+
+	for _, b := range resp.Builtins {
+		b.path = path
+	}
+	return resp.Builtins, nil
+}
+
+// discover the plugins and register their builtins, once per session
+// builtins of zeus can not be replaced, plugins that fail to describe themselves are skipped with a warning
+func (p *pluginRegistry) load() {
+
+	p.Lock()
+	if p.loaded {
+		p.Unlock()
+		return
+	}
+	p.loaded = true
+	p.Unlock()
+
+	for _, path := range findPlugins() {
+
+		builtinsOfPlugin, err := describePlugin(path)
+		if err != nil {
+			Log.WithError(err).Warn("ignoring plugin " + path)
+			continue
+		}
+
+		for _, b := range builtinsOfPlugin {
+			if _, ok := builtins[b.Name]; ok || strings.TrimSpace(b.Name) == "" || strings.ContainsAny(b.Name, " \t") {
+				Log.Warn("ignoring builtin " + b.Name + " of plugin " + path + ": invalid name or conflicts with a builtin")
+				continue
+			}
+
+			p.Lock()
+			if _, ok := p.items[b.Name]; !ok {
+				p.items[b.Name] = b
+			}
+			p.Unlock()
+		}
+	}
+}
+
+// get a builtin of a plugin, the plugins are loaded when needed
+func (p *pluginRegistry) get(name string) (*pluginBuiltin, bool) {
+	p.load()
+
+	p.Lock()
+	defer p.Unlock()
+	b, ok := p.items[name]
+	return b, ok
+}
+
+// the names of the plugin builtins, sorted
+func (p *pluginRegistry) names() (names []string) {
+	p.load()
+
+	p.Lock()
+	defer p.Unlock()
+	for name := range p.items {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
+
+// add the plugin builtins to the completer
+func (p *pluginRegistry) addCompletions() {
+
+	var items []readline.PrefixCompleterInterface
+	for _, name := range p.names() {
+		b, _ := p.get(name)
+		items = append(items, readline.PcItem(name, readline.PcItemDynamic(b.completer)))
+	}
+
+	completer.Lock()
+	completer.Children = append(completer.Children, items...)
+	completer.Unlock()
+}
+
+// complete the arguments of a plugin builtin
+func (b *pluginBuiltin) completer(line string) []string {
+
+	if !b.Complete {
+		return b.Completions
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), pluginCompleteTimeout)
+	defer cancel()
+
+	fields := strings.Fields(line)
+	if len(fields) > 0 {
+		fields = fields[1:]
+	}
+
+	out, err := (&pluginRequest{Type: pluginRequestComplete, Builtin: b.Name, Args: fields}).send(ctx, b.path)
+	if err != nil {
+		return b.Completions
+	}
+
+	var resp pluginResponse
+	if err := json.Unmarshal(out, &resp); err != nil {
+		return b.Completions
+	}
+	return resp.Completions
+}
+
+// run a plugin builtin
+// the plugin writes output and error messages as JSON lines, other lines are printed as they are
+func (b *pluginBuiltin) run(args []string) error {
+
+	globals := make(map[string]string)
+	g.Lock()
+	for name, value := range g.Vars {
+		globals[name] = substitutions.expand(value)
+	}
+	g.Unlock()
+
+	req, err := json.Marshal(&pluginRequest{
+		Type:    pluginRequestRun,
+		Version: version,
+		Builtin: b.Name,
+		Args:    args,
+		Dir:     workingDir,
+		ZeusDir: zeusDir,
+		Globals: globals,
+	})
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(b.path)
+	cmd.Stdin = bytes.NewReader(append(req, '\n'))
+	cmd.Stderr = os.Stderr
+	cmd.Env = os.Environ()
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		return err
+	}
+
+	var (
+		scanner  = bufio.NewScanner(stdout)
+		messages []string
+	)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		var m pluginMessage
+		if json.Unmarshal([]byte(line), &m) != nil || m.Type == "" {
+			l.Println(line)
+			continue
+		}
+
+		switch m.Type {
+		case pluginMessageOutput:
+			l.Println(m.Text)
+		case pluginMessageError:
+			messages = append(messages, m.Message)
+		}
+	}
+
+	err = cmd.Wait()
+	if len(messages) > 0 {
+		return errors.New(ErrPluginFailed.Error() + ": " + b.Name + ": " + strings.Join(messages, ", "))
+	}
+	if err != nil {
+		return errors.New(ErrPluginFailed.Error() + ": " + b.Name + ": " + err.Error())
+	}
+	return nil
+}
+
+// run the plugin builtin with the name
+// returns ErrUnknownCommand if no plugin provides it
+func runPlugin(name string, args []string) error {
+
+	b, ok := plugins.get(name)
+	if !ok {
+		return ErrUnknownCommand
+	}
+	return b.run(args)
+}
+
+// print the builtins of the plugins for the builtins overview
+func printPluginBuiltins(width int) {
+
+	names := plugins.names()
+	if len(names) == 0 {
+		return
+	}
+
+	l.Println(cp.Text + "plugins")
+	for _, name := range names {
+		b, _ := plugins.get(name)
+		description := wrapText(b.Description, terminalWidth()-width, "")
+		l.Println(cp.CmdName + pad(name, width) + cp.Text + strings.Replace(description, "\n", "\n"+pad("", width), -1))
+	}
+	l.Println()
+}
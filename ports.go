@@ -0,0 +1,212 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// behaviour when a declared port is already in use
+const (
+	portConflictsFail     = "fail"
+	portConflictsAllocate = "allocate"
+)
+
+var (
+	// ErrInvalidPort means a port declaration does not follow the variable=port format
+	ErrInvalidPort = errors.New("invalid port declaration, expected <variable>=<port>")
+
+	// ErrPortInUse means a port declared by a command is already in use
+	ErrPortInUse = errors.New("port already in use")
+)
+
+// port declared by a service command
+type commandPort struct {
+
+	// name of the global the port is exported as
+	variable string
+	port     int
+}
+
+// validate the ports field from the CommandsFile
+func validatePorts(ports []string) ([]*commandPort, error) {
+
+	var res []*commandPort
+
+	for _, p := range ports {
+
+		slice := strings.SplitN(p, "=", 2)
+		if len(slice) != 2 || strings.TrimSpace(slice[0]) == "" {
+			return nil, errors.New(ErrInvalidPort.Error() + ": " + p)
+		}
+
+		port, err := strconv.Atoi(strings.TrimSpace(slice[1]))
+		if err != nil || port < 1 || port > 65535 {
+			return nil, errors.New(ErrInvalidPort.Error() + ": " + p)
+		}
+
+		res = append(res, &commandPort{
+			variable: strings.TrimSpace(slice[0]),
+			port:     port,
+		})
+	}
+
+	return res, nil
+}
+
+// make sure the ports of the command are free before it is started
+// the port that will be used is exported as a global, so dependent commands can reach the service
+func (c *command) reservePorts() error {
+
+	conf.Lock()
+	allocate := conf.fields.PortConflicts == portConflictsAllocate
+	conf.Unlock()
+
+	for _, p := range c.ports {
+
+		port := p.port
+		if !portFree(port) {
+
+			var owner string
+			if name, pid := portOwner(port); name != "" {
+				owner = " by " + name + " (pid " + strconv.Itoa(pid) + ")"
+			}
+
+			if !allocate {
+				return errors.New(ErrPortInUse.Error() + ": " + strconv.Itoa(port) + owner)
+			}
+
+			free, err := freePort()
+			if err != nil {
+				return errors.New("failed to allocate a free port: " + err.Error())
+			}
+			l.Println(printPrompt() + "port " + strconv.Itoa(port) + " in use" + owner + ", " + c.name + " uses " + cp.Prompt + p.variable + "=" + strconv.Itoa(free) + cp.Reset)
+			port = free
+		}
+
+		g.Lock()
+		g.Vars[p.variable] = strconv.Itoa(port)
+		g.Unlock()
+	}
+
+	return nil
+}
+
+// check if a TCP port can be bound
+func portFree(port int) bool {
+	ln, err := net.Listen("tcp", ":"+strconv.Itoa(port))
+	if err != nil {
+		return false
+	}
+	ln.Close()
+	return true
+}
+
+// ask the operating system for a free TCP port
+func freePort() (int, error) {
+	ln, err := net.Listen("tcp", ":0")
+	if err != nil {
+		return 0, err
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port, nil
+}
+
+// find the process listening on a TCP port
+// returns an empty name if the owner could not be determined
+func portOwner(port int) (name string, pid int) {
+
+	// lsof prints fields prefixed with their type: p<pid> and c<command>
+	out, err := exec.Command("lsof", "-nP", "-iTCP:"+strconv.Itoa(port), "-sTCP:LISTEN", "-Fpc").Output()
+	if err == nil {
+		for _, line := range strings.Split(string(out), "\n") {
+			switch {
+			case strings.HasPrefix(line, "p") && pid == 0:
+				pid, _ = strconv.Atoi(line[1:])
+			case strings.HasPrefix(line, "c") && name == "":
+				name = line[1:]
+			}
+		}
+		if name != "" {
+			return
+		}
+	}
+
+	return procPortOwner(port)
+}
+
+// find the owner of a listening socket with the proc filesystem on linux
+func procPortOwner(port int) (name string, pid int) {
+
+	var inodes = make(map[string]bool)
+
+	for _, file := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+
+		c, err := ioutil.ReadFile(file)
+		if err != nil {
+			continue
+		}
+
+		for _, line := range strings.Split(string(c), "\n")[1:] {
+
+			// sl local_address rem_address st tx_queue:rx_queue tr:tm->when retrnsmt uid timeout inode
+			fields := strings.Fields(line)
+			if len(fields) < 10 || fields[3] != "0A" {
+				continue
+			}
+
+			addr := fields[1]
+			p, err := strconv.ParseInt(addr[strings.LastIndex(addr, ":")+1:], 16, 32)
+			if err == nil && int(p) == port {
+				inodes["socket:["+fields[9]+"]"] = true
+			}
+		}
+	}
+
+	if len(inodes) == 0 {
+		return "", 0
+	}
+
+	fds, _ := filepath.Glob("/proc/[0-9]*/fd/*")
+	for _, fd := range fds {
+
+		target, err := os.Readlink(fd)
+		if err != nil || !inodes[target] {
+			continue
+		}
+
+		dir := filepath.Dir(filepath.Dir(fd))
+		pid, _ = strconv.Atoi(filepath.Base(dir))
+
+		comm, err := ioutil.ReadFile(filepath.Join(dir, "comm"))
+		if err != nil {
+			return "", 0
+		}
+		return strings.TrimSpace(string(comm)), pid
+	}
+
+	return "", 0
+}
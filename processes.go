@@ -23,15 +23,22 @@ import (
 	"os/exec"
 	"strconv"
 	"sync"
+	"syscall"
 	"time"
 )
 
 type processID string
 
+// number of exited processes that are remembered with their exit code
+const maxExitedProcesses = 20
+
 var (
 	// process instances for all spawned commands, for cleaning up when we leave
 	processMap      = make(map[processID]*Process, 0)
 	processMapMutex = &sync.Mutex{}
+
+	// the latest processes that exited, guarded by processMapMutex
+	exitedProcesses []*Process
 )
 
 // Process keeps track of an os.Process
@@ -48,6 +55,15 @@ type Process struct {
 
 	// underlying process
 	Proc *os.Process
+
+	// exit code once the process has exited, -1 if it did not exit normally
+	ExitCode int
+
+	// whether the process has exited
+	Exited bool
+
+	// removes the temporary files of a detached command
+	cleanup func()
 }
 
 // add a process to the store
@@ -71,6 +87,50 @@ func deleteProcess(id processID) {
 	processMapMutex.Unlock()
 }
 
+// set the function that cleans up after a detached process
+// thread safe
+func setProcessCleanup(pid int, f func()) {
+	processMapMutex.Lock()
+	for _, p := range processMap {
+		if p.PID == pid {
+			p.cleanup = f
+		}
+	}
+	processMapMutex.Unlock()
+}
+
+// number of processes zeus waits for, detached processes only count if they are terminated on shutdown
+func runningProcesses() (n int) {
+	terminate := terminateAsync()
+	processMapMutex.Lock()
+	defer processMapMutex.Unlock()
+	for _, p := range processMap {
+		if p.Proc != nil || terminate {
+			n++
+		}
+	}
+	return
+}
+
+// remove a process from the store and remember its exit code
+// thread safe
+func exitProcess(pid, code int) {
+	processMapMutex.Lock()
+	defer processMapMutex.Unlock()
+	for id, p := range processMap {
+		if p.PID == pid {
+			delete(processMap, id)
+			p.Proc = nil
+			p.Exited = true
+			p.ExitCode = code
+			exitedProcesses = append(exitedProcesses, p)
+		}
+	}
+	if len(exitedProcesses) > maxExitedProcesses {
+		exitedProcesses = exitedProcesses[len(exitedProcesses)-maxExitedProcesses:]
+	}
+}
+
 // delete a process from the store by its PID
 // thread safe
 func deleteProcessByPID(pid int) {
@@ -122,28 +182,61 @@ func clearProcessMap() {
 	}
 }
 
-// clean up the mess
+// pass a signal to all spawned processes and their process groups
+// detached processes only receive it if they are terminated on shutdown
 func passSignalToProcs(sig os.Signal) {
 
-	// l.Println("processMap:", processMap)
+	sysSig, ok := sig.(syscall.Signal)
+	if !ok {
+		sysSig = syscall.SIGINT
+	}
+	terminate := terminateAsync()
 
 	processMapMutex.Lock()
 	defer processMapMutex.Unlock()
 
 	// range processes
 	for _, p := range processMap {
-		if p.Proc != nil {
+		if p.Proc == nil && !terminate {
+			continue
+		}
 
-			Log.Debug("passing signal "+sig.String()+" to PID: ", p.Proc.Pid)
+		Log.Debug("passing signal "+sig.String()+" to PID: ", p.PID)
 
-			err := p.Proc.Signal(sig)
-			if err != nil {
-				Log.WithError(err).Debug("failed to pass signal "+sig.String()+" to PID:", p.Proc.Pid)
-			}
+		err := signalProcess(p.PID, sysSig)
+		if err != nil {
+			Log.WithError(err).Debug("failed to pass signal "+sig.String()+" to PID:", p.PID)
 		}
 	}
 }
 
+// kill all spawned processes and their process groups immediately
+// detached processes are only killed if they are terminated on shutdown, their cleanup runs afterwards
+func killProcesses() {
+
+	terminate := terminateAsync()
+
+	processMapMutex.Lock()
+	var cleanups []func()
+	for _, p := range processMap {
+		if p.Proc == nil && !terminate {
+			continue
+		}
+		err := signalProcess(p.PID, syscall.SIGKILL)
+		if err != nil {
+			Log.WithError(err).Debug("failed to kill PID:", p.PID)
+		}
+		if p.Proc == nil && p.cleanup != nil {
+			cleanups = append(cleanups, p.cleanup)
+		}
+	}
+	processMapMutex.Unlock()
+
+	for _, f := range cleanups {
+		f()
+	}
+}
+
 func printProcsCommandUsageErr() {
 	l.Println(ErrInvalidUsage)
 	l.Println("usage: procs [detach <command>] [attach <pid>] [kill <pid>]")
@@ -204,8 +297,11 @@ func printProcs() {
 	processMapMutex.Lock()
 	defer processMapMutex.Unlock()
 
-	l.Println(cp.Prompt + pad("ID", 20) + pad("PID", 10) + "Name")
+	l.Println(cp.Prompt + pad("ID", 20) + pad("PID", 10) + pad("Exit", 6) + "Name")
 	for _, p := range processMap {
-		l.Println(cp.Text + pad(string(p.ID), 20) + pad(strconv.Itoa(p.PID), 10) + p.Name)
+		l.Println(cp.Text + pad(string(p.ID), 20) + pad(strconv.Itoa(p.PID), 10) + pad("-", 6) + p.Name)
+	}
+	for _, p := range exitedProcesses {
+		l.Println(cp.Text + pad(string(p.ID), 20) + pad(strconv.Itoa(p.PID), 10) + pad(strconv.Itoa(p.ExitCode), 6) + p.Name)
 	}
 }
@@ -0,0 +1,265 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// print a timing breakdown and write a chrome trace after a run from the commandline
+	profileRun bool
+
+	// default path for the chrome trace
+	tracePath = zeusDir + "/trace.json"
+)
+
+func printProfileCommandUsageErr() {
+	l.Println(ErrInvalidUsage)
+	l.Println("usage: profile [clear] [<command>]")
+}
+
+// traceEvent is a complete event in the chrome trace_event format
+// see: https://docs.google.com/document/d/1CvAClvFfyA5R-PhYUmn5OOQtYMH4h6I0nSsKchNAySU
+type traceEvent struct {
+	Name      string            `json:"name"`
+	Category  string            `json:"cat"`
+	Phase     string            `json:"ph"`
+	Timestamp int64             `json:"ts"`
+	Duration  int64             `json:"dur"`
+	PID       int               `json:"pid"`
+	TID       int               `json:"tid"`
+	Args      map[string]string `json:"args,omitempty"`
+}
+
+// traceFile is the JSON object format for chrome traces
+type traceFile struct {
+	TraceEvents     []*traceEvent `json:"traceEvents"`
+	DisplayTimeUnit string        `json:"displayTimeUnit"`
+}
+
+// commandProfile holds the accumulated timings of a command
+type commandProfile struct {
+	name    string
+	runs    int
+	skipped int
+	failed  int
+	total   time.Duration
+}
+
+// handle profile shell command
+func handleProfileCommand(args []string) {
+
+	if len(args) == 1 {
+		printProfile(runRecords.records())
+		return
+	}
+
+	if args[1] == "clear" {
+		if len(args) != 2 {
+			printProfileCommandUsageErr()
+			return
+		}
+		runRecords.flush()
+		return
+	}
+
+	// profile the given command or commandChain
+	runRecords.flush()
+	handleLine(strings.Join(args[1:], " "))
+
+	records := runRecords.records()
+	printProfile(records)
+	writeProfileTrace(records)
+}
+
+// accumulate the timings for each command
+// sorted by total duration, longest first
+func profileCommands(records []*runRecord) (profiles []*commandProfile) {
+
+	var index = make(map[string]*commandProfile)
+
+	for _, r := range records {
+		p, ok := index[r.Name]
+		if !ok {
+			p = &commandProfile{name: r.Name}
+			index[r.Name] = p
+			profiles = append(profiles, p)
+		}
+		if r.Skipped {
+			p.skipped++
+			continue
+		}
+		if r.Err != nil {
+			p.failed++
+		}
+		p.runs++
+		p.total += r.Duration
+	}
+
+	sort.SliceStable(profiles, func(i, j int) bool {
+		return profiles[i].total > profiles[j].total
+	})
+
+	return
+}
+
+// calculate the wall time from the first start to the last end
+func wallTime(records []*runRecord) time.Duration {
+
+	var first, last time.Time
+	for _, r := range records {
+		if first.IsZero() || r.Start.Before(first) {
+			first = r.Start
+		}
+		if end := r.Start.Add(r.Duration); end.After(last) {
+			last = end
+		}
+	}
+
+	return last.Sub(first)
+}
+
+// print the timing breakdown table
+func printProfile(records []*runRecord) {
+
+	if len(records) == 0 {
+		l.Println("no commands executed yet.")
+		return
+	}
+
+	var (
+		wall = wallTime(records)
+		w    = 25
+	)
+
+	l.Println(cp.Prompt + pad("command", w) + pad("runs", 8) + pad("skipped", 9) + pad("failed", 8) + pad("total", 15) + pad("average", 15) + "share" + cp.Text)
+	for _, p := range profileCommands(records) {
+
+		var avg time.Duration
+		if p.runs > 0 {
+			avg = p.total / time.Duration(p.runs)
+		}
+
+		var share float64
+		if wall > 0 {
+			share = float64(p.total) / float64(wall) * 100
+		}
+
+		l.Println(pad(p.name, w) + pad(strconv.Itoa(p.runs), 8) + pad(strconv.Itoa(p.skipped), 9) + pad(strconv.Itoa(p.failed), 8) + pad(formatDuration(p.total), 15) + pad(formatDuration(avg), 15) + strconv.FormatFloat(share, 'f', 1, 64) + "%")
+	}
+	l.Println(cp.Prompt + pad("wall time", w) + cp.Text + formatDuration(wall) + cp.Reset)
+}
+
+// create the chrome trace for the given records
+// commands running at the same time are placed on separate threads
+func newTrace(records []*runRecord) *traceFile {
+
+	var (
+		trace = &traceFile{
+			DisplayTimeUnit: "ms",
+		}
+		sorted = append([]*runRecord{}, records...)
+		lanes  []time.Time
+		first  time.Time
+	)
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Start.Before(sorted[j].Start)
+	})
+
+	if len(sorted) > 0 {
+		first = sorted[0].Start
+	}
+
+	for _, r := range sorted {
+
+		// find the first lane that is free at the start of the command
+		tid := -1
+		for i, end := range lanes {
+			if !end.After(r.Start) {
+				tid = i
+				break
+			}
+		}
+		if tid == -1 {
+			lanes = append(lanes, time.Time{})
+			tid = len(lanes) - 1
+		}
+		lanes[tid] = r.Start.Add(r.Duration)
+
+		e := &traceEvent{
+			Name:      r.Name,
+			Category:  "command",
+			Phase:     "X",
+			Timestamp: int64(r.Start.Sub(first) / time.Microsecond),
+			Duration:  int64(r.Duration / time.Microsecond),
+			PID:       os.Getpid(),
+			TID:       tid,
+			Args:      map[string]string{},
+		}
+		if len(r.Args) > 0 {
+			e.Args["args"] = strings.Join(r.Args, " ")
+		}
+		if r.Skipped {
+			e.Args["skipped"] = "true"
+		}
+		if r.Err != nil {
+			e.Args["error"] = r.Err.Error()
+		}
+		trace.TraceEvents = append(trace.TraceEvents, e)
+	}
+
+	return trace
+}
+
+// write the chrome trace to disk
+func writeProfileTrace(records []*runRecord) {
+
+	if len(records) == 0 {
+		return
+	}
+
+	c, err := json.MarshalIndent(newTrace(records), "", "  ")
+	if err != nil {
+		Log.WithError(err).Error("failed to marshal trace")
+		return
+	}
+
+	err = os.MkdirAll(filepath.Dir(tracePath), 0700)
+	if err != nil {
+		Log.WithError(err).Error("failed to create trace directory")
+		return
+	}
+
+	err = ioutil.WriteFile(tracePath, c, 0644)
+	if err != nil {
+		Log.WithError(err).Error("failed to write trace")
+		return
+	}
+
+	l.Println(cp.Text + "trace written to " + cp.Prompt + tracePath + cp.Text + ", open it in chrome://tracing" + cp.Reset)
+}
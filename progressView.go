@@ -0,0 +1,488 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dreadl0ck/readline"
+	"github.com/mgutz/ansi"
+)
+
+// interval of the redraws of the progress view
+const progressViewInterval = 100 * time.Millisecond
+
+// states of the rows in the progress view, besides the states of the commands
+const (
+	// planned, but not started yet
+	rowPending = "pending"
+
+	// the script of the command is running
+	rowRunning = "running"
+
+	// the command failed
+	rowFailed = "failed"
+)
+
+var (
+	// the live view of the execution plan, used with the fancyOutput config field
+	progressUI = &progressView{out: os.Stdout}
+
+	// animation of running commands
+	spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+)
+
+// progressRow is a command in the progress view
+type progressRow struct {
+	name     string
+	state    string
+	start    time.Time
+	duration time.Duration
+	children []*progressRow
+
+	// the output of the command, printed if it fails
+	output *boundedBuffer
+
+	// the latest line of output, shown while the command is running
+	lastLine string
+}
+
+// progressView draws a tree of the execution plan below the output,
+// with a spinner and the elapsed time for the running commands
+// the output of the commands is held back and only printed for failed commands,
+// a successful command collapses to a single line once its dependencies finished
+type progressView struct {
+	out    io.Writer
+	active bool
+	rows   []*progressRow
+
+	// names of the commands in the tree
+	planned map[string]bool
+
+	// number of lines of the last drawing
+	drawn int
+
+	// number of commands that currently need the terminal for themselves
+	suspended int
+
+	frame int
+	done  chan struct{}
+
+	sync.Mutex
+}
+
+// check if the progress view should be used for the next run
+// it needs a terminal and falls back to the line output otherwise, in quiet mode there is no progress
+func fancyOutput() bool {
+
+	conf.Lock()
+	fancy := conf.fields.FancyOutput && !conf.fields.RawOutput && !conf.fields.Accessible
+	conf.Unlock()
+
+	return fancy && !ciMode && !quietOutput() && readline.IsTerminal(int(os.Stdout.Fd()))
+}
+
+// start the view for a new run, if enabled
+// the output of the logger goes above the view until it is stopped
+func (v *progressView) start() {
+
+	if !fancyOutput() {
+		return
+	}
+
+	v.Lock()
+	if v.active {
+		v.Unlock()
+		return
+	}
+	v.active = true
+	v.rows = nil
+	v.planned = make(map[string]bool)
+	v.drawn = 0
+	v.suspended = 0
+	v.done = make(chan struct{})
+	v.Unlock()
+
+	// outside of the lock, the logger holds its own lock while writing to the view
+	l.SetOutput(v)
+
+	go func(done chan struct{}) {
+		ticker := time.NewTicker(progressViewInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				v.Lock()
+				// the view may have been stopped while waiting for the lock
+				select {
+				case <-done:
+				default:
+					v.frame++
+					v.redraw(nil)
+				}
+				v.Unlock()
+			}
+		}
+	}(v.done)
+}
+
+// stop the view, the final state of the tree stays on the terminal
+func (v *progressView) stop() {
+
+	v.Lock()
+	if !v.active {
+		v.Unlock()
+		return
+	}
+	close(v.done)
+	v.redraw(nil)
+	v.drawn = 0
+	v.active = false
+	v.Unlock()
+
+	l.SetOutput(os.Stdout)
+}
+
+// check if the view is drawn
+func (v *progressView) isActive() bool {
+	v.Lock()
+	defer v.Unlock()
+	return v.active
+}
+
+// add the command and its dependencies to the tree
+// dependencies that are already part of the tree are not added again, like in the execution plan
+func (v *progressView) plan(c *command) {
+
+	v.Lock()
+	defer v.Unlock()
+
+	if !v.active {
+		return
+	}
+	if row := v.planRow(c); row != nil {
+		v.rows = append(v.rows, row)
+	}
+}
+
+// create the row for a command and its dependencies, the caller holds the lock
+func (v *progressView) planRow(c *command) *progressRow {
+
+	if v.planned[c.name] {
+		return nil
+	}
+	v.planned[c.name] = true
+
+	row := &progressRow{name: c.name, state: rowPending}
+	if skipDependencies() {
+		return row
+	}
+
+	for _, dep := range c.dependencies {
+		fields := strings.Fields(dep)
+		if len(fields) == 0 {
+			continue
+		}
+		depCmd, err := cmdMap.getCommand(fields[0])
+		if err != nil {
+			continue
+		}
+		if child := v.planRow(depCmd); child != nil {
+			row.children = append(row.children, child)
+		}
+	}
+	return row
+}
+
+// find the first row of the named command in the given state
+// unplanned commands are added at the end of the tree
+func (v *progressView) row(name, state string) *progressRow {
+
+	var find func(rows []*progressRow) *progressRow
+	find = func(rows []*progressRow) *progressRow {
+		for _, r := range rows {
+			if r.name == name && r.state == state {
+				return r
+			}
+			if found := find(r.children); found != nil {
+				return found
+			}
+		}
+		return nil
+	}
+
+	if r := find(v.rows); r != nil {
+		return r
+	}
+
+	r := &progressRow{name: name, state: state}
+	v.rows = append(v.rows, r)
+	return r
+}
+
+// mark the command as running
+// returns a writer that holds back the output of the command, nil if the view is not active
+func (v *progressView) running(name string) io.Writer {
+
+	v.Lock()
+	defer v.Unlock()
+
+	if !v.active {
+		return nil
+	}
+
+	r := v.row(name, rowPending)
+	r.state = rowRunning
+	r.start = time.Now()
+	r.output = newBoundedBuffer(stdErrBufferSize())
+
+	return &progressRowWriter{row: r, v: v}
+}
+
+// mark a command that was not started with its state: skipped, cached or detached
+func (v *progressView) finished(name, state string) {
+
+	v.Lock()
+	defer v.Unlock()
+
+	if !v.active {
+		return
+	}
+	v.row(name, rowPending).state = state
+}
+
+// mark the running command as executed or failed
+// the held back output of a failed command is printed above the view
+func (v *progressView) exited(name string, err error) {
+
+	v.Lock()
+	defer v.Unlock()
+
+	if !v.active {
+		return
+	}
+
+	r := v.row(name, rowRunning)
+	r.duration = time.Since(r.start)
+	r.state = stateExecuted
+	if err == nil {
+		return
+	}
+	r.state = rowFailed
+
+	if r.output != nil && r.output.String() != "" {
+		var b bytes.Buffer
+		b.WriteString(fitLine(cp.Prompt+"output of "+r.name+cp.Reset) + "\n")
+		b.WriteString(strings.TrimSuffix(r.output.String(), "\n") + "\n")
+		v.redraw(b.Bytes())
+	}
+}
+
+// stop drawing while a command uses the terminal for itself, for example in a pseudo terminal
+func (v *progressView) suspend() {
+	v.Lock()
+	defer v.Unlock()
+	if v.active {
+		v.clear()
+		v.suspended++
+	}
+}
+
+// draw again after suspend
+func (v *progressView) resume() {
+	v.Lock()
+	defer v.Unlock()
+	if v.active && v.suspended > 0 {
+		v.suspended--
+		v.redraw(nil)
+	}
+}
+
+// Write implements the io.Writer interface
+// the text is written above the view
+func (v *progressView) Write(p []byte) (int, error) {
+
+	v.Lock()
+	defer v.Unlock()
+
+	if !v.active {
+		return v.out.Write(p)
+	}
+
+	v.redraw(p)
+	return len(p), nil
+}
+
+// erase the view, the caller holds the lock
+func (v *progressView) clear() {
+	if v.drawn > 0 {
+		v.out.Write([]byte(eraseLines(v.drawn)))
+		v.drawn = 0
+	}
+}
+
+// move the cursor up n lines and erase everything below
+func eraseLines(n int) string {
+	return "\x1b[" + strconv.Itoa(n) + "F\x1b[J"
+}
+
+// erase the view, write the text and draw the view below it, at once to avoid flickering
+// the caller holds the lock
+func (v *progressView) redraw(text []byte) {
+
+	var b bytes.Buffer
+	if v.drawn > 0 {
+		b.WriteString(eraseLines(v.drawn))
+	}
+	b.Write(text)
+
+	v.drawn = 0
+	if v.suspended == 0 {
+		lines := v.render(time.Now(), progressViewHeight())
+		for _, line := range lines {
+			b.WriteString(fitLine(line) + "\n")
+		}
+		v.drawn = len(lines)
+	}
+
+	v.out.Write(b.Bytes())
+}
+
+// maximum number of lines of the view, it must fit on the screen to be erased again
+func progressViewHeight() int {
+	_, h, err := readline.GetSize(int(os.Stdout.Fd()))
+	if err != nil || h < 4 {
+		return 20
+	}
+	return h - 2
+}
+
+// the lines of the tree, at most height lines
+// the top of a tree that is too high is cut
+func (v *progressView) render(now time.Time, height int) (lines []string) {
+
+	for _, r := range v.rows {
+		lines = append(lines, v.renderRow(r, 0, now)...)
+	}
+
+	if height > 0 && len(lines) > height {
+		cut := len(lines) - height + 1
+		lines = append([]string{cp.Text + "… " + strconv.Itoa(cut) + " more" + cp.Reset}, lines[cut:]...)
+	}
+	return
+}
+
+// the line of a row followed by those of its children
+// a successful row collapses once all rows below it are done, the number of collapsed steps is shown
+func (v *progressView) renderRow(r *progressRow, depth int, now time.Time) []string {
+
+	var (
+		line   = strings.Repeat("  ", depth)
+		steps  = r.countSteps()
+		status string
+	)
+
+	switch r.state {
+	case rowPending:
+		line += cp.Text + "○ " + r.name
+	case rowRunning:
+		line += cp.Prompt + spinnerFrames[v.frame%len(spinnerFrames)] + " " + cp.CmdName + r.name
+		status = formatDuration(now.Sub(r.start))
+		if r.lastLine != "" {
+			status += "  " + cp.Text + r.lastLine
+		}
+	case rowFailed:
+		line += ansi.Red + "✗ " + r.name
+		status = formatDuration(r.duration)
+	case stateExecuted:
+		line += cp.Prompt + "✓ " + cp.CmdName + r.name
+		status = formatDuration(r.duration)
+	default:
+		line += cp.Prompt + "✓ " + cp.Text + r.name + " (" + r.state + ")"
+	}
+
+	collapsed := r.state != rowPending && r.state != rowRunning && r.state != rowFailed && r.succeeded()
+	if collapsed && steps > 0 {
+		line += cp.Text + " +" + strconv.Itoa(steps) + " steps"
+	}
+	if status != "" {
+		line += cp.Text + "  " + status
+	}
+
+	lines := []string{line + cp.Reset}
+	if collapsed {
+		return lines
+	}
+	for _, c := range r.children {
+		lines = append(lines, v.renderRow(c, depth+1, now)...)
+	}
+	return lines
+}
+
+// number of rows below a row
+func (r *progressRow) countSteps() (n int) {
+	for _, c := range r.children {
+		n += 1 + c.countSteps()
+	}
+	return
+}
+
+// check if all rows below a row are done and none of them failed
+func (r *progressRow) succeeded() bool {
+	for _, c := range r.children {
+		if c.state == rowPending || c.state == rowRunning || c.state == rowFailed || !c.succeeded() {
+			return false
+		}
+	}
+	return true
+}
+
+// progressRowWriter holds back the output of a command in the progress view
+type progressRowWriter struct {
+	row *progressRow
+	v   *progressView
+}
+
+// Write implements the io.Writer interface
+func (w *progressRowWriter) Write(p []byte) (int, error) {
+
+	w.v.Lock()
+	defer w.v.Unlock()
+
+	w.row.output.Write(p)
+
+	// the latest non empty line, progress bars rewrite their line with a carriage return
+	for _, line := range strings.Split(string(p), "\n") {
+		if i := strings.LastIndex(line, "\r"); i >= 0 {
+			line = line[i+1:]
+		}
+		if line = strings.TrimSpace(stripANSI(line)); line != "" {
+			w.row.lastLine = line
+		}
+	}
+	return len(p), nil
+}
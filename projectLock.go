@@ -0,0 +1,250 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// flag to block until the project lock is released, instead of failing
+	projectLockWaitFlag = "wait"
+
+	// interval for checking if the project lock has been released
+	projectLockPollInterval = 250 * time.Millisecond
+)
+
+var (
+	// ErrProjectLocked means another zeus instance is executing commands in the project
+	ErrProjectLocked = errors.New("the project is locked by another zeus instance")
+
+	// path of the project lock file
+	projectLockPath = zeusDir + "/.lock"
+
+	// the lock of the current process
+	projectLocks = &projectLock{
+		interrupts: make(chan struct{}, 1),
+	}
+)
+
+// projectLockOwner is the content of the lock file
+type projectLockOwner struct {
+	PID     int       `json:"pid"`
+	RunID   string    `json:"runID"`
+	Started time.Time `json:"started"`
+}
+
+// projectLock makes sure only one zeus instance executes commands in a working tree at a time
+// it is acquired by the top-level invocation and shared by nested and async invocations
+type projectLock struct {
+
+	// number of invocations holding the lock
+	holders int
+
+	// the lock file has been created by this process
+	owned bool
+
+	// block until the lock is released instead of failing, set with the --wait flag
+	wait bool
+
+	// a signal stops waiting for the lock
+	interrupts chan struct{}
+
+	sync.Mutex
+}
+
+// check if executing commands requires the project lock
+// there is no lock before the config is loaded
+func projectLockEnabled() bool {
+	if conf == nil {
+		return false
+	}
+	conf.RLock()
+	defer conf.RUnlock()
+	return conf.fields.ProjectLock
+}
+
+// acquire the lock for an invocation
+// a zeus process started by a command of the lock owner continues its invocation and does not need the lock
+func (p *projectLock) acquire() error {
+
+	p.Lock()
+	defer p.Unlock()
+
+	if p.holders > 0 || !(p.wait || projectLockEnabled()) {
+		p.holders++
+		return nil
+	}
+
+	// forget signals received before waiting started
+	select {
+	case <-p.interrupts:
+	default:
+	}
+
+	var waiting bool
+	for {
+		owner, err := tryProjectLock()
+		if err != nil {
+			return err
+		}
+		if owner == nil {
+			p.owned = true
+			break
+		}
+		if owner.RunID != "" && owner.RunID == os.Getenv(runIDEnv) {
+			break
+		}
+
+		if !p.wait {
+			return errors.New(ErrProjectLocked.Error() + " " + owner.String() + ", use --" + projectLockWaitFlag + " to wait for it")
+		}
+		if !waiting {
+			waiting = true
+			l.Println(cp.Text + "waiting for the project lock, held by " + owner.String() + cp.Reset)
+		}
+
+		select {
+		case <-p.interrupts:
+			return ErrInterrupted
+		case <-time.After(projectLockPollInterval):
+		}
+	}
+
+	p.holders++
+	return nil
+}
+
+// release the lock of an invocation, the lock file is removed when the last invocation ended
+func (p *projectLock) release() {
+
+	p.Lock()
+	defer p.Unlock()
+
+	if p.holders == 0 {
+		return
+	}
+	p.holders--
+
+	if p.holders == 0 && p.owned {
+		p.owned = false
+		err := os.Remove(projectLockPath)
+		if err != nil && !os.IsNotExist(err) {
+			Log.WithError(err).Error("failed to remove the project lock")
+		}
+	}
+}
+
+// stop waiting for the lock
+func (p *projectLock) interrupt() {
+	select {
+	case p.interrupts <- struct{}{}:
+	default:
+	}
+}
+
+// try to create the lock file and return its owner if it is held by a running process
+// a lock of a process that does not exist anymore is stale and will be replaced
+func tryProjectLock() (*projectLockOwner, error) {
+
+	runID, _ := s.run()
+
+	contents, err := json.Marshal(&projectLockOwner{
+		PID:     os.Getpid(),
+		RunID:   runID,
+		Started: time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// write to a temporary file and link it, so the lock file is never seen without contents
+	tmp := projectLockPath + "." + strconv.Itoa(os.Getpid())
+	err = ioutil.WriteFile(tmp, contents, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp)
+
+	for {
+		err = os.Link(tmp, projectLockPath)
+		if err == nil {
+			return nil, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+
+		owner, err := readProjectLock()
+		if err != nil {
+			if os.IsNotExist(err) {
+				// released in the meantime
+				continue
+			}
+			return nil, err
+		}
+
+		if owner.alive() {
+			return owner, nil
+		}
+
+		Log.Debug("removing stale project lock of ", owner.String())
+		err = os.Remove(projectLockPath)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+}
+
+// read the owner of the lock file
+// a lock file that can not be parsed is treated as stale
+func readProjectLock() (*projectLockOwner, error) {
+
+	contents, err := ioutil.ReadFile(projectLockPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var owner = new(projectLockOwner)
+	if err := json.Unmarshal(contents, owner); err != nil {
+		Log.WithError(err).Debug("invalid project lock")
+		return &projectLockOwner{}, nil
+	}
+	return owner, nil
+}
+
+// check if the process holding the lock is still running
+func (o *projectLockOwner) alive() bool {
+	if o.PID <= 0 {
+		return false
+	}
+	err := syscall.Kill(o.PID, 0)
+	return err == nil || err == syscall.EPERM
+}
+
+func (o *projectLockOwner) String() string {
+	return "pid " + strconv.Itoa(o.PID) + " since " + o.Started.Format(time.RFC3339)
+}
@@ -0,0 +1,277 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// report project
+	reportTargetProject = "project"
+
+	// number of scripts listed as the largest ones
+	largestScriptsLimit = 5
+)
+
+// projectReport summarizes the structure of the project, it is computed locally and never sent anywhere
+type projectReport struct {
+
+	// number of commands
+	commands int
+
+	// number of commands by language
+	languages map[string]int
+
+	// the longest chain of dependencies, starting with the command that has it
+	deepest []string
+
+	// commands by number of lines of their scripts, largest first
+	largest []scriptSize
+
+	// commands that are neither referenced nor have been run
+	unused []string
+}
+
+// size of the script of a command
+type scriptSize struct {
+	name  string
+	lines int
+}
+
+func printReportUsageErr() {
+	l.Println(ErrInvalidUsage)
+	l.Println("usage: report " + reportTargetProject)
+}
+
+// report project
+func handleReportCommand(args []string) {
+
+	if len(args) != 2 || args[1] != reportTargetProject {
+		printReportUsageErr()
+		return
+	}
+
+	entries, err := readRunHistory()
+	if err != nil {
+		l.Println("failed to read run history:", err)
+		return
+	}
+
+	newProjectReport(entries).print()
+}
+
+// collect the report for the commands in the command map
+func newProjectReport(history []*historyEntry) *projectReport {
+
+	cmdMap.RLock()
+	defer cmdMap.RUnlock()
+
+	r := &projectReport{
+		commands:  len(cmdMap.items),
+		languages: make(map[string]int),
+	}
+
+	var (
+		referenced = projectReferences()
+		depths     = make(map[string][]string)
+		names      []string
+	)
+
+	for name := range cmdMap.items {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, h := range history {
+		referenced[h.Name] = true
+	}
+
+	for _, name := range names {
+		c := cmdMap.items[name]
+
+		r.languages[c.language]++
+		r.largest = append(r.largest, scriptSize{name: name, lines: c.scriptLines()})
+
+		if chain := dependencyChain(name, depths, make(map[string]bool)); len(chain) > len(r.deepest) {
+			r.deepest = chain
+		}
+
+		for _, dep := range append(append([]string{}, c.dependencies...), c.finally...) {
+			if fields := strings.Fields(dep); len(fields) > 0 && fields[0] != name {
+				referenced[fields[0]] = true
+			}
+		}
+	}
+
+	for _, name := range names {
+		if !referenced[name] {
+			r.unused = append(r.unused, name)
+		}
+	}
+
+	sort.SliceStable(r.largest, func(i, j int) bool {
+		return r.largest[i].lines > r.largest[j].lines
+	})
+	if len(r.largest) > largestScriptsLimit {
+		r.largest = r.largest[:largestScriptsLimit]
+	}
+
+	return r
+}
+
+// the command names in the hooks, aliases and events of the project
+// every word of their command lines counts, so the separators of command chains need no parsing
+func projectReferences() map[string]bool {
+
+	var (
+		referenced = make(map[string]bool)
+		lines      []string
+	)
+
+	gitHooks.Lock()
+	for _, chain := range gitHooks.items {
+		lines = append(lines, chain)
+	}
+	gitHooks.Unlock()
+
+	projectData.Lock()
+	for _, command := range projectData.fields.Aliases {
+		lines = append(lines, command)
+	}
+	for _, e := range projectData.fields.Events {
+		lines = append(lines, e.Command)
+	}
+	projectData.Unlock()
+
+	for _, line := range lines {
+		for _, word := range strings.Fields(line) {
+			referenced[word] = true
+		}
+	}
+	return referenced
+}
+
+// the longest chain of dependencies starting at the named command, the caller holds the lock
+// results are memoized in depths, visiting breaks cycles
+func dependencyChain(name string, depths map[string][]string, visiting map[string]bool) []string {
+
+	if chain, ok := depths[name]; ok {
+		return chain
+	}
+
+	c, ok := cmdMap.items[name]
+	if !ok || visiting[name] {
+		return nil
+	}
+	visiting[name] = true
+	defer delete(visiting, name)
+
+	var longest []string
+	for _, dep := range c.dependencies {
+		fields := strings.Fields(dep)
+		if len(fields) == 0 {
+			continue
+		}
+		if chain := dependencyChain(fields[0], depths, visiting); len(chain) > len(longest) {
+			longest = chain
+		}
+	}
+
+	chain := append([]string{name}, longest...)
+	depths[name] = chain
+	return chain
+}
+
+// number of lines of the script of the command
+func (c *command) scriptLines() int {
+
+	script := c.exec
+	if script == "" && c.path != "" {
+		contents, err := ioutil.ReadFile(c.path)
+		if err != nil {
+			return 0
+		}
+		script = string(contents)
+	}
+
+	script = strings.TrimRight(script, "\n")
+	if script == "" {
+		return 0
+	}
+	return strings.Count(script, "\n") + 1
+}
+
+// the languages with the number of their commands, most used first
+func (r *projectReport) languageSummary() string {
+
+	var names []string
+	for name := range r.languages {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if r.languages[names[i]] != r.languages[names[j]] {
+			return r.languages[names[i]] > r.languages[names[j]]
+		}
+		return names[i] < names[j]
+	})
+
+	var parts []string
+	for _, name := range names {
+		parts = append(parts, name+" "+strconv.Itoa(r.languages[name]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (r *projectReport) print() {
+
+	const width = 20
+
+	l.Println(cp.Prompt + "project report" + cp.Text)
+	l.Println(pad("commands", width) + strconv.Itoa(r.commands))
+	if r.commands == 0 {
+		return
+	}
+	l.Println(pad("languages", width) + r.languageSummary())
+
+	// the depth counts the dependencies, a command without any has depth 0
+	depth := strconv.Itoa(len(r.deepest) - 1)
+	if len(r.deepest) > 1 {
+		depth += " (" + strings.Join(r.deepest, " -> ") + ")"
+	}
+	l.Println(fitLine(pad("dependency depth", width) + depth))
+
+	l.Println(cp.Prompt + "largest scripts" + cp.Text)
+	for _, s := range r.largest {
+		l.Println(pad("  "+s.name, width) + strconv.Itoa(s.lines) + " lines")
+	}
+
+	l.Println(cp.Prompt + "unused commands" + cp.Text)
+	if len(r.unused) == 0 {
+		l.Println("  none")
+		return
+	}
+	for _, name := range r.unused {
+		l.Println("  " + name)
+	}
+	l.Println(cp.Text + "not referenced by other commands, hooks, aliases or events, and never run")
+}
@@ -0,0 +1,108 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	// placeholders in the prompt template: {name}
+	promptPlaceholder = regexp.MustCompile(`\{[a-z_]+\}`)
+
+	// the prompt rendered from the template of the prompt config field
+	// rendered once for every line read by the interactive shell, the output lines reuse it
+	shellPrompt = &promptCache{}
+)
+
+type promptCache struct {
+	rendered string
+	sync.Mutex
+}
+
+// resolve the placeholder of a prompt template
+// only the placeholders used in the template are resolved, the branch needs the version control system
+func promptValue(placeholder string) (string, bool) {
+	switch placeholder {
+	case "{project}":
+		return filepath.Base(workingDir), true
+	case "{git_branch}", "{branch}":
+		branch, err := projectVCS().branch()
+		if err != nil {
+			return "", true
+		}
+		return branch, true
+	case "{env}":
+		return envs.current(), true
+	case "{jobs}":
+		if n := runningProcesses(); n > 0 {
+			return strconv.Itoa(n) + " jobs", true
+		}
+		return "", true
+	}
+	return "", false
+}
+
+// replace the placeholders of a prompt template
+// unknown placeholders are kept, the spaces around empty ones are collapsed
+func renderPrompt(template string, value func(string) (string, bool)) string {
+
+	out := promptPlaceholder.ReplaceAllStringFunc(template, func(p string) string {
+		if v, ok := value(p); ok {
+			return v
+		}
+		return p
+	})
+
+	return strings.Join(strings.Fields(out), " ") + " "
+}
+
+// render the prompt for the interactive shell
+// without a template the project name, the environment profile and the arrow are shown
+func refreshPrompt() string {
+
+	var template string
+	if conf != nil {
+		conf.RLock()
+		template = conf.fields.Prompt
+		conf.RUnlock()
+	}
+
+	var rendered string
+	if template != "" {
+		rendered = cp.Prompt + renderPrompt(template, promptValue) + cp.Text
+	}
+
+	shellPrompt.Lock()
+	shellPrompt.rendered = rendered
+	shellPrompt.Unlock()
+
+	if rendered == "" {
+		return defaultPrompt()
+	}
+	return rendered
+}
+
+func defaultPrompt() string {
+	return cp.Prompt + zeusPrompt + envs.prompt() + marker(" » ", "> ") + cp.Text
+}
@@ -0,0 +1,90 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	"github.com/creack/pty"
+	"github.com/dreadl0ck/readline"
+)
+
+// start the command attached to a pseudo terminal
+// the output of the terminal is copied to out, the returned function waits until all output has been copied
+// programs that check isatty (colored test runners, prompts, progress bars) behave like in a normal shell
+func startPTY(cmd *exec.Cmd, out io.Writer) (wait func(), err error) {
+
+	// pty.Start attaches all standard streams to the terminal
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = nil, nil, nil
+
+	ptmx, err := pty.Start(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	// proxy the window size of the zeus terminal
+	resize := make(chan os.Signal, 1)
+	signal.Notify(resize, syscall.SIGWINCH)
+	go func() {
+		for range resize {
+			err := pty.InheritSize(os.Stdin, ptmx)
+			if err != nil {
+				Log.WithError(err).Debug("failed to resize pty")
+			}
+		}
+	}()
+	resize <- syscall.SIGWINCH
+
+	// pass keystrokes through unprocessed, the pty handles line editing
+	var (
+		fd    = int(os.Stdin.Fd())
+		state *readline.State
+	)
+	if readline.IsTerminal(fd) {
+		state, err = readline.MakeRaw(fd)
+		if err != nil {
+			Log.WithError(err).Debug("failed to set terminal into raw mode")
+		}
+	}
+
+	go io.Copy(ptmx, os.Stdin)
+
+	done := make(chan struct{})
+	go func() {
+		// returns with EIO once the process closed the terminal
+		io.Copy(out, ptmx)
+		close(done)
+	}()
+
+	return func() {
+		<-done
+
+		signal.Stop(resize)
+		close(resize)
+
+		if state != nil {
+			readline.Restore(fd, state)
+		}
+		ptmx.Close()
+	}, nil
+}
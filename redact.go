@@ -0,0 +1,98 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"os"
+	"sort"
+	"strings"
+)
+
+// shorter values are not redacted, they would hide too much of the output
+const minRedactLength = 4
+
+// default patterns for names of sensitive environment variables and globals
+var defaultRedactPatterns = []string{"TOKEN", "PASSWORD", "KEY", "SECRET"}
+
+// check if the name of a variable matches one of the redactPatterns, ignoring case
+func sensitiveName(name string, patterns []string) bool {
+	name = strings.ToUpper(name)
+	for _, p := range patterns {
+		if p != "" && strings.Contains(name, strings.ToUpper(p)) {
+			return true
+		}
+	}
+	return false
+}
+
+// collect the values of environment variables and globals with sensitive names
+// sorted by length, so longer values are replaced before the values they contain
+func redactedValues() (values []string) {
+
+	conf.Lock()
+	patterns := conf.fields.RedactPatterns
+	conf.Unlock()
+
+	if len(patterns) == 0 {
+		return nil
+	}
+
+	add := func(name, value string) {
+		if len(value) >= minRedactLength && sensitiveName(name, patterns) {
+			values = append(values, value)
+		}
+	}
+
+	for _, e := range os.Environ() {
+		if i := strings.Index(e, "="); i > 0 {
+			add(e[:i], e[i+1:])
+		}
+	}
+
+	g.RLock()
+	for name, value := range g.Vars {
+		add(name, value)
+		// dynamic globals are not evaluated just for the redaction
+		if v, ok := substitutions.cached(value); ok {
+			add(name, v)
+		}
+	}
+	g.RUnlock()
+
+	cmdMap.Lock()
+	for _, c := range cmdMap.items {
+		for name, value := range c.env {
+			add(name, value)
+		}
+	}
+	cmdMap.Unlock()
+
+	sort.Slice(values, func(i, j int) bool {
+		return len(values[i]) > len(values[j])
+	})
+	return
+}
+
+// replace sensitive values and secrets in output that is printed or written to disk
+func redact(s string) string {
+	for _, value := range redactedValues() {
+		s = strings.Replace(s, value, secretMask, -1)
+	}
+	return secrets.mask(s)
+}
@@ -0,0 +1,276 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	releaseFlagDraft  = "--draft"
+	releaseFlagDryRun = "--dry-run"
+)
+
+var (
+	// ErrMissingReleaseFile means an output, its checksum or its SBOM does not exist yet
+	ErrMissingReleaseFile = errors.New("missing release file")
+
+	// ErrNoReleaseAssets means no command generates an SBOM for its outputs
+	ErrNoReleaseAssets = errors.New("no commands with sbom: true")
+)
+
+// a release as returned by the GitHub API
+type releaseInfo struct {
+	ID        int    `json:"id"`
+	TagName   string `json:"tag_name"`
+	UploadURL string `json:"upload_url"`
+	HTMLURL   string `json:"html_url"`
+	Assets    []struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	} `json:"assets"`
+}
+
+func printReleaseCommandUsageErr() {
+	l.Println(ErrInvalidUsage)
+	l.Println("usage: release <tag> [" + releaseFlagDraft + "] [" + releaseFlagDryRun + "]")
+}
+
+// collect the outputs of the commands with sbom: true, together with their checksums and SBOM documents
+// directories have no checksum, only their SBOM is attached
+func releaseAssets() ([]string, error) {
+
+	var (
+		format = sbomFormat()
+		names  []string
+		assets []string
+	)
+
+	cmdMap.Lock()
+	for name, cmd := range cmdMap.items {
+		if cmd.sbom {
+			names = append(names, name)
+		}
+	}
+	cmdMap.Unlock()
+	sort.Strings(names)
+
+	if len(names) == 0 {
+		return nil, ErrNoReleaseAssets
+	}
+
+	for _, name := range names {
+
+		cmd, err := cmdMap.getCommand(name)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, artifact := range cmd.outputs {
+
+			stat, err := os.Stat(artifact)
+			if err != nil {
+				return nil, errors.New(ErrMissingReleaseFile.Error() + ": " + artifact + ", run " + name + " first")
+			}
+
+			files := []string{sbomPath(artifact, format)}
+			if !stat.IsDir() {
+				files = []string{artifact, artifact + ".sha256", sbomPath(artifact, format)}
+			}
+
+			for _, f := range files {
+				if _, err := os.Stat(f); err != nil {
+					return nil, errors.New(ErrMissingReleaseFile.Error() + ": " + f + ", run " + name + " first")
+				}
+				assets = append(assets, f)
+			}
+		}
+	}
+
+	return assets, nil
+}
+
+// handle the release builtin
+// attaches the outputs of the commands with sbom: true, their checksums and SBOM documents to the GitHub release for the tag
+// the release is created if it does not exist, assets with the same name are replaced
+func handleReleaseCommand(args []string) error {
+
+	var (
+		tag    string
+		draft  bool
+		dryRun bool
+	)
+	for _, arg := range args[1:] {
+		switch arg {
+		case releaseFlagDraft:
+			draft = true
+		case releaseFlagDryRun:
+			dryRun = true
+		default:
+			if tag != "" || strings.HasPrefix(arg, "-") {
+				printReleaseCommandUsageErr()
+				return ErrInvalidUsage
+			}
+			tag = arg
+		}
+	}
+	if tag == "" {
+		printReleaseCommandUsageErr()
+		return ErrInvalidUsage
+	}
+
+	assets, err := releaseAssets()
+	if err != nil {
+		return err
+	}
+
+	if dryRun {
+		for _, a := range assets {
+			l.Println(a)
+		}
+		return nil
+	}
+
+	conf.Lock()
+	c := conf.fields.CI
+	conf.Unlock()
+	if c == nil {
+		c = newCIConfig()
+	}
+
+	token, err := githubToken(c)
+	if err != nil {
+		return err
+	}
+
+	repo := os.Getenv("GITHUB_REPOSITORY")
+	if repo == "" {
+		return errors.New("GITHUB_REPOSITORY not set")
+	}
+
+	release, err := findRelease(c, repo, tag, token)
+	if err != nil {
+		return err
+	}
+	if release == nil {
+		release = &releaseInfo{}
+		err = githubRequest("POST", githubAPI(c)+"/repos/"+repo+"/releases", token, map[string]interface{}{
+			"tag_name": tag,
+			"name":     tag,
+			"draft":    draft,
+		}, release)
+		if err != nil {
+			return err
+		}
+		l.Println(cp.Text + "created release " + tag)
+	}
+
+	for _, path := range assets {
+
+		name := filepath.Base(path)
+		for _, existing := range release.Assets {
+			if existing.Name == name {
+				err = githubRequest("DELETE", githubAPI(c)+"/repos/"+repo+"/releases/assets/"+strconv.Itoa(existing.ID), token, nil, nil)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		err = uploadReleaseAsset(release, path, token)
+		if err != nil {
+			return errors.New("failed to upload " + path + ": " + err.Error())
+		}
+		l.Println(cp.Text + "uploaded " + cp.Prompt + name + cp.Reset)
+	}
+
+	if release.HTMLURL != "" {
+		l.Println(cp.Text + release.HTMLURL)
+	}
+
+	return nil
+}
+
+// find the release for a tag, including drafts, which can not be looked up by tag
+// returns nil if there is no release for the tag
+func findRelease(c *ciConfig, repo, tag, token string) (*releaseInfo, error) {
+
+	var releases []*releaseInfo
+	err := githubRequest("GET", githubAPI(c)+"/repos/"+repo+"/releases?per_page=100", token, nil, &releases)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range releases {
+		if r.TagName == tag {
+			return r, nil
+		}
+	}
+	return nil, nil
+}
+
+// upload a file to the release
+func uploadReleaseAsset(release *releaseInfo, path, token string) error {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	// the upload URL is a template: https://uploads.github.com/repos/<repo>/releases/<id>/assets{?name,label}
+	uploadURL := release.UploadURL
+	if i := strings.Index(uploadURL, "{"); i != -1 {
+		uploadURL = uploadURL[:i]
+	}
+
+	req, err := http.NewRequest("POST", uploadURL+"?name="+url.QueryEscape(filepath.Base(path)), f)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = stat.Size()
+	req.Header.Set("Authorization", "token "+token)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	client := &http.Client{Timeout: 5 * time.Minute}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return errors.New("POST " + uploadURL + ": " + resp.Status)
+	}
+	return nil
+}
@@ -18,8 +18,116 @@
 
 package main
 
+import (
+	"sync"
+	"time"
+)
+
 var (
 	// format for TimeStamp in report
 	timestampFormat = "[Mon Jan 2 15:04:05 2006]"
 	// reportFileHandle *os.File
+
+	// records of all commands executed during the current invocation
+	runRecords = &runReport{}
 )
+
+// runRecord describes the outcome of a single command execution
+type runRecord struct {
+
+	// command name
+	Name string
+
+	// arguments passed to the command
+	Args []string
+
+	// time the command was started
+	Start time.Time
+
+	// wall time of the command
+	Duration time.Duration
+
+	// command was skipped because all outputs exist
+	Skipped bool
+
+	// error returned from the process, nil on success
+	Err error
+
+	// stdErr output collected for failed commands
+	StdErr string
+
+	// files copied into the dump directory for failed commands
+	Collected []string
+}
+
+// maximum number of runRecords kept in memory
+// long running shells would accumulate them forever, the run history on disk keeps them all
+const maxRunRecords = 10000
+
+// thread safe collection of runRecords
+type runReport struct {
+	items []*runRecord
+	sync.Mutex
+}
+
+// add a record to the report and persist it in the run history
+func (r *runReport) add(rec *runRecord) {
+	r.Lock()
+	r.items = append(r.items, rec)
+
+	// drop the oldest quarter when the limit is exceeded
+	// copying releases the underlying array of the dropped records
+	if len(r.items) > maxRunRecords {
+		r.items = append([]*runRecord{}, r.items[len(r.items)-(maxRunRecords-maxRunRecords/4):]...)
+	}
+	r.Unlock()
+
+	runHistory.append(rec)
+}
+
+// return a copy of all records
+func (r *runReport) records() []*runRecord {
+	r.Lock()
+	defer r.Unlock()
+	return append([]*runRecord{}, r.items...)
+}
+
+// check if any of the recorded commands failed
+func (r *runReport) failed() bool {
+	r.Lock()
+	defer r.Unlock()
+	for _, rec := range r.items {
+		if rec.Err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// number of records in memory
+func (r *runReport) len() int {
+	r.Lock()
+	defer r.Unlock()
+	return len(r.items)
+}
+
+// reset the report
+func (r *runReport) flush() {
+	r.Lock()
+	r.items = nil
+	r.Unlock()
+}
+
+// handle the results after a run from the commandline has completed
+func finishRun() {
+
+	// zeus kills all spawned processes on exit, so async dependencies must finish first
+	asyncDependencies.Wait()
+
+	if profileRun {
+		records := runRecords.records()
+		printProfile(records)
+		writeProfileTrace(records)
+	}
+	reportRunToCI(mergeSarifReports())
+}
@@ -0,0 +1,109 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// sourceDateEpochEnv is the environment variable for the timestamp of reproducible builds
+// see https://reproducible-builds.org/specs/source-date-epoch/
+const sourceDateEpochEnv = "SOURCE_DATE_EPOCH"
+
+var (
+	// set by the --reproducible flag
+	reproducibleRun bool
+
+	// timestamp of the latest commit, determined once
+	commitTimeOnce sync.Once
+	commitTime     time.Time
+)
+
+// check if reproducible mode is enabled by flag or config
+func reproducible() bool {
+	return reproducibleRun || (conf != nil && conf.fields.Reproducible)
+}
+
+// the timestamp for generated artifacts
+// SOURCE_DATE_EPOCH is honored when it is set in the environment,
+// in reproducible mode it defaults to the time of the latest commit
+func sourceDateEpoch() (time.Time, bool) {
+
+	if v := os.Getenv(sourceDateEpochEnv); v != "" {
+		sec, err := strconv.ParseInt(v, 10, 64)
+		if err == nil {
+			return time.Unix(sec, 0).UTC(), true
+		}
+		Log.Warn("ignoring invalid " + sourceDateEpochEnv + ": " + v)
+	}
+
+	if !reproducible() {
+		return time.Time{}, false
+	}
+
+	commitTimeOnce.Do(func() {
+		commitTime = time.Unix(0, 0).UTC()
+		t, err := projectVCS().commitTime()
+		if err != nil {
+			Log.Debug("failed to get the time of the latest commit, using the unix epoch: ", err)
+			return
+		}
+		commitTime = t
+	})
+
+	return commitTime, true
+}
+
+// the time to put into generated artifacts
+func artifactTime() time.Time {
+	if t, ok := sourceDateEpoch(); ok {
+		return t
+	}
+	return time.Now()
+}
+
+// environment entry that exports the timestamp to the commands
+// empty if SOURCE_DATE_EPOCH is already set or reproducible mode is disabled
+func sourceDateEpochEnvEntry() string {
+	if os.Getenv(sourceDateEpochEnv) != "" {
+		return ""
+	}
+	t, ok := sourceDateEpoch()
+	if !ok {
+		return ""
+	}
+	return sourceDateEpochEnv + "=" + strconv.FormatInt(t.Unix(), 10)
+}
+
+// create a UUID that is derived from seed, for deterministic documents
+func stableUUID(seed string) string {
+
+	b := sha256.Sum256([]byte(seed))
+
+	// name based UUID, version 5 layout
+	b[6] = (b[6] & 0x0f) | 0x50
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
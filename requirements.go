@@ -0,0 +1,233 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrRequirementNotMet means a tool required by a command is missing or has the wrong version
+	ErrRequirementNotMet = errors.New("requirement not met")
+
+	// ErrDoctorFindings means the doctor builtin found problems
+	ErrDoctorFindings = errors.New("doctor found problems")
+
+	// requirements that have been met, tools are only asked for their version once per session
+	// unmet requirements are checked again, so a tool can be installed while the shell is running
+	metRequirements = &requirementCache{
+		items: make(map[string]bool, 0),
+	}
+)
+
+type requirementCache struct {
+	items map[string]bool
+	sync.Mutex
+}
+
+func printDoctorCommandUsageErr() {
+	l.Println(ErrInvalidUsage)
+	l.Println("usage: doctor")
+}
+
+// validate the requires field from the CommandsFile
+// the requirements follow the format of the tools in the environment section
+func validateRequirements(requires []string) error {
+	for _, r := range requires {
+		if !toolRequirement.MatchString(strings.TrimSpace(r)) {
+			return errors.New(ErrInvalidToolRequirement.Error() + ": " + r)
+		}
+	}
+	return nil
+}
+
+// check a requirement, met requirements are taken from the cache
+func checkRequirement(requirement string) *environmentCheck {
+
+	requirement = strings.TrimSpace(requirement)
+
+	metRequirements.Lock()
+	met := metRequirements.items[requirement]
+	metRequirements.Unlock()
+
+	if met {
+		return &environmentCheck{kind: "tools", name: requirement, found: "checked", ok: true}
+	}
+
+	c := checkTool(requirement)
+	if c.ok {
+		metRequirements.Lock()
+		metRequirements.items[requirement] = true
+		metRequirements.Unlock()
+	}
+	return c
+}
+
+// the commands whose requirements have to be met before the command can run:
+// the command and its dependencies, unless they run in jobs of their own
+func (c *command) requirementCommands(deps bool) (cmds []*command) {
+
+	var (
+		seen  = make(map[string]bool)
+		visit func(cmd *command)
+	)
+
+	visit = func(cmd *command) {
+		if seen[cmd.name] {
+			return
+		}
+		seen[cmd.name] = true
+		cmds = append(cmds, cmd)
+
+		if !deps {
+			return
+		}
+		for _, dep := range append(append([]string{}, cmd.dependencies...), cmd.asyncDeps...) {
+			fields := strings.Fields(dep)
+			if len(fields) == 0 {
+				continue
+			}
+			if d, err := cmdMap.getCommand(fields[0]); err == nil {
+				visit(d)
+			}
+		}
+	}
+	visit(c)
+
+	return
+}
+
+// make sure the tools required by the command are installed, before anything is started
+// with deps the requirements of the dependencies are checked as well
+func (c *command) checkRequirements(deps bool) error {
+
+	for _, cmd := range c.requirementCommands(deps) {
+		for _, r := range cmd.requires {
+			if check := checkRequirement(r); !check.ok {
+				return errors.New(ErrRequirementNotMet.Error() + ": " + cmd.name + " requires " + check.name + ": " + check.hint)
+			}
+		}
+	}
+
+	return nil
+}
+
+// handle the doctor builtin
+// checks the environment from the CommandsFile, the requirements of all commands and the interpreters they use
+func handleDoctorCommand(args []string) error {
+
+	if len(args) != 1 {
+		printDoctorCommandUsageErr()
+		return ErrInvalidUsage
+	}
+
+	var (
+		checks    = checkEnvironment()
+		languages = make(map[string]bool)
+		names     []string
+	)
+
+	cmdMap.Lock()
+	for name, cmd := range cmdMap.items {
+		names = append(names, name)
+		languages[cmd.language] = true
+	}
+	cmdMap.Unlock()
+	sort.Strings(names)
+
+	for _, name := range names {
+		cmd, err := cmdMap.getCommand(name)
+		if err != nil {
+			continue
+		}
+		for _, r := range cmd.requires {
+			check := checkTool(r)
+			check.kind = "commands"
+			check.name = name + ": " + check.name
+			checks = append(checks, check)
+		}
+	}
+
+	checks = append(checks, checkInterpreters(languages)...)
+
+	var (
+		failed int
+		kind   string
+	)
+	for _, c := range checks {
+		if !c.ok {
+			failed++
+		}
+		if c.kind != kind {
+			kind = c.kind
+			l.Println(cp.Prompt + kind + cp.Text)
+		}
+		c.print()
+	}
+
+	if failed == 0 {
+		l.Println(cp.Text + "no problems found")
+		return nil
+	}
+
+	l.Println(cp.Text + strconv.Itoa(failed) + " of " + strconv.Itoa(len(checks)) + " checks failed")
+	return ErrDoctorFindings
+}
+
+// check if the interpreters of the languages are installed
+func checkInterpreters(languages map[string]bool) (checks []*environmentCheck) {
+
+	var names []string
+	for name := range languages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	ls.Lock()
+	defer ls.Unlock()
+
+	for _, name := range names {
+
+		lang, ok := ls.items[name]
+		if !ok {
+			continue
+		}
+
+		c := &environmentCheck{
+			kind: "interpreters",
+			name: name,
+		}
+		path, err := exec.LookPath(lang.Interpreter)
+		if err != nil {
+			c.found = "not installed"
+			c.hint = "install " + lang.Interpreter + " or set the interpreter of " + name + " in the config"
+		} else {
+			c.found = path
+			c.ok = true
+		}
+		checks = append(checks, c)
+	}
+
+	return
+}
@@ -0,0 +1,205 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rerunFlagFromFailure continues the failed invocation at the failed command
+const rerunFlagFromFailure = "--from-failure"
+
+// guards the rerun state file
+var rerunLock sync.Mutex
+
+// rerunState is persisted in zeus/data/rerun.json
+type rerunState struct {
+
+	// steps of the latest invocation
+	Last []string `json:"last"`
+
+	// failed invocations mapped to their progress
+	// entries are removed when the invocation succeeds
+	Failed map[string]*failedInvocation `json:"failed"`
+
+	// key of the invocation that failed most recently
+	LastFailed string `json:"lastFailed"`
+}
+
+// failedInvocation records how far a command chain got
+type failedInvocation struct {
+
+	// all steps of the original invocation, command name and arguments
+	Steps []string `json:"steps"`
+
+	// index of the step that failed
+	Failed int `json:"failed"`
+
+	// time of the failure
+	Timestamp time.Time `json:"timestamp"`
+}
+
+func printRerunCommandUsageErr() {
+	l.Println(ErrInvalidUsage)
+	l.Println("usage: rerun [" + rerunFlagFromFailure + " [<commandChain>]]")
+}
+
+// path of the rerun state
+func rerunStatePath() string {
+	return filepath.Join(zeusDir, "data", "rerun.json")
+}
+
+// create the key for an invocation
+// example: clean -> build name=testBuild
+func invocationKey(steps []string) string {
+	var fields []string
+	for _, step := range steps {
+		fields = append(fields, strings.Join(strings.Fields(step), " "))
+	}
+	return strings.Join(fields, " "+commandChainSeparator+" ")
+}
+
+func loadRerunState() *rerunState {
+
+	state := &rerunState{
+		Failed: make(map[string]*failedInvocation),
+	}
+
+	c, err := ioutil.ReadFile(rerunStatePath())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			Log.WithError(err).Error("failed to read rerun state")
+		}
+		return state
+	}
+
+	err = json.Unmarshal(c, state)
+	if err != nil {
+		Log.WithError(err).Error("failed to parse rerun state")
+	}
+	if state.Failed == nil {
+		state.Failed = make(map[string]*failedInvocation)
+	}
+
+	return state
+}
+
+func (state *rerunState) save() {
+
+	c, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		Log.WithError(err).Error("failed to marshal rerun state")
+		return
+	}
+
+	err = os.MkdirAll(filepath.Dir(rerunStatePath()), 0700)
+	if err != nil {
+		Log.WithError(err).Error("failed to create rerun state directory")
+		return
+	}
+
+	err = writeFileAtomic(rerunStatePath(), c, 0644)
+	if err != nil {
+		Log.WithError(err).Error("failed to write rerun state")
+	}
+}
+
+// record the outcome of an invocation
+// failed is the index of the failed step, or -1 on success
+func recordInvocation(key string, steps []string, failed int) {
+
+	rerunLock.Lock()
+	defer rerunLock.Unlock()
+
+	state := loadRerunState()
+	state.Last = steps
+
+	if failed < 0 {
+		delete(state.Failed, key)
+		if state.LastFailed == key {
+			state.LastFailed = ""
+		}
+	} else {
+		state.Failed[key] = &failedInvocation{
+			Steps:     steps,
+			Failed:    failed,
+			Timestamp: time.Now(),
+		}
+		state.LastFailed = key
+	}
+
+	state.save()
+}
+
+// handle rerun shell command
+// returns the error of the rerun invocation
+func handleRerunCommand(args []string) error {
+
+	state := loadRerunState()
+
+	if len(args) == 1 {
+		if len(state.Last) == 0 {
+			l.Println("nothing to rerun.")
+			return nil
+		}
+		return runInvocation(invocationKey(state.Last), state.Last, 0)
+	}
+
+	if args[1] != rerunFlagFromFailure {
+		printRerunCommandUsageErr()
+		return ErrInvalidUsage
+	}
+
+	key := state.LastFailed
+	if len(args) > 2 {
+		key = invocationKey(strings.Split(strings.Join(args[2:], " "), commandChainSeparator))
+	}
+
+	inv, ok := state.Failed[key]
+	if !ok {
+		l.Println("no failed invocation to resume.")
+		return nil
+	}
+
+	l.Println(cp.Text + "resuming " + cp.Prompt + key + cp.Text + " at " + cp.Prompt + inv.Steps[inv.Failed] + cp.Reset)
+	return runInvocation(key, inv.Steps, inv.Failed)
+}
+
+// run the steps of an invocation starting at offset
+func runInvocation(key string, steps []string, offset int) error {
+
+	if offset >= len(steps) {
+		return nil
+	}
+
+	cmdChain, ok := validCommandChain(steps[offset:])
+	if !ok {
+		l.Println("invalid commandChain")
+		return errors.New("invalid commandChain: " + strings.Join(steps[offset:], commandChainSeparator))
+	}
+
+	return cmdChain.execInvocation(key, steps, offset)
+}
@@ -18,9 +18,9 @@ func init() {
 	}
 	file4 := &embedded.EmbeddedFile{
 		Filename:    "css/index.css",
-		FileModTime: time.Unix(1508259734, 0),
+		FileModTime: time.Unix(1792171686, 0),
 
-		Content: string("*{box-sizing:border-box}i{color:#fff;font-size:15px!important}.buttons{position:absolute;top:180px;right:10px}#main-spinner{display:none;position:absolute;right:20px;top:20px}#main-spinner .loader{border-radius:50%;width:5em;height:5em}html{background-color:gray}.logo{opacity:.7;width:250px;height:185px;margin-left:11px;margin-top:5px;margin-bottom:-5px}.navbar{position:absolute;top:-60px;width:100%}footer{float:right;color:#fff;margin:10px}.screen{margin:10px;background-color:#000;color:#00b100;opacity:.8;height:580px;border-radius:15px;padding:20px;width:98%}.inspect-button{cursor:pointer;background-color:#000;border:2px gray solid;border-radius:5px;color:#fff;width:100px;height:50px}.inspect-button.hvr-glow:hover,.inspect-button.hvr-glow:focus{box-shadow:0 0 10px green}.inspect-button .fa{font-size:16px}.inspect-button:hover,.inspect-button:focus,.inspect-button.highlight{border-color:0;color:#fff}.loader{margin:0 auto;margin:60px auto;font-size:10px;text-indent:-9999em;border-top:1.1em solid rgba(255,255,255,.2);border-right:1.1em solid rgba(255,255,255,.2);border-bottom:1.1em solid rgba(255,255,255,.2);border-left:1.1em solid #fff;-webkit-transform:translateZ(0);-ms-transform:translateZ(0);transform:translateZ(0);-webkit-animation:loading-spin 1.1s infinite linear;animation:loading-spin 1.1s infinite linear}h1{color:#fff;text-align:center}h1 b{top:-35px;position:relative}.loader,.loader:after{border-radius:50%;width:10em;height:10em}@-webkit-keyframes loading-spin{0%{-webkit-transform:rotate(0);transform:rotate(0)}100%{-webkit-transform:rotate(360deg);transform:rotate(360deg)}}@keyframes loading-spin{0%{-webkit-transform:rotate(0);transform:rotate(0)}100%{-webkit-transform:rotate(360deg);transform:rotate(360deg)}}"),
+		Content: string("*{box-sizing:border-box}i{color:#fff;font-size:15px!important}.buttons{position:absolute;top:180px;right:10px}#main-spinner{display:none;position:absolute;right:20px;top:20px}#main-spinner .loader{border-radius:50%;width:5em;height:5em}html{background-color:gray}.logo{opacity:.7;width:250px;height:185px;margin-left:11px;margin-top:5px;margin-bottom:-5px}.navbar{position:absolute;top:-60px;width:100%}footer{float:right;color:#fff;margin:10px}.screen{margin:10px;background-color:#000;color:#00b100;opacity:.8;height:580px;border-radius:15px;padding:20px;width:98%}.dashboard{margin-top:170px;padding:10px}.dashboard .panel{margin-bottom:20px}.dashboard h2{color:#fff}.dashboard .command{background-color:#000;border-radius:5px;color:#fff;margin-bottom:5px;opacity:.8;padding:10px}.dashboard .command .command-name{color:#00b100;display:inline-block;font-weight:700;width:200px}.dashboard .command .command-description{color:#d3d3d3;display:inline-block;margin-right:10px}.dashboard .command input,.dashboard .command select{color:#000;margin-right:5px}.dashboard #output{overflow-y:scroll;white-space:pre-wrap}.dashboard #output .stderr{color:#f55}.dashboard #output .status{color:#fff}.dashboard #procs{background-color:#000;color:#fff;opacity:.8}.inspect-button{cursor:pointer;background-color:#000;border:2px gray solid;border-radius:5px;color:#fff;width:100px;height:50px}.inspect-button.hvr-glow:hover,.inspect-button.hvr-glow:focus{box-shadow:0 0 10px green}.inspect-button .fa{font-size:16px}.inspect-button:hover,.inspect-button:focus,.inspect-button.highlight{border-color:0;color:#fff}.loader{margin:0 auto;margin:60px auto;font-size:10px;text-indent:-9999em;border-top:1.1em solid rgba(255,255,255,.2);border-right:1.1em solid rgba(255,255,255,.2);border-bottom:1.1em solid rgba(255,255,255,.2);border-left:1.1em solid #fff;-webkit-transform:translateZ(0);-ms-transform:translateZ(0);transform:translateZ(0);-webkit-animation:loading-spin 1.1s infinite linear;animation:loading-spin 1.1s infinite linear}h1{color:#fff;text-align:center}h1 b{top:-35px;position:relative}.loader,.loader:after{border-radius:50%;width:10em;height:10em}@-webkit-keyframes loading-spin{0%{-webkit-transform:rotate(0);transform:rotate(0)}100%{-webkit-transform:rotate(360deg);transform:rotate(360deg)}}@keyframes loading-spin{0%{-webkit-transform:rotate(0);transform:rotate(0)}100%{-webkit-transform:rotate(360deg);transform:rotate(360deg)}}"),
 	}
 	file5 := &embedded.EmbeddedFile{
 		Filename:    "css/pure-min.css",
@@ -66,9 +66,9 @@ func init() {
 	}
 	filee := &embedded.EmbeddedFile{
 		Filename:    "html/index.html",
-		FileModTime: time.Unix(1487968253, 0),
+		FileModTime: time.Unix(1792171686, 0),
 
-		Content: string("<!DOCTYPE html>\n<html>\n    <head>\n        <meta charset=\"utf8\" />\n        <meta name=\"viewport\" content=\"width=device-width, initial-scale=1, maximum-scale=1, user-scalable=0\"/>\n    \n        <!-- Page Title -->\n        <title>ZEUS beta</title>\n\n        <!-- Styles -->\n        <link rel=\"stylesheet\" type=\"text/css\" href=\"files/css/index.css\"/>\n        <link rel=\"stylesheet\" type=\"text/css\" href=\"files/css/font-awesome.min.css\"/>\n        <link rel=\"stylesheet\" type=\"text/css\" href=\"files/css/pure-min.css\"/>\n\n        <!-- normal script imports etc  -->\n        <script src=\"files/js/jquery.js\"></script>\n        <script src=\"files/js/highlight.js\"></script>\n        <script src=\"files/js/glue.js\"></script>\n        <script src=\"files/js/index.js\"></script>\n    </head>\n\n    <header>\n        <!--<img class=\"logo\" src=\"/files/images/logo.png\"></img>-->\n\n        <div class=\"navbar\">\n\n            <div class=\"settings\">\n            </div>\n\n            <div class=\"wrap\" id=\"main-spinner\">\n                <div class=\"loader\"></div>\n            </div>\n            \n            <div class=\"buttons\">\n                <button class=\"zeus-button\" id=\"btn-add\"><i class=\"fa fa-plus-circle\"></i></button>\n                <button class=\"zeus-button\" id=\"btn-wiki\">WIKI</button>\n                <button class=\"zeus-button\" id=\"btn-db\">COMMANDS</button>\n                <button class=\"zeus-button\" id=\"btn-reports\">BUILTINS</button>\n                <button class=\"zeus-button\" id=\"btn-config\">CONFIG</button>\n                <button class=\"zeus-button\" id=\"btn-quit\">QUIT</button>\n            </div>\n        </div>\n    </header>\n\n    <body class=\"main\"> \n    </body>\n\n</html>"),
+		Content: string("<!DOCTYPE html>\n<html>\n    <head>\n        <meta charset=\"utf8\" />\n        <meta name=\"viewport\" content=\"width=device-width, initial-scale=1, maximum-scale=1, user-scalable=0\"/>\n    \n        <!-- Page Title -->\n        <title>ZEUS beta</title>\n\n        <!-- Styles -->\n        <link rel=\"stylesheet\" type=\"text/css\" href=\"files/css/index.css\"/>\n        <link rel=\"stylesheet\" type=\"text/css\" href=\"files/css/font-awesome.min.css\"/>\n        <link rel=\"stylesheet\" type=\"text/css\" href=\"files/css/pure-min.css\"/>\n\n        <!-- normal script imports etc  -->\n        <script src=\"files/js/jquery.js\"></script>\n        <script src=\"files/js/highlight.js\"></script>\n        <script src=\"files/js/glue.js\"></script>\n        <script src=\"files/js/index.js\"></script>\n    </head>\n\n    <header>\n        <!--<img class=\"logo\" src=\"/files/images/logo.png\"></img>-->\n\n        <div class=\"navbar\">\n\n            <div class=\"settings\">\n            </div>\n\n            <div class=\"wrap\" id=\"main-spinner\">\n                <div class=\"loader\"></div>\n            </div>\n            \n            <div class=\"buttons\">\n                <button class=\"zeus-button\" id=\"btn-add\"><i class=\"fa fa-plus-circle\"></i></button>\n                <button class=\"zeus-button\" id=\"btn-wiki\">WIKI</button>\n                <button class=\"zeus-button\" id=\"btn-db\">COMMANDS</button>\n                <button class=\"zeus-button\" id=\"btn-reports\">BUILTINS</button>\n                <button class=\"zeus-button\" id=\"btn-config\">CONFIG</button>\n                <button class=\"zeus-button\" id=\"btn-quit\">QUIT</button>\n            </div>\n        </div>\n    </header>\n\n    <body class=\"main\">\n        <div class=\"dashboard\">\n\n            <div class=\"panel\" id=\"commands-panel\">\n                <h2>Commands</h2>\n                <div id=\"commands\"></div>\n            </div>\n\n            <div class=\"panel\" id=\"output-panel\">\n                <h2>Output <button class=\"zeus-button\" id=\"btn-clear\">CLEAR</button></h2>\n                <pre class=\"screen\" id=\"output\"></pre>\n            </div>\n\n            <div class=\"panel\" id=\"procs-panel\">\n                <h2>Processes</h2>\n                <table class=\"pure-table\" id=\"procs\">\n                    <thead>\n                        <tr><th>Command</th><th>PID</th><th></th></tr>\n                    </thead>\n                    <tbody></tbody>\n                </table>\n            </div>\n        </div>\n    </body>\n\n</html>"),
 	}
 	fileg := &embedded.EmbeddedFile{
 		Filename:    "js/glue.js",
@@ -84,9 +84,9 @@ func init() {
 	}
 	filei := &embedded.EmbeddedFile{
 		Filename:    "js/index.js",
-		FileModTime: time.Unix(1508259734, 0),
+		FileModTime: time.Unix(1792171686, 0),
 
-		Content: string("$(document).ready(function(){$('#btn-wiki').click(function(){window.open(\"/wiki\",\"_blank\");});$('#btn-scripts').click(function(){window.open(\"/scripts\",\"_blank\");});$('#btn-config').click(function(){console.log(\"toggle config panel\");});$('#btn-quit').click(function(){window.location=\"/quit\";setTimeout(function(){window.close();},1000);});var socket=glue();socket.onMessage(function(data){console.log(\"onMessage: \"+data);});socket.on(\"connected\",function(){console.log(\"connected\");});socket.on(\"connecting\",function(){console.log(\"connecting\");});socket.on(\"disconnected\",function(){console.log(\"disconnected\");});socket.on(\"reconnecting\",function(){console.log(\"reconnecting\");});socket.on(\"error\",function(e,msg){console.log(\"error: \"+msg);});socket.on(\"connect_timeout\",function(){console.log(\"connect_timeout\");});socket.on(\"timeout\",function(){console.log(\"timeout\");});socket.on(\"discard_send_buffer\",function(){console.log(\"some data could not be send and was discarded.\");});});function spinnerON(){$('#main-spinner').toggle(true);}\nfunction spinnerOFF(){$('#main-spinner').toggle(false);}"),
+		Content: string("$(document).ready(function() {\n$('#btn-wiki').click(function() {\nwindow.open(\"/wiki\", \"_blank\");\n});\n$('#btn-scripts').click(function() {\nwindow.open(\"/scripts\", \"_blank\");\n});\n$('#btn-config').click(function() {\nconsole.log(\"toggle config panel\");\n});\n$('#btn-db').click(function() {\nloadCommands();\n});\n$('#btn-clear').click(function() {\n$('#output').empty();\n});\n$('#btn-quit').click(function() {\nwindow.location = \"/quit\";\nsetTimeout(function() {\nwindow.close();\n}, 1000);\n});\nvar socket = glue();\nsocket.onMessage(function(data) {\nvar msg;\ntry {\nmsg = JSON.parse(data);\n} catch (e) {\nconsole.log(\"onMessage: \" + data);\nreturn;\n}\nswitch (msg.type) {\ncase \"output\":\nappendOutput(msg.command, msg.stream, msg.line);\nbreak;\ncase \"started\":\nappendOutput(msg.command, \"status\", \"started\");\nloadProcs();\nbreak;\ncase \"finished\":\nif (msg.error) {\nappendOutput(msg.command, \"stderr\", \"failed: \" + msg.error);\n} else {\nappendOutput(msg.command, \"status\", \"finished\");\n}\nloadProcs();\nbreak;\n}\n});\nsocket.on(\"connected\", function() {\nconsole.log(\"connected\");\n});\nsocket.on(\"connecting\", function() {\nconsole.log(\"connecting\");\n});\nsocket.on(\"disconnected\", function() {\nconsole.log(\"disconnected\");\n});\nsocket.on(\"reconnecting\", function() {\nconsole.log(\"reconnecting\");\n});\nsocket.on(\"error\", function(e, msg) {\nconsole.log(\"error: \" + msg);\n});\nsocket.on(\"connect_timeout\", function() {\nconsole.log(\"connect_timeout\");\n});\nsocket.on(\"timeout\", function() {\nconsole.log(\"timeout\");\n});\nsocket.on(\"discard_send_buffer\", function() {\nconsole.log(\"some data could not be send and was discarded.\");\n});\nloadCommands();\nloadProcs();\nsetInterval(loadProcs, 3000);\n});\nfunction loadCommands() {\n$.getJSON(\"/api/commands\", function(commands) {\nvar list = $('#commands').empty();\n$.each(commands, function(i, cmd) {\nvar form = $('<form class=\"pure-form command\"></form>');\nform.append($('<div class=\"command-name\"></div>').text(cmd.name));\nif (cmd.description) {\nform.append($('<div class=\"command-description\"></div>').text(cmd.description));\n}\n$.each(cmd.arguments, function(j, arg) {\nvar input;\nif (arg.type === \"Bool\") {\ninput = $('<select></select>');\nif (arg.optional) {\ninput.append($('<option value=\"\"></option>'));\n}\ninput.append($('<option>true</option>'), $('<option>false</option>'));\n} else {\ninput = $('<input type=\"text\">');\ninput.attr(\"placeholder\", arg.name + \":\" + arg.type + (arg.optional ? \"?\" : \"\"));\n}\ninput.attr(\"name\", arg.name);\ninput.attr(\"title\", arg.name + \":\" + arg.type);\ninput.prop(\"required\", !arg.optional);\nif (arg.default) {\ninput.val(arg.default);\n}\nform.append(input);\n});\nform.append($('<button type=\"submit\" class=\"zeus-button\">RUN</button>'));\nform.submit(function(e) {\ne.preventDefault();\nrunCommand(cmd.name, form);\n});\nlist.append(form);\n});\n});\n}\nfunction runCommand(name, form) {\nvar args = {};\nform.find(\"input, select\").each(function() {\nargs[$(this).attr(\"name\")] = $(this).val();\n});\n$.ajax({\nurl: \"/api/run\",\nmethod: \"POST\",\ncontentType: \"application/json\",\ndata: JSON.stringify({\ncommand: name,\narguments: args\n}),\nerror: function(xhr) {\nappendOutput(name, \"stderr\", xhr.responseJSON ? xhr.responseJSON.error : xhr.statusText);\n}\n});\n}\nfunction appendOutput(command, stream, line) {\nvar out = $('#output');\nout.append($('<span></span>').addClass(stream).text(\"[\" + command + \"] \" + line + \"\\n\"));\nout.scrollTop(out[0].scrollHeight);\n}\nfunction loadProcs() {\n$.getJSON(\"/api/procs\", function(procs) {\nvar body = $('#procs tbody').empty();\n$.each(procs, function(i, p) {\nvar kill = $('<button class=\"zeus-button\">KILL</button>').click(function() {\n$.ajax({\nurl: \"/api/procs/\" + p.pid + \"/kill\",\nmethod: \"POST\",\ncontentType: \"application/json\",\ncomplete: loadProcs\n});\n});\nbody.append($('<tr></tr>').append(\n$('<td></td>').text(p.name),\n$('<td></td>').text(p.pid),\n$('<td></td>').append(kill)\n));\n});\n});\n}\nfunction spinnerON() {\n$('#main-spinner').toggle(true);\n}\nfunction spinnerOFF() {\n$('#main-spinner').toggle(false);\n}\n"),
 	}
 	filej := &embedded.EmbeddedFile{
 		Filename:    "js/jquery.js",
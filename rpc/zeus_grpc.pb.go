@@ -0,0 +1,245 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+
+package rpc
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// ZeusClient is the client API for Zeus service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ZeusClient interface {
+	// list all commands
+	ListCommands(ctx context.Context, in *ListCommandsRequest, opts ...grpc.CallOption) (*ListCommandsResponse, error)
+	// run a command and stream its output until it has finished
+	RunCommand(ctx context.Context, in *RunCommandRequest, opts ...grpc.CallOption) (Zeus_RunCommandClient, error)
+	// cancel a running command by killing its processes
+	CancelRun(ctx context.Context, in *CancelRunRequest, opts ...grpc.CallOption) (*Run, error)
+	// get the dependency graph of all commands
+	GetGraph(ctx context.Context, in *GetGraphRequest, opts ...grpc.CallOption) (*Graph, error)
+}
+
+type zeusClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewZeusClient(cc grpc.ClientConnInterface) ZeusClient {
+	return &zeusClient{cc}
+}
+
+func (c *zeusClient) ListCommands(ctx context.Context, in *ListCommandsRequest, opts ...grpc.CallOption) (*ListCommandsResponse, error) {
+	out := new(ListCommandsResponse)
+	err := c.cc.Invoke(ctx, "/zeus.Zeus/ListCommands", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *zeusClient) RunCommand(ctx context.Context, in *RunCommandRequest, opts ...grpc.CallOption) (Zeus_RunCommandClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Zeus_ServiceDesc.Streams[0], "/zeus.Zeus/RunCommand", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &zeusRunCommandClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Zeus_RunCommandClient interface {
+	Recv() (*RunEvent, error)
+	grpc.ClientStream
+}
+
+type zeusRunCommandClient struct {
+	grpc.ClientStream
+}
+
+func (x *zeusRunCommandClient) Recv() (*RunEvent, error) {
+	m := new(RunEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *zeusClient) CancelRun(ctx context.Context, in *CancelRunRequest, opts ...grpc.CallOption) (*Run, error) {
+	out := new(Run)
+	err := c.cc.Invoke(ctx, "/zeus.Zeus/CancelRun", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *zeusClient) GetGraph(ctx context.Context, in *GetGraphRequest, opts ...grpc.CallOption) (*Graph, error) {
+	out := new(Graph)
+	err := c.cc.Invoke(ctx, "/zeus.Zeus/GetGraph", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ZeusServer is the server API for Zeus service.
+// All implementations must embed UnimplementedZeusServer
+// for forward compatibility
+type ZeusServer interface {
+	// list all commands
+	ListCommands(context.Context, *ListCommandsRequest) (*ListCommandsResponse, error)
+	// run a command and stream its output until it has finished
+	RunCommand(*RunCommandRequest, Zeus_RunCommandServer) error
+	// cancel a running command by killing its processes
+	CancelRun(context.Context, *CancelRunRequest) (*Run, error)
+	// get the dependency graph of all commands
+	GetGraph(context.Context, *GetGraphRequest) (*Graph, error)
+	mustEmbedUnimplementedZeusServer()
+}
+
+// UnimplementedZeusServer must be embedded to have forward compatible implementations.
+type UnimplementedZeusServer struct {
+}
+
+func (UnimplementedZeusServer) ListCommands(context.Context, *ListCommandsRequest) (*ListCommandsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListCommands not implemented")
+}
+func (UnimplementedZeusServer) RunCommand(*RunCommandRequest, Zeus_RunCommandServer) error {
+	return status.Errorf(codes.Unimplemented, "method RunCommand not implemented")
+}
+func (UnimplementedZeusServer) CancelRun(context.Context, *CancelRunRequest) (*Run, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CancelRun not implemented")
+}
+func (UnimplementedZeusServer) GetGraph(context.Context, *GetGraphRequest) (*Graph, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetGraph not implemented")
+}
+func (UnimplementedZeusServer) mustEmbedUnimplementedZeusServer() {}
+
+// UnsafeZeusServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ZeusServer will
+// result in compilation errors.
+type UnsafeZeusServer interface {
+	mustEmbedUnimplementedZeusServer()
+}
+
+func RegisterZeusServer(s grpc.ServiceRegistrar, srv ZeusServer) {
+	s.RegisterService(&Zeus_ServiceDesc, srv)
+}
+
+func _Zeus_ListCommands_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListCommandsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ZeusServer).ListCommands(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/zeus.Zeus/ListCommands",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ZeusServer).ListCommands(ctx, req.(*ListCommandsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Zeus_RunCommand_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(RunCommandRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ZeusServer).RunCommand(m, &zeusRunCommandServer{stream})
+}
+
+type Zeus_RunCommandServer interface {
+	Send(*RunEvent) error
+	grpc.ServerStream
+}
+
+type zeusRunCommandServer struct {
+	grpc.ServerStream
+}
+
+func (x *zeusRunCommandServer) Send(m *RunEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Zeus_CancelRun_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CancelRunRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ZeusServer).CancelRun(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/zeus.Zeus/CancelRun",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ZeusServer).CancelRun(ctx, req.(*CancelRunRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Zeus_GetGraph_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetGraphRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ZeusServer).GetGraph(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/zeus.Zeus/GetGraph",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ZeusServer).GetGraph(ctx, req.(*GetGraphRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Zeus_ServiceDesc is the grpc.ServiceDesc for Zeus service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Zeus_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "zeus.Zeus",
+	HandlerType: (*ZeusServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListCommands",
+			Handler:    _Zeus_ListCommands_Handler,
+		},
+		{
+			MethodName: "CancelRun",
+			Handler:    _Zeus_CancelRun_Handler,
+		},
+		{
+			MethodName: "GetGraph",
+			Handler:    _Zeus_GetGraph_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "RunCommand",
+			Handler:       _Zeus_RunCommand_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "rpc/zeus.proto",
+}
@@ -0,0 +1,226 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// supported report types
+const (
+	reportTypeSarif = "sarif"
+)
+
+var (
+	// ErrInvalidReport means a report declaration does not follow the type=path format
+	ErrInvalidReport = errors.New("invalid report declaration, expected <type>=<path>")
+
+	// ErrUnknownReportType means the report type is not supported
+	ErrUnknownReportType = errors.New("unknown report type")
+)
+
+// report file declared by a command
+type commandReport struct {
+	reportType string
+	path       string
+}
+
+// sarifLog is the minimal subset of the SARIF format needed for merging
+type sarifLog struct {
+	Schema  string            `json:"$schema,omitempty"`
+	Version string            `json:"version"`
+	Runs    []json.RawMessage `json:"runs"`
+}
+
+// validate the reports field from the CommandsFile
+func validateReports(reports []string) ([]*commandReport, error) {
+
+	var res []*commandReport
+
+	for _, r := range reports {
+
+		slice := strings.SplitN(r, "=", 2)
+		if len(slice) != 2 || strings.TrimSpace(slice[1]) == "" {
+			return nil, errors.New(ErrInvalidReport.Error() + ": " + r)
+		}
+
+		t := strings.TrimSpace(slice[0])
+		switch t {
+		case reportTypeSarif:
+		default:
+			return nil, errors.New(ErrUnknownReportType.Error() + ": " + t)
+		}
+
+		res = append(res, &commandReport{
+			reportType: t,
+			path:       strings.TrimSpace(slice[1]),
+		})
+	}
+
+	return res, nil
+}
+
+// get the path for the merged SARIF file
+func sarifOutputPath() string {
+
+	conf.Lock()
+	defer conf.Unlock()
+
+	if conf.fields.SarifOutput != "" {
+		return conf.fields.SarifOutput
+	}
+	return zeusDir + "/reports/zeus.sarif"
+}
+
+// collect the SARIF reports of all commands executed in this run
+// and merge them into a single file
+// returns the path of the merged file, or an empty string if there were no reports
+func mergeSarifReports() string {
+
+	var (
+		paths []string
+		seen  = make(map[string]bool, 0)
+	)
+
+	for _, rec := range runRecords.records() {
+
+		cmd, err := cmdMap.getCommand(rec.Name)
+		if err != nil {
+			continue
+		}
+
+		for _, r := range cmd.reports {
+			if r.reportType != reportTypeSarif || seen[r.path] {
+				continue
+			}
+			seen[r.path] = true
+
+			if _, err := os.Stat(r.path); err != nil {
+				Log.Debug("report ", r.path, " for command ", cmd.name, " does not exist")
+				continue
+			}
+			paths = append(paths, r.path)
+		}
+	}
+
+	if len(paths) == 0 {
+		return ""
+	}
+
+	merged, err := mergeSarifFiles(paths)
+	if err != nil {
+		Log.WithError(err).Error("failed to merge SARIF reports")
+		return ""
+	}
+
+	out := sarifOutputPath()
+
+	err = os.MkdirAll(filepath.Dir(out), 0700)
+	if err != nil {
+		Log.WithError(err).Error("failed to create directory for SARIF report")
+		return ""
+	}
+
+	err = ioutil.WriteFile(out, merged, 0600)
+	if err != nil {
+		Log.WithError(err).Error("failed to write SARIF report")
+		return ""
+	}
+
+	l.Println(printPrompt() + "merged " + cp.Prompt + strings.Join(paths, ", ") + cp.Text + " into " + cp.Prompt + out + cp.Reset)
+
+	return out
+}
+
+// merge multiple SARIF files by concatenating their runs
+func mergeSarifFiles(paths []string) ([]byte, error) {
+
+	merged := &sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []json.RawMessage{},
+	}
+
+	for _, path := range paths {
+
+		c, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		var log sarifLog
+		err = json.Unmarshal(c, &log)
+		if err != nil {
+			return nil, errors.New(path + ": " + err.Error())
+		}
+
+		merged.Runs = append(merged.Runs, log.Runs...)
+	}
+
+	return json.MarshalIndent(merged, "", "  ")
+}
+
+// upload a SARIF file to GitHub code scanning
+func uploadSarif(c *ciConfig, path string) error {
+
+	token, err := githubToken(c)
+	if err != nil {
+		return err
+	}
+
+	repo := os.Getenv("GITHUB_REPOSITORY")
+	if repo == "" {
+		return errors.New("GITHUB_REPOSITORY not set")
+	}
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	// the API expects gzip compressed and base64 encoded contents
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	_, err = w.Write(contents)
+	if err != nil {
+		return err
+	}
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+
+	payload := map[string]string{
+		"commit_sha": os.Getenv("GITHUB_SHA"),
+		"ref":        os.Getenv("GITHUB_REF"),
+		"sarif":      base64.StdEncoding.EncodeToString(b.Bytes()),
+		"tool_name":  "zeus",
+	}
+
+	Log.Debug("uploading SARIF report ", path)
+	return githubRequest("POST", githubAPI(c)+"/repos/"+repo+"/code-scanning/sarifs", token, payload, nil)
+}
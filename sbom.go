@@ -0,0 +1,394 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha256"
+	"debug/buildinfo"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	sbomFormatCycloneDX = "cyclonedx"
+	sbomFormatSPDX      = "spdx"
+)
+
+var (
+	// ErrUnknownSBOMFormat means the sbomFormat config field contains an unsupported format
+	ErrUnknownSBOMFormat = errors.New("unknown SBOM format")
+
+	// ErrSBOMWithoutOutputs means a command generates an SBOM but declares no outputs
+	ErrSBOMWithoutOutputs = errors.New("sbom requires declared outputs")
+)
+
+// sbomComponent is a go module contained in an artifact
+type sbomComponent struct {
+	path    string
+	version string
+}
+
+// package URL for the component
+func (c *sbomComponent) purl() string {
+	return "pkg:golang/" + c.path + "@" + c.version
+}
+
+// cycloneDX document, see: https://cyclonedx.org/docs/1.4/json
+type cycloneDX struct {
+	BomFormat    string               `json:"bomFormat"`
+	SpecVersion  string               `json:"specVersion"`
+	SerialNumber string               `json:"serialNumber"`
+	Version      int                  `json:"version"`
+	Metadata     cycloneDXMetadata    `json:"metadata"`
+	Components   []cycloneDXComponent `json:"components"`
+}
+
+type cycloneDXMetadata struct {
+	Timestamp string             `json:"timestamp"`
+	Tools     []cycloneDXTool    `json:"tools"`
+	Component cycloneDXComponent `json:"component"`
+}
+
+type cycloneDXTool struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type cycloneDXComponent struct {
+	Type    string          `json:"type"`
+	Name    string          `json:"name"`
+	Version string          `json:"version,omitempty"`
+	Purl    string          `json:"purl,omitempty"`
+	Hashes  []cycloneDXHash `json:"hashes,omitempty"`
+}
+
+type cycloneDXHash struct {
+	Algorithm string `json:"alg"`
+	Content   string `json:"content"`
+}
+
+// spdx document, see: https://spdx.github.io/spdx-spec/v2.3
+type spdxDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	Name             string            `json:"name"`
+	SPDXID           string            `json:"SPDXID"`
+	VersionInfo      string            `json:"versionInfo,omitempty"`
+	DownloadLocation string            `json:"downloadLocation"`
+	Checksums        []spdxChecksum    `json:"checksums,omitempty"`
+	ExternalRefs     []spdxExternalRef `json:"externalRefs,omitempty"`
+}
+
+type spdxChecksum struct {
+	Algorithm string `json:"algorithm"`
+	Value     string `json:"checksumValue"`
+}
+
+type spdxExternalRef struct {
+	Category string `json:"referenceCategory"`
+	Type     string `json:"referenceType"`
+	Locator  string `json:"referenceLocator"`
+}
+
+type spdxRelationship struct {
+	Element        string `json:"spdxElementId"`
+	Type           string `json:"relationshipType"`
+	RelatedElement string `json:"relatedSpdxElement"`
+}
+
+// get the configured SBOM format
+func sbomFormat() string {
+	conf.Lock()
+	defer conf.Unlock()
+	if conf.fields.SBOMFormat == "" {
+		return sbomFormatCycloneDX
+	}
+	return conf.fields.SBOMFormat
+}
+
+// path of the SBOM document for an artifact
+func sbomPath(artifact, format string) string {
+	if format == sbomFormatSPDX {
+		return artifact + ".spdx.json"
+	}
+	return artifact + ".cdx.json"
+}
+
+// generate checksums and SBOM documents for all outputs of a command
+func generateSBOMs(name string, outputs []string) error {
+
+	format := sbomFormat()
+	if format != sbomFormatCycloneDX && format != sbomFormatSPDX {
+		return errors.New(ErrUnknownSBOMFormat.Error() + ": " + format)
+	}
+
+	for _, artifact := range outputs {
+
+		checksum, err := writeChecksum(artifact)
+		if err != nil {
+			return errors.New("failed to create checksum for " + artifact + ": " + err.Error())
+		}
+
+		err = writeSBOM(artifact, format, checksum)
+		if err != nil {
+			return errors.New("failed to create SBOM for " + artifact + ": " + err.Error())
+		}
+
+		l.Println(printPrompt() + "[" + name + "] created SBOM " + cp.Prompt + sbomPath(artifact, format) + cp.Reset)
+	}
+
+	return nil
+}
+
+// write the sha256sum of a regular file into <artifact>.sha256
+// directories have no checksum and an empty string is returned
+func writeChecksum(artifact string) (string, error) {
+
+	stat, err := os.Stat(artifact)
+	if err != nil {
+		return "", err
+	}
+	if stat.IsDir() {
+		return "", nil
+	}
+
+	f, err := os.Open(artifact)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+
+	sum := hex.EncodeToString(h.Sum(nil))
+
+	return sum, ioutil.WriteFile(artifact+".sha256", []byte(sum+"  "+filepath.Base(artifact)+"\n"), 0644)
+}
+
+// create the SBOM document for the artifact
+// syft is used if installed, otherwise the go modules are collected
+func writeSBOM(artifact, format, checksum string) error {
+
+	if _, err := exec.LookPath("syft"); err == nil {
+
+		out, err := exec.Command("syft", artifact, "-o", format+"-json").Output()
+		if err != nil {
+			return errors.New("syft: " + err.Error())
+		}
+
+		return ioutil.WriteFile(sbomPath(artifact, format), out, 0644)
+	}
+
+	components, err := goModules(artifact)
+	if err != nil {
+		return err
+	}
+
+	var doc interface{}
+	if format == sbomFormatSPDX {
+		doc = newSPDXDocument(filepath.Base(artifact), checksum, components)
+	} else {
+		doc = newCycloneDX(filepath.Base(artifact), checksum, components)
+	}
+
+	c, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(sbomPath(artifact, format), c, 0644)
+}
+
+// collect the go modules for an artifact
+// the build info is used for go binaries, otherwise the go.sum of the project is read
+func goModules(artifact string) (components []*sbomComponent, err error) {
+
+	if info, err := buildinfo.ReadFile(artifact); err == nil {
+		for _, d := range info.Deps {
+			if d.Replace != nil {
+				d = d.Replace
+			}
+			components = append(components, &sbomComponent{path: d.Path, version: d.Version})
+		}
+		return components, nil
+	}
+
+	f, err := os.Open("go.sum")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var (
+		seen    = make(map[string]bool)
+		scanner = bufio.NewScanner(f)
+	)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 || strings.HasSuffix(fields[1], "/go.mod") {
+			continue
+		}
+		if !seen[fields[0]+fields[1]] {
+			seen[fields[0]+fields[1]] = true
+			components = append(components, &sbomComponent{path: fields[0], version: fields[1]})
+		}
+	}
+
+	return components, scanner.Err()
+}
+
+// create a random version 4 UUID
+func newUUID() string {
+
+	var b = make([]byte, 16)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		Log.WithError(err).Fatal(ErrReadingRandomString)
+	}
+
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// UUID for an SBOM document, derived from the artifact in reproducible mode
+func documentUUID(name, checksum string) string {
+	if reproducible() {
+		return stableUUID(name + ":" + checksum)
+	}
+	return newUUID()
+}
+
+func newCycloneDX(name, checksum string, components []*sbomComponent) *cycloneDX {
+
+	doc := &cycloneDX{
+		BomFormat:    "CycloneDX",
+		SpecVersion:  "1.4",
+		SerialNumber: "urn:uuid:" + documentUUID(name, checksum),
+		Version:      1,
+		Metadata: cycloneDXMetadata{
+			Timestamp: artifactTime().UTC().Format(time.RFC3339),
+			Tools:     []cycloneDXTool{{Name: "zeus", Version: version}},
+			Component: cycloneDXComponent{
+				Type: "application",
+				Name: name,
+			},
+		},
+		Components: []cycloneDXComponent{},
+	}
+
+	if checksum != "" {
+		doc.Metadata.Component.Hashes = []cycloneDXHash{{Algorithm: "SHA-256", Content: checksum}}
+	}
+
+	for _, c := range components {
+		doc.Components = append(doc.Components, cycloneDXComponent{
+			Type:    "library",
+			Name:    c.path,
+			Version: c.version,
+			Purl:    c.purl(),
+		})
+	}
+
+	return doc
+}
+
+func newSPDXDocument(name, checksum string, components []*sbomComponent) *spdxDocument {
+
+	doc := &spdxDocument{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              name,
+		DocumentNamespace: "https://spdx.org/spdxdocs/" + name + "-" + documentUUID(name, checksum),
+		CreationInfo: spdxCreationInfo{
+			Created:  artifactTime().UTC().Format(time.RFC3339),
+			Creators: []string{"Tool: zeus-" + version},
+		},
+		Packages: []spdxPackage{
+			{
+				Name:             name,
+				SPDXID:           "SPDXRef-Package-0",
+				DownloadLocation: "NOASSERTION",
+			},
+		},
+		Relationships: []spdxRelationship{
+			{Element: "SPDXRef-DOCUMENT", Type: "DESCRIBES", RelatedElement: "SPDXRef-Package-0"},
+		},
+	}
+
+	if checksum != "" {
+		doc.Packages[0].Checksums = []spdxChecksum{{Algorithm: "SHA256", Value: checksum}}
+	}
+
+	for i, c := range components {
+		id := "SPDXRef-Package-" + strconv.Itoa(i+1)
+		doc.Packages = append(doc.Packages, spdxPackage{
+			Name:             c.path,
+			SPDXID:           id,
+			VersionInfo:      c.version,
+			DownloadLocation: "NOASSERTION",
+			ExternalRefs: []spdxExternalRef{
+				{Category: "PACKAGE-MANAGER", Type: "purl", Locator: c.purl()},
+			},
+		})
+		doc.Relationships = append(doc.Relationships, spdxRelationship{
+			Element:        "SPDXRef-Package-0",
+			Type:           "CONTAINS",
+			RelatedElement: id,
+		})
+	}
+
+	return doc
+}
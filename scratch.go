@@ -0,0 +1,146 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// edit target for the scratch script
+	editTargetScratch = "scratch"
+
+	// language of the scratch script when none is given
+	scratchDefaultLanguage = "bash"
+)
+
+// path of the scratch script for the language
+// every language has a scratch script of its own, it is kept between the runs
+func scratchPath(lang *Language) string {
+	return filepath.Join(zeusDir, "data", "scratch", "scratch"+lang.FileExtension)
+}
+
+// create the scratch script with a header, unless it exists
+func createScratch(lang *Language) (string, error) {
+
+	path := scratchPath(lang)
+
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return "", err
+	}
+
+	header := lang.Comment + " zeus scratch script, it runs when the editor is closed\n" +
+		lang.Comment + " an empty script is not run\n"
+
+	return path, ioutil.WriteFile(path, []byte(header), 0700)
+}
+
+// the code of the scratch script, without the comment lines and blank lines
+// an empty string means there is nothing to run
+func scratchCode(lang *Language, contents string) string {
+
+	var lines []string
+	for _, line := range strings.Split(contents, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || lang.Comment != "" && strings.HasPrefix(trimmed, lang.Comment) {
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// run the scratch script as a transient command
+// it is not added to the command map, the globals are available like for every other command
+func runScratch(lang *Language, code string) error {
+
+	cmd := &command{
+		name:     editTargetScratch,
+		language: lang.Name,
+		exec:     code,
+		args:     map[string]*commandArg{},
+	}
+
+	err := s.begin()
+	if err != nil {
+		return err
+	}
+	defer s.end()
+
+	s.plan(1)
+	progressUI.plan(cmd)
+
+	return cmd.AtomicRun(nil, false)
+}
+
+// edit scratch [<language>]
+// open the scratch script in the editor and run it when the editor is closed
+func handleScratchCommand(args []string) error {
+
+	if len(args) > 3 {
+		printEditCommandUsageErr()
+		return ErrInvalidUsage
+	}
+
+	name := scratchDefaultLanguage
+	if len(args) == 3 {
+		name = args[2]
+	}
+
+	ls.Lock()
+	lang, ok := ls.items[name]
+	ls.Unlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnsupportedLanguage, name)
+	}
+
+	path, err := createScratch(lang)
+	if err != nil {
+		return err
+	}
+
+	runEditor(editorCommand(), []string{path})
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	code := scratchCode(lang, string(contents))
+	if code == "" {
+		l.Println(cp.Text + "the scratch script is empty, nothing to run" + cp.Reset)
+		return nil
+	}
+
+	err = runScratch(lang, code)
+	if err != nil {
+		return fmt.Errorf("scratch script failed: %w", err)
+	}
+	return nil
+}
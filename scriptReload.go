@@ -0,0 +1,111 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// modification times of the scripts when they were reloaded last
+	// editors write a file more than once when saving it, each version is reloaded once
+	scriptVersions = &scriptVersionMap{
+		items: make(map[string]time.Time, 0),
+	}
+)
+
+type scriptVersionMap struct {
+	items map[string]time.Time
+	sync.Mutex
+}
+
+// check if the version of the script has been seen and remember it
+func (m *scriptVersionMap) seen(path string, version time.Time) bool {
+	m.Lock()
+	defer m.Unlock()
+
+	if prev, ok := m.items[path]; ok && prev.Equal(version) {
+		return true
+	}
+	m.items[path] = version
+	return false
+}
+
+func (m *scriptVersionMap) forget(path string) {
+	m.Lock()
+	delete(m.items, path)
+	m.Unlock()
+}
+
+// reload the command of a script in the script directory after it changed
+// only this command is initialized again, the other commands, the state of the shell and running commands are kept
+// when the project has a CommandsFile, the scripts are read whenever their command runs and the CommandsFile watcher takes care of the commands
+func reloadScript(path string) {
+
+	// temporary scripts, hidden files and sub directories
+	if filepath.Dir(filepath.Clean(path)) != filepath.Clean(scriptDir) || strings.HasPrefix(filepath.Base(path), ".") {
+		return
+	}
+
+	if len(commandsFileParts(commandsFilePath)) > 0 {
+		return
+	}
+	if _, err := os.Stat(commandsStarPath); err == nil {
+		return
+	}
+
+	var (
+		ext  = filepath.Ext(path)
+		name = strings.TrimSuffix(filepath.Base(path), ext)
+	)
+
+	info, err := os.Stat(path)
+	if err != nil {
+
+		// removed or renamed
+		scriptVersions.forget(path)
+		if cmd, err := cmdMap.getCommand(name); err == nil && cmd.path == path {
+			cmdMap.remove(name)
+			l.Println(cp.Text + "removed " + cp.CmdName + name + cp.Reset)
+		}
+		return
+	}
+
+	if info.IsDir() || scriptVersions.seen(path, info.ModTime()) {
+		return
+	}
+
+	cmd, err := newScriptCommand(path)
+	if err != nil {
+		Log.WithError(err).Debug("ignoring change in the script directory")
+		return
+	}
+
+	action := "reloaded "
+	if _, err := cmdMap.getCommand(name); err != nil {
+		action = "added "
+	}
+
+	cmdMap.replace(cmd)
+	l.Println(cp.Text + action + cp.CmdName + name + cp.Reset)
+}
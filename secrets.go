@@ -0,0 +1,430 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/dreadl0ck/readline"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// environment variable with the passphrase for the secrets
+	secretPassphraseEnv = "ZEUS_SECRET_PASSPHRASE"
+
+	// replaces the values of secrets in the output
+	secretMask = "****"
+
+	// scrypt parameters for deriving the key from the passphrase
+	secretSaltSize = 16
+	secretKeySize  = 32
+	secretScryptN  = 1 << 15
+	secretScryptR  = 8
+	secretScryptP  = 1
+)
+
+var (
+	// ErrNoSecretKey means there is neither a passphrase nor a keyfile to encrypt or decrypt the secrets
+	ErrNoSecretKey = errors.New("no key for the secrets, set " + secretPassphraseEnv + " or the secretKeyFile config field")
+
+	// ErrUndeclaredSecret means a secret was not marked as secret in the globals of the CommandsFile
+	ErrUndeclaredSecret = errors.New("secret is not declared in the globals of the CommandsFile")
+
+	// ErrInvalidSecret means a stored secret could not be decrypted
+	ErrInvalidSecret = errors.New("failed to decrypt secret, wrong passphrase or keyfile")
+
+	// ErrSecretInEnv means a secret was declared in the env of a command
+	ErrSecretInEnv = errors.New("secrets can only be declared in the globals")
+)
+
+// globals marked as secret, their values are stored encrypted in the project data
+type secretStore struct {
+
+	// names of the secrets declared in the CommandsFile
+	names []string
+
+	// decrypted values by name
+	values map[string]string
+
+	// read once per process
+	passphrase []byte
+
+	sync.Mutex
+}
+
+var secrets = &secretStore{
+	values: make(map[string]string),
+}
+
+func printSecretsCommandUsageErr() {
+	l.Println(ErrInvalidUsage)
+	l.Println("usage: secrets [set <name>] [remove <name>]")
+}
+
+// handle the secrets shell command
+func handleSecretsCommand(args []string) {
+
+	if len(args) < 2 {
+		listSecrets()
+		return
+	}
+
+	if len(args) != 3 {
+		printSecretsCommandUsageErr()
+		return
+	}
+
+	var err error
+	switch args[1] {
+	case "set":
+		err = setSecret(args[2])
+	case "remove":
+		projectData.Lock()
+		delete(projectData.fields.Secrets, args[2])
+		projectData.Unlock()
+		projectData.update()
+		secrets.forget(args[2])
+	default:
+		printSecretsCommandUsageErr()
+		return
+	}
+	if err != nil {
+		l.Println(err)
+	}
+}
+
+// print the declared secrets and whether a value is stored for them
+func listSecrets() {
+
+	secrets.Lock()
+	names := secrets.names
+	secrets.Unlock()
+
+	if len(names) == 0 {
+		l.Println("no secrets declared.")
+		return
+	}
+
+	projectData.RLock()
+	defer projectData.RUnlock()
+
+	for _, name := range names {
+		if _, ok := projectData.fields.Secrets[name]; ok {
+			l.Println(cp.Text+pad(name, 20), secretMask)
+		} else {
+			l.Println(cp.Text+pad(name, 20), "(not set)")
+		}
+	}
+}
+
+// read the value for a secret, encrypt it and store it in the project data
+func setSecret(name string) error {
+
+	if !secrets.declared(name) {
+		return errors.New(ErrUndeclaredSecret.Error() + ": " + name)
+	}
+
+	value, err := readSecretValue("value for " + name + ": ")
+	if err != nil {
+		return err
+	}
+
+	passphrase, err := secrets.key()
+	if err != nil {
+		return err
+	}
+
+	encrypted, err := encryptSecret(passphrase, value)
+	if err != nil {
+		return err
+	}
+
+	projectData.Lock()
+	if projectData.fields.Secrets == nil {
+		projectData.fields.Secrets = make(map[string]string)
+	}
+	projectData.fields.Secrets[name] = encrypted
+	projectData.Unlock()
+	projectData.update()
+
+	secrets.forget(name)
+	l.Println("stored secret " + name)
+	return nil
+}
+
+// read a value without echoing it on a terminal, or the first line of stdin
+func readSecretValue(prompt string) ([]byte, error) {
+
+	if readline.IsTerminal(int(os.Stdin.Fd())) {
+		return readline.Password(prompt)
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return []byte(strings.TrimRight(line, "\r\n")), nil
+}
+
+// set the names of the secrets declared in the CommandsFile
+func (st *secretStore) declare(names []string) {
+	st.Lock()
+	st.names = names
+	st.Unlock()
+}
+
+// check if a secret is declared in the CommandsFile
+func (st *secretStore) declared(name string) bool {
+	st.Lock()
+	defer st.Unlock()
+	for _, n := range st.names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// drop the decrypted value of a secret
+func (st *secretStore) forget(name string) {
+	st.Lock()
+	delete(st.values, name)
+	st.Unlock()
+}
+
+// the passphrase for the secrets
+// from the environment, the keyfile or a prompt on the terminal
+func (st *secretStore) key() ([]byte, error) {
+
+	st.Lock()
+	defer st.Unlock()
+
+	if st.passphrase != nil {
+		return st.passphrase, nil
+	}
+
+	if p := os.Getenv(secretPassphraseEnv); p != "" {
+		st.passphrase = []byte(p)
+		return st.passphrase, nil
+	}
+
+	conf.Lock()
+	keyFile := conf.fields.SecretKeyFile
+	conf.Unlock()
+
+	if keyFile != "" {
+		c, err := ioutil.ReadFile(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		st.passphrase = []byte(strings.TrimSpace(string(c)))
+		return st.passphrase, nil
+	}
+
+	if readline.IsTerminal(int(os.Stdin.Fd())) {
+		p, err := readline.Password("secret passphrase: ")
+		if err != nil {
+			return nil, err
+		}
+		st.passphrase = p
+		return st.passphrase, nil
+	}
+
+	return nil, ErrNoSecretKey
+}
+
+// decrypt the stored secrets referenced in the source of a command and return them as environment entries
+// secrets without a stored value are left to the environment
+// the key is only needed when the command references a stored secret
+func (st *secretStore) environment(source string) ([]string, error) {
+
+	st.Lock()
+	names := st.names
+	st.Unlock()
+
+	var env []string
+	for _, name := range names {
+
+		if !referencesName(source, name) {
+			continue
+		}
+
+		projectData.RLock()
+		encrypted, ok := projectData.fields.Secrets[name]
+		projectData.RUnlock()
+		if !ok {
+			continue
+		}
+
+		st.Lock()
+		value, ok := st.values[name]
+		st.Unlock()
+
+		if !ok {
+			passphrase, err := st.key()
+			if err != nil {
+				return nil, err
+			}
+			v, err := decryptSecret(passphrase, encrypted)
+			if err != nil {
+				return nil, errors.New(name + ": " + err.Error())
+			}
+			value = string(v)
+
+			st.Lock()
+			st.values[name] = value
+			st.Unlock()
+		}
+		env = append(env, name+"="+value)
+	}
+	return env, nil
+}
+
+// check if there are decrypted secrets that must be masked
+func (st *secretStore) active() bool {
+	st.Lock()
+	defer st.Unlock()
+	return len(st.values) > 0
+}
+
+// replace the values of all decrypted secrets
+func (st *secretStore) mask(s string) string {
+	st.Lock()
+	defer st.Unlock()
+	for _, value := range st.values {
+		if value != "" {
+			s = strings.Replace(s, value, secretMask, -1)
+		}
+	}
+	return s
+}
+
+// remove the passphrase from an environment, so the commands never see it
+func withoutPassphrase(env []string) []string {
+	out := env[:0:0]
+	for _, e := range env {
+		if !strings.HasPrefix(e, secretPassphraseEnv+"=") {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// masks the secrets in the output of a command
+// expects complete lines, so a secret is never split between two writes
+type maskWriter struct {
+	out io.Writer
+}
+
+// Write implements the io.Writer interface
+func (w *maskWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(w.out, secrets.mask(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// derive the key for a secret from the passphrase
+func secretKey(passphrase, salt []byte) ([]byte, error) {
+	return scrypt.Key(passphrase, salt, secretScryptN, secretScryptR, secretScryptP, secretKeySize)
+}
+
+// encrypt a value with AES-GCM
+// returns the salt, nonce and ciphertext encoded as base64
+func encryptSecret(passphrase, value []byte) (string, error) {
+
+	salt := make([]byte, secretSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key, err := secretKey(passphrase, salt)
+	if err != nil {
+		return "", err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	out := append(salt, nonce...)
+	out = gcm.Seal(out, nonce, value, nil)
+
+	return base64.StdEncoding.EncodeToString(out), nil
+}
+
+// decrypt a value created by encryptSecret
+func decryptSecret(passphrase []byte, encrypted string) ([]byte, error) {
+
+	data, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return nil, ErrInvalidSecret
+	}
+	if len(data) < secretSaltSize {
+		return nil, ErrInvalidSecret
+	}
+
+	key, err := secretKey(passphrase, data[:secretSaltSize])
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	data = data[secretSaltSize:]
+	if len(data) < gcm.NonceSize() {
+		return nil, ErrInvalidSecret
+	}
+
+	value, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, ErrInvalidSecret
+	}
+	return value, nil
+}
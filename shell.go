@@ -46,6 +46,8 @@ var (
 // when there's an unknown command it will be passed to the shell
 func readlineLoop() error {
 
+	watchTerminalSize()
+
 	if conf.fields.PrintBuiltins {
 		printBuiltins()
 	}
@@ -53,28 +55,42 @@ func readlineLoop() error {
 	// print overview
 	printCommands()
 
+	migrateShellHistory()
+
 	var (
-		historyFileName string
+		historyFileName = shellHistoryFile()
 		err             error
 	)
 
-	if conf.fields.HistoryFile {
-		historyFileName = zeusDir + "/.history"
+	if historyFileName != "" {
+		err = os.MkdirAll(filepath.Dir(historyFileName), 0700)
+		if err != nil {
+			Log.WithError(err).Error("failed to create the directory for the shell history")
+		}
 	}
 
 	conf.Lock()
 	historyLimit := conf.fields.HistoryLimit
 	conf.Unlock()
 
+	shellHistory.load(historyFileName, historyLimit)
+
 	readlineMutex.Lock()
 	// prepare readline
 	rl, err = readline.NewEx(&readline.Config{
-		Prompt:          printPrompt(),
-		AutoComplete:    completer,
-		HistoryLimit:    historyLimit,
-		HistoryFile:     historyFileName,
-		Listener:        listener,
-		InterruptPrompt: "\nBye." + cp.Reset,
+		Prompt:       printPrompt(),
+		AutoComplete: completer,
+		HistoryLimit: historyLimit,
+		HistoryFile:  historyFileName,
+
+		// lines referring to the history are saved as the line they refer to
+		DisableAutoSaveHistory: true,
+		Listener:               listener,
+		InterruptPrompt:        "\nBye." + cp.Reset,
+
+		// the fuzzy finder handles its keys and paints the matches below the prompt
+		FuncFilterInputRune: finder.filterInputRune,
+		Painter:             finder,
 	})
 	readlineMutex.Unlock()
 	if err != nil {
@@ -84,10 +100,29 @@ func readlineLoop() error {
 
 	for {
 
-		// read a line
-		line, err := rl.Readline()
+		// the placeholders change between the lines
+		readlineMutex.Lock()
+		if finder.isActive() {
+			rl.SetPrompt(finderPrompt())
+		} else {
+			rl.SetPrompt(refreshPrompt())
+		}
+		readlineMutex.Unlock()
+
+		// read a line, starting with the selection of the fuzzy finder
+		var line string
+		if pending := finder.takePending(); pending != "" {
+			line, err = rl.ReadlineWithDefault(pending)
+		} else {
+			line, err = rl.Readline()
+		}
 		if err != nil {
 
+			if err == readline.ErrInterrupt && finder.isActive() {
+				finder.close()
+				continue
+			}
+
 			if err == io.EOF {
 				return nil
 			}
@@ -106,10 +141,99 @@ func readlineLoop() error {
 			return fmt.Errorf("readline error: %v", err)
 		}
 
+		if finder.isActive() {
+			finder.accept(line)
+			continue
+		}
+
+		// lines ending with a backslash continue on the next line
+		line, err = joinContinuedLines(line, readContinuation)
+		if err != nil {
+			if err == readline.ErrInterrupt {
+				continue
+			}
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("readline error: %v", err)
+		}
+
+		expanded, err := expandHistoryLine(line, shellHistory.get())
+		if err != nil {
+			l.Println(err)
+			continue
+		}
+		if expanded != line {
+			l.Println(cp.Text + expanded + cp.Reset)
+			line = expanded
+		}
+		if strings.TrimSpace(line) != "" {
+			shellHistory.add(strings.TrimSpace(line))
+			rl.SaveHistory(strings.TrimSpace(line))
+		}
+
+		// every line is a new invocation
+		s.resume()
+		substitutions.reset()
+		line, level := stripOutputLevelFlagsFromLine(line)
+		setOutputLevel(level)
 		handleLine(line)
 	}
 }
 
+// prompt of the interactive shell for the continuation of a line
+func continuationPrompt() string {
+	return cp.Prompt + "..." + marker(" » ", "> ") + cp.Text
+}
+
+// read the continuation of a line, the prompt is restored afterwards
+func readContinuation() (string, error) {
+
+	readlineMutex.Lock()
+	rl.SetPrompt(continuationPrompt())
+	readlineMutex.Unlock()
+
+	defer func() {
+		readlineMutex.Lock()
+		rl.SetPrompt(printPrompt())
+		readlineMutex.Unlock()
+	}()
+
+	return rl.Readline()
+}
+
+// check if the line ends with a backslash that is not escaped
+func continuesLine(line string) bool {
+	trimmed := strings.TrimRight(line, " \t")
+	n := len(trimmed) - len(strings.TrimRight(trimmed, "\\"))
+	return n%2 == 1
+}
+
+// join a line ending with a backslash with the lines read by next
+// the backslash is replaced by a space, Ctrl-C while reading a continuation discards the whole line
+func joinContinuedLines(line string, next func() (string, error)) (string, error) {
+
+	for continuesLine(line) {
+
+		trimmed := strings.TrimRight(line, " \t")
+		line = strings.TrimSpace(trimmed[:len(trimmed)-1])
+
+		cont, err := next()
+		if err != nil {
+			return "", err
+		}
+
+		if c := strings.TrimSpace(cont); c != "" {
+			if line != "" {
+				line += " "
+			}
+			line += c
+		}
+	}
+
+	return line, nil
+}
+
 // handle input line read by the readline instance
 func handleLine(line string) {
 
@@ -129,7 +253,7 @@ func handleLine(line string) {
 
 		clearScreen()
 
-		l.Println(cp.Text + asciiArt + "v" + version)
+		printBanner()
 
 		conf.Lock()
 		if conf.fields.Debug {
@@ -144,9 +268,6 @@ func handleLine(line string) {
 	case infoCommand:
 		printProjectInfo()
 
-	case formatCommand:
-		f.formatCommand()
-
 	case "zeus": // prevent spawning a new interactive shell
 
 	case globalsCommand:
@@ -165,21 +286,24 @@ func handleLine(line string) {
 	case dataCommand:
 		printProjectData()
 
-	case updateCommand:
-		updateZeus()
-
 	case versionCommand:
 		l.Println(version)
 
 	case clearCommand:
 
 		clearScreen()
-		l.Println(cp.Text + asciiArt + "v" + version)
+		printBanner()
 		l.Println(cp.Text + "Project Name: " + cp.Prompt + filepath.Base(workingDir) + cp.Text + "\n")
 
 	case builtinsCommand:
 		printBuiltins()
 
+	case statsCommand:
+		handleStatsCommand()
+
+	case gcCommand:
+		handleGCCommand()
+
 	default:
 
 		// split the input line
@@ -226,10 +350,92 @@ func handleLine(line string) {
 			handleTodoCommand(args)
 		case generateCommand:
 			handleGenerateCommand(args)
+		case logsCommand:
+			handleLogsCommand(args)
+		case profileCommand:
+			handleProfileCommand(args)
+		case historyCommand:
+			handleHistoryCommand(args)
+		case findCommand:
+			handleFindCommand(args)
+		case secretsCommand:
+			handleSecretsCommand(args)
+		case dumpsCommand:
+			handleDumpsCommand(args)
+		case formatCommand:
+			// errors are printed by the formatter
+			f.formatCommand(args)
+		case lintCommand:
+			err := handleLintCommand(args)
+			if err != nil && err != ErrLintFindings && err != ErrInvalidUsage {
+				l.Println(err)
+			}
+		case batchCommand:
+			err := handleBatchCommand(args)
+			if err != nil {
+				l.Println(err)
+			}
+		case rerunCommand:
+			handleRerunCommand(args)
+		case gitHooksCommand:
+			handleGitHooksCommand(args)
+		case serveCommand:
+			go handleServeCommand(args)
+		case lspCommand:
+			l.Println("the language server talks to your editor over stdin and stdout, configure your editor to start: zeus lsp")
+		case migrateCommand:
+			handleMigrateCommand(args)
+		case exportCommand:
+			err := handleExportCommand(args)
+			if err != nil && err != ErrInvalidUsage {
+				l.Println(err)
+			}
+		case useCommand:
+			handleUseCommand(args)
+		case reportCommand:
+			handleReportCommand(args)
+		case optimizeCommand:
+			handleOptimizeCommand(args)
+		case cmdCommand:
+			// values of the flags can contain spaces
+			err := handleCmdCommand(splitQuotedFields(line))
+			if err != nil && err != ErrInvalidUsage {
+				l.Println(err)
+			}
+		case envCommand:
+			err := handleEnvCommand(args)
+			if err != nil && err != ErrEnvironmentDiffers && err != ErrInvalidUsage {
+				l.Println(err)
+			}
+		case doctorCommand:
+			err := handleDoctorCommand(args)
+			if err != nil && err != ErrDoctorFindings && err != ErrInvalidUsage {
+				l.Println(err)
+			}
+		case updateCommand:
+			err := handleUpdateCommand(args)
+			if err != nil && err != ErrInvalidUsage {
+				l.Println(err)
+			}
+		case toolchainCommand:
+			err := handleToolchainCommand(args)
+			if err != nil && err != ErrInvalidUsage {
+				l.Println(err)
+			}
+		case releaseCommand:
+			err := handleReleaseCommand(args)
+			if err != nil && err != ErrInvalidUsage {
+				l.Println(err)
+			}
+		case affectedCommand:
+			err := handleAffectedCommand(args)
+			if err != nil {
+				l.Println(err)
+			}
 
 		default:
 			// check if its a commandchain
-			if strings.Contains(line, commandChainSeparator) {
+			if isCommandChain(line) {
 				fields := strings.Split(line, commandChainSeparator)
 				if cmdChain, ok := validCommandChain(fields); ok {
 					cmdChain.exec(fields)
@@ -256,40 +462,64 @@ func handleLine(line string) {
 
 					projectData.Unlock()
 					handleLine(command)
-
-					s.reset()
 					return
 				}
 				projectData.Unlock()
 
-				// not an alias - pass to shell
-				if conf.fields.PassCommandsToShell {
+				// not an alias - pass to a plugin, the fallback or the shell
+				if _, ok := plugins.get(commandName); ok {
+					err := runPlugin(commandName, args)
+					if err != nil {
+						l.Println(err)
+					}
+					return
+				}
+
+				switch {
+				case commandFallback.get() != "":
+					err := runFallback(commandName, args)
+					if err != nil {
+						l.Println(err)
+					}
+				case conf.fields.PassCommandsToShell:
 					err := passCommandToShell(commandName, args)
 					if err != nil {
 						l.Println(err)
+
+						// bash exits with 127 if the command was not found
+						if exitCode(err) == 127 {
+							printUnknownCommand(commandName)
+						}
 					}
-				} else {
-					l.Println(ErrUnknownCommand, ": ", commandName)
+				default:
+					printUnknownCommand(commandName)
 				}
 				return
 			}
 			cmdMap.Unlock()
 
-			defer s.reset()
-			count, err := getTotalDependencyCount(cmd)
+			err := s.begin()
 			if err != nil {
 				l.Println(err)
 				return
 			}
+			defer s.end()
 
-			s.Lock()
-			s.numCommands = s.numCommands + count
-			s.Unlock()
+			count, err := getTotalDependencyCount(cmd)
+			if err != nil {
+				l.Println(err)
+				return
+			}
+			s.plan(count)
+			progressUI.plan(cmd)
 
 			// run the command
 			err = cmd.Run(args, cmd.async)
 			if err != nil {
 				fmt.Printf("command "+cmd.name+" failed. error: %v\n", err)
+				recordInvocation(invocationKey([]string{line}), []string{line}, 0)
+			} else {
+				recordInvocation(invocationKey([]string{line}), []string{line}, -1)
 			}
 
 			if cmd.async {
@@ -0,0 +1,218 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// subcommand of the history builtin for the lines entered in the interactive shell
+const historySubcommandLines = "lines"
+
+var (
+	// ErrUnknownHistoryLine occurs when a line is re-executed by an index that is not in the shell history
+	ErrUnknownHistoryLine = errors.New("no such line in the shell history")
+
+	// lines entered in the interactive shell, loaded from the history file on startup
+	shellHistory = &shellHistoryStore{}
+)
+
+// the lines entered in the interactive shell, oldest first
+// the index of a line is its position, counted from 1
+type shellHistoryStore struct {
+	lines  []string
+	limit  int
+	loaded bool
+	sync.Mutex
+}
+
+// path of the history file of the interactive shell
+func shellHistoryPath() string {
+	return filepath.Join(zeusDir, "data", "history")
+}
+
+// move the history file of older versions to the data directory
+func migrateShellHistory() {
+
+	legacy := filepath.Join(zeusDir, ".history")
+	if _, err := os.Stat(legacy); err != nil {
+		return
+	}
+	if _, err := os.Stat(shellHistoryPath()); err == nil {
+		return
+	}
+
+	err := os.MkdirAll(filepath.Dir(shellHistoryPath()), 0700)
+	if err == nil {
+		err = os.Rename(legacy, shellHistoryPath())
+	}
+	if err != nil {
+		Log.WithError(err).Warn("failed to move " + legacy + " to " + shellHistoryPath())
+	}
+}
+
+// path of the history file, empty if the history is not persisted
+func shellHistoryFile() string {
+
+	conf.Lock()
+	enabled := conf.fields.HistoryFile
+	conf.Unlock()
+
+	if !enabled {
+		return ""
+	}
+	return shellHistoryPath()
+}
+
+// load the last lines of the history file
+func (h *shellHistoryStore) load(path string, limit int) {
+
+	h.Lock()
+	defer h.Unlock()
+
+	h.lines, h.limit, h.loaded = nil, limit, true
+
+	if path == "" {
+		return
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			h.lines = append(h.lines, line)
+		}
+	}
+	h.trim()
+}
+
+// add a line entered in the shell
+// like in the history file, a line repeated directly is stored once
+func (h *shellHistoryStore) add(line string) {
+	h.Lock()
+	defer h.Unlock()
+	if n := len(h.lines); n > 0 && h.lines[n-1] == line {
+		return
+	}
+	h.lines = append(h.lines, line)
+	h.trim()
+}
+
+// keep the configured number of lines, a limit of 0 or less keeps all
+func (h *shellHistoryStore) trim() {
+	if h.limit > 0 && len(h.lines) > h.limit {
+		h.lines = append([]string{}, h.lines[len(h.lines)-h.limit:]...)
+	}
+}
+
+// get a copy of the lines
+// loads the history file, when used outside of the interactive shell
+func (h *shellHistoryStore) get() []string {
+
+	h.Lock()
+	loaded := h.loaded
+	h.Unlock()
+
+	if !loaded {
+		conf.Lock()
+		limit := conf.fields.HistoryLimit
+		conf.Unlock()
+		h.load(shellHistoryFile(), limit)
+	}
+
+	h.Lock()
+	defer h.Unlock()
+	return append([]string{}, h.lines...)
+}
+
+// replace a reference to the shell history with the line it refers to
+// !! is the previous line, !<index> the line with the index shown by 'history lines', !-<n> the n-th last line
+// all other lines are returned unchanged
+func expandHistoryLine(line string, lines []string) (string, error) {
+
+	ref := strings.TrimSpace(line)
+	if !strings.HasPrefix(ref, "!") || strings.ContainsAny(ref, " \t") {
+		return line, nil
+	}
+
+	var index int
+	switch {
+	case ref == "!!":
+		index = len(lines)
+	case strings.HasPrefix(ref, "!-"):
+		n, err := strconv.Atoi(ref[2:])
+		if err != nil {
+			return line, nil
+		}
+		index = len(lines) - n + 1
+	default:
+		n, err := strconv.Atoi(ref[1:])
+		if err != nil {
+			return line, nil
+		}
+		index = n
+	}
+
+	if index < 1 || index > len(lines) {
+		return "", errors.New(ErrUnknownHistoryLine.Error() + ": " + ref)
+	}
+	return lines[index-1], nil
+}
+
+// history lines [<number of lines>]
+// print the most recent lines of the shell history with their index
+func handleHistoryLinesCommand(args []string) {
+
+	n := 20
+	if len(args) > 0 {
+		i, err := strconv.Atoi(args[0])
+		if err != nil || len(args) > 1 {
+			printHistoryCommandUsageErr()
+			return
+		}
+		n = i
+	}
+
+	lines := shellHistory.get()
+	if len(lines) == 0 {
+		l.Println("the shell history is empty.")
+		return
+	}
+
+	start := 0
+	if n > 0 && len(lines) > n {
+		start = len(lines) - n
+	}
+
+	width := len(strconv.Itoa(len(lines))) + 2
+	for i := start; i < len(lines); i++ {
+		l.Println(cp.Prompt + pad(strconv.Itoa(i+1), width) + cp.Text + lines[i])
+	}
+}
@@ -0,0 +1,126 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/dreadl0ck/readline"
+)
+
+const (
+	// policies for detached commands when zeus shuts down
+	asyncOnExitOrphan    = "orphan"
+	asyncOnExitTerminate = "terminate"
+)
+
+var (
+	// ErrInterrupted means no further commands are started, because zeus received a signal
+	ErrInterrupted = errors.New("interrupted by signal")
+
+	// guards shuttingDown
+	signalMutex = &sync.Mutex{}
+
+	// a signal is being handled, another one kills all processes immediately
+	shuttingDown bool
+)
+
+// handle OS SIGNALS for a clean exit and clean up all spawned processes
+func handleSignals() {
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM, syscall.SIGSEGV, syscall.SIGHUP, syscall.SIGQUIT)
+
+	go func() {
+		for sig := range c {
+			Log.Debug("received SIGNAL: ", sig)
+			go shutdown(sig)
+		}
+	}()
+}
+
+// stop the running invocation
+// the signal is passed to all spawned processes, which get a grace period to exit before they are killed
+// the invocation fails with ErrInterrupted instead of starting further commands
+func shutdown(sig os.Signal) {
+
+	signalMutex.Lock()
+	if shuttingDown {
+		signalMutex.Unlock()
+		Log.Warn("received a second signal, killing all processes")
+		killProcesses()
+		return
+	}
+	shuttingDown = true
+	signalMutex.Unlock()
+
+	defer func() {
+		signalMutex.Lock()
+		shuttingDown = false
+		signalMutex.Unlock()
+	}()
+
+	s.interrupt()
+	projectLocks.interrupt()
+
+	// pass signal to all spawned procs
+	passSignalToProcs(sig)
+
+	conf.Lock()
+	grace := time.Duration(conf.fields.GracePeriod) * time.Second
+	conf.Unlock()
+
+	deadline := time.Now().Add(grace)
+	for runningProcesses() > 0 {
+		if time.Now().After(deadline) {
+			Log.Warn("processes did not exit within the grace period of " + strconv.Itoa(int(grace/time.Second)) + "s, killing them")
+			killProcesses()
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// commands are started in a process group of their own, if there is no terminal they could read from
+// this way a signal reaches all processes spawned by a command
+// with a terminal, they need to stay in the foreground process group of zeus
+func ownProcessGroup() bool {
+	return !readline.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// send a signal to a process and all processes in its group
+func signalProcess(pid int, sig syscall.Signal) error {
+	if pgid, err := syscall.Getpgid(pid); err == nil && pgid == pid {
+		return syscall.Kill(-pid, sig)
+	}
+	return syscall.Kill(pid, sig)
+}
+
+// check if detached commands are terminated when zeus shuts down
+func terminateAsync() bool {
+	conf.Lock()
+	defer conf.Unlock()
+	return conf.fields.AsyncOnExit == asyncOnExitTerminate
+}
@@ -68,6 +68,19 @@ func (s *SocketStore) Clear() {
 	return
 }
 
+// Broadcast writes data to all socket connections
+func (s *SocketStore) Broadcast(data string) {
+
+	s.Lock()
+	defer s.Unlock()
+
+	for _, socket := range s.sockets {
+		if !socket.IsClosed() {
+			socket.Write(data)
+		}
+	}
+}
+
 // NumSockets returns the current amount of socket connections managed by the SocketStore
 func (s *SocketStore) NumSockets() int {
 
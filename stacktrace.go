@@ -0,0 +1,194 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// names under which interpreters report a script passed on the commandline
+var evaluatedScriptNames = map[string]bool{
+	"<string>":       true, // python
+	"-e":             true, // ruby, perl
+	"[eval]":         true, // node
+	"(command line)": true, // lua
+	"-":              true,
+}
+
+// a location in a script, taken from the error output of the interpreter
+type stackFrame struct {
+	file string
+	line int
+}
+
+// parse the locations from the error output of a script
+// uses the ErrLinePattern of the language, or the ErrLineNumberSymbol if there is none
+// the frames are returned in the order of appearance, without duplicates
+func (lang *Language) stackFrames(errMsg string) (frames []stackFrame) {
+
+	if lang.ErrLinePattern == "" {
+		if lang.ErrLineNumberSymbol == "" {
+			return nil
+		}
+		if i, err := extractLineNumFromError(errMsg, lang.ErrLineNumberSymbol); err == nil {
+			frames = append(frames, stackFrame{line: i})
+		}
+		return
+	}
+
+	exp, err := regexp.Compile(lang.ErrLinePattern)
+	if err != nil {
+		Log.WithError(err).Error("invalid errLinePattern for language " + lang.Name)
+		return nil
+	}
+
+	seen := make(map[stackFrame]bool)
+	for _, match := range exp.FindAllStringSubmatch(errMsg, -1) {
+
+		var f stackFrame
+		for i, name := range exp.SubexpNames() {
+			switch {
+			case match[i] == "":
+			case name == "file" && f.file == "":
+				f.file = match[i]
+			case name == "line" && f.line == 0:
+				f.line, _ = strconv.Atoi(match[i])
+			}
+		}
+		if f.line == 0 || seen[f] {
+			continue
+		}
+		seen[f] = true
+		frames = append(frames, f)
+	}
+	return
+}
+
+// check if a frame is located in the script of the command
+// frames without a file name are assumed to be in the script
+func (c *command) ownsFrame(f stackFrame, lang *Language) bool {
+
+	switch {
+	case f.file == "", f.file == c.name, evaluatedScriptNames[f.file]:
+		return true
+	case filepath.Base(f.file) == filepath.Base(lang.Interpreter):
+		// shells name the script after the interpreter, when no name was passed
+		return true
+	case c.path != "" && filepath.Base(f.file) == filepath.Base(c.path):
+		return true
+	}
+
+	// temporary script for the command
+	return strings.HasPrefix(filepath.Base(f.file), c.name+"_") && strings.Contains(f.file, "/.tmp/")
+}
+
+// the lines of the script referenced in the error output, starting at 1
+func (c *command) errorLines(stdErr string, lang *Language) (lines []int) {
+
+	for _, f := range lang.stackFrames(stdErr) {
+		if !c.ownsFrame(f, lang) {
+			continue
+		}
+
+		// some scripting languages return a line number
+		// thats one line below the real error line
+		if lang.CorrectErrLineNumber {
+			f.line--
+		}
+
+		lines = append(lines, f.line)
+	}
+	return
+}
+
+// number of lines zeus inserts in front of the exec of a command:
+// the bang, the globals, the global code and the arguments
+// scripts from files are run as they are
+func (c *command) preamble(script string) int {
+	if c.exec == "" || !strings.HasSuffix(script, c.exec) {
+		return 0
+	}
+	return strings.Count(strings.TrimSuffix(script, c.exec), "\n")
+}
+
+// line of the CommandsFile with the given line of the exec of a command, starting at 1
+// returns 0 if the exec of the command is not from the CommandsFile
+func (c *command) commandsFileLine(line int) int {
+
+	if c.exec == "" {
+		return 0
+	}
+
+	contents, err := ioutil.ReadFile(commandsFilePath)
+	if err != nil {
+		return 0
+	}
+
+	cmd, ok := parseOutline(string(contents)).commands[c.name]
+	if !ok {
+		return 0
+	}
+
+	// commands imported from other build systems can have the same name
+	exec := cmd.field("exec")
+	if exec == nil || exec.Value != c.exec {
+		return 0
+	}
+
+	switch exec.Style {
+	case yamlv3.LiteralStyle, yamlv3.FoldedStyle:
+		// the block starts in the line after the indicator
+		return exec.Line + line
+	default:
+		if line != 1 {
+			return 0
+		}
+		return exec.Line
+	}
+}
+
+// the locations of the lines from the error output in the source of the command, in the file:line format
+// lines in the exec are translated to the CommandsFile, lines inserted by zeus are skipped
+func (c *command) errorLocations(script string, lines []int) (locations []string) {
+
+	preamble := c.preamble(script)
+
+	for _, n := range lines {
+
+		n -= preamble
+		if n < 1 {
+			continue
+		}
+
+		if c.exec == "" {
+			locations = append(locations, c.path+":"+strconv.Itoa(n))
+			continue
+		}
+		if line := c.commandsFileLine(n); line > 0 {
+			locations = append(locations, commandsFilePath+":"+strconv.Itoa(line))
+		}
+	}
+	return
+}
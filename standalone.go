@@ -0,0 +1,342 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// delimiter of the heredocs containing the scripts
+// scripts are quoted, nothing inside of them is expanded by the runner
+const standaloneEOF = "ZEUS_SCRIPT_EOF"
+
+func printExportStandaloneUsageErr() {
+	l.Println(ErrInvalidUsage)
+	l.Println("usage: export standalone <command> [" + exportFlagOutput + " <file>]")
+}
+
+// handle export standalone
+// writes a single bash script that runs the command and its dependencies without zeus
+func handleExportStandaloneCommand(args []string) error {
+
+	var (
+		name   string
+		output string
+	)
+	for i := 2; i < len(args); i++ {
+		switch {
+		case args[i] == exportFlagOutput && i+1 < len(args):
+			output = args[i+1]
+			i++
+		case name == "":
+			name = args[i]
+		default:
+			printExportStandaloneUsageErr()
+			return ErrInvalidUsage
+		}
+	}
+	if name == "" {
+		printExportStandaloneUsageErr()
+		return ErrInvalidUsage
+	}
+
+	cmd, err := cmdMap.getCommand(name)
+	if err != nil {
+		return err
+	}
+
+	contents, err := generateStandalone(cmd)
+	if err != nil {
+		return err
+	}
+
+	if output == "-" {
+		os.Stdout.WriteString(contents)
+		return nil
+	}
+	if output == "" {
+		output = filepath.Join(zeusDir, "generated", cmd.name+"-standalone.sh")
+	}
+
+	err = os.MkdirAll(filepath.Dir(output), 0700)
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(output, []byte(contents), 0700)
+	if err != nil {
+		return err
+	}
+
+	l.Println("exported standalone runner for " + cmd.name + " to " + output)
+	return nil
+}
+
+// generate a bash script reproducing the command and its dependency chain
+// globals are inlined, the arguments of the command are parsed from flags
+func generateStandalone(cmd *command) (string, error) {
+
+	deps, err := validDeepDependencies(cmd)
+	if err != nil {
+		return "", err
+	}
+
+	var (
+		b     bytes.Buffer
+		names []string
+	)
+	for name := range cmd.args {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	b.WriteString("#!/usr/bin/env bash\n")
+	b.WriteString("# standalone runner for the " + cmd.name + " command, generated by ZEUS v" + version)
+	if !reproducible() {
+		b.WriteString(" @ " + artifactTime().Format(timestampFormat))
+	}
+	b.WriteString("\n# runs the command and its dependencies without zeus\n\n")
+	b.WriteString("set -e\n\n")
+
+	// usage
+	b.WriteString("usage() {\n")
+	b.WriteString("\techo \"usage: $0\"" + shellQuote(standaloneFlagUsage(cmd, names)) + "\n")
+	if cmd.description != "" {
+		b.WriteString("\techo " + shellQuote(cmd.description) + "\n")
+	}
+	b.WriteString("}\n\n")
+
+	// globals are passed to all scripts in the environment, just like zeus does
+	g.Lock()
+	if len(g.Vars) > 0 {
+		b.WriteString("# globals\n")
+		for _, name := range sortedKeys(g.Vars) {
+			// templates are executed now, command substitutions are evaluated when the script starts
+			value, err := renderTemplate(g.Vars[name])
+			if err != nil {
+				Log.WithError(err).Warn("failed to execute template of global " + name)
+				value = g.Vars[name]
+			}
+			if strings.Contains(value, commandSubstitution) {
+				b.WriteString("export " + name + "=\"" + value + "\"\n")
+				continue
+			}
+			b.WriteString("export " + name + "=" + shellQuote(value) + "\n")
+		}
+		b.WriteString("\n")
+	}
+	g.Unlock()
+
+	// flags
+	for _, name := range names {
+		b.WriteString(name + "=\n")
+	}
+	b.WriteString("while [ $# -gt 0 ]; do\n")
+	b.WriteString("\tcase \"$1\" in\n")
+	for _, name := range names {
+		b.WriteString("\t\t--" + name + ") [ $# -gt 1 ] || { echo \"missing value for $1\" >&2; exit 1; }; " + name + "=\"$2\"; shift 2 ;;\n")
+		b.WriteString("\t\t--" + name + "=*) " + name + "=\"${1#*=}\"; shift ;;\n")
+	}
+	b.WriteString("\t\t-h|--help) usage; exit 0 ;;\n")
+	b.WriteString("\t\t*) echo \"unknown argument: $1\" >&2; usage >&2; exit 1 ;;\n")
+	b.WriteString("\tesac\n")
+	b.WriteString("done\n\n")
+
+	for _, name := range names {
+		b.WriteString(standaloneArgCheck(cmd.args[name]))
+	}
+	if len(names) > 0 {
+		b.WriteString("\n")
+	}
+
+	b.WriteString("ZEUS_TMP=$(mktemp -d)\n")
+	b.WriteString("trap 'rm -rf \"$ZEUS_TMP\"' EXIT\n\n")
+
+	// dependencies with their arguments, in the order zeus runs them
+	for i, dep := range deps {
+
+		fields := strings.Fields(dep)
+		if len(fields) == 0 {
+			return "", ErrEmptyDependency
+		}
+
+		depCmd, err := cmdMap.getCommand(fields[0])
+		if err != nil {
+			return "", errors.New("invalid dependency: " + err.Error())
+		}
+
+		var arguments string
+		if len(depCmd.args) > 0 {
+			arguments, err = depCmd.parseArguments(fields[1:])
+			if err != nil {
+				return "", errors.New("dependency " + dep + ": " + err.Error())
+			}
+		}
+
+		err = writeStandaloneStep(&b, depCmd, "dependency_"+strconv.Itoa(i+1), arguments, "")
+		if err != nil {
+			return "", err
+		}
+	}
+
+	// the values of the arguments are only known when the runner is executed
+	lang, err := cmd.getLanguage()
+	if err != nil {
+		return "", err
+	}
+	var assignments []string
+	for _, name := range names {
+		assignments = append(assignments, lang.VariableKeyword+name+lang.AssignmentOperator+"$"+name+lang.LineDelimiter)
+	}
+
+	err = writeStandaloneStep(&b, cmd, "command", "", strings.Join(assignments, "\n"))
+	if err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
+
+// write a step running the script of a command with its interpreter
+// static arguments go into the quoted script, dynamic ones are expanded by the runner
+func writeStandaloneStep(b *bytes.Buffer, cmd *command, id, arguments, dynamicArguments string) error {
+
+	lang, err := cmd.getLanguage()
+	if err != nil {
+		return errors.New(cmd.name + ": " + err.Error() + ": " + cmd.language)
+	}
+
+	script := cmd.exec
+	if script == "" {
+		c, err := ioutil.ReadFile(cmd.path)
+		if err != nil {
+			return err
+		}
+		script = string(c)
+	}
+	if strings.HasPrefix(script, "#!") {
+		script = script[strings.Index(script+"\n", "\n")+1:]
+	}
+
+	var (
+		file        = "\"$ZEUS_TMP/" + id + lang.FileExtension + "\""
+		interpreter = []string{lang.Interpreter}
+	)
+	conf.Lock()
+	if conf.fields.StopOnError && lang.FlagStopOnError != "" {
+		interpreter = append(interpreter, lang.FlagStopOnError)
+	}
+	conf.Unlock()
+
+	b.WriteString("# " + cmd.name + "\n")
+
+	// commands are skipped if all their outputs exist
+	indent := ""
+	if len(cmd.outputs) > 0 {
+		var checks []string
+		for _, o := range cmd.outputs {
+			checks = append(checks, "[ -e "+shellQuote(o)+" ]")
+		}
+		b.WriteString("if " + strings.Join(checks, " && ") + "; then\n")
+		b.WriteString("\techo " + shellQuote("skipping "+cmd.name+" because all named outputs exist") + "\n")
+		b.WriteString("else\n")
+		indent = "\t"
+	}
+
+	b.WriteString(indent + "echo " + shellQuote("executing "+cmd.name) + "\n")
+	b.WriteString(indent + "{\n")
+	if dynamicArguments != "" {
+		b.WriteString(indent + "\tcat <<" + standaloneEOF + "\n" + dynamicArguments + "\n" + standaloneEOF + "\n")
+	}
+	b.WriteString(indent + "\tcat <<'" + standaloneEOF + "'\n")
+
+	// language specific globals and global code, just like zeus generates them
+	b.WriteString(generateGlobals(lang, cmd))
+	if code, err := ioutil.ReadFile(zeusDir + "/globals/globals" + lang.FileExtension); err == nil {
+		b.Write(code)
+		b.WriteString("\n")
+	}
+	b.WriteString(arguments)
+	b.WriteString(strings.TrimRight(script, "\n") + "\n")
+
+	b.WriteString(standaloneEOF + "\n")
+	b.WriteString(indent + "} > " + file + "\n")
+	b.WriteString(indent + strings.Join(interpreter, " ") + " " + file + "\n")
+	if indent != "" {
+		b.WriteString("fi\n")
+	}
+	b.WriteString("\n")
+
+	return nil
+}
+
+// describe the flags of the runner for the usage message
+func standaloneFlagUsage(cmd *command, names []string) (out string) {
+	for _, name := range names {
+		arg := cmd.args[name]
+		flag := "--" + name + " <" + strings.Title(arg.argType.String()) + ">"
+		if arg.optional {
+			flag = "[" + flag + "]"
+		}
+		out += " " + flag
+	}
+	return
+}
+
+// apply the default value, make sure required arguments are set and validate the type
+func standaloneArgCheck(arg *commandArg) string {
+
+	var (
+		b   bytes.Buffer
+		ref = "\"$" + arg.name + "\""
+	)
+
+	if arg.optional {
+		value := arg.defaultValue
+		if value == "" {
+			value = getDefaultValue(arg)
+		}
+		b.WriteString("[ -n " + ref + " ] || " + arg.name + "=" + shellQuote(strings.TrimSpace(value)) + "\n")
+	} else {
+		b.WriteString("[ -n " + ref + " ] || { echo \"missing argument: --" + arg.name + "\" >&2; usage >&2; exit 1; }\n")
+	}
+
+	var pattern string
+	switch arg.argType {
+	case reflect.Int:
+		pattern = "^-?[0-9]+$"
+	case reflect.Float64:
+		pattern = "^-?[0-9]*\\.?[0-9]+$"
+	case reflect.Bool:
+		pattern = "^(true|false)$"
+	}
+	if pattern != "" {
+		b.WriteString("[[ " + ref + " =~ " + pattern + " ]] || { echo \"invalid value for --" + arg.name + ": $" + arg.name + "\" >&2; exit 1; }\n")
+	}
+
+	return b.String()
+}
@@ -0,0 +1,155 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// flags of the serve builtin for the static file server
+const (
+	staticFlagDir  = "--static"
+	staticFlagPort = "--port"
+	staticFlagSPA  = "--spa"
+
+	defaultStaticPort = 8000
+)
+
+var (
+	// ErrNoStaticDir occurs when a serve section has no directory
+	ErrNoStaticDir = errors.New("serve needs a dir to serve files from")
+
+	// ErrServeWithScript occurs when a command has a serve section and a script
+	ErrServeWithScript = errors.New("serve can not be combined with exec or path")
+)
+
+// staticServerData is the serve section of a command in the CommandsFile
+// the command runs the built-in static file server instead of a script
+type staticServerData struct {
+
+	// directory to serve
+	Dir string `yaml:"dir"`
+
+	// port to listen on, defaults to 8000
+	Port int `yaml:"port"`
+
+	// serve index.html for all paths that do not exist, for single page applications
+	SPA bool `yaml:"spa"`
+}
+
+// the script for a command with a serve section
+// it runs zeus itself, so the server is a regular process that can be managed with the procs builtin
+func (d *staticServerData) script() (string, error) {
+
+	if d.Dir == "" {
+		return "", ErrNoStaticDir
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+
+	port := d.Port
+	if port == 0 {
+		port = defaultStaticPort
+	}
+
+	args := []string{shellQuote(exe), serveCommand, staticFlagDir, shellQuote(d.Dir), staticFlagPort, strconv.Itoa(port)}
+	if d.SPA {
+		args = append(args, staticFlagSPA)
+	}
+
+	return "exec " + strings.Join(args, " ") + "\n", nil
+}
+
+// parse the arguments of the serve builtin for the static file server:
+// serve --static <dir> [--port <port>] [--spa]
+func parseStaticServerArgs(args []string) (*staticServerData, error) {
+
+	if len(args) < 3 || args[0] != serveCommand || args[1] != staticFlagDir {
+		return nil, ErrInvalidUsage
+	}
+
+	d := &staticServerData{
+		Dir:  args[2],
+		Port: defaultStaticPort,
+	}
+
+	for i := 3; i < len(args); i++ {
+		switch args[i] {
+		case staticFlagSPA:
+			d.SPA = true
+		case staticFlagPort:
+			if i+1 == len(args) {
+				return nil, ErrInvalidUsage
+			}
+			port, err := strconv.Atoi(args[i+1])
+			if err != nil {
+				return nil, errors.New("invalid port: " + args[i+1])
+			}
+			d.Port = port
+			i++
+		default:
+			return nil, ErrInvalidUsage
+		}
+	}
+
+	return d, nil
+}
+
+// handler for the static file server
+// with spa enabled, index.html is served for all paths that do not exist
+func staticHandler(dir string, spa bool) http.Handler {
+
+	files := http.FileServer(http.Dir(dir))
+	if !spa {
+		return files
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := os.Stat(filepath.Join(dir, filepath.FromSlash(path.Clean("/"+r.URL.Path))))
+		if os.IsNotExist(err) {
+			http.ServeFile(w, r, filepath.Join(dir, "index.html"))
+			return
+		}
+		files.ServeHTTP(w, r)
+	})
+}
+
+// serve the files of a directory until the process is stopped
+func serveStatic(d *staticServerData) error {
+
+	stat, err := os.Stat(d.Dir)
+	if err != nil {
+		return err
+	}
+	if !stat.IsDir() {
+		return errors.New(d.Dir + " is not a directory")
+	}
+
+	l.Println(cp.Text + "serving " + cp.Prompt + d.Dir + cp.Text + " on " + cp.Prompt + "http://localhost:" + strconv.Itoa(d.Port) + cp.Reset)
+	return http.ListenAndServe(":"+strconv.Itoa(d.Port), staticHandler(d.Dir, d.SPA))
+}
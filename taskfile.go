@@ -0,0 +1,353 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+var (
+	// ErrNoTasks means the Taskfile does not contain any tasks
+	ErrNoTasks = errors.New("no tasks found in Taskfile")
+
+	// file names go-task looks for
+	taskfileNames = []string{"Taskfile.yml", "Taskfile.yaml", "taskfile.yml", "taskfile.yaml"}
+
+	// {{.VAR}} references of the go template syntax
+	taskfileVar      = regexp.MustCompile("\\{\\{\\s*\\.([A-Za-z_][A-Za-z0-9_]*)\\s*\\}\\}")
+	taskfileTemplate = regexp.MustCompile("\\{\\{[^}]*\\}\\}")
+
+	// task fields that are translated
+	taskfileFields = map[string]bool{
+		"desc":      true,
+		"summary":   true,
+		"deps":      true,
+		"cmds":      true,
+		"sources":   true,
+		"generates": true,
+		"env":       true,
+		"vars":      true,
+		"dir":       true,
+		"silent":    true,
+	}
+)
+
+// Taskfile fields used for the migration
+type taskfile struct {
+	Vars     yaml.MapSlice `yaml:"vars"`
+	Env      yaml.MapSlice `yaml:"env"`
+	Includes yaml.MapSlice `yaml:"includes"`
+	Dotenv   []string      `yaml:"dotenv"`
+	Tasks    yaml.MapSlice `yaml:"tasks"`
+}
+
+// a task of a Taskfile
+type taskfileTask struct {
+	Desc      string        `yaml:"desc"`
+	Summary   string        `yaml:"summary"`
+	Deps      []interface{} `yaml:"deps"`
+	Cmds      []interface{} `yaml:"cmds"`
+	Sources   []string      `yaml:"sources"`
+	Generates []string      `yaml:"generates"`
+	Env       yaml.MapSlice `yaml:"env"`
+	Vars      yaml.MapSlice `yaml:"vars"`
+	Dir       string        `yaml:"dir"`
+}
+
+// migrate the tasks of a Taskfile into a zeus command folder
+func migrateTaskfile(zeusDirectory, policy string) {
+
+	Log.WithField("dir", zeusDirectory).Info("Taskfile migration started.")
+
+	var (
+		contents []byte
+		name     string
+		err      error
+	)
+	for _, name = range taskfileNames {
+		contents, err = ioutil.ReadFile(name)
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		Log.WithError(err).Error("unable to read Taskfile")
+		return
+	}
+
+	m, err := translateTaskfile(contents, name)
+	if err != nil {
+		l.Println(err)
+		return
+	}
+
+	err = m.write(zeusDirectory, policy)
+	if err != nil {
+		l.Println(err)
+	}
+}
+
+// translate the tasks of a Taskfile into globals and commands
+func translateTaskfile(contents []byte, source string) (*migration, error) {
+
+	var (
+		t taskfile
+		m = newMigration(source)
+	)
+
+	err := yaml.Unmarshal(contents, &t)
+	if err != nil {
+		return nil, errors.New("failed to parse " + source + ": " + err.Error())
+	}
+
+	if len(t.Tasks) == 0 {
+		return nil, ErrNoTasks
+	}
+
+	// vars and env are both available in all tasks
+	for _, section := range []yaml.MapSlice{t.Vars, t.Env} {
+		for _, item := range section {
+			name := fmt.Sprint(item.Key)
+			value, ok := taskfileValue(item.Value)
+			if !ok {
+				m.note(0, "variable "+name+" has an unsupported value")
+				continue
+			}
+			if _, exists := m.globals[name]; !exists {
+				m.globalNames = append(m.globalNames, name)
+			}
+			m.globals[name] = m.translateTemplate(value)
+		}
+	}
+
+	for _, item := range t.Includes {
+		m.note(0, "included Taskfile: "+fmt.Sprint(item.Key))
+	}
+	for _, file := range t.Dotenv {
+		m.note(0, "dotenv file: "+file)
+	}
+
+	for _, item := range t.Tasks {
+
+		name := fmt.Sprint(item.Key)
+
+		c, err := translateTask(name, item.Value)
+		if err != nil {
+			return nil, err
+		}
+		m.commands = append(m.commands, c)
+	}
+
+	return m, nil
+}
+
+// translate a single task into a command
+// a task can be declared as a string, a list of commands or a map
+func translateTask(name string, value interface{}) (*migratedCommand, error) {
+
+	var (
+		task taskfileTask
+		c    = &migratedCommand{
+			name:        migratedCommandName(name),
+			description: "migrated from task " + name,
+		}
+	)
+
+	switch v := value.(type) {
+	case string:
+		task.Cmds = []interface{}{v}
+	case []interface{}:
+		task.Cmds = v
+	case yaml.MapSlice, map[interface{}]interface{}:
+
+		// remarshal to get the typed fields
+		out, err := yaml.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		err = yaml.Unmarshal(out, &task)
+		if err != nil {
+			return nil, errors.New("task " + name + ": " + err.Error())
+		}
+
+		var keys yaml.MapSlice
+		yaml.Unmarshal(out, &keys)
+		for _, k := range keys {
+			if !taskfileFields[fmt.Sprint(k.Key)] {
+				c.notes = append(c.notes, "task field "+fmt.Sprint(k.Key))
+			}
+		}
+	}
+
+	switch {
+	case task.Desc != "":
+		c.description = task.Desc
+	case task.Summary != "":
+		c.description = strings.SplitN(strings.TrimSpace(task.Summary), "\n", 2)[0]
+	}
+
+	for _, dep := range task.Deps {
+		switch d := dep.(type) {
+		case string:
+			c.dependencies = append(c.dependencies, migratedCommandName(d))
+		default:
+			if t, ok := taskfileMapValue(d, "task"); ok {
+				c.dependencies = append(c.dependencies, migratedCommandName(t))
+				if _, ok := taskfileMapValue(d, "vars"); ok {
+					c.notes = append(c.notes, "variables passed to dependency "+t)
+				}
+			} else {
+				c.notes = append(c.notes, "dependency "+fmt.Sprint(d))
+			}
+		}
+	}
+
+	// sources are watched by task to decide if the task is up to date
+	for _, s := range task.Sources {
+		c.inputs = append(c.inputs, c.translateTemplate(s))
+	}
+	for _, g := range task.Generates {
+		c.outputs = append(c.outputs, c.translateTemplate(g))
+	}
+
+	if task.Dir != "" {
+		c.script = append(c.script, "cd "+shellDoubleQuote(c.translateTemplate(task.Dir))+" || exit 1")
+	}
+	for _, item := range task.Vars {
+		if value, ok := taskfileValue(item.Value); ok {
+			c.script = append(c.script, fmt.Sprint(item.Key)+"="+shellDoubleQuote(c.translateTemplate(value)))
+		} else {
+			c.notes = append(c.notes, "variable "+fmt.Sprint(item.Key)+" has an unsupported value")
+		}
+	}
+	for _, item := range task.Env {
+		if value, ok := taskfileValue(item.Value); ok {
+			c.script = append(c.script, "export "+fmt.Sprint(item.Key)+"="+shellDoubleQuote(c.translateTemplate(value)))
+		} else {
+			c.notes = append(c.notes, "environment variable "+fmt.Sprint(item.Key)+" has an unsupported value")
+		}
+	}
+
+	var deferred []string
+	for _, cmd := range task.Cmds {
+		switch v := cmd.(type) {
+		case string:
+			c.script = append(c.script, c.translateTemplate(v))
+		default:
+			if t, ok := taskfileMapValue(v, "task"); ok {
+				c.script = append(c.script, "zeus "+migratedCommandName(t))
+			} else if s, ok := taskfileMapValue(v, "cmd"); ok {
+				line := c.translateTemplate(s)
+				if ignore, _ := taskfileMapValue(v, "ignore_error"); ignore == "true" {
+					line += " || true"
+				}
+				c.script = append(c.script, line)
+			} else if s, ok := taskfileMapValue(v, "defer"); ok {
+				deferred = append(deferred, c.translateTemplate(s))
+			} else {
+				c.notes = append(c.notes, "command "+fmt.Sprint(v))
+			}
+		}
+	}
+	if len(deferred) > 0 {
+		// deferred commands run in reverse order when the task exits
+		for i, j := 0, len(deferred)-1; i < j; i, j = i+1, j-1 {
+			deferred[i], deferred[j] = deferred[j], deferred[i]
+		}
+		c.script = append([]string{"trap " + shellDoubleQuote(strings.Join(deferred, "; ")) + " EXIT"}, c.script...)
+	}
+
+	return c, nil
+}
+
+// translate the go template variables of a global
+func (m *migration) translateTemplate(s string) string {
+	s, unsupported := translateTaskfileTemplate(s)
+	for _, u := range unsupported {
+		m.note(0, "template "+u)
+	}
+	return s
+}
+
+// translate the go template variables of a command
+func (c *migratedCommand) translateTemplate(s string) string {
+	s, unsupported := translateTaskfileTemplate(s)
+	for _, u := range unsupported {
+		c.notes = append(c.notes, "template "+u)
+	}
+	return s
+}
+
+// replace {{.VAR}} with ${VAR}, CLI_ARGS are passed as arguments
+// returns the templates that could not be translated
+func translateTaskfileTemplate(s string) (string, []string) {
+
+	s = taskfileVar.ReplaceAllStringFunc(s, func(v string) string {
+		name := taskfileVar.FindStringSubmatch(v)[1]
+		if name == "CLI_ARGS" {
+			return "$@"
+		}
+		return "${" + name + "}"
+	})
+
+	return s, taskfileTemplate.FindAllString(s, -1)
+}
+
+// get the value of a variable, dynamic variables are evaluated by the shell
+func taskfileValue(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case int, float64, bool:
+		return fmt.Sprint(v), true
+	default:
+		if sh, ok := taskfileMapValue(v, "sh"); ok {
+			return "$(" + sh + ")", true
+		}
+	}
+	return "", false
+}
+
+// look up a key of a YAML map
+func taskfileMapValue(value interface{}, key string) (string, bool) {
+	switch v := value.(type) {
+	case yaml.MapSlice:
+		for _, item := range v {
+			if fmt.Sprint(item.Key) == key {
+				return fmt.Sprint(item.Value), true
+			}
+		}
+	case map[interface{}]interface{}:
+		if item, ok := v[key]; ok {
+			return fmt.Sprint(item), true
+		}
+	}
+	return "", false
+}
+
+// quote s in double quotes for the shell, variables and subshells are still expanded
+func shellDoubleQuote(s string) string {
+	return "\"" + strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "`", "\\`").Replace(s) + "\""
+}
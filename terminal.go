@@ -0,0 +1,213 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/dreadl0ck/readline"
+)
+
+// used when the width of the terminal cannot be determined
+const defaultTerminalWidth = 80
+
+// width of the terminal attached to stdout, 0 if unknown
+// updated when the terminal is resized
+var termWidth int64
+
+// query the width of the terminal attached to stdout
+func updateTerminalWidth() int {
+	w, _, err := readline.GetSize(int(os.Stdout.Fd()))
+	if err != nil || w < 0 {
+		w = 0
+	}
+	atomic.StoreInt64(&termWidth, int64(w))
+	return w
+}
+
+// update the terminal width whenever the terminal is resized
+func watchTerminalSize() {
+
+	updateTerminalWidth()
+
+	resize := make(chan os.Signal, 1)
+	signal.Notify(resize, syscall.SIGWINCH)
+
+	go func() {
+		for range resize {
+			updateTerminalWidth()
+		}
+	}()
+}
+
+// width of the terminal attached to stdout
+func terminalWidth() int {
+	if w := int(atomic.LoadInt64(&termWidth)); w > 0 {
+		return w
+	}
+	if w := updateTerminalWidth(); w > 0 {
+		return w
+	}
+	return defaultTerminalWidth
+}
+
+// shorten a text to the given number of characters
+func truncate(text string, length int) string {
+	r := []rune(text)
+	if len(r) <= length {
+		return text
+	}
+	if length < 1 {
+		return ""
+	}
+	cut := []rune(marker("…", cutMarker))
+	if length <= len(cut) {
+		return string(r[:length])
+	}
+	return string(r[:length-len(cut)]) + string(cut)
+}
+
+// shorten a line with color codes to the width of the terminal
+// the color codes do not count, the colors are reset after a cut
+func fitLine(line string) string {
+
+	width := terminalWidth()
+	if visibleLength(line) <= width {
+		return line
+	}
+
+	var (
+		visible int
+		escape  bool
+		out     strings.Builder
+	)
+	for _, r := range line {
+		switch {
+		case escape:
+			escape = !isLetter(r)
+		case r == '\x1b':
+			escape = true
+		default:
+			if visible == width-len([]rune(marker("…", cutMarker))) {
+				return out.String() + marker("…", cutMarker) + cp.Reset
+			}
+			visible++
+		}
+		out.WriteRune(r)
+	}
+	return out.String()
+}
+
+// number of characters of a line, without color codes
+func visibleLength(line string) (n int) {
+	var escape bool
+	for _, r := range line {
+		switch {
+		case escape:
+			// color codes end with a letter
+			escape = !isLetter(r)
+		case r == '\x1b':
+			escape = true
+		default:
+			n++
+		}
+	}
+	return
+}
+
+// remove the color codes from a line
+func stripANSI(line string) string {
+	var (
+		escape bool
+		out    strings.Builder
+	)
+	for _, r := range line {
+		switch {
+		case escape:
+			escape = !isLetter(r)
+		case r == '\x1b':
+			escape = true
+		default:
+			out.WriteRune(r)
+		}
+	}
+	return out.String()
+}
+
+func isLetter(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z'
+}
+
+// break a text into lines that fit the given width, at spaces where possible
+// lines that fit are kept as they are, continuation lines are prefixed with indent
+func wrapText(text string, width int, indent string) string {
+
+	var out []string
+	for i, paragraph := range strings.Split(text, "\n") {
+
+		prefix := ""
+		if i > 0 {
+			prefix = indent
+		}
+		if len([]rune(prefix+paragraph)) <= width {
+			out = append(out, prefix+paragraph)
+			continue
+		}
+
+		var line string
+		for _, word := range strings.Fields(paragraph) {
+			switch {
+			case line == "":
+				line = word
+			case len([]rune(prefix+line+" "+word)) <= width:
+				line += " " + word
+			default:
+				out = append(out, prefix+line)
+				prefix, line = indent, word
+			}
+
+			// split words that are too long on their own
+			for len([]rune(prefix+line)) > width && width > len([]rune(prefix))+1 {
+				r := []rune(line)
+				n := width - len([]rune(prefix))
+				out = append(out, prefix+string(r[:n]))
+				prefix, line = indent, string(r[n:])
+			}
+		}
+		out = append(out, prefix+line)
+	}
+	return strings.Join(out, "\n")
+}
+
+// a horizontal line between the left and right edge, as wide as the terminal
+// empty in accessible mode
+func ruler(left, fill, right string) string {
+	if accessible() {
+		return ""
+	}
+	n := terminalWidth() - len(left) - len(right)
+	if n < 1 {
+		n = 1
+	}
+	return left + strings.Repeat(fill, n) + right
+}
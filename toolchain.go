@@ -0,0 +1,619 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// downloads of large tools like node take a while on slow connections
+const toolDownloadTimeout = 10 * time.Minute
+
+var (
+	// ErrUnknownTool means a tool in the toolchain has no url and there is no recipe for it
+	ErrUnknownTool = errors.New("unknown tool, declare the url to download it from")
+
+	// ErrMissingToolVersion means a tool in the toolchain is not pinned to a version
+	ErrMissingToolVersion = errors.New("missing version")
+
+	// ErrChecksumMismatch means a downloaded tool does not match its checksum
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+
+	// ErrUnsafeArchivePath means an archive contains a file outside of the directory it is extracted to
+	ErrUnsafeArchivePath = errors.New("unsafe path in archive")
+
+	// the tools pinned in the CommandsFile
+	projectToolchain = &toolchain{
+		items: make(map[string]*toolData, 0),
+	}
+
+	// the PATH zeus was started with, the toolchain is prepended to it
+	originalPath = os.Getenv("PATH")
+
+	// download locations of well known tools
+	// {version}, {os} and {arch} are replaced when the tool is downloaded
+	toolRecipes = map[string]*toolData{
+		"shfmt": {
+			URL: "https://github.com/mvdan/sh/releases/download/v{version}/shfmt_v{version}_{os}_{arch}",
+			Bin: []string{"shfmt"},
+		},
+		"golangci-lint": {
+			URL: "https://github.com/golangci/golangci-lint/releases/download/v{version}/golangci-lint-{version}-{os}-{arch}.tar.gz",
+			Bin: []string{"golangci-lint-{version}-{os}-{arch}/golangci-lint"},
+		},
+		"node": {
+			URL:  "https://nodejs.org/dist/v{version}/node-v{version}-{os}-{arch}.tar.gz",
+			Bin:  []string{"node-v{version}-{os}-{arch}/bin/node", "node-v{version}-{os}-{arch}/bin/npm", "node-v{version}-{os}-{arch}/bin/npx"},
+			Arch: map[string]string{"amd64": "x64", "386": "x86"},
+		},
+	}
+)
+
+type toolchain struct {
+	items map[string]*toolData
+	sync.Mutex
+}
+
+// toolData contains the pinned version of a tool and where to get it
+// a tool can be declared with its version only, when there is a recipe for it
+type toolData struct {
+
+	// pinned version
+	Version string `yaml:"version"`
+
+	// download url, a single executable, a .tar.gz, .tgz or .zip archive
+	URL string `yaml:"url"`
+
+	// executables in the download, linked into the bin directory of the toolchain
+	Bin []string `yaml:"bin"`
+
+	// names of the architectures in the url, if they differ from the go names
+	Arch map[string]string `yaml:"arch"`
+
+	// sha256 checksums of the downloads per platform, for example linux-amd64
+	Checksums map[string]string `yaml:"checksums"`
+}
+
+// UnmarshalYAML accepts the version as a plain value
+func (t *toolData) UnmarshalYAML(unmarshal func(interface{}) error) error {
+
+	var version string
+	if err := unmarshal(&version); err == nil {
+		t.Version = version
+		return nil
+	}
+
+	type plain toolData
+	return unmarshal((*plain)(t))
+}
+
+// the entries of the lock file
+// checksums of tools without declared checksums are recorded on the first download
+type toolLock struct {
+	Version   string            `yaml:"version"`
+	Checksums map[string]string `yaml:"checksums"`
+}
+
+func toolchainDir() string {
+	return filepath.Join(zeusDir, ".toolchain")
+}
+
+func toolchainBinDir() string {
+	return filepath.Join(toolchainDir(), "bin")
+}
+
+func toolchainLockPath() string {
+	return filepath.Join(zeusDir, "toolchain.lock")
+}
+
+// the platform of the machine, used as the key for the checksums
+func toolPlatform() string {
+	return runtime.GOOS + "-" + runtime.GOARCH
+}
+
+func printToolchainCommandUsageErr() {
+	l.Println(ErrInvalidUsage)
+	l.Println("usage: toolchain [install [<tool> ...] | clean]")
+}
+
+// set the toolchain declared in the CommandsFile
+// the recipes fill in the fields that are not declared
+// the bin directory of the toolchain is put in front of the PATH, for zeus and the commands it runs
+func initToolchain(tools map[string]*toolData) error {
+
+	items := make(map[string]*toolData, len(tools))
+	for name, d := range tools {
+
+		if d == nil || strings.TrimSpace(d.Version) == "" {
+			return errors.New(ErrMissingToolVersion.Error() + ": " + name)
+		}
+
+		t := *d
+		if r, ok := toolRecipes[name]; ok {
+			if t.URL == "" {
+				t.URL = r.URL
+			}
+			if len(t.Bin) == 0 {
+				t.Bin = r.Bin
+			}
+			if t.Arch == nil {
+				t.Arch = r.Arch
+			}
+		}
+		if t.URL == "" {
+			return errors.New(ErrUnknownTool.Error() + ": " + name)
+		}
+		if len(t.Bin) == 0 {
+			t.Bin = []string{name}
+		}
+		t.Version = strings.TrimSpace(t.Version)
+		items[name] = &t
+	}
+
+	projectToolchain.Lock()
+	projectToolchain.items = items
+	projectToolchain.Unlock()
+
+	if len(items) == 0 {
+		return os.Setenv("PATH", originalPath)
+	}
+
+	bin, err := filepath.Abs(toolchainBinDir())
+	if err != nil {
+		return err
+	}
+	return os.Setenv("PATH", bin+string(os.PathListSeparator)+originalPath)
+}
+
+// the names of the tools in the toolchain, sorted
+func (t *toolchain) names() (names []string) {
+	t.Lock()
+	defer t.Unlock()
+	for name := range t.items {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
+
+func (t *toolchain) get(name string) (*toolData, bool) {
+	t.Lock()
+	defer t.Unlock()
+	d, ok := t.items[name]
+	return d, ok
+}
+
+// replace the placeholders in a url or a bin path
+func (t *toolData) expand(s string) string {
+
+	arch := runtime.GOARCH
+	if a, ok := t.Arch[arch]; ok {
+		arch = a
+	}
+
+	return strings.NewReplacer(
+		"{version}", t.Version,
+		"{os}", runtime.GOOS,
+		"{arch}", arch,
+	).Replace(s)
+}
+
+// directory the version of the tool is installed to
+func (t *toolData) dir(name string) string {
+	return filepath.Join(toolchainDir(), name, t.Version)
+}
+
+// check if the pinned version of the tool is installed and linked
+func (t *toolData) installed(name string) bool {
+	for _, b := range t.Bin {
+		target := filepath.Join(t.dir(name), t.expand(b))
+		link := filepath.Join(toolchainBinDir(), filepath.Base(target))
+
+		dest, err := os.Readlink(link)
+		if err != nil {
+			return false
+		}
+		if !filepath.IsAbs(dest) {
+			dest = filepath.Join(toolchainBinDir(), dest)
+		}
+		if filepath.Clean(dest) != filepath.Clean(target) {
+			return false
+		}
+		if _, err := os.Stat(target); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// install the tools of the toolchain that are missing
+// called before a command runs, so a fresh checkout gets its tools on the first run
+func ensureToolchain() error {
+	for _, name := range projectToolchain.names() {
+		t, ok := projectToolchain.get(name)
+		if !ok || t.installed(name) {
+			continue
+		}
+		err := installTool(name, t)
+		if err != nil {
+			return errors.New("failed to install " + name + " " + t.Version + ": " + err.Error())
+		}
+	}
+	return nil
+}
+
+// download, verify and link the pinned version of a tool
+func installTool(name string, t *toolData) error {
+
+	url := t.expand(t.URL)
+	l.Println(cp.Text + "installing " + cp.Prompt + name + " " + t.Version + cp.Text + " from " + url + cp.Reset)
+
+	tmp, err := ioutil.TempFile("", "zeus-toolchain-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	sum, err := downloadTool(url, tmp)
+	if err != nil {
+		return err
+	}
+
+	err = verifyTool(name, t, sum)
+	if err != nil {
+		return err
+	}
+
+	// extract next to the final directory and move it in place when everything worked
+	dir := t.dir(name)
+	err = os.MkdirAll(filepath.Dir(dir), 0700)
+	if err != nil {
+		return err
+	}
+	staging, err := ioutil.TempDir(filepath.Dir(dir), "."+t.Version+"-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	switch {
+	case strings.HasSuffix(url, ".tar.gz"), strings.HasSuffix(url, ".tgz"):
+		err = extractTarGz(tmp, staging)
+	case strings.HasSuffix(url, ".zip"):
+		err = extractZip(tmp.Name(), staging)
+	default:
+		err = writeToolFile(tmp, filepath.Join(staging, t.expand(t.Bin[0])), 0700)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, b := range t.Bin {
+		path := filepath.Join(staging, t.expand(b))
+		if _, err := os.Stat(path); err != nil {
+			return errors.New("missing executable in download: " + t.expand(b))
+		}
+		if err := os.Chmod(path, 0700); err != nil {
+			return err
+		}
+	}
+
+	os.RemoveAll(dir)
+	err = os.Rename(staging, dir)
+	if err != nil {
+		return err
+	}
+
+	return linkTool(name, t)
+}
+
+// link the executables of the tool into the bin directory of the toolchain
+func linkTool(name string, t *toolData) error {
+
+	err := os.MkdirAll(toolchainBinDir(), 0700)
+	if err != nil {
+		return err
+	}
+
+	for _, b := range t.Bin {
+		var (
+			target = filepath.Join(t.dir(name), t.expand(b))
+			link   = filepath.Join(toolchainBinDir(), filepath.Base(target))
+		)
+		rel, err := filepath.Rel(toolchainBinDir(), target)
+		if err != nil {
+			return err
+		}
+		os.Remove(link)
+		err = os.Symlink(rel, link)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// download a file and return its sha256 checksum
+func downloadTool(url string, w io.Writer) (string, error) {
+
+	client := &http.Client{Timeout: toolDownloadTimeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.New("download failed: " + resp.Status)
+	}
+
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(w, h), resp.Body)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// compare the checksum with the one declared in the CommandsFile or the one in the lock file
+// without either, the checksum is recorded in the lock file
+func verifyTool(name string, t *toolData, sum string) error {
+
+	platform := toolPlatform()
+	if want, ok := t.Checksums[platform]; ok {
+		if !strings.EqualFold(strings.TrimSpace(want), sum) {
+			return errors.New(ErrChecksumMismatch.Error() + ": expected " + want + ", got " + sum)
+		}
+		return nil
+	}
+
+	locks, err := readToolchainLock()
+	if err != nil {
+		return err
+	}
+
+	lock, ok := locks[name]
+	if !ok || lock.Version != t.Version {
+		lock = &toolLock{Version: t.Version}
+		locks[name] = lock
+	}
+	if want, ok := lock.Checksums[platform]; ok {
+		if want != sum {
+			return errors.New(ErrChecksumMismatch.Error() + ": expected " + want + " from " + toolchainLockPath() + ", got " + sum)
+		}
+		return nil
+	}
+
+	if lock.Checksums == nil {
+		lock.Checksums = make(map[string]string)
+	}
+	lock.Checksums[platform] = sum
+
+	return writeToolchainLock(locks)
+}
+
+func readToolchainLock() (map[string]*toolLock, error) {
+
+	locks := make(map[string]*toolLock)
+
+	contents, err := ioutil.ReadFile(toolchainLockPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return locks, nil
+		}
+		return nil, err
+	}
+
+	err = yaml.Unmarshal(contents, &locks)
+	if err != nil {
+		return nil, errors.New(toolchainLockPath() + ": " + err.Error())
+	}
+	if locks == nil {
+		locks = make(map[string]*toolLock)
+	}
+	return locks, nil
+}
+
+func writeToolchainLock(locks map[string]*toolLock) error {
+
+	contents, err := yaml.Marshal(locks)
+	if err != nil {
+		return err
+	}
+
+	header := "# checksums of the toolchain downloads, generated by zeus\n# commit this file, so every machine gets the same tools\n"
+	return ioutil.WriteFile(toolchainLockPath(), append([]byte(header), contents...), 0600)
+}
+
+// resolve the path of an archive entry inside the directory
+func archivePath(dir, name string) (string, error) {
+	path := filepath.Join(dir, name)
+	if path != filepath.Clean(dir) && !strings.HasPrefix(path, filepath.Clean(dir)+string(os.PathSeparator)) {
+		return "", errors.New(ErrUnsafeArchivePath.Error() + ": " + name)
+	}
+	return path, nil
+}
+
+func writeToolFile(r io.Reader, path string, mode os.FileMode) error {
+
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(f, r)
+	return err
+}
+
+func extractTarGz(r io.Reader, dir string) error {
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		path, err := archivePath(dir, hdr.Name)
+		if err != nil {
+			return err
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(path, 0700)
+		case tar.TypeReg:
+			err = writeToolFile(tr, path, os.FileMode(hdr.Mode)&0700|0600)
+		case tar.TypeSymlink:
+			// links must stay inside the tool, node links its npm executable into the package
+			if _, err = archivePath(dir, filepath.Join(filepath.Dir(hdr.Name), hdr.Linkname)); err != nil || filepath.IsAbs(hdr.Linkname) {
+				return errors.New(ErrUnsafeArchivePath.Error() + ": " + hdr.Name + " -> " + hdr.Linkname)
+			}
+			if err = os.MkdirAll(filepath.Dir(path), 0700); err == nil {
+				err = os.Symlink(hdr.Linkname, path)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func extractZip(archive, dir string) error {
+
+	zr, err := zip.OpenReader(archive)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	for _, f := range zr.File {
+
+		path, err := archivePath(dir, f.Name)
+		if err != nil {
+			return err
+		}
+
+		if f.FileInfo().IsDir() {
+			if err := os.MkdirAll(path, 0700); err != nil {
+				return err
+			}
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		err = writeToolFile(rc, path, f.Mode()&0700|0600)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handle the toolchain builtin
+// lists the pinned tools, installs them or removes all downloads
+func handleToolchainCommand(args []string) error {
+
+	if len(args) == 1 {
+		names := projectToolchain.names()
+		if len(names) == 0 {
+			l.Println(cp.Text + "no toolchain declared in the CommandsFile" + cp.Reset)
+			return nil
+		}
+		for _, name := range names {
+			t, _ := projectToolchain.get(name)
+			status := "missing"
+			if t.installed(name) {
+				status = "installed"
+			}
+			l.Println(cp.Prompt + pad(name, 20) + cp.Text + pad(t.Version, 12) + status + cp.Reset)
+		}
+		return nil
+	}
+
+	switch args[1] {
+	case "install":
+		names := args[2:]
+		if len(names) == 0 {
+			names = projectToolchain.names()
+		}
+		for _, name := range names {
+			t, ok := projectToolchain.get(name)
+			if !ok {
+				return errors.New("tool not in the toolchain: " + name)
+			}
+			err := installTool(name, t)
+			if err != nil {
+				return errors.New("failed to install " + name + " " + t.Version + ": " + err.Error())
+			}
+		}
+		return nil
+	case "clean":
+		if len(args) != 2 {
+			printToolchainCommandUsageErr()
+			return ErrInvalidUsage
+		}
+		l.Println(cp.Text + "removing " + toolchainDir() + cp.Reset)
+		return os.RemoveAll(toolchainDir())
+	default:
+		printToolchainCommandUsageErr()
+		return ErrInvalidUsage
+	}
+}
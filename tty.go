@@ -0,0 +1,115 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/dreadl0ck/readline"
+)
+
+// values for the --color flag
+const (
+	colorFlag = "color"
+
+	// colors when stdout is a terminal
+	colorModeAuto = "auto"
+
+	// colors also when the output is redirected or in CI mode
+	colorModeAlways = "always"
+
+	// no colors
+	colorModeNever = "never"
+
+	configOriginTerminal = "output is not a terminal"
+	configOriginFlag     = "--" + colorFlag + " flag"
+)
+
+// ErrInvalidColorMode occurs when the --color flag has an unknown value
+var ErrInvalidColorMode = errors.New("invalid value for --" + colorFlag + ", use: " + colorModeAuto + ", " + colorModeAlways + " or " + colorModeNever)
+
+var (
+	// set with the --color flag
+	colorMode = colorModeAuto
+
+	// stdout is a terminal, detected on startup
+	// when the output is redirected there are no colors, the screen is not cleared and there is no interactive shell
+	stdoutTerminal = true
+)
+
+// check if f is attached to a terminal
+func isTerminal(f *os.File) bool {
+	return readline.IsTerminal(int(f.Fd()))
+}
+
+// check if the value of the --color flag is valid
+func validColorMode(mode string) error {
+	switch mode {
+	case colorModeAuto, colorModeAlways, colorModeNever:
+		return nil
+	}
+	return ErrInvalidColorMode
+}
+
+// the origin of a config field that is overridden because of the terminal or the --color flag
+func terminalFieldOrigin(name string) (string, bool) {
+	switch {
+	case name == "colors" && colorMode != colorModeAuto:
+		return configOriginFlag, true
+	case (name == "colors" || name == "interactive") && !stdoutTerminal:
+		return configOriginTerminal, true
+	}
+	return "", false
+}
+
+// override the config when stdout is not a terminal, or colors are set with the --color flag
+// like in CI mode the changes are never written to the config file
+func applyTerminalFallback() {
+
+	conf.Lock()
+	defer conf.Unlock()
+
+	if !stdoutTerminal {
+		conf.fields.Interactive = false
+	}
+
+	switch {
+	case colorMode == colorModeAlways:
+		conf.fields.Colors = true
+	case colorMode == colorModeNever || !stdoutTerminal:
+		conf.fields.Colors = false
+	}
+}
+
+// remove the --color flags and their values from the commandline arguments
+func stripColorFlags(args []string) (out []string) {
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "-"+colorFlag || args[i] == "--"+colorFlag:
+			// skip the value
+			i++
+		case strings.HasPrefix(args[i], "-"+colorFlag+"=") || strings.HasPrefix(args[i], "--"+colorFlag+"="):
+		default:
+			out = append(out, args[i])
+		}
+	}
+	return
+}
@@ -0,0 +1,550 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// updateChannelStable only updates to releases
+	updateChannelStable = "stable"
+
+	// updateChannelBeta updates to prereleases as well
+	updateChannelBeta = "beta"
+
+	updateFlagCheck    = "--check"
+	updateFlagChannel  = "--channel"
+	updateFlagRollback = "--rollback"
+
+	// file with the sha256 checksums of the release archives
+	updateChecksumsAsset = "checksums.txt"
+
+	// ed25519 signature of the checksums file
+	updateSignatureAsset = "checksums.txt.sig"
+
+	// base64 encoded ed25519 public key of the releases, the private key signs the checksums in the release pipeline
+	// see .goreleaser.yml for how the key pair is generated, updates are refused while it is empty
+	updateReleaseKey = ""
+
+	// suffix of the previous binary, kept for update --rollback
+	updateBackupSuffix = ".old"
+
+	updateDownloadTimeout = 5 * time.Minute
+	updateSelfTestTimeout = 30 * time.Second
+)
+
+var (
+	// ErrNoRelease means there is no release in the update channel
+	ErrNoRelease = errors.New("no release found")
+
+	// ErrInvalidUpdateChannel means the update channel is neither stable nor beta
+	ErrInvalidUpdateChannel = errors.New("invalid update channel, expected stable or beta")
+
+	// ErrMissingReleaseAsset means a release lacks the archive for the platform or the checksums
+	ErrMissingReleaseAsset = errors.New("missing release asset")
+
+	// ErrNoReleaseKey means the build contains no key to verify the releases with
+	ErrNoReleaseKey = errors.New("no release key in this build, updates are disabled")
+
+	// ErrInvalidSignature means the checksums of a release are not signed with the release key
+	ErrInvalidSignature = errors.New("invalid release signature")
+
+	// ErrSelfTestFailed means the new binary did not print its version
+	ErrSelfTestFailed = errors.New("self-test failed")
+
+	// ErrNoBackup means there is no previous binary to roll back to
+	ErrNoBackup = errors.New("no previous version to roll back to")
+
+	// releases of zeus on github
+	updateReleasesURL = "https://api.github.com/repos/dreadl0ck/zeus/releases"
+
+	// the key the checksums of the releases are verified with, the tests replace it with a key of their own
+	updatePublicKey = updateReleaseKey
+)
+
+type githubRelease struct {
+	TagName    string        `json:"tag_name"`
+	Prerelease bool          `json:"prerelease"`
+	Draft      bool          `json:"draft"`
+	Assets     []githubAsset `json:"assets"`
+}
+
+type githubAsset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+}
+
+func printUpdateCommandUsageErr() {
+	l.Println(ErrInvalidUsage)
+	l.Println("usage: update [--check] [--channel <stable | beta>] | update --rollback")
+}
+
+// version of the release without the v prefix of the tag
+func (r *githubRelease) version() string {
+	return strings.TrimPrefix(r.TagName, "v")
+}
+
+func (r *githubRelease) asset(name string) *githubAsset {
+	for i, a := range r.Assets {
+		if a.Name == name {
+			return &r.Assets[i]
+		}
+	}
+	return nil
+}
+
+// name of the release archive for the platform, as created by goreleaser
+func releaseArchiveName(version string) string {
+	return "zeus_" + version + "_" + runtime.GOOS + "_" + runtime.GOARCH + ".tar.gz"
+}
+
+// check if version a is newer than version b
+// a prerelease like 0.9.0-beta.1 is older than the release 0.9.0
+func newerVersion(a, b string) bool {
+
+	var (
+		an, apre = splitPrerelease(a)
+		bn, bpre = splitPrerelease(b)
+	)
+
+	if cmp := compareVersions(an, bn); cmp != 0 {
+		return cmp > 0
+	}
+
+	switch {
+	case apre == bpre:
+		return false
+	case apre == "":
+		return true
+	case bpre == "":
+		return false
+	}
+
+	// identifiers of prereleases are compared one by one, numbers numerically: beta.10 is newer than beta.9
+	var (
+		as = strings.Split(apre, ".")
+		bs = strings.Split(bpre, ".")
+	)
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if as[i] == bs[i] {
+			continue
+		}
+		x, errX := strconv.Atoi(as[i])
+		y, errY := strconv.Atoi(bs[i])
+		if errX == nil && errY == nil {
+			return x > y
+		}
+		return as[i] > bs[i]
+	}
+	return len(as) > len(bs)
+}
+
+func splitPrerelease(version string) (string, string) {
+	parts := strings.SplitN(strings.TrimPrefix(version, "v"), "-", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
+
+// the channel from the flags, or from the config
+func updateChannel(flag string) (string, error) {
+
+	channel := flag
+	if channel == "" {
+		conf.Lock()
+		channel = conf.fields.UpdateChannel
+		conf.Unlock()
+	}
+	if channel == "" {
+		channel = updateChannelStable
+	}
+
+	if channel != updateChannelStable && channel != updateChannelBeta {
+		return "", errors.New(ErrInvalidUpdateChannel.Error() + ": " + channel)
+	}
+	return channel, nil
+}
+
+func fetchUpdate(url string) ([]byte, error) {
+
+	client := &http.Client{Timeout: updateDownloadTimeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(url + ": " + resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// the newest release of the channel, drafts are ignored and prereleases only belong to the beta channel
+func latestRelease(channel string) (*githubRelease, error) {
+
+	contents, err := fetchUpdate(updateReleasesURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var releases []*githubRelease
+	err = json.Unmarshal(contents, &releases)
+	if err != nil {
+		return nil, errors.New("failed to parse the releases: " + err.Error())
+	}
+
+	var latest *githubRelease
+	for _, r := range releases {
+		if r.Draft || r.Prerelease && channel != updateChannelBeta {
+			continue
+		}
+		if latest == nil || newerVersion(r.version(), latest.version()) {
+			latest = r
+		}
+	}
+
+	if latest == nil {
+		return nil, errors.New(ErrNoRelease.Error() + " in the " + channel + " channel")
+	}
+	return latest, nil
+}
+
+// download the archive of the release and verify it against the checksums of the release
+// the checksums must be signed with the release key
+func downloadRelease(r *githubRelease) ([]byte, error) {
+
+	if updatePublicKey == "" {
+		return nil, ErrNoReleaseKey
+	}
+
+	var (
+		name      = releaseArchiveName(r.version())
+		archive   = r.asset(name)
+		checksums = r.asset(updateChecksumsAsset)
+	)
+	if archive == nil {
+		return nil, errors.New(ErrMissingReleaseAsset.Error() + ": " + name)
+	}
+	if checksums == nil {
+		return nil, errors.New(ErrMissingReleaseAsset.Error() + ": " + updateChecksumsAsset)
+	}
+
+	sums, err := fetchUpdate(checksums.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	sig := r.asset(updateSignatureAsset)
+	if sig == nil {
+		return nil, errors.New(ErrMissingReleaseAsset.Error() + ": " + updateSignatureAsset)
+	}
+	signature, err := fetchUpdate(sig.URL)
+	if err != nil {
+		return nil, err
+	}
+	err = verifyReleaseSignature(updatePublicKey, sums, signature)
+	if err != nil {
+		return nil, err
+	}
+
+	contents, err := fetchUpdate(archive.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	want := releaseChecksum(string(sums), name)
+	if want == "" {
+		return nil, errors.New(ErrMissingReleaseAsset.Error() + ": no checksum for " + name)
+	}
+
+	sum := sha256.Sum256(contents)
+	if got := hex.EncodeToString(sum[:]); !strings.EqualFold(got, want) {
+		return nil, errors.New(ErrChecksumMismatch.Error() + ": expected " + want + ", got " + got)
+	}
+
+	return contents, nil
+}
+
+// verify the ed25519 signature of the checksums, the signature can be raw or base64 encoded
+func verifyReleaseSignature(key string, message, signature []byte) error {
+
+	pub, err := base64.StdEncoding.DecodeString(strings.TrimSpace(key))
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return errors.New(ErrInvalidSignature.Error() + ": invalid release key")
+	}
+
+	if len(signature) != ed25519.SignatureSize {
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+		if err != nil {
+			return ErrInvalidSignature
+		}
+		signature = decoded
+	}
+
+	if len(signature) != ed25519.SignatureSize || !ed25519.Verify(pub, message, signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// find the checksum of a file in the sha256sum format: <checksum>  <name>
+func releaseChecksum(sums, name string) string {
+	for _, line := range strings.Split(sums, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return fields[0]
+		}
+	}
+	return ""
+}
+
+// run the binary and compare the version it prints
+func selfTest(path, want string) error {
+
+	// the binary runs outside of the project, so it does not touch the project files
+	// printing the version needs no project setup
+	dir, err := ioutil.TempDir("", "zeus-self-test")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), updateSelfTestTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, path, versionCommand)
+	cmd.Dir = dir
+	cmd.Env = os.Environ()
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return errors.New(ErrSelfTestFailed.Error() + ": " + err.Error() + ": " + strings.TrimSpace(string(out)))
+	}
+	if got := strings.TrimSpace(string(out)); got != want {
+		return errors.New(ErrSelfTestFailed.Error() + ": expected version " + want + ", got " + got)
+	}
+	return nil
+}
+
+// replace the binary with the new version
+// the previous binary is kept as a backup, and restored when the new one fails the self-test
+func installRelease(exe string, binary io.Reader, want string) error {
+
+	next := exe + ".new"
+	err := writeToolFile(binary, next, 0755)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(next)
+
+	// the mode is only applied to new files
+	err = os.Chmod(next, 0755)
+	if err != nil {
+		return err
+	}
+
+	backup := exe + updateBackupSuffix
+	err = os.Rename(exe, backup)
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(next, exe)
+	if err != nil {
+		os.Rename(backup, exe)
+		return err
+	}
+
+	err = selfTest(exe, want)
+	if err != nil {
+		if rbErr := os.Rename(backup, exe); rbErr != nil {
+			return errors.New(err.Error() + ", rollback failed: " + rbErr.Error())
+		}
+		return errors.New(err.Error() + ", rolled back to " + version)
+	}
+
+	return nil
+}
+
+// swap the binary with the backup of the previous version
+func rollbackZeus(exe string) error {
+
+	backup := exe + updateBackupSuffix
+	if _, err := os.Stat(backup); err != nil {
+		return ErrNoBackup
+	}
+
+	tmp := exe + ".rollback"
+	err := os.Rename(exe, tmp)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(backup, exe)
+	if err != nil {
+		os.Rename(tmp, exe)
+		return err
+	}
+	return os.Rename(tmp, backup)
+}
+
+// update the binary at exe to the latest release of the channel
+func updateZeus(exe, channel string) error {
+
+	l.Println(cp.Text + "current version: " + cp.Prompt + version + cp.Reset)
+
+	r, err := latestRelease(channel)
+	if err != nil {
+		return err
+	}
+
+	if !newerVersion(r.version(), version) {
+		l.Println(cp.Text + "zeus is up to date" + cp.Reset)
+		return nil
+	}
+
+	l.Println(cp.Text + "updating zeus to " + cp.Prompt + r.version() + cp.Reset)
+
+	archive, err := downloadRelease(r)
+	if err != nil {
+		return err
+	}
+
+	dir, err := ioutil.TempDir("", "zeus-update")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	err = extractTarGz(bytes.NewReader(archive), dir)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(filepath.Join(dir, "zeus"))
+	if err != nil {
+		return errors.New(ErrMissingReleaseAsset.Error() + ": the archive contains no zeus binary")
+	}
+	defer f.Close()
+
+	err = installRelease(exe, f, r.version())
+	if err != nil {
+		return err
+	}
+
+	l.Println(cp.Text + "zeus updated to " + cp.Prompt + r.version() + cp.Text + ", the previous version can be restored with: update " + updateFlagRollback + cp.Reset)
+	return nil
+}
+
+// print the latest release of the channel, without installing it
+func checkUpdate(channel string) error {
+
+	r, err := latestRelease(channel)
+	if err != nil {
+		return err
+	}
+
+	if newerVersion(r.version(), version) {
+		l.Println(cp.Text + "update available: " + cp.Prompt + version + cp.Text + " -> " + cp.Prompt + r.version() + cp.Text + " (" + channel + ")" + cp.Reset)
+		return nil
+	}
+	l.Println(cp.Text + "zeus " + version + " is up to date (" + channel + ")" + cp.Reset)
+	return nil
+}
+
+// handle the update builtin
+func handleUpdateCommand(args []string) error {
+
+	var (
+		check, rollback bool
+		channelFlag     string
+	)
+
+	for i := 1; i < len(args); i++ {
+		switch args[i] {
+		case updateFlagCheck:
+			check = true
+		case updateFlagRollback:
+			rollback = true
+		case updateFlagChannel:
+			if i+1 == len(args) {
+				printUpdateCommandUsageErr()
+				return ErrInvalidUsage
+			}
+			i++
+			channelFlag = args[i]
+		default:
+			printUpdateCommandUsageErr()
+			return ErrInvalidUsage
+		}
+	}
+
+	if rollback && (check || channelFlag != "") {
+		printUpdateCommandUsageErr()
+		return ErrInvalidUsage
+	}
+
+	channel, err := updateChannel(channelFlag)
+	if err != nil {
+		return err
+	}
+
+	if check {
+		return checkUpdate(channel)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	exe, err = filepath.EvalSymlinks(exe)
+	if err != nil {
+		return err
+	}
+
+	if rollback {
+		err = rollbackZeus(exe)
+		if err != nil {
+			return err
+		}
+		l.Println(cp.Text + "restored the previous version of " + exe + cp.Reset)
+		return nil
+	}
+
+	return updateZeus(exe, channel)
+}
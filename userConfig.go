@@ -0,0 +1,199 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// origins of config values, from the lowest to the highest precedence
+const (
+	configOriginDefault = "default"
+	configOriginUser    = "user config"
+	configOriginProject = "project config"
+	configOriginCI      = "CI mode"
+)
+
+// ErrUnknownConfigField occurs when a config field does not exist
+var ErrUnknownConfigField = errors.New("unknown config field")
+
+// path of the user config, below $XDG_CONFIG_HOME or ~/.config
+func userConfigPath() string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "zeus", "config.yml")
+	}
+	return expandHome("~/.config/zeus/config.yml")
+}
+
+// the top-level keys of a config file
+func configKeys(contents []byte) (keys []string) {
+	var items yaml.MapSlice
+	if err := yaml.Unmarshal(contents, &items); err != nil {
+		return nil
+	}
+	for _, item := range items {
+		if key, ok := item.Key.(string); ok {
+			keys = append(keys, key)
+		}
+	}
+	return
+}
+
+// set the origin of the values of a config file
+// the caller holds the lock
+func (c *config) setOrigins(contents []byte, origin string) {
+	if c.origins == nil {
+		c.origins = make(map[string]string)
+	}
+	for key, o := range c.origins {
+		if o == origin {
+			delete(c.origins, key)
+		}
+	}
+	for _, key := range configKeys(contents) {
+		c.origins[key] = origin
+	}
+}
+
+// apply the user config on top of the defaults
+// problems are returned as warnings, a broken user config must not break the projects
+func (c *config) loadUserConfig() (warnings []string) {
+
+	path := userConfigPath()
+	if _, err := os.Stat(path); err != nil {
+		return nil
+	}
+
+	contents, userWarnings, err := validateConfig(path)
+	for _, w := range userWarnings {
+		warnings = append(warnings, path+": "+w)
+	}
+	if err != nil {
+		return append(warnings, path+": "+err.Error())
+	}
+
+	err = unmarshalConfig(contents, c)
+	if err != nil && err != ErrEmptyConfig {
+		return append(warnings, path+": "+err.Error())
+	}
+
+	c.setOrigins(contents, configOriginUser)
+	return warnings
+}
+
+// reduce the marshalled config to the fields of the project config
+// a new project config gets all fields that are not set in the user config
+// the caller holds the lock
+func (c *config) projectFields(contents []byte) ([]byte, error) {
+
+	if c.origins == nil {
+		c.origins = make(map[string]string)
+	}
+
+	var items yaml.MapSlice
+	err := yaml.Unmarshal(contents, &items)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields yaml.MapSlice
+	for _, item := range items {
+		key, _ := item.Key.(string)
+		if !c.project && c.origins[key] == "" {
+			c.origins[key] = configOriginProject
+		}
+		if c.origins[key] == configOriginProject {
+			fields = append(fields, item)
+		}
+	}
+	c.project = true
+
+	return yaml.Marshal(fields)
+}
+
+// the struct field of a config key, by its YAML name or its field name
+func configField(key string) (reflect.StructField, bool) {
+	t := reflect.TypeOf(configFields{})
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Tag.Get("yaml") == key || f.Name == key {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// describe the value of a config field and where it came from
+func (c *config) which(key string) (string, error) {
+
+	field, ok := configField(key)
+	if !ok {
+		return "", ErrUnknownConfigField
+	}
+	name := field.Tag.Get("yaml")
+
+	c.RLock()
+	defer c.RUnlock()
+
+	value := reflect.ValueOf(c.fields).Elem().FieldByIndex(field.Index)
+
+	var origin string
+	terminalOrigin, overridden := terminalFieldOrigin(name)
+	switch {
+	case overridden:
+		origin = terminalOrigin
+	case ciMode && isCIModeField(name):
+		origin = configOriginCI
+	case c.origins[name] == configOriginUser:
+		origin = configOriginUser + " " + userConfigPath()
+	case c.origins[name] == configOriginProject:
+		origin = configOriginProject + " " + projectConfigPath
+	default:
+		origin = configOriginDefault
+	}
+
+	switch value.Kind() {
+	case reflect.Bool, reflect.Int, reflect.String:
+		return fmt.Sprint(name, ": ", value.Interface(), " (", origin, ")"), nil
+	default:
+		return name + " (" + origin + ")", nil
+	}
+}
+
+// config which <field>
+func handleConfigWhichCommand(args []string) {
+
+	if len(args) < 3 {
+		printConfigUsageErr()
+		return
+	}
+
+	info, err := conf.which(args[2])
+	if err != nil {
+		l.Println(err.Error() + ": " + args[2])
+		return
+	}
+	l.Println(info)
+}
@@ -27,15 +27,11 @@ import (
 	"log"
 	"os"
 	"os/exec"
-	"os/signal"
 	"path/filepath"
 	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
-	"sync"
-	"syscall"
-	"time"
 
 	yaml "gopkg.in/yaml.v2"
 
@@ -46,89 +42,52 @@ import (
 
 var (
 	// prompt for the interactive shell
-	zeusPrompt  = "zeus"
-	signalMutex = &sync.Mutex{}
+	zeusPrompt = "zeus"
 
 	// ErrNoLineNumberFound means there was no line number in the error message
 	ErrNoLineNumberFound = errors.New("no line number found in error string")
 )
 
-// dump the currently executed script to disk
-func dumpScript(script, language string, e error, stdErr string) {
-
-	stat, err := os.Stat(zeusDir + "/dumps")
-	if err != nil {
-		err := os.Mkdir(zeusDir+"/dumps", 0700)
-		if err != nil {
-			Log.WithError(err).Error("failed to create dumps directory")
-			return
-		}
-	} else {
-		if !stat.IsDir() {
-			Log.Error("dumpScript: " + zeusDir + "/dumps is a file")
-			return
-		}
-	}
-
-	lang, err := ls.getLang(language)
-	if err != nil {
-		Log.WithError(err).Error("failed to get lang")
-		return
-	}
+// print the complete script to stdout
+// adds line numbers and optionally highlights lines, counted from 1 in the complete script
+// the first preamble lines were inserted by zeus and are printed without a number,
+// so the numbers match the source of the command
+func printScript(contents, path string, preamble int, highlightLines ...int) {
 
-	var stdErrOutputComment string
-	for _, line := range strings.Split(stdErr, "\n") {
-		stdErrOutputComment += lang.Comment + " " + line + "\n"
-	}
+	contents = redact(contents)
 
 	var (
-		t            = lang.Comment + " Timestamp: " + time.Now().Format(timestampFormat) + "\n"
-		errString    = lang.Comment + " Error: " + e.Error() + "\n" + lang.Comment + " StdErr: \n" + stdErrOutputComment + "\n\n"
-		dumpFileName = zeusDir + "/dumps/error_dump" + lang.FileExtension
+		highlight = make(map[int]bool, len(highlightLines))
+		errLines  []string
 	)
-
-	f, err := os.OpenFile(dumpFileName, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0700)
-	if err != nil {
-		Log.WithError(err).Error("failed to open dump file")
-		return
+	for _, n := range highlightLines {
+		highlight[n] = true
+		if n > preamble {
+			errLines = append(errLines, strconv.Itoa(n-preamble))
+		}
 	}
-	defer f.Close()
 
-	f.WriteString(lang.Bang + "\n" + lang.Comment + "\n")
-	f.WriteString(lang.Comment + " ZEUS Error Dump\n")
-	f.WriteString(t)
-	f.WriteString(errString)
-	f.WriteString(script)
-	Log.Debug("script dumped: ", dumpFileName)
-}
-
-// print the complete script to stdout
-// adds line numbers and optionally highlight a line
-// when no line shall be highlighted pass -1
-func printScript(contents, path string, highlightLine int) {
-
-	fmt.Println("\n" + cp.Reset + " |---------------------------------------------------------------------------------------------|")
+	fmt.Println("\n" + cp.Reset + ruler(" |", "-", "|"))
 	fmt.Println("     Script: " + path)
-	fmt.Println(" |---------------------------------------------------------------------------------------------|")
+	fmt.Println(ruler(" |", "-", "|"))
 	for i, s := range strings.Split(contents, "\n") {
 
-		var lineNumber string
-		switch true {
-		case i > 9:
-			lineNumber = strconv.Itoa(i) + " "
-		case i > 99:
-			lineNumber = strconv.Itoa(i)
-		default:
-			lineNumber = strconv.Itoa(i) + "  "
+		lineNumber := pad("", 3)
+		if i >= preamble {
+			lineNumber = pad(strconv.Itoa(i-preamble+1), 3)
 		}
 
-		if i == highlightLine {
-			fmt.Println(" "+ansi.Red+lineNumber, s+cp.Reset)
+		if highlight[i+1] {
+			fmt.Println(" "+ansi.Red+marker("", highlightMarker)+lineNumber, s+cp.Reset)
 		} else {
 			fmt.Println(" "+lineNumber, s)
 		}
 	}
-	fmt.Println(" |---------------------------------------------------------------------------------------------|" + cp.Text)
+	if len(errLines) > 0 {
+		fmt.Println(ruler(" |", "-", "|"))
+		fmt.Println("     Error in line: " + strings.Join(errLines, ", "))
+	}
+	fmt.Println(ruler(" |", "-", "|") + cp.Text)
 }
 
 // print a code snippet to stdout
@@ -138,6 +97,8 @@ func printScript(contents, path string, highlightLine int) {
 // $scope lines before and after the line will be printed
 func printCodeSnippet(contents, path string, highlightLine int) {
 
+	contents = redact(contents)
+
 	var (
 		rangeStart int
 		rangeEnd   int
@@ -152,9 +113,9 @@ func printCodeSnippet(contents, path string, highlightLine int) {
 		rangeEnd = highlightLine + scope
 	}
 
-	fmt.Println("\n" + cp.Reset + " |---------------------------------------------------------------------------------------------|")
+	fmt.Println("\n" + cp.Reset + ruler(" |", "-", "|"))
 	fmt.Println("     File: " + path)
-	fmt.Println(" |---------------------------------------------------------------------------------------------|")
+	fmt.Println(ruler(" |", "-", "|"))
 	for i, s := range strings.Split(contents, "\n") {
 
 		if i < rangeStart || i > rangeEnd {
@@ -172,36 +133,12 @@ func printCodeSnippet(contents, path string, highlightLine int) {
 		}
 
 		if i == highlightLine {
-			fmt.Println(" "+ansi.Red+lineNumber, s+cp.Reset)
+			fmt.Println(" "+ansi.Red+marker("", highlightMarker)+lineNumber, s+cp.Reset)
 		} else {
 			fmt.Println(" "+lineNumber, s)
 		}
 	}
-	fmt.Println(" |---------------------------------------------------------------------------------------------|" + cp.Text)
-}
-
-// handle OS SIGNALS for a clean exit and clean up all spawned processes
-func handleSignals() {
-
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM, syscall.SIGSEGV, syscall.SIGHUP, syscall.SIGQUIT)
-
-	// var signalLock sync.Mutex
-	go func() {
-
-		sig := <-c
-
-		Log.Debug("received SIGNAL: ", sig)
-
-		// lock the mutex
-		signalMutex.Lock()
-
-		// pass signal to all spawned procs
-		passSignalToProcs(sig)
-
-		// return to interactive shell
-		return
-	}()
+	fmt.Println(ruler(" |", "-", "|") + cp.Text)
 }
 
 // pad the input string up to the given number of space characters
@@ -230,6 +167,10 @@ func formatDependencies(deps []string) (out string) {
 
 // ClearScreen prints ANSI escape to flush screen
 func clearScreen() {
+	// a screen reader would lose the previous output, redirected output would contain the escape codes
+	if ciMode || accessible() || !stdoutTerminal {
+		return
+	}
 	print("\033[H\033[2J")
 }
 
@@ -268,52 +209,87 @@ func extractLineNumFromError(errMsg, errLineNumberSymbol string) (int, error) {
 	return 0, ErrNoLineNumberFound
 }
 
-// count total length of the commands dependencies
-func countDependencies(deps []string) (int, error) {
+// check that the dependencies exist and contain no cycles
+// path contains the command the dependencies belong to and its parents
+func validateDependencies(deps []string, path dependencyPath) error {
 
-	if len(deps) == 0 {
-		return 0, nil
-	}
-
-	count := 0
 	for _, dep := range deps {
 
 		fields := strings.Fields(dep)
 		if len(fields) == 0 {
-			return 0, ErrEmptyDependency
+			return ErrEmptyDependency
 		}
 
 		// lookup
 		cmd, err := cmdMap.getCommand(fields[0])
 		if err != nil {
-			return 0, errors.New("invalid dependency: " + err.Error())
+			return errors.New("invalid dependency: " + err.Error())
 		}
 
-		err = s.incrementRecursionCount(cmd.name)
+		depPath, err := path.enter(cmd.name)
 		if err != nil {
-			return 0, err
+			return err
 		}
 
-		count++
-		if len(cmd.dependencies) > 0 {
-			c, err := countDependencies(cmd.dependencies)
-			if err != nil {
-				return 0, err
-			}
-			count += c
+		err = validateDependencies(cmd.dependencies, depPath)
+		if err != nil {
+			return err
 		}
 	}
-	return count, nil
+	return nil
+}
+
+// the command lines started for a command, in their order
+// every dependency is started once, even if several commands depend on it, the command itself comes last
+func executionPlan(c *command) ([]string, error) {
+
+	if skipDependencies() {
+		return []string{c.name}, nil
+	}
+
+	deps, err := validDeepDependencies(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(deps, c.name), nil
+}
+
+// collect the dependencies of a command recursively, after checking them for cycles
+// getDeepDependencies does not terminate for cyclic dependencies
+func validDeepDependencies(c *command) ([]string, error) {
+
+	path, err := dependencyPath{}.enter(c.name)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validateDependencies(c.dependencies, path)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.getDeepDependencies(), nil
 }
 
+// number of commands in the execution plan of a command
 func getTotalDependencyCount(c *command) (int, error) {
-	count, err := countDependencies(c.dependencies)
-	return count + 1, err
+	plan, err := executionPlan(c)
+	return len(plan), err
 }
 
 // print the prompt for the interactive shell
+// the template of the prompt config field is rendered on first use and by the interactive shell for every line
 func printPrompt() string {
-	return cp.Prompt + zeusPrompt + " » " + cp.Text
+
+	shellPrompt.Lock()
+	rendered := shellPrompt.rendered
+	shellPrompt.Unlock()
+
+	if rendered != "" {
+		return rendered
+	}
+	return refreshPrompt()
 }
 
 // pass the command to the bash
@@ -388,13 +364,27 @@ func handleHelpCommand(args []string) {
 		return
 	}
 
+	if args[1] == longOverviewFlag {
+		printCommandOverview(true)
+		return
+	}
+
 	if c, ok := cmdMap.items[args[1]]; ok {
 
-		if c.help != "" {
-			l.Println("\n" + c.help)
-		} else {
+		help, err := c.helpText()
+		switch {
+		case err != nil:
+			l.Println(err)
+		case c.helpFile != "":
+			page("\n" + renderManual(help))
+		case help != "":
+			l.Println("\n" + wrapText(help, terminalWidth(), ""))
+		case len(c.examples) == 0:
 			l.Println("no help text available.")
 		}
+		if err == nil {
+			c.printExamples()
+		}
 		return
 	}
 
@@ -403,7 +393,7 @@ func handleHelpCommand(args []string) {
 
 func printHelpUsageErr() {
 	l.Println(ErrInvalidUsage)
-	l.Println("usage: help <command>")
+	l.Println("usage: help [<command> | " + longOverviewFlag + "]")
 }
 
 // check if the argument type matches the expected one
@@ -415,9 +405,9 @@ func validArgType(in string, k reflect.Kind) error {
 	case reflect.Bool:
 		_, err = strconv.ParseBool(in)
 	case reflect.Int:
-		_, err = strconv.ParseInt(in, 10, 0)
+		_, err = parseIntArg(in)
 	case reflect.Float64:
-		_, err = strconv.ParseFloat(in, 10)
+		_, err = parseFloatArg(in)
 	case reflect.String:
 
 		// check if input is explicitely marked as string
@@ -453,6 +443,9 @@ func validArgType(in string, k reflect.Kind) error {
 
 // display an OS notification
 func showNote(text, subtitle string) {
+	if ciMode {
+		return
+	}
 	err := beeep.Notify("ZEUS", text+":"+subtitle, "")
 	if err != nil {
 		Log.WithError(err).Error("error pushing notification")
@@ -484,11 +477,11 @@ func randomString() string {
 
 // print file content with linenumbers to stdout - useful for debugging
 func printFileContents(data []byte) {
-	l.Println("| ------------------------------------------------------------ |")
+	l.Println(ruler("| ", "-", " |"))
 	for i, line := range strings.Split(string(data), "\n") {
 		l.Println(pad(strconv.Itoa(i+1), 3), line)
 	}
-	l.Println("| ------------------------------------------------------------ |")
+	l.Println(ruler("| ", "-", " |"))
 }
 
 // print available completions for the bash-completion package
@@ -498,6 +491,50 @@ func printCompletions(previous string) {
 	case makefileCommand:
 		fmt.Println("migrate")
 		return
+	case migrateCommand:
+		fmt.Println("makefile")
+		fmt.Println("npm")
+		fmt.Println("taskfile")
+		fmt.Println("justfile")
+		fmt.Println(migrateTargetSyntax)
+		return
+	case envCommand:
+		fmt.Println("diff")
+		return
+	case exportCommand:
+		fmt.Println("ci")
+		fmt.Println("standalone")
+		return
+	case bootstrapCommand:
+		for _, name := range bootstrapProfileNames() {
+			fmt.Println(name)
+		}
+		return
+	case reportCommand:
+		fmt.Println(reportTargetProject)
+		return
+	case cmdCommand:
+		fmt.Println(cmdSubcommandSet)
+		return
+	case colorsCommand:
+		for _, name := range colorProfileNames() {
+			fmt.Println(name)
+		}
+		fmt.Println(colorsSubcommandPreview)
+		return
+	case useCommand:
+		if commandsFile, err := loadCommandsFile(commandsFilePath); err == nil {
+			for name := range commandsFile.Profiles {
+				fmt.Println(name)
+			}
+		}
+		fmt.Println(envProfileNone)
+		return
+	case migrateFlagNonInteractive:
+		for _, p := range conflictPolicies {
+			fmt.Println(p)
+		}
+		return
 	}
 
 	// print builtins
@@ -519,37 +556,57 @@ func printCompletions(previous string) {
 		createCommand,
 		generateCommand,
 		editCommand,
+		logsCommand,
+		profileCommand,
+		historyCommand,
+		statsCommand,
+		batchCommand,
+		secretsCommand,
+		dumpsCommand,
+		lintCommand,
+		rerunCommand,
+		gitHooksCommand,
+		affectedCommand,
+		serveCommand,
+		lspCommand,
+		migrateCommand,
+		envCommand,
+		exportCommand,
+		useCommand,
+		reportCommand,
+		optimizeCommand,
+		cmdCommand,
+		releaseCommand,
 	}
 
 	for _, name := range completions {
-		if previous == name || previous == bootstrapCommand {
+		if previous == name {
 			return
 		}
 	}
 
-	// check for commandsFile
-	var (
-		commandsFile = new(CommandsFile)
-		contents     []byte
-		err          error
-	)
-
-	contents, err = ioutil.ReadFile(commandsFilePath)
-	if err == nil {
-
-		// unmarshal data
-		err = yaml.Unmarshal(contents, commandsFile)
+	// check for commandsFile and its fragments
+	commandsFile, err := loadCommandsFile(commandsFilePath)
+	if err != ErrFailedToReadCommandsFile {
 		if err != nil {
 			fmt.Println()
 			return
 		}
 
-		for name := range commandsFile.Commands {
+		var names []string
+		for name, d := range commandsFile.Commands {
 			if name == previous {
+				if args, err := validateArgs(d.Arguments); err == nil {
+					for _, value := range completionValues(name, d.CompletionCmd, args) {
+						fmt.Println(value)
+					}
+				}
 				return
 			}
-			completions = append(completions, name)
+			names = append(names, name)
 		}
+		sortCommandNames(names)
+		completions = append(completions, names...)
 	} else {
 
 		// bootstrap is available when there's no zeusDir or commandsFile
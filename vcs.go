@@ -0,0 +1,333 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// version control systems for the vcs config option
+const (
+	// vcsAuto detects the version control system from the project directory
+	vcsAuto = "auto"
+
+	vcsGit       = "git"
+	vcsMercurial = "hg"
+
+	// vcsNone disables all version control features
+	vcsNone = "none"
+)
+
+// ErrNoVCS occurs when a feature needs version control, but the project is not in a repository
+var ErrNoVCS = errors.New("project is not under version control")
+
+// a version control system for the features working with the history of the project
+// the changed files, the commit log, the template globals and the time of reproducible builds
+type vcs interface {
+	// name of the version control system
+	name() string
+
+	// the files changed in the working copy since the revision, including untracked files
+	// paths are relative to the working directory, changes outside of it are ignored
+	changedFiles(ref string) ([]string, error)
+
+	// the latest n commits, all commits if n is 0
+	log(n int) ([]vcsCommit, error)
+
+	// short identifier of the current revision
+	revision() (string, error)
+
+	// name of the current branch
+	branch() (string, error)
+
+	// time of the current revision
+	commitTime() (time.Time, error)
+}
+
+// a commit in the log of a version control system
+type vcsCommit struct {
+	date    string
+	author  string
+	subject string
+}
+
+// the version control system of the project
+// set by the vcs config option or detected from the working directory for auto and unknown values
+func projectVCS() vcs {
+
+	var name string
+	if conf != nil {
+		conf.Lock()
+		name = conf.fields.VCS
+		conf.Unlock()
+	}
+
+	switch name {
+	case vcsGit:
+		return gitVCS{}
+	case vcsMercurial:
+		return mercurialVCS{}
+	case vcsNone:
+		return noVCS{}
+	}
+
+	dir, err := os.Getwd()
+	if err != nil {
+		return noVCS{}
+	}
+	return detectVCS(dir)
+}
+
+// detect the version control system of the repository containing dir
+func detectVCS(dir string) vcs {
+	for {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return gitVCS{}
+		}
+		if _, err := os.Stat(filepath.Join(dir, ".hg")); err == nil {
+			return mercurialVCS{}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return noVCS{}
+		}
+		dir = parent
+	}
+}
+
+// run a version control command and return its trimmed output
+// the error contains the error output of the command
+func vcsOutput(name string, args ...string) (string, error) {
+	cmd := exec.Command(name, args...)
+	cmd.Env = append(os.Environ(), "HGPLAIN=1")
+	out, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return "", errors.New(name + " " + args[0] + " failed: " + strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// parse the lines of a log in the date, author and subject format separated by null bytes
+func parseVCSLog(out string) (commits []vcsCommit) {
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.SplitN(line, "\x00", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		commits = append(commits, vcsCommit{
+			date:    fields[0],
+			author:  fields[1],
+			subject: fields[2],
+		})
+	}
+	return
+}
+
+// split output into file paths, skipping empty lines
+func vcsFiles(out string) (files []string) {
+	for _, line := range strings.Split(out, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			files = append(files, filepath.FromSlash(line))
+		}
+	}
+	return
+}
+
+/*
+ *	Git
+ */
+
+type gitVCS struct{}
+
+func (gitVCS) name() string {
+	return vcsGit
+}
+
+func (gitVCS) changedFiles(ref string) ([]string, error) {
+
+	out, err := vcsOutput("git", "diff", "--name-only", "--relative", ref)
+	if err != nil {
+		return nil, err
+	}
+
+	untracked, err := vcsOutput("git", "ls-files", "--others", "--exclude-standard")
+	if err != nil {
+		return nil, err
+	}
+
+	return vcsFiles(out + "\n" + untracked), nil
+}
+
+func (gitVCS) log(n int) ([]vcsCommit, error) {
+
+	args := []string{"log", "--pretty=format:%ci%x00%an%x00%s"}
+	if n > 0 {
+		args = append(args, "-n", strconv.Itoa(n))
+	}
+
+	out, err := vcsOutput("git", args...)
+	if err != nil {
+		return nil, err
+	}
+	return parseVCSLog(out), nil
+}
+
+func (gitVCS) revision() (string, error) {
+	return vcsOutput("git", "rev-parse", "--short", "HEAD")
+}
+
+func (gitVCS) branch() (string, error) {
+	return vcsOutput("git", "rev-parse", "--abbrev-ref", "HEAD")
+}
+
+func (gitVCS) commitTime() (time.Time, error) {
+	out, err := vcsOutput("git", "log", "-1", "--format=%ct")
+	if err != nil {
+		return time.Time{}, err
+	}
+	return parseUnixTime(out)
+}
+
+/*
+ *	Mercurial
+ */
+
+type mercurialVCS struct{}
+
+func (mercurialVCS) name() string {
+	return vcsMercurial
+}
+
+func (mercurialVCS) changedFiles(ref string) ([]string, error) {
+
+	root, err := vcsOutput("hg", "root")
+	if err != nil {
+		return nil, err
+	}
+
+	// modified, added, removed, deleted and unknown files, relative to the repository root
+	out, err := vcsOutput("hg", "status", "--rev", ref, "--no-status", "-mardu")
+	if err != nil {
+		return nil, err
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, file := range vcsFiles(out) {
+		rel, err := filepath.Rel(wd, filepath.Join(root, file))
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		files = append(files, rel)
+	}
+	return files, nil
+}
+
+func (mercurialVCS) log(n int) ([]vcsCommit, error) {
+
+	args := []string{"log", "--template", "{date|isodate}\\x00{author|person}\\x00{desc|firstline}\\n"}
+	if n > 0 {
+		args = append(args, "-l", strconv.Itoa(n))
+	}
+
+	out, err := vcsOutput("hg", args...)
+	if err != nil {
+		return nil, err
+	}
+	return parseVCSLog(out), nil
+}
+
+func (mercurialVCS) revision() (string, error) {
+	return vcsOutput("hg", "log", "-r", ".", "--template", "{node|short}")
+}
+
+// the active bookmark, or the named branch
+func (mercurialVCS) branch() (string, error) {
+	bookmark, err := vcsOutput("hg", "log", "-r", ".", "--template", "{activebookmark}")
+	if err != nil || bookmark != "" {
+		return bookmark, err
+	}
+	return vcsOutput("hg", "branch")
+}
+
+func (mercurialVCS) commitTime() (time.Time, error) {
+	// seconds and timezone offset
+	out, err := vcsOutput("hg", "log", "-r", ".", "--template", "{date|hgdate}")
+	if err != nil {
+		return time.Time{}, err
+	}
+	fields := strings.Fields(out)
+	if len(fields) == 0 {
+		return time.Time{}, errors.New("hg log failed: no date for the current revision")
+	}
+	return parseUnixTime(fields[0])
+}
+
+/*
+ *	No version control
+ */
+
+// noVCS is used for projects outside of a repository
+// all features that need version control fail with ErrNoVCS
+type noVCS struct{}
+
+func (noVCS) name() string {
+	return vcsNone
+}
+
+func (noVCS) changedFiles(string) ([]string, error) {
+	return nil, ErrNoVCS
+}
+
+func (noVCS) log(int) ([]vcsCommit, error) {
+	return nil, ErrNoVCS
+}
+
+func (noVCS) revision() (string, error) {
+	return "", ErrNoVCS
+}
+
+func (noVCS) branch() (string, error) {
+	return "", ErrNoVCS
+}
+
+func (noVCS) commitTime() (time.Time, error) {
+	return time.Time{}, ErrNoVCS
+}
+
+func parseUnixTime(s string) (time.Time, error) {
+	sec, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(sec, 0).UTC(), nil
+}
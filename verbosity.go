@@ -0,0 +1,202 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// output levels of an invocation
+const (
+	// the quiet config field decides
+	outputDefault int32 = iota
+
+	// progress lines and banners, the default without the quiet config field
+	outputNormal
+
+	// only the output of the commands and errors
+	outputQuiet
+
+	// the interpreter command lines, the environment and the timing of the commands in addition
+	outputVerbose
+)
+
+var (
+	// output level selected on the commandline, used for every line of the interactive shell without flags
+	sessionOutputLevel = outputDefault
+
+	// output level of the running invocation
+	invocationOutputLevel = outputDefault
+
+	// the output level flags in a line of the interactive shell
+	outputLevelFlagPattern = regexp.MustCompile(`(^|\s)(-q|--quiet|-v|--verbose)(\s|$)`)
+)
+
+// the output level selected by a flag
+// outputDefault if the argument is no output level flag
+func outputLevelFlag(arg string) int32 {
+	switch arg {
+	case "-q", "-quiet", "--quiet":
+		return outputQuiet
+	case "-v", "-verbose", "--verbose":
+		return outputVerbose
+	}
+	return outputDefault
+}
+
+// remove the output level flags from the arguments and return the level they select, the last flag wins
+// arguments after the extra arguments separator belong to the script
+func stripOutputLevelFlags(args []string) (out []string, level int32) {
+
+	level = outputDefault
+	for i, arg := range args {
+		if arg == extraArgsSeparator {
+			return append(out, args[i:]...), level
+		}
+		if flagLevel := outputLevelFlag(arg); flagLevel != outputDefault {
+			level = flagLevel
+			continue
+		}
+		out = append(out, arg)
+	}
+	return
+}
+
+// remove the output level flags from a line of the interactive shell and return the level they select
+func stripOutputLevelFlagsFromLine(line string) (string, int32) {
+
+	var (
+		head  = line
+		tail  string
+		level = outputDefault
+	)
+
+	// the separator is surrounded by spaces, or at the end of the line
+	if i := strings.Index(line+" ", " "+extraArgsSeparator+" "); i >= 0 {
+		head, tail = line[:i], line[i:]
+	}
+
+	for {
+		m := outputLevelFlagPattern.FindStringSubmatchIndex(head)
+		if m == nil {
+			break
+		}
+		level = outputLevelFlag(head[m[4]:m[5]])
+		head = head[:m[0]] + " " + head[m[1]:]
+	}
+
+	return strings.TrimSpace(head) + tail, level
+}
+
+// select the output level for the next invocation
+// without flags the level from the commandline is used
+func setOutputLevel(level int32) {
+	if level == outputDefault {
+		level = sessionOutputLevel
+	}
+	atomic.StoreInt32(&invocationOutputLevel, level)
+}
+
+// the output level of the running invocation, the flags override the quiet config field
+func outputLevel() int32 {
+
+	if level := atomic.LoadInt32(&invocationOutputLevel); level != outputDefault {
+		return level
+	}
+
+	if conf != nil {
+		conf.Lock()
+		defer conf.Unlock()
+		if conf.fields.Quiet {
+			return outputQuiet
+		}
+	}
+	return outputNormal
+}
+
+// check if only the output of the commands and errors should be printed
+func quietOutput() bool {
+	return outputLevel() == outputQuiet
+}
+
+// check if the command lines, environment and timing of the commands should be printed
+func verboseOutput() bool {
+	return outputLevel() == outputVerbose
+}
+
+// print how a command is started: the interpreter command line, the working directory
+// and the variables set by zeus, the values of secrets and redacted values are masked
+func printCommandDetails(cmd *exec.Cmd) {
+
+	l.Println(fitLine(cp.Text + "  command line: " + cp.Prompt + redact(formatCommandLine(cmd.Args)) + cp.Reset))
+	if cmd.Dir != "" {
+		l.Println(fitLine(cp.Text + "  directory:    " + cp.Prompt + cmd.Dir + cp.Reset))
+	}
+
+	inherited := make(map[string]bool)
+	for _, entry := range os.Environ() {
+		inherited[entry] = true
+	}
+
+	var entries []string
+	for _, entry := range cmd.Env {
+		if !inherited[entry] {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Strings(entries)
+
+	for _, entry := range entries {
+		kv := strings.SplitN(entry, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		l.Println(fitLine(cp.Text + "  env:          " + cp.CmdArgs + kv[0] + cp.Text + "=" + redact(kv[1]) + cp.Reset))
+	}
+}
+
+// join the arguments of a process, scripts passed inline are replaced with their number of lines
+// example: /bin/bash -e -c <script, 6 lines> build 'two words'
+func formatCommandLine(args []string) string {
+
+	out := make([]string, len(args))
+	for i, arg := range args {
+		switch {
+		case strings.Contains(arg, "\n"):
+			out[i] = "<script, " + strconv.Itoa(strings.Count(strings.TrimSuffix(arg, "\n"), "\n")+1) + " lines>"
+		case arg == "" || strings.ContainsAny(arg, " \t'\"$`\\*?;&|<>()"):
+			out[i] = shellQuote(arg)
+		default:
+			out[i] = arg
+		}
+	}
+	return strings.Join(out, " ")
+}
+
+// print the time a command needed to prepare and to run, and how it exited
+func printCommandTiming(name string, setup, run time.Duration, err error) {
+	l.Println(cp.Text + "  timing:       " + cp.Prompt + name + cp.Text + " setup " + formatDuration(setup) + ", run " + formatDuration(run) + ", exit code " + strconv.Itoa(exitCode(err)) + cp.Reset)
+}
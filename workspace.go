@@ -0,0 +1,223 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"os/signal"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+var (
+	// ErrNoWorkspaceProjects occurs when none of the directories passed with -C has a zeus setup
+	ErrNoWorkspaceProjects = errors.New("no projects with a zeus setup found")
+
+	// ErrNoWorkspaceCommand occurs when multiple projects are selected with -C, but no command is given
+	ErrNoWorkspaceCommand = errors.New("a command is required when running in multiple projects")
+
+	// the zeus binary that is started in the projects of a workspace
+	zeusExecutable = os.Executable
+)
+
+// workDirs holds the directories passed with the -C flag
+// the flag can be repeated, takes comma separated lists and glob patterns
+type workDirs []string
+
+// String implements the flag.Value interface
+func (w *workDirs) String() string {
+	return strings.Join(*w, ",")
+}
+
+// Set implements the flag.Value interface
+func (w *workDirs) Set(value string) error {
+	for _, dir := range strings.Split(value, ",") {
+		if dir = strings.TrimSpace(dir); dir != "" {
+			*w = append(*w, expandHome(dir))
+		}
+	}
+	return nil
+}
+
+// check if the command should run in multiple projects
+func (w workDirs) multiple() bool {
+	return len(w) > 1 || len(w) == 1 && isGlob(w[0])
+}
+
+// the directories with a zeus setup, glob patterns are expanded
+// directories are included only once, in the order they were passed
+func (w workDirs) projects() (projects []string) {
+
+	seen := make(map[string]bool)
+	for _, dir := range w {
+
+		matches := []string{dir}
+		if isGlob(dir) {
+			matches, _ = filepath.Glob(dir)
+		}
+
+		for _, m := range matches {
+			m = filepath.Clean(m)
+			if seen[m] {
+				continue
+			}
+			seen[m] = true
+
+			if !hasZeusSetup(m) {
+				if !isGlob(dir) {
+					Log.Warn("skipping " + m + ": no " + zeusDir + " directory")
+				}
+				continue
+			}
+			projects = append(projects, m)
+		}
+	}
+	return
+}
+
+// check if dir contains a zeus directory
+func hasZeusSetup(dir string) bool {
+	info, err := os.Stat(filepath.Join(dir, zeusDir))
+	return err == nil && info.IsDir()
+}
+
+// expand a leading ~ or $HOME to the home directory of the current user
+func expandHome(dir string) string {
+	for _, prefix := range []string{"~", "$HOME"} {
+		if !strings.HasPrefix(dir, prefix) {
+			continue
+		}
+		usr, err := user.Current()
+		if err != nil {
+			Log.WithError(err).Fatal("unable to get current user for expanding " + prefix)
+		}
+		return filepath.Join(usr.HomeDir, strings.TrimPrefix(dir, prefix))
+	}
+	return dir
+}
+
+// remove all -C flags and their values from the commandline arguments
+func stripWorkDirFlags(args []string) (out []string) {
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "-C" || args[i] == "--C":
+			// skip the value
+			i++
+		case strings.HasPrefix(args[i], "-C=") || strings.HasPrefix(args[i], "--C="):
+		default:
+			out = append(out, args[i])
+		}
+	}
+	return
+}
+
+// run zeus with the arguments in all projects in parallel
+// the output is prefixed with the project directory, a summary is printed at the end
+// returns the exit status of the first failed project in order, 0 if all succeeded
+func runWorkspace(projects, args []string) int {
+
+	if len(projects) == 0 {
+		l.Println(ErrNoWorkspaceProjects)
+		return 1
+	}
+	if len(args) == 0 {
+		l.Println(ErrNoWorkspaceCommand)
+		return 1
+	}
+
+	exe, err := zeusExecutable()
+	if err != nil {
+		l.Println("failed to locate the zeus binary: ", err)
+		return 1
+	}
+
+	var (
+		wg      sync.WaitGroup
+		errs    = make([]error, len(projects))
+		cmds    = make([]*exec.Cmd, len(projects))
+		signals = make(chan os.Signal, 1)
+	)
+
+	for i, dir := range projects {
+
+		w := mux.writer(dir, false)
+		cmd := exec.Command(exe, args...)
+		cmd.Dir = dir
+		cmd.Stdout = w
+		cmd.Stderr = w
+
+		errs[i] = cmd.Start()
+		if errs[i] != nil {
+			continue
+		}
+		cmds[i] = cmd
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = cmds[i].Wait()
+			w.flush()
+		}(i)
+	}
+
+	// pass signals to the projects, a Ctrl-C from the terminal reaches them directly
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(signals)
+	go func() {
+		for sig := range signals {
+			if sig == os.Interrupt {
+				continue
+			}
+			for _, cmd := range cmds {
+				if cmd != nil {
+					cmd.Process.Signal(sig)
+				}
+			}
+		}
+	}()
+
+	wg.Wait()
+
+	var status, failed int
+
+	l.Println(cp.Prompt + pad("status", 10) + pad("exit", 6) + "project" + cp.Text)
+	for i, dir := range projects {
+
+		if errs[i] == nil {
+			l.Println(pad("ok", 10) + pad("0", 6) + dir)
+			continue
+		}
+
+		failed++
+		code := exitStatus(errs[i])
+		if status == 0 {
+			status = code
+		}
+		l.Println(pad("failed", 10) + pad(strconv.Itoa(code), 6) + dir)
+	}
+
+	l.Println(cp.Text + strconv.Itoa(len(projects)) + " projects, " + strconv.Itoa(failed) + " failed" + cp.Reset)
+	return status
+}
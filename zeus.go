@@ -20,15 +20,14 @@ package main
 
 import (
 	"flag"
-	"fmt"
 	"log"
 	"os"
-	"os/user"
 	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	rice "github.com/GeertJohan/go.rice"
 	"github.com/dreadl0ck/readline"
@@ -62,8 +61,8 @@ var (
 	// project data
 	projectData *data
 
-	// shell formatter
-	f = newFormatter("path/to/your/formatter", bashLanguage())
+	// script formatter
+	f = newFormatter()
 
 	g = &globals{
 		Vars: make(map[string]string, 0),
@@ -75,9 +74,7 @@ var (
 	workingDir   string
 
 	// status info
-	s = &status{
-		recursionMap: make(map[string]int, 0),
-	}
+	s = &status{}
 
 	// running a test?
 	testingMode bool
@@ -98,12 +95,27 @@ func newAtomicLogger() *atomicLogger {
 func initZeus() {
 
 	var (
-		err             error
-		flagCompletions = flag.String("completions", "", "get available command completions")
-		flagWorkDir     = flag.String("C", "", "set work directory to start from")
-		flagHelp        = flag.Bool("h", false, "print zeus help and exit")
+		err              error
+		flagCompletions  = flag.String("completions", "", "get available command completions")
+		flagWorkDirs     workDirs
+		flagHelp         = flag.Bool("h", false, "print zeus help and exit")
+		flagProfile      = flag.Bool("profile", false, "print a timing breakdown and write a chrome trace after the run")
+		flagReproducible = flag.Bool("reproducible", false, "export SOURCE_DATE_EPOCH and produce deterministic artifacts")
+		flagCI           = flag.Bool("ci", false, "run non-interactive without colors and stop on errors, enabled when $CI is set")
+		flagStdin        = flag.Bool("stdin", false, "run one command or commandChain per line from stdin, same as: zeus batch -")
+		flagEnv          = flag.String(envProfileFlag, "", "select the environment profile from the CommandsFile, continued from $ZEUS_ENV")
+		flagWait         = flag.Bool(projectLockWaitFlag, false, "wait until the project lock is released, instead of failing if another zeus instance holds it")
+		flagColor        = flag.String(colorFlag, colorModeAuto, "use colors: auto (when stdout is a terminal), always or never")
 	)
 
+	// the output level flags are also accepted after the command, handleArgs strips them
+	flag.Bool("q", false, "only print the output of the commands and errors, no banners and progress")
+	flag.Bool("quiet", false, "same as -q")
+	flag.Bool("v", false, "print the interpreter command lines, the environment and the timing of the commands")
+	flag.Bool("verbose", false, "same as -v")
+
+	flag.Var(&flagWorkDirs, "C", "set work directory to start from, multiple directories or a glob pattern run the command in every project")
+
 	// set up formatter
 	Log.Formatter = &prefixed.TextFormatter{}
 
@@ -126,7 +138,7 @@ func initZeus() {
 
 	if len(os.Args) > 1 {
 		if os.Args[1] == bootstrapCommand {
-			runBootstrapCommand()
+			runBootstrapCommand(os.Args[2:])
 
 			// remove bootstrap arg
 			os.Args = []string{os.Args[0]}
@@ -135,36 +147,46 @@ func initZeus() {
 
 	if len(os.Args) > 2 {
 		if os.Args[1] == "makefile" && os.Args[2] == "migrate" {
-			migrateMakefile(zeusDir)
+			handleMakefileCommand(os.Args[1:])
+			os.Exit(0)
+		}
+		// projects are created from templates before there is a zeus directory
+		if os.Args[1] == createCommand && os.Args[2] == createTargetProject {
+			handleCreateProjectCommand(os.Args[1:])
+			os.Exit(0)
+		}
+		if os.Args[1] == migrateCommand {
+			handleMigrateCommand(os.Args[1:])
 			os.Exit(0)
 		}
 	}
 
+	// stdout belongs to the editor, start before anything is printed
+	// the documents are sent by the editor, so a broken CommandsFile does not prevent startup
+	if len(os.Args) == 2 && os.Args[1] == lspCommand {
+		Log.Out = os.Stderr
+		os.Exit(serveLSP(os.Stdin, os.Stdout))
+	}
+
+	// the version needs no project setup, the update builtin runs it on the new binary outside of the project
+	if len(os.Args) == 2 && os.Args[1] == versionCommand {
+		l.Println(version)
+		os.Exit(0)
+	}
+
+	// static file servers are spawned by commands, they need no project setup
+	if len(os.Args) > 2 && os.Args[1] == serveCommand && os.Args[2] == staticFlagDir {
+		handleServeCommand(os.Args[1:])
+		os.Exit(1)
+	}
+
 	flag.Parse()
 
-	if *flagWorkDir != "" {
-		if strings.HasPrefix(*flagWorkDir, "~") {
-			usr, err := user.Current()
-			if err != nil {
-				log.Fatal("unable to get current user for expanding the ~ character: ", err)
-			}
-			*flagWorkDir = filepath.Join(usr.HomeDir, strings.TrimPrefix(*flagWorkDir, "~"))
-			fmt.Println("expanded ~:", *flagWorkDir)
-		}
-		if strings.HasPrefix(*flagWorkDir, "$HOME") {
-			usr, err := user.Current()
-			if err != nil {
-				log.Fatal("unable to get current user for expanding $HOME: ", err)
-			}
-			*flagWorkDir = filepath.Join(usr.HomeDir, strings.TrimPrefix(*flagWorkDir, "$HOME"))
-			fmt.Println("expanded $HOME:", *flagWorkDir)
-		}
-		err := os.Chdir(*flagWorkDir)
+	if len(flagWorkDirs) == 1 && !flagWorkDirs.multiple() {
+		err := os.Chdir(flagWorkDirs[0])
 		if err != nil {
 			log.Fatal("failed to change dir: ", err)
 		}
-		commandsFilePath = filepath.Join(*flagWorkDir, commandsFilePath)
-		fmt.Println("commandsFilePath", commandsFilePath)
 	}
 
 	if *flagCompletions != "" {
@@ -176,12 +198,45 @@ func initZeus() {
 		printHelp()
 	}
 
+	profileRun = *flagProfile
+	reproducibleRun = *flagReproducible
+	ciMode = *flagCI || ciModeDetected()
+	batchFromStdin = *flagStdin
+	projectLocks.wait = *flagWait
+
+	if err := validColorMode(*flagColor); err != nil {
+		Log.Fatal(err)
+	}
+	colorMode = *flagColor
+
+	// the tests use the interactive setup
+	if !testingMode {
+		stdoutTerminal = isTerminal(os.Stdout)
+	}
+	if *flagEnv != "" {
+		envs.active = *flagEnv
+	}
+
+	// projects that have not been migrated yet
+	useZeusfile()
+
+	// run the command in every project of the workspace
+	if flagWorkDirs.multiple() {
+		conf = newConfig()
+		applyCIMode()
+		applyTerminalFallback()
+		os.Exit(runWorkspace(flagWorkDirs.projects(), stripWorkDirFlags(os.Args[1:])))
+	}
+
 	stat, err := os.Stat(scriptDir)
 	if err != nil {
 		if stat, err = os.Stat(commandsFilePath); err != nil {
-			Log.WithError(err).Error("no " + scriptDir + " directory or CommandsFile found.")
-			Log.Info("run 'zeus bootstrap' to create a default setup, or 'zeus makefile migrate' if you want to migrate from a GNU Makefile.")
-			os.Exit(1)
+			// a project can consist of fragments only
+			if len(commandsFragments()) == 0 {
+				Log.WithError(err).Error("no " + scriptDir + " directory or CommandsFile found.")
+				Log.Info("run 'zeus bootstrap' to create a default setup, or 'zeus makefile migrate' if you want to migrate from a GNU Makefile.")
+				os.Exit(1)
+			}
 		} else {
 			// make sure its a file
 			if stat.IsDir() {
@@ -220,9 +275,13 @@ func main() {
 		cLog.Info("initializing default configuration")
 
 		conf = newConfig()
+		configWarnings = conf.loadUserConfig()
 		conf.update()
 	}
 
+	applyCIMode()
+	applyTerminalFallback()
+
 	initColorProfile()
 
 	// load persisted events from project data
@@ -231,7 +290,7 @@ func main() {
 	projectData.Lock()
 
 	// validate aliases
-	for name := range projectData.fields.Aliases {
+	for _, name := range sortedKeys(projectData.fields.Aliases) {
 		err = validateAlias(name)
 		if err != nil {
 			Log.WithError(err).Fatal("failed to validate alias: ", name)
@@ -243,6 +302,11 @@ func main() {
 
 	projectData.Unlock()
 
+	// the plugins are only loaded on startup for the completions of the interactive shell
+	if len(os.Args) == 1 {
+		plugins.addCompletions()
+	}
+
 	// get debug value from config
 	debug = conf.fields.Debug
 
@@ -257,14 +321,28 @@ func main() {
 		Log.Formatter = formatter
 	}
 
+	// the logger checks itself if its output is a terminal
+	if colorMode == colorModeAlways {
+		Log.Formatter = &prefixed.TextFormatter{
+			ForceColors:      true,
+			DisableTimestamp: conf.fields.DisableTimestamps,
+		}
+	}
+
 	// disable colors
-	if !conf.fields.Colors {
+	if !conf.fields.Colors || conf.fields.Accessible {
 
-		print(cp.Reset)
+		// redirected output must not contain escape codes
+		if stdoutTerminal {
+			print(cp.Reset)
+		}
 
 		// lock once
 		cp.Lock()
 		cp = colorsOffProfile().parse()
+		if !stdoutTerminal {
+			cp.Reset = ""
+		}
 
 		Log.Formatter = &prefixed.TextFormatter{
 			DisableColors:    true,
@@ -295,6 +373,9 @@ func main() {
 	for _, w := range configWarnings {
 		Log.Warn(w)
 	}
+	for _, w := range deprecationWarnings(time.Now()) {
+		Log.Warn(w)
+	}
 
 	// start watchers when running in interactive mode
 	if conf.fields.Interactive {
@@ -302,10 +383,8 @@ func main() {
 		// watch config for changes
 		go conf.watch("")
 
-		if conf.fields.AutoFormat {
-			// watch zeus directory for changes
-			go f.watchScriptDir("")
-		}
+		// watch the script directory for changes
+		go f.watchScriptDir("")
 	}
 
 	// print makefile command overview
@@ -337,11 +416,20 @@ func main() {
 		findCommands()
 	} else if err != nil {
 		Log.Error("failed to parse commandsFile: ", err, "\n")
+
+		// a broken CommandsFile must fail the pipeline
+		if ciMode {
+			os.Exit(1)
+		}
 	}
 
 	// watch commandsFile for changes in interactive mode
 	if err == nil && conf.fields.Interactive {
-		go watchCommandsFile(commandsFilePath, "")
+		if _, statErr := os.Stat(commandsFilePath); statErr == nil {
+			go watchCommandsFile(commandsFilePath, "")
+		}
+		go watchCommandsFragments("")
+		go watchCommandsStar("")
 	}
 
 	if conf.fields.ProjectNamePrompt {
@@ -377,6 +465,16 @@ func main() {
 	}
 }
 
+// clean up and exit if a run failed
+// the exit code of the failed script becomes the exit code of zeus
+func exitOnError(err error) {
+	if err == nil {
+		return
+	}
+	cleanup()
+	os.Exit(exitStatus(err))
+}
+
 func printHelp() {
 	l.Println("ZEUS - An Electrifying Build System")
 	l.Println("author: dreadl0ck@protonmail.ch")
@@ -390,9 +488,12 @@ func printHelp() {
 // print the project ascii art and project infos
 func printProjectHeader() {
 
-	// print ascii art
+	if quietOutput() {
+		return
+	}
+
 	clearScreen()
-	l.Println(cp.Text + asciiArt + "v" + version)
+	printBanner()
 
 	if !conf.fields.Quiet {
 		if conf.fields.Debug {
@@ -417,19 +518,49 @@ func printProjectHeader() {
 func handleArgs() {
 
 	// strip commandline flags
+	os.Args = append(os.Args[:1], stripWorkDirFlags(os.Args[1:])...)
+	os.Args = append(os.Args[:1], stripEnvProfileFlags(os.Args[1:])...)
+	os.Args = append(os.Args[:1], stripColorFlags(os.Args[1:])...)
+
+	for i, elem := range os.Args {
+		if elem == "-profile" || elem == "--profile" {
+			os.Args = append(os.Args[:i], os.Args[i+1:]...)
+			break
+		}
+	}
+
 	for i, elem := range os.Args {
-		if strings.HasPrefix(elem, "-C=") {
-			// delete i
+		if elem == "-reproducible" || elem == "--reproducible" {
 			os.Args = append(os.Args[:i], os.Args[i+1:]...)
 			break
 		}
-		if elem == "-C" {
-			// delete i and i+1
-			os.Args = append(os.Args[:i], os.Args[i+2:]...)
+	}
+
+	for i, elem := range os.Args {
+		if elem == "-ci" || elem == "--ci" {
+			os.Args = append(os.Args[:i], os.Args[i+1:]...)
+			break
+		}
+	}
+
+	for i, elem := range os.Args {
+		if elem == "-"+projectLockWaitFlag || elem == "--"+projectLockWaitFlag {
+			os.Args = append(os.Args[:i], os.Args[i+1:]...)
 			break
 		}
 	}
 
+	// the level applies to this invocation, and to every line of the interactive shell without flags
+	args, level := stripOutputLevelFlags(os.Args[1:])
+	os.Args = append(os.Args[:1], args...)
+	sessionOutputLevel = level
+	setOutputLevel(level)
+
+	// same as: zeus batch -
+	if batchFromStdin {
+		os.Args = []string{os.Args[0], batchCommand, batchStdin}
+	}
+
 	var cLog = Log.WithField("prefix", "handleArgs")
 
 	if len(os.Args) > 1 {
@@ -438,13 +569,21 @@ func handleArgs() {
 
 		switch os.Args[1] {
 		case helpCommand:
+			if len(os.Args) > 2 && os.Args[2] != longOverviewFlag {
+				handleHelpCommand(os.Args[1:])
+				break
+			}
 			if conf.fields.PrintBuiltins {
 				printBuiltins()
 			}
-			printCommands()
+			printCommandOverview(len(os.Args) > 2)
 
 		case formatCommand:
-			f.formatCommand()
+			err := f.formatCommand(os.Args[1:])
+			if err != nil {
+				cleanup()
+				os.Exit(1)
+			}
 		case dataCommand:
 			printProjectData()
 
@@ -462,13 +601,20 @@ func handleArgs() {
 		case versionCommand:
 			l.Println(version)
 		case updateCommand:
-			updateZeus()
+			err := handleUpdateCommand(os.Args[1:])
+			if err != nil {
+				if err != ErrInvalidUsage {
+					l.Println(err)
+				}
+				cleanup()
+				os.Exit(1)
+			}
 		case infoCommand:
 			printProjectInfo()
 
 		case colorsCommand:
 
-			if len(os.Args) == 3 {
+			if len(os.Args) == 3 || len(os.Args) > 3 && os.Args[2] == colorsSubcommandPreview {
 				handleColorsCommand(os.Args[1:])
 			} else {
 				printColorsUsageErr()
@@ -489,6 +635,106 @@ func handleArgs() {
 			handleCreateCommand(os.Args[1:])
 			os.Exit(0)
 
+		case logsCommand:
+			handleLogsCommand(os.Args[1:])
+
+		case profileCommand:
+			handleProfileCommand(os.Args[1:])
+
+		case historyCommand:
+			handleHistoryCommand(os.Args[1:])
+		case findCommand:
+			handleFindCommand(os.Args[1:])
+		case statsCommand:
+			handleStatsCommand()
+		case secretsCommand:
+			handleSecretsCommand(os.Args[1:])
+		case dumpsCommand:
+			handleDumpsCommand(os.Args[1:])
+		case lintCommand:
+			err := handleLintCommand(os.Args[1:])
+			if err != nil {
+				cleanup()
+				os.Exit(1)
+			}
+		case batchCommand:
+			err := handleBatchCommand(os.Args[1:])
+			finishRun()
+			exitOnError(err)
+		case rerunCommand:
+			err := handleRerunCommand(os.Args[1:])
+			finishRun()
+			exitOnError(err)
+		case gitHooksCommand:
+			handleGitHooksCommand(os.Args[1:])
+		case serveCommand:
+			handleServeCommand(os.Args[1:])
+		case exportCommand:
+			err := handleExportCommand(os.Args[1:])
+			if err != nil {
+				if err != ErrInvalidUsage {
+					l.Println(err)
+				}
+				cleanup()
+				os.Exit(1)
+			}
+		case reportCommand:
+			handleReportCommand(os.Args[1:])
+		case optimizeCommand:
+			handleOptimizeCommand(os.Args[1:])
+		case cmdCommand:
+			err := handleCmdCommand(os.Args[1:])
+			if err != nil {
+				if err != ErrInvalidUsage {
+					l.Println(err)
+				}
+				cleanup()
+				os.Exit(1)
+			}
+		case useCommand:
+			if handleUseCommand(os.Args[1:]) != nil {
+				cleanup()
+				os.Exit(1)
+			}
+		case envCommand:
+			err := handleEnvCommand(os.Args[1:])
+			if err != nil {
+				cleanup()
+				os.Exit(1)
+			}
+		case doctorCommand:
+			err := handleDoctorCommand(os.Args[1:])
+			if err != nil {
+				cleanup()
+				os.Exit(1)
+			}
+		case toolchainCommand:
+			err := handleToolchainCommand(os.Args[1:])
+			if err != nil {
+				if err != ErrInvalidUsage {
+					l.Println(err)
+				}
+				cleanup()
+				os.Exit(1)
+			}
+		case releaseCommand:
+			err := handleReleaseCommand(os.Args[1:])
+			if err != nil {
+				if err != ErrInvalidUsage {
+					l.Println(err)
+				}
+				cleanup()
+				os.Exit(1)
+			}
+		case affectedCommand:
+			handleSignals()
+			err := handleAffectedCommand(os.Args[1:])
+			finishRun()
+			if err != nil {
+				cLog.WithError(err).Error("failed to run affected commands")
+				exitOnError(err)
+			}
+
 		default:
 			handleSignals()
 
@@ -503,43 +749,82 @@ func handleArgs() {
 				count, err := getTotalDependencyCount(cmd)
 				if err != nil {
 					l.Println(err)
-					return
+					cleanup()
+					os.Exit(1)
+				}
+
+				err = s.begin()
+				if err != nil {
+					l.Println(err)
+					cleanup()
+					os.Exit(1)
 				}
+				s.plan(count)
+				progressUI.plan(cmd)
 
-				s.Lock()
-				s.numCommands = count
-				s.Unlock()
+				var (
+					line = strings.Join(os.Args[1:], " ")
+					key  = invocationKey([]string{line})
+				)
 
 				err = cmd.Run(os.Args[2:], cmd.async)
+				s.end()
+				finishRun()
 				if err != nil {
+					recordInvocation(key, []string{line}, 0)
 					cLog.WithError(err).Error("failed to execute " + cmd.name)
-					cleanup()
-					os.Exit(1)
+					exitOnError(err)
 				}
+				recordInvocation(key, []string{line}, -1)
 			} else {
 				cmdMap.Unlock()
 			}
 
 			// check if its a commandchain supplied with "" or ''
-			if strings.Contains(os.Args[1], commandChainSeparator) {
+			if isCommandChain(os.Args[1]) {
 				fields := strings.Split(os.Args[1], commandChainSeparator)
 				if cmdChain, ok := validCommandChain(fields); ok {
-					cmdChain.exec(fields)
+					err := cmdChain.exec(fields)
+					finishRun()
+					exitOnError(err)
 				} else {
 					l.Println("invalid commandChain")
+					cleanup()
+					os.Exit(1)
 				}
 				return
 			}
 
 			// check if its an alias
 			if command, ok := projectData.fields.Aliases[os.Args[1]]; ok {
-				handleLine(command)
+				err := runAlias(command)
+				finishRun()
+				if err != nil {
+					cLog.WithError(err).Error("failed to execute alias " + os.Args[1])
+					exitOnError(err)
+				}
 				os.Exit(0)
 			}
 
 			if !validCommand {
 				if !testingMode {
-					cLog.Fatal("unknown command: ", os.Args[1])
+					if _, ok := plugins.get(os.Args[1]); ok {
+						err := runPlugin(os.Args[1], os.Args[2:])
+						if err != nil {
+							l.Println(err)
+							cleanup()
+							os.Exit(1)
+						}
+						os.Exit(0)
+					}
+					if commandFallback.get() != "" {
+						err := runFallback(os.Args[1], os.Args[2:])
+						exitOnError(err)
+						os.Exit(0)
+					}
+					printUnknownCommand(os.Args[1])
+					cleanup()
+					os.Exit(1)
 				}
 			}
 		}
@@ -19,20 +19,94 @@
 package main
 
 import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"testing"
 	"time"
 
+	"github.com/dreadl0ck/readline"
+	"github.com/dreadl0ck/zeus/rpc"
+	"github.com/fsnotify/fsnotify"
+	"github.com/mgutz/ansi"
 	. "github.com/smartystreets/goconvey/convey"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	grpcStatus "google.golang.org/grpc/status"
+	yaml "gopkg.in/yaml.v2"
 )
 
 var (
 	// make sure backend is only started once
 	running bool
+
+	// the tests work on a copy of tests/zeus, so the fixtures stay untouched
+	testProjectDir string
 )
 
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if testProjectDir != "" {
+		os.RemoveAll(testProjectDir)
+	}
+	os.Exit(code)
+}
+
+// copy the test project into a temporary directory
+func copyTestProject(src string) (string, error) {
+
+	dir, err := ioutil.TempDir("", "zeus-tests")
+	if err != nil {
+		return "", err
+	}
+
+	err = filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		dst := filepath.Join(dir, rel)
+		err = copyFile(path, dst)
+		if err != nil {
+			return err
+		}
+		return os.Chmod(dst, info.Mode())
+	})
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return dir, nil
+}
+
 // Test main entrypoint
 // must be executed prior to other tests
 // because it handles command and config parsing
@@ -46,18 +120,24 @@ func TestMainFunction(t *testing.T) {
 		testingMode = true
 
 		// parse tests dir on startup
-		zeusDir = "tests/zeus"
-		scriptDir = "tests/zeus/scripts"
+		// the dumps, the project data, the history and the backups are written into the copy
+		dir, err := copyTestProject("tests/zeus")
+		if err != nil {
+			t.Fatal(err)
+		}
+		testProjectDir = dir
+		zeusDir = dir
+		scriptDir = filepath.Join(dir, "scripts")
 
 		// ignore commandsFile in the project dir for now, it will be tested separately with TestCommandsFile()
 		// commandsFilePath = ""
 		// manipulate CommandsFile path to not use the ZEUS projects CommandsFile for the tests
-		commandsFilePath = "tests/zeus/commands.yml"
+		commandsFilePath = filepath.Join(dir, "commands.yml")
 
 		Convey("When Starting main", t, func(c C) {
 
-			// remove project data from previous test runs
-			os.Remove("tests/zeus/data.yml")
+			// start without project data
+			os.Remove(filepath.Join(zeusDir, "data.yml"))
 
 			go main()
 
@@ -145,6 +225,144 @@ func TestConfig(t *testing.T) {
 	})
 }
 
+func TestUserConfig(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing the user config layer", t, func(c C) {
+
+		dir, err := ioutil.TempDir("", "zeus-user-config")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		prev, hadPrev := os.LookupEnv("XDG_CONFIG_HOME")
+		os.Setenv("XDG_CONFIG_HOME", dir)
+		defer func() {
+			if hadPrev {
+				os.Setenv("XDG_CONFIG_HOME", prev)
+			} else {
+				os.Unsetenv("XDG_CONFIG_HOME")
+			}
+		}()
+
+		c.So(userConfigPath(), ShouldEqual, filepath.Join(dir, "zeus", "config.yml"))
+		c.So(os.MkdirAll(filepath.Join(dir, "zeus"), 0700), ShouldBeNil)
+		c.So(ioutil.WriteFile(userConfigPath(), []byte("colorProfile: light\neditor: vim\n"), 0600), ShouldBeNil)
+
+		cfg := newConfig()
+		c.So(cfg.loadUserConfig(), ShouldBeEmpty)
+		c.So(cfg.fields.ColorProfile, ShouldEqual, "light")
+		c.So(cfg.fields.Editor, ShouldEqual, "vim")
+
+		// a new project config gets all fields, except the ones from the user config
+		out, err := yaml.Marshal(cfg.fields)
+		c.So(err, ShouldBeNil)
+		out, err = cfg.projectFields(out)
+		c.So(err, ShouldBeNil)
+		keys := configKeys(out)
+		c.So(keys, ShouldContain, "debug")
+		c.So(keys, ShouldNotContain, "editor")
+		c.So(keys, ShouldNotContain, "colorProfile")
+
+		// the project config takes precedence
+		project := []byte("editor: nano\n")
+		c.So(unmarshalConfig(project, cfg), ShouldBeNil)
+		cfg.setOrigins(project, configOriginProject)
+
+		info, err := cfg.which("editor")
+		c.So(err, ShouldBeNil)
+		c.So(info, ShouldStartWith, "editor: nano ("+configOriginProject)
+
+		info, err = cfg.which("colorProfile")
+		c.So(err, ShouldBeNil)
+		c.So(info, ShouldEqual, "colorProfile: light ("+configOriginUser+" "+userConfigPath()+")")
+
+		info, err = cfg.which("HistoryLimit")
+		c.So(err, ShouldBeNil)
+		c.So(info, ShouldEqual, "historyLimit: 20 ("+configOriginDefault+")")
+
+		_, err = cfg.which("noSuchField")
+		c.So(err, ShouldEqual, ErrUnknownConfigField)
+
+		// only the fields of an existing project config are written
+		cfg.project = true
+		cfg.origins = map[string]string{"editor": configOriginProject, "colorProfile": configOriginUser}
+		out, err = yaml.Marshal(cfg.fields)
+		c.So(err, ShouldBeNil)
+		out, err = cfg.projectFields(out)
+		c.So(err, ShouldBeNil)
+		c.So(configKeys(out), ShouldResemble, []string{"editor"})
+	})
+}
+
+func TestConfigReload(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing the config reload", t, func(c C) {
+
+		dir, err := ioutil.TempDir("", "zeus-config-reload")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		prev, hadPrev := os.LookupEnv("XDG_CONFIG_HOME")
+		os.Setenv("XDG_CONFIG_HOME", dir)
+		defer func() {
+			if hadPrev {
+				os.Setenv("XDG_CONFIG_HOME", prev)
+			} else {
+				os.Unsetenv("XDG_CONFIG_HOME")
+			}
+		}()
+
+		prevPath := projectConfigPath
+		projectConfigPath = filepath.Join(dir, "config.yml")
+		defer func() {
+			projectConfigPath = prevPath
+		}()
+
+		c.So(ioutil.WriteFile(projectConfigPath, []byte("editor: vim\nhistoryLimit: 50\n"), 0600), ShouldBeNil)
+
+		cfg := newConfig()
+		changes, warnings, err := cfg.reload()
+		c.So(err, ShouldBeNil)
+		c.So(warnings, ShouldBeEmpty)
+		c.So(cfg.fields.Editor, ShouldEqual, "vim")
+		c.So(len(changes), ShouldEqual, 2)
+		c.So(changes[0].String(), ShouldEqual, "historyLimit: 20 -> 50")
+		c.So(changes[0].restart(), ShouldBeTrue)
+		c.So(changes[1].String(), ShouldEqual, "editor: micro -> vim")
+		c.So(changes[1].restart(), ShouldBeFalse)
+
+		// unchanged files
+		changes, _, err = cfg.reload()
+		c.So(err, ShouldBeNil)
+		c.So(changes, ShouldBeEmpty)
+
+		// removed fields fall back to the user config and the defaults
+		c.So(os.MkdirAll(filepath.Join(dir, "zeus"), 0700), ShouldBeNil)
+		c.So(ioutil.WriteFile(userConfigPath(), []byte("editor: nano\n"), 0600), ShouldBeNil)
+		c.So(ioutil.WriteFile(projectConfigPath, []byte("codeSnippetScope: 5\n"), 0600), ShouldBeNil)
+
+		changes, _, err = cfg.reload()
+		c.So(err, ShouldBeNil)
+		var names []string
+		for _, change := range changes {
+			names = append(names, change.name)
+		}
+		c.So(names, ShouldResemble, []string{"historyLimit", "codeSnippetScope", "editor"})
+		c.So(cfg.fields.Editor, ShouldEqual, "nano")
+		c.So(cfg.fields.HistoryLimit, ShouldEqual, 20)
+
+		info, err := cfg.which("editor")
+		c.So(err, ShouldBeNil)
+		c.So(info, ShouldStartWith, "editor: nano ("+configOriginUser)
+
+		// complex values are only named
+		c.So(configChange{name: "languages", to: []*Language{}}.String(), ShouldEqual, "languages")
+	})
+}
+
 func TestCommands(t *testing.T) {
 
 	TestMainFunction(t)
@@ -215,8 +433,8 @@ func TestEvents(t *testing.T) {
 
 			printEvents()
 
-			// there should be only the config watcher event
-			c.So(len(projectData.fields.Events), ShouldEqual, 2)
+			// there should be only the internal watchers for the config, the CommandsFile and the scripts
+			c.So(len(projectData.fields.Events), ShouldEqual, 3)
 		}()
 
 		handleLine("events asdfasd")
@@ -232,7 +450,7 @@ func TestEvents(t *testing.T) {
 			projectData.Lock()
 			defer projectData.Unlock()
 
-			c.So(len(projectData.fields.Events), ShouldEqual, 3)
+			c.So(len(projectData.fields.Events), ShouldEqual, 4)
 		}()
 
 		projectData.Lock()
@@ -255,7 +473,7 @@ func TestEvents(t *testing.T) {
 			projectData.Lock()
 			defer projectData.Unlock()
 
-			c.So(len(projectData.fields.Events), ShouldEqual, 2)
+			c.So(len(projectData.fields.Events), ShouldEqual, 3)
 		}()
 	})
 }
@@ -321,13 +539,552 @@ func TestMakefileMigration(t *testing.T) {
 		// os.Remove("tests/zeus/migration-test")
 
 		// migrate test Makefile into tests/zeus
-		migrateMakefile("tests/zeus/migration-test")
+		migrateMakefile("tests/zeus/migration-test", "")
 
 		// clean up
 		// os.Remove("tests/zeus/migration-test")
 	})
 }
 
+func TestAsyncDependencies(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing async dependencies", t, func(c C) {
+
+		deps, async := splitAsyncDependencies([]string{"generate", "metrics-push &", "warm-cache env=dev&"})
+		c.So(deps, ShouldResemble, []string{"generate", "metrics-push", "warm-cache env=dev"})
+		c.So(async, ShouldResemble, []string{"metrics-push", "warm-cache env=dev"})
+
+		dir, err := ioutil.TempDir("", "zeus-async-deps")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		pushed := filepath.Join(dir, "pushed")
+
+		cmdMap.Lock()
+		cmdMap.items["ad-push"] = &command{name: "ad-push", language: "bash", exec: "sleep 1; touch " + pushed + "; exit 3"}
+		cmdMap.Unlock()
+		defer func() {
+			cmdMap.Lock()
+			delete(cmdMap.items, "ad-push")
+			cmdMap.Unlock()
+		}()
+
+		deps, async = splitAsyncDependencies([]string{"ad-push &"})
+		build := &command{name: "ad-build", language: "bash", exec: "true", dependencies: deps, asyncDeps: async}
+
+		// the command does not wait for the dependency, and its failure is ignored
+		start := time.Now()
+		c.So(build.Run([]string{}, false), ShouldBeNil)
+		c.So(time.Since(start), ShouldBeLessThan, time.Second)
+
+		// it is tracked in the process map
+		for i := 0; i < 25 && runningProcesses() == 0; i++ {
+			time.Sleep(20 * time.Millisecond)
+		}
+		c.So(runningProcesses(), ShouldEqual, 1)
+
+		asyncDependencies.Wait()
+		_, err = os.Stat(pushed)
+		c.So(err, ShouldBeNil)
+		c.So(runningProcesses(), ShouldEqual, 0)
+	})
+}
+
+func TestFinally(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing finally commands", t, func(c C) {
+
+		dir, err := ioutil.TempDir("", "zeus-finally")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		var (
+			log   = filepath.Join(dir, "log")
+			names = []string{"fin-setup", "fin-broken", "fin-stop-db", "fin-rm-ns"}
+		)
+
+		cmdMap.Lock()
+		cmdMap.items["fin-setup"] = &command{name: "fin-setup", language: "bash", exec: "echo setup >> " + log}
+		cmdMap.items["fin-broken"] = &command{name: "fin-broken", language: "bash", exec: "exit 2"}
+		cmdMap.items["fin-stop-db"] = &command{name: "fin-stop-db", language: "bash", exec: "echo stop-db >> " + log + "; exit 1"}
+		cmdMap.items["fin-rm-ns"] = &command{name: "fin-rm-ns", language: "bash", exec: "echo rm-ns >> " + log}
+		cmdMap.Unlock()
+		defer func() {
+			cmdMap.Lock()
+			for _, name := range names {
+				delete(cmdMap.items, name)
+			}
+			cmdMap.Unlock()
+		}()
+
+		readLog := func() string {
+			b, _ := ioutil.ReadFile(log)
+			os.Remove(log)
+			return string(b)
+		}
+
+		// the finalizers run after the failed step, the last registered first, even if one of them fails
+		e2e := &command{
+			name:         "fin-e2e",
+			language:     "bash",
+			exec:         "echo e2e >> " + log + "; exit 1",
+			dependencies: []string{"fin-setup"},
+			finally:      []string{"fin-stop-db", "fin-rm-ns"},
+		}
+		s.begin()
+		c.So(e2e.Run([]string{}, false), ShouldNotBeNil)
+		c.So(readLog(), ShouldEqual, "setup\ne2e\n")
+		s.end()
+		c.So(readLog(), ShouldEqual, "rm-ns\nstop-db\n")
+
+		// nested invocations do not run them, a failed dependency does not skip them
+		e2e.dependencies = []string{"fin-broken"}
+		s.begin()
+		s.begin()
+		c.So(e2e.Run([]string{}, false), ShouldNotBeNil)
+		s.end()
+		c.So(readLog(), ShouldEqual, "")
+		s.end()
+		c.So(readLog(), ShouldEqual, "rm-ns\nstop-db\n")
+
+		// they run once per invocation, and after an interrupt
+		s.begin()
+		finalizers.add(e2e)
+		finalizers.add(&command{name: "fin-other", finally: []string{"fin-rm-ns"}})
+		s.interrupt()
+		c.So(errors.Is(e2e.Run([]string{}, false), ErrInterrupted), ShouldBeTrue)
+		s.end()
+		c.So(readLog(), ShouldEqual, "rm-ns\nstop-db\n")
+
+		// commands that were never started register nothing
+		s.begin()
+		s.interrupt()
+		c.So(errors.Is(e2e.Run([]string{}, false), ErrInterrupted), ShouldBeTrue)
+		s.end()
+		c.So(readLog(), ShouldEqual, "")
+	})
+}
+
+func TestOrderOnlyDependencies(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing order-only dependencies", t, func(c C) {
+
+		deps, orderOnly := splitOrderOnly([]string{"generate", "| mkdir-bin", "|setup name=test"})
+		c.So(deps, ShouldResemble, []string{"generate", "mkdir-bin", "setup name=test"})
+		c.So(orderOnly, ShouldResemble, []string{"mkdir-bin", "setup name=test"})
+
+		dir, err := ioutil.TempDir("", "zeus-order-only")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		var (
+			generated = filepath.Join(dir, "gen.go")
+			bin       = filepath.Join(dir, "bin")
+			app       = filepath.Join(bin, "app")
+			now       = time.Now()
+		)
+		c.So(ioutil.WriteFile(generated, []byte("package main"), 0600), ShouldBeNil)
+		c.So(os.Mkdir(bin, 0700), ShouldBeNil)
+		c.So(ioutil.WriteFile(app, []byte(""), 0600), ShouldBeNil)
+
+		cmdMap.Lock()
+		cmdMap.items["oo-generate"] = &command{name: "oo-generate", language: "bash", exec: "true", outputs: []string{generated}}
+		cmdMap.items["oo-mkdir"] = &command{name: "oo-mkdir", language: "bash", exec: "true", outputs: []string{bin}}
+		cmdMap.Unlock()
+		defer func() {
+			cmdMap.Lock()
+			delete(cmdMap.items, "oo-generate")
+			delete(cmdMap.items, "oo-mkdir")
+			cmdMap.Unlock()
+		}()
+
+		deps, orderOnly = splitOrderOnly([]string{"oo-generate", "| oo-mkdir"})
+		build := &command{name: "oo-build", language: "bash", exec: "true", outputs: []string{app}, dependencies: deps, orderOnly: orderOnly}
+
+		// the directory changed after the build, it is order-only
+		os.Chtimes(generated, now.Add(-2*time.Hour), now.Add(-2*time.Hour))
+		os.Chtimes(app, now.Add(-time.Hour), now.Add(-time.Hour))
+		os.Chtimes(bin, now, now)
+		c.So(build.upToDate(), ShouldBeTrue)
+
+		// a regenerated file makes the build stale
+		os.Chtimes(generated, now, now)
+		c.So(build.upToDate(), ShouldBeFalse)
+
+		// the same for a normal dependency on the directory
+		os.Chtimes(generated, now.Add(-2*time.Hour), now.Add(-2*time.Hour))
+		build.orderOnly = nil
+		c.So(build.upToDate(), ShouldBeFalse)
+
+		os.Remove(app)
+		c.So(build.upToDate(), ShouldBeFalse)
+	})
+}
+
+func TestMakefileTranslation(t *testing.T) {
+
+	Convey("Testing makefile translation", t, func(c C) {
+
+		dir, err := ioutil.TempDir("", "zeus-makefile")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		ioutil.WriteFile(filepath.Join(dir, "main.c"), []byte("int main() {}"), 0600)
+		ioutil.WriteFile(filepath.Join(dir, "util.c"), []byte(""), 0600)
+
+		m := translateMakefile([]byte(`CC ?= gcc
+CFLAGS := -O2 \
+	-Wall
+CFLAGS += -g
+VERSION = $(shell git describe)
+CC ?= clang
+
+.PHONY: all clean
+
+all: bin/app
+
+bin/app: main.o util.o | bin
+	$(CC) -o $@ $^
+
+bin:
+	mkdir -p $@
+
+%.o: %.c
+	@$(CC) $(CFLAGS) -c $< -o $@
+
+clean:
+	-rm -f *.o $(wildcard bin/*)
+	for f in *.o; do echo $$f; done
+
+ifeq ($(CC),gcc)
+include extra.mk
+endif
+`), dir)
+
+		c.So(m.globalNames, ShouldResemble, []string{"CC", "CFLAGS", "VERSION"})
+		c.So(m.globals["CC"], ShouldEqual, "gcc")
+		c.So(m.globals["CFLAGS"], ShouldEqual, "-O2 -Wall -g")
+		c.So(m.globals["VERSION"], ShouldEqual, "$(git describe)")
+
+		var commands = make(map[string]*migratedCommand)
+		for _, cmd := range m.commands {
+			commands[cmd.name] = cmd
+		}
+		c.So(commands, ShouldHaveLength, 6)
+
+		c.So(commands["all"].dependencies, ShouldResemble, []string{"bin-app"})
+		c.So(commands["all"].outputs, ShouldBeEmpty)
+
+		app := commands["bin-app"]
+		c.So(app.dependencies, ShouldResemble, []string{"main.o", "util.o", "| bin"})
+		c.So(app.outputs, ShouldResemble, []string{"bin/app"})
+		c.So(app.script, ShouldResemble, []string{"${CC} -o bin/app main.o util.o"})
+
+		obj := commands["main.o"]
+		c.So(obj.inputs, ShouldResemble, []string{"main.c"})
+		c.So(obj.outputs, ShouldResemble, []string{"main.o"})
+		c.So(obj.script, ShouldResemble, []string{"${CC} ${CFLAGS} -c main.c -o main.o"})
+
+		clean := commands["clean"]
+		c.So(clean.script, ShouldResemble, []string{"rm -f *.o $(wildcard bin/*) || true", "for f in *.o; do echo $f; done"})
+		c.So(clean.notes, ShouldHaveLength, 1)
+
+		// the conditional and the include are reported
+		c.So(m.notes, ShouldHaveLength, 3)
+
+		out := m.render("globals:\n    CC: cc\n\ncommands:\n")
+		c.So(out, ShouldContainSubstring, "globals:\n    CFLAGS: -O2 -Wall -g\n")
+		c.So(out, ShouldNotContainSubstring, "CC: gcc")
+		c.So(out, ShouldContainSubstring, "    # - global CC exists already\n")
+
+		commandsFile := newCommandsFile()
+		c.So(yaml.Unmarshal([]byte(out), commandsFile), ShouldBeNil)
+		c.So(commandsFile.Commands["main.o"].Inputs, ShouldResemble, []string{"main.c"})
+		c.So(validateCommandsFile([]byte(out)), ShouldBeNil)
+	})
+}
+
+func TestNPMMigration(t *testing.T) {
+
+	Convey("Testing npm script migration", t, func(c C) {
+
+		_, err := translatePackageJSON([]byte(`{"name": "app"}`))
+		c.So(err, ShouldEqual, ErrNoScripts)
+
+		m, err := translatePackageJSON([]byte(`{
+	"scripts": {
+		"//": ["build:prod: bundle for production"],
+		"prebuild:prod": "npm run clean",
+		"build:prod": "webpack --mode production",
+		"postbuild:prod": "echo $npm_package_version",
+		"clean": "rimraf dist",
+		"test": "jest -- --ci"
+	},
+	"scripts-info": {
+		"clean": "remove the dist folder"
+	}
+}`))
+		c.So(err, ShouldBeNil)
+		c.So(m.commands, ShouldHaveLength, 5)
+
+		var commands = make(map[string]*migratedCommand)
+		for _, cmd := range m.commands {
+			commands[cmd.name] = cmd
+		}
+
+		build := commands["build-prod"]
+		c.So(build.description, ShouldEqual, "bundle for production")
+		c.So(build.dependencies, ShouldResemble, []string{"prebuild-prod"})
+		c.So(build.script[1:], ShouldResemble, []string{"webpack --mode production || exit $?", "echo $npm_package_version"})
+		c.So(build.notes, ShouldHaveLength, 1)
+
+		c.So(commands["clean"].description, ShouldEqual, "remove the dist folder")
+		c.So(commands["prebuild-prod"].script[1], ShouldEqual, "zeus clean")
+		c.So(commands["test"].notes, ShouldHaveLength, 1)
+
+		out := m.render("")
+		c.So(out, ShouldStartWith, "language: bash\n")
+		c.So(out, ShouldContainSubstring, "    # migrated from package.json\n")
+		c.So(validateCommandsFile([]byte(out)), ShouldBeNil)
+	})
+}
+
+func TestTaskfileMigration(t *testing.T) {
+
+	Convey("Testing Taskfile migration", t, func(c C) {
+
+		_, err := translateTaskfile([]byte("version: '3'\n"), "Taskfile.yml")
+		c.So(err, ShouldEqual, ErrNoTasks)
+
+		m, err := translateTaskfile([]byte(`version: '3'
+
+includes:
+  docs: ./docs
+
+vars:
+  BINARY: app
+  VERSION:
+    sh: git describe --tags
+
+env:
+  CGO_ENABLED: 0
+
+tasks:
+  build:
+    desc: build the binary
+    deps: [generate, {task: lint, vars: {STRICT: true}}]
+    sources:
+      - "**/*.go"
+    generates:
+      - bin/{{.BINARY}}
+    env:
+      GOOS: linux
+    cmds:
+      - go build -o bin/{{.BINARY}} {{.CLI_ARGS}}
+      - task: checksum
+      - cmd: upx bin/{{.BINARY}}
+        ignore_error: true
+      - defer: rm -rf tmp
+    status:
+      - test -f bin/{{.BINARY}}
+
+  generate: go generate ./...
+
+  lint:
+    dir: tools
+    cmds:
+      - golangci-lint run {{if .STRICT}}--strict{{end}}
+
+  checksum:
+    summary: |
+      write checksums
+
+      for all binaries
+    cmds:
+      - sha256sum bin/* > bin/checksums
+`), "Taskfile.yml")
+		c.So(err, ShouldBeNil)
+
+		c.So(m.globalNames, ShouldResemble, []string{"BINARY", "VERSION", "CGO_ENABLED"})
+		c.So(m.globals["VERSION"], ShouldEqual, "$(git describe --tags)")
+		c.So(m.notes, ShouldHaveLength, 1)
+
+		c.So(m.commands, ShouldHaveLength, 4)
+
+		build := m.commands[0]
+		c.So(build.description, ShouldEqual, "build the binary")
+		c.So(build.dependencies, ShouldResemble, []string{"generate", "lint"})
+		c.So(build.inputs, ShouldResemble, []string{"**/*.go"})
+		c.So(build.outputs, ShouldResemble, []string{"bin/${BINARY}"})
+		c.So(build.script, ShouldResemble, []string{
+			"trap \"rm -rf tmp\" EXIT",
+			"export GOOS=\"linux\"",
+			"go build -o bin/${BINARY} $@",
+			"zeus checksum",
+			"upx bin/${BINARY} || true",
+		})
+
+		// variables passed to lint and the status field
+		c.So(build.notes, ShouldHaveLength, 2)
+
+		c.So(m.commands[1].script, ShouldResemble, []string{"go generate ./..."})
+		c.So(m.commands[2].script[0], ShouldEqual, "cd \"tools\" || exit 1")
+		c.So(m.commands[2].notes, ShouldHaveLength, 2)
+		c.So(m.commands[3].description, ShouldEqual, "write checksums")
+
+		out := m.render("")
+		c.So(out, ShouldContainSubstring, "    # migrated from Taskfile.yml\n")
+		c.So(validateCommandsFile([]byte(out)), ShouldBeNil)
+	})
+}
+
+func TestJustfileMigration(t *testing.T) {
+
+	Convey("Testing Justfile migration", t, func(c C) {
+
+		_, err := translateJustfile([]byte("set shell := [\"bash\", \"-c\"]\n"), "justfile")
+		c.So(err, ShouldEqual, ErrNoRecipes)
+
+		m, err := translateJustfile([]byte(`set dotenv-load
+alias b := build
+
+export RUST_LOG := "info"
+version := `+"`git describe`"+`
+target := os() + "-bin"
+
+# build the project
+build: clean (lint "strict") && notify
+    cargo build --release
+    @echo built {{version}}
+    -rm -rf tmp
+
+clean:
+    rm -rf target
+
+[private]
+lint mode="default":
+    #!/usr/bin/env bash
+    cargo clippy -- {{ mode }} {{ uppercase(mode) }}
+
+notify:
+    echo done {{{{literal}}
+`), "justfile")
+		c.So(err, ShouldBeNil)
+
+		c.So(m.globalNames, ShouldResemble, []string{"RUST_LOG", "version", "target"})
+		c.So(m.globals["RUST_LOG"], ShouldEqual, "info")
+		c.So(m.globals["version"], ShouldEqual, "$(git describe)")
+
+		// set, alias and the expression
+		c.So(m.notes, ShouldHaveLength, 3)
+
+		c.So(m.commands, ShouldHaveLength, 4)
+
+		build := m.commands[0]
+		c.So(build.description, ShouldEqual, "build the project")
+		c.So(build.dependencies, ShouldResemble, []string{"clean", "lint"})
+		c.So(build.script, ShouldResemble, []string{
+			"cargo build --release",
+			"echo built ${version}",
+			"rm -rf tmp || true",
+			"zeus notify",
+		})
+		c.So(build.notes, ShouldHaveLength, 1)
+
+		lint := m.commands[2]
+		c.So(lint.script, ShouldResemble, []string{"cargo clippy -- ${mode} {{ uppercase(mode) }}"})
+
+		// attribute, parameters, shebang and expression
+		c.So(lint.notes, ShouldHaveLength, 4)
+
+		c.So(m.commands[3].script, ShouldResemble, []string{"echo done {{literal}}"})
+
+		out := m.render("")
+		c.So(validateCommandsFile([]byte(out)), ShouldBeNil)
+	})
+}
+
+func TestMigrationConflicts(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing migration conflict resolution", t, func(c C) {
+
+		_, err := parseConflictPolicy([]string{migrateFlagNonInteractive, "ignore"})
+		c.So(err, ShouldEqual, ErrUnknownConflictPolicy)
+		policy, err := parseConflictPolicy([]string{migrateFlagNonInteractive, conflictMerge})
+		c.So(err, ShouldBeNil)
+		c.So(policy, ShouldEqual, conflictMerge)
+
+		cmdMap.Lock()
+		for _, name := range []string{"mc-build", "mc-test"} {
+			cmdMap.items[name] = &command{name: name, language: "bash", exec: "true"}
+		}
+		cmdMap.Unlock()
+		defer func() {
+			cmdMap.Lock()
+			delete(cmdMap.items, "mc-build")
+			delete(cmdMap.items, "mc-test")
+			cmdMap.Unlock()
+		}()
+
+		var (
+			existing = "language: bash\n\ncommands:\n\n    mc-build:\n        description: build\n        exec: go build\n\n    mc-test:\n        dependencies: [mc-build]\n        exec: go test\n"
+			migrate  = func() *migration {
+				m := newMigration("Makefile")
+				m.commands = []*migratedCommand{
+					{name: "mc-build", script: []string{"make build"}},
+					{name: "mc-test", dependencies: []string{"mc-build", "mc-lint"}, script: []string{"make test"}},
+					{name: "mc-lint", script: []string{"make lint"}},
+				}
+				return m
+			}
+		)
+
+		// without a terminal there is nobody to ask
+		m := migrate()
+		c.So(m.resolveConflicts(""), ShouldNotBeNil)
+
+		m = migrate()
+		c.So(m.resolveConflicts(conflictKeep), ShouldBeNil)
+		c.So(m.commands, ShouldHaveLength, 1)
+		c.So(m.commands[0].name, ShouldEqual, "mc-lint")
+
+		m = migrate()
+		c.So(m.resolveConflicts(conflictRename), ShouldBeNil)
+		c.So(m.commands[0].name, ShouldEqual, "mc-build-migrated")
+		c.So(m.commands[1].dependencies, ShouldResemble, []string{"mc-build-migrated", "mc-lint"})
+
+		m = migrate()
+		c.So(m.resolveConflicts(conflictOverwrite), ShouldBeNil)
+		out := m.render(existing)
+		c.So(out, ShouldNotContainSubstring, "go build")
+		c.So(out, ShouldNotContainSubstring, "go test")
+		c.So(validateCommandsFile([]byte(out)), ShouldBeNil)
+
+		m = migrate()
+		c.So(m.resolveConflicts(conflictMerge), ShouldBeNil)
+		c.So(m.commands, ShouldHaveLength, 1)
+		out = m.render(existing)
+		c.So(out, ShouldContainSubstring, "go build")
+
+		commandsFile := newCommandsFile()
+		c.So(yaml.Unmarshal([]byte(out), commandsFile), ShouldBeNil)
+		c.So(commandsFile.Commands["mc-test"].Dependencies, ShouldResemble, []string{"mc-build", "mc-lint"})
+		c.So(commandsFile.Commands["mc-build"].Dependencies, ShouldBeEmpty)
+		c.So(commandsFile.Commands["mc-test"].Exec, ShouldEqual, "go test")
+		c.So(commandsFile.Commands["mc-lint"], ShouldNotBeNil)
+
+		out = mergeYAMLDependencies(existing, "mc-build", nil, []string{"mc-lint"})
+		c.So(out, ShouldContainSubstring, "    mc-build:\n        dependencies:\n            - mc-lint\n        description: build\n")
+	})
+}
+
 func TestAuthorCommand(t *testing.T) {
 
 	TestMainFunction(t)
@@ -472,7 +1229,7 @@ func TestGenerate(t *testing.T) {
 		handleLine("generate build.sh build")
 		handleLine("generate testChain.sh async -> optional bla=asdf req=asdfd -> error")
 
-		os.Remove("tests/zeus/generated")
+		os.RemoveAll(filepath.Join(zeusDir, "generated"))
 	})
 }
 
@@ -552,3 +1309,5683 @@ func TestCustomCompleters(t *testing.T) {
 		c.So(directoryCompleter(""), ShouldNotBeEmpty)
 	})
 }
+
+func TestCISummary(t *testing.T) {
+
+	Convey("Testing the CI run summary", t, func(c C) {
+
+		summary := renderCISummary(newCIConfig(), []*runRecord{
+			{Name: "clean", Skipped: true},
+			{Name: "build", Args: []string{"name=test"}, Duration: time.Second},
+			{Name: "deploy", Err: errors.New("exit status 1"), StdErr: "line1\nline2\n"},
+		})
+
+		c.So(summary, ShouldStartWith, ciCommentMarker)
+		c.So(summary, ShouldContainSubstring, "| `clean` | skipped |")
+		c.So(summary, ShouldContainSubstring, "| `build name=test` | ok | 1s |")
+		c.So(summary, ShouldContainSubstring, "<details><summary>deploy: exit status 1</summary>")
+		c.So(tailLines("a\nb\nc\n", 2), ShouldEqual, "b\nc")
+	})
+}
+
+func TestOutputMultiplexer(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing the output multiplexer", t, func(c C) {
+
+		var (
+			out bytes.Buffer
+			m   = newOutputMultiplexer(&out)
+			w1  = m.writer("build", false)
+			w2  = m.writer("test", true)
+		)
+
+		conf.Lock()
+		conf.fields.Colors = false
+		conf.Unlock()
+
+		w1.Write([]byte("compiling"))
+		c.So(out.String(), ShouldBeEmpty)
+		w2.Write([]byte("running\n"))
+		c.So(out.String(), ShouldBeEmpty)
+		w1.Write([]byte("...\ndone\n"))
+		c.So(out.String(), ShouldEqual, "build | compiling...\nbuild | done\n")
+		w2.flush()
+		c.So(out.String(), ShouldEndWith, "test  | running\n")
+
+		conf.Lock()
+		conf.fields.Colors = true
+		conf.Unlock()
+	})
+}
+
+func TestSarifReports(t *testing.T) {
+
+	Convey("Testing SARIF report handling", t, func(c C) {
+
+		reports, err := validateReports([]string{"sarif=bin/out.sarif"})
+		c.So(err, ShouldBeNil)
+		c.So(reports[0].path, ShouldEqual, "bin/out.sarif")
+
+		_, err = validateReports([]string{"junit=bin/out.xml"})
+		c.So(err, ShouldNotBeNil)
+
+		_, err = validateReports([]string{"sarif"})
+		c.So(err, ShouldNotBeNil)
+
+		var (
+			dir   = os.TempDir()
+			file1 = filepath.Join(dir, "zeus1.sarif")
+			file2 = filepath.Join(dir, "zeus2.sarif")
+		)
+		ioutil.WriteFile(file1, []byte(`{"version":"2.1.0","runs":[{"tool":{"driver":{"name":"a"}}}]}`), 0600)
+		ioutil.WriteFile(file2, []byte(`{"version":"2.1.0","runs":[{"tool":{"driver":{"name":"b"}}}]}`), 0600)
+		defer os.Remove(file1)
+		defer os.Remove(file2)
+
+		merged, err := mergeSarifFiles([]string{file1, file2})
+		c.So(err, ShouldBeNil)
+
+		var log sarifLog
+		c.So(json.Unmarshal(merged, &log), ShouldBeNil)
+		c.So(log.Runs, ShouldHaveLength, 2)
+	})
+}
+
+func TestCommandLogs(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing command logs", t, func(c C) {
+
+		dir, err := ioutil.TempDir("", "zeus-logs")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		conf.Lock()
+		conf.fields.LogDir = dir
+		conf.fields.LogRetention = 2
+		conf.Unlock()
+
+		defer func() {
+			conf.Lock()
+			conf.fields.LogDir = ""
+			conf.fields.LogRetention = 10
+			conf.Unlock()
+		}()
+
+		for i := 0; i < 3; i++ {
+			f, err := openCommandLog("build")
+			c.So(err, ShouldBeNil)
+			f.Close()
+			time.Sleep(5 * time.Millisecond)
+		}
+
+		// must not be listed for build
+		ioutil.WriteFile(filepath.Join(dir, "build-race-2017-01-01_00-00-00.000.log"), nil, 0600)
+
+		c.So(commandLogs("build"), ShouldHaveLength, 2)
+		c.So(commandLogs("build-race"), ShouldHaveLength, 1)
+	})
+}
+
+func TestCompliance(t *testing.T) {
+
+	Convey("Testing license compliance checks", t, func(c C) {
+
+		c.So(detectLicense("MIT License\n\nPermission is hereby granted, free\nof charge, to any person"), ShouldEqual, "MIT")
+		c.So(detectLicense("GNU LESSER GENERAL PUBLIC LICENSE\nVersion 3, 29 June 2007\nGNU General Public License"), ShouldEqual, "LGPL-3.0")
+		c.So(detectLicense("// SPDX-License-Identifier: Apache-2.0"), ShouldEqual, "Apache-2.0")
+		c.So(detectLicense("all rights reserved"), ShouldEqual, unknownLicense)
+
+		findings := parseScannerOutput("github.com/a/b,https://github.com/a/b/LICENSE,MIT\ngithub.com/c/d GPL-3.0\n")
+		c.So(findings, ShouldHaveLength, 2)
+		c.So(findings[1].license, ShouldEqual, "GPL-3.0")
+
+		_, err := newComplianceCheck(&complianceData{Inputs: []string{"vendor"}}, nil)
+		c.So(err, ShouldEqual, ErrNoLicenseAllowlist)
+
+		dir, err := ioutil.TempDir("", "zeus-compliance")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		ioutil.WriteFile(filepath.Join(dir, "LICENSE"), []byte("GNU GENERAL PUBLIC LICENSE\nVersion 3"), 0600)
+
+		check, err := newComplianceCheck(&complianceData{Inputs: []string{dir}}, []string{"mit"})
+		c.So(err, ShouldBeNil)
+		c.So(check.run("test"), ShouldNotBeNil)
+
+		check.allow = append(check.allow, "gpl-3.0")
+		c.So(check.run("test"), ShouldBeNil)
+	})
+}
+
+func TestProfile(t *testing.T) {
+
+	Convey("Testing command profiling", t, func(c C) {
+
+		var (
+			start   = time.Now()
+			records = []*runRecord{
+				{Name: "clean", Start: start, Duration: time.Second},
+				{Name: "build", Start: start.Add(time.Second), Duration: 3 * time.Second},
+				{Name: "lint", Start: start.Add(time.Second), Duration: time.Second, Err: errors.New("failed")},
+				{Name: "build", Start: start.Add(4 * time.Second), Skipped: true},
+			}
+		)
+
+		c.So(wallTime(records), ShouldEqual, 4*time.Second)
+
+		profiles := profileCommands(records)
+		c.So(profiles, ShouldHaveLength, 3)
+		c.So(profiles[0].name, ShouldEqual, "build")
+		c.So(profiles[0].runs, ShouldEqual, 1)
+		c.So(profiles[0].skipped, ShouldEqual, 1)
+
+		trace := newTrace(records)
+		c.So(trace.TraceEvents, ShouldHaveLength, 4)
+
+		// build and lint overlap and must be placed on different threads
+		c.So(trace.TraceEvents[1].TID, ShouldNotEqual, trace.TraceEvents[2].TID)
+		c.So(trace.TraceEvents[1].Timestamp, ShouldEqual, int64(time.Second/time.Microsecond))
+	})
+}
+
+func TestSBOM(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing SBOM generation", t, func(c C) {
+
+		dir, err := ioutil.TempDir("", "zeus-sbom")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		artifact := filepath.Join(dir, "artifact")
+		ioutil.WriteFile(artifact, []byte("zeus"), 0644)
+
+		c.So(generateSBOMs("package", []string{artifact}), ShouldBeNil)
+
+		sum, err := ioutil.ReadFile(artifact + ".sha256")
+		c.So(err, ShouldBeNil)
+		c.So(string(sum), ShouldStartWith, "5667ef73")
+
+		// without syft the modules are collected from the go.sum of the project
+		contents, err := ioutil.ReadFile(sbomPath(artifact, sbomFormatCycloneDX))
+		c.So(err, ShouldBeNil)
+
+		var doc cycloneDX
+		c.So(json.Unmarshal(contents, &doc), ShouldBeNil)
+		c.So(doc.BomFormat, ShouldEqual, "CycloneDX")
+		c.So(doc.Metadata.Component.Hashes, ShouldHaveLength, 1)
+
+		spdx := newSPDXDocument("artifact", "", []*sbomComponent{{path: "github.com/mgutz/ansi", version: "v0.0.0"}})
+		c.So(spdx.Packages, ShouldHaveLength, 2)
+		c.So(spdx.Packages[1].ExternalRefs[0].Locator, ShouldEqual, "pkg:golang/github.com/mgutz/ansi@v0.0.0")
+	})
+}
+
+func TestRelease(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing the release builtin", t, func(c C) {
+
+		dir, err := ioutil.TempDir("", "zeus-release")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		artifact := filepath.Join(dir, "artifact")
+		cmdMap.Lock()
+		cmdMap.items["release-package"] = &command{name: "release-package", language: "bash", exec: "true", outputs: []string{artifact}, sbom: true}
+		cmdMap.Unlock()
+		defer func() {
+			cmdMap.Lock()
+			delete(cmdMap.items, "release-package")
+			cmdMap.Unlock()
+		}()
+
+		c.So(handleReleaseCommand([]string{releaseCommand}), ShouldEqual, ErrInvalidUsage)
+		c.So(handleReleaseCommand([]string{releaseCommand, "v1.0.0", releaseFlagDryRun}).Error(), ShouldStartWith, ErrMissingReleaseFile.Error()+": "+artifact)
+
+		ioutil.WriteFile(artifact, []byte("zeus"), 0644)
+		c.So(generateSBOMs("release-package", []string{artifact}), ShouldBeNil)
+
+		assets, err := releaseAssets()
+		c.So(err, ShouldBeNil)
+		c.So(assets, ShouldResemble, []string{artifact, artifact + ".sha256", artifact + ".cdx.json"})
+
+		var (
+			mu       sync.Mutex
+			uploaded []string
+			deleted  []string
+			srv      *httptest.Server
+		)
+		srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case r.Method == "GET" && r.URL.Path == "/repos/dreadl0ck/zeus/releases":
+				w.Write([]byte(`[{"id": 1, "tag_name": "v1.0.0", "upload_url": "` + srv.URL + `/uploads/1/assets{?name,label}", "assets": [{"id": 7, "name": "artifact"}]}]`))
+			case r.Method == "DELETE" && r.URL.Path == "/repos/dreadl0ck/zeus/releases/assets/7":
+				deleted = append(deleted, "artifact")
+			case r.Method == "POST" && r.URL.Path == "/uploads/1/assets":
+				uploaded = append(uploaded, r.URL.Query().Get("name"))
+				w.WriteHeader(http.StatusCreated)
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+		defer srv.Close()
+
+		conf.Lock()
+		ci := conf.fields.CI
+		conf.fields.CI = &ciConfig{APIURL: srv.URL}
+		conf.Unlock()
+		defer func() {
+			conf.Lock()
+			conf.fields.CI = ci
+			conf.Unlock()
+		}()
+
+		os.Setenv("GITHUB_TOKEN", "token")
+		os.Setenv("GITHUB_REPOSITORY", "dreadl0ck/zeus")
+		defer os.Unsetenv("GITHUB_TOKEN")
+		defer os.Unsetenv("GITHUB_REPOSITORY")
+
+		// the existing release is reused and the asset with the same name replaced
+		c.So(handleReleaseCommand([]string{releaseCommand, "v1.0.0"}), ShouldBeNil)
+		c.So(deleted, ShouldResemble, []string{"artifact"})
+		c.So(uploaded, ShouldResemble, []string{"artifact", "artifact.sha256", "artifact.cdx.json"})
+	})
+}
+
+func TestRunHistory(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing the run history", t, func(c C) {
+
+		os.Remove(runHistoryPath())
+		defer os.Remove(runHistoryPath())
+
+		conf.Lock()
+		conf.fields.RunHistorySize = 4
+		conf.Unlock()
+
+		defer func() {
+			conf.Lock()
+			conf.fields.RunHistorySize = 10000
+			conf.Unlock()
+		}()
+
+		runHistory.path = ""
+		for i := 0; i < 5; i++ {
+			runHistory.append(&runRecord{Name: "build", Start: time.Now(), Duration: time.Duration(i) * time.Second})
+		}
+		runHistory.append(&runRecord{Name: "test", Start: time.Now(), Duration: 10 * time.Second, Err: errors.New("failed")})
+
+		entries, err := readRunHistory()
+		c.So(err, ShouldBeNil)
+		c.So(len(entries), ShouldBeLessThanOrEqualTo, 4)
+		c.So(entries[len(entries)-1].ExitCode, ShouldEqual, -1)
+
+		stats := runStats(entries)
+		c.So(stats[0].name, ShouldEqual, "test")
+		c.So(stats[0].failureRate(), ShouldEqual, 100)
+		c.So(stats[1].slowest, ShouldEqual, 4*time.Second)
+	})
+}
+
+func TestExtraArgs(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing pass-through of extra arguments", t, func(c C) {
+
+		parsed, extra := splitExtraArgs([]string{"name=test", "--", "-run", "TestFoo", "--", "-v"})
+		c.So(parsed, ShouldResemble, []string{"name=test"})
+		c.So(extra, ShouldResemble, []string{"-run", "TestFoo", "--", "-v"})
+
+		parsed, extra = splitExtraArgs([]string{"name=test"})
+		c.So(parsed, ShouldResemble, []string{"name=test"})
+		c.So(extra, ShouldBeNil)
+
+		c.So(quoteExtraArgs([]string{"-run", "Test Foo", "it's"}), ShouldEqual, `'-run' 'Test Foo' 'it'\''s'`)
+
+		dir, err := ioutil.TempDir("", "zeus-extra-args")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		var (
+			out = filepath.Join(dir, "out")
+			env = filepath.Join(dir, "env")
+		)
+
+		cmdMap.Lock()
+		cmdMap.items["extra-args"] = &command{
+			name:     "extra-args",
+			language: "bash",
+			args:     map[string]*commandArg{},
+			exec:     `echo "$0 $# $1 $2" > ` + out + `; echo "$ZEUS_ARGS" > ` + env,
+		}
+		cmdMap.Unlock()
+		defer func() {
+			cmdMap.Lock()
+			delete(cmdMap.items, "extra-args")
+			cmdMap.Unlock()
+		}()
+
+		cmd, err := cmdMap.getCommand("extra-args")
+		c.So(err, ShouldBeNil)
+
+		// the extra arguments are not validated
+		_, err = cmd.parseArguments([]string{"--", "-v"})
+		c.So(err, ShouldBeNil)
+		_, err = cmd.parseArguments([]string{"-v"})
+		c.So(err, ShouldNotBeNil)
+
+		c.So(cmd.Run([]string{"--", "-run", "Test Foo"}, false), ShouldBeNil)
+
+		contents, err := ioutil.ReadFile(out)
+		c.So(err, ShouldBeNil)
+		c.So(string(contents), ShouldEqual, "extra-args 2 -run Test Foo\n")
+
+		contents, err = ioutil.ReadFile(env)
+		c.So(err, ShouldBeNil)
+		c.So(string(contents), ShouldEqual, "'-run' 'Test Foo'\n")
+	})
+}
+
+func TestLifecycleEnv(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing the lifecycle variables of commands", t, func(c C) {
+
+		dir, err := ioutil.TempDir("", "zeus-lifecycle")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		out := filepath.Join(dir, "env")
+		script := `echo "$ZEUS_COMMAND|$ZEUS_PARENT|$ZEUS_ATTEMPT|$ZEUS_RUN_ID|$ZEUS_INVOCATION_TIME|$ZEUS_IS_CI" >> ` + out
+
+		cmdMap.Lock()
+		cmdMap.items["lc-dep"] = &command{name: "lc-dep", language: "bash", exec: script}
+		cmdMap.Unlock()
+		defer func() {
+			cmdMap.Lock()
+			delete(cmdMap.items, "lc-dep")
+			cmdMap.Unlock()
+		}()
+
+		main := &command{name: "lc-main", language: "bash", exec: script, dependencies: []string{"lc-dep"}}
+
+		s.begin()
+		c.So(main.Run([]string{}, false), ShouldBeNil)
+		c.So(main.AtomicRun([]string{}, false), ShouldBeNil)
+		s.end()
+
+		contents, err := ioutil.ReadFile(out)
+		c.So(err, ShouldBeNil)
+		lines := strings.Split(strings.TrimSpace(string(contents)), "\n")
+		c.So(len(lines), ShouldEqual, 3)
+
+		dep := strings.Split(lines[0], "|")
+		first := strings.Split(lines[1], "|")
+		second := strings.Split(lines[2], "|")
+
+		c.So(dep[:3], ShouldResemble, []string{"lc-dep", "lc-main", "1"})
+		c.So(first[:3], ShouldResemble, []string{"lc-main", "", "1"})
+		c.So(second[:3], ShouldResemble, []string{"lc-main", "", "2"})
+
+		// all commands of the invocation share the id and the start
+		c.So(dep[3], ShouldNotBeEmpty)
+		c.So(first[3], ShouldEqual, dep[3])
+		c.So(second[3:5], ShouldResemble, dep[3:5])
+		_, err = time.Parse(time.RFC3339, dep[4])
+		c.So(err, ShouldBeNil)
+		c.So(dep[5], ShouldEqual, strconv.FormatBool(ciMode))
+
+		// the next invocation gets a new id
+		c.So(os.Remove(out), ShouldBeNil)
+		s.begin()
+		c.So(main.AtomicRun([]string{}, false), ShouldBeNil)
+		s.end()
+
+		contents, err = ioutil.ReadFile(out)
+		c.So(err, ShouldBeNil)
+		next := strings.Split(strings.TrimSpace(string(contents)), "|")
+		c.So(next[2], ShouldEqual, "1")
+		c.So(next[3], ShouldNotEqual, dep[3])
+	})
+}
+
+func TestBatchMode(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing batch mode", t, func(c C) {
+
+		dir, err := ioutil.TempDir("", "zeus-batch")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		var (
+			first = filepath.Join(dir, "first")
+			last  = filepath.Join(dir, "last")
+		)
+
+		cmdMap.Lock()
+		cmdMap.items["bt-first"] = &command{name: "bt-first", language: "bash", exec: "touch " + first}
+		cmdMap.items["bt-fail"] = &command{name: "bt-fail", language: "bash", exec: "exit 6"}
+		cmdMap.items["bt-last"] = &command{name: "bt-last", language: "bash", exec: "touch " + last}
+		cmdMap.Unlock()
+		defer func() {
+			cmdMap.Lock()
+			delete(cmdMap.items, "bt-first")
+			delete(cmdMap.items, "bt-fail")
+			delete(cmdMap.items, "bt-last")
+			cmdMap.Unlock()
+		}()
+
+		c.So(runBatch(strings.NewReader("# generated\n\nbt-first\n")), ShouldBeNil)
+		_, err = os.Stat(first)
+		c.So(err, ShouldBeNil)
+
+		// the lines after a failure are skipped
+		err = runBatch(strings.NewReader("bt-first -> bt-fail\nbt-last\n"))
+		c.So(exitStatus(err), ShouldEqual, 6)
+		_, err = os.Stat(last)
+		c.So(os.IsNotExist(err), ShouldBeTrue)
+
+		// unknown commands are not passed to the shell
+		err = runBatch(strings.NewReader("bt-missing\n"))
+		c.So(err.Error(), ShouldEqual, ErrUnknownCommand.Error()+": bt-missing")
+
+		c.So(handleBatchCommand([]string{batchCommand}), ShouldEqual, ErrInvalidUsage)
+	})
+}
+
+func TestTypedGlobals(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing typed globals", t, func(c C) {
+
+		var raw map[string]*globalData
+		c.So(yaml.Unmarshal([]byte(`
+name: zeus
+debug: false
+workers: 4
+version: 1.10
+bin: ${HOME}/bin
+target: ${bin}/${name}
+path: ${PATH}:${bin}
+other: ${ZEUS_UNKNOWN_GLOBAL}
+empty:
+`), &raw), ShouldBeNil)
+
+		vars, types, err := parseGlobals(raw, nil)
+		c.So(err, ShouldBeNil)
+		c.So(types["debug"], ShouldEqual, globalTypeBool)
+		c.So(types["workers"], ShouldEqual, globalTypeInt)
+		c.So(types["version"], ShouldEqual, globalTypeFloat)
+		c.So(vars["version"], ShouldEqual, "1.10")
+		c.So(vars["bin"], ShouldEqual, os.Getenv("HOME")+"/bin")
+		c.So(vars["target"], ShouldEqual, os.Getenv("HOME")+"/bin/zeus")
+		c.So(vars["path"], ShouldEqual, os.Getenv("PATH")+":"+os.Getenv("HOME")+"/bin")
+		c.So(vars["other"], ShouldEqual, "${ZEUS_UNKNOWN_GLOBAL}")
+		c.So(vars["empty"], ShouldEqual, "")
+
+		c.So(yaml.Unmarshal([]byte("a: ${b}\nb: ${a}\n"), &raw), ShouldBeNil)
+		_, _, err = parseGlobals(raw, nil)
+		c.So(err, ShouldNotBeNil)
+
+		c.So(yaml.Unmarshal([]byte("a: [1, 2]\n"), &raw), ShouldEqual, ErrUnsupportedGlobalType)
+
+		python, err := ls.getLang("python")
+		c.So(err, ShouldBeNil)
+		bash, err := ls.getLang("bash")
+		c.So(err, ShouldBeNil)
+
+		c.So(python.literal("true", globalTypeBool), ShouldEqual, "True")
+		c.So(bash.literal("false", globalTypeBool), ShouldEqual, "false")
+		c.So(bash.literal(`say "hi"`, globalTypeString), ShouldEqual, `"say \"hi\""`)
+		c.So(bash.literal("42", ""), ShouldEqual, "42")
+
+		// the env of a command is merged over the project globals
+		g.Lock()
+		g.Vars["tg_name"], g.types["tg_name"] = "zeus", globalTypeString
+		g.Unlock()
+		defer func() {
+			g.Lock()
+			delete(g.Vars, "tg_name")
+			delete(g.types, "tg_name")
+			g.Unlock()
+		}()
+
+		cmd := &command{
+			name:     "tg-env",
+			language: "bash",
+			env:      map[string]string{"tg_name": "release", "tg_debug": "true"},
+			envTypes: map[string]string{"tg_name": globalTypeString, "tg_debug": globalTypeBool},
+		}
+		out := generateGlobals(python, cmd)
+		c.So(out, ShouldContainSubstring, `tg_name = "release"`)
+		c.So(out, ShouldContainSubstring, "tg_debug = True")
+		c.So(generateGlobals(python, nil), ShouldContainSubstring, `tg_name = "zeus"`)
+
+		// the env is exported when running the command
+		f := filepath.Join(os.TempDir(), "zeus-typed-globals")
+		defer os.Remove(f)
+
+		cmd = &command{
+			name:     "tg-run",
+			language: "bash",
+			exec:     "echo $TG_TARGET > " + f,
+			env:      map[string]string{"TG_TARGET": "release"},
+			envTypes: map[string]string{"TG_TARGET": globalTypeString},
+		}
+		c.So(cmd.Run([]string{}, false), ShouldBeNil)
+		b, err := ioutil.ReadFile(f)
+		c.So(err, ShouldBeNil)
+		c.So(string(b), ShouldEqual, "release\n")
+	})
+}
+
+func TestDynamicGlobals(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing dynamic globals", t, func(c C) {
+
+		dir, err := ioutil.TempDir("", "zeus-dynamic")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		var (
+			counter = filepath.Join(dir, "counter")
+			out     = filepath.Join(dir, "out")
+			value   = "$(echo run >> " + counter + "; echo abc123)"
+		)
+
+		substitutions.reset()
+		defer substitutions.reset()
+
+		c.So(isDynamic(value), ShouldBeTrue)
+		c.So(isDynamic("${HOME}/bin"), ShouldBeFalse)
+
+		// the snippet runs only once per invocation
+		v, err := substitutions.eval(value)
+		c.So(err, ShouldBeNil)
+		c.So(v, ShouldEqual, "abc123")
+		c.So(substitutions.expand("sha-"+value), ShouldEqual, "sha-abc123")
+		c.So(substitutions.expand(value), ShouldEqual, "abc123")
+
+		b, err := ioutil.ReadFile(counter)
+		c.So(err, ShouldBeNil)
+		c.So(string(b), ShouldEqual, "run\nrun\n")
+
+		substitutions.reset()
+		c.So(substitutions.expand(value), ShouldEqual, "abc123")
+		b, _ = ioutil.ReadFile(counter)
+		c.So(strings.Count(string(b), "run"), ShouldEqual, 3)
+
+		// failing snippets are reported with the name of the global
+		err = evaluateGlobals(map[string]string{"broken": "$(exit 3)"})
+		c.So(err, ShouldNotBeNil)
+		c.So(err.Error(), ShouldStartWith, "global broken: exit status 3")
+		c.So(substitutions.expand("$(exit 3)"), ShouldEqual, "$(exit 3)")
+
+		// commands see the result in the environment and as a variable
+		g.Lock()
+		g.Vars["DG_SHA"] = "$(echo abc123)"
+		g.Unlock()
+		defer func() {
+			g.Lock()
+			delete(g.Vars, "DG_SHA")
+			g.Unlock()
+		}()
+
+		cmd := &command{
+			name:     "dg-run",
+			language: "bash",
+			exec:     "echo $DG_SHA $(printenv DG_SHA) > " + out,
+		}
+		c.So(cmd.Run([]string{}, false), ShouldBeNil)
+		b, err = ioutil.ReadFile(out)
+		c.So(err, ShouldBeNil)
+		c.So(string(b), ShouldEqual, "abc123 abc123\n")
+
+		cmd = &command{
+			name:     "dg-fail",
+			language: "bash",
+			exec:     "true",
+			env:      map[string]string{"DG_BROKEN": "$(exit 3)"},
+		}
+		c.So(cmd.Run([]string{}, false), ShouldNotBeNil)
+	})
+}
+
+func TestComputedGlobals(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing computed and lazy globals", t, func(c C) {
+
+		dir, err := ioutil.TempDir("", "zeus-computed")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		var (
+			counter = filepath.Join(dir, "counter")
+			out     = filepath.Join(dir, "out")
+		)
+
+		substitutions.reset()
+		defer substitutions.reset()
+
+		// templates
+		os.Setenv("COMPUTED_ENV", "from-env")
+		defer os.Unsetenv("COMPUTED_ENV")
+
+		c.So(isDynamic("{{ gitSHA }}"), ShouldBeTrue)
+		c.So(substitutions.expand(`{{ env "COMPUTED_ENV" }}-{{ sh "echo abc" }}`), ShouldEqual, "from-env-abc")
+		c.So(substitutions.expand(`{{ date "2006" }}`), ShouldEqual, artifactTime().Format("2006"))
+		c.So(substitutions.expand(`{{ sh "printf a" }}$(printf b)`), ShouldEqual, "ab")
+
+		_, err = substitutions.eval("{{ unknown }}")
+		c.So(err, ShouldNotBeNil)
+		c.So(evaluateGlobals(map[string]string{"broken": `{{ sh "exit 4" }}`}), ShouldNotBeNil)
+
+		// names are matched as whole identifiers
+		c.So(referencesName("echo $CG_SHA", "CG_SHA"), ShouldBeTrue)
+		c.So(referencesName("echo ${CG_SHA}-x", "CG_SHA"), ShouldBeTrue)
+		c.So(referencesName("echo $CG_SHA_LONG", "CG_SHA"), ShouldBeFalse)
+		c.So(referencesName("echo $XCG_SHA $CG_SHA", "CG_SHA"), ShouldBeTrue)
+
+		// only the globals a command references are computed
+		g.Lock()
+		g.Vars["CG_USED"] = `{{ sh "echo used >> ` + counter + `; echo used" }}`
+		g.Vars["CG_UNUSED"] = "$(echo unused >> " + counter + "; echo unused)"
+		g.Unlock()
+		defer func() {
+			g.Lock()
+			delete(g.Vars, "CG_USED")
+			delete(g.Vars, "CG_UNUSED")
+			g.Unlock()
+		}()
+
+		cmd := &command{
+			name:     "cg-run",
+			language: "bash",
+			exec:     "echo $CG_USED > " + out + "; printenv | grep ^CG_ | sort >> " + out,
+		}
+		c.So(cmd.Run([]string{}, false), ShouldBeNil)
+		c.So(cmd.Run([]string{}, false), ShouldBeNil)
+
+		b, err := ioutil.ReadFile(out)
+		c.So(err, ShouldBeNil)
+		c.So(string(b), ShouldEqual, "used\nCG_USED=used\n")
+
+		// cached for the invocation
+		b, err = ioutil.ReadFile(counter)
+		c.So(err, ShouldBeNil)
+		c.So(string(b), ShouldEqual, "used\n")
+
+		// startup mode evaluates all of them
+		conf.Lock()
+		conf.fields.DynamicGlobals = dynamicGlobalsStartup
+		conf.Unlock()
+		defer func() {
+			conf.Lock()
+			conf.fields.DynamicGlobals = dynamicGlobalsLazy
+			conf.Unlock()
+		}()
+
+		c.So(cmd.Run([]string{}, false), ShouldBeNil)
+		b, _ = ioutil.ReadFile(out)
+		c.So(string(b), ShouldEqual, "used\nCG_UNUSED=unused\nCG_USED=used\n")
+	})
+}
+
+func TestSecrets(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing secrets", t, func(c C) {
+
+		encrypted, err := encryptSecret([]byte("passphrase"), []byte("s3cr3t-value"))
+		c.So(err, ShouldBeNil)
+		c.So(encrypted, ShouldNotContainSubstring, "s3cr3t-value")
+
+		value, err := decryptSecret([]byte("passphrase"), encrypted)
+		c.So(err, ShouldBeNil)
+		c.So(string(value), ShouldEqual, "s3cr3t-value")
+
+		_, err = decryptSecret([]byte("wrong"), encrypted)
+		c.So(err, ShouldEqual, ErrInvalidSecret)
+		_, err = decryptSecret([]byte("passphrase"), "invalid")
+		c.So(err, ShouldEqual, ErrInvalidSecret)
+
+		// secrets are declared in the globals, but not in the env of a command
+		var raw map[string]*globalData
+		c.So(yaml.Unmarshal([]byte("TS_TOKEN:\n    secret: true\nname: zeus\n"), &raw), ShouldBeNil)
+		c.So(splitSecrets(raw), ShouldResemble, []string{"TS_TOKEN"})
+		c.So(raw, ShouldContainKey, "name")
+		c.So(raw, ShouldNotContainKey, "TS_TOKEN")
+
+		c.So(yaml.Unmarshal([]byte("TS_TOKEN:\n    secret: true\n"), &raw), ShouldBeNil)
+		_, _, err = parseGlobals(raw, nil)
+		c.So(err, ShouldNotBeNil)
+		c.So(yaml.Unmarshal([]byte("TS_TOKEN:\n    secret: false\n"), &raw), ShouldEqual, ErrUnsupportedGlobalType)
+
+		// decrypted only into the environment of the commands
+		os.Setenv(secretPassphraseEnv, "passphrase")
+		secrets.Lock()
+		secrets.passphrase = nil
+		secrets.Unlock()
+		secrets.declare([]string{"TS_TOKEN", "TS_UNSET"})
+
+		projectData.Lock()
+		projectData.fields.Secrets["TS_TOKEN"] = encrypted
+		projectData.Unlock()
+
+		defer func() {
+			os.Unsetenv(secretPassphraseEnv)
+			secrets.declare(nil)
+			secrets.forget("TS_TOKEN")
+			projectData.Lock()
+			delete(projectData.fields.Secrets, "TS_TOKEN")
+			projectData.Unlock()
+		}()
+
+		env, err := secrets.environment("curl -H \"Authorization: $TS_TOKEN\" $TS_UNSET")
+		c.So(err, ShouldBeNil)
+		c.So(env, ShouldResemble, []string{"TS_TOKEN=s3cr3t-value"})
+
+		// only the secrets referenced in the script are decrypted, so commands without secrets need no key
+		env, err = secrets.environment("echo $TS_TOKEN_OLD")
+		c.So(err, ShouldBeNil)
+		c.So(env, ShouldBeEmpty)
+
+		os.Unsetenv(secretPassphraseEnv)
+		secrets.Lock()
+		secrets.passphrase = nil
+		secrets.Unlock()
+		secrets.forget("TS_TOKEN")
+
+		env, err = secrets.environment("echo build")
+		c.So(err, ShouldBeNil)
+		c.So(env, ShouldBeEmpty)
+		c.So((&command{name: "ts-plain", language: "bash", exec: "true"}).Run([]string{}, false), ShouldBeNil)
+
+		_, err = secrets.environment("echo $TS_TOKEN")
+		c.So(err, ShouldEqual, ErrNoSecretKey)
+
+		os.Setenv(secretPassphraseEnv, "passphrase")
+		c.So(withoutPassphrase([]string{"A=1", secretPassphraseEnv + "=passphrase"}), ShouldResemble, []string{"A=1"})
+
+		f := filepath.Join(os.TempDir(), "zeus-secrets")
+		defer os.Remove(f)
+
+		cmd := &command{
+			name:     "ts-run",
+			language: "bash",
+			exec:     "echo $TS_TOKEN ${" + secretPassphraseEnv + ":-none} > " + f,
+		}
+		c.So(cmd.Run([]string{}, false), ShouldBeNil)
+		b, err := ioutil.ReadFile(f)
+		c.So(err, ShouldBeNil)
+		c.So(string(b), ShouldEqual, "s3cr3t-value none\n")
+
+		// and masked in the output
+		var buf bytes.Buffer
+		w := &maskWriter{out: &buf}
+		w.Write([]byte("token: s3cr3t-value\n"))
+		c.So(buf.String(), ShouldEqual, "token: "+secretMask+"\n")
+		c.So(secrets.active(), ShouldBeTrue)
+	})
+}
+
+func TestRedaction(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing redaction of sensitive values", t, func(c C) {
+
+		c.So(sensitiveName("GITHUB_TOKEN", defaultRedactPatterns), ShouldBeTrue)
+		c.So(sensitiveName("db_password", defaultRedactPatterns), ShouldBeTrue)
+		c.So(sensitiveName("buildDir", defaultRedactPatterns), ShouldBeFalse)
+
+		os.Setenv("ZR_API_TOKEN", "tok-1234567")
+		g.Lock()
+		g.Vars["zr_password"] = "hunter22"
+		g.Vars["zr_key"] = "abc"
+		g.Vars["zr_name"] = "zeus-release"
+		g.Unlock()
+		defer func() {
+			os.Unsetenv("ZR_API_TOKEN")
+			g.Lock()
+			delete(g.Vars, "zr_password")
+			delete(g.Vars, "zr_key")
+			delete(g.Vars, "zr_name")
+			g.Unlock()
+		}()
+
+		out := redact("curl -H tok-1234567 -u admin:hunter22 zeus-release abc")
+		c.So(out, ShouldEqual, "curl -H "+secretMask+" -u admin:"+secretMask+" zeus-release abc")
+
+		// the patterns are configurable
+		conf.Lock()
+		conf.fields.RedactPatterns = []string{"NAME"}
+		conf.Unlock()
+		defer func() {
+			conf.Lock()
+			conf.fields.RedactPatterns = defaultRedactPatterns
+			conf.Unlock()
+		}()
+		c.So(redact("zeus-release hunter22"), ShouldEqual, secretMask+" hunter22")
+
+		// dumps are redacted
+		conf.Lock()
+		conf.fields.RedactPatterns = defaultRedactPatterns
+		conf.Unlock()
+
+		d, err := newErrorDump(&command{name: "redact-dump", language: "bash"}, []string{"hunter22"}, nil, "echo hunter22", errors.New("exit status 1"), "failed with tok-1234567")
+		c.So(err, ShouldBeNil)
+		d.write()
+		dumps := errorDumps()
+		c.So(dumps, ShouldNotBeEmpty)
+		b, err := ioutil.ReadFile(dumps[0].path)
+		c.So(err, ShouldBeNil)
+		c.So(string(b), ShouldNotContainSubstring, "hunter22")
+		c.So(string(b), ShouldNotContainSubstring, "tok-1234567")
+		c.So(string(b), ShouldContainSubstring, "echo "+secretMask)
+	})
+}
+
+func TestFailureCollection(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing the collection of files for failed commands", t, func(c C) {
+
+		dir, err := ioutil.TempDir("", "zeus-collect")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		var (
+			dumps = filepath.Join(dir, "dumps")
+			logs  = filepath.Join(dir, "logs")
+		)
+		c.So(os.MkdirAll(filepath.Join(logs, "unit"), 0700), ShouldBeNil)
+		c.So(ioutil.WriteFile(filepath.Join(logs, "e2e.log"), []byte("e2e"), 0600), ShouldBeNil)
+		c.So(ioutil.WriteFile(filepath.Join(logs, "unit", "unit.log"), []byte("unit"), 0600), ShouldBeNil)
+		c.So(ioutil.WriteFile(filepath.Join(logs, "unit", "ignored.txt"), []byte("-"), 0600), ShouldBeNil)
+		c.So(ioutil.WriteFile(filepath.Join(dir, "screenshot.png"), []byte("png"), 0600), ShouldBeNil)
+
+		conf.Lock()
+		conf.fields.DumpDir = dumps
+		conf.Unlock()
+		defer func() {
+			conf.Lock()
+			conf.fields.DumpDir = ""
+			conf.Unlock()
+		}()
+
+		cmd := &command{
+			name:     "collect-fail",
+			language: "bash",
+			exec:     "exit 1",
+			onFailureCollect: []string{
+				logs + "/**/*.log",
+				filepath.Join(dir, "screenshot.png"),
+				filepath.Join(dir, "missing-*.png"),
+			},
+		}
+		c.So(cmd.Run([]string{}, false), ShouldNotBeNil)
+
+		records := runRecords.records()
+		rec := records[len(records)-1]
+		c.So(rec.Name, ShouldEqual, "collect-fail")
+		c.So(len(rec.Collected), ShouldEqual, 3)
+
+		for _, path := range rec.Collected {
+			_, err := os.Stat(path)
+			c.So(err, ShouldBeNil)
+			c.So(path, ShouldStartWith, dumps)
+		}
+		c.So(rec.Collected[0], ShouldEndWith, "logs/e2e.log")
+		c.So(rec.Collected[1], ShouldEndWith, "logs/unit/unit.log")
+
+		// the collected files belong to the dump
+		d := errorDumps()
+		c.So(len(d), ShouldEqual, 1)
+		c.So(d[0].Command, ShouldEqual, "collect-fail")
+		c.So(len(d[0].collectedFiles()), ShouldEqual, 3)
+
+		b, err := ioutil.ReadFile(d[0].path)
+		c.So(err, ShouldBeNil)
+		c.So(string(b), ShouldContainSubstring, "# Collected:")
+
+		// and are referenced in the CI summary
+		summary := renderCISummary(newCIConfig(), []*runRecord{rec})
+		c.So(summary, ShouldContainSubstring, "Collected files:")
+		c.So(summary, ShouldContainSubstring, "unit.log`")
+	})
+}
+
+func TestStackTraces(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing stack trace parsing", t, func(c C) {
+
+		cmd := &command{name: "st-fail", language: "bash"}
+
+		pyErr := `Traceback (most recent call last):
+  File "<string>", line 9, in <module>
+  File "<string>", line 5, in f
+  File "/usr/lib/python3/json/__init__.py", line 346, in loads
+ValueError: x`
+		c.So(cmd.errorLines(pyErr, pythonLanguage()), ShouldResemble, []int{9, 5})
+
+		nodeErr := `[eval]:3
+function f() { throw new Error("x") }
+               ^
+
+Error: x
+    at f ([eval]:3:22)
+    at [eval]:4:1
+    at runScriptInThisContext (node:internal/vm:209:10)
+    at [eval]-wrapper:6:24`
+		c.So(cmd.errorLines(nodeErr, javaScriptLanguage()), ShouldResemble, []int{3, 4})
+		c.So(cmd.errorLines("execution error: Error on line 7: ReferenceError", javaScriptLanguage()), ShouldResemble, []int{7})
+
+		rubyErr := "-e:3:in 'f': boom (RuntimeError)\n\tfrom /usr/lib/ruby/set.rb:10:in 'x'\n\tfrom -e:6:in '<main>'"
+		c.So(cmd.errorLines(rubyErr, rubyLanguage()), ShouldResemble, []int{3, 6})
+
+		c.So(cmd.errorLines("boom at -e line 3.", perlLanguage()), ShouldResemble, []int{3})
+		c.So(cmd.errorLines("st-fail: line 4: foo: command not found", bashLanguage()), ShouldResemble, []int{4})
+		c.So(cmd.errorLines("other: line 4: foo: command not found", bashLanguage()), ShouldBeEmpty)
+
+		// languages without a pattern use the symbol
+		lang := &Language{Name: "custom", ErrLineNumberSymbol: "line", CorrectErrLineNumber: true}
+		c.So(cmd.errorLines("failed in line 12", lang), ShouldResemble, []int{11})
+
+		// line numbers of the real interpreter, in the script with the preamble of zeus
+		cmd.exec = "true\nmissing_st_command"
+		c.So(cmd.preamble("#!/bin/bash\nx=1\n\n"+cmd.exec), ShouldEqual, 3)
+
+		ex, script, _, err := cmd.createCommand("", nil)
+		c.So(err, ShouldBeNil)
+		out, err := ex.CombinedOutput()
+		c.So(err, ShouldNotBeNil)
+
+		lines := cmd.errorLines(string(out), bashLanguage())
+		c.So(lines, ShouldResemble, []int{cmd.preamble(script) + 2})
+		c.So(strings.Split(script, "\n")[lines[0]-1], ShouldEqual, "missing_st_command")
+	})
+}
+
+func TestSourceMapping(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing the source mapping of error lines", t, func(c C) {
+
+		dir, err := ioutil.TempDir("", "zeus-sourcemap")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "commands.yml")
+		c.So(ioutil.WriteFile(path, []byte(`language: bash
+commands:
+    sm-block:
+        description: fails in the third line
+        exec: |
+            echo one
+            echo two
+            missing_sm_command
+    sm-line:
+        exec: missing_sm_command
+`), 0600), ShouldBeNil)
+
+		prev := commandsFilePath
+		commandsFilePath = path
+		defer func() {
+			commandsFilePath = prev
+		}()
+
+		block := &command{name: "sm-block", language: "bash", exec: "echo one\necho two\nmissing_sm_command\n"}
+		c.So(block.commandsFileLine(1), ShouldEqual, 6)
+		c.So(block.commandsFileLine(3), ShouldEqual, 8)
+
+		line := &command{name: "sm-line", language: "bash", exec: "missing_sm_command"}
+		c.So(line.commandsFileLine(1), ShouldEqual, 10)
+
+		// a different exec is not from the CommandsFile
+		other := &command{name: "sm-line", language: "bash", exec: "echo imported"}
+		c.So(other.commandsFileLine(1), ShouldEqual, 0)
+
+		// lines reported by the interpreter are translated through the preamble
+		ex, script, _, err := block.createCommand("", nil)
+		c.So(err, ShouldBeNil)
+		out, err := ex.CombinedOutput()
+		c.So(err, ShouldNotBeNil)
+
+		lines := block.errorLines(string(out), bashLanguage())
+		c.So(block.errorLocations(script, lines), ShouldResemble, []string{path + ":8"})
+
+		// lines of the preamble have no location
+		c.So(block.errorLocations(script, []int{1}), ShouldBeEmpty)
+
+		// scripts from files are run as they are
+		file := &command{name: "sm-file", language: "bash", path: filepath.Join(dir, "sm-file.sh")}
+		c.So(file.errorLocations("#!/bin/bash\nfalse", []int{2}), ShouldResemble, []string{file.path + ":2"})
+	})
+}
+
+func TestLint(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing the linters for scripts", t, func(c C) {
+
+		dir, err := ioutil.TempDir("", "zeus-lint")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "commands.yml")
+		c.So(ioutil.WriteFile(path, []byte(`language: lint-test
+commands:
+    lint-block:
+        exec: |
+            echo one
+            lint_me two
+`), 0600), ShouldBeNil)
+
+		prev := commandsFilePath
+		commandsFilePath = path
+		defer func() {
+			commandsFilePath = prev
+		}()
+
+		// grep reports matches in the file:line: message format
+		lang := bashLanguage()
+		lang.Name = "lint-test"
+		lang.Linter = "grep -n -H lint_me"
+		ls.Lock()
+		ls.items[lang.Name] = lang
+		ls.Unlock()
+		defer func() {
+			ls.Lock()
+			delete(ls.items, lang.Name)
+			ls.Unlock()
+		}()
+
+		block := &command{
+			name:     "lint-block",
+			language: lang.Name,
+			exec:     "echo one\nlint_me two\n",
+			args: map[string]*commandArg{
+				"lint_me_arg": {name: "lint_me_arg", argType: reflect.String},
+			},
+		}
+
+		// the declaration of the argument in front of the exec is ignored
+		findings, err := block.lint()
+		c.So(err, ShouldBeNil)
+		c.So(findings, ShouldResemble, []lintFinding{
+			{command: "lint-block", location: path + ":6", message: "lint_me two"},
+		})
+
+		// scripts from files are linted as they are
+		file := &command{name: "lint-file", language: lang.Name, path: filepath.Join(dir, "lint-file.sh")}
+		c.So(ioutil.WriteFile(file.path, []byte("#!/bin/bash\nlint_me\n"), 0700), ShouldBeNil)
+		findings, err = file.lint()
+		c.So(err, ShouldBeNil)
+		c.So(findings, ShouldResemble, []lintFinding{
+			{command: "lint-file", location: file.path + ":2", message: "lint_me"},
+		})
+
+		// languages without a linter are skipped
+		lang.Linter = ""
+		findings, err = block.lint()
+		c.So(err, ShouldBeNil)
+		c.So(findings, ShouldBeEmpty)
+
+		lang.Linter = "zeus-missing-linter"
+		_, err = block.lint()
+		c.So(err, ShouldEqual, ErrLinterNotFound)
+	})
+}
+
+func TestFormatters(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing the formatters for scripts", t, func(c C) {
+
+		dir, err := ioutil.TempDir("", "zeus-format")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		prev := scriptDir
+		scriptDir = dir
+		defer func() {
+			scriptDir = prev
+		}()
+
+		// the formatter upper cases the script in place
+		lang := bashLanguage()
+		lang.Name = "format-test"
+		lang.FileExtension = ".fmt-test"
+		lang.Formatter = `sh -c 'tr a-z A-Z < "$0" > "$0.tmp" && mv "$0.tmp" "$0"'`
+		ls.Lock()
+		ls.items[lang.Name] = lang
+		ls.Unlock()
+		defer func() {
+			ls.Lock()
+			delete(ls.items, lang.Name)
+			ls.Unlock()
+		}()
+
+		var (
+			ugly   = filepath.Join(dir, "ugly.fmt-test")
+			pretty = filepath.Join(dir, "pretty.fmt-test")
+		)
+		c.So(ioutil.WriteFile(ugly, []byte("ECHO ugly\n"), 0700), ShouldBeNil)
+		c.So(ioutil.WriteFile(pretty, []byte("ECHO PRETTY\n"), 0700), ShouldBeNil)
+		c.So(scriptLanguage(ugly), ShouldEqual, lang)
+
+		// checking does not change the scripts
+		c.So(newFormatter().formatCommand([]string{formatCommand, formatFlagCheck}), ShouldEqual, ErrUnformattedScripts)
+		unformatted, err := newFormatter().formatzeusDir(true)
+		c.So(err, ShouldBeNil)
+		c.So(unformatted, ShouldResemble, []string{ugly})
+
+		contents, err := ioutil.ReadFile(ugly)
+		c.So(err, ShouldBeNil)
+		c.So(string(contents), ShouldEqual, "ECHO ugly\n")
+
+		c.So(newFormatter().formatCommand([]string{formatCommand}), ShouldBeNil)
+		contents, err = ioutil.ReadFile(ugly)
+		c.So(err, ShouldBeNil)
+		c.So(string(contents), ShouldEqual, "ECHO UGLY\n")
+		c.So(newFormatter().formatCommand([]string{formatCommand, formatFlagCheck}), ShouldBeNil)
+
+		// languages with a formatter that is not installed are skipped
+		lang.Formatter = "zeus-missing-formatter -w"
+		c.So(newFormatter().formatPath(ugly), ShouldEqual, ErrFormatterNotFound)
+		c.So(newFormatter().formatCommand([]string{formatCommand, formatFlagCheck}), ShouldBeNil)
+
+		c.So(newFormatter().formatCommand([]string{formatCommand, "--invalid"}), ShouldEqual, ErrInvalidUsage)
+	})
+}
+
+func TestCommandsFileFormat(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing formatting and rewriting the CommandsFile", t, func(c C) {
+
+		formatted, err := formatCommandsFile(`# header
+
+commands:
+  # builds it
+  build:
+    exec: |
+      go build
+    dependencies: [clean]   # first clean
+    description: build it
+  clean:
+    exec: rm -rf bin
+language: bash
+globals:
+  name: zeus
+`)
+		c.So(err, ShouldBeNil)
+		c.So(formatted, ShouldEqual, `# header
+
+language: bash
+
+globals:
+    name: zeus
+
+commands:
+    # builds it
+    build:
+        description: build it
+        dependencies: [clean] # first clean
+        exec: |
+            go build
+
+    clean:
+        exec: rm -rf bin
+`)
+
+		again, err := formatCommandsFile(formatted)
+		c.So(err, ShouldBeNil)
+		c.So(again, ShouldEqual, formatted)
+
+		_, err = formatCommandsFile("- not a mapping\n")
+		c.So(err, ShouldNotBeNil)
+
+		// commands are inserted with the indentation of the file, in front of the next section
+		c.So(insertYAMLCommand(`language: bash
+commands:
+  build:
+    exec: go build
+
+# hooks for git
+hooks:
+  pre-commit: build
+`, "test", []string{"exec: go test"}), ShouldEqual, `language: bash
+commands:
+  build:
+    exec: go build
+
+  test:
+    exec: go test
+
+# hooks for git
+hooks:
+  pre-commit: build
+`)
+		c.So(insertYAMLCommand("language: bash\n", "test", []string{"exec: go test"}), ShouldEqual, "language: bash\n\ncommands:\n    test:\n        exec: go test\n")
+
+		// checking the CommandsFile on disk
+		dir, err := ioutil.TempDir("", "zeus-commandsfile-format")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "commands.yml")
+		c.So(ioutil.WriteFile(path, []byte("commands:\n  build:\n    exec: go build\n"), 0600), ShouldBeNil)
+
+		prev := commandsFilePath
+		commandsFilePath = path
+		defer func() {
+			commandsFilePath = prev
+		}()
+
+		c.So(f.formatCommand([]string{formatCommand, formatTargetCommandsFile, formatFlagCheck}), ShouldEqual, ErrUnformattedCommandsFile)
+		c.So(f.formatCommand([]string{formatCommand, formatTargetCommandsFile}), ShouldBeNil)
+		c.So(f.formatCommand([]string{formatCommand, formatFlagCheck, formatTargetCommandsFile}), ShouldBeNil)
+
+		contents, err := ioutil.ReadFile(path)
+		c.So(err, ShouldBeNil)
+		c.So(string(contents), ShouldEqual, "commands:\n    build:\n        exec: go build\n")
+	})
+}
+
+func TestEnvProfiles(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing environment profiles", t, func(c C) {
+
+		contents := []byte(`globals:
+    host: localhost
+    url: https://${host}/api
+profiles:
+    staging:
+        host: staging.example.com
+    prod:
+        host: example.com
+        replicas: 3
+commands:
+    deploy:
+        exec: echo $url
+`)
+		c.So(validateCommandsFile(contents), ShouldBeNil)
+
+		commandsFile := newCommandsFile()
+		c.So(yaml.Unmarshal(contents, commandsFile), ShouldBeNil)
+
+		e := &envProfiles{}
+		vars, _, err := e.load(commandsFile.Globals, commandsFile.Profiles)
+		c.So(err, ShouldBeNil)
+		c.So(e.list(), ShouldResemble, []string{"prod", "staging"})
+		c.So(vars["url"], ShouldEqual, "https://localhost/api")
+		c.So(e.prompt(), ShouldEqual, "")
+
+		// the globals reference the values of the profile
+		c.So(e.use("prod"), ShouldBeNil)
+		vars, types, err := e.load(commandsFile.Globals, commandsFile.Profiles)
+		c.So(err, ShouldBeNil)
+		c.So(vars["url"], ShouldEqual, "https://example.com/api")
+		c.So(vars["replicas"], ShouldEqual, "3")
+		c.So(types["replicas"], ShouldEqual, globalTypeInt)
+		c.So(e.prompt(), ShouldEqual, " (prod)")
+
+		c.So(e.use("qa"), ShouldEqual, ErrUnknownEnvProfile)
+		c.So(e.current(), ShouldEqual, "prod")
+
+		// a profile removed from the CommandsFile can't be used
+		delete(commandsFile.Profiles, "prod")
+		_, _, err = e.load(commandsFile.Globals, commandsFile.Profiles)
+		c.So(err, ShouldNotBeNil)
+		c.So(err.Error(), ShouldEqual, ErrUnknownEnvProfile.Error()+": prod")
+
+		c.So(e.use(envProfileNone), ShouldBeNil)
+		c.So(e.current(), ShouldEqual, "")
+
+		c.So(stripEnvProfileFlags([]string{"--env", "staging", "deploy", "-env=prod", "-C", "."}), ShouldResemble, []string{"deploy", "-C", "."})
+
+		// profiles can't be declared in more than one file
+		origins := map[string]string{"profile staging": "commands.yml"}
+		fragment := newCommandsFile()
+		fragment.Profiles = map[string]map[string]*globalData{"staging": nil}
+		err = newCommandsFile().merge(fragment, "zeus.d/staging.yml", origins)
+		c.So(err, ShouldNotBeNil)
+		c.So(err.Error(), ShouldContainSubstring, "profile staging")
+	})
+}
+
+func TestNumericArguments(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing numeric arguments", t, func(c C) {
+
+		for in, out := range map[string]string{
+			"42":      "42",
+			" 42 ":    "42",
+			"+7":      "7",
+			"-1_000":  "-1000",
+			"010":     "10",
+			"0x1F":    "31",
+			"0b101":   "5",
+			"0o17":    "15",
+			"-0x10":   "-16",
+			"0x_ff":   "255",
+			"1_000_0": "10000",
+		} {
+			v, err := normalizeArg(in, reflect.Int)
+			c.So(err, ShouldBeNil)
+			c.So(v, ShouldEqual, out)
+		}
+
+		for in, want := range map[string]error{
+			"1,5":                  ErrThousandsSeparator,
+			"1.5":                  ErrNotAnInteger,
+			"1e3":                  ErrNotAnInteger,
+			"1__0":                 ErrNotANumber,
+			"_1":                   ErrNotANumber,
+			"abc":                  ErrNotANumber,
+			"0xZZ":                 ErrNotANumber,
+			"":                     ErrNotANumber,
+			"99999999999999999999": ErrNumberOutOfRange,
+		} {
+			_, err := normalizeArg(in, reflect.Int)
+			c.So(err, ShouldEqual, want)
+		}
+
+		for in, out := range map[string]string{
+			"1.5":     "1.5",
+			"-.5":     "-0.5",
+			"1_000.5": "1000.5",
+			"1e3":     "1000",
+			"2":       "2",
+			"0x1p-2":  "0.25",
+		} {
+			v, err := normalizeArg(in, reflect.Float64)
+			c.So(err, ShouldBeNil)
+			c.So(v, ShouldEqual, out)
+		}
+
+		for in, want := range map[string]error{
+			"1,5":     ErrDecimalComma,
+			"1,000.5": ErrThousandsSeparator,
+			"Inf":     ErrNotANumber,
+			"NaN":     ErrNotANumber,
+			"1.5.1":   ErrNotANumber,
+			"1e999":   ErrNumberOutOfRange,
+		} {
+			_, err := normalizeArg(in, reflect.Float64)
+			c.So(err, ShouldEqual, want)
+		}
+
+		c.So(validArgType("0x10", reflect.Int), ShouldBeNil)
+		c.So(validArgType("1,5", reflect.Float64), ShouldEqual, ErrDecimalComma)
+
+		// the error names the label, the type and the value
+		cmd := &command{
+			name:     "numbers",
+			language: "bash",
+			args: map[string]*commandArg{
+				"ratio": {name: "ratio", argType: reflect.Float64},
+			},
+		}
+		_, err := cmd.parseArguments([]string{"ratio=1,5"})
+		c.So(err, ShouldNotBeNil)
+		c.So(err.Error(), ShouldEqual, `invalid argument type: ratio expects Float, got "1,5": `+ErrDecimalComma.Error())
+
+		code, err := cmd.parseArguments([]string{"ratio=1_0.5"})
+		c.So(err, ShouldBeNil)
+		c.So(code, ShouldContainSubstring, "ratio=10.5")
+
+		// numeric defaults are checked and normalized
+		arg, err := parseArgument("mask:Int? = 0xff")
+		c.So(err, ShouldBeNil)
+		c.So(arg.defaultValue, ShouldEqual, "255")
+
+		_, err = parseArgument("ratio:Float? = 1,5")
+		c.So(err, ShouldNotBeNil)
+		c.So(err.Error(), ShouldContainSubstring, `ratio expects Float, got "1,5"`)
+	})
+}
+
+func TestProjectReport(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing the project report", t, func(c C) {
+
+		items := map[string]*command{
+			"pr-base":    {name: "pr-base", language: "bash", exec: "true"},
+			"pr-build":   {name: "pr-build", language: "bash", exec: "true", dependencies: []string{"pr-base"}},
+			"pr-release": {name: "pr-release", language: "python", exec: "print(1)", dependencies: []string{"pr-build name=x", "pr-base"}},
+			"pr-big":     {name: "pr-big", language: "bash", exec: strings.Repeat("echo\n", 5000)},
+			"pr-ran":     {name: "pr-ran", language: "bash", exec: "true"},
+			"pr-cycle":   {name: "pr-cycle", language: "bash", exec: "true", dependencies: []string{"pr-cycle"}},
+		}
+
+		cmdMap.Lock()
+		for name, cmd := range items {
+			cmdMap.items[name] = cmd
+		}
+		cmdMap.Unlock()
+		defer func() {
+			cmdMap.Lock()
+			for name := range items {
+				delete(cmdMap.items, name)
+			}
+			cmdMap.Unlock()
+		}()
+
+		c.So(items["pr-big"].scriptLines(), ShouldEqual, 5000)
+		c.So((&command{}).scriptLines(), ShouldEqual, 0)
+
+		cmdMap.RLock()
+		depths := make(map[string][]string)
+		c.So(dependencyChain("pr-release", depths, make(map[string]bool)), ShouldResemble, []string{"pr-release", "pr-build", "pr-base"})
+		c.So(dependencyChain("pr-cycle", depths, make(map[string]bool)), ShouldResemble, []string{"pr-cycle"})
+		cmdMap.RUnlock()
+
+		r := newProjectReport([]*historyEntry{{Name: "pr-ran"}})
+		c.So(r.commands, ShouldBeGreaterThanOrEqualTo, len(items))
+		c.So(r.languages["python"], ShouldBeGreaterThanOrEqualTo, 1)
+		c.So(len(r.largest), ShouldEqual, largestScriptsLimit)
+		c.So(r.largest[0], ShouldResemble, scriptSize{name: "pr-big", lines: 5000})
+		c.So(len(r.deepest), ShouldBeGreaterThanOrEqualTo, 3)
+
+		c.So(r.unused, ShouldContain, "pr-release")
+		c.So(r.unused, ShouldContain, "pr-big")
+		c.So(r.unused, ShouldNotContain, "pr-base")
+		c.So(r.unused, ShouldNotContain, "pr-build")
+		c.So(r.unused, ShouldNotContain, "pr-ran")
+
+		// a command referencing itself is not used by it
+		c.So(r.unused, ShouldContain, "pr-cycle")
+
+		r.languages = map[string]int{"bash": 2, "python": 2, "go": 3}
+		c.So(r.languageSummary(), ShouldEqual, "go 3, bash 2, python 2")
+
+		handleReportCommand([]string{reportCommand})
+		handleReportCommand([]string{reportCommand, reportTargetProject})
+	})
+}
+
+func TestDeprecations(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing deprecation warnings", t, func(c C) {
+
+		out, renamed := renameConfigFields([]byte("AutoFormat: true\nColors:  false\nUnknownField: 1\ncolorProfiles:\n    Dark: {}\ndebug: true\n"))
+		c.So(string(out), ShouldEqual, "autoFormat: true\ncolors:  false\nUnknownField: 1\ncolorProfiles:\n    Dark: {}\ndebug: true\n")
+		c.So(renamed, ShouldResemble, []string{"AutoFormat -> autoFormat", "Colors -> colors"})
+
+		dir, err := ioutil.TempDir("", "zeus-deprecations")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		prevZeusDir, prevConfig, prevCommandsFile := zeusDir, projectConfigPath, commandsFilePath
+		zeusDir = dir
+		projectConfigPath = filepath.Join(dir, "config.yml")
+		commandsFilePath = filepath.Join(dir, "commands.yml")
+		defer func() {
+			zeusDir, projectConfigPath, commandsFilePath = prevZeusDir, prevConfig, prevCommandsFile
+		}()
+
+		c.So(ioutil.WriteFile(projectConfigPath, []byte("AutoFormat: true\neditor: vim\n"), 0600), ShouldBeNil)
+		c.So(ioutil.WriteFile(filepath.Join(dir, zeusfileName), []byte("commands:\n    build:\n        exec: make\n"), 0600), ShouldBeNil)
+
+		// the old syntax is still understood
+		contents, warnings, err := validateConfig(projectConfigPath)
+		c.So(err, ShouldBeNil)
+		c.So(warnings, ShouldBeEmpty)
+		cfg := newConfig()
+		c.So(unmarshalConfig(contents, cfg), ShouldBeNil)
+		c.So(cfg.fields.AutoFormat, ShouldBeTrue)
+
+		useZeusfile()
+		c.So(commandsFilePath, ShouldEqual, filepath.Join(dir, zeusfileName))
+
+		// each warning is shown once per day
+		day := time.Date(2017, 8, 12, 10, 0, 0, 0, time.UTC)
+		warnings = deprecationWarnings(day)
+		c.So(len(warnings), ShouldEqual, 2)
+		c.So(warnings[0], ShouldStartWith, "deprecated since v0.8.0: config field names start with a lower case letter")
+		c.So(warnings[0], ShouldContainSubstring, "AutoFormat -> autoFormat")
+		c.So(warnings[0], ShouldContainSubstring, "zeus migrate syntax")
+		c.So(deprecationWarnings(day.Add(time.Hour)), ShouldBeEmpty)
+		c.So(len(deprecationWarnings(day.AddDate(0, 0, 1))), ShouldEqual, 2)
+
+		// the migration rewrites the files
+		migrateSyntax()
+		c.So(commandsFilePath, ShouldEqual, filepath.Join(dir, "commands.yml"))
+		_, err = os.Stat(commandsFilePath)
+		c.So(err, ShouldBeNil)
+		contents, err = ioutil.ReadFile(projectConfigPath)
+		c.So(err, ShouldBeNil)
+		c.So(string(contents), ShouldEqual, "autoFormat: true\neditor: vim\n")
+		c.So(deprecationWarnings(day.AddDate(0, 0, 2)), ShouldBeEmpty)
+	})
+}
+
+func TestExpressions(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing skipIf expressions", t, func(c C) {
+
+		os.Setenv("ZEUS_EXPR_TEST", "yes")
+		defer os.Unsetenv("ZEUS_EXPR_TEST")
+
+		eval := func(source string) bool {
+			e, err := parseExpression(source)
+			c.So(err, ShouldBeNil)
+			return e.eval()
+		}
+
+		c.So(eval("exists('zeus_test.go') && env('CI_NOT_SET') != 'true'"), ShouldBeTrue)
+		c.So(eval("exists('*.go')"), ShouldBeTrue)
+		c.So(eval("exists(\"missing/file\")"), ShouldBeFalse)
+		c.So(eval("env('ZEUS_EXPR_TEST') == 'yes' || false"), ShouldBeTrue)
+		c.So(eval("!(true && false) == true"), ShouldBeTrue)
+		c.So(eval("!true || !false && false"), ShouldBeFalse)
+		c.So(eval("newer('zeus_test.go', 'missing/file')"), ShouldBeTrue)
+		c.So(eval("newer('missing/file', 'zeus_test.go')"), ShouldBeFalse)
+		c.So(eval("os() != ''"), ShouldBeTrue)
+
+		for source, expected := range map[string]error{
+			"env('CI')":                ErrExpressionType,
+			"exists(true)":             ErrExpressionType,
+			"'a' == true":              ErrExpressionType,
+			"!env('CI')":               ErrExpressionType,
+			"run('rm -rf /')":          ErrUnknownExpressionFunc,
+			"exists('a'":               ErrInvalidExpression,
+			"exists('a', 'b')":         ErrInvalidExpression,
+			"env('CI') == 'true' true": ErrInvalidExpression,
+			"'unterminated":            ErrInvalidExpression,
+			"exists('a') & true":       ErrInvalidExpression,
+			"":                         ErrInvalidExpression,
+		} {
+			_, err := parseExpression(source)
+			c.So(err, ShouldNotBeNil)
+			c.So(err.Error(), ShouldStartWith, expected.Error())
+		}
+
+		// skipIf is checked before the outputs
+		cmd := &command{name: "expr-test"}
+		_, reason := cmd.skipReason()
+		c.So(reason, ShouldBeEmpty)
+		cmd.skipIf, _ = parseExpression("env('ZEUS_EXPR_TEST') == 'yes'")
+		state, reason := cmd.skipReason()
+		c.So(state, ShouldEqual, stateSkipped)
+		c.So(reason, ShouldStartWith, "skipIf is true")
+		cmd.skipIf, _ = parseExpression("false")
+		_, reason = cmd.skipReason()
+		c.So(reason, ShouldBeEmpty)
+
+		// invalid expressions are rejected when the command is initialized
+		d := &commandData{SkipIf: "exists(", Exec: "true"}
+		err := d.init(&CommandsFile{}, "expr-test")
+		c.So(err, ShouldNotBeNil)
+		c.So(err.Error(), ShouldContainSubstring, "skipIf: "+ErrInvalidExpression.Error())
+	})
+}
+
+func TestProjectLock(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing the project lock", t, func(c C) {
+
+		conf.Lock()
+		conf.fields.ProjectLock = true
+		conf.Unlock()
+		defer func() {
+			conf.Lock()
+			conf.fields.ProjectLock = false
+			conf.Unlock()
+			projectLocks.wait = false
+			os.Remove(projectLockPath)
+		}()
+
+		writeOwner := func(o *projectLockOwner) {
+			contents, err := json.Marshal(o)
+			c.So(err, ShouldBeNil)
+			c.So(ioutil.WriteFile(projectLockPath, contents, 0644), ShouldBeNil)
+		}
+
+		// nested invocations share the lock of the top-level invocation
+		c.So(projectLocks.acquire(), ShouldBeNil)
+		c.So(projectLocks.acquire(), ShouldBeNil)
+		owner, err := readProjectLock()
+		c.So(err, ShouldBeNil)
+		c.So(owner.PID, ShouldEqual, os.Getpid())
+		projectLocks.release()
+		_, err = os.Stat(projectLockPath)
+		c.So(err, ShouldBeNil)
+		projectLocks.release()
+		_, err = os.Stat(projectLockPath)
+		c.So(os.IsNotExist(err), ShouldBeTrue)
+
+		// held by a running process
+		writeOwner(&projectLockOwner{PID: 1, RunID: "other", Started: time.Now()})
+		err = projectLocks.acquire()
+		c.So(err, ShouldNotBeNil)
+		c.So(err.Error(), ShouldStartWith, ErrProjectLocked.Error())
+
+		// a nested zeus process continues the invocation of the owner
+		os.Setenv(runIDEnv, "other")
+		c.So(projectLocks.acquire(), ShouldBeNil)
+		projectLocks.release()
+		os.Unsetenv(runIDEnv)
+		_, err = os.Stat(projectLockPath)
+		c.So(err, ShouldBeNil)
+
+		// wait until the lock has been released
+		projectLocks.wait = true
+		go func() {
+			time.Sleep(2 * projectLockPollInterval)
+			os.Remove(projectLockPath)
+		}()
+		c.So(projectLocks.acquire(), ShouldBeNil)
+		owner, err = readProjectLock()
+		c.So(err, ShouldBeNil)
+		c.So(owner.PID, ShouldEqual, os.Getpid())
+		projectLocks.release()
+
+		// a signal stops waiting
+		writeOwner(&projectLockOwner{PID: 1, RunID: "other", Started: time.Now()})
+		go func() {
+			time.Sleep(2 * projectLockPollInterval)
+			projectLocks.interrupt()
+		}()
+		c.So(projectLocks.acquire(), ShouldEqual, ErrInterrupted)
+		projectLocks.wait = false
+
+		// the owner of a stale lock does not exist anymore
+		writeOwner(&projectLockOwner{PID: 1 << 30, RunID: "other", Started: time.Now()})
+		c.So(projectLocks.acquire(), ShouldBeNil)
+		owner, err = readProjectLock()
+		c.So(err, ShouldBeNil)
+		c.So(owner.PID, ShouldEqual, os.Getpid())
+		projectLocks.release()
+
+		// without the config field the lock is not needed
+		conf.Lock()
+		conf.fields.ProjectLock = false
+		conf.Unlock()
+		writeOwner(&projectLockOwner{PID: 1, RunID: "other", Started: time.Now()})
+		c.So(projectLocks.acquire(), ShouldBeNil)
+		projectLocks.release()
+	})
+}
+
+func TestRecursionLimit(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing the recursion limit", t, func(c C) {
+
+		items := map[string]*command{
+			"rl-release":  {name: "rl-release", dependencies: []string{"rl-build"}},
+			"rl-build":    {name: "rl-build", dependencies: []string{"rl-generate"}},
+			"rl-generate": {name: "rl-generate", dependencies: []string{"rl-build"}},
+			"rl-top":      {name: "rl-top", dependencies: []string{"rl-a", "rl-b"}},
+			"rl-a":        {name: "rl-a", dependencies: []string{"rl-shared"}},
+			"rl-b":        {name: "rl-b", dependencies: []string{"rl-shared"}},
+			"rl-shared":   {name: "rl-shared"},
+		}
+
+		cmdMap.Lock()
+		for name, cmd := range items {
+			cmdMap.items[name] = cmd
+		}
+		cmdMap.Unlock()
+		defer func() {
+			cmdMap.Lock()
+			for name := range items {
+				delete(cmdMap.items, name)
+			}
+			cmdMap.Unlock()
+			conf.Lock()
+			conf.fields.MaxRecursionDepth = 64
+			conf.Unlock()
+		}()
+
+		// the cycle is printed with the path leading to it
+		_, err := getTotalDependencyCount(items["rl-release"])
+		c.So(err, ShouldNotBeNil)
+		c.So(err.Error(), ShouldStartWith, ErrRecursionLimit.Error())
+		c.So(err.Error(), ShouldContainSubstring, "rl-release => rl-build => rl-generate => rl-build")
+		c.So(err.Error(), ShouldEndWith, "repeated sequence: rl-build => rl-generate => rl-build")
+
+		// shared dependencies are no cycle, and counting again starts from scratch
+		for i := 0; i < 2; i++ {
+			count, err := getTotalDependencyCount(items["rl-top"])
+			c.So(err, ShouldBeNil)
+			c.So(count, ShouldEqual, 4)
+		}
+
+		conf.Lock()
+		conf.fields.MaxRecursionDepth = 2
+		conf.Unlock()
+		_, err = getTotalDependencyCount(items["rl-top"])
+		c.So(err, ShouldNotBeNil)
+		c.So(err.Error(), ShouldStartWith, ErrMaxRecursionDepth.Error())
+		c.So(err.Error(), ShouldContainSubstring, "rl-top => rl-a => rl-shared")
+
+		c.So(dependencyPath{"a", "b", "c", "b"}.repeated(), ShouldResemble, dependencyPath{"b", "c", "b"})
+		c.So(dependencyPath{"a", "b"}.repeated(), ShouldResemble, dependencyPath{"a", "b"})
+	})
+}
+
+func TestOptimize(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing the chain optimization", t, func(c C) {
+
+		items := map[string]*command{
+			"op-gen":   {name: "op-gen"},
+			"op-lint":  {name: "op-lint"},
+			"op-test":  {name: "op-test", dependencies: []string{"op-gen"}},
+			"op-build": {name: "op-build", dependencies: []string{"op-gen"}, outputs: []string{"bin/app"}},
+			"op-vet":   {name: "op-vet", inputs: []string{"bin/*"}},
+		}
+
+		cmdMap.Lock()
+		for name, cmd := range items {
+			cmdMap.items[name] = cmd
+		}
+		cmdMap.Unlock()
+		defer func() {
+			cmdMap.Lock()
+			for name := range items {
+				delete(cmdMap.items, name)
+			}
+			cmdMap.Unlock()
+		}()
+
+		c.So(stepsConflict("op-lint", "op-test"), ShouldBeFalse)
+		c.So(stepsConflict("op-test", "op-build"), ShouldBeTrue)
+		c.So(stepsConflict("op-build", "op-vet"), ShouldBeTrue)
+		c.So(stepsConflict("op-gen", "op-test"), ShouldBeTrue)
+		c.So(stepsConflict("op-lint", "op-missing"), ShouldBeTrue)
+
+		averages := averageDurations([]*historyEntry{
+			{Name: "op-lint", Duration: 10 * time.Second},
+			{Name: "op-test", Duration: 30 * time.Second},
+			{Name: "op-test", Duration: 50 * time.Second},
+			{Name: "op-vet", Duration: time.Second, Skipped: true},
+		})
+
+		p := &pipeline{kind: pipelineAlias, name: "op-ci", chain: "op-lint -> op-test name=x -> op-build -> op-vet"}
+		sg := optimizeChain(p, averages)
+		c.So(sg, ShouldNotBeNil)
+		c.So(sg.chain, ShouldEqual, "op-lint & op-test name=x -> op-build -> op-vet")
+		c.So(sg.groups, ShouldResemble, [][]string{{"op-lint", "op-test name=x"}})
+		c.So(sg.savings, ShouldResemble, []time.Duration{10 * time.Second})
+
+		// steps move forward, steps with operators stay in place
+		sg = optimizeChain(&pipeline{chain: "op-build -> op-vet -> op-lint -> op-test || op-gen -> op-lint"}, nil)
+		c.So(sg.chain, ShouldEqual, "op-build & op-lint -> op-vet -> op-test || op-gen -> op-lint")
+		c.So(sg.savings, ShouldResemble, []time.Duration{0})
+
+		c.So(optimizeChain(&pipeline{chain: "op-gen -> op-test"}, averages), ShouldBeNil)
+		c.So(optimizeChain(&pipeline{chain: "op-lint"}, averages), ShouldBeNil)
+
+		// aliases are rewritten in the project data
+		projectData.Lock()
+		projectData.fields.Aliases["op-ci"] = p.chain
+		projectData.Unlock()
+		defer deleteAlias("op-ci")
+
+		sg = optimizeChain(p, averages)
+		c.So(sg.apply(), ShouldBeNil)
+		projectData.Lock()
+		c.So(projectData.fields.Aliases["op-ci"], ShouldEqual, "op-lint & op-test name=x -> op-build -> op-vet")
+		projectData.Unlock()
+
+		// hooks are rewritten in the CommandsFile, other lines are kept
+		path := filepath.Join(os.TempDir(), "zeus-optimize-commands.yml")
+		c.So(ioutil.WriteFile(path, []byte("hooks:\n    # run before pushing\n    pre-push: op-lint -> op-test\n\ncommands:\n    pre-push:\n        exec: op-lint -> op-test\n"), 0600), ShouldBeNil)
+		defer os.Remove(path)
+		defer os.Remove(path + backupSuffix)
+
+		prev := commandsFilePath
+		commandsFilePath = path
+		defer func() {
+			commandsFilePath = prev
+		}()
+
+		c.So(rewriteHook("pre-push", "op-lint -> op-test", "op-lint & op-test"), ShouldBeNil)
+		contents, err := ioutil.ReadFile(path)
+		c.So(err, ShouldBeNil)
+		c.So(string(contents), ShouldEqual, "hooks:\n    # run before pushing\n    pre-push: op-lint & op-test\n\ncommands:\n    pre-push:\n        exec: op-lint -> op-test\n")
+
+		err = rewriteHook("pre-commit", "op-lint -> op-test", "op-lint & op-test")
+		c.So(err, ShouldNotBeNil)
+		c.So(err.Error(), ShouldStartWith, ErrPipelineNotFound.Error())
+
+		c.So(gitHookShim("pre-push", "op-lint & op-test", "."), ShouldContainSubstring, "exec zeus 'op-lint & op-test'\n")
+	})
+}
+
+func TestCompletionCmd(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing the completionCmd of commands", t, func(c C) {
+
+		args, err := validateArgs([]string{"context:String", "tag:String?"})
+		c.So(err, ShouldBeNil)
+
+		values := completionValues("deploy", "printf 'context=dev\\ncontext=prod\\nregion=eu\\ntag=\\nno value\\ncontext=dev\\n'; echo tag=$ZEUS_COMMAND", args)
+		c.So(values, ShouldResemble, []string{"context=dev", "context=prod", "tag=deploy"})
+
+		// a failing or slow helper yields no values
+		c.So(completionValues("deploy", "exit 1", args), ShouldBeEmpty)
+		c.So(completionValues("deploy", "sleep 5", args), ShouldBeEmpty)
+		c.So(completionValues("deploy", "", args), ShouldBeEmpty)
+
+		d := &commandData{Arguments: []string{"context:String"}, CompletionCmd: "echo context=staging", Exec: "true"}
+		c.So(d.init(newCommandsFile(), "completion-deploy"), ShouldBeNil)
+		defer func() {
+			cmdMap.Lock()
+			delete(cmdMap.items, "completion-deploy")
+			cmdMap.Unlock()
+		}()
+
+		cmdMap.Lock()
+		cmd := cmdMap.items["completion-deploy"]
+		cmdMap.Unlock()
+		c.So(cmd, ShouldNotBeNil)
+		c.So(cmd.completionCmd, ShouldEqual, "echo context=staging")
+		argsCompleter := cmd.PrefixCompleter.Children[0].(*readline.PrefixCompleter)
+		c.So(argsCompleter.Callback("completion-deploy "), ShouldContain, "context=staging")
+		c.So(argsCompleter.Callback("completion-deploy context=dev "), ShouldNotContain, "context=staging")
+	})
+}
+
+func TestArgumentCompletion(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing the completion of argument values", t, func(c C) {
+
+		arg, err := parseArgument("env:String(dev|staging | prod)?=dev")
+		c.So(err, ShouldBeNil)
+		c.So(arg.values, ShouldResemble, []string{"dev", "staging", "prod"})
+		c.So(arg.typeName(), ShouldEqual, "String(dev|staging|prod)")
+		c.So(arg.allows("prod"), ShouldBeTrue)
+		c.So(arg.allows(`"prod"`), ShouldBeTrue)
+		c.So(arg.allows("test"), ShouldBeFalse)
+
+		arg, err = parseArgument("replicas:Int(1|0x3)")
+		c.So(err, ShouldBeNil)
+		c.So(arg.values, ShouldResemble, []string{"1", "3"})
+
+		arg, err = parseArgument("config:Path?")
+		c.So(err, ShouldBeNil)
+		c.So(arg.path, ShouldBeTrue)
+		c.So(arg.argType, ShouldEqual, reflect.String)
+		c.So(arg.typeName(), ShouldEqual, "Path")
+
+		for _, s := range []string{"env:String(dev|)", "env:String(dev|prod)?=test", "n:Int(1|x)"} {
+			_, err = parseArgument(s)
+			c.So(err, ShouldNotBeNil)
+		}
+
+		d := &commandData{
+			Arguments: []string{"env:String(dev|prod)", "config:Path?", "verbose:Bool?"},
+			Examples:  []string{"completion-args env=dev"},
+			Exec:      "true",
+		}
+		c.So(d.init(newCommandsFile(), "completion-args"), ShouldBeNil)
+		defer func() {
+			cmdMap.Lock()
+			delete(cmdMap.items, "completion-args")
+			cmdMap.Unlock()
+		}()
+
+		cmd, err := cmdMap.getCommand("completion-args")
+		c.So(err, ShouldBeNil)
+
+		_, err = cmd.parseArguments([]string{"env=test"})
+		c.So(err, ShouldNotBeNil)
+		c.So(err.Error(), ShouldStartWith, ErrInvalidArgumentValue.Error())
+
+		complete := func(line string) (res []string) {
+			candidates, _ := completer.Do([]rune(line), len([]rune(line)))
+			for _, r := range candidates {
+				res = append(res, string(r))
+			}
+			return
+		}
+
+		// the labels are offered after every argument, not only after the command name
+		c.So(complete("completion-args "), ShouldResemble, []string{"env=dev ", "config=", "env=", "verbose="})
+		c.So(complete("completion-args env=prod "), ShouldResemble, []string{"config=", "verbose=", "-> "})
+		c.So(complete("completion-args env=prod v"), ShouldResemble, []string{"erbose="})
+		c.So(complete("completion-args env=p"), ShouldResemble, []string{"rod "})
+		c.So(complete("completion-args verbose="), ShouldResemble, []string{"true ", "false "})
+		c.So(complete("completion-args env=dev -- "), ShouldBeEmpty)
+		c.So(complete("completion-args config=tests/zeus/scr"), ShouldResemble, []string{"ipts/"})
+		c.So(complete("completion-args env=dev -> completion-args env=d"), ShouldResemble, []string{"ev "})
+		c.So(complete("completion-args env=dev -> completion-ar"), ShouldContain, "gs ")
+
+		// the dependencies of the cmd builtin
+		cmd.dependencies = []string{"clean", "build name=x"}
+		c.So(complete("cmd set completion-args --add-dep completion-ar"), ShouldBeEmpty)
+		c.So(complete("cmd set completion-args --remove-dep "), ShouldResemble, []string{"clean ", `"build name=x" `})
+		c.So(complete("cmd set completion-args --async "), ShouldResemble, []string{"true ", "false "})
+		c.So(complete("cmd set completion-args --remove-dep clean --unset asy"), ShouldResemble, []string{"nc "})
+		c.So(complete("cmd set completion-args --description x --"), ShouldContain, "add-dep ")
+		c.So(complete("cmd set completion-"), ShouldContain, "args ")
+
+		// other lines are completed by the prefix completer
+		c.So(complete("histo"), ShouldResemble, []string{"ry "})
+	})
+}
+
+func TestCommandEdit(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing batch editing of commands", t, func(c C) {
+
+		c.So(splitQuotedFields(`cmd set build --description "build the app" --exec 'go build'`), ShouldResemble, []string{"cmd", "set", "build", "--description", "build the app", "--exec", "go build"})
+
+		names, edits, err := parseCommandEdits([]string{"build", "test", "--description", "x", "--add-dep", "generate", "--output", "bin/app", "--unset", "async", "--tty", "true"})
+		c.So(err, ShouldBeNil)
+		c.So(names, ShouldResemble, []string{"build", "test"})
+		c.So(edits, ShouldResemble, []*commandEdit{
+			{op: editSet, field: "description", value: "x"},
+			{op: editAdd, field: "dependencies", value: "generate"},
+			{op: editAdd, field: "outputs", value: "bin/app"},
+			{op: editUnset, field: "async"},
+			{op: editSet, field: "tty", value: "true"},
+		})
+
+		for _, args := range [][]string{
+			{"build"},
+			{"--description", "x"},
+			{"build", "--description"},
+			{"build", "--unknown", "x"},
+			{"build", "--env", "x"},
+			{"build", "--tty", "maybe"},
+			{"build", "--add-description", "x"},
+			{"build", "--tty", "true", "test"},
+		} {
+			_, _, err = parseCommandEdits(args)
+			c.So(err, ShouldNotBeNil)
+		}
+
+		contents := `# header
+commands:
+
+    # builds the app
+    build:
+        description: old   # trailing comment
+        dependencies:
+            - clean
+            # formatted first
+            - format
+        exec: |
+            go build
+
+            echo done
+
+    # runs the tests
+    test:
+        outputs: [a, b]
+        exec: go test
+`
+
+		edit := func(contents, name string, e *commandEdit) string {
+			out, err := applyCommandEdit(contents, name, e)
+			c.So(err, ShouldBeNil)
+			return out
+		}
+
+		out := edit(contents, "build", &commandEdit{op: editSet, field: "description", value: "build the app: fast"})
+		c.So(out, ShouldEqual, strings.Replace(contents, "description: old   # trailing comment", `description: 'build the app: fast'`, 1))
+
+		out = edit(contents, "build", &commandEdit{op: editAdd, field: "dependencies", value: "generate"})
+		c.So(out, ShouldEqual, strings.Replace(contents, "            - format\n", "            - format\n            - generate\n", 1))
+		c.So(edit(out, "build", &commandEdit{op: editAdd, field: "dependencies", value: "generate"}), ShouldEqual, out)
+
+		out = edit(contents, "build", &commandEdit{op: editRemove, field: "dependencies", value: "clean"})
+		c.So(out, ShouldEqual, strings.Replace(contents, "            - clean\n", "", 1))
+
+		// new fields are added at the end of the command
+		out = edit(contents, "build", &commandEdit{op: editSet, field: "tty", value: "true"})
+		c.So(out, ShouldEqual, strings.Replace(contents, "            echo done\n", "            echo done\n        tty: true\n", 1))
+
+		out = edit(contents, "build", &commandEdit{op: editUnset, field: "exec"})
+		c.So(out, ShouldEqual, strings.Replace(contents, "        exec: |\n            go build\n\n            echo done\n", "", 1))
+		c.So(edit(contents, "build", &commandEdit{op: editUnset, field: "async"}), ShouldEqual, contents)
+
+		// flow sequences are written as block sequences
+		out = edit(contents, "test", &commandEdit{op: editAdd, field: "outputs", value: "c"})
+		c.So(out, ShouldEqual, strings.Replace(contents, "        outputs: [a, b]\n", "        outputs:\n            - a\n            - b\n            - c\n", 1))
+
+		out = edit(contents, "test", &commandEdit{op: editAdd, field: "inputs", value: "**/*.go"})
+		c.So(out, ShouldEqual, strings.Replace(contents, "        exec: go test\n", "        exec: go test\n        inputs:\n            - '**/*.go'\n", 1))
+
+		_, err = applyCommandEdit(contents, "deploy", &commandEdit{op: editSet, field: "description", value: "x"})
+		c.So(err, ShouldNotBeNil)
+
+		// the files are checked before they are written
+		path := filepath.Join(os.TempDir(), "zeus-edit-commands.yml")
+		c.So(ioutil.WriteFile(path, []byte(contents), 0600), ShouldBeNil)
+		defer os.Remove(path)
+		defer os.Remove(path + backupSuffix)
+
+		prev := commandsFilePath
+		commandsFilePath = path
+		defer func() {
+			commandsFilePath = prev
+		}()
+
+		c.So(handleCmdCommand([]string{"cmd", "set", "build", "test", "--add-dep", "generate", "--output", "bin/app"}), ShouldBeNil)
+		written, err := ioutil.ReadFile(path)
+		c.So(err, ShouldBeNil)
+		c.So(string(written), ShouldContainSubstring, "            - format\n            - generate\n")
+		c.So(string(written), ShouldContainSubstring, "# runs the tests\n    test:\n        outputs:\n            - a\n            - b\n            - bin/app\n")
+
+		c.So(handleCmdCommand([]string{"cmd", "set", "build", "--add-arg", "name"}), ShouldNotBeNil)
+		c.So(handleCmdCommand([]string{"cmd", "set", "deploy", "--description", "x"}), ShouldNotBeNil)
+		unchanged, err := ioutil.ReadFile(path)
+		c.So(err, ShouldBeNil)
+		c.So(string(unchanged), ShouldEqual, string(written))
+		c.So(handleCmdCommand([]string{"cmd", "unset"}), ShouldEqual, ErrInvalidUsage)
+	})
+}
+
+func TestProgressView(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing the progress view", t, func(c C) {
+
+		var (
+			out bytes.Buffer
+			v   = &progressView{out: &out, active: true, planned: make(map[string]bool)}
+			now = time.Now()
+		)
+
+		cmdMap.Lock()
+		cmdMap.items["pv-gen"] = &command{name: "pv-gen"}
+		cmdMap.items["pv-clean"] = &command{name: "pv-clean"}
+		cmdMap.items["pv-build"] = &command{name: "pv-build", dependencies: []string{"pv-gen", "pv-clean"}}
+		cmdMap.items["pv-test"] = &command{name: "pv-test", dependencies: []string{"pv-gen"}}
+		cmdMap.Unlock()
+		defer func() {
+			cmdMap.Lock()
+			for _, name := range []string{"pv-gen", "pv-clean", "pv-build", "pv-test"} {
+				delete(cmdMap.items, name)
+			}
+			cmdMap.Unlock()
+		}()
+
+		render := func() (lines []string) {
+			for _, line := range v.render(now, 0) {
+				lines = append(lines, stripANSI(line))
+			}
+			return
+		}
+
+		// dependencies are nested below their command, and only planned once
+		v.plan(cmdMap.items["pv-build"])
+		v.plan(cmdMap.items["pv-test"])
+		c.So(render(), ShouldResemble, []string{"○ pv-build", "  ○ pv-gen", "  ○ pv-clean", "○ pv-test"})
+
+		// running commands show the latest line of their output
+		w := v.running("pv-gen")
+		c.So(w, ShouldNotBeNil)
+		w.Write([]byte("step 1\nprogress 10%\rprogress 50%\n\n"))
+		lines := render()
+		c.So(lines[1], ShouldStartWith, "  "+spinnerFrames[0]+" pv-gen")
+		c.So(lines[1], ShouldEndWith, "progress 50%")
+
+		v.exited("pv-gen", nil)
+		v.finished("pv-clean", stateCached)
+		c.So(render()[2], ShouldEqual, "  ✓ pv-clean (cached)")
+
+		// successful commands collapse once all rows below them are done
+		v.running("pv-build")
+		c.So(render(), ShouldHaveLength, 4)
+		v.exited("pv-build", nil)
+		lines = render()
+		c.So(lines, ShouldHaveLength, 2)
+		c.So(lines[0], ShouldStartWith, "✓ pv-build +2 steps")
+
+		// the output of failed commands is printed above the view
+		w = v.running("pv-test")
+		w.Write([]byte("assertion failed\n"))
+		v.exited("pv-test", errors.New("exit status 1"))
+		c.So(out.String(), ShouldContainSubstring, "output of pv-test")
+		c.So(out.String(), ShouldContainSubstring, "assertion failed\n")
+		c.So(render()[1], ShouldStartWith, "✗ pv-test")
+
+		// unplanned commands are added at the end, text is written above the erased view
+		v.finished("pv-event", stateSkipped)
+		c.So(render()[2], ShouldEqual, "✓ pv-event (skipped)")
+
+		out.Reset()
+		v.Write([]byte("hello\n"))
+		c.So(out.String(), ShouldStartWith, eraseLines(2)+"hello\n")
+		c.So(v.drawn, ShouldEqual, 3)
+
+		// views that are too high for the terminal are cut at the top
+		lines = v.render(now, 2)
+		c.So(lines, ShouldHaveLength, 2)
+		c.So(stripANSI(lines[0]), ShouldEqual, "… 2 more")
+
+		// commands in a pseudo terminal suspend the view
+		v.suspend()
+		c.So(v.drawn, ShouldEqual, 0)
+		out.Reset()
+		v.Write([]byte("tty\n"))
+		c.So(out.String(), ShouldEqual, "tty\n")
+		v.resume()
+		c.So(v.drawn, ShouldEqual, 3)
+
+		// without a terminal the line output is used
+		c.So(fancyOutput(), ShouldBeFalse)
+		inactive := &progressView{out: &out}
+		c.So(inactive.running("pv-gen"), ShouldBeNil)
+	})
+}
+
+func TestOutputLevels(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing the quiet and verbose output levels", t, func(c C) {
+
+		args, level := stripOutputLevelFlags([]string{"-q", "build", "name=x", "--verbose", "--", "-v"})
+		c.So(args, ShouldResemble, []string{"build", "name=x", "--", "-v"})
+		c.So(level, ShouldEqual, outputVerbose)
+
+		args, level = stripOutputLevelFlags([]string{"build"})
+		c.So(args, ShouldResemble, []string{"build"})
+		c.So(level, ShouldEqual, outputDefault)
+
+		line, level := stripOutputLevelFlagsFromLine("-v build -> test --quiet -- -q")
+		c.So(line, ShouldEqual, "build -> test -- -q")
+		c.So(level, ShouldEqual, outputQuiet)
+
+		line, level = stripOutputLevelFlagsFromLine("deploy host=-v.example.com")
+		c.So(line, ShouldEqual, "deploy host=-v.example.com")
+		c.So(level, ShouldEqual, outputDefault)
+
+		// the flags override the config, lines without flags use the level from the commandline
+		defer func() {
+			conf.fields.Quiet = false
+			sessionOutputLevel = outputDefault
+			setOutputLevel(outputDefault)
+			l.SetOutput(os.Stdout)
+		}()
+
+		c.So(outputLevel(), ShouldEqual, outputNormal)
+		conf.fields.Quiet = true
+		c.So(quietOutput(), ShouldBeTrue)
+		setOutputLevel(outputVerbose)
+		c.So(verboseOutput(), ShouldBeTrue)
+		conf.fields.Quiet = false
+
+		sessionOutputLevel = outputQuiet
+		setOutputLevel(outputDefault)
+		c.So(quietOutput(), ShouldBeTrue)
+
+		// quiet mode prints no progress
+		var buf bytes.Buffer
+		l.SetOutput(&buf)
+		cmd := &command{name: "ol-build"}
+		cmd.printSkipped(stateCached, "all named outputs exist")
+		c.So(buf.String(), ShouldBeEmpty)
+
+		setOutputLevel(outputNormal)
+		cmd.printSkipped(stateCached, "all named outputs exist")
+		c.So(buf.String(), ShouldContainSubstring, "skipping")
+
+		// verbose mode prints the command line and the variables set by zeus
+		c.So(formatCommandLine([]string{"/bin/bash", "-e", "-c", "#!/bin/bash\necho hi\n", "build", "two words", ""}), ShouldEqual, "/bin/bash -e -c <script, 2 lines> build 'two words' ''")
+
+		buf.Reset()
+		proc := exec.Command("/bin/bash", "script.sh")
+		proc.Env = append(os.Environ(), "ol_global=value", "ZEUS_COMMAND=ol-build")
+		printCommandDetails(proc)
+		out := stripANSI(buf.String())
+		c.So(out, ShouldContainSubstring, "command line: /bin/bash script.sh")
+		c.So(out, ShouldContainSubstring, "env:          ZEUS_COMMAND=ol-build\n")
+		c.So(out, ShouldContainSubstring, "env:          ol_global=value\n")
+		c.So(out, ShouldNotContainSubstring, "PATH=")
+
+		buf.Reset()
+		printCommandTiming("ol-build", time.Millisecond, time.Second, errors.New("exit status 1"))
+		c.So(stripANSI(buf.String()), ShouldContainSubstring, "ol-build setup ")
+	})
+}
+
+func TestTerminalFallback(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing the fallback for redirected output", t, func(c C) {
+
+		c.So(validColorMode(colorModeAlways), ShouldBeNil)
+		c.So(validColorMode("sometimes"), ShouldEqual, ErrInvalidColorMode)
+		c.So(stripColorFlags([]string{"--color", "never", "build", "-color=always", "name=x"}), ShouldResemble, []string{"build", "name=x"})
+
+		conf.Lock()
+		interactive, colors := conf.fields.Interactive, conf.fields.Colors
+		conf.Unlock()
+		defer func() {
+			stdoutTerminal = true
+			colorMode = colorModeAuto
+			conf.Lock()
+			conf.fields.Interactive, conf.fields.Colors = interactive, colors
+			conf.Unlock()
+		}()
+
+		// a terminal keeps the config
+		applyTerminalFallback()
+		c.So(conf.fields.Interactive, ShouldEqual, interactive)
+		c.So(conf.fields.Colors, ShouldEqual, colors)
+		_, overridden := terminalFieldOrigin("colors")
+		c.So(overridden, ShouldBeFalse)
+
+		// redirected output has no colors and no interactive shell
+		stdoutTerminal = false
+		applyTerminalFallback()
+		c.So(conf.fields.Interactive, ShouldBeFalse)
+		c.So(conf.fields.Colors, ShouldBeFalse)
+
+		info, err := conf.which("interactive")
+		c.So(err, ShouldBeNil)
+		c.So(info, ShouldEqual, "interactive: false ("+configOriginTerminal+")")
+		_, overridden = terminalFieldOrigin("stopOnError")
+		c.So(overridden, ShouldBeFalse)
+
+		// colors can be forced
+		colorMode = colorModeAlways
+		applyTerminalFallback()
+		c.So(conf.fields.Colors, ShouldBeTrue)
+		info, err = conf.which("colors")
+		c.So(err, ShouldBeNil)
+		c.So(info, ShouldEqual, "colors: true ("+configOriginFlag+")")
+
+		// and disabled on a terminal
+		stdoutTerminal = true
+		colorMode = colorModeNever
+		applyTerminalFallback()
+		c.So(conf.fields.Colors, ShouldBeFalse)
+	})
+}
+
+func TestColorProfiles(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing user-defined color profiles", t, func(c C) {
+
+		c.So(validColorStyle("red+bh:blue+h"), ShouldBeNil)
+		c.So(validColorStyle("214"), ShouldBeNil)
+		c.So(validColorStyle("#ff8800+u:#222"), ShouldBeNil)
+		c.So(validColorStyle("purple"), ShouldNotBeNil)
+		c.So(validColorStyle("#ff88"), ShouldNotBeNil)
+		c.So(validColorStyle("red+x"), ShouldNotBeNil)
+		c.So(validColorStyle("red:blue:green"), ShouldNotBeNil)
+
+		r, g, b, ok := parseHexColor("#f80")
+		c.So(ok, ShouldBeTrue)
+		c.So([]int{r, g, b}, ShouldResemble, []int{255, 136, 0})
+		_, _, _, ok = parseHexColor("ff8800")
+		c.So(ok, ShouldBeFalse)
+		c.So(ansi256(255, 136, 0), ShouldEqual, 214)
+		c.So(ansi256(0, 0, 0), ShouldEqual, 16)
+
+		// hex colors are used as is on truecolor terminals
+		prev := os.Getenv("COLORTERM")
+		defer os.Setenv("COLORTERM", prev)
+
+		os.Setenv("COLORTERM", "truecolor")
+		c.So(colorCode("#ff8800+b:#202020"), ShouldEqual, "\033[0;1;39m\033[38;2;255;136;0m\033[48;2;32;32;32m")
+		c.So(colorCode("red:#202020"), ShouldEqual, "\033[0;31m\033[48;2;32;32;32m")
+		c.So(colorCode("red"), ShouldEqual, ansi.ColorCode("red"))
+
+		os.Setenv("COLORTERM", "")
+		c.So(colorCode("#ff8800"), ShouldEqual, "\033[0;39m\033[38;5;214m")
+
+		// profiles from the config take precedence, the builtin ones are always available
+		custom := &ColorProfile{Text: "#ff8800", Prompt: "red"}
+		profiles := map[string]*ColorProfile{"dark": custom, "sunset": custom, "off": custom}
+
+		p, ok := lookupColorProfile(profiles, "dark")
+		c.So(ok, ShouldBeTrue)
+		c.So(p, ShouldEqual, custom)
+		p, ok = lookupColorProfile(profiles, "off")
+		c.So(ok, ShouldBeTrue)
+		c.So(p, ShouldResemble, colorsOffProfile())
+		p, ok = lookupColorProfile(nil, "light")
+		c.So(ok, ShouldBeTrue)
+		c.So(p, ShouldResemble, lightProfile())
+		_, ok = lookupColorProfile(profiles, "nope")
+		c.So(ok, ShouldBeFalse)
+
+		c.So((&ColorProfile{CmdName: "purple"}).validate().Error(), ShouldStartWith, "CmdName: ")
+		c.So(colorProfileNames(), ShouldContain, "black")
+
+		var buf bytes.Buffer
+		l.SetOutput(&buf)
+		printColorProfiles([]string{"light", "nope"})
+		l.SetOutput(os.Stdout)
+		out := stripANSI(buf.String())
+		c.So(out, ShouldContainSubstring, "light       zeus » build name:String description: some text output")
+		c.So(out, ShouldContainSubstring, "nope           "+ErrUnknownColorProfile.Error())
+	})
+}
+
+func TestPromptTemplate(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing the prompt template", t, func(c C) {
+
+		values := map[string]string{"{project}": "api", "{git_branch}": "main", "{env}": "", "{jobs}": "2 jobs"}
+		value := func(p string) (string, bool) {
+			v, ok := values[p]
+			return v, ok
+		}
+
+		c.So(renderPrompt("{project} {git_branch} {env} ❯", value), ShouldEqual, "api main ❯ ")
+		c.So(renderPrompt("[{jobs}] {project}:{git_branch} {unknown} $", value), ShouldEqual, "[2 jobs] api:main {unknown} $ ")
+
+		v, ok := promptValue("{project}")
+		c.So(ok, ShouldBeTrue)
+		c.So(v, ShouldEqual, filepath.Base(workingDir))
+		_, ok = promptValue("{nope}")
+		c.So(ok, ShouldBeFalse)
+
+		// without a template the default prompt is used
+		c.So(refreshPrompt(), ShouldEqual, defaultPrompt())
+		c.So(printPrompt(), ShouldEqual, defaultPrompt())
+
+		conf.Lock()
+		conf.fields.Prompt = "{project} ❯"
+		conf.Unlock()
+		defer func() {
+			conf.Lock()
+			conf.fields.Prompt = ""
+			conf.Unlock()
+			refreshPrompt()
+		}()
+
+		expected := cp.Prompt + filepath.Base(workingDir) + " ❯ " + cp.Text
+		c.So(refreshPrompt(), ShouldEqual, expected)
+
+		// the output lines reuse the rendered prompt
+		conf.Lock()
+		conf.fields.Prompt = "{env} ❯"
+		conf.Unlock()
+		c.So(printPrompt(), ShouldEqual, expected)
+		c.So(refreshPrompt(), ShouldEqual, cp.Prompt+"❯ "+cp.Text)
+	})
+}
+
+func TestShellHistory(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing the history of the interactive shell", t, func(c C) {
+
+		lines := []string{"build", "test name=x", "deploy -> notify"}
+
+		line, err := expandHistoryLine("!!", lines)
+		c.So(err, ShouldBeNil)
+		c.So(line, ShouldEqual, "deploy -> notify")
+		line, err = expandHistoryLine("!2", lines)
+		c.So(err, ShouldBeNil)
+		c.So(line, ShouldEqual, "test name=x")
+		line, err = expandHistoryLine("!-3", lines)
+		c.So(err, ShouldBeNil)
+		c.So(line, ShouldEqual, "build")
+		_, err = expandHistoryLine("!4", lines)
+		c.So(err, ShouldNotBeNil)
+		_, err = expandHistoryLine("!!", nil)
+		c.So(err, ShouldNotBeNil)
+
+		// other lines are not touched
+		for _, in := range []string{"build", "!echo", "! 2", "git commit -m 'fix!'"} {
+			line, err = expandHistoryLine(in, lines)
+			c.So(err, ShouldBeNil)
+			c.So(line, ShouldEqual, in)
+		}
+
+		dir, err := ioutil.TempDir("", "zeus-shell-history")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "history")
+		c.So(ioutil.WriteFile(path, []byte("one\n\ntwo\nthree\nfour\n"), 0600), ShouldBeNil)
+
+		h := &shellHistoryStore{}
+		h.load(path, 3)
+		c.So(h.get(), ShouldResemble, []string{"two", "three", "four"})
+		h.add("four")
+		h.add("five")
+		c.So(h.get(), ShouldResemble, []string{"three", "four", "five"})
+
+		// the history moves to the data directory
+		prev := zeusDir
+		zeusDir = dir
+		defer func() {
+			zeusDir = prev
+		}()
+		c.So(ioutil.WriteFile(filepath.Join(dir, ".history"), []byte("legacy\n"), 0600), ShouldBeNil)
+		migrateShellHistory()
+		contents, err := ioutil.ReadFile(filepath.Join(dir, "data", "history"))
+		c.So(err, ShouldBeNil)
+		c.So(string(contents), ShouldEqual, "legacy\n")
+
+		var buf bytes.Buffer
+		shellHistory.load(shellHistoryPath(), 10)
+		defer shellHistory.load("", 0)
+		l.SetOutput(&buf)
+		handleHistoryCommand([]string{historyCommand, historySubcommandLines})
+		l.SetOutput(os.Stdout)
+		c.So(stripANSI(buf.String()), ShouldEqual, "1  legacy\n")
+	})
+}
+
+func TestFuzzyFinder(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing the fuzzy finder", t, func(c C) {
+
+		_, ok := fuzzyScore("dpl", "deploy")
+		c.So(ok, ShouldBeTrue)
+		_, ok = fuzzyScore("lpd", "deploy")
+		c.So(ok, ShouldBeFalse)
+
+		// consecutive characters and word starts rank higher
+		consecutive, _ := fuzzyScore("dep", "deploy")
+		spread, _ := fuzzyScore("dep", "dump-env-path")
+		scattered, _ := fuzzyScore("dep", "disable-keep")
+		c.So(consecutive, ShouldBeGreaterThan, spread)
+		c.So(spread, ShouldBeGreaterThan, scattered)
+
+		items := []*finderItem{
+			{name: "deploy", description: "deploy the api, defaults to production"},
+			{name: "deploy-staging", description: "deploy the api to the staging cluster"},
+			{name: "test", description: "run the tests before a deploy"},
+			{name: "build", description: "compile the binaries"},
+		}
+
+		names := func(matches []*finderItem) (out []string) {
+			for _, m := range matches {
+				out = append(out, m.name)
+			}
+			return out
+		}
+
+		c.So(names(fuzzyFind("dpl", items)), ShouldResemble, []string{"deploy", "deploy-staging", "test"})
+		c.So(names(fuzzyFind("dpl stg", items)), ShouldResemble, []string{"deploy-staging"})
+		c.So(names(fuzzyFind("BIN", items)), ShouldResemble, []string{"build"})
+		c.So(fuzzyFind("xyz", items), ShouldBeEmpty)
+		c.So(names(fuzzyFind("", items)), ShouldResemble, []string{"test", "build", "deploy", "deploy-staging"})
+
+		// the matches are painted below the line, the selection moves with the arrow keys
+		f := &fuzzyFinder{active: true, items: items}
+		painted := stripANSI(string(f.Paint([]rune("dpl"), 3)))
+		c.So(painted, ShouldStartWith, "dpl")
+		c.So(painted, ShouldContainSubstring, "❯ deploy")
+		c.So(painted, ShouldContainSubstring, "deploy-staging")
+		c.So(painted, ShouldNotContainSubstring, "build")
+		c.So(string(f.Paint([]rune("dpl\n"), 4)), ShouldEqual, "dpl\n")
+
+		_, process := f.filterInputRune(readline.CharNext)
+		c.So(process, ShouldBeFalse)
+		f.accept("dpl")
+		c.So(f.isActive(), ShouldBeFalse)
+		c.So(f.takePending(), ShouldEqual, "deploy-staging ")
+		c.So(f.takePending(), ShouldEqual, "")
+
+		// without matches the query stays
+		f = &fuzzyFinder{active: true, items: items}
+		f.accept("xyz")
+		c.So(f.takePending(), ShouldEqual, "xyz")
+
+		// keys pass through while the finder is closed
+		r, process := f.filterInputRune(readline.CharNext)
+		c.So(process, ShouldBeTrue)
+		c.So(r, ShouldEqual, readline.CharNext)
+
+		// in the shell the builtin opens the finder with the query
+		handleFindCommand([]string{findCommand, "dpl"})
+		c.So(finder.isActive(), ShouldBeTrue)
+		c.So(finder.takePending(), ShouldEqual, "dpl")
+		finder.close()
+
+		// outside of the shell the matches are printed
+		readlineMutex.Lock()
+		prevShell := rl
+		rl = nil
+		readlineMutex.Unlock()
+		defer func() {
+			readlineMutex.Lock()
+			rl = prevShell
+			readlineMutex.Unlock()
+		}()
+
+		var buf bytes.Buffer
+		l.SetOutput(&buf)
+		handleFindCommand([]string{findCommand, "builtins", "overview"})
+		l.SetOutput(os.Stdout)
+		c.So(stripANSI(buf.String()), ShouldStartWith, "builtins")
+	})
+}
+
+func TestMultiLineInput(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing multi-line input and scratch scripts", t, func(c C) {
+
+		reader := func(lines ...string) func() (string, error) {
+			return func() (string, error) {
+				if len(lines) == 0 {
+					return "", io.EOF
+				}
+				line := lines[0]
+				lines = lines[1:]
+				return line, nil
+			}
+		}
+
+		line, err := joinContinuedLines("deploy env=staging \\", reader("  tag=v1 \\", "-> notify"))
+		c.So(err, ShouldBeNil)
+		c.So(line, ShouldEqual, "deploy env=staging tag=v1 -> notify")
+
+		// escaped backslashes do not continue the line
+		line, err = joinContinuedLines("echo a\\\\", reader("next"))
+		c.So(err, ShouldBeNil)
+		c.So(line, ShouldEqual, "echo a\\\\")
+
+		// an interrupt discards the line
+		_, err = joinContinuedLines("build \\", func() (string, error) { return "", readline.ErrInterrupt })
+		c.So(err, ShouldEqual, readline.ErrInterrupt)
+
+		ls.Lock()
+		lang := ls.items["bash"]
+		ls.Unlock()
+
+		path, err := createScratch(lang)
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(filepath.Dir(path))
+		c.So(path, ShouldEqual, filepath.Join(zeusDir, "data", "scratch", "scratch.sh"))
+
+		contents, err := ioutil.ReadFile(path)
+		c.So(err, ShouldBeNil)
+		c.So(scratchCode(lang, string(contents)), ShouldEqual, "")
+
+		// the script is kept between the runs
+		out, err := filepath.Abs(path + ".out")
+		c.So(err, ShouldBeNil)
+		err = ioutil.WriteFile(path, append(contents, []byte("\necho scratch > "+out+"\n")...), 0700)
+		c.So(err, ShouldBeNil)
+		path, err = createScratch(lang)
+		c.So(err, ShouldBeNil)
+		contents, err = ioutil.ReadFile(path)
+		c.So(err, ShouldBeNil)
+		code := scratchCode(lang, string(contents))
+		c.So(code, ShouldEqual, "echo scratch > "+out)
+
+		c.So(runScratch(lang, code), ShouldBeNil)
+		result, err := ioutil.ReadFile(out)
+		c.So(err, ShouldBeNil)
+		c.So(string(result), ShouldEqual, "scratch\n")
+
+		_, err = cmdMap.getCommand(editTargetScratch)
+		c.So(err, ShouldNotBeNil)
+	})
+}
+
+func TestCommandsStar(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing commands generated by the commands script", t, func(c C) {
+
+		dir, err := ioutil.TempDir("", "zeus-star")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		prevPath, prevDir, prevStar := commandsFilePath, commandsFragmentsDir, commandsStarPath
+		commandsFilePath = filepath.Join(dir, "commands.yml")
+		commandsFragmentsDir = filepath.Join(dir, "zeus.d")
+		commandsStarPath = filepath.Join(dir, "commands.star")
+		defer func() {
+			commandsFilePath, commandsFragmentsDir, commandsStarPath = prevPath, prevDir, prevStar
+		}()
+
+		os.Setenv("ZEUS_STAR_REGION", "eu")
+		defer os.Unsetenv("ZEUS_STAR_REGION")
+
+		c.So(ioutil.WriteFile(commandsFilePath, []byte("language: bash\ncommands:\n    build:\n        exec: go build\n"), 0600), ShouldBeNil)
+		c.So(ioutil.WriteFile(commandsStarPath, []byte(`
+services = ["auth", "billing"]
+
+for svc in services:
+    command("deploy-" + svc,
+        description = "deploy the " + svc + " service",
+        dependencies = ["build"],
+        exec = "kubectl apply -f k8s/%s.yml --region %s" % (svc, env("ZEUS_STAR_REGION")),
+    )
+
+command("deploy-all", {"async": True}, dependencies = ["deploy-" + s for s in services])
+
+if exists("`+commandsFilePath+`") and not glob("*.missing"):
+    command("conditional", exec = "true", buildNumber = False)
+`), 0600), ShouldBeNil)
+
+		commandsFile, err := loadCommandsFile(commandsFilePath)
+		c.So(err, ShouldBeNil)
+		c.So(commandsFile.Commands, ShouldContainKey, "build")
+		c.So(commandsFile.Commands, ShouldContainKey, "conditional")
+		c.So(commandsFile.Commands["deploy-billing"].Exec, ShouldEqual, "kubectl apply -f k8s/billing.yml --region eu")
+		c.So(commandsFile.Commands["deploy-billing"].Dependencies, ShouldResemble, []string{"build"})
+		c.So(commandsFile.Commands["deploy-all"].Async, ShouldBeTrue)
+		c.So(commandsFile.Commands["deploy-all"].Dependencies, ShouldResemble, []string{"deploy-auth", "deploy-billing"})
+
+		// the generated commands are checked like the ones of the YAML files
+		for name, d := range commandsFile.Commands {
+			c.So(d.init(commandsFile, name), ShouldBeNil)
+		}
+		c.So(commandSource(&command{name: "deploy-auth", exec: "true"}), ShouldResemble, sourceLocation{path: commandsStarPath})
+		c.So(isCommandSource(commandsStarPath), ShouldBeTrue)
+
+		c.So(ioutil.WriteFile(commandsStarPath, []byte(`command("build", exec = "make")`), 0600), ShouldBeNil)
+		_, err = loadCommandsFile(commandsFilePath)
+		c.So(err, ShouldNotBeNil)
+		c.So(err.Error(), ShouldContainSubstring, "command build "+ErrDuplicateDefinition.Error())
+
+		c.So(ioutil.WriteFile(commandsStarPath, []byte(`command("lint", exce = "golint")`), 0600), ShouldBeNil)
+		_, err = loadCommandsFile(commandsFilePath)
+		c.So(err, ShouldNotBeNil)
+		c.So(err.Error(), ShouldContainSubstring, "command: lint: unknown field: exce")
+
+		c.So(ioutil.WriteFile(commandsStarPath, []byte("x = 1\ncommand(\"lint\", exec = x + \"a\")\n"), 0600), ShouldBeNil)
+		_, err = loadCommandsFile(commandsFilePath)
+		c.So(err, ShouldNotBeNil)
+		c.So(err.Error(), ShouldContainSubstring, "commands.star:2")
+
+		// the script is enough to define the commands
+		c.So(os.Remove(commandsFilePath), ShouldBeNil)
+		c.So(ioutil.WriteFile(commandsStarPath, []byte(`command("lint", exec = "golint")`), 0600), ShouldBeNil)
+		commandsFile, err = loadCommandsFile(commandsFilePath)
+		c.So(err, ShouldBeNil)
+		c.So(commandsFile.Commands, ShouldContainKey, "lint")
+
+		c.So(os.Remove(commandsStarPath), ShouldBeNil)
+		_, err = loadCommandsFile(commandsFilePath)
+		c.So(err, ShouldEqual, ErrFailedToReadCommandsFile)
+	})
+}
+
+func TestEditCommandSource(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing the source of commands for the edit builtin", t, func(c C) {
+
+		dir, err := ioutil.TempDir("", "zeus-edit")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		prevPath, prevDir := commandsFilePath, commandsFragmentsDir
+		commandsFilePath = filepath.Join(dir, "commands.yml")
+		commandsFragmentsDir = filepath.Join(dir, "zeus.d")
+		defer func() {
+			commandsFilePath, commandsFragmentsDir = prevPath, prevDir
+		}()
+
+		script := filepath.Join(dir, "lint.sh")
+		c.So(os.Mkdir(commandsFragmentsDir, 0700), ShouldBeNil)
+		c.So(ioutil.WriteFile(script, []byte("golint ./...\n"), 0700), ShouldBeNil)
+		c.So(ioutil.WriteFile(commandsFilePath, []byte("language: bash\ncommands:\n    build:\n        description: build it\n        exec: |\n            go build\n    test:\n        dependencies:\n            - build\n"), 0600), ShouldBeNil)
+		c.So(ioutil.WriteFile(filepath.Join(commandsFragmentsDir, "10-deploy.yml"), []byte("commands:\n    deploy:\n        exec: ./deploy.sh\n"), 0600), ShouldBeNil)
+
+		// the first line of the exec block
+		c.So(commandSource(&command{name: "build", exec: "go build\n"}), ShouldResemble, sourceLocation{path: commandsFilePath, line: 6, col: 13})
+		c.So(commandSource(&command{name: "deploy", exec: "./deploy.sh"}).String(), ShouldEqual, filepath.Join(commandsFragmentsDir, "10-deploy.yml")+":3")
+
+		// the name of commands without an exec, scripts from the top
+		c.So(commandSource(&command{name: "test"}), ShouldResemble, sourceLocation{path: commandsFilePath, line: 7, col: 5})
+		c.So(commandSource(&command{name: "lint", path: script}), ShouldResemble, sourceLocation{path: script})
+		c.So(commandSource(&command{name: "unknown", exec: "true"}), ShouldResemble, sourceLocation{path: commandsFilePath})
+
+		c.So(editorPositionArgs("/usr/bin/vim", 6, 13), ShouldResemble, []string{"+call cursor(6,13)"})
+		c.So(editorPositionArgs("micro", 6, 13), ShouldResemble, []string{"+6:13"})
+		c.So(editorPositionArgs("nano", 6, 0), ShouldResemble, []string{"+6,1"})
+		c.So(editorPositionArgs("vim", 0, 0), ShouldBeNil)
+		c.So(editorPositionArgs("gedit", 6, 13), ShouldBeNil)
+
+		c.So(isCommandSource(filepath.Join(commandsFragmentsDir, "10-deploy.yml")), ShouldBeTrue)
+		c.So(isCommandSource(filepath.Join(dir, "notes.yml")), ShouldBeFalse)
+	})
+
+	Convey("Testing the reload after editing a command", t, func(c C) {
+
+		conf.Lock()
+		prevEditor := conf.fields.Editor
+		conf.fields.Editor = "touch"
+		conf.Unlock()
+		defer func() {
+			conf.Lock()
+			conf.fields.Editor = prevEditor
+			conf.Unlock()
+		}()
+
+		// commands of other tests are replaced by the ones from the CommandsFile
+		c.So(parseCommandsFile(commandsFilePath), ShouldBeNil)
+
+		// the editor changes the CommandsFile, the commands are parsed again
+		var buf bytes.Buffer
+		l.SetOutput(&buf)
+		time.Sleep(10 * time.Millisecond)
+		handleEditCommand([]string{editCommand, "python"})
+		l.SetOutput(os.Stdout)
+		c.So(stripANSI(buf.String()), ShouldContainSubstring, "commands after editing "+commandsFilePath)
+
+		_, err := cmdMap.getCommand("python")
+		c.So(err, ShouldBeNil)
+
+		buf.Reset()
+		l.SetOutput(&buf)
+		handleEditCommand([]string{editCommand, "python", "line"})
+		handleEditCommand([]string{editCommand, "missing"})
+		l.SetOutput(os.Stdout)
+		c.So(buf.String(), ShouldContainSubstring, "usage: edit <command>")
+		c.So(buf.String(), ShouldContainSubstring, "invalid command: missing")
+	})
+}
+
+func TestScriptReload(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing the reload of scripts", t, func(c C) {
+
+		dir, err := ioutil.TempDir("", "zeus-scripts")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		// a project without a CommandsFile
+		prevPath, prevFragments, prevScripts := commandsFilePath, commandsFragmentsDir, scriptDir
+		commandsFilePath = filepath.Join(dir, "commands.yml")
+		commandsFragmentsDir = filepath.Join(dir, "zeus.d")
+		scriptDir = dir
+		defer func() {
+			commandsFilePath, commandsFragmentsDir, scriptDir = prevPath, prevFragments, prevScripts
+		}()
+
+		var (
+			buf    bytes.Buffer
+			path   = filepath.Join(dir, "hot-reload.sh")
+			reload = func() string {
+				buf.Reset()
+				l.SetOutput(&buf)
+				reloadScript(path)
+				l.SetOutput(os.Stdout)
+				return stripANSI(buf.String())
+			}
+			completions = func() (names []string) {
+				completer.Lock()
+				defer completer.Unlock()
+				for _, child := range completer.Children {
+					if strings.TrimSpace(string(child.GetName())) == "hot-reload" {
+						names = append(names, "hot-reload")
+					}
+				}
+				return
+			}
+		)
+
+		c.So(ioutil.WriteFile(path, []byte("echo one\n"), 0700), ShouldBeNil)
+		c.So(reload(), ShouldEqual, "added hot-reload\n")
+		cmd, err := cmdMap.getCommand("hot-reload")
+		c.So(err, ShouldBeNil)
+		c.So([]string{"bash", "sh"}, ShouldContain, cmd.language)
+		c.So(completions(), ShouldHaveLength, 1)
+
+		// every version of a script is reloaded once
+		c.So(reload(), ShouldEqual, "")
+
+		later := time.Now().Add(time.Second)
+		c.So(os.Chtimes(path, later, later), ShouldBeNil)
+		c.So(reload(), ShouldEqual, "reloaded hot-reload\n")
+		c.So(completions(), ShouldHaveLength, 1)
+
+		other, err := cmdMap.getCommand("hot-reload")
+		c.So(err, ShouldBeNil)
+		c.So(other, ShouldNotEqual, cmd)
+
+		c.So(os.Remove(path), ShouldBeNil)
+		c.So(reload(), ShouldEqual, "removed hot-reload\n")
+		_, err = cmdMap.getCommand("hot-reload")
+		c.So(err, ShouldNotBeNil)
+		c.So(completions(), ShouldBeEmpty)
+
+		// temporary scripts and unsupported files are ignored
+		c.So(os.Mkdir(filepath.Join(dir, ".tmp"), 0700), ShouldBeNil)
+		path = filepath.Join(dir, ".tmp", "hot-reload_1234.sh")
+		c.So(ioutil.WriteFile(path, []byte("echo tmp\n"), 0700), ShouldBeNil)
+		c.So(reload(), ShouldEqual, "")
+		path = filepath.Join(dir, "notes.txt")
+		c.So(ioutil.WriteFile(path, []byte("notes\n"), 0600), ShouldBeNil)
+		c.So(reload(), ShouldEqual, "")
+
+		// with a CommandsFile the scripts are left to it
+		c.So(ioutil.WriteFile(commandsFilePath, []byte("commands: {}\n"), 0600), ShouldBeNil)
+		path = filepath.Join(dir, "hot-reload.sh")
+		c.So(ioutil.WriteFile(path, []byte("echo two\n"), 0700), ShouldBeNil)
+		c.So(reload(), ShouldEqual, "")
+	})
+}
+
+func TestCommandsFileFragments(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing CommandsFile fragments", t, func(c C) {
+
+		dir, err := ioutil.TempDir("", "zeus-fragments")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		prevPath, prevDir := commandsFilePath, commandsFragmentsDir
+		commandsFilePath = filepath.Join(dir, "commands.yml")
+		commandsFragmentsDir = filepath.Join(dir, "zeus.d")
+		defer func() {
+			commandsFilePath, commandsFragmentsDir = prevPath, prevDir
+		}()
+
+		c.So(os.Mkdir(commandsFragmentsDir, 0700), ShouldBeNil)
+		c.So(ioutil.WriteFile(commandsFilePath, []byte("language: bash\nglobals:\n    name: app\ncommands:\n    build:\n        exec: make\n"), 0600), ShouldBeNil)
+		c.So(ioutil.WriteFile(filepath.Join(commandsFragmentsDir, "20-deploy.yml"), []byte("commands:\n    deploy:\n        dependencies:\n            - build\n        exec: ./deploy.sh\ngroups:\n    release:\n        - deploy\n"), 0600), ShouldBeNil)
+		c.So(ioutil.WriteFile(filepath.Join(commandsFragmentsDir, "10-test.yml"), []byte("language: python\nglobals:\n    retries: 3\ncommands:\n    test:\n        exec: print('test')\n"), 0600), ShouldBeNil)
+		c.So(ioutil.WriteFile(filepath.Join(commandsFragmentsDir, "notes.txt"), []byte("not a fragment"), 0600), ShouldBeNil)
+
+		c.So(commandsFragments(), ShouldResemble, []string{
+			filepath.Join(commandsFragmentsDir, "10-test.yml"),
+			filepath.Join(commandsFragmentsDir, "20-deploy.yml"),
+		})
+
+		commandsFile, err := loadCommandsFile(commandsFilePath)
+		c.So(err, ShouldBeNil)
+		c.So(commandsFile.Language, ShouldEqual, "bash")
+		c.So(commandsFile.Commands, ShouldContainKey, "build")
+		c.So(commandsFile.Commands, ShouldContainKey, "deploy")
+		c.So(commandsFile.Globals, ShouldContainKey, "retries")
+		c.So(commandsFile.Globals, ShouldContainKey, "name")
+		c.So(len(commandsFile.Groups), ShouldEqual, 1)
+
+		// the language of a fragment applies to its own commands
+		c.So(commandsFile.Commands["test"].Language, ShouldEqual, "python")
+		c.So(commandsFile.Commands["build"].Language, ShouldEqual, "")
+		c.So(commandsFile.Commands["deploy"].Language, ShouldEqual, "")
+
+		// definitions in more than one file are refused
+		dup := filepath.Join(commandsFragmentsDir, "30-dup.yml")
+		c.So(ioutil.WriteFile(dup, []byte("commands:\n    build:\n        exec: go build\n"), 0600), ShouldBeNil)
+		_, err = loadCommandsFile(commandsFilePath)
+		c.So(err, ShouldNotBeNil)
+		c.So(err.Error(), ShouldContainSubstring, commandsFilePath)
+		c.So(err.Error(), ShouldContainSubstring, dup)
+		c.So(os.Remove(dup), ShouldBeNil)
+
+		// syntax errors name the fragment
+		broken := filepath.Join(commandsFragmentsDir, "40-broken.yml")
+		c.So(ioutil.WriteFile(broken, []byte("commands:\n  - [\n"), 0600), ShouldBeNil)
+		_, err = loadCommandsFile(commandsFilePath)
+		c.So(err, ShouldHaveSameTypeAs, &commandsFileSyntaxError{})
+		c.So(err.Error(), ShouldStartWith, broken)
+		c.So(os.Remove(broken), ShouldBeNil)
+
+		// a project can consist of fragments only
+		c.So(os.Remove(commandsFilePath), ShouldBeNil)
+		commandsFile, err = loadCommandsFile(commandsFilePath)
+		c.So(err, ShouldBeNil)
+		c.So(commandsFile.Commands, ShouldContainKey, "test")
+		c.So(commandsFile.Language, ShouldEqual, "bash")
+
+		c.So(os.RemoveAll(commandsFragmentsDir), ShouldBeNil)
+		_, err = loadCommandsFile(commandsFilePath)
+		c.So(err, ShouldEqual, ErrFailedToReadCommandsFile)
+	})
+}
+
+func TestWorkspace(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing zeus -C with multiple projects", t, func(c C) {
+
+		var dirs workDirs
+		c.So(dirs.Set("a, b"), ShouldBeNil)
+		c.So(dirs.Set("c"), ShouldBeNil)
+		c.So(dirs, ShouldResemble, workDirs{"a", "b", "c"})
+		c.So(dirs.multiple(), ShouldBeTrue)
+		c.So(workDirs{"a"}.multiple(), ShouldBeFalse)
+		c.So(workDirs{"services/*"}.multiple(), ShouldBeTrue)
+
+		c.So(stripWorkDirFlags([]string{"-C", "a,b", "--profile", "-C=c", "build"}), ShouldResemble, []string{"--profile", "build"})
+
+		dir, err := ioutil.TempDir("", "zeus-workspace")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		// projects without a zeus setup are skipped
+		for name, status := range map[string]string{"api": "0", "web": "3", "docs": ""} {
+			project := filepath.Join(dir, "services", name)
+			c.So(os.MkdirAll(project, 0700), ShouldBeNil)
+			if status == "" {
+				continue
+			}
+			c.So(os.MkdirAll(filepath.Join(project, zeusDir), 0700), ShouldBeNil)
+			c.So(ioutil.WriteFile(filepath.Join(project, "status"), []byte(status), 0600), ShouldBeNil)
+		}
+
+		var (
+			api      = filepath.Join(dir, "services", "api")
+			web      = filepath.Join(dir, "services", "web")
+			projects = workDirs{filepath.Join(dir, "services", "*"), api}.projects()
+		)
+		c.So(projects, ShouldResemble, []string{api, web})
+
+		// the shell stands in for the zeus binary
+		prevExecutable, prevMux := zeusExecutable, mux
+		defer func() {
+			zeusExecutable, mux = prevExecutable, prevMux
+		}()
+		zeusExecutable = func() (string, error) {
+			return "/bin/sh", nil
+		}
+		var out bytes.Buffer
+		mux = newOutputMultiplexer(&out)
+
+		c.So(runWorkspace(projects, []string{"-c", "echo running; exit $(cat status)"}), ShouldEqual, 3)
+		c.So(out.String(), ShouldContainSubstring, api)
+		c.So(out.String(), ShouldContainSubstring, web)
+		c.So(strings.Count(out.String(), "running"), ShouldEqual, 2)
+
+		c.So(runWorkspace(projects[:1], []string{"-c", "exit $(cat status)"}), ShouldEqual, 0)
+		c.So(runWorkspace(nil, []string{"build"}), ShouldEqual, 1)
+		c.So(runWorkspace(projects, nil), ShouldEqual, 1)
+	})
+}
+
+func TestHelpFile(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing help files for commands", t, func(c C) {
+
+		dir, err := ioutil.TempDir("", "zeus-help")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "build.md")
+		c.So(ioutil.WriteFile(path, []byte("# Build\n\nCompiles **all** packages.\n\n```\nzeus build\n```\n"), 0600), ShouldBeNil)
+
+		cmd := &command{name: "build", help: "short help"}
+		text, err := cmd.helpText()
+		c.So(err, ShouldBeNil)
+		c.So(text, ShouldEqual, "short help")
+
+		cmd.helpFile = path
+		text, err = cmd.helpText()
+		c.So(err, ShouldBeNil)
+		c.So(text, ShouldStartWith, "# Build")
+
+		manual := renderManual(text)
+		c.So(manual, ShouldContainSubstring, cp.Prompt+"Build")
+		c.So(manual, ShouldContainSubstring, "Compiles all packages.")
+		c.So(manual, ShouldContainSubstring, "    "+cp.CmdOutput+"zeus build")
+		c.So(manual, ShouldNotContainSubstring, "```")
+
+		cmd.helpFile = filepath.Join(dir, "missing.md")
+		_, err = cmd.helpText()
+		c.So(err, ShouldNotBeNil)
+
+		d := &commandData{Help: "short help", HelpFile: path}
+		err = d.init(newCommandsFile(), "help-conflict")
+		c.So(err, ShouldNotBeNil)
+		c.So(err.Error(), ShouldContainSubstring, ErrHelpAndHelpFile.Error())
+	})
+}
+
+func TestExamples(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing command examples", t, func(c C) {
+
+		args, err := validateArgs([]string{"host:String", "dryRun:Bool?"})
+		c.So(err, ShouldBeNil)
+
+		examples := []string{"deploy host=prod.example.com", "deploy host=staging.example.com dryRun=true -- -v"}
+		c.So(validateExamples("deploy", examples, args), ShouldBeNil)
+		c.So(validateExamples("deploy", []string{"build host=prod"}, args), ShouldNotBeNil)
+		c.So(validateExamples("deploy", []string{"deploy port=22"}, args), ShouldNotBeNil)
+
+		c.So(exampleArguments(examples), ShouldResemble, []string{"host=prod.example.com", "host=staging.example.com", "dryRun=true"})
+
+		d := &commandData{Arguments: []string{"host:String"}, Examples: []string{"deploy target=prod"}, Exec: "true"}
+		err = d.init(newCommandsFile(), "deploy")
+		c.So(err, ShouldNotBeNil)
+		c.So(err.Error(), ShouldContainSubstring, ErrInvalidExample.Error())
+
+		cmdMap.Lock()
+		cmdMap.items["example-deploy"] = &command{name: "example-deploy", examples: []string{"example-deploy host=a", "example-deploy host=b"}}
+		cmdMap.Unlock()
+		defer func() {
+			cmdMap.Lock()
+			delete(cmdMap.items, "example-deploy")
+			cmdMap.Unlock()
+		}()
+
+		// the key cycles through the examples of the command on the prompt
+		line, ok := copyExample([]rune("example-deploy "))
+		c.So(ok, ShouldBeTrue)
+		c.So(string(line), ShouldEqual, "example-deploy host=a")
+		line, _ = copyExample(line)
+		c.So(string(line), ShouldEqual, "example-deploy host=b")
+		line, _ = copyExample(line)
+		c.So(string(line), ShouldEqual, "example-deploy host=a")
+
+		_, ok = copyExample([]rune("unknown-command"))
+		c.So(ok, ShouldBeFalse)
+		_, ok = copyExample([]rune(""))
+		c.So(ok, ShouldBeFalse)
+	})
+}
+
+func TestCreateTemplates(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing the create wizard and templates", t, func(c C) {
+
+		dir, err := ioutil.TempDir("", "zeus-templates")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		prev := templatesDir
+		templatesDir = dir
+		defer func() {
+			templatesDir = prev
+		}()
+
+		c.So(ioutil.WriteFile(filepath.Join(dir, "go-service-build.yml"), []byte("description: build {{name}}\nexec: go build -o bin/{{name}}\n"), 0600), ShouldBeNil)
+		c.So(os.Mkdir(filepath.Join(dir, "go-service"), 0700), ShouldBeNil)
+		c.So(listTemplates(), ShouldResemble, []string{"go-service", "go-service-build"})
+
+		fields, err := commandTemplate("go-service-build", "server")
+		c.So(err, ShouldBeNil)
+		c.So(fields, ShouldResemble, []string{"description: build server", "exec: go build -o bin/server"})
+
+		_, err = commandTemplate("missing", "server")
+		c.So(err, ShouldNotBeNil)
+		c.So(err.Error(), ShouldContainSubstring, "go-service-build")
+
+		c.So(splitAnswer(" a, ,b "), ShouldResemble, []string{"a", "b"})
+		c.So(yamlList("dependencies", nil), ShouldBeEmpty)
+
+		cmdMap.Lock()
+		cmdMap.items["wizard-dep"] = &command{name: "wizard-dep", language: "bash", exec: "true"}
+		cmdMap.Unlock()
+		defer func() {
+			cmdMap.Lock()
+			delete(cmdMap.items, "wizard-dep")
+			cmdMap.Unlock()
+		}()
+
+		// invalid answers are asked again
+		// without an interactive shell the answers are read from stdin
+		readlineMutex.Lock()
+		prevReader, prevShell := stdinReader, rl
+		stdinReader = bufio.NewReader(strings.NewReader("wizard-dep\nwizard-new\nno-such-language\nbash\ndeploy it\nhost:String\nnot-defined\nwizard-dep\n"))
+		rl = nil
+		readlineMutex.Unlock()
+		defer func() {
+			readlineMutex.Lock()
+			stdinReader, rl = prevReader, prevShell
+			readlineMutex.Unlock()
+		}()
+
+		name, fields, err := runCreateWizard()
+		c.So(err, ShouldBeNil)
+		c.So(name, ShouldEqual, "wizard-new")
+		c.So(fields, ShouldResemble, []string{
+			"language: bash",
+			"description: deploy it",
+			"arguments:",
+			"    - host:String",
+			"dependencies:",
+			"    - wizard-dep",
+			"exec: implement wizard-new command",
+		})
+	})
+}
+
+func TestBootstrapProfiles(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing the bootstrap profiles", t, func(c C) {
+
+		names := bootstrapProfileNames()
+		c.So(names[0], ShouldEqual, defaultBootstrapProfile)
+		c.So(names, ShouldContain, "go")
+		c.So(names, ShouldContain, "docker")
+
+		for _, name := range names {
+			commandsFile := newCommandsFile()
+			c.So(yaml.Unmarshal([]byte(fillTemplate(bootstrapProfiles[name].commands, "")), commandsFile), ShouldBeNil)
+			c.So(commandsFile.Language, ShouldEqual, "bash")
+			c.So(commandsFile.Commands, ShouldContainKey, "build")
+			if name == defaultBootstrapProfile {
+				continue
+			}
+			for _, cmd := range []string{"test", "lint", "release"} {
+				c.So(commandsFile.Commands, ShouldContainKey, cmd)
+			}
+			for cmdName, d := range commandsFile.Commands {
+				for _, dep := range d.Dependencies {
+					c.So(commandsFile.Commands, ShouldContainKey, dep)
+				}
+				c.So(d.Exec, ShouldNotContainSubstring, "{{")
+				c.So(cmdName, ShouldNotBeEmpty)
+			}
+		}
+
+		profile, err := selectBootstrapProfile([]string{"go"})
+		c.So(err, ShouldBeNil)
+		c.So(profile, ShouldEqual, "go")
+		c.So(bootstrapProfiles[profile].config().fields.LintOnSave, ShouldBeTrue)
+		c.So(bootstrapProfiles[defaultBootstrapProfile].config().fields.LintOnSave, ShouldBeFalse)
+
+		_, err = selectBootstrapProfile([]string{"cobol"})
+		c.So(err, ShouldNotBeNil)
+
+		// without a terminal the default profile is used
+		profile, err = selectBootstrapProfile(nil)
+		c.So(err, ShouldBeNil)
+		c.So(profile, ShouldEqual, defaultBootstrapProfile)
+	})
+}
+
+func TestErrorDumps(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing error dumps", t, func(c C) {
+
+		dir, err := ioutil.TempDir("", "zeus-dumps")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		conf.Lock()
+		conf.fields.DumpDir = dir
+		conf.fields.DumpRetention = 2
+		conf.fields.DumpFormat = dumpFormatJSON
+		conf.Unlock()
+		defer func() {
+			conf.Lock()
+			conf.fields.DumpDir = ""
+			conf.fields.DumpRetention = 10
+			conf.fields.DumpFormat = dumpFormatScript
+			conf.Unlock()
+		}()
+
+		cmd := &command{name: "dump-me", language: "bash"}
+		env := append(os.Environ(), "DUMP_TARGET=linux", "DUMP_TOKEN=abc123456")
+
+		d, err := newErrorDump(cmd, []string{"target=linux"}, env, "exit 3", errors.New("exit status 3"), "boom")
+		c.So(err, ShouldBeNil)
+		d.write()
+
+		dumps := errorDumps()
+		c.So(len(dumps), ShouldEqual, 1)
+		c.So(dumps[0].Command, ShouldEqual, "dump-me")
+		c.So(filepath.Ext(dumps[0].path), ShouldEqual, ".json")
+
+		b, err := ioutil.ReadFile(dumps[0].path)
+		c.So(err, ShouldBeNil)
+
+		var written errorDump
+		c.So(json.Unmarshal(b, &written), ShouldBeNil)
+		c.So(written.Command, ShouldEqual, "dump-me")
+		c.So(written.Args, ShouldResemble, []string{"target=linux"})
+		c.So(written.Env, ShouldResemble, []string{"DUMP_TARGET=linux", "DUMP_TOKEN=" + secretMask})
+		c.So(written.Error, ShouldEqual, "exit status 3")
+		c.So(written.StdErr, ShouldEqual, "boom")
+		c.So(written.Script, ShouldEqual, "exit 3")
+
+		// only the newest dumps are kept
+		for i := 0; i < 3; i++ {
+			time.Sleep(2 * time.Millisecond)
+			d, _ = newErrorDump(cmd, nil, nil, "exit 1", errors.New("exit status 1"), "")
+			d.write()
+		}
+		c.So(len(errorDumps()), ShouldEqual, 2)
+
+		var buf bytes.Buffer
+		l.SetOutput(&buf)
+		handleDumpsCommand([]string{dumpsCommand})
+		handleDumpsCommand([]string{dumpsCommand, "show", "3"})
+		l.SetOutput(os.Stdout)
+
+		c.So(buf.String(), ShouldContainSubstring, "dump-me")
+		c.So(buf.String(), ShouldContainSubstring, "no dump with number 3")
+	})
+}
+
+func TestMemoryUsage(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing bounded in-memory state", t, func(c C) {
+
+		c.So(formatBytes(512), ShouldEqual, "512 B")
+		c.So(formatBytes(1536), ShouldEqual, "1.5 KiB")
+		c.So(formatBytes(3*1024*1024), ShouldEqual, "3.0 MiB")
+
+		os.Remove(runHistoryPath())
+		runHistory.path = ""
+
+		entries, err := tailRunHistory("", 10)
+		c.So(err, ShouldBeNil)
+		c.So(entries, ShouldBeEmpty)
+
+		for i := 0; i < 5; i++ {
+			runHistory.append(&runRecord{Name: "build", Start: time.Now(), Duration: time.Duration(i) * time.Second})
+			runHistory.append(&runRecord{Name: "test", Start: time.Now(), Duration: time.Duration(i) * time.Second})
+		}
+
+		// only the latest runs are read, oldest first
+		entries, err = tailRunHistory("build", 2)
+		c.So(err, ShouldBeNil)
+		c.So(len(entries), ShouldEqual, 2)
+		c.So(entries[0].Duration, ShouldEqual, 3*time.Second)
+		c.So(entries[1].Duration, ShouldEqual, 4*time.Second)
+
+		entries, err = tailRunHistory("", 3)
+		c.So(err, ShouldBeNil)
+		c.So(entries[2].Name, ShouldEqual, "test")
+
+		// the run records are bounded, without persisting them for this test
+		conf.Lock()
+		conf.fields.RunHistorySize = 0
+		conf.Unlock()
+		defer func() {
+			conf.Lock()
+			conf.fields.RunHistorySize = 10000
+			conf.Unlock()
+		}()
+
+		runRecords.flush()
+		for i := 0; i <= maxRunRecords; i++ {
+			runRecords.add(&runRecord{Name: "build"})
+		}
+		c.So(runRecords.len(), ShouldEqual, maxRunRecords-maxRunRecords/4)
+
+		// the records belong to the current run while commands are running
+		s.reset()
+		s.begin()
+		reclaimMemory()
+		c.So(runRecords.len(), ShouldNotEqual, 0)
+		s.end()
+
+		reclaimMemory()
+		c.So(runRecords.len(), ShouldEqual, 0)
+	})
+}
+
+func TestChainCompletion(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing history ranked chain completion", t, func(c C) {
+
+		var (
+			start   = time.Now()
+			entries = []*historyEntry{
+				{Name: "build", Timestamp: start, Duration: time.Second},
+				{Name: "test", Timestamp: start.Add(2 * time.Second)},
+				{Name: "build", Timestamp: start.Add(time.Minute)},
+				{Name: "deploy", Timestamp: start.Add(time.Minute + time.Second)},
+				{Name: "build", Timestamp: start.Add(2 * time.Minute)},
+				{Name: "test", Timestamp: start.Add(2*time.Minute + time.Second)},
+				// too late to count as following
+				{Name: "clean", Timestamp: start.Add(2 * time.Hour)},
+			}
+			followers = commandFollowers(entries)
+		)
+
+		c.So(followers["build"]["test"], ShouldEqual, 2)
+		c.So(followers["build"]["deploy"], ShouldEqual, 1)
+		c.So(followers["test"]["clean"], ShouldEqual, 0)
+
+		ranked := rankByFollowers("build", []string{"clean", "deploy", "lint", "test"}, followers)
+		c.So(ranked, ShouldResemble, []string{"test", "deploy", "clean", "lint"})
+
+		// unknown commands keep the order
+		c.So(rankByFollowers("lint", []string{"b", "a"}, followers), ShouldResemble, []string{"b", "a"})
+
+		// completion reads the run history
+		os.Remove(runHistoryPath())
+		defer os.Remove(runHistoryPath())
+
+		cmdMap.Lock()
+		cmdMap.items["chain-build"] = &command{name: "chain-build"}
+		cmdMap.items["chain-test"] = &command{name: "chain-test"}
+		cmdMap.Unlock()
+
+		defer func() {
+			cmdMap.Lock()
+			delete(cmdMap.items, "chain-build")
+			delete(cmdMap.items, "chain-test")
+			cmdMap.Unlock()
+		}()
+
+		runHistory.path = ""
+		runHistory.append(&runRecord{Name: "chain-build", Start: time.Now()})
+		runHistory.append(&runRecord{Name: "chain-test", Start: time.Now()})
+
+		c.So(chainCompleter("chain-build -> ")[0], ShouldEqual, "chain-test")
+		c.So(chainCompleter("chain-build arg=1 -> chain-")[0], ShouldEqual, "chain-test")
+	})
+}
+
+func TestBoundedBuffer(t *testing.T) {
+
+	Convey("Testing the bounded stderr buffer", t, func(c C) {
+
+		b := newBoundedBuffer(8)
+		b.Write([]byte("abc"))
+		c.So(b.String(), ShouldEqual, "abc")
+
+		b.Write([]byte("defgh"))
+		c.So(b.String(), ShouldEqual, "abcdefgh")
+
+		b.Write([]byte("ij"))
+		b.Write([]byte("klmnop"))
+		c.So(b.String(), ShouldEqual, "abcd\n... 8 bytes omitted ...\nmnop")
+
+		b.Write([]byte("q"))
+		c.So(b.String(), ShouldEqual, "abcd\n... 9 bytes omitted ...\nnopq")
+
+		unbounded := newBoundedBuffer(0)
+		unbounded.Write(bytes.Repeat([]byte("a"), 100))
+		c.So(unbounded.String(), ShouldHaveLength, 100)
+	})
+}
+
+func TestLineWriter(t *testing.T) {
+
+	Convey("Testing line buffered output", t, func(c C) {
+
+		var (
+			out    bytes.Buffer
+			lock   = &sync.Mutex{}
+			stdout = newLineWriter(&out, lock)
+			stderr = newLineWriter(&out, lock)
+		)
+
+		stdout.Write([]byte("hello "))
+		stderr.Write([]byte("error\n"))
+		stdout.Write([]byte("world\npartial"))
+		c.So(out.String(), ShouldEqual, "error\nhello world\n")
+
+		// partial lines are written after a short delay
+		time.Sleep(2 * partialLineDelay)
+		c.So(out.String(), ShouldEqual, "error\nhello world\npartial")
+
+		stdout.Write([]byte(" line"))
+		stdout.flush()
+		c.So(out.String(), ShouldEqual, "error\nhello world\npartial line")
+	})
+}
+
+func TestRerunState(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing the rerun state", t, func(c C) {
+
+		os.Remove(rerunStatePath())
+		defer os.Remove(rerunStatePath())
+
+		steps := []string{"clean", "  build   name=test ", "deploy"}
+		key := invocationKey(steps)
+		c.So(key, ShouldEqual, "clean -> build name=test -> deploy")
+
+		recordInvocation(key, steps, 2)
+
+		state := loadRerunState()
+		c.So(state.LastFailed, ShouldEqual, key)
+		c.So(state.Failed[key].Failed, ShouldEqual, 2)
+		c.So(state.Last, ShouldResemble, steps)
+
+		recordInvocation(key, steps, -1)
+
+		state = loadRerunState()
+		c.So(state.LastFailed, ShouldBeEmpty)
+		c.So(state.Failed, ShouldBeEmpty)
+	})
+}
+
+func TestPTY(t *testing.T) {
+
+	Convey("Testing commands attached to a pseudo terminal", t, func(c C) {
+
+		var (
+			out bytes.Buffer
+			cmd = exec.Command("sh", "-c", "test -t 1 && echo terminal")
+		)
+
+		wait, err := startPTY(cmd, &out)
+		c.So(err, ShouldBeNil)
+		c.So(cmd.Wait(), ShouldBeNil)
+		wait()
+
+		c.So(out.String(), ShouldContainSubstring, "terminal")
+	})
+}
+
+func TestEventPatterns(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing event glob patterns and chaining", t, func(c C) {
+
+		c.So(globBase("src/**/*.go"), ShouldEqual, "src")
+		c.So(globBase("*.go"), ShouldEqual, ".")
+		c.So(globBase("docs/index.md"), ShouldEqual, "docs/index.md")
+
+		c.So(matchGlob("src/**/*.go", "src/main.go"), ShouldBeTrue)
+		c.So(matchGlob("src/**/*.go", "src/a/b/main.go"), ShouldBeTrue)
+		c.So(matchGlob("src/**/*.go", "src/a/b/main.js"), ShouldBeFalse)
+		c.So(matchGlob("src/*.go", "src/a/main.go"), ShouldBeFalse)
+
+		c.So(isIgnored("web/node_modules/x/index.js", defaultEventIgnore), ShouldBeTrue)
+		c.So(isIgnored("api/api.pb.go", []string{"**/*.pb.go"}), ShouldBeTrue)
+		c.So(isIgnored("api/api.go", []string{"*.pb.go"}), ShouldBeFalse)
+
+		var fired []string
+		first := newEvent("tests", fsnotify.Write, "first", "", "", "", func(fsnotify.Event) {
+			fired = append(fired, "first")
+		})
+		second := newEvent("tests", fsnotify.Write, "second", "", "", "", func(fsnotify.Event) {
+			fired = append(fired, "second")
+		})
+
+		projectData.Lock()
+		projectData.fields.Events[first.ID] = first
+		projectData.fields.Events[second.ID] = second
+		projectData.Unlock()
+
+		defer func() {
+			projectData.Lock()
+			delete(projectData.fields.Events, first.ID)
+			delete(projectData.fields.Events, second.ID)
+			projectData.Unlock()
+		}()
+
+		c.So(chainEvents(first.ID, second.ID), ShouldBeNil)
+		c.So(chainEvents(second.ID, first.ID), ShouldBeNil)
+		c.So(chainEvents(first.ID, "unknown"), ShouldNotBeNil)
+
+		// the loop must be detected
+		c.So(testEvent(first.ID), ShouldBeNil)
+		c.So(fired, ShouldResemble, []string{"first", "second"})
+	})
+}
+
+func TestAtomicWrites(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing atomic writes and backup recovery", t, func(c C) {
+
+		dir, err := ioutil.TempDir("", "zeus-atomic")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "data.yml")
+
+		c.So(writeFileWithBackup(path, []byte("author: first\n"), 0700), ShouldBeNil)
+		c.So(writeFileWithBackup(path, []byte("author: second\n"), 0700), ShouldBeNil)
+
+		backup, err := ioutil.ReadFile(path + backupSuffix)
+		c.So(err, ShouldBeNil)
+		c.So(string(backup), ShouldEqual, "author: first\n")
+
+		// no temp files must be left behind
+		files, err := ioutil.ReadDir(dir)
+		c.So(err, ShouldBeNil)
+		c.So(files, ShouldHaveLength, 2)
+
+		// simulate a truncated write
+		ioutil.WriteFile(path, []byte("author: [sec"), 0700)
+
+		d := newData()
+		c.So(unmarshalProjectData([]byte("author: [sec"), d), ShouldNotBeNil)
+
+		restored, err := restoreBackup(path)
+		c.So(err, ShouldBeNil)
+		c.So(unmarshalProjectData(restored, d), ShouldBeNil)
+		c.So(d.fields.Author, ShouldEqual, "first")
+
+		contents, err := ioutil.ReadFile(path)
+		c.So(err, ShouldBeNil)
+		c.So(string(contents), ShouldEqual, "author: first\n")
+	})
+}
+
+func TestProgress(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing progress accounting", t, func(c C) {
+
+		st := &status{}
+
+		st.begin()
+		st.plan(3)
+
+		var (
+			wg        sync.WaitGroup
+			positions = make(chan int, 3)
+		)
+		for i := 0; i < 3; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				positions <- st.next(stateExecuted)
+			}()
+		}
+		wg.Wait()
+		close(positions)
+
+		var sum int
+		for pos := range positions {
+			sum += pos
+		}
+		c.So(sum, ShouldEqual, 6)
+		c.So(st.progress(3), ShouldEqual, "[3/3]")
+
+		// nested invocation extends the plan and keeps the counters alive
+		st.begin()
+		st.plan(1)
+		st.end()
+		c.So(st.progress(st.next(stateCached)), ShouldEqual, "[4/4]")
+
+		// unplanned commands never exceed the total
+		c.So(st.progress(st.next(stateDetached)), ShouldEqual, "[5/5]")
+		c.So(st.summary(), ShouldEqual, "finished 5 of 5 commands: 3 executed, 1 detached, 1 cached")
+
+		st.end()
+		c.So(st.numCommands, ShouldEqual, 0)
+		c.So(st.currentCommand, ShouldEqual, 0)
+		c.So(st.summary(), ShouldBeEmpty)
+
+		// shared dependencies are planned once, like they are started
+		items := map[string]*command{
+			"pp-gen": {name: "pp-gen"},
+			"pp-a":   {name: "pp-a", dependencies: []string{"pp-gen"}},
+			"pp-b":   {name: "pp-b", dependencies: []string{"pp-gen", "pp-a name=x"}},
+			"pp-top": {name: "pp-top", dependencies: []string{"pp-a", "pp-b"}},
+		}
+		cmdMap.Lock()
+		for name, cmd := range items {
+			cmdMap.items[name] = cmd
+		}
+		cmdMap.Unlock()
+		defer func() {
+			cmdMap.Lock()
+			for name := range items {
+				delete(cmdMap.items, name)
+			}
+			cmdMap.Unlock()
+		}()
+
+		plan, err := executionPlan(items["pp-top"])
+		c.So(err, ShouldBeNil)
+		c.So(plan, ShouldResemble, []string{"pp-gen", "pp-a", "pp-a name=x", "pp-b", "pp-top"})
+	})
+}
+
+func TestVCS(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing the version control systems", t, func(c C) {
+
+		dir, err := ioutil.TempDir("", "zeus-vcs")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		// the nearest repository wins
+		sub := filepath.Join(dir, "project", "sub")
+		c.So(os.MkdirAll(sub, 0700), ShouldBeNil)
+		c.So(detectVCS(sub), ShouldResemble, noVCS{})
+		c.So(os.Mkdir(filepath.Join(dir, ".hg"), 0700), ShouldBeNil)
+		c.So(detectVCS(sub), ShouldResemble, mercurialVCS{})
+		c.So(os.Mkdir(filepath.Join(dir, "project", ".git"), 0700), ShouldBeNil)
+		c.So(detectVCS(sub), ShouldResemble, gitVCS{})
+
+		c.So(parseVCSLog("2017-01-01 12:00 +0100\x00alice\x00fix: the build\ninvalid\n"), ShouldResemble, []vcsCommit{
+			{date: "2017-01-01 12:00 +0100", author: "alice", subject: "fix: the build"},
+		})
+
+		// a git repository with a modified and an untracked file
+		repo := filepath.Join(dir, "repo")
+		c.So(exec.Command("git", "init", "-q", repo).Run(), ShouldBeNil)
+		c.So(ioutil.WriteFile(filepath.Join(repo, "tracked.txt"), []byte("one"), 0600), ShouldBeNil)
+		for _, args := range [][]string{
+			{"add", "tracked.txt"},
+			{"-c", "user.name=zeus", "-c", "user.email=zeus@example.com", "commit", "-q", "-m", "initial commit"},
+		} {
+			c.So(exec.Command("git", append([]string{"-C", repo}, args...)...).Run(), ShouldBeNil)
+		}
+		c.So(ioutil.WriteFile(filepath.Join(repo, "tracked.txt"), []byte("two"), 0600), ShouldBeNil)
+		c.So(ioutil.WriteFile(filepath.Join(repo, "untracked.txt"), []byte("new"), 0600), ShouldBeNil)
+
+		wd, err := os.Getwd()
+		c.So(err, ShouldBeNil)
+		c.So(os.Chdir(repo), ShouldBeNil)
+		defer os.Chdir(wd)
+
+		c.So(projectVCS(), ShouldResemble, gitVCS{})
+
+		files, err := projectVCS().changedFiles("HEAD")
+		c.So(err, ShouldBeNil)
+		c.So(files, ShouldResemble, []string{"tracked.txt", "untracked.txt"})
+
+		commits, err := projectVCS().log(0)
+		c.So(err, ShouldBeNil)
+		c.So(len(commits), ShouldEqual, 1)
+		c.So(commits[0].author, ShouldEqual, "zeus")
+		c.So(commits[0].subject, ShouldEqual, "initial commit")
+
+		rev, err := projectVCS().revision()
+		c.So(err, ShouldBeNil)
+		c.So(rev, ShouldNotBeEmpty)
+
+		// version control can be disabled in the config
+		conf.Lock()
+		conf.fields.VCS = vcsNone
+		conf.Unlock()
+		defer func() {
+			conf.Lock()
+			conf.fields.VCS = vcsAuto
+			conf.Unlock()
+		}()
+
+		c.So(projectVCS(), ShouldResemble, noVCS{})
+		c.So(handleAffectedCommand([]string{affectedCommand, affectedFlagSince, "HEAD"}), ShouldEqual, ErrNoVCS)
+		_, err = renderTemplate("{{ gitSHA }}")
+		c.So(err, ShouldNotBeNil)
+
+		_, err = gitHooksDir()
+		c.So(err, ShouldEqual, ErrNotAGitRepository)
+	})
+}
+
+func TestGitHooks(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing git hook shims", t, func(c C) {
+
+		dir, err := ioutil.TempDir("", "zeus-githooks")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		c.So(exec.Command("git", "init", "-q", dir).Run(), ShouldBeNil)
+
+		wd, err := os.Getwd()
+		c.So(err, ShouldBeNil)
+		c.So(os.Chdir(dir), ShouldBeNil)
+		defer os.Chdir(wd)
+
+		previousWorkingDir := workingDir
+		workingDir = dir
+		defer func() {
+			workingDir = previousWorkingDir
+		}()
+
+		hooksDir := filepath.Join(dir, ".git", "hooks")
+		c.So(os.MkdirAll(hooksDir, 0700), ShouldBeNil)
+		c.So(ioutil.WriteFile(filepath.Join(hooksDir, "pre-push"), []byte("#!/bin/sh\nexit 0\n"), 0755), ShouldBeNil)
+
+		gitHooks.Lock()
+		gitHooks.items = map[string]string{
+			"pre-commit": "clean -> build",
+			"commit-msg": "build name=it's",
+			"pre-push":   "clean",
+		}
+		gitHooks.Unlock()
+
+		c.So(installGitHooks(), ShouldBeNil)
+		c.So(installedGitHooks(hooksDir), ShouldResemble, []string{"pre-commit", "commit-msg"})
+
+		shim, err := ioutil.ReadFile(filepath.Join(hooksDir, "pre-commit"))
+		c.So(err, ShouldBeNil)
+		c.So(string(shim), ShouldContainSubstring, "exec zeus 'clean -> build'")
+
+		shim, err = ioutil.ReadFile(filepath.Join(hooksDir, "commit-msg"))
+		c.So(err, ShouldBeNil)
+		c.So(string(shim), ShouldContainSubstring, `exec zeus 'build' 'name=it'\''s'`)
+
+		// hooks that were not generated by zeus are left untouched
+		shim, err = ioutil.ReadFile(filepath.Join(hooksDir, "pre-push"))
+		c.So(err, ShouldBeNil)
+		c.So(string(shim), ShouldEqual, "#!/bin/sh\nexit 0\n")
+
+		// removed declarations are removed from the hooks directory
+		gitHooks.Lock()
+		gitHooks.items = map[string]string{
+			"pre-commit": "build",
+		}
+		gitHooks.Unlock()
+
+		c.So(installGitHooks(), ShouldBeNil)
+		c.So(installedGitHooks(hooksDir), ShouldResemble, []string{"pre-commit"})
+
+		c.So(uninstallGitHooks(), ShouldBeNil)
+		c.So(installedGitHooks(hooksDir), ShouldBeEmpty)
+		_, err = os.Stat(filepath.Join(hooksDir, "pre-push"))
+		c.So(err, ShouldBeNil)
+
+		gitHooks.Lock()
+		gitHooks.items = make(map[string]string, 0)
+		gitHooks.Unlock()
+	})
+}
+
+func TestCommandOrder(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing deterministic command ordering", t, func(c C) {
+
+		defer func() {
+			conf.fields.CommandOrder = commandOrderAlphabetical
+		}()
+
+		c.So(commandNamespace("build-linux"), ShouldEqual, "build")
+		c.So(commandNamespace("test:unit"), ShouldEqual, "test")
+		c.So(commandNamespace("clean"), ShouldEqual, "clean")
+
+		names := []string{"buildx", "build-linux", "clean", "build", "build-darwin", "release"}
+
+		conf.fields.CommandOrder = commandOrderAlphabetical
+		sortCommandNames(names)
+		c.So(names, ShouldResemble, []string{"build", "build-darwin", "build-linux", "buildx", "clean", "release"})
+
+		conf.fields.CommandOrder = commandOrderGroup
+		sortCommandNames(names)
+		c.So(names, ShouldResemble, []string{"build", "build-darwin", "build-linux", "buildx", "clean", "release"})
+
+		groups, members := groupCommandNames(names)
+		c.So(groups, ShouldResemble, []string{"", "build"})
+		c.So(members[""], ShouldResemble, []string{"buildx", "clean", "release"})
+		c.So(members["build"], ShouldResemble, []string{"build", "build-darwin", "build-linux"})
+
+		c.So(sortedKeys(map[string]string{"b": "", "c": "", "a": ""}), ShouldResemble, []string{"a", "b", "c"})
+	})
+}
+
+func TestCommandOverview(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing the command overview", t, func(c C) {
+
+		c.So(truncate("description", 20), ShouldEqual, "description")
+		c.So(truncate("description", 5), ShouldEqual, "desc…")
+		c.So(truncate("description", 0), ShouldEqual, "")
+
+		cmdMap.Lock()
+		cmdMap.items["ov-build"] = &command{name: "ov-build", description: strings.Repeat("long description ", 10)}
+		cmdMap.items["ov-test"] = &command{name: "ov-test", description: "run the tests", dependencies: []string{"ov-build"}}
+		cmdMap.Unlock()
+		defer func() {
+			cmdMap.Lock()
+			delete(cmdMap.items, "ov-build")
+			delete(cmdMap.items, "ov-test")
+			cmdMap.Unlock()
+			l.SetOutput(os.Stdout)
+			conf.fields.Quiet = false
+		}()
+
+		var buf bytes.Buffer
+		l.SetOutput(&buf)
+
+		printCommandOverview(false)
+		out := buf.String()
+		c.So(out, ShouldContainSubstring, "\nov\n")
+		c.So(out, ShouldContainSubstring, "run the tests")
+		c.So(out, ShouldNotContainSubstring, pad("deps", 6)+"ov-build")
+
+		// descriptions are cut at the terminal width
+		for _, line := range strings.Split(out, "\n") {
+			if strings.Contains(line, "long description") {
+				c.So(line, ShouldEndWith, "…")
+			}
+		}
+
+		buf.Reset()
+		printCommandOverview(true)
+		c.So(buf.String(), ShouldContainSubstring, pad("deps", 6)+"ov-build")
+
+		// quiet mode prints the names in columns
+		conf.fields.Quiet = true
+		buf.Reset()
+		printCommandOverview(false)
+		c.So(buf.String(), ShouldNotContainSubstring, "run the tests")
+		c.So(buf.String(), ShouldContainSubstring, "ov-test")
+	})
+}
+
+func TestTerminalWidth(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing output for the terminal width", t, func(c C) {
+
+		atomic.StoreInt64(&termWidth, 20)
+		defer atomic.StoreInt64(&termWidth, 0)
+
+		c.So(terminalWidth(), ShouldEqual, 20)
+		c.So(len(ruler(" |", "-", "|")), ShouldEqual, 20)
+
+		// lines that fit are kept, including their indentation
+		c.So(wrapText("  indented line", 20, ""), ShouldEqual, "  indented line")
+		c.So(wrapText("the quick brown fox jumps over the lazy dog", 20, "  "), ShouldEqual, "the quick brown fox\n  jumps over the\n  lazy dog")
+		c.So(wrapText("abcdefghijklmnopqrstuvwxyz", 10, ""), ShouldEqual, "abcdefghij\nklmnopqrst\nuvwxyz")
+
+		// color codes do not count towards the width
+		line := ansi.Red + "0123456789" + ansi.Reset + "0123456789"
+		c.So(visibleLength(line), ShouldEqual, 20)
+		c.So(fitLine(line), ShouldEqual, line)
+
+		line = ansi.Red + "0123456789" + ansi.Reset + "0123456789abc"
+		c.So(fitLine(line), ShouldEqual, ansi.Red+"0123456789"+ansi.Reset+"012345678…"+cp.Reset)
+	})
+}
+
+func TestAccessibleMode(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing plain text output for screen readers", t, func(c C) {
+
+		c.So(marker("✔ ", "ok "), ShouldEqual, "✔ ")
+
+		conf.fields.Accessible = true
+		atomic.StoreInt64(&termWidth, 20)
+		defer func() {
+			conf.fields.Accessible = false
+			atomic.StoreInt64(&termWidth, 0)
+			l.SetOutput(os.Stdout)
+		}()
+
+		c.So(marker("✔ ", "ok "), ShouldEqual, "ok ")
+		c.So(ruler(" |", "-", "|"), ShouldBeEmpty)
+		c.So(truncate("description", 8), ShouldEqual, "descr...")
+		c.So(fitLine(strings.Repeat("x", 30)), ShouldEqual, strings.Repeat("x", 17)+"..."+cp.Reset)
+		c.So(printPrompt(), ShouldNotContainSubstring, "»")
+
+		var buf bytes.Buffer
+		l.SetOutput(&buf)
+		printBanner()
+		c.So(buf.String(), ShouldEqual, "ZEUS v"+version+"\n")
+	})
+}
+
+func TestDisplayGroups(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing display groups from the CommandsFile", t, func(c C) {
+
+		cmdMap.Lock()
+		cmdMap.items["dg-build"] = &command{name: "dg-build", description: "build it"}
+		cmdMap.items["dg-clean"] = &command{name: "dg-clean"}
+		cmdMap.items["dg-release"] = &command{name: "dg-release"}
+		cmdMap.items["dg-other"] = &command{name: "dg-other"}
+		cmdMap.Unlock()
+		defer func() {
+			cmdMap.Lock()
+			delete(cmdMap.items, "dg-build")
+			delete(cmdMap.items, "dg-clean")
+			delete(cmdMap.items, "dg-release")
+			delete(cmdMap.items, "dg-other")
+			c.So(initGroups(nil), ShouldBeNil)
+			cmdMap.Unlock()
+			l.SetOutput(os.Stdout)
+		}()
+
+		parse := func(contents string) error {
+			var groups yaml.MapSlice
+			c.So(yaml.Unmarshal([]byte(contents), &groups), ShouldBeNil)
+			cmdMap.Lock()
+			defer cmdMap.Unlock()
+			return initGroups(groups)
+		}
+
+		c.So(parse("Release: [dg-release]\nBuild: [dg-clean, dg-build]\n"), ShouldBeNil)
+
+		// grouped commands come first, in the declared order
+		names := []string{"dg-other", "dg-build", "dg-release", "dg-clean"}
+		sortCommandNames(names)
+		c.So(names, ShouldResemble, []string{"dg-release", "dg-clean", "dg-build", "dg-other"})
+
+		groups, members, ok := displayGroups.split(names)
+		c.So(ok, ShouldBeTrue)
+		c.So(groups, ShouldResemble, []string{"Release", "Build", ""})
+		c.So(members["Build"], ShouldResemble, []string{"dg-clean", "dg-build"})
+		c.So(members[""], ShouldResemble, []string{"dg-other"})
+
+		var buf bytes.Buffer
+		l.SetOutput(&buf)
+		printCommandOverview(false)
+		out := buf.String()
+		c.So(strings.Index(out, "Release"), ShouldBeLessThan, strings.Index(out, "Build"))
+		c.So(strings.Index(out, "dg-clean"), ShouldBeLessThan, strings.Index(out, "dg-build"))
+		c.So(out, ShouldContainSubstring, "\nother\n")
+
+		c.So(parse("Build: [dg-missing]\n").Error(), ShouldEqual, "Build: "+ErrUnknownCommand.Error()+": dg-missing")
+		c.So(parse("Build: [dg-build]\nTest: [dg-build]\n").Error(), ShouldEqual, "Test: "+ErrDuplicateGroupMember.Error()+": dg-build")
+		c.So(parse("Build: dg-build\n").Error(), ShouldEqual, "Build: "+ErrInvalidGroup.Error())
+
+		// group names after the commands are not taken for command names
+		c.So(validateCommandsFile([]byte("commands:\n    build:\n        exec: make\ngroups:\n    build:\n        - build\n")), ShouldBeNil)
+	})
+}
+
+func TestAffected(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing affected command selection", t, func(c C) {
+
+		c.So(matchInput("src/**/*.go", "src/a/main.go"), ShouldBeTrue)
+		c.So(matchInput("assets", "assets/img/logo.png"), ShouldBeTrue)
+		c.So(matchInput("assets", "assets-old/logo.png"), ShouldBeFalse)
+		c.So(matchInput("go.mod", "go.mod"), ShouldBeTrue)
+
+		cmdMap.Lock()
+		cmdMap.items["affected-lib"] = &command{name: "affected-lib", inputs: []string{"lib/**/*.go"}}
+		cmdMap.items["affected-app"] = &command{name: "affected-app", dependencies: []string{"affected-lib"}}
+		cmdMap.items["affected-docs"] = &command{name: "affected-docs", inputs: []string{"docs"}}
+		cmdMap.Unlock()
+
+		defer func() {
+			cmdMap.Lock()
+			delete(cmdMap.items, "affected-lib")
+			delete(cmdMap.items, "affected-app")
+			delete(cmdMap.items, "affected-docs")
+			cmdMap.Unlock()
+		}()
+
+		affected := affectedCommands([]string{"lib/util/strings.go", "README.md"})
+		c.So(affected, ShouldResemble, []string{"affected-app", "affected-lib"})
+		c.So(affectedTargets(affected), ShouldResemble, []string{"affected-app"})
+
+		affected = affectedCommands([]string{"docs/index.md"})
+		c.So(affected, ShouldResemble, []string{"affected-docs"})
+		c.So(affectedTargets(affected), ShouldResemble, []string{"affected-docs"})
+	})
+}
+
+func TestEnvironment(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing environment checks", t, func(c C) {
+
+		c.So(versionSatisfies("1.15.3", ">=", "1.15"), ShouldBeTrue)
+		c.So(versionSatisfies("1.9", ">=", "1.15"), ShouldBeFalse)
+		c.So(versionSatisfies("14.17.0", "", "14"), ShouldBeTrue)
+		c.So(versionSatisfies("140.1", "", "14"), ShouldBeFalse)
+		c.So(versionSatisfies("2.0", "<", "2.0.1"), ShouldBeTrue)
+
+		c.So(initEnvironment(&environmentData{Tools: []string{"go >= one"}}), ShouldNotBeNil)
+
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		c.So(err, ShouldBeNil)
+		defer ln.Close()
+
+		os.Setenv("ZEUS_ENV_TEST", "dev")
+		defer os.Unsetenv("ZEUS_ENV_TEST")
+
+		c.So(initEnvironment(&environmentData{
+			Tools:     []string{"sh", "zeus-missing-tool >= 1.0"},
+			Variables: []string{"ZEUS_ENV_TEST", "ZEUS_ENV_TEST=prod", "ZEUS_ENV_UNSET"},
+			Services:  []string{ln.Addr().String()},
+		}), ShouldBeNil)
+		defer initEnvironment(nil)
+
+		var ok []bool
+		for _, check := range checkEnvironment() {
+			ok = append(ok, check.ok)
+		}
+		c.So(ok, ShouldResemble, []bool{true, false, true, false, false, true})
+
+		c.So(handleEnvCommand([]string{"env", "diff"}), ShouldEqual, ErrEnvironmentDiffers)
+		c.So(handleEnvCommand([]string{"env", "list"}), ShouldEqual, ErrInvalidUsage)
+	})
+}
+
+func TestCommandRequirements(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing the requirements of commands", t, func(c C) {
+
+		c.So(validateRequirements([]string{"docker >= 24", "sh", "node 18"}), ShouldBeNil)
+		c.So(validateRequirements([]string{"docker >= twenty"}), ShouldNotBeNil)
+
+		d := &commandData{Requires: []string{">= 1"}, Exec: "true"}
+		err := d.init(newCommandsFile(), "requires-invalid")
+		c.So(err, ShouldNotBeNil)
+		c.So(err.Error(), ShouldContainSubstring, ErrInvalidToolRequirement.Error())
+
+		cmdMap.Lock()
+		cmdMap.items["requires-build"] = &command{name: "requires-build", language: "bash", requires: []string{"sh"}}
+		cmdMap.items["requires-deploy"] = &command{name: "requires-deploy", language: "bash", requires: []string{"zeus-missing-tool >= 1.0"}}
+		cmdMap.items["requires-release"] = &command{name: "requires-release", language: "bash", dependencies: []string{"requires-build", "requires-deploy env=prod"}}
+		cmdMap.Unlock()
+
+		defer func() {
+			cmdMap.Lock()
+			for _, name := range []string{"requires-build", "requires-deploy", "requires-release"} {
+				delete(cmdMap.items, name)
+			}
+			cmdMap.Unlock()
+		}()
+
+		release, err := cmdMap.getCommand("requires-release")
+		c.So(err, ShouldBeNil)
+
+		var names []string
+		for _, cmd := range release.requirementCommands(true) {
+			names = append(names, cmd.name)
+		}
+		c.So(names, ShouldResemble, []string{"requires-release", "requires-build", "requires-deploy"})
+
+		// the dependencies are checked before anything runs
+		c.So(release.checkRequirements(false), ShouldBeNil)
+		err = release.checkRequirements(true)
+		c.So(err, ShouldNotBeNil)
+		c.So(err.Error(), ShouldStartWith, ErrRequirementNotMet.Error()+": requires-deploy requires zeus-missing-tool >= 1.0: install zeus-missing-tool")
+
+		err = release.Run(nil, false)
+		c.So(err, ShouldNotBeNil)
+		c.So(err.Error(), ShouldStartWith, ErrRequirementNotMet.Error())
+
+		// met requirements are cached
+		build, err := cmdMap.getCommand("requires-build")
+		c.So(err, ShouldBeNil)
+		c.So(build.checkRequirements(true), ShouldBeNil)
+		metRequirements.Lock()
+		c.So(metRequirements.items, ShouldContainKey, "sh")
+		c.So(metRequirements.items, ShouldNotContainKey, "zeus-missing-tool >= 1.0")
+		metRequirements.Unlock()
+
+		var buf bytes.Buffer
+		l.SetOutput(&buf)
+		err = handleDoctorCommand([]string{doctorCommand})
+		l.SetOutput(os.Stdout)
+		c.So(err, ShouldEqual, ErrDoctorFindings)
+
+		out := stripANSI(buf.String())
+		c.So(out, ShouldContainSubstring, "requires-build: sh")
+		c.So(out, ShouldContainSubstring, "requires-deploy: zeus-missing-tool >= 1.0")
+		c.So(out, ShouldContainSubstring, "interpreters\n")
+		c.So(handleDoctorCommand([]string{doctorCommand, "all"}), ShouldEqual, ErrInvalidUsage)
+	})
+}
+
+func TestToolchain(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing the toolchain", t, func(c C) {
+
+		dir, err := ioutil.TempDir("", "zeus-toolchain")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		prev := zeusDir
+		zeusDir = dir
+		defer func() {
+			zeusDir = prev
+			initToolchain(nil)
+		}()
+
+		// a tar.gz with an executable and a link to it
+		var archive bytes.Buffer
+		gz := gzip.NewWriter(&archive)
+		tw := tar.NewWriter(gz)
+		script := []byte("#!/bin/sh\necho pkgtool 2.0.0\n")
+		c.So(tw.WriteHeader(&tar.Header{Name: "pkg-2.0.0/bin/pkgtool", Mode: 0755, Size: int64(len(script)), Typeflag: tar.TypeReg}), ShouldBeNil)
+		_, err = tw.Write(script)
+		c.So(err, ShouldBeNil)
+		c.So(tw.WriteHeader(&tar.Header{Name: "pkg-2.0.0/bin/pkgalias", Linkname: "pkgtool", Typeflag: tar.TypeSymlink}), ShouldBeNil)
+		c.So(tw.Close(), ShouldBeNil)
+		c.So(gz.Close(), ShouldBeNil)
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/rawtool/1.0.0/" + runtime.GOOS + "-" + runtime.GOARCH:
+				w.Write([]byte("#!/bin/sh\necho rawtool 1.0.0\n"))
+			case "/pkg-2.0.0.tar.gz":
+				w.Write(archive.Bytes())
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+		defer srv.Close()
+
+		commandsFile := newCommandsFile()
+		c.So(yaml.Unmarshal([]byte(`
+toolchain:
+    shfmt: 3.7.0
+    rawtool:
+        version: 1.0.0
+        url: `+srv.URL+`/rawtool/{version}/{os}-{arch}
+    pkgtool:
+        version: 2.0.0
+        url: `+srv.URL+`/pkg-{version}.tar.gz
+        bin:
+            - pkg-{version}/bin/pkgtool
+            - pkg-{version}/bin/pkgalias
+`), commandsFile), ShouldBeNil)
+		c.So(commandsFile.Toolchain["shfmt"].Version, ShouldEqual, "3.7.0")
+		delete(commandsFile.Toolchain, "shfmt")
+
+		c.So(initToolchain(map[string]*toolData{"sometool": {URL: "https://example.com"}}).Error(), ShouldEqual, ErrMissingToolVersion.Error()+": sometool")
+		c.So(initToolchain(map[string]*toolData{"sometool": {Version: "1.0"}}).Error(), ShouldEqual, ErrUnknownTool.Error()+": sometool")
+
+		// the recipes fill in the download
+		c.So(initToolchain(map[string]*toolData{"node": {Version: "18.17.0"}}), ShouldBeNil)
+		node, ok := projectToolchain.get("node")
+		c.So(ok, ShouldBeTrue)
+		c.So(node.Bin, ShouldHaveLength, 3)
+		if runtime.GOARCH == "amd64" {
+			c.So(node.expand(node.URL), ShouldEqual, "https://nodejs.org/dist/v18.17.0/node-v18.17.0-"+runtime.GOOS+"-x64.tar.gz")
+		}
+
+		c.So(initToolchain(commandsFile.Toolchain), ShouldBeNil)
+		bin, err := filepath.Abs(toolchainBinDir())
+		c.So(err, ShouldBeNil)
+		c.So(os.Getenv("PATH"), ShouldStartWith, bin+string(os.PathListSeparator))
+
+		var buf bytes.Buffer
+		l.SetOutput(&buf)
+		defer l.SetOutput(os.Stdout)
+
+		c.So(ensureToolchain(), ShouldBeNil)
+		c.So(stripANSI(buf.String()), ShouldContainSubstring, "installing pkgtool 2.0.0")
+
+		for _, name := range []string{"rawtool", "pkgtool", "pkgalias"} {
+			path, err := exec.LookPath(name)
+			c.So(err, ShouldBeNil)
+			c.So(path, ShouldStartWith, bin)
+		}
+		out, err := exec.Command("pkgalias").Output()
+		c.So(err, ShouldBeNil)
+		c.So(string(out), ShouldEqual, "pkgtool 2.0.0\n")
+
+		// installed tools are not downloaded again
+		buf.Reset()
+		c.So(ensureToolchain(), ShouldBeNil)
+		c.So(buf.String(), ShouldBeEmpty)
+
+		// the checksums are recorded and verified
+		locks, err := readToolchainLock()
+		c.So(err, ShouldBeNil)
+		c.So(locks["rawtool"].Version, ShouldEqual, "1.0.0")
+		c.So(locks["rawtool"].Checksums, ShouldContainKey, toolPlatform())
+
+		locks["rawtool"].Checksums[toolPlatform()] = "0000"
+		c.So(writeToolchainLock(locks), ShouldBeNil)
+		err = handleToolchainCommand([]string{toolchainCommand, "install", "rawtool"})
+		c.So(err, ShouldNotBeNil)
+		c.So(err.Error(), ShouldContainSubstring, ErrChecksumMismatch.Error())
+
+		raw, _ := projectToolchain.get("rawtool")
+		raw.Checksums = map[string]string{toolPlatform(): "1111"}
+		err = handleToolchainCommand([]string{toolchainCommand, "install", "rawtool"})
+		c.So(err, ShouldNotBeNil)
+		c.So(err.Error(), ShouldContainSubstring, ErrChecksumMismatch.Error()+": expected 1111")
+
+		// the installed version is kept when a download fails
+		c.So(raw.installed("rawtool"), ShouldBeTrue)
+
+		c.So(handleToolchainCommand([]string{toolchainCommand, "install", "missing"}), ShouldNotBeNil)
+		c.So(handleToolchainCommand([]string{toolchainCommand, "clean", "all"}), ShouldEqual, ErrInvalidUsage)
+
+		buf.Reset()
+		c.So(handleToolchainCommand([]string{toolchainCommand}), ShouldBeNil)
+		c.So(stripANSI(buf.String()), ShouldContainSubstring, "installed")
+
+		c.So(handleToolchainCommand([]string{toolchainCommand, "clean"}), ShouldBeNil)
+		_, err = os.Stat(toolchainDir())
+		c.So(os.IsNotExist(err), ShouldBeTrue)
+		c.So(raw.installed("rawtool"), ShouldBeFalse)
+
+		// archives can not write outside of the tool directory
+		archive.Reset()
+		gz = gzip.NewWriter(&archive)
+		tw = tar.NewWriter(gz)
+		c.So(tw.WriteHeader(&tar.Header{Name: "../escape", Mode: 0600, Typeflag: tar.TypeReg}), ShouldBeNil)
+		c.So(tw.Close(), ShouldBeNil)
+		c.So(gz.Close(), ShouldBeNil)
+		err = extractTarGz(&archive, dir)
+		c.So(err, ShouldNotBeNil)
+		c.So(err.Error(), ShouldStartWith, ErrUnsafeArchivePath.Error())
+
+		c.So(initToolchain(nil), ShouldBeNil)
+		c.So(os.Getenv("PATH"), ShouldEqual, originalPath)
+	})
+}
+
+func TestUpdate(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing the self-updater", t, func(c C) {
+
+		c.So(newerVersion("0.9.0", "0.8.10"), ShouldBeTrue)
+		c.So(newerVersion("0.8.10", "0.9.0"), ShouldBeFalse)
+		c.So(newerVersion("0.9.0", "0.9.0-beta.2"), ShouldBeTrue)
+		c.So(newerVersion("0.9.0-beta.10", "0.9.0-beta.9"), ShouldBeTrue)
+		c.So(newerVersion("v0.9.0", "0.9.0"), ShouldBeFalse)
+
+		dir, err := ioutil.TempDir("", "zeus-update")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		// release archives with a zeus binary
+		archives := make(map[string][]byte)
+		release := func(v string, binary []byte) {
+			var buf bytes.Buffer
+			gz := gzip.NewWriter(&buf)
+			tw := tar.NewWriter(gz)
+			c.So(tw.WriteHeader(&tar.Header{Name: "zeus", Mode: 0755, Size: int64(len(binary)), Typeflag: tar.TypeReg}), ShouldBeNil)
+			_, err := tw.Write(binary)
+			c.So(err, ShouldBeNil)
+			c.So(tw.Close(), ShouldBeNil)
+			c.So(gz.Close(), ShouldBeNil)
+			archives[v] = buf.Bytes()
+		}
+
+		// the stable release is a real build, the self-test runs it outside of a project
+		build := filepath.Join(dir, "build", "zeus")
+		out, err := exec.Command("go", "build", "-ldflags", "-s -w -X main.version=0.9.0", "-o", build, ".").CombinedOutput()
+		c.So(err, ShouldBeNil)
+		c.So(string(out), ShouldBeEmpty)
+		binary, err := ioutil.ReadFile(build)
+		c.So(err, ShouldBeNil)
+		c.So(selfTest(build, "0.9.0"), ShouldBeNil)
+
+		release("0.9.0", binary)
+		release("0.10.0-beta.1", []byte("#!/bin/sh\necho broken\n"))
+
+		pub, priv, err := ed25519.GenerateKey(nil)
+		c.So(err, ShouldBeNil)
+
+		var srv *httptest.Server
+		srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var releases []*githubRelease
+			for _, tag := range []string{"v0.9.0", "v0.10.0-beta.1", "v1.0.0"} {
+				v := strings.TrimPrefix(tag, "v")
+				releases = append(releases, &githubRelease{
+					TagName:    tag,
+					Prerelease: strings.Contains(tag, "-"),
+					Draft:      tag == "v1.0.0",
+					Assets: []githubAsset{
+						{Name: releaseArchiveName(v), URL: srv.URL + "/" + v + "/archive"},
+						{Name: updateChecksumsAsset, URL: srv.URL + "/" + v + "/checksums"},
+						{Name: updateSignatureAsset, URL: srv.URL + "/" + v + "/signature"},
+					},
+				})
+			}
+
+			parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+			if len(parts) != 2 {
+				json.NewEncoder(w).Encode(releases)
+				return
+			}
+
+			sum := sha256.Sum256(archives[parts[0]])
+			checksums := []byte(hex.EncodeToString(sum[:]) + "  " + releaseArchiveName(parts[0]) + "\n")
+			switch parts[1] {
+			case "archive":
+				w.Write(archives[parts[0]])
+			case "checksums":
+				w.Write(checksums)
+			case "signature":
+				w.Write(ed25519.Sign(priv, checksums))
+			}
+		}))
+		defer srv.Close()
+
+		prevURL, prevKey := updateReleasesURL, updatePublicKey
+		updateReleasesURL = srv.URL + "/releases"
+		updatePublicKey = base64.StdEncoding.EncodeToString(pub)
+		defer func() {
+			updateReleasesURL, updatePublicKey = prevURL, prevKey
+		}()
+
+		var buf bytes.Buffer
+		l.SetOutput(&buf)
+		defer l.SetOutput(os.Stdout)
+
+		r, err := latestRelease(updateChannelStable)
+		c.So(err, ShouldBeNil)
+		c.So(r.version(), ShouldEqual, "0.9.0")
+		r, err = latestRelease(updateChannelBeta)
+		c.So(err, ShouldBeNil)
+		c.So(r.version(), ShouldEqual, "0.10.0-beta.1")
+
+		c.So(handleUpdateCommand([]string{updateCommand, updateFlagCheck, updateFlagChannel, updateChannelStable}), ShouldBeNil)
+		c.So(stripANSI(buf.String()), ShouldContainSubstring, "update available: "+version+" -> 0.9.0 (stable)")
+		c.So(handleUpdateCommand([]string{updateCommand, updateFlagChannel, "nightly"}).Error(), ShouldStartWith, ErrInvalidUpdateChannel.Error())
+		c.So(handleUpdateCommand([]string{updateCommand, updateFlagChannel}), ShouldEqual, ErrInvalidUsage)
+		c.So(handleUpdateCommand([]string{updateCommand, updateFlagRollback, updateFlagCheck}), ShouldEqual, ErrInvalidUsage)
+
+		exe := filepath.Join(dir, "zeus")
+		c.So(ioutil.WriteFile(exe, []byte("#!/bin/sh\necho "+version+"\n"), 0755), ShouldBeNil)
+
+		// the prerelease fails the self-test and the previous binary is restored
+		err = updateZeus(exe, updateChannelBeta)
+		c.So(err, ShouldNotBeNil)
+		c.So(err.Error(), ShouldStartWith, ErrSelfTestFailed.Error())
+		c.So(err.Error(), ShouldEndWith, "rolled back to "+version)
+		out, err = exec.Command(exe).Output()
+		c.So(err, ShouldBeNil)
+		c.So(string(out), ShouldEqual, version+"\n")
+
+		c.So(updateZeus(exe, updateChannelStable), ShouldBeNil)
+		out, err = exec.Command(exe, versionCommand).Output()
+		c.So(err, ShouldBeNil)
+		c.So(string(out), ShouldEqual, "0.9.0\n")
+
+		c.So(rollbackZeus(exe), ShouldBeNil)
+		out, err = exec.Command(exe).Output()
+		c.So(err, ShouldBeNil)
+		c.So(string(out), ShouldEqual, version+"\n")
+		c.So(rollbackZeus(filepath.Join(dir, "missing")), ShouldEqual, ErrNoBackup)
+
+		// downloads have to match the signed checksums
+		other, _, err := ed25519.GenerateKey(nil)
+		c.So(err, ShouldBeNil)
+		updatePublicKey = base64.StdEncoding.EncodeToString(other)
+		_, err = downloadRelease(r)
+		c.So(err, ShouldEqual, ErrInvalidSignature)
+
+		updatePublicKey = base64.StdEncoding.EncodeToString(pub)
+		_, err = downloadRelease(r)
+		c.So(err, ShouldBeNil)
+
+		// releases without a signature are refused
+		unsigned := *r
+		unsigned.Assets = r.Assets[:2]
+		_, err = downloadRelease(&unsigned)
+		c.So(err, ShouldNotBeNil)
+		c.So(err.Error(), ShouldEqual, ErrMissingReleaseAsset.Error()+": "+updateSignatureAsset)
+
+		// a checksums file signed with the test key, raw or base64 encoded
+		sums := []byte("0123abcd  " + releaseArchiveName("0.9.0") + "\n")
+		sig := ed25519.Sign(priv, sums)
+		c.So(verifyReleaseSignature(updatePublicKey, sums, sig), ShouldBeNil)
+		c.So(verifyReleaseSignature(updatePublicKey, sums, []byte(base64.StdEncoding.EncodeToString(sig))), ShouldBeNil)
+		c.So(verifyReleaseSignature(updatePublicKey, append(sums, '#'), sig), ShouldEqual, ErrInvalidSignature)
+
+		// builds without a release key never install updates
+		updatePublicKey = ""
+		_, err = downloadRelease(r)
+		c.So(err, ShouldEqual, ErrNoReleaseKey)
+		updatePublicKey = base64.StdEncoding.EncodeToString(pub)
+
+		// a different archive than the one in the checksums
+		r.Assets[0].URL = srv.URL + "/0.9.0/archive"
+		_, err = downloadRelease(r)
+		c.So(err, ShouldNotBeNil)
+		c.So(err.Error(), ShouldStartWith, ErrChecksumMismatch.Error())
+	})
+}
+
+func TestPlugins(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing plugins", t, func(c C) {
+
+		dir, err := ioutil.TempDir("", "zeus-plugins")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		prevDir, prevPlugins := zeusDir, plugins
+		zeusDir = dir
+		plugins = &pluginRegistry{items: make(map[string]*pluginBuiltin)}
+		defer func() {
+			zeusDir, plugins = prevDir, prevPlugins
+		}()
+
+		c.So(os.MkdirAll(filepath.Join(dir, "plugins"), 0700), ShouldBeNil)
+		script := `#!/bin/sh
+read -r req
+case "$req" in
+*'"type":"describe"'*)
+    echo '{"builtins": [{"name": "hello", "description": "say hello", "completions": ["world"]}, {"name": "deploy", "complete": true}, {"name": "help"}]}' ;;
+*'"type":"complete"'*)
+    echo '{"completions": ["prod", "staging"]}' ;;
+*'"args":["fail"]'*)
+    echo '{"type": "error", "message": "it failed"}' ;;
+*'"type":"run"'*)
+    echo '{"type": "output", "text": "hello from the plugin"}'
+    echo "plain output" ;;
+esac
+`
+		c.So(ioutil.WriteFile(filepath.Join(dir, "plugins", "zeus-hello"), []byte(script), 0700), ShouldBeNil)
+
+		// not executable
+		c.So(ioutil.WriteFile(filepath.Join(dir, "plugins", "zeus-notes"), []byte("notes"), 0600), ShouldBeNil)
+
+		paths := findPlugins()
+		c.So(paths, ShouldContain, filepath.Join(dir, "plugins", "zeus-hello"))
+		c.So(paths, ShouldNotContain, filepath.Join(dir, "plugins", "zeus-notes"))
+
+		// builtins of zeus can not be replaced
+		c.So(plugins.names(), ShouldResemble, []string{"deploy", "hello"})
+
+		hello, ok := plugins.get("hello")
+		c.So(ok, ShouldBeTrue)
+		c.So(hello.completer("hello "), ShouldResemble, []string{"world"})
+		deploy, ok := plugins.get("deploy")
+		c.So(ok, ShouldBeTrue)
+		c.So(deploy.completer("deploy "), ShouldResemble, []string{"prod", "staging"})
+
+		var buf bytes.Buffer
+		l.SetOutput(&buf)
+		defer l.SetOutput(os.Stdout)
+
+		c.So(runPlugin("hello", []string{"world"}), ShouldBeNil)
+		c.So(buf.String(), ShouldEqual, "hello from the plugin\nplain output\n")
+
+		err = runPlugin("hello", []string{"fail"})
+		c.So(err, ShouldNotBeNil)
+		c.So(err.Error(), ShouldEqual, ErrPluginFailed.Error()+": hello: it failed")
+		c.So(runPlugin("missing", nil), ShouldEqual, ErrUnknownCommand)
+
+		buf.Reset()
+		handleLine("hello")
+		c.So(buf.String(), ShouldContainSubstring, "hello from the plugin")
+
+		buf.Reset()
+		printBuiltins()
+		c.So(stripANSI(buf.String()), ShouldContainSubstring, "plugins\n")
+		c.So(stripANSI(buf.String()), ShouldContainSubstring, "say hello")
+	})
+}
+
+func TestCIExport(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing CI pipeline export", t, func(c C) {
+
+		cmdMap.Lock()
+		cmdMap.items["export-gen"] = &command{name: "export-gen", outputs: []string{"gen/api.go"}}
+		cmdMap.items["export-build"] = &command{name: "export-build", dependencies: []string{"export-gen", "export-lint strict=true"}}
+		cmdMap.items["export-lint"] = &command{name: "export-lint"}
+		cmdMap.items["export-deploy"] = &command{name: "export-deploy"}
+		cmdMap.Unlock()
+
+		defer func() {
+			cmdMap.Lock()
+			for _, name := range []string{"export-gen", "export-build", "export-lint", "export-deploy"} {
+				delete(cmdMap.items, name)
+			}
+			cmdMap.Unlock()
+		}()
+
+		p, err := newCIPipeline("export-build -> export-deploy")
+		c.So(err, ShouldBeNil)
+
+		var ids []string
+		for _, job := range p.jobs {
+			ids = append(ids, job.id)
+		}
+		c.So(ids, ShouldResemble, []string{"export-gen", "export-lint-strict-true", "export-build", "export-deploy"})
+		c.So(p.index["export-build"].needs, ShouldResemble, []string{"export-gen", "export-lint-strict-true"})
+		c.So(p.index["export-deploy"].needs, ShouldResemble, []string{"export-build"})
+		c.So(p.index["export-deploy"].depth, ShouldEqual, 2)
+		c.So(p.index["export-lint-strict-true"].invocation, ShouldEqual, "zeus export-lint strict=true")
+
+		github := p.github()
+		c.So(github, ShouldContainSubstring, "        needs: [export-gen, export-lint-strict-true]\n")
+		c.So(github, ShouldContainSubstring, "                  name: export-gen\n")
+		c.So(github, ShouldContainSubstring, "            - run: zeus export-lint strict=true\n")
+
+		gitlab := p.gitlab()
+		c.So(gitlab, ShouldContainSubstring, "stages:\n    - zeus-1\n    - zeus-2\n    - zeus-3\n")
+		c.So(gitlab, ShouldContainSubstring, "export-deploy:\n    stage: zeus-3\n")
+
+		for _, out := range []string{github, gitlab} {
+			var parsed map[string]interface{}
+			c.So(yaml.Unmarshal([]byte(out), &parsed), ShouldBeNil)
+		}
+
+		_, err = newCIPipeline("export-missing")
+		c.So(err, ShouldNotBeNil)
+		c.So(handleExportCommand([]string{"export", "ci", "--format", "jenkins"}), ShouldEqual, ErrUnknownExportFormat)
+
+		os.Setenv(skipDependenciesEnv, "true")
+		defer os.Unsetenv(skipDependenciesEnv)
+		cmd, err := cmdMap.getCommand("export-build")
+		c.So(err, ShouldBeNil)
+		count, err := getTotalDependencyCount(cmd)
+		c.So(err, ShouldBeNil)
+		c.So(count, ShouldEqual, 1)
+	})
+}
+
+func TestStandaloneExport(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing standalone runner export", t, func(c C) {
+
+		dir, err := ioutil.TempDir("", "zeus-standalone")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		greetArgs, err := validateArgs([]string{"name:String", "count:Int?=2"})
+		c.So(err, ShouldBeNil)
+		prepareArgs, err := validateArgs([]string{"mode:String"})
+		c.So(err, ShouldBeNil)
+
+		cmdMap.Lock()
+		cmdMap.items["standalone-prepare"] = &command{
+			name:     "standalone-prepare",
+			language: "bash",
+			args:     prepareArgs,
+			exec:     "echo \"prepare $mode\" > " + filepath.Join(dir, "prepared"),
+		}
+		cmdMap.items["standalone-greet"] = &command{
+			name:         "standalone-greet",
+			language:     "bash",
+			args:         greetArgs,
+			dependencies: []string{"standalone-prepare mode=fast"},
+			exec:         "for i in $(seq $count); do echo \"hello $name '$i'\"; done",
+		}
+		cmdMap.Unlock()
+
+		defer func() {
+			cmdMap.Lock()
+			delete(cmdMap.items, "standalone-prepare")
+			delete(cmdMap.items, "standalone-greet")
+			cmdMap.Unlock()
+		}()
+
+		script := filepath.Join(dir, "greet.sh")
+		c.So(handleExportCommand([]string{"export", "standalone", "standalone-greet", "--output", script}), ShouldBeNil)
+
+		out, err := exec.Command(script, "--name", "world").CombinedOutput()
+		c.So(err, ShouldBeNil)
+		c.So(string(out), ShouldContainSubstring, "hello world '1'\nhello world '2'\n")
+
+		prepared, err := ioutil.ReadFile(filepath.Join(dir, "prepared"))
+		c.So(err, ShouldBeNil)
+		c.So(string(prepared), ShouldEqual, "prepare fast\n")
+
+		out, err = exec.Command(script, "--name=zeus", "--count", "1").CombinedOutput()
+		c.So(err, ShouldBeNil)
+		c.So(string(out), ShouldNotContainSubstring, "'2'")
+
+		_, err = exec.Command(script).CombinedOutput()
+		c.So(err, ShouldNotBeNil)
+		out, err = exec.Command(script, "--name", "x", "--count", "many").CombinedOutput()
+		c.So(err, ShouldNotBeNil)
+		c.So(string(out), ShouldContainSubstring, "invalid value for --count")
+
+		// cyclic dependencies can not be exported
+		cycle, err := cmdMap.getCommand("cycle1")
+		c.So(err, ShouldBeNil)
+		_, err = generateStandalone(cycle)
+		c.So(err.Error(), ShouldStartWith, ErrRecursionLimit.Error())
+	})
+}
+
+func TestUnknownCommands(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing unknown command suggestions and the fallback", t, func(c C) {
+
+		c.So(levenshtein("build", "build"), ShouldEqual, 0)
+		c.So(levenshtein("biuld", "build"), ShouldEqual, 2)
+		c.So(levenshtein("", "test"), ShouldEqual, 4)
+		c.So(levenshtein("tests", "test"), ShouldEqual, 1)
+
+		cmdMap.Lock()
+		cmdMap.items["deploy-staging"] = &command{name: "deploy-staging", language: "bash", exec: "true"}
+		cmdMap.Unlock()
+		defer func() {
+			cmdMap.Lock()
+			delete(cmdMap.items, "deploy-staging")
+			cmdMap.Unlock()
+		}()
+
+		c.So(suggestCommands("deploy-stagign"), ShouldResemble, []string{"deploy-staging"})
+		c.So(suggestCommands("histroy"), ShouldContain, historyCommand)
+		c.So(suggestCommands("qqqqqqqq"), ShouldBeEmpty)
+
+		// without a fallback unknown commands are reported
+		c.So(initFallback(""), ShouldBeNil)
+		c.So(runFallback("dist", nil), ShouldEqual, ErrUnknownCommand)
+
+		c.So(initFallback("   "), ShouldEqual, ErrEmptyFallback)
+
+		dir, err := ioutil.TempDir("", "zeus-fallback")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		c.So(initFallback("cd "+dir+" && touch"), ShouldBeNil)
+		defer initFallback("")
+
+		c.So(runFallback("dist", []string{"release"}), ShouldBeNil)
+		_, err = os.Stat(filepath.Join(dir, "dist"))
+		c.So(err, ShouldBeNil)
+		_, err = os.Stat(filepath.Join(dir, "release"))
+		c.So(err, ShouldBeNil)
+
+		c.So(initFallback("exit 4;"), ShouldBeNil)
+		c.So(exitStatus(runFallback("dist", nil)), ShouldEqual, 4)
+	})
+}
+
+func TestExitCodes(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing exit code propagation", t, func(c C) {
+
+		c.So(exitStatus(nil), ShouldEqual, 0)
+		c.So(exitStatus(errors.New("invalid commandChain")), ShouldEqual, 1)
+
+		cmdMap.Lock()
+		cmdMap.items["exit-three"] = &command{name: "exit-three", language: "bash", exec: "exit 3"}
+		cmdMap.items["exit-dep"] = &command{name: "exit-dep", language: "bash", exec: "true", dependencies: []string{"exit-three"}}
+		cmdMap.Unlock()
+		defer func() {
+			cmdMap.Lock()
+			delete(cmdMap.items, "exit-three")
+			delete(cmdMap.items, "exit-dep")
+			cmdMap.Unlock()
+		}()
+
+		cmd, err := cmdMap.getCommand("exit-three")
+		c.So(err, ShouldBeNil)
+		err = cmd.Run([]string{}, false)
+		c.So(exitCode(err), ShouldEqual, 3)
+		c.So(exitStatus(err), ShouldEqual, 3)
+
+		// the process map remembers the exit code
+		processMapMutex.Lock()
+		last := exitedProcesses[len(exitedProcesses)-1]
+		processMapMutex.Unlock()
+		c.So(last.Name, ShouldEqual, "exit-three")
+		c.So(last.ExitCode, ShouldEqual, 3)
+
+		// failed dependencies and commandChains pass the code on
+		cmd, err = cmdMap.getCommand("exit-dep")
+		c.So(err, ShouldBeNil)
+		err = cmd.Run([]string{}, false)
+		c.So(err.Error(), ShouldStartWith, "dependency error")
+		c.So(exitStatus(err), ShouldEqual, 3)
+
+		c.So(exitStatus(runAlias("exit-dep -> exit-three")), ShouldEqual, 3)
+	})
+}
+
+func TestGracefulShutdown(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing signal forwarding and graceful shutdown", t, func(c C) {
+
+		conf.Lock()
+		grace := conf.fields.GracePeriod
+		conf.fields.GracePeriod = 1
+		conf.Unlock()
+
+		cmdMap.Lock()
+		cmdMap.items["ignore-term"] = &command{name: "ignore-term", language: "bash", exec: "trap '' TERM; sleep 30"}
+		cmdMap.Unlock()
+		defer func() {
+			cmdMap.Lock()
+			delete(cmdMap.items, "ignore-term")
+			cmdMap.Unlock()
+
+			conf.Lock()
+			conf.fields.GracePeriod = grace
+			conf.Unlock()
+		}()
+
+		cmd, err := cmdMap.getCommand("ignore-term")
+		c.So(err, ShouldBeNil)
+
+		done := make(chan error, 1)
+		go func() {
+			done <- cmd.Run([]string{}, false)
+		}()
+
+		// wait until the process has been started
+		for i := 0; i < 100 && runningProcesses() == 0; i++ {
+			time.Sleep(20 * time.Millisecond)
+		}
+		c.So(runningProcesses(), ShouldEqual, 1)
+
+		// the signal is ignored, the process is killed after the grace period
+		start := time.Now()
+		shutdown(syscall.SIGTERM)
+
+		select {
+		case err = <-done:
+		case <-time.After(10 * time.Second):
+			t.Fatal("process was not killed after the grace period")
+		}
+		c.So(time.Since(start), ShouldBeLessThan, 5*time.Second)
+		c.So(exitStatus(err), ShouldEqual, 128+int(syscall.SIGKILL))
+
+		// no further commands are started after a signal
+		s.begin()
+		s.interrupt()
+		c.So(cmd.Run([]string{}, false), ShouldEqual, ErrInterrupted)
+		s.end()
+		s.resume()
+		c.So(s.isInterrupted(), ShouldBeFalse)
+	})
+}
+
+func TestChainOperators(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing parallel and fallback operators in commandChains", t, func(c C) {
+
+		elems, mode, err := parseChainStep(" deploy env=prod || rollback ")
+		c.So(err, ShouldBeNil)
+		c.So(mode, ShouldEqual, chainStepFallback)
+		c.So(elems, ShouldResemble, []string{"deploy env=prod", "rollback"})
+
+		_, mode, err = parseChainStep("a & b & c")
+		c.So(err, ShouldBeNil)
+		c.So(mode, ShouldEqual, chainStepParallel)
+
+		_, _, err = parseChainStep("a & b || c")
+		c.So(err, ShouldEqual, ErrMixedChainOperators)
+
+		// operators in quoted argument values belong to the value
+		elems, mode, err = parseChainStep(`deploy msg="a & b" & notify text='x || y'`)
+		c.So(err, ShouldBeNil)
+		c.So(mode, ShouldEqual, chainStepParallel)
+		c.So(elems, ShouldResemble, []string{`deploy msg="a & b"`, `notify text='x || y'`})
+
+		_, mode, err = parseChainStep(`deploy msg="a & b"`)
+		c.So(err, ShouldBeNil)
+		c.So(mode, ShouldEqual, chainStepSingle)
+
+		cmdMap.Lock()
+		cmdMap.items["op-ok"] = &command{name: "op-ok", language: "bash", exec: "true"}
+		cmdMap.items["op-fail"] = &command{name: "op-fail", language: "bash", exec: "exit 4"}
+		cmdMap.items["op-fail-too"] = &command{name: "op-fail-too", language: "bash", exec: "exit 5"}
+		cmdMap.items["op-sleep"] = &command{name: "op-sleep", language: "bash", exec: "sleep 0.5"}
+		cmdMap.items["op-sleep-too"] = &command{name: "op-sleep-too", language: "bash", exec: "sleep 0.5"}
+		cmdMap.Unlock()
+		defer func() {
+			cmdMap.Lock()
+			for _, name := range []string{"op-ok", "op-fail", "op-fail-too", "op-sleep", "op-sleep-too"} {
+				delete(cmdMap.items, name)
+			}
+			cmdMap.Unlock()
+		}()
+
+		c.So(isCommandChain("op-fail || op-ok"), ShouldBeTrue)
+		c.So(isCommandChain("ls || true"), ShouldBeFalse)
+		c.So(isCommandChain("ls -> true"), ShouldBeTrue)
+
+		_, ok := validCommandChain([]string{"op-ok & op-missing"})
+		c.So(ok, ShouldBeFalse)
+
+		run := func(line string) error {
+			fields := strings.Split(line, commandChainSeparator)
+			cmdChain, ok := validCommandChain(fields)
+			c.So(ok, ShouldBeTrue)
+			return cmdChain.exec(fields)
+		}
+
+		// fallbacks only run if the previous command failed
+		c.So(run("op-fail || op-ok"), ShouldBeNil)
+		c.So(exitStatus(run("op-ok -> op-fail || op-fail-too")), ShouldEqual, 5)
+
+		// parallel commands fail the step if one of them failed
+		c.So(exitStatus(run("op-ok & op-fail -> op-sleep")), ShouldEqual, 4)
+
+		start := time.Now()
+		c.So(run("op-sleep & op-sleep-too"), ShouldBeNil)
+		c.So(time.Since(start), ShouldBeLessThan, 900*time.Millisecond)
+
+		// a dependency shared by parallel commands runs once, before they are started
+		log, err := ioutil.TempFile("", "zeus-chain")
+		c.So(err, ShouldBeNil)
+		log.Close()
+		defer os.Remove(log.Name())
+
+		cmdMap.Lock()
+		cmdMap.items["op-shared"] = &command{name: "op-shared", language: "bash", exec: "echo shared >> " + log.Name()}
+		cmdMap.items["op-first"] = &command{name: "op-first", language: "bash", exec: "echo first >> " + log.Name(), dependencies: []string{"op-shared"}}
+		cmdMap.items["op-second"] = &command{name: "op-second", language: "bash", exec: "echo second >> " + log.Name(), dependencies: []string{"op-shared"}}
+		cmdMap.Unlock()
+		defer func() {
+			cmdMap.Lock()
+			for _, name := range []string{"op-shared", "op-first", "op-second"} {
+				delete(cmdMap.items, name)
+			}
+			cmdMap.Unlock()
+		}()
+
+		c.So(run("op-first & op-second"), ShouldBeNil)
+		contents, err := ioutil.ReadFile(log.Name())
+		c.So(err, ShouldBeNil)
+		lines := strings.Fields(string(contents))
+		c.So(lines, ShouldHaveLength, 3)
+		c.So(lines[0], ShouldEqual, "shared")
+	})
+}
+
+func TestCIMode(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing CI mode", t, func(c C) {
+
+		ci, set := os.LookupEnv("CI")
+		defer func() {
+			if set {
+				os.Setenv("CI", ci)
+			} else {
+				os.Unsetenv("CI")
+			}
+		}()
+
+		os.Setenv("CI", "true")
+		c.So(ciModeDetected(), ShouldBeTrue)
+		os.Setenv("CI", "false")
+		c.So(ciModeDetected(), ShouldBeFalse)
+		os.Unsetenv("CI")
+		c.So(ciModeDetected(), ShouldBeFalse)
+
+		conf.Lock()
+		fields := *conf.fields
+		conf.fields.StopOnError = false
+		conf.Unlock()
+
+		defer func() {
+			ciMode = false
+			conf.Lock()
+			*conf.fields = fields
+			conf.Unlock()
+		}()
+
+		ciMode = true
+		applyCIMode()
+
+		conf.Lock()
+		c.So(conf.fields.Interactive, ShouldBeFalse)
+		c.So(conf.fields.Colors, ShouldBeFalse)
+		c.So(conf.fields.StopOnError, ShouldBeTrue)
+		conf.Unlock()
+
+		cmdMap.Lock()
+		cmdMap.items["ci-fail"] = &command{name: "ci-fail", language: "bash", exec: "exit 3"}
+		cmdMap.Unlock()
+		defer func() {
+			cmdMap.Lock()
+			delete(cmdMap.items, "ci-fail")
+			cmdMap.Unlock()
+		}()
+
+		c.So(runAlias("ci-fail"), ShouldNotBeNil)
+		c.So(runAlias("ci-fail -> ci-fail"), ShouldNotBeNil)
+
+		// a command that can not be started fails the pipeline as well
+		conf.Lock()
+		conf.fields.ProjectLock = true
+		conf.Unlock()
+		defer func() {
+			conf.Lock()
+			conf.fields.ProjectLock = false
+			conf.Unlock()
+			os.Remove(projectLockPath)
+		}()
+
+		contents, err := json.Marshal(&projectLockOwner{PID: 1, RunID: "other", Started: time.Now()})
+		c.So(err, ShouldBeNil)
+		c.So(ioutil.WriteFile(projectLockPath, contents, 0644), ShouldBeNil)
+
+		err = runAlias("ci-fail")
+		c.So(err, ShouldNotBeNil)
+		c.So(err.Error(), ShouldStartWith, ErrProjectLocked.Error())
+		c.So(exitStatus(err), ShouldEqual, 1)
+	})
+}
+
+func TestFormatDuration(t *testing.T) {
+
+	Convey("Testing duration formatting", t, func(c C) {
+
+		d := time.Minute + 23*time.Second + 456*time.Millisecond
+
+		c.So(compactDuration(d, 2), ShouldEqual, "1m 23s")
+		c.So(compactDuration(d, 3), ShouldEqual, "1m 23s 456ms")
+		c.So(compactDuration(d, 1), ShouldEqual, "1m")
+		c.So(compactDuration(1500*time.Millisecond, 2), ShouldEqual, "1s 500ms")
+		c.So(compactDuration(59600*time.Millisecond, 1), ShouldEqual, "1m")
+		c.So(compactDuration(time.Hour+5*time.Second, 2), ShouldEqual, "1h")
+		c.So(compactDuration(42*time.Microsecond, 2), ShouldEqual, "42µs")
+		c.So(compactDuration(0, 2), ShouldEqual, "0s")
+		c.So(compactDuration(-2*time.Second, 2), ShouldEqual, "-2s")
+
+		c.So(durationMillis(d), ShouldEqual, 83456)
+	})
+}
+
+func TestDashboard(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing the web dashboard API", t, func(c C) {
+
+		cmdMap.Lock()
+		cmdMap.items["dashboard-test"] = &command{
+			name:        "dashboard-test",
+			description: "dashboard test command",
+			args: map[string]*commandArg{
+				"name": {name: "name", argType: reflect.String},
+				"race": {name: "race", argType: reflect.Bool, optional: true, defaultValue: "false"},
+			},
+		}
+		cmdMap.Unlock()
+
+		defer func() {
+			cmdMap.Lock()
+			delete(cmdMap.items, "dashboard-test")
+			cmdMap.Unlock()
+		}()
+
+		r := createRouter()
+
+		// list commands
+		req := httptest.NewRequest("GET", "/api/commands", nil)
+		req.RemoteAddr = "127.0.0.1:50000"
+		req.Host = "localhost:8080"
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		c.So(rec.Code, ShouldEqual, http.StatusOK)
+
+		var commands []*dashboardCommand
+		c.So(json.Unmarshal(rec.Body.Bytes(), &commands), ShouldBeNil)
+
+		var found *dashboardCommand
+		for _, cmd := range commands {
+			if cmd.Name == "dashboard-test" {
+				found = cmd
+			}
+		}
+		c.So(found, ShouldNotBeNil)
+		c.So(found.Description, ShouldEqual, "dashboard test command")
+		c.So(found.Arguments, ShouldResemble, []*dashboardArgument{
+			{Name: "name", Type: "String"},
+			{Name: "race", Type: "Bool", Optional: true, Default: "false"},
+		})
+
+		// runs can only be triggered from the local machine without a token
+		req = httptest.NewRequest("POST", "/api/run", strings.NewReader(`{"command":"dashboard-test"}`))
+		req.Header.Set("Content-Type", "application/json")
+		rec = httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		c.So(rec.Code, ShouldEqual, http.StatusUnauthorized)
+
+		// unknown commands
+		req = httptest.NewRequest("POST", "/api/run", strings.NewReader(`{"command":"doesNotExist"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = "127.0.0.1:50000"
+		req.Host = "localhost:8080"
+		rec = httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		c.So(rec.Code, ShouldEqual, http.StatusNotFound)
+
+		// local requests to a foreign host or from a foreign origin need a token as well
+		req = httptest.NewRequest("POST", "/api/run", strings.NewReader(`{"command":"doesNotExist"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = "127.0.0.1:50000"
+		req.Host = "rebind.example.com:8080"
+		rec = httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		c.So(rec.Code, ShouldEqual, http.StatusUnauthorized)
+
+		req = httptest.NewRequest("POST", "/api/run", strings.NewReader(`{"command":"doesNotExist"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Origin", "https://example.com")
+		req.RemoteAddr = "127.0.0.1:50000"
+		req.Host = "localhost:8080"
+		rec = httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		c.So(rec.Code, ShouldEqual, http.StatusUnauthorized)
+
+		// routes that change state only accept JSON
+		req = httptest.NewRequest("POST", "/api/procs/1/kill", nil)
+		req.RemoteAddr = "127.0.0.1:50000"
+		req.Host = "localhost:8080"
+		rec = httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		c.So(rec.Code, ShouldEqual, http.StatusUnsupportedMediaType)
+
+		// processes that have not been spawned by zeus are never killed
+		req = httptest.NewRequest("POST", "/api/procs/1/kill", nil)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Origin", "http://localhost:8080")
+		req.RemoteAddr = "127.0.0.1:50000"
+		req.Host = "localhost:8080"
+		rec = httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		c.So(rec.Code, ShouldEqual, http.StatusNotFound)
+
+		req = httptest.NewRequest("GET", "/api/procs", nil)
+		req.RemoteAddr = "127.0.0.1:50000"
+		req.Host = "localhost:8080"
+		rec = httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		c.So(rec.Code, ShouldEqual, http.StatusOK)
+
+		// the live output is not streamed to sockets of remote clients without a token
+		socketstoreMutex.Lock()
+		if socketstore == nil {
+			socketstore = NewSocketStore()
+		}
+		sockets := socketstore.NumSockets()
+		socketstoreMutex.Unlock()
+
+		for _, host := range []string{"zeus.example.com:8080", "localhost:8080"} {
+			req = httptest.NewRequest("GET", "/glue/ws", nil)
+			req.Header.Set("Connection", "Upgrade")
+			req.Header.Set("Upgrade", "websocket")
+			req.Header.Set("Sec-WebSocket-Version", "13")
+			req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+			req.RemoteAddr = "10.0.0.5:50000"
+			req.Host = host
+			rec = httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+			c.So(rec.Code, ShouldEqual, http.StatusUnauthorized)
+
+			broadcast(&dashboardMessage{Type: "output", Command: "dashboard-test", Line: "token=leaked"})
+			c.So(rec.Body.String(), ShouldNotContainSubstring, "leaked")
+
+			req = httptest.NewRequest("POST", "/glue/ajax", strings.NewReader("i"))
+			req.RemoteAddr = "10.0.0.5:50000"
+			req.Host = host
+			rec = httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+			c.So(rec.Code, ShouldEqual, http.StatusUnauthorized)
+		}
+		c.So(socketstore.NumSockets(), ShouldEqual, sockets)
+	})
+}
+
+func TestAPI(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing the REST API", t, func(c C) {
+
+		cmdMap.Lock()
+		cmdMap.items["api-lib"] = &command{name: "api-lib"}
+		cmdMap.items["api-app"] = &command{name: "api-app", dependencies: []string{"api-lib name=test"}}
+		cmdMap.Unlock()
+
+		conf.Lock()
+		conf.fields.APIToken = "secret"
+		conf.Unlock()
+
+		defer func() {
+			cmdMap.Lock()
+			delete(cmdMap.items, "api-lib")
+			delete(cmdMap.items, "api-app")
+			cmdMap.Unlock()
+
+			conf.Lock()
+			conf.fields.APIToken = ""
+			conf.Unlock()
+		}()
+
+		r := createAPIRouter()
+
+		get := func(path, token string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest("GET", path, nil)
+			if token != "" {
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+			return rec
+		}
+
+		// remote requests need the token
+		c.So(get("/api/graph", "").Code, ShouldEqual, http.StatusUnauthorized)
+		c.So(get("/api/graph", "wrong").Code, ShouldEqual, http.StatusUnauthorized)
+
+		rec := get("/api/graph", "secret")
+		c.So(rec.Code, ShouldEqual, http.StatusOK)
+
+		var graph apiGraph
+		c.So(json.Unmarshal(rec.Body.Bytes(), &graph), ShouldBeNil)
+		c.So(graph.Nodes, ShouldContain, "api-app")
+		c.So(graph.Edges, ShouldContain, &apiGraphEdge{From: "api-app", To: "api-lib", Arguments: []string{"name=test"}})
+
+		// runs
+		run := apiRuns.add("api-app", nil)
+		apiRuns.finish(run, errors.New("failed"))
+
+		rec = get("/api/runs/"+run.ID, "secret")
+		c.So(rec.Code, ShouldEqual, http.StatusOK)
+
+		var status apiRun
+		c.So(json.Unmarshal(rec.Body.Bytes(), &status), ShouldBeNil)
+		c.So(status.Status, ShouldEqual, runStatusFailed)
+		c.So(status.Error, ShouldEqual, "failed")
+
+		c.So(get("/api/runs/unknown", "secret").Code, ShouldEqual, http.StatusNotFound)
+		c.So(get("/api/runs", "secret").Code, ShouldEqual, http.StatusOK)
+		c.So(get("/api/logs/api-app", "secret").Code, ShouldEqual, http.StatusNotFound)
+	})
+}
+
+func TestGRPC(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing the gRPC interface", t, func(c C) {
+
+		cmdMap.Lock()
+		cmdMap.items["grpc-lib"] = &command{name: "grpc-lib"}
+		cmdMap.items["grpc-app"] = &command{name: "grpc-app", dependencies: []string{"grpc-lib name=test"}}
+		cmdMap.Unlock()
+
+		conf.Lock()
+		conf.fields.APIToken = "secret"
+		conf.Unlock()
+
+		defer func() {
+			cmdMap.Lock()
+			delete(cmdMap.items, "grpc-lib")
+			delete(cmdMap.items, "grpc-app")
+			cmdMap.Unlock()
+
+			conf.Lock()
+			conf.fields.APIToken = ""
+			conf.Unlock()
+		}()
+
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		c.So(err, ShouldBeNil)
+
+		srv := newGRPCServer()
+		go srv.Serve(lis)
+		defer srv.Stop()
+
+		conn, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+		c.So(err, ShouldBeNil)
+		defer conn.Close()
+
+		var (
+			client = rpc.NewZeusClient(conn)
+			ctx    = context.Background()
+		)
+
+		commands, err := client.ListCommands(ctx, &rpc.ListCommandsRequest{})
+		c.So(err, ShouldBeNil)
+
+		var names []string
+		for _, cmd := range commands.Commands {
+			names = append(names, cmd.Name)
+		}
+		c.So(names, ShouldContain, "grpc-app")
+
+		graph, err := client.GetGraph(ctx, &rpc.GetGraphRequest{})
+		c.So(err, ShouldBeNil)
+		c.So(graph.Nodes, ShouldContain, "grpc-lib")
+
+		var found bool
+		for _, e := range graph.Edges {
+			if e.From == "grpc-app" && e.To == "grpc-lib" && reflect.DeepEqual(e.Arguments, []string{"name=test"}) {
+				found = true
+			}
+		}
+		c.So(found, ShouldBeTrue)
+
+		// cyclic dependencies are rejected before the run starts
+		stream, err := client.RunCommand(ctx, &rpc.RunCommandRequest{Command: "cycle1"})
+		c.So(err, ShouldBeNil)
+		_, err = stream.Recv()
+		c.So(grpcStatus.Code(err), ShouldEqual, codes.InvalidArgument)
+
+		// cancel
+		_, err = client.CancelRun(ctx, &rpc.CancelRunRequest{Id: "unknown"})
+		c.So(grpcStatus.Code(err), ShouldEqual, codes.NotFound)
+
+		run := apiRuns.add("grpc-app", nil)
+		res, err := client.CancelRun(ctx, &rpc.CancelRunRequest{Id: run.ID})
+		c.So(err, ShouldBeNil)
+		c.So(res.Status, ShouldEqual, runStatusCanceled)
+
+		apiRuns.finish(run, errors.New("killed"))
+		status, _ := apiRuns.get(run.ID)
+		c.So(status.Status, ShouldEqual, runStatusCanceled)
+
+		_, err = client.CancelRun(ctx, &rpc.CancelRunRequest{Id: run.ID})
+		c.So(grpcStatus.Code(err), ShouldEqual, codes.FailedPrecondition)
+
+		// remote calls need the token
+		remote := peer.NewContext(ctx, &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1234}})
+		c.So(grpcAuthorized(remote), ShouldBeFalse)
+		c.So(grpcAuthorized(metadata.NewIncomingContext(remote, metadata.Pairs("authorization", "Bearer wrong"))), ShouldBeFalse)
+		c.So(grpcAuthorized(metadata.NewIncomingContext(remote, metadata.Pairs("authorization", "Bearer secret"))), ShouldBeTrue)
+
+		// local calls need a local authority
+		local := peer.NewContext(ctx, &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 1234}})
+		c.So(grpcAuthorized(metadata.NewIncomingContext(local, metadata.Pairs(":authority", "localhost:50051"))), ShouldBeTrue)
+		c.So(grpcAuthorized(metadata.NewIncomingContext(local, metadata.Pairs(":authority", "rebind.example.com:50051"))), ShouldBeFalse)
+
+		// output is delivered to listeners
+		ch := outputListeners.add()
+		c.So(outputListeners.active(), ShouldBeTrue)
+		broadcast(&dashboardMessage{Type: "output", Command: "grpc-app", Stream: "stdout", Line: "hello"})
+		msg := <-ch
+		c.So(msg.Line, ShouldEqual, "hello")
+		outputListeners.remove(ch)
+		c.So(outputListeners.active(), ShouldBeFalse)
+	})
+}
+
+func TestLSP(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing the language server", t, func(c C) {
+
+		var (
+			in  bytes.Buffer
+			out bytes.Buffer
+			uri = "file:///project/zeus/commands.yml"
+			doc = strings.Join([]string{
+				"language: bash",
+				"commands:",
+				"    lib:",
+				"        description: build the library",
+				"        arguments:",
+				"            - name:String",
+				"            - count:Int?",
+				"            - broken:Strin",
+				"    app:",
+				"        unknownField: true",
+				"        dependencies:",
+				"            - lib name=test count=abc",
+				"            - missing",
+				"            - ",
+			}, "\n")
+			id = 0
+		)
+
+		send := func(method string, params interface{}) {
+			id++
+			c, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": id, "method": method, "params": params})
+			in.WriteString("Content-Length: " + strconv.Itoa(len(c)) + "\r\n\r\n" + string(c))
+		}
+		notify := func(method string, params interface{}) {
+			c, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params})
+			in.WriteString("Content-Length: " + strconv.Itoa(len(c)) + "\r\n\r\n" + string(c))
+		}
+		position := func(line, character int) map[string]interface{} {
+			return map[string]interface{}{
+				"textDocument": map[string]string{"uri": uri},
+				"position":     map[string]int{"line": line, "character": character},
+			}
+		}
+
+		send("initialize", map[string]interface{}{})
+		notify("textDocument/didOpen", map[string]interface{}{
+			"textDocument": map[string]string{"uri": uri, "text": doc},
+		})
+		send("textDocument/completion", position(13, 14))
+		send("textDocument/completion", position(11, 18))
+		send("textDocument/hover", position(11, 15))
+		send("textDocument/definition", position(11, 15))
+		send("shutdown", nil)
+		notify("exit", nil)
+
+		c.So(serveLSP(&in, &out), ShouldEqual, 0)
+
+		// decode all messages sent by the server
+		var messages []map[string]interface{}
+		for _, part := range strings.Split(out.String(), "Content-Length: ")[1:] {
+			body := part[strings.Index(part, "\r\n\r\n")+4:]
+			var m map[string]interface{}
+			c.So(json.Unmarshal([]byte(body), &m), ShouldBeNil)
+			messages = append(messages, m)
+		}
+		c.So(len(messages), ShouldEqual, 7)
+
+		// diagnostics
+		var diagnostics []string
+		for _, d := range messages[1]["params"].(map[string]interface{})["diagnostics"].([]interface{}) {
+			diagnostics = append(diagnostics, d.(map[string]interface{})["message"].(string))
+		}
+		c.So(diagnostics, ShouldContain, "invalid or missing argument type: broken:Strin")
+		c.So(diagnostics, ShouldContain, "unknown field: unknownField")
+		c.So(diagnostics, ShouldContain, "unknown dependency: missing")
+		c.So(strings.Join(diagnostics, "\n"), ShouldContainSubstring, `got "abc"`)
+
+		labels := func(m map[string]interface{}) (res []string) {
+			for _, item := range m["result"].([]interface{}) {
+				res = append(res, item.(map[string]interface{})["label"].(string))
+			}
+			return
+		}
+
+		// dependency names and dependency arguments
+		c.So(labels(messages[2]), ShouldContain, "lib")
+		c.So(labels(messages[3]), ShouldContain, "count=")
+
+		// hover and definition of the dependency
+		c.So(messages[4]["result"].(map[string]interface{})["contents"].(map[string]interface{})["value"], ShouldContainSubstring, "build the library")
+		c.So(messages[5]["result"].(map[string]interface{})["range"].(map[string]interface{})["start"].(map[string]interface{})["line"], ShouldEqual, 2)
+	})
+}
+
+func TestCredentialHelpers(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing credential helpers", t, func(c C) {
+
+		dir, err := ioutil.TempDir("", "zeus-credentials")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		var (
+			jsonHelper = filepath.Join(dir, "json-helper")
+			rawHelper  = filepath.Join(dir, "raw-helper")
+			calls      = filepath.Join(dir, "calls")
+		)
+
+		// docker style helper, echoes the server URL from stdin
+		c.So(ioutil.WriteFile(jsonHelper, []byte("#!/bin/sh\n"+
+			"echo $1 >> "+calls+"\n"+
+			"read url\n"+
+			"echo \"{\\\"ServerURL\\\": \\\"$url\\\", \\\"Username\\\": \\\"ci\\\", \\\"Secret\\\": \\\"json-secret\\\"}\"\n"), 0700), ShouldBeNil)
+		c.So(ioutil.WriteFile(rawHelper, []byte("#!/bin/sh\necho \"  raw-secret $2\"\n"), 0700), ShouldBeNil)
+
+		conf.Lock()
+		conf.fields.CredentialHelpers = map[string]string{
+			"api.github.com": jsonHelper,
+			"*":              rawHelper + " --profile",
+		}
+		conf.Unlock()
+
+		os.Setenv("ZEUS_TEST_TOKEN", "env-secret")
+
+		defer func() {
+			conf.Lock()
+			conf.fields.CredentialHelpers = nil
+			conf.Unlock()
+
+			os.Unsetenv("ZEUS_TEST_TOKEN")
+
+			credentialCache.Lock()
+			credentialCache.items = make(map[string]string, 0)
+			credentialCache.Unlock()
+		}()
+
+		token, err := credentialToken("https://api.github.com", "ZEUS_TEST_TOKEN")
+		c.So(err, ShouldBeNil)
+		c.So(token, ShouldEqual, "json-secret")
+
+		// the helper runs only once per host
+		token, err = credentialToken("https://api.github.com/repos", "ZEUS_TEST_TOKEN")
+		c.So(err, ShouldBeNil)
+		c.So(token, ShouldEqual, "json-secret")
+
+		out, err := ioutil.ReadFile(calls)
+		c.So(err, ShouldBeNil)
+		c.So(string(out), ShouldEqual, "get\n")
+
+		// plain output with arguments from the config, for all other hosts
+		token, err = credentialToken("https://cache.example.com", "ZEUS_TEST_TOKEN")
+		c.So(err, ShouldBeNil)
+		c.So(token, ShouldEqual, "raw-secret get")
+
+		// fall back to the environment without helpers
+		conf.Lock()
+		conf.fields.CredentialHelpers = map[string]string{}
+		conf.Unlock()
+
+		token, err = credentialToken("https://other.example.com", "ZEUS_TEST_TOKEN")
+		c.So(err, ShouldBeNil)
+		c.So(token, ShouldEqual, "env-secret")
+		c.So(hasCredentials("https://other.example.com", "ZEUS_UNSET_TOKEN"), ShouldBeFalse)
+	})
+}
+
+func TestStaticServer(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing the static file server", t, func(c C) {
+
+		dir, err := ioutil.TempDir("", "zeus-static")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		c.So(ioutil.WriteFile(filepath.Join(dir, "index.html"), []byte("index"), 0644), ShouldBeNil)
+		c.So(ioutil.WriteFile(filepath.Join(dir, "app.js"), []byte("app"), 0644), ShouldBeNil)
+
+		get := func(h http.Handler, path string) *httptest.ResponseRecorder {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+			return rec
+		}
+
+		files := staticHandler(dir, false)
+		c.So(get(files, "/app.js").Body.String(), ShouldEqual, "app")
+		c.So(get(files, "/dashboard/settings").Code, ShouldEqual, http.StatusNotFound)
+
+		spa := staticHandler(dir, true)
+		c.So(get(spa, "/app.js").Body.String(), ShouldEqual, "app")
+		c.So(get(spa, "/dashboard/settings").Body.String(), ShouldEqual, "index")
+
+		// arguments
+		d, err := parseStaticServerArgs([]string{"serve", "--static", "docs", "--port", "9000", "--spa"})
+		c.So(err, ShouldBeNil)
+		c.So(d, ShouldResemble, &staticServerData{Dir: "docs", Port: 9000, SPA: true})
+
+		d, err = parseStaticServerArgs([]string{"serve", "--static", "docs"})
+		c.So(err, ShouldBeNil)
+		c.So(d.Port, ShouldEqual, defaultStaticPort)
+
+		_, err = parseStaticServerArgs([]string{"serve", "--static", "docs", "--port"})
+		c.So(err, ShouldNotBeNil)
+
+		// commands with a serve section run zeus as static file server
+		data := &commandData{Serve: &staticServerData{Dir: "docs", SPA: true}}
+		c.So(data.init(newCommandsFile(), "static-docs"), ShouldBeNil)
+		defer func() {
+			cmdMap.Lock()
+			delete(cmdMap.items, "static-docs")
+			cmdMap.Unlock()
+		}()
+
+		cmd, err := cmdMap.getCommand("static-docs")
+		c.So(err, ShouldBeNil)
+		c.So(cmd.language, ShouldEqual, "bash")
+		c.So(cmd.exec, ShouldContainSubstring, "serve --static 'docs' --port 8000 --spa")
+
+		data = &commandData{Exec: "echo", Serve: &staticServerData{Dir: "docs"}}
+		c.So(data.init(newCommandsFile(), "static-invalid"), ShouldNotBeNil)
+	})
+}
+
+func TestPorts(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing port conflict detection", t, func(c C) {
+
+		_, err := validatePorts([]string{"8080"})
+		c.So(err, ShouldNotBeNil)
+		_, err = validatePorts([]string{"PORT=http"})
+		c.So(err, ShouldNotBeNil)
+
+		ln, err := net.Listen("tcp", ":0")
+		c.So(err, ShouldBeNil)
+		defer ln.Close()
+
+		port := ln.Addr().(*net.TCPAddr).Port
+		ports, err := validatePorts([]string{"TEST_PORT = " + strconv.Itoa(port)})
+		c.So(err, ShouldBeNil)
+		c.So(ports[0].variable, ShouldEqual, "TEST_PORT")
+
+		cmd := &command{name: "service", ports: ports}
+		defer func() {
+			g.Lock()
+			delete(g.Vars, "TEST_PORT")
+			g.Unlock()
+			conf.Lock()
+			conf.fields.PortConflicts = portConflictsFail
+			conf.Unlock()
+		}()
+
+		err = cmd.reservePorts()
+		c.So(err, ShouldNotBeNil)
+		c.So(err.Error(), ShouldStartWith, ErrPortInUse.Error()+": "+strconv.Itoa(port))
+
+		conf.Lock()
+		conf.fields.PortConflicts = portConflictsAllocate
+		conf.Unlock()
+
+		c.So(cmd.reservePorts(), ShouldBeNil)
+
+		g.Lock()
+		allocated := g.Vars["TEST_PORT"]
+		g.Unlock()
+		c.So(allocated, ShouldNotEqual, strconv.Itoa(port))
+		c.So(allocated, ShouldNotBeEmpty)
+	})
+}
+
+func TestReproducible(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing reproducible mode", t, func(c C) {
+
+		previous, hadPrevious := os.LookupEnv(sourceDateEpochEnv)
+		defer func() {
+			if hadPrevious {
+				os.Setenv(sourceDateEpochEnv, previous)
+			} else {
+				os.Unsetenv(sourceDateEpochEnv)
+			}
+			reproducibleRun = false
+		}()
+
+		os.Unsetenv(sourceDateEpochEnv)
+		reproducibleRun = false
+
+		_, ok := sourceDateEpoch()
+		c.So(ok, ShouldBeFalse)
+		c.So(sourceDateEpochEnvEntry(), ShouldBeEmpty)
+
+		// the environment is honored without reproducible mode
+		os.Setenv(sourceDateEpochEnv, "1500000000")
+		c.So(artifactTime().Unix(), ShouldEqual, 1500000000)
+		c.So(sourceDateEpochEnvEntry(), ShouldBeEmpty)
+
+		// reproducible mode exports the time of the latest commit
+		os.Unsetenv(sourceDateEpochEnv)
+		reproducibleRun = true
+		c.So(reproducible(), ShouldBeTrue)
+		c.So(sourceDateEpochEnvEntry(), ShouldStartWith, sourceDateEpochEnv+"=")
+
+		c.So(stableUUID("bin/zeus:abc"), ShouldEqual, stableUUID("bin/zeus:abc"))
+		c.So(stableUUID("bin/zeus:abc"), ShouldNotEqual, stableUUID("bin/zeus:abd"))
+		c.So(documentUUID("bin/zeus", "abc"), ShouldEqual, documentUUID("bin/zeus", "abc"))
+	})
+}